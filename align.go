@@ -0,0 +1,166 @@
+package ftdc
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// Interp describes how AlignSeries estimates the value of a series at
+// times between its samples.
+type Interp string
+
+const (
+	// InterpPrevious uses the value of the most recent sample at or
+	// before each time (i.e. last observation carried forward.)
+	InterpPrevious Interp = "previous"
+	// InterpLinear interpolates linearly between the samples
+	// before and after each time. Times after the last sample of
+	// a series have no value.
+	InterpLinear Interp = "linear"
+)
+
+// Validate returns an error if the interpolation method is not one of
+// the defined methods.
+func (i Interp) Validate() error {
+	switch i {
+	case InterpPrevious, InterpLinear:
+		return nil
+	default:
+		return errors.Errorf("invalid interpolation method '%s'", i)
+	}
+}
+
+// MetricSeries is a sequence of timestamped values of a metric, to be
+// aligned with other series by AlignSeries. The times must be in
+// increasing order.
+type MetricSeries struct {
+	// Name identifies the series in the aligned output. When
+	// series come from different sources, include the source in
+	// the name (e.g. "client/opcounters.insert").
+	Name   string
+	Times  []time.Time
+	Values []float64
+}
+
+// MetricSeries returns the values of the stitched series as a named
+// series for AlignSeries. Integer values beyond the precision of a
+// double are rounded.
+func (s *StitchedSeries) MetricSeries(name string) MetricSeries {
+	out := MetricSeries{
+		Name:   name,
+		Times:  s.Times,
+		Values: make([]float64, len(s.Values)),
+	}
+
+	for idx, v := range s.Values {
+		if s.Type == bsontype.Double {
+			out.Values[idx] = restoreFloat(v)
+		} else {
+			out.Values[idx] = float64(v)
+		}
+	}
+
+	return out
+}
+
+// AlignedSeries holds the values of several series resampled onto
+// a common grid of times.
+type AlignedSeries struct {
+	Times []time.Time
+	Names []string
+	// Values holds a slice for each series, in the order of
+	// Names, with a value for each time. Values are NaN at times
+	// for which the series has no value, such as before its first
+	// sample.
+	Values [][]float64
+}
+
+// AlignSeries resamples the series, which may come from different
+// files or collectors, onto a common grid of times, so that the values
+// of the series can be correlated sample by sample. The grid has a
+// time for every multiple of the step since the Unix epoch from the
+// earliest sample of any series to the latest, and the value of each
+// series at each time is estimated with the interpolation method.
+//
+// Returns an error if the step is not positive, if the method is not
+// valid, or if a series does not have a value for each time, or its
+// times are not in increasing order.
+func AlignSeries(series []MetricSeries, step time.Duration, method Interp) (*AlignedSeries, error) {
+	if step <= 0 {
+		return nil, errors.New("step must be positive")
+	}
+	if err := method.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var first, last time.Time
+	for _, s := range series {
+		if len(s.Times) != len(s.Values) {
+			return nil, errors.Errorf("series '%s' has %d times and %d values", s.Name, len(s.Times), len(s.Values))
+		}
+		if len(s.Times) == 0 {
+			continue
+		}
+		for idx := 1; idx < len(s.Times); idx++ {
+			if !s.Times[idx].After(s.Times[idx-1]) {
+				return nil, errors.Errorf("times of series '%s' are not increasing at sample %d", s.Name, idx)
+			}
+		}
+
+		if first.IsZero() || s.Times[0].Before(first) {
+			first = s.Times[0]
+		}
+		if last.IsZero() || s.Times[len(s.Times)-1].After(last) {
+			last = s.Times[len(s.Times)-1]
+		}
+	}
+
+	out := &AlignedSeries{
+		Names:  make([]string, len(series)),
+		Values: make([][]float64, len(series)),
+	}
+	if !first.IsZero() {
+		for ts := first.Truncate(step); !ts.After(last); ts = ts.Add(step) {
+			out.Times = append(out.Times, ts)
+		}
+	}
+
+	for idx, s := range series {
+		out.Names[idx] = s.Name
+		out.Values[idx] = s.resample(out.Times, method)
+	}
+
+	return out, nil
+}
+
+// resample returns the values of the series at each of the times,
+// which must be in increasing order.
+func (s *MetricSeries) resample(times []time.Time, method Interp) []float64 {
+	out := make([]float64, len(times))
+
+	// next is the index of the first sample after the current
+	// time, and advances with it.
+	next := 0
+	for idx, ts := range times {
+		next += sort.Search(len(s.Times)-next, func(i int) bool { return s.Times[next+i].After(ts) })
+
+		switch {
+		case next == 0:
+			out[idx] = math.NaN()
+		case method == InterpPrevious || s.Times[next-1].Equal(ts):
+			out[idx] = s.Values[next-1]
+		case next == len(s.Times):
+			out[idx] = math.NaN()
+		default:
+			t0, t1 := s.Times[next-1], s.Times[next]
+			v0, v1 := s.Values[next-1], s.Values[next]
+			out[idx] = v0 + (v1-v0)*float64(ts.Sub(t0))/float64(t1.Sub(t0))
+		}
+	}
+
+	return out
+}
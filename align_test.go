@@ -0,0 +1,102 @@
+package ftdc
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlignSeries(t *testing.T) {
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return base.Add(time.Duration(ms) * time.Millisecond) }
+
+	// the server samples every second, and the client samples
+	// every 400ms, starting later, and offset from the server.
+	server := MetricSeries{
+		Name:   "server/counter",
+		Times:  []time.Time{at(0), at(1000), at(2000), at(3000)},
+		Values: []float64{0, 10, 20, 40},
+	}
+	client := MetricSeries{
+		Name:   "client/latency",
+		Times:  []time.Time{at(1250), at(1650), at(2050), at(2450)},
+		Values: []float64{4, 8, 2, 6},
+	}
+
+	t.Run("Previous", func(t *testing.T) {
+		aligned, err := AlignSeries([]MetricSeries{server, client}, 500*time.Millisecond, InterpPrevious)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"server/counter", "client/latency"}, aligned.Names)
+		require.Len(t, aligned.Times, 7)
+		for idx, ts := range aligned.Times {
+			assert.Equal(t, at(500*idx), ts)
+		}
+
+		require.Len(t, aligned.Values, 2)
+		assert.Equal(t, []float64{0, 0, 10, 10, 20, 20, 40}, aligned.Values[0])
+
+		require.Len(t, aligned.Values[1], 7)
+		for idx := 0; idx < 3; idx++ {
+			assert.True(t, math.IsNaN(aligned.Values[1][idx]))
+		}
+		// the last sample is carried forward.
+		assert.Equal(t, []float64{4, 8, 6, 6}, aligned.Values[1][3:])
+	})
+	t.Run("Linear", func(t *testing.T) {
+		aligned, err := AlignSeries([]MetricSeries{server, client}, 500*time.Millisecond, InterpLinear)
+		require.NoError(t, err)
+		require.Len(t, aligned.Times, 7)
+		assert.Equal(t, []float64{0, 5, 10, 15, 20, 30, 40}, aligned.Values[0])
+
+		values := aligned.Values[1]
+		require.Len(t, values, 7)
+		assert.True(t, math.IsNaN(values[2]))
+		assert.InDelta(t, 6.5, values[3], 1e-9)
+		assert.InDelta(t, 2.75, values[4], 1e-9)
+		// there is no value after the last sample.
+		assert.True(t, math.IsNaN(values[5]))
+		assert.True(t, math.IsNaN(values[6]))
+	})
+	t.Run("GridAlignment", func(t *testing.T) {
+		aligned, err := AlignSeries([]MetricSeries{client}, time.Second, InterpPrevious)
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{at(1000), at(2000)}, aligned.Times)
+		assert.True(t, math.IsNaN(aligned.Values[0][0]))
+		assert.Equal(t, 8.0, aligned.Values[0][1])
+	})
+	t.Run("Empty", func(t *testing.T) {
+		aligned, err := AlignSeries(nil, time.Second, InterpLinear)
+		require.NoError(t, err)
+		assert.Len(t, aligned.Times, 0)
+
+		aligned, err = AlignSeries([]MetricSeries{{Name: "empty"}, server}, time.Second, InterpLinear)
+		require.NoError(t, err)
+		require.Len(t, aligned.Times, 4)
+		for _, v := range aligned.Values[0] {
+			assert.True(t, math.IsNaN(v))
+		}
+	})
+	t.Run("Errors", func(t *testing.T) {
+		_, err := AlignSeries([]MetricSeries{server}, 0, InterpLinear)
+		assert.Error(t, err)
+		_, err = AlignSeries([]MetricSeries{server}, time.Second, Interp("cubic"))
+		assert.Error(t, err)
+		_, err = AlignSeries([]MetricSeries{{Name: "short", Times: server.Times, Values: []float64{1}}}, time.Second, InterpLinear)
+		assert.Error(t, err)
+		_, err = AlignSeries([]MetricSeries{{Name: "unordered", Times: []time.Time{at(1000), at(0)}, Values: []float64{1, 2}}}, time.Second, InterpLinear)
+		assert.Error(t, err)
+	})
+	t.Run("StitchedSeries", func(t *testing.T) {
+		ints := &StitchedSeries{Key: "a", Type: bsontype.Int64, Times: server.Times[:2], Values: []int64{3, 7}}
+		series := ints.MetricSeries("server/a")
+		assert.Equal(t, "server/a", series.Name)
+		assert.Equal(t, []float64{3, 7}, series.Values)
+
+		doubles := &StitchedSeries{Key: "b", Type: bsontype.Double, Times: server.Times[:2], Values: []int64{normalizeFloat(1.5), normalizeFloat(-2.25)}}
+		assert.Equal(t, []float64{1.5, -2.25}, doubles.MetricSeries("b").Values)
+	})
+}
@@ -0,0 +1,226 @@
+// Package analysis provides simple detectors of anomalies in the
+// metrics of FTDC data (e.g. spikes, counter resets, and metrics that
+// are saturated at their limits), which produce findings that make up
+// a first pass triage report of a capture.
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// Kind identifies the detector that produced a finding.
+type Kind string
+
+const (
+	KindSpike        Kind = "spike"
+	KindCounterReset Kind = "counter-reset"
+	KindSaturation   Kind = "saturation"
+)
+
+// Finding is an anomaly in the values of a metric.
+type Finding struct {
+	Kind Kind
+	Key  string
+	// Time is the time of the sample at which the anomaly began.
+	Time time.Time
+	// Value is the value of the metric at the sample that
+	// produced the finding.
+	Value float64
+	// Description explains the finding, e.g. the deviation of a
+	// spike from the median of the preceding values.
+	Description string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s [%s] %s: %s", f.Time.UTC().Format(time.RFC3339), f.Kind, f.Key, f.Description)
+}
+
+// Detector finds anomalies in the values of metrics. Detectors are
+// configured with options, and keep the state of each metric in the
+// Series that they return.
+type Detector interface {
+	// Validate ensures that the options of the detector are
+	// reasonable, and sets default values.
+	Validate() error
+	// Series returns the state of the detector for a metric, or
+	// nil if the detector does not apply to the metric.
+	Series(key string, t bsontype.Type) Series
+}
+
+// Series detects anomalies in the values of one metric.
+type Series interface {
+	// Add examines the next value of the metric, and returns a
+	// finding, or nil if the value is not anomalous.
+	Add(ts time.Time, value float64) *Finding
+}
+
+// Options configure Analyze.
+type Options struct {
+	// Detectors are run over the values of every metric. Defaults
+	// to a spike detector and a counter reset detector, with
+	// their default options.
+	Detectors []Detector
+	// Keys selects the metrics that are analyzed. Defaults to all
+	// metrics.
+	Keys ftdc.KeyMatcher
+	// TimeKey is the key of the date time metric that holds the
+	// time of each sample. Defaults to the first date time metric
+	// in each chunk.
+	TimeKey string
+}
+
+// Validate ensures that the options are reasonable, and sets default
+// values.
+func (opts *Options) Validate() error {
+	if len(opts.Detectors) == 0 {
+		opts.Detectors = []Detector{&SpikeDetector{}, &CounterResetDetector{}}
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for idx, detector := range opts.Detectors {
+		if detector == nil {
+			catcher.Errorf("detector %d is nil", idx)
+			continue
+		}
+		catcher.Wrapf(detector.Validate(), "invalid detector %d", idx)
+	}
+	return catcher.Resolve()
+}
+
+// metricState holds the series of the detectors for a metric.
+type metricState struct {
+	kind   bsontype.Type
+	series []Series
+}
+
+// Analyze runs the detectors over the values of the metrics in a
+// stream of chunks, and returns the findings, ordered by time. The
+// state of the detectors for a metric carries over between chunks, so
+// that, for example, the window of a spike detector spans chunks,
+// unless the type of the metric changes.
+//
+// Only double, int32, and int64 metrics are analyzed, and values that
+// are NaN or infinite are ignored. Returns an error if a chunk does
+// not have a time metric, or if there are any errors reading chunks.
+func Analyze(ctx context.Context, iter *ftdc.ChunkIterator, opts Options) ([]Finding, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+
+	states := map[string]*metricState{}
+	out := []Finding{}
+	for iter.Next() {
+		if ctx.Err() != nil {
+			return nil, errors.New("operation aborted")
+		}
+
+		chunk := iter.Chunk()
+		timeMetric := analysisTimeMetric(chunk, opts.TimeKey)
+		if timeMetric == nil {
+			if opts.TimeKey != "" {
+				return nil, errors.Errorf("chunk does not have the date time metric '%s'", opts.TimeKey)
+			}
+			return nil, errors.New("chunk does not have a date time metric")
+		}
+
+		times := make([]time.Time, len(timeMetric.Values))
+		for i, value := range timeMetric.Values {
+			times[i] = time.Unix(value/1000, value%1000*int64(time.Millisecond))
+		}
+
+		for idx := range chunk.Metrics {
+			m := &chunk.Metrics[idx]
+			if !isNumeric(m.Type()) {
+				continue
+			}
+			key := m.Key()
+			if opts.Keys != nil && !opts.Keys.MatchKey(key) {
+				continue
+			}
+
+			state, ok := states[key]
+			if !ok || state.kind != m.Type() {
+				state = &metricState{kind: m.Type()}
+				for _, detector := range opts.Detectors {
+					if series := detector.Series(key, m.Type()); series != nil {
+						state.series = append(state.series, series)
+					}
+				}
+				states[key] = state
+			}
+			if len(state.series) == 0 {
+				continue
+			}
+
+			for i, raw := range m.Values {
+				value := metricValue(m.Type(), raw)
+				if math.IsNaN(value) || math.IsInf(value, 0) {
+					continue
+				}
+				for _, series := range state.series {
+					if finding := series.Add(times[i], value); finding != nil {
+						out = append(out, *finding)
+					}
+				}
+			}
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, errors.Wrap(err, "problem reading chunks")
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out, nil
+}
+
+// WriteReport writes the findings to the writer, one per line, in a
+// format suitable for people to read.
+func WriteReport(w io.Writer, findings []Finding) error {
+	for _, finding := range findings {
+		if _, err := fmt.Fprintln(w, finding.String()); err != nil {
+			return errors.Wrap(err, "problem writing report")
+		}
+	}
+	return nil
+}
+
+func analysisTimeMetric(chunk *ftdc.Chunk, key string) *ftdc.Metric {
+	for idx := range chunk.Metrics {
+		m := &chunk.Metrics[idx]
+		if m.Type() != bsontype.DateTime {
+			continue
+		}
+		if key == "" || m.Key() == key {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func isNumeric(t bsontype.Type) bool {
+	switch t {
+	case bsontype.Double, bsontype.Int32, bsontype.Int64:
+		return true
+	default:
+		return false
+	}
+}
+
+func metricValue(t bsontype.Type, value int64) float64 {
+	if t == bsontype.Double {
+		return math.Float64frombits(uint64(value))
+	}
+	return float64(value)
+}
@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyze(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	capture := func(t *testing.T, samples int, sample func(int) *bsonx.Document) []byte {
+		buf := &bytes.Buffer{}
+		collector := ftdc.NewStreamingCollector(25, buf)
+		for i := 0; i < samples; i++ {
+			doc := bsonx.NewDocument(bsonx.EC.Time("ts", start.Add(time.Duration(i)*time.Second)))
+			iter := sample(i).Iterator()
+			for iter.Next() {
+				doc.Append(iter.Element())
+			}
+			require.NoError(t, iter.Err())
+			require.NoError(t, collector.Add(doc))
+		}
+		require.NoError(t, ftdc.FlushCollector(collector, buf))
+		return buf.Bytes()
+	}
+
+	// the capture holds a counter that resets at sample 70, a
+	// gauge that spikes at sample 80, and a pool that is
+	// saturated from sample 90.
+	data := capture(t, 100, func(i int) *bsonx.Document {
+		counter := int64(i * 10)
+		if i >= 70 {
+			counter = int64(i - 70)
+		}
+		gauge := int64(50 + i%5)
+		if i == 80 {
+			gauge = 5000
+		}
+		pool := int64(i % 10)
+		if i >= 90 {
+			pool = 20
+		}
+		return bsonx.NewDocument(
+			bsonx.EC.Int64("counter", counter),
+			bsonx.EC.SubDocument("pool", bsonx.NewDocument(
+				bsonx.EC.Int64("gauge", gauge),
+				bsonx.EC.Int32("used", int32(pool)),
+			)),
+			bsonx.EC.Boolean("up", true),
+		)
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		findings, err := Analyze(ctx, ftdc.ReadChunks(ctx, bytes.NewReader(data)), Options{})
+		require.NoError(t, err)
+		require.Len(t, findings, 2)
+
+		assert.Equal(t, KindCounterReset, findings[0].Kind)
+		assert.Equal(t, "counter", findings[0].Key)
+		assert.Equal(t, start.Add(70*time.Second), findings[0].Time.UTC())
+
+		assert.Equal(t, KindSpike, findings[1].Kind)
+		assert.Equal(t, "pool.gauge", findings[1].Key)
+		assert.Equal(t, start.Add(80*time.Second), findings[1].Time.UTC())
+		assert.Equal(t, 5000.0, findings[1].Value)
+	})
+	t.Run("Detectors", func(t *testing.T) {
+		matcher, err := ftdc.NewGlobMatcher("pool.*")
+		require.NoError(t, err)
+		findings, err := Analyze(ctx, ftdc.ReadChunks(ctx, bytes.NewReader(data)), Options{
+			Keys: matcher,
+			Detectors: []Detector{
+				&SaturationDetector{Limits: map[string]float64{"pool.used": 20}},
+				&SpikeDetector{Window: 20},
+			},
+		})
+		require.NoError(t, err)
+		kinds := []Kind{}
+		for _, finding := range findings {
+			kinds = append(kinds, finding.Kind)
+		}
+		assert.Equal(t, []Kind{KindSpike, KindSaturation}, kinds, "%v", findings)
+		assert.Equal(t, start.Add(90*time.Second), findings[1].Time.UTC())
+	})
+	t.Run("Keys", func(t *testing.T) {
+		matcher, err := ftdc.NewGlobMatcher("pool.*")
+		require.NoError(t, err)
+		findings, err := Analyze(ctx, ftdc.ReadChunks(ctx, bytes.NewReader(data)), Options{Keys: matcher})
+		require.NoError(t, err)
+		require.Len(t, findings, 1)
+		assert.Equal(t, "pool.gauge", findings[0].Key)
+	})
+	t.Run("Report", func(t *testing.T) {
+		findings, err := Analyze(ctx, ftdc.ReadChunks(ctx, bytes.NewReader(data)), Options{})
+		require.NoError(t, err)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, WriteReport(buf, findings))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+		assert.Equal(t, "2018-06-01T12:01:10Z [counter-reset] counter: counter decreased from 690 to 0 after increasing for 69 samples", lines[0])
+		assert.True(t, strings.HasPrefix(lines[1], "2018-06-01T12:01:20Z [spike] pool.gauge: value 5000 is "), lines[1])
+	})
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for name, opts := range map[string]Options{
+			"Nil":        {Detectors: []Detector{nil}},
+			"Saturation": {Detectors: []Detector{&SaturationDetector{}}},
+		} {
+			_, err := Analyze(ctx, ftdc.ReadChunks(ctx, bytes.NewReader(data)), opts)
+			assert.Error(t, err, name)
+		}
+	})
+	t.Run("MissingTime", func(t *testing.T) {
+		collector := ftdc.NewBaseCollector(10)
+		require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("a", 1))))
+		out, err := collector.Resolve()
+		require.NoError(t, err)
+
+		_, err = Analyze(ctx, ftdc.ReadChunks(ctx, bytes.NewReader(out)), Options{})
+		assert.Error(t, err)
+		_, err = Analyze(ctx, ftdc.ReadChunks(ctx, bytes.NewReader(data)), Options{TimeKey: "other"})
+		assert.Error(t, err)
+	})
+	t.Run("Canceled", func(t *testing.T) {
+		cctx, ccancel := context.WithCancel(ctx)
+		ccancel()
+		_, err := Analyze(cctx, ftdc.ReadChunks(ctx, bytes.NewReader(data)), Options{})
+		assert.Error(t, err)
+	})
+}
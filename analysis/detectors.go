@@ -0,0 +1,291 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// madScale scales the median absolute deviation so that it estimates
+// the standard deviation of normally distributed values.
+const madScale = 1.4826
+
+// SpikeDetector finds values that deviate from the median of the
+// preceding values of a metric by more than a number of median
+// absolute deviations (MAD), which, unlike the standard deviation, is
+// not inflated by the spikes themselves. Consecutive anomalous values
+// produce one finding, for the first value. Metrics whose preceding
+// values do not vary (i.e. with a MAD of zero) never have spikes.
+type SpikeDetector struct {
+	// Window is the number of preceding values whose median the
+	// detector compares values with, and the detector does not
+	// examine the first Window values of a metric. Defaults to 60.
+	Window int
+	// Threshold is the number of MADs, scaled to estimate the
+	// standard deviation, that values must deviate from the
+	// median to be spikes. Defaults to 6.
+	Threshold float64
+}
+
+// Validate ensures that the options are reasonable, and sets default
+// values.
+func (d *SpikeDetector) Validate() error {
+	if d.Window < 0 {
+		return errors.New("window must not be negative")
+	}
+	if d.Threshold < 0 {
+		return errors.New("threshold must not be negative")
+	}
+
+	if d.Window == 0 {
+		d.Window = 60
+	}
+	if d.Threshold == 0 {
+		d.Threshold = 6
+	}
+	return nil
+}
+
+// Series returns the state of the detector for the metric.
+func (d *SpikeDetector) Series(key string, _ bsontype.Type) Series {
+	return &spikeSeries{
+		opts:    d,
+		key:     key,
+		window:  make([]float64, 0, d.Window),
+		scratch: make([]float64, d.Window),
+	}
+}
+
+type spikeSeries struct {
+	opts      *SpikeDetector
+	key       string
+	window    []float64
+	next      int
+	scratch   []float64
+	anomalous bool
+}
+
+func (s *spikeSeries) Add(ts time.Time, value float64) *Finding {
+	var out *Finding
+	if len(s.window) == s.opts.Window {
+		median, mad := s.deviation()
+		score := math.Abs(value-median) / (madScale * mad)
+		if mad > 0 && score >= s.opts.Threshold {
+			if !s.anomalous {
+				out = &Finding{
+					Kind:  KindSpike,
+					Key:   s.key,
+					Time:  ts,
+					Value: value,
+					Description: fmt.Sprintf("value %g is %.1f deviations from the median %g of the previous %d values",
+						value, score, median, s.opts.Window),
+				}
+			}
+			s.anomalous = true
+		} else {
+			s.anomalous = false
+		}
+	}
+
+	if len(s.window) < s.opts.Window {
+		s.window = append(s.window, value)
+	} else {
+		s.window[s.next] = value
+		s.next = (s.next + 1) % s.opts.Window
+	}
+
+	return out
+}
+
+// deviation returns the median and the median absolute deviation of
+// the values in the window.
+func (s *spikeSeries) deviation() (float64, float64) {
+	values := s.scratch[:len(s.window)]
+	copy(values, s.window)
+	median := medianOf(values)
+
+	for idx := range values {
+		values[idx] = math.Abs(values[idx] - median)
+	}
+	return median, medianOf(values)
+}
+
+// medianOf returns the median of the values, which it sorts.
+func medianOf(values []float64) float64 {
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// CounterResetDetector finds counters whose values decrease, which
+// typically happens when the process that reports the counter
+// restarts.
+type CounterResetDetector struct {
+	// Counters selects the metrics that are counters, and every
+	// decrease of their values is a reset. If nil, metrics are
+	// treated as counters when their values have not decreased
+	// for MinSamples samples, and have increased.
+	Counters ftdc.KeyMatcher
+	// MinSamples is the number of samples that the values of a
+	// metric must not decrease for, without a matcher of
+	// counters, before a decrease is a reset. Defaults to 10.
+	MinSamples int
+}
+
+// Validate ensures that the options are reasonable, and sets default
+// values.
+func (d *CounterResetDetector) Validate() error {
+	if d.MinSamples < 0 {
+		return errors.New("minimum samples must not be negative")
+	}
+
+	if d.MinSamples == 0 {
+		d.MinSamples = 10
+	}
+	return nil
+}
+
+// Series returns the state of the detector for the metric, or nil if
+// the detector has a matcher of counters that does not match the
+// metric.
+func (d *CounterResetDetector) Series(key string, _ bsontype.Type) Series {
+	counter := d.Counters != nil
+	if counter && !d.Counters.MatchKey(key) {
+		return nil
+	}
+
+	return &counterSeries{opts: d, key: key, counter: counter}
+}
+
+type counterSeries struct {
+	opts      *CounterResetDetector
+	key       string
+	counter   bool
+	started   bool
+	previous  float64
+	run       int
+	increased bool
+}
+
+func (s *counterSeries) Add(ts time.Time, value float64) *Finding {
+	defer func() { s.previous, s.started = value, true }()
+	if !s.started {
+		return nil
+	}
+
+	if value >= s.previous {
+		s.run++
+		s.increased = s.increased || value > s.previous
+		return nil
+	}
+
+	reset := s.counter || (s.run >= s.opts.MinSamples && s.increased)
+	run := s.run
+	s.run, s.increased = 0, false
+	if !reset {
+		return nil
+	}
+
+	description := fmt.Sprintf("counter decreased from %g to %g", s.previous, value)
+	if !s.counter {
+		description += fmt.Sprintf(" after increasing for %d samples", run)
+	}
+	return &Finding{
+		Kind:        KindCounterReset,
+		Key:         s.key,
+		Time:        ts,
+		Value:       value,
+		Description: description,
+	}
+}
+
+// SaturationDetector finds metrics whose values stay at, or above, a
+// fraction of their limits, for a number of consecutive samples. Each
+// period of saturation produces one finding, at the time of its first
+// sample. Metrics whose limits are other metrics (e.g. connections
+// and the maximum number of connections) may be compared with their
+// limits by deriving their utilization (see ftdc.DeriveMetric.)
+type SaturationDetector struct {
+	// Limits maps the keys of metrics to their limits. Other
+	// metrics are not examined.
+	Limits map[string]float64
+	// Fraction of the limit at which a metric is saturated.
+	// Defaults to 1.
+	Fraction float64
+	// MinSamples is the number of consecutive samples that a
+	// metric must be saturated for. Defaults to 5.
+	MinSamples int
+}
+
+// Validate ensures that the options are reasonable, and sets default
+// values.
+func (d *SaturationDetector) Validate() error {
+	if len(d.Limits) == 0 {
+		return errors.New("must specify the limits of metrics")
+	}
+	if d.Fraction < 0 {
+		return errors.New("fraction must not be negative")
+	}
+	if d.MinSamples < 0 {
+		return errors.New("minimum samples must not be negative")
+	}
+
+	if d.Fraction == 0 {
+		d.Fraction = 1
+	}
+	if d.MinSamples == 0 {
+		d.MinSamples = 5
+	}
+	return nil
+}
+
+// Series returns the state of the detector for the metric, or nil if
+// the metric does not have a limit.
+func (d *SaturationDetector) Series(key string, _ bsontype.Type) Series {
+	limit, ok := d.Limits[key]
+	if !ok {
+		return nil
+	}
+
+	return &saturationSeries{opts: d, key: key, limit: limit}
+}
+
+type saturationSeries struct {
+	opts  *SaturationDetector
+	key   string
+	limit float64
+	run   int
+	start time.Time
+}
+
+func (s *saturationSeries) Add(ts time.Time, value float64) *Finding {
+	if value < s.opts.Fraction*s.limit {
+		s.run = 0
+		return nil
+	}
+
+	s.run++
+	if s.run == 1 {
+		s.start = ts
+	}
+	if s.run != s.opts.MinSamples {
+		return nil
+	}
+
+	return &Finding{
+		Kind:  KindSaturation,
+		Key:   s.key,
+		Time:  s.start,
+		Value: value,
+		Description: fmt.Sprintf("value %g has been at least %g%% of the limit %g for %d samples",
+			value, s.opts.Fraction*100, s.limit, s.run),
+	}
+}
@@ -0,0 +1,137 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func addValues(series Series, start time.Time, values []float64) []*Finding {
+	out := []*Finding{}
+	for idx, value := range values {
+		if finding := series.Add(start.Add(time.Duration(idx)*time.Second), value); finding != nil {
+			out = append(out, finding)
+		}
+	}
+	return out
+}
+
+func TestSpikeDetector(t *testing.T) {
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Defaults", func(t *testing.T) {
+		d := &SpikeDetector{}
+		require.NoError(t, d.Validate())
+		assert.Equal(t, 60, d.Window)
+		assert.Equal(t, 6.0, d.Threshold)
+
+		assert.Error(t, (&SpikeDetector{Window: -1}).Validate())
+		assert.Error(t, (&SpikeDetector{Threshold: -1}).Validate())
+	})
+	t.Run("Spikes", func(t *testing.T) {
+		d := &SpikeDetector{Window: 10}
+		require.NoError(t, d.Validate())
+
+		values := []float64{}
+		for i := 0; i < 40; i++ {
+			values = append(values, float64(100+i%3))
+		}
+		values[5] = 1000  // within the first window
+		values[20] = 1000 // spike
+		values[30] = 1000 // a spike that lasts two samples
+		values[31] = 1000
+		values[25] = 95 // deviates, but less than the threshold
+
+		findings := addValues(d.Series("a", bsontype.Int64), start, values)
+		require.Len(t, findings, 2)
+		assert.Equal(t, KindSpike, findings[0].Kind)
+		assert.Equal(t, "a", findings[0].Key)
+		assert.Equal(t, start.Add(20*time.Second), findings[0].Time)
+		assert.Equal(t, 1000.0, findings[0].Value)
+		assert.Contains(t, findings[0].Description, "median 101")
+		assert.Equal(t, start.Add(30*time.Second), findings[1].Time)
+	})
+	t.Run("Constant", func(t *testing.T) {
+		d := &SpikeDetector{Window: 5}
+		require.NoError(t, d.Validate())
+		findings := addValues(d.Series("a", bsontype.Int64), start, []float64{1, 1, 1, 1, 1, 1, 50, 1})
+		assert.Empty(t, findings)
+	})
+}
+
+func TestCounterResetDetector(t *testing.T) {
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Defaults", func(t *testing.T) {
+		d := &CounterResetDetector{}
+		require.NoError(t, d.Validate())
+		assert.Equal(t, 10, d.MinSamples)
+		assert.Error(t, (&CounterResetDetector{MinSamples: -1}).Validate())
+	})
+	t.Run("Heuristic", func(t *testing.T) {
+		d := &CounterResetDetector{MinSamples: 4}
+		require.NoError(t, d.Validate())
+
+		// the gauge decreases before it has increased for
+		// enough samples, and the constant never increases.
+		assert.Empty(t, addValues(d.Series("gauge", bsontype.Int64), start, []float64{5, 6, 4, 7, 3, 8, 2}))
+		assert.Empty(t, addValues(d.Series("constant", bsontype.Int64), start, []float64{5, 5, 5, 5, 5, 5, 0}))
+
+		findings := addValues(d.Series("counter", bsontype.Int64), start, []float64{1, 2, 3, 3, 5, 8, 2, 3, 4, 1})
+		require.Len(t, findings, 1)
+		assert.Equal(t, KindCounterReset, findings[0].Kind)
+		assert.Equal(t, start.Add(6*time.Second), findings[0].Time)
+		assert.Equal(t, 2.0, findings[0].Value)
+		assert.Equal(t, "counter decreased from 8 to 2 after increasing for 5 samples", findings[0].Description)
+	})
+	t.Run("Counters", func(t *testing.T) {
+		matcher, err := ftdc.NewGlobMatcher("*.count")
+		require.NoError(t, err)
+		d := &CounterResetDetector{Counters: matcher}
+		require.NoError(t, d.Validate())
+
+		assert.Nil(t, d.Series("a.gauge", bsontype.Int64))
+		findings := addValues(d.Series("a.count", bsontype.Int64), start, []float64{5, 6, 4, 7, 3})
+		require.Len(t, findings, 2)
+		assert.Equal(t, "counter decreased from 6 to 4", findings[0].Description)
+	})
+}
+
+func TestSaturationDetector(t *testing.T) {
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Defaults", func(t *testing.T) {
+		assert.Error(t, (&SaturationDetector{}).Validate())
+		d := &SaturationDetector{Limits: map[string]float64{"a": 10}}
+		require.NoError(t, d.Validate())
+		assert.Equal(t, 1.0, d.Fraction)
+		assert.Equal(t, 5, d.MinSamples)
+
+		assert.Error(t, (&SaturationDetector{Limits: d.Limits, Fraction: -1}).Validate())
+		assert.Error(t, (&SaturationDetector{Limits: d.Limits, MinSamples: -1}).Validate())
+	})
+	t.Run("Saturation", func(t *testing.T) {
+		d := &SaturationDetector{Limits: map[string]float64{"conns": 100}, Fraction: 0.9, MinSamples: 3}
+		require.NoError(t, d.Validate())
+		assert.Nil(t, d.Series("other", bsontype.Int64))
+
+		findings := addValues(d.Series("conns", bsontype.Int64), start,
+			[]float64{50, 95, 99, 80, 90, 100, 100, 100, 100, 10, 95, 95, 95})
+		require.Len(t, findings, 2)
+		assert.Equal(t, KindSaturation, findings[0].Kind)
+		assert.Equal(t, start.Add(4*time.Second), findings[0].Time)
+		assert.Equal(t, 100.0, findings[0].Value)
+		assert.Equal(t, "value 100 has been at least 90% of the limit 100 for 3 samples", findings[0].Description)
+		assert.Equal(t, start.Add(10*time.Second), findings[1].Time)
+	})
+	t.Run("Infinite", func(t *testing.T) {
+		d := &SaturationDetector{Limits: map[string]float64{"a": math.Inf(1)}, MinSamples: 1}
+		require.NoError(t, d.Validate())
+		assert.Empty(t, addValues(d.Series("a", bsontype.Double), start, []float64{1, 1e300}))
+	})
+}
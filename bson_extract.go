@@ -1,11 +1,11 @@
 package ftdc
 
 import (
+	"math"
 	"time"
 
 	"github.com/mongodb/ftdc/bsonx"
 	"github.com/mongodb/ftdc/bsonx/bsontype"
-	"github.com/mongodb/grip"
 	"github.com/pkg/errors"
 )
 
@@ -13,117 +13,141 @@ import (
 //
 // Helpers for encoding values from bsonx documents
 
+// extractedMetrics holds the metrics of a document, in the order of
+// the reference document, as the values that FTDC encodes: the bits
+// of doubles, milliseconds since the epoch for date times, and
+// integers for everything else. Collectors reuse the buffers of
+// extracted metrics between samples (see reset), so that extracting
+// the metrics of documents with a stable schema doesn't allocate.
 type extractedMetrics struct {
-	values []*bsonx.Value
+	values []int64
 	types  []bsontype.Type
 	ts     time.Time
 }
 
-func extractMetricsFromDocument(doc *bsonx.Document) (extractedMetrics, error) {
-	metrics := extractedMetrics{}
-	iter := doc.Iterator()
+// reset truncates the metrics, retaining their buffers.
+func (m *extractedMetrics) reset() {
+	m.values = m.values[:0]
+	m.types = m.types[:0]
+	m.ts = time.Time{}
+}
+
+func (m *extractedMetrics) add(t bsontype.Type, value int64) {
+	m.values = append(m.values, value)
+	m.types = append(m.types, t)
+}
 
-	var (
-		err  error
-		data extractedMetrics
-	)
+// number returns the metric at the index as a float.
+func (m *extractedMetrics) number(idx int) float64 {
+	if m.types[idx] == bsontype.Double {
+		return math.Float64frombits(uint64(m.values[idx]))
+	}
+	return float64(m.values[idx])
+}
 
-	catcher := grip.NewBasicCatcher()
+// extractDocument appends the metrics of the document, and records
+// the current time as the time of the sample.
+func (m *extractedMetrics) extractDocument(doc *bsonx.Document) error {
+	err := m.extractSubDocument(doc)
+	m.ts = time.Now()
 
-	for iter.Next() {
-		data, err = extractMetricsFromValue(iter.Element().Value())
-		catcher.Add(err)
-		metrics.values = append(metrics.values, data.values...)
-		metrics.types = append(metrics.types, data.types...)
+	return err
+}
 
-		if metrics.ts.IsZero() {
-			metrics.ts = data.ts
+// extractSubDocument appends the metrics of a document.
+//
+// Elements are visited by index, rather than with an iterator, which
+// would validate every sub-document again at each level of nesting;
+// leaf elements are validated as they are extracted.
+func (m *extractedMetrics) extractSubDocument(doc *bsonx.Document) error {
+	for idx := 0; idx < doc.Len(); idx++ {
+		if err := m.extractElement(doc.ElementAt(uint(idx))); err != nil {
+			return err
 		}
 	}
 
-	catcher.Add(iter.Err())
+	return nil
+}
 
-	if metrics.ts.IsZero() {
-		metrics.ts = time.Now()
+func (m *extractedMetrics) extractArray(array *bsonx.Array) error {
+	for idx := 0; idx < array.Len(); idx++ {
+		if err := m.extractElement(array.LookupElement(uint(idx))); err != nil {
+			return err
+		}
 	}
 
-	return metrics, catcher.Resolve()
+	return nil
 }
 
-func extractMetricsFromArray(array *bsonx.Array) (extractedMetrics, error) {
-	metrics := extractedMetrics{}
-
-	var (
-		err  error
-		data extractedMetrics
-	)
-
-	catcher := grip.NewBasicCatcher()
-	iter := array.Iterator()
-
-	for iter.Next() {
-		data, err = extractMetricsFromValue(iter.Value())
-		catcher.Add(err)
-		metrics.values = append(metrics.values, data.values...)
-		metrics.types = append(metrics.types, data.types...)
-
-		if metrics.ts.IsZero() {
-			metrics.ts = data.ts
+func (m *extractedMetrics) extractElement(elem *bsonx.Element) error {
+	val := elem.Value()
+	switch val.Type() {
+	case bsontype.Array, bsontype.EmbeddedDocument:
+	default:
+		if _, err := elem.Validate(); err != nil {
+			return errors.WithStack(err)
 		}
 	}
 
-	catcher.Add(iter.Err())
-
-	return metrics, catcher.Resolve()
+	return m.extractValue(val)
 }
 
-func extractMetricsFromValue(val *bsonx.Value) (extractedMetrics, error) {
-	metrics := extractedMetrics{}
-	var err error
-
-	btype := val.Type()
-	switch btype {
+func (m *extractedMetrics) extractValue(val *bsonx.Value) error {
+	switch val.Type() {
 	case bsontype.Array:
-		metrics, err = extractMetricsFromArray(val.MutableArray())
-		err = errors.WithStack(err)
+		// the elements of arrays are extracted from the
+		// document that holds them, which, unlike the array,
+		// doesn't have to be allocated.
+		return errors.WithStack(m.extractSubDocument(val.MutableArrayDocument()))
 	case bsontype.EmbeddedDocument:
-		metrics, err = extractMetricsFromDocument(val.MutableDocument())
-		err = errors.WithStack(err)
+		return errors.WithStack(m.extractSubDocument(val.MutableDocument()))
 	case bsontype.Boolean:
 		if val.Boolean() {
-			metrics.values = append(metrics.values, bsonx.VC.Int64(1))
+			m.add(bsontype.Boolean, 1)
 		} else {
-			metrics.values = append(metrics.values, bsonx.VC.Int64(0))
+			m.add(bsontype.Boolean, 0)
 		}
-		metrics.types = append(metrics.types, bsontype.Boolean)
 	case bsontype.Double:
-		metrics.values = append(metrics.values, val)
-		metrics.types = append(metrics.types, bsontype.Double)
+		m.add(bsontype.Double, normalizeFloat(val.Double()))
 	case bsontype.Int32:
-		metrics.values = append(metrics.values, bsonx.VC.Int64(int64(val.Int32())))
-		metrics.types = append(metrics.types, bsontype.Int32)
+		m.add(bsontype.Int32, int64(val.Int32()))
 	case bsontype.Int64:
-		metrics.values = append(metrics.values, val)
-		metrics.types = append(metrics.types, bsontype.Int64)
+		m.add(bsontype.Int64, val.Int64())
 	case bsontype.DateTime:
-		metrics.values = append(metrics.values, bsonx.VC.Int64(epochMs(val.Time())))
-		metrics.types = append(metrics.types, bsontype.DateTime)
+		m.add(bsontype.DateTime, epochMs(val.Time()))
 	case bsontype.Timestamp:
 		t, i := val.Timestamp()
-		metrics.values = append(metrics.values, bsonx.VC.Int64(int64(t)), bsonx.VC.Int64(int64(i)))
-		metrics.types = append(metrics.types, bsontype.Timestamp, bsontype.Timestamp)
+		m.add(bsontype.Timestamp, int64(t))
+		m.add(bsontype.Timestamp, int64(i))
 	}
 
+	return nil
+}
+
+func extractMetricsFromDocument(doc *bsonx.Document) (extractedMetrics, error) {
+	metrics := extractedMetrics{}
+	err := metrics.extractDocument(doc)
 	return metrics, err
 }
 
-func extractDelta(current *bsonx.Value, previous *bsonx.Value) (int64, error) {
-	switch current.Type() {
-	case bsontype.Double:
-		return normalizeFloat(current.Double() - previous.Double()), nil
-	case bsontype.Int64:
-		return current.Int64() - previous.Int64(), nil
-	default:
-		return 0, errors.Errorf("invalid type %s", current.Type())
+func extractMetricsFromArray(array *bsonx.Array) (extractedMetrics, error) {
+	metrics := extractedMetrics{}
+	err := metrics.extractArray(array)
+	return metrics, err
+}
+
+func extractMetricsFromValue(val *bsonx.Value) (extractedMetrics, error) {
+	metrics := extractedMetrics{}
+	err := metrics.extractValue(val)
+	return metrics, err
+}
+
+// extractDelta returns the delta between two extracted values of a
+// metric of the type.
+func extractDelta(t bsontype.Type, current, previous int64) int64 {
+	if t == bsontype.Double {
+		return normalizeFloat(math.Float64frombits(uint64(current)) - math.Float64frombits(uint64(previous)))
 	}
+
+	return current - previous
 }
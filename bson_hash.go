@@ -3,6 +3,7 @@ package ftdc
 import (
 	"crypto/md5"
 	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"hash"
 	"hash/fnv"
@@ -26,9 +27,82 @@ func metricKeySHA1(doc *bsonx.Document) (string, int) {
 }
 
 func metricKeyHash(doc *bsonx.Document) (string, int) {
-	checksum := fnv.New64()
-	seen := metricKeyHashDocument(checksum, "", doc)
-	return fmt.Sprintf("%x", checksum.Sum(nil)), seen
+	h := &schemaHasher{}
+	return h.hash(doc)
+}
+
+// schemaHasher computes the same hash of the schema of documents as
+// metricKeyHash, without allocating: the flattened keys of metrics
+// are built in a reusable buffer rather than formatted as strings,
+// and the hashes are interned in a table, so that collectors that
+// hash every sample don't allocate for documents with a schema that
+// they have already seen. The zero value is ready to use.
+type schemaHasher struct {
+	checksum hash.Hash64
+	key      []byte
+	raw      []byte
+	sum      [16]byte
+	sums     *bsonx.KeyInterner
+}
+
+// hash returns the hash of the flattened keys of the metrics in the
+// document, and the number of metrics.
+func (h *schemaHasher) hash(doc *bsonx.Document) (string, int) {
+	if h.checksum == nil {
+		h.checksum = fnv.New64()
+		h.sums = bsonx.NewKeyInterner()
+	}
+
+	h.checksum.Reset()
+	h.key = h.key[:0]
+	seen := h.document(doc)
+
+	h.raw = h.checksum.Sum(h.raw[:0])
+	hex.Encode(h.sum[:], h.raw)
+
+	return h.sums.Intern(h.sum[:]), seen
+}
+
+func (h *schemaHasher) document(doc *bsonx.Document) int {
+	seen := 0
+	prefix := len(h.key)
+	for idx := 0; idx < doc.Len(); idx++ {
+		elem := doc.ElementAt(uint(idx))
+		h.key = elem.AppendKey(append(h.key[:prefix], '.'))
+		seen += h.value(elem.Value())
+	}
+	h.key = h.key[:prefix]
+
+	return seen
+}
+
+func (h *schemaHasher) array(array *bsonx.Document) int {
+	seen := 0
+	prefix := len(h.key)
+	for idx := 0; idx < array.Len(); idx++ {
+		h.key = strconv.AppendInt(append(h.key[:prefix], '.'), int64(idx), 10)
+		seen += h.value(array.ElementAt(uint(idx)).Value())
+	}
+	h.key = h.key[:prefix]
+
+	return seen
+}
+
+func (h *schemaHasher) value(value *bsonx.Value) int {
+	switch value.Type() {
+	case bsontype.Array:
+		return h.array(value.MutableArrayDocument())
+	case bsontype.EmbeddedDocument:
+		return h.document(value.MutableDocument())
+	case bsontype.Boolean, bsontype.Double, bsontype.Int32, bsontype.Int64, bsontype.DateTime:
+		_, _ = h.checksum.Write(h.key)
+		return 1
+	case bsontype.Timestamp:
+		_, _ = h.checksum.Write(h.key)
+		return 2
+	default:
+		return 0
+	}
 }
 
 func metricKeyHashDocument(checksum hash.Hash, key string, doc *bsonx.Document) int {
@@ -51,12 +51,14 @@ func metricForType(key string, path []string, val *bsonx.Value) []Metric {
 	case bsontype.Array:
 		return metricForArray(key, path, val.MutableArray())
 	case bsontype.EmbeddedDocument:
-		path = append(path, key)
+		// copy the path, so that sibling documents do not
+		// share (and overwrite) the backing array.
+		path = append(append(make([]string, 0, len(path)+1), path...), key)
 
 		o := []Metric{}
 		for _, ne := range metricForDocument(path, val.MutableDocument()) {
 			o = append(o, Metric{
-				ParentPath:    path,
+				ParentPath:    ne.ParentPath,
 				KeyName:       ne.KeyName,
 				startingValue: ne.startingValue,
 				originalType:  ne.originalType,
@@ -1,6 +1,8 @@
 package ftdc
 
 import (
+	"bytes"
+	"fmt"
 	"hash/fnv"
 	"strings"
 	"testing"
@@ -625,7 +627,7 @@ func TestExtractingMetrics(t *testing.T) {
 
 			keys, num := isMetricsValue("keyname", test.Value)
 			if test.NumEncodedValues > 0 {
-				assert.EqualValues(t, test.FirstEncodedValue, metrics.values[0].Interface())
+				assert.EqualValues(t, test.FirstEncodedValue, metrics.number(0))
 				assert.True(t, len(keys) >= 1)
 				assert.True(t, strings.HasPrefix(keys[0], "keyname"))
 			} else {
@@ -696,7 +698,7 @@ func TestDocumentExtraction(t *testing.T) {
 			assert.Equal(t, test.NumEncodedValues, len(metrics.values))
 			assert.False(t, metrics.ts.IsZero())
 			if len(metrics.values) > 0 {
-				assert.EqualValues(t, test.FirstEncodedValue, metrics.values[0].Interface())
+				assert.EqualValues(t, test.FirstEncodedValue, metrics.number(0))
 			}
 			require.Len(t, metrics.types, len(test.Types))
 			for i := range metrics.types {
@@ -754,7 +756,7 @@ func TestArrayExtraction(t *testing.T) {
 			assert.NoError(t, err)
 			assert.Equal(t, test.NumEncodedValues, len(metrics.values))
 			if test.NumEncodedValues >= 1 {
-				assert.EqualValues(t, test.FirstEncodedValue, metrics.values[0].Interface())
+				assert.EqualValues(t, test.FirstEncodedValue, metrics.number(0))
 			}
 			require.Len(t, metrics.types, len(test.Types))
 			for i := range metrics.types {
@@ -1108,3 +1110,73 @@ func TestIsOneChecker(t *testing.T) {
 	assert.True(t, isNum(1, bsonx.VC.Int64(1)))
 	assert.True(t, isNum(1, bsonx.VC.Double(1.0)))
 }
+
+func TestMetricExtractionAllocations(t *testing.T) {
+	start := time.Now()
+	docs := make([]*bsonx.Document, 16)
+	for idx := range docs {
+		docs[idx] = bsonx.NewDocument(
+			bsonx.EC.Time("ts", start.Add(time.Duration(idx)*time.Second)),
+			bsonx.EC.Int64("ops", int64(idx*idx)),
+			bsonx.EC.Double("ratio", float64(idx)/3),
+			bsonx.EC.Boolean("ok", idx%2 == 0),
+			bsonx.EC.String("host", "localhost"),
+			bsonx.EC.SubDocument("mem", bsonx.NewDocument(
+				bsonx.EC.Int32("resident", int32(idx)),
+				bsonx.EC.Timestamp("optime", uint32(idx), 1),
+				bsonx.EC.Array("pages", bsonx.NewArray(bsonx.VC.Int64(1), bsonx.VC.Int64(int64(idx)))),
+			)),
+		)
+	}
+
+	t.Run("Hash", func(t *testing.T) {
+		// the hash matches the hash of the flattened keys,
+		// formatted as strings.
+		checksum := fnv.New64()
+		for _, key := range []string{".ts", ".ops", ".ratio", ".ok", ".mem.resident", ".mem.optime", ".mem.pages.0", ".mem.pages.1"} {
+			_, _ = checksum.Write([]byte(key))
+		}
+		hash, num := metricKeyHash(docs[0])
+		assert.Equal(t, fmt.Sprintf("%x", checksum.Sum(nil)), hash)
+		assert.Equal(t, 9, num)
+
+		hasher := &schemaHasher{}
+		var seen int
+		allocs := testing.AllocsPerRun(100, func() {
+			for _, doc := range docs {
+				hash, seen = hasher.hash(doc)
+			}
+		})
+		assert.Zero(t, allocs)
+		assert.Equal(t, 9, seen)
+	})
+	t.Run("Extract", func(t *testing.T) {
+		metrics := extractedMetrics{}
+		allocs := testing.AllocsPerRun(100, func() {
+			for _, doc := range docs {
+				metrics.reset()
+				if err := metrics.extractDocument(doc); err != nil {
+					panic(err)
+				}
+			}
+		})
+		assert.Zero(t, allocs)
+		require.Len(t, metrics.values, 9)
+		assert.Equal(t, float64(5), metrics.number(2))
+	})
+	for name, collector := range map[string]Collector{
+		"Base":             NewBaseCollector(2000),
+		"FloatPreserving":  NewFloatPreservingCollector(2000),
+		"StreamingDynamic": NewStreamingDynamicCollector(2000, &bytes.Buffer{}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, collector.Add(docs[0]))
+			allocs := testing.AllocsPerRun(100, func() {
+				if err := collector.Add(docs[1]); err != nil {
+					panic(err)
+				}
+			})
+			assert.Zero(t, allocs)
+		})
+	}
+}
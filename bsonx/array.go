@@ -14,7 +14,6 @@ import (
 
 	"github.com/mongodb/ftdc/bsonx/bsonerr"
 	"github.com/mongodb/ftdc/bsonx/bsontype"
-	"github.com/mongodb/ftdc/bsonx/elements"
 	"github.com/pkg/errors"
 )
 
@@ -59,22 +58,7 @@ func (a *Array) Reset() {
 // Validate ensures that the array's underlying BSON is valid. It returns the the number of bytes
 // in the underlying BSON if it is valid or an error if it isn't.
 func (a *Array) Validate() (uint32, error) {
-	var size uint32 = 4 + 1
-	for i, elem := range a.doc.elems {
-		n, err := elem.value.validate(false)
-		if err != nil {
-			return 0, err
-		}
-
-		// type
-		size++
-		// key
-		size += uint32(len(strconv.Itoa(i))) + 1
-		// value
-		size += n
-	}
-
-	return size, nil
+	return validateNested(a.doc, true, validateMaxDepthDefault, nil)
 }
 
 // Lookup returns the value in the array at the given index or an error if it cannot be found.
@@ -185,6 +169,7 @@ func (a *Array) Set(index uint, value *Value) *Array {
 	if index >= uint(len(a.doc.elems)) {
 		panic(bsonerr.OutOfBounds)
 	}
+	a.doc.own()
 
 	a.doc.elems[index] = &Element{value}
 
@@ -269,9 +254,23 @@ func (a *Array) Delete(index uint) *Value {
 		return nil
 	}
 
+	a.doc.own()
 	elem := a.doc.elems[index]
 	a.doc.elems = append(a.doc.elems[:index], a.doc.elems[index+1:]...)
 
+	// keep the index consistent with the elements, so that
+	// subsequent insertions remain valid.
+	position := uint32(index)
+	for i := 0; i < len(a.doc.index); i++ {
+		switch {
+		case a.doc.index[i] == position:
+			a.doc.index = append(a.doc.index[:i], a.doc.index[i+1:]...)
+			i--
+		case a.doc.index[i] > position:
+			a.doc.index[i]--
+		}
+	}
+
 	return elem.value
 }
 
@@ -324,59 +323,12 @@ func (a *Array) WriteArray(start uint, writer []byte) (int64, error) {
 // writeByteSlice handles serializing this array to a slice of bytes starting
 // at the given start position.
 func (a *Array) writeByteSlice(start uint, size uint32, b []byte) (int64, error) {
-	var total int64
-	var pos = start
-
-	if len(b) < int(start)+int(size) {
-		return 0, newErrTooSmall()
-	}
-	n, err := elements.Int32.Encode(start, b, int32(size))
-	total += int64(n)
-	pos += uint(n)
-	if err != nil {
-		return total, err
-	}
-
-	for i, elem := range a.doc.elems {
-		b[pos] = elem.value.data[elem.value.start]
-		total++
-		pos++
-
-		key := []byte(strconv.Itoa(i))
-		key = append(key, 0)
-		copy(b[pos:], key)
-		total += int64(len(key))
-		pos += uint(len(key))
-
-		n, err := elem.writeElement(false, pos, b)
-		total += int64(n)
-		pos += uint(n)
-		if err != nil {
-			return total, err
-		}
-	}
-
-	n, err = elements.Byte.Encode(pos, b, '\x00')
-	total += int64(n)
-	pos += uint(n)
-	if err != nil {
-		return total, err
-	}
-	return total, nil
+	return writeNestedByteSlice(a.doc, true, start, size, b)
 }
 
 // MarshalBSON implements the Marshaler interface.
 func (a *Array) MarshalBSON() ([]byte, error) {
-	size, err := a.Validate()
-	if err != nil {
-		return nil, err
-	}
-	b := make([]byte, size)
-	_, err = a.writeByteSlice(0, size, b)
-	if err != nil {
-		return nil, err
-	}
-	return b, nil
+	return marshalNested(a.doc, true, validateMaxDepthDefault)
 }
 
 // Iterator returns a ArrayIterator that can be used to iterate through the
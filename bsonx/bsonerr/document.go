@@ -43,3 +43,15 @@ var ElementNotFound = errors.New("element not found")
 
 // OutOfBounds indicates that an index provided to access something was invalid.
 var OutOfBounds = errors.New("out of bounds")
+
+// DocumentTooLarge indicates that the encoded size of a document or array exceeds the largest
+// size that a BSON document can represent.
+var DocumentTooLarge = errors.New("document exceeds the maximum BSON document size")
+
+// TooManyElements indicates that an element was added to a document that already has the
+// maximum number of elements.
+var TooManyElements = errors.New("document has too many elements")
+
+// MaxDepthExceeded indicates that the documents and arrays embedded in a document are nested
+// more deeply than the maximum depth.
+var MaxDepthExceeded = errors.New("document exceeds the maximum nesting depth")
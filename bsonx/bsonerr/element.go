@@ -17,6 +17,9 @@ var InvalidString = errors.New("invalid string value")
 // InvalidBinarySubtype indicates that a BSON binary value had an undefined subtype.
 var InvalidBinarySubtype = errors.New("invalid BSON binary Subtype")
 
+// InvalidBinaryLength indicates that the length of a BSON binary value does not match its subtype.
+var InvalidBinaryLength = errors.New("invalid length for BSON binary Subtype")
+
 // InvalidBooleanType indicates that a BSON boolean value had an incorrect byte.
 var InvalidBooleanType = errors.New("invalid value for BSON Boolean Type")
 
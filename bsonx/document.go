@@ -12,9 +12,9 @@ import (
 	"io"
 	"sort"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/mongodb/ftdc/bsonx/bsonerr"
-	"github.com/mongodb/ftdc/bsonx/elements"
 )
 
 // Document is a mutable ordered map that compactly represents a BSON document.
@@ -23,8 +23,21 @@ type Document struct {
 	// insertion of a nil element. Setting IgnoreNilInsert to true will instead
 	// silently ignore any nil paramet()ers to these methods.
 	IgnoreNilInsert bool
-	elems           []*Element
-	index           []uint32
+	// KeyIndex enables a hash index of the keys of the document,
+	// which makes Lookup and LookupElement take constant time,
+	// rather than logarithmic time, for documents with more than
+	// KeyIndexThreshold elements (e.g. serverStatus documents that
+	// are looked up repeatedly.) The index is built by the first
+	// lookup after the document is modified, so it's most useful
+	// for documents that are read more often than they change.
+	KeyIndex bool
+	elems    []*Element
+	index    []uint32
+	keys     atomic.Value
+
+	// shared is set, atomically, when the elems and index slices
+	// are shared with a clone of the document (see Clone).
+	shared uint32
 }
 
 // NewDocument creates an empty Document. The numberOfElems parameter will
@@ -50,12 +63,16 @@ func (d *Document) Copy() *Document {
 
 	doc := &Document{
 		IgnoreNilInsert: d.IgnoreNilInsert,
+		KeyIndex:        d.KeyIndex,
 		elems:           make([]*Element, len(d.elems), cap(d.elems)),
 		index:           make([]uint32, len(d.index), cap(d.index)),
 	}
 
 	copy(doc.elems, d.elems)
 	copy(doc.index, d.index)
+	if keys, _ := d.keys.Load().(keyIndex); keys != nil {
+		doc.keys.Store(keys)
+	}
 
 	return doc
 }
@@ -125,6 +142,7 @@ func (d *Document) Append(elems ...*Element) *Document {
 	if d == nil {
 		panic(bsonerr.NilDocument)
 	}
+	d.own()
 
 	for _, elem := range elems {
 		if elem == nil {
@@ -140,13 +158,7 @@ func (d *Document) Append(elems ...*Element) *Document {
 			return bytes.Compare(
 				d.keyFromIndex(i), elem.value.data[elem.value.start+1:elem.value.offset]) >= 0
 		})
-		if i < len(d.index) {
-			d.index = append(d.index, 0)
-			copy(d.index[i+1:], d.index[i:])
-			d.index[i] = uint32(len(d.elems) - 1)
-		} else {
-			d.index = append(d.index, uint32(len(d.elems)-1))
-		}
+		d.insertIndex(i, len(d.elems)-1)
 	}
 	return d
 }
@@ -161,6 +173,7 @@ func (d *Document) Prepend(elems ...*Element) *Document {
 	if d == nil {
 		panic(bsonerr.NilDocument)
 	}
+	d.own()
 
 	// In order to insert the prepended elements in order we need to make space
 	// at the front of the elements slice.
@@ -194,13 +207,7 @@ func (d *Document) Prepend(elems ...*Element) *Document {
 			return bytes.Compare(
 				d.keyFromIndex(i), elem.value.data[elem.value.start+1:elem.value.offset]) >= 0
 		})
-		if i < len(d.index) {
-			d.index = append(d.index, 0)
-			copy(d.index[i+1:], d.index[i:])
-			d.index[i] = 0
-		} else {
-			d.index = append(d.index, 0)
-		}
+		d.insertIndex(i, 0)
 	}
 	return d
 }
@@ -221,6 +228,7 @@ func (d *Document) Set(elem *Element) *Document {
 		}
 		panic(bsonerr.NilElement)
 	}
+	d.own()
 
 	key := elem.Key() + "\x00"
 	i := sort.Search(len(d.index), func(i int) bool { return bytes.Compare(d.keyFromIndex(i), []byte(key)) >= 0 })
@@ -230,16 +238,54 @@ func (d *Document) Set(elem *Element) *Document {
 	}
 
 	d.elems = append(d.elems, elem)
-	position := uint32(len(d.elems) - 1)
+	d.insertIndex(i, len(d.elems)-1)
+
+	return d
+}
+
+// insertIndex inserts the position of an element in the elems slice
+// at position i of the index. Positions are stored as uint32 values,
+// which limits documents to MaxDocumentElements elements; inserting
+// more elements panics.
+func (d *Document) insertIndex(i, position int) {
+	if uint64(len(d.elems)) > MaxDocumentElements {
+		panic(bsonerr.TooManyElements)
+	}
+
 	if i < len(d.index) {
 		d.index = append(d.index, 0)
 		copy(d.index[i+1:], d.index[i:])
-		d.index[i] = position
+		d.index[i] = uint32(position)
 	} else {
-		d.index = append(d.index, position)
+		d.index = append(d.index, uint32(position))
 	}
+}
 
-	return d
+// buildIndex rebuilds the index for all elements of the document,
+// which is faster than inserting each element into the index, for
+// documents with many elements. Elements with the same key are
+// indexed in the same order that repeated calls to Append would
+// produce, with later elements first.
+func (d *Document) buildIndex() {
+	if uint64(len(d.elems)) > MaxDocumentElements {
+		panic(bsonerr.TooManyElements)
+	}
+
+	if cap(d.index) < len(d.elems) {
+		d.index = make([]uint32, len(d.elems))
+	}
+	d.index = d.index[:len(d.elems)]
+	for idx := range d.index {
+		d.index[idx] = uint32(idx)
+	}
+
+	sort.Slice(d.index, func(i, j int) bool {
+		cmp := bytes.Compare(d.keyFromIndex(i), d.keyFromIndex(j))
+		if cmp == 0 {
+			return d.index[i] > d.index[j]
+		}
+		return cmp < 0
+	})
 }
 
 // RecursiveLookup searches the document and potentially subdocuments or arrays for the
@@ -353,6 +399,7 @@ func (d *Document) Delete(key ...string) *Element {
 		keyIndex := d.index[i]
 		elem = d.elems[keyIndex]
 		if len(key) == 1 {
+			d.own()
 			d.index = append(d.index[:i], d.index[i+1:]...)
 			d.elems = append(d.elems[:keyIndex], d.elems[keyIndex+1:]...)
 			for j := range d.index {
@@ -473,6 +520,15 @@ func (d *Document) Reset() {
 	if d == nil {
 		panic(bsonerr.NilDocument)
 	}
+	d.resetKeyIndex()
+
+	// the storage of shared documents is released, rather than
+	// cleared, as it's still in use by their clones.
+	if atomic.LoadUint32(&d.shared) != 0 {
+		d.elems, d.index = nil, nil
+		atomic.StoreUint32(&d.shared, 0)
+		return
+	}
 
 	for idx := range d.elems {
 		d.elems[idx] = nil
@@ -482,31 +538,19 @@ func (d *Document) Reset() {
 }
 
 // Validate validates the document and returns its total size.
+// Embedded documents and arrays may be nested to a depth of 2048.
 func (d *Document) Validate() (uint32, error) {
-	if d == nil {
-		return 0, bsonerr.NilDocument
-	}
-
-	// Header and Footer
-	var size uint32 = 4 + 1
-	for _, elem := range d.elems {
-		n, err := elem.Validate()
-		if err != nil {
-			return 0, err
-		}
-		size += n
-	}
-	return size, nil
+	return d.ValidateWithOptions(ValidationOptions{})
 }
 
-// validates the document and returns its total size. This method has
-// bookkeeping parameters to prevent a stack overflow.
-func (d *Document) validate(currentDepth, maxDepth uint32) (uint32, error) {
+// ValidateWithOptions validates the document, as Validate does, with
+// the maximum depth of the options, and returns its total size.
+func (d *Document) ValidateWithOptions(opts ValidationOptions) (uint32, error) {
 	if d == nil {
 		return 0, bsonerr.NilDocument
 	}
 
-	return 0, nil
+	return validateNested(d, false, opts.maxDepth(), nil)
 }
 
 // WriteTo implements the io.WriterTo interface.
@@ -556,89 +600,62 @@ func (d *Document) WriteDocument(start uint, writer interface{}) (int64, error)
 // writeByteSlice handles serializing this document to a slice of bytes starting
 // at the given start position.
 func (d *Document) writeByteSlice(start uint, size uint32, b []byte) (int64, error) {
-	if d == nil {
-		return 0, bsonerr.NilDocument
-	}
-
-	var total int64
-	var pos = start
-	if len(b) < int(start)+int(size) {
-		return 0, newErrTooSmall()
-	}
-	n, err := elements.Int32.Encode(start, b, int32(size))
-	total += int64(n)
-	pos += uint(n)
-	if err != nil {
-		return total, err
-	}
-	for _, elem := range d.elems {
-		n, err := elem.writeElement(true, pos, b)
-		total += int64(n)
-		pos += uint(n)
-		if err != nil {
-			return total, err
-		}
-	}
-
-	n, err = elements.Byte.Encode(pos, b, '\x00')
-	total += int64(n)
-	pos += uint(n)
-	if err != nil {
-		return total, err
-	}
-	return total, nil
+	return writeNestedByteSlice(d, false, start, size, b)
 }
 
 // MarshalBSON implements the Marshaler interface.
 func (d *Document) MarshalBSON() ([]byte, error) {
+	return d.MarshalBSONWithOptions(ValidationOptions{})
+}
+
+// MarshalBSONWithOptions serializes the document, as MarshalBSON
+// does, after validating it with the maximum depth of the options.
+func (d *Document) MarshalBSONWithOptions(opts ValidationOptions) ([]byte, error) {
 	if d == nil {
 		return nil, bsonerr.NilDocument
 	}
 
-	size, err := d.Validate()
-
-	if err != nil {
-		return nil, err
-	}
-	b := make([]byte, size)
-	_, err = d.writeByteSlice(0, size, b)
-	if err != nil {
-		return nil, err
-	}
-	return b, nil
+	return marshalNested(d, false, opts.maxDepth())
 }
 
 // UnmarshalBSON implements the Unmarshaler interface.
 func (d *Document) UnmarshalBSON(b []byte) error {
+	return d.unmarshalBSON(b, nil)
+}
+
+func (d *Document) unmarshalBSON(b []byte, interner *KeyInterner) error {
 	if d == nil {
 		return bsonerr.NilDocument
 	}
+	d.own()
 
 	// Read byte array
 	//   - Create an Element for each element found
-	//   - Update the index with the key of the element
-	//   TODO: Maybe do 2 pass and alloc the elems and index once?
-	// 		   We should benchmark 2 pass vs multiple allocs for growing the slice
+	//   - Build the index for all elements once, rather than
+	//     inserting each key, which is quadratic for large
+	//     documents.
 	_, err := Reader(b).readElements(func(elem *Element) error {
-		d.elems = append(d.elems, elem)
-		i := sort.Search(len(d.index), func(i int) bool {
-			return bytes.Compare(
-				d.keyFromIndex(i), elem.value.data[elem.value.start+1:elem.value.offset]) >= 0
-		})
-		if i < len(d.index) {
-			d.index = append(d.index, 0)
-			copy(d.index[i+1:], d.index[i:])
-			d.index[i] = uint32(len(d.elems) - 1)
-		} else {
-			d.index = append(d.index, uint32(len(d.elems)-1))
+		if interner != nil {
+			elem.value.key = interner.Intern(elem.value.data[elem.value.start+1 : elem.value.offset-1])
+			elem.value.interner = interner
 		}
+		d.elems = append(d.elems, elem)
 		return nil
 	})
-	return err
+	if err != nil {
+		return err
+	}
+
+	d.buildIndex()
+	return nil
 }
 
 // ReadFrom will read one BSON document from the given io.Reader.
 func (d *Document) ReadFrom(r io.Reader) (int64, error) {
+	return d.readFrom(r, nil)
+}
+
+func (d *Document) readFrom(r io.Reader, interner *KeyInterner) (int64, error) {
 	if d == nil {
 		return 0, bsonerr.NilDocument
 	}
@@ -658,7 +675,7 @@ func (d *Document) ReadFrom(r io.Reader) (int64, error) {
 	if err != nil {
 		return total, err
 	}
-	err = d.UnmarshalBSON(b)
+	err = d.unmarshalBSON(b, interner)
 	return total, err
 }
 
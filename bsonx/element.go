@@ -38,10 +38,12 @@ func newElement(start uint32, offset uint32) *Element {
 func (e *Element) Clone() *Element {
 	return &Element{
 		value: &Value{
-			start:  e.value.start,
-			offset: e.value.offset,
-			data:   e.value.data,
-			d:      e.value.d,
+			start:    e.value.start,
+			offset:   e.value.offset,
+			data:     e.value.data,
+			d:        e.value.d,
+			key:      e.value.key,
+			interner: e.value.interner,
 		},
 	}
 }
@@ -74,14 +76,6 @@ func (e *Element) Validate() (uint32, error) {
 	return total, nil
 }
 
-// validate is a common validation method for elements.
-//
-// TODO(skriptble): Fill out this method and ensure all validation routines
-// pass through this method.
-func (e *Element) validate(recursive bool, currentDepth, maxDepth uint32) (uint32, error) {
-	return 0, nil
-}
-
 func (e *Element) validateKey() (uint32, error) {
 	if e.value.data == nil {
 		return 0, bsonerr.UninitializedElement
@@ -117,6 +111,10 @@ func (e *Element) KeyOK() (string, bool) {
 		return "", false
 	}
 
+	if e.value.interner != nil {
+		return e.value.key, true
+	}
+
 	return string(e.value.data[e.value.start+1 : e.value.offset-1]), true
 }
 
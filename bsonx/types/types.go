@@ -72,3 +72,27 @@ var MinKey struct{}
 
 // MaxKey represents the BSON minkey value.
 var MaxKey struct{}
+
+// Compare returns -1 if t is before o, 1 if t is after o, and 0 if
+// they are equal, ordering by time and then by ordinal, as the server
+// does.
+func (t Timestamp) Compare(o Timestamp) int {
+	switch {
+	case t.T < o.T || (t.T == o.T && t.I < o.I):
+		return -1
+	case t == o:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// Increment returns the timestamp that follows t, which has the next
+// ordinal of the same second, or the first ordinal of the next second
+// if the ordinal of t is the largest ordinal.
+func (t Timestamp) Increment() Timestamp {
+	if t.I == ^uint32(0) {
+		return Timestamp{T: t.T + 1, I: 1}
+	}
+	return Timestamp{T: t.T, I: t.I + 1}
+}
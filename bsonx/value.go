@@ -39,6 +39,12 @@ type Value struct {
 	data []byte
 
 	d *Document
+
+	// key and interner are set for values parsed with a
+	// KeyInterner: key holds the interned key of the element,
+	// and the interner is used when parsing nested documents.
+	key      string
+	interner *KeyInterner
 }
 
 // Offset returns the offset to the beginning of the value in the underlying data. When called on
@@ -140,7 +146,10 @@ func (v *Value) validate(sizeOnly bool) (uint32, error) {
 		}
 		l := readi32(v.data[v.offset : v.offset+4])
 		total += 4
-		if int32(v.offset)+4+l > int32(len(v.data)) {
+		if l < 1 {
+			return total, bsonerr.InvalidLength
+		}
+		if int64(v.offset)+4+int64(l) > int64(len(v.data)) {
 			return total, newErrTooSmall()
 		}
 		// We check if the value that is the last element of the string is a
@@ -169,7 +178,7 @@ func (v *Value) validate(sizeOnly bool) (uint32, error) {
 		if l < 5 {
 			return total, bsonerr.InvalidReadOnlyDocument
 		}
-		if int32(v.offset)+l > int32(len(v.data)) {
+		if int64(v.offset)+int64(l) > int64(len(v.data)) {
 			return total, newErrTooSmall()
 		}
 		if !sizeOnly {
@@ -199,7 +208,7 @@ func (v *Value) validate(sizeOnly bool) (uint32, error) {
 		if l < 5 {
 			return total, bsonerr.InvalidReadOnlyDocument
 		}
-		if int32(v.offset)+l > int32(len(v.data)) {
+		if int64(v.offset)+int64(l) > int64(len(v.data)) {
 			return total, newErrTooSmall()
 		}
 		if !sizeOnly {
@@ -220,9 +229,15 @@ func (v *Value) validate(sizeOnly bool) (uint32, error) {
 		if v.data[v.offset+4] > '\x05' && v.data[v.offset+4] < '\x80' {
 			return total, bsonerr.InvalidBinarySubtype
 		}
-		if int32(v.offset)+5+l > int32(len(v.data)) {
+		if l < 0 {
+			return total, bsonerr.InvalidLength
+		}
+		if int64(v.offset)+5+int64(l) > int64(len(v.data)) {
 			return total, newErrTooSmall()
 		}
+		if err := validateBinaryLength(v.data[v.offset+4], int(l)); err != nil {
+			return total, err
+		}
 		total += uint32(l)
 	case '\x07':
 		if int(v.offset+12) > len(v.data) {
@@ -265,31 +280,22 @@ func (v *Value) validate(sizeOnly bool) (uint32, error) {
 		}
 		l := readi32(v.data[v.offset : v.offset+4])
 		total += 4
-		if int32(v.offset)+4+l+12 > int32(len(v.data)) {
+		if l < 1 {
+			return total, bsonerr.InvalidLength
+		}
+		if int64(v.offset)+4+int64(l)+12 > int64(len(v.data)) {
 			return total, newErrTooSmall()
 		}
 		total += uint32(l) + 12
 	case '\x0F':
 		if v.d != nil {
-			// NOTE: For code with scope specifically, we write the length as
-			// we are marshaling the element and the constructor doesn't know
-			// the length of the document when it constructs the element.
-			// Because of that we don't check the length here and just validate
-			// the string and the document.
-			if int(v.offset+8) > len(v.data) {
-				return total, newErrTooSmall()
-			}
-			total += 8
-			sLength := readi32(v.data[v.offset+4 : v.offset+8])
-			if int(sLength) > len(v.data)+8 {
-				return total, newErrTooSmall()
-			}
-			total += uint32(sLength)
-			if !sizeOnly && v.data[v.offset+8+uint32(sLength)-1] != 0x00 {
-				return total, bsonerr.InvalidString
+			n, err := v.validateScopeCode(sizeOnly)
+			total += n
+			if err != nil {
+				return total, err
 			}
 
-			n, err := v.d.Validate()
+			n, err = v.d.Validate()
 			total += uint32(n)
 			if err != nil {
 				return total, err
@@ -301,7 +307,10 @@ func (v *Value) validate(sizeOnly bool) (uint32, error) {
 		}
 		l := readi32(v.data[v.offset : v.offset+4])
 		total += 4
-		if int32(v.offset)+l > int32(len(v.data)) {
+		if l < 0 {
+			return total, bsonerr.InvalidLength
+		}
+		if int64(v.offset)+int64(l) > int64(len(v.data)) {
 			return total, newErrTooSmall()
 		}
 		if !sizeOnly {
@@ -313,7 +322,7 @@ func (v *Value) validate(sizeOnly bool) (uint32, error) {
 			//
 			// TODO(skriptble): We should actually validate that the string
 			// doesn't consume any of the bytes used by the document.
-			if sLength > l-13 {
+			if sLength < 1 || sLength > l-13 {
 				return total, bsonerr.StringLargerThanContainer
 			}
 			// We check if the value that is the last element of the string is a
@@ -355,6 +364,33 @@ func (v *Value) validate(sizeOnly bool) (uint32, error) {
 	return total, nil
 }
 
+// validateScopeCode validates the length and code of JavaScript code
+// with a mutable scope, and returns their size, excluding the scope.
+//
+// NOTE: For code with scope specifically, we write the length as we
+// are marshaling the element and the constructor doesn't know the
+// length of the document when it constructs the element. Because of
+// that we don't check the length here and just validate the string.
+func (v *Value) validateScopeCode(sizeOnly bool) (uint32, error) {
+	var total uint32
+	if int(v.offset+8) > len(v.data) {
+		return total, newErrTooSmall()
+	}
+	total += 8
+	sLength := readi32(v.data[v.offset+4 : v.offset+8])
+	if sLength < 1 {
+		return total, bsonerr.InvalidString
+	}
+	if int(sLength) > len(v.data)+8 {
+		return total, newErrTooSmall()
+	}
+	total += uint32(sLength)
+	if !sizeOnly && v.data[v.offset+8+uint32(sLength)-1] != 0x00 {
+		return total, bsonerr.InvalidString
+	}
+	return total, nil
+}
+
 // valueSize returns the size of the value in bytes.
 func (v *Value) valueSize() (uint32, error) {
 	return v.validate(true)
@@ -412,7 +448,7 @@ func (v *Value) StringValue() string {
 		panic(bsonerr.ElementType{"compact.Element.String", bsontype.Type(v.data[v.start])})
 	}
 	l := readi32(v.data[v.offset : v.offset+4])
-	return string(v.data[v.offset+4 : int32(v.offset)+4+l-1])
+	return string(v.data[v.offset+4 : v.offset+4+uint32(l)-1])
 }
 
 // StringValueOK is the same as StringValue, but returns a boolean instead of
@@ -486,7 +522,7 @@ func (v *Value) MutableDocument() *Document {
 	if v.d == nil {
 		var err error
 		l := int32(binary.LittleEndian.Uint32(v.data[v.offset : v.offset+4]))
-		v.d, err = ReadDocument(v.data[v.offset : v.offset+uint32(l)])
+		v.d, err = ReadDocumentInterned(v.data[v.offset:v.offset+uint32(l)], v.interner)
 		if err != nil {
 			panic(err)
 		}
@@ -527,7 +563,12 @@ func (v *Value) ReaderArrayOK() (Reader, bool) {
 }
 
 // MutableArray returns the array for this element.
-func (v *Value) MutableArray() *Array {
+func (v *Value) MutableArray() *Array { return &Array{v.MutableArrayDocument()} }
+
+// MutableArrayDocument returns the document that holds the elements of
+// the array for this element, keyed by their indexes. Unlike
+// MutableArray, it does not allocate.
+func (v *Value) MutableArrayDocument() *Document {
 	if v == nil || v.offset == 0 || v.data == nil {
 		panic(bsonerr.UninitializedElement)
 	}
@@ -537,12 +578,12 @@ func (v *Value) MutableArray() *Array {
 	if v.d == nil {
 		var err error
 		l := int32(binary.LittleEndian.Uint32(v.data[v.offset : v.offset+4]))
-		v.d, err = ReadDocument(v.data[v.offset : v.offset+uint32(l)])
+		v.d, err = ReadDocumentInterned(v.data[v.offset:v.offset+uint32(l)], v.interner)
 		if err != nil {
 			panic(err)
 		}
 	}
-	return &Array{v.d}
+	return v.d
 }
 
 // MutableArrayOK is the same as MutableArray, except it returns a boolean
@@ -571,7 +612,7 @@ func (v *Value) Binary() (subtype byte, data []byte) {
 		l = readi32(v.data[v.offset+5 : v.offset+9])
 	}
 	b := make([]byte, l)
-	copy(b, v.data[v.offset+offset:int32(v.offset)+int32(offset)+l])
+	copy(b, v.data[v.offset+offset:v.offset+offset+uint32(l)])
 	return st, b
 }
 
@@ -704,7 +745,7 @@ func (v *Value) DBPointer() (string, types.ObjectID) {
 	l := readi32(v.data[v.offset : v.offset+4])
 	var p [12]byte
 	copy(p[:], v.data[v.offset+4+uint32(l):v.offset+4+uint32(l)+12])
-	return string(v.data[v.offset+4 : int32(v.offset)+4+l-1]), p
+	return string(v.data[v.offset+4 : v.offset+4+uint32(l)-1]), p
 }
 
 // DBPointerOK is the same as DBPoitner, except that it returns a boolean
@@ -728,7 +769,7 @@ func (v *Value) JavaScript() string {
 		panic(bsonerr.ElementType{"compact.Element.JavaScript", bsontype.Type(v.data[v.start])})
 	}
 	l := readi32(v.data[v.offset : v.offset+4])
-	return string(v.data[v.offset+4 : int32(v.offset)+4+l-1])
+	return string(v.data[v.offset+4 : v.offset+4+uint32(l)-1])
 }
 
 // JavaScriptOK is the same as Javascript, excepti that it returns a boolean
@@ -750,7 +791,7 @@ func (v *Value) Symbol() string {
 		panic(bsonerr.ElementType{"compact.Element.symbol", bsontype.Type(v.data[v.start])})
 	}
 	l := readi32(v.data[v.offset : v.offset+4])
-	return string(v.data[v.offset+4 : int32(v.offset)+4+l-1])
+	return string(v.data[v.offset+4 : v.offset+4+uint32(l)-1])
 }
 
 // ReaderJavaScriptWithScope returns the BSON JavaScript code with scope the Value represents, with
@@ -957,6 +998,8 @@ func (v *Value) setString(str string) {
 	v.start = 0
 	v.offset = 2
 	v.data = b
+	v.key = ""
+	v.interner = nil
 }
 
 func (v *Value) setDouble(f float64) {
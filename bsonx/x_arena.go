@@ -0,0 +1,286 @@
+package bsonx
+
+import (
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx/elements"
+)
+
+// arena slabs hold this many documents, elements, or element
+// pointers, and byte slabs hold arenaByteSlabSize bytes. Requests
+// that are larger than a slab are allocated outside of the arena.
+const (
+	arenaSlabSize     = 1024
+	arenaByteSlabSize = 64 * 1024
+)
+
+// DocumentArena allocates Documents, Elements, and Values, and the
+// storage for their data, from large slabs of memory, rather than
+// individually, so that building many short-lived documents (e.g. a
+// document for every sample of a collector) creates little garbage.
+// The memory of the arena is reused, rather than freed, when the
+// arena is Reset, so that all of the documents built from an arena
+// are freed together.
+//
+// Documents and elements built from an arena behave like all other
+// documents and elements, and may be mixed with them, but they must
+// not be used after the arena is Reset, as their memory may then be
+// reused. Documents that must outlive the arena should be copied
+// (e.g. by marshaling them) first.
+//
+// Arenas are not safe for concurrent use.
+type DocumentArena struct {
+	docs  documentSlabs
+	elems elementSlabs
+	ptrs  pointerSlabs
+	index indexSlabs
+	bytes byteSlabs
+}
+
+// NewDocumentArena constructs an empty arena. Arenas allocate memory
+// as documents are built from them.
+func NewDocumentArena() *DocumentArena { return &DocumentArena{} }
+
+// Reset frees all of the documents and elements built from the
+// arena, so that their memory is reused by documents and elements
+// built after the reset.
+func (a *DocumentArena) Reset() {
+	a.docs.reset()
+	a.elems.reset()
+	a.ptrs.reset()
+	a.index.reset()
+	a.bytes.reset()
+}
+
+// Make returns an empty document with storage for n elements. As with
+// DC.Make, the document grows past n elements, but the storage for
+// the additional elements is not allocated from the arena.
+func (a *DocumentArena) Make(n int) *Document {
+	doc := a.docs.next()
+	*doc = Document{elems: a.ptrs.next(n), index: a.index.next(n)}
+	return doc
+}
+
+// Elements returns a document of the elements.
+func (a *DocumentArena) Elements(elems ...*Element) *Document {
+	return a.Make(len(elems)).Append(elems...)
+}
+
+// Int32 creates an int32 element with the given key and value.
+func (a *DocumentArena) Int32(key string, i int32) *Element {
+	elem := a.element(key, 4)
+	if _, err := elements.Int32.Element(0, elem.value.data, key, i); err != nil {
+		panic(err)
+	}
+	return elem
+}
+
+// Int64 creates an int64 element with the given key and value.
+func (a *DocumentArena) Int64(key string, i int64) *Element {
+	elem := a.element(key, 8)
+	if _, err := elements.Int64.Element(0, elem.value.data, key, i); err != nil {
+		panic(err)
+	}
+	return elem
+}
+
+// Double creates a double element with the given key and value.
+func (a *DocumentArena) Double(key string, f float64) *Element {
+	elem := a.element(key, 8)
+	if _, err := elements.Double.Element(0, elem.value.data, key, f); err != nil {
+		panic(err)
+	}
+	return elem
+}
+
+// Boolean creates a boolean element with the given key and value.
+func (a *DocumentArena) Boolean(key string, b bool) *Element {
+	elem := a.element(key, 1)
+	if _, err := elements.Boolean.Element(0, elem.value.data, key, b); err != nil {
+		panic(err)
+	}
+	return elem
+}
+
+// DateTime creates a datetime element with the given key and value,
+// in milliseconds since the Unix epoch.
+func (a *DocumentArena) DateTime(key string, dt int64) *Element {
+	elem := a.element(key, 8)
+	if _, err := elements.DateTime.Element(0, elem.value.data, key, dt); err != nil {
+		panic(err)
+	}
+	return elem
+}
+
+// Time creates a datetime element with the given key and value.
+func (a *DocumentArena) Time(key string, t time.Time) *Element {
+	return a.DateTime(key, t.Unix()*1000+int64(t.Nanosecond()/1e6))
+}
+
+// String creates a string element with the given key and value.
+func (a *DocumentArena) String(key string, val string) *Element {
+	elem := a.element(key, 4+len(val)+1)
+	if _, err := elements.String.Element(0, elem.value.data, key, val); err != nil {
+		panic(err)
+	}
+	return elem
+}
+
+// SubDocument creates a subdocument element with the given key and
+// value.
+func (a *DocumentArena) SubDocument(key string, d *Document) *Element {
+	return a.container('\x03', key, d)
+}
+
+// Array creates an array element with the given key and value.
+func (a *DocumentArena) Array(key string, arr *Array) *Element {
+	return a.container('\x04', key, arr.doc)
+}
+
+func (a *DocumentArena) container(t byte, key string, d *Document) *Element {
+	elem := a.element(key, 0)
+	if _, err := elements.Byte.Encode(0, elem.value.data, t); err != nil {
+		panic(err)
+	}
+	if _, err := elements.CString.Encode(1, elem.value.data, key); err != nil {
+		panic(err)
+	}
+	elem.value.d = d
+	return elem
+}
+
+// element returns an element with storage for the key and a value of
+// the given size.
+func (a *DocumentArena) element(key string, size int) *Element {
+	cell := a.elems.next()
+	offset := uint32(1 + len(key) + 1)
+	cell.value = Value{offset: offset, data: a.bytes.next(int(offset) + size)}
+	cell.elem = Element{value: &cell.value}
+	return &cell.elem
+}
+
+// arenaElement holds an element and its value, so that both are
+// allocated together.
+type arenaElement struct {
+	elem  Element
+	value Value
+}
+
+// The slabs of each type record the slabs that they have allocated,
+// so that they can be reused after a reset, and the position of the
+// next allocation.
+
+type documentSlabs struct {
+	slabs [][]Document
+	slab  int
+	pos   int
+}
+
+func (s *documentSlabs) next() *Document {
+	if s.slab == len(s.slabs) {
+		s.slabs = append(s.slabs, make([]Document, arenaSlabSize))
+	}
+	out := &s.slabs[s.slab][s.pos]
+	if s.pos++; s.pos == arenaSlabSize {
+		s.slab++
+		s.pos = 0
+	}
+	return out
+}
+
+func (s *documentSlabs) reset() { s.slab, s.pos = 0, 0 }
+
+type elementSlabs struct {
+	slabs [][]arenaElement
+	slab  int
+	pos   int
+}
+
+func (s *elementSlabs) next() *arenaElement {
+	if s.slab == len(s.slabs) {
+		s.slabs = append(s.slabs, make([]arenaElement, arenaSlabSize))
+	}
+	out := &s.slabs[s.slab][s.pos]
+	if s.pos++; s.pos == arenaSlabSize {
+		s.slab++
+		s.pos = 0
+	}
+	return out
+}
+
+func (s *elementSlabs) reset() { s.slab, s.pos = 0, 0 }
+
+type pointerSlabs struct {
+	slabs [][]*Element
+	slab  int
+	pos   int
+}
+
+// next returns an empty slice with a capacity of n, which is limited
+// so that appending past n does not overwrite other slices.
+func (s *pointerSlabs) next(n int) []*Element {
+	if n > arenaSlabSize {
+		return make([]*Element, 0, n)
+	}
+	if s.slab < len(s.slabs) && s.pos+n > arenaSlabSize {
+		s.slab++
+		s.pos = 0
+	}
+	if s.slab == len(s.slabs) {
+		s.slabs = append(s.slabs, make([]*Element, arenaSlabSize))
+	}
+	out := s.slabs[s.slab][s.pos : s.pos : s.pos+n]
+	s.pos += n
+	return out
+}
+
+func (s *pointerSlabs) reset() { s.slab, s.pos = 0, 0 }
+
+type indexSlabs struct {
+	slabs [][]uint32
+	slab  int
+	pos   int
+}
+
+func (s *indexSlabs) next(n int) []uint32 {
+	if n > arenaSlabSize {
+		return make([]uint32, 0, n)
+	}
+	if s.slab < len(s.slabs) && s.pos+n > arenaSlabSize {
+		s.slab++
+		s.pos = 0
+	}
+	if s.slab == len(s.slabs) {
+		s.slabs = append(s.slabs, make([]uint32, arenaSlabSize))
+	}
+	out := s.slabs[s.slab][s.pos : s.pos : s.pos+n]
+	s.pos += n
+	return out
+}
+
+func (s *indexSlabs) reset() { s.slab, s.pos = 0, 0 }
+
+type byteSlabs struct {
+	slabs [][]byte
+	slab  int
+	pos   int
+}
+
+// next returns a slice of n bytes, with a capacity of n.
+func (s *byteSlabs) next(n int) []byte {
+	if n > arenaByteSlabSize {
+		return make([]byte, n)
+	}
+	if s.slab < len(s.slabs) && s.pos+n > arenaByteSlabSize {
+		s.slab++
+		s.pos = 0
+	}
+	if s.slab == len(s.slabs) {
+		s.slabs = append(s.slabs, make([]byte, arenaByteSlabSize))
+	}
+	out := s.slabs[s.slab][s.pos : s.pos+n : s.pos+n]
+	s.pos += n
+	return out
+}
+
+func (s *byteSlabs) reset() { s.slab, s.pos = 0, 0 }
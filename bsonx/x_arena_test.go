@@ -0,0 +1,103 @@
+package bsonx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentArena(t *testing.T) {
+	now := time.Now()
+	build := func(a *DocumentArena, n int64) *Document {
+		return a.Elements(
+			a.Time("ts", now),
+			a.Int64("counter", n),
+			a.Int32("small", int32(n)),
+			a.Double("ratio", float64(n)/2),
+			a.Boolean("ok", n%2 == 0),
+			a.String("name", "value"),
+			a.SubDocument("nested", a.Elements(a.Int64("inner", n))),
+			a.Array("list", NewArray(VC.Int64(n))),
+		)
+	}
+	expected := func(n int64) *Document {
+		return NewDocument(
+			EC.Time("ts", now),
+			EC.Int64("counter", n),
+			EC.Int32("small", int32(n)),
+			EC.Double("ratio", float64(n)/2),
+			EC.Boolean("ok", n%2 == 0),
+			EC.String("name", "value"),
+			EC.SubDocument("nested", NewDocument(EC.Int64("inner", n))),
+			EC.Array("list", NewArray(VC.Int64(n))),
+		)
+	}
+
+	t.Run("Equivalent", func(t *testing.T) {
+		a := NewDocumentArena()
+		doc := build(a, 42)
+		assert.True(t, doc.Equal(expected(42)))
+		assert.Equal(t, int64(42), doc.Lookup("counter").Int64())
+		assert.Equal(t, int64(42), doc.LookupPath("nested.inner").Int64())
+
+		data, err := doc.MarshalBSON()
+		require.NoError(t, err)
+		want, err := expected(42).MarshalBSON()
+		require.NoError(t, err)
+		assert.Equal(t, want, data)
+	})
+	t.Run("ManyDocuments", func(t *testing.T) {
+		a := NewDocumentArena()
+		docs := make([]*Document, 0, 4*arenaSlabSize)
+		for i := 0; i < cap(docs); i++ {
+			docs = append(docs, build(a, int64(i)))
+		}
+		for i, doc := range docs {
+			require.True(t, doc.Equal(expected(int64(i))), "document %d", i)
+		}
+	})
+	t.Run("GrowsPastCapacity", func(t *testing.T) {
+		a := NewDocumentArena()
+		first := a.Make(1)
+		second := a.Make(1)
+		for i := 0; i < 10; i++ {
+			first.Append(a.Int64("a", int64(i)))
+		}
+		second.Append(a.Int64("b", 1))
+
+		assert.Equal(t, 10, first.Len())
+		assert.Equal(t, 1, second.Len())
+		assert.Equal(t, "b", second.ElementAt(0).Key())
+	})
+	t.Run("LargeValues", func(t *testing.T) {
+		a := NewDocumentArena()
+		big := string(make([]byte, 2*arenaByteSlabSize))
+		doc := a.Make(2 * arenaSlabSize)
+		for i := 0; i < 2*arenaSlabSize; i++ {
+			doc.Append(a.Int64("k", int64(i)))
+		}
+		doc.Append(a.String("big", big))
+
+		assert.Equal(t, 2*arenaSlabSize+1, doc.Len())
+		assert.Equal(t, big, doc.Lookup("big").StringValue())
+	})
+	t.Run("ResetReusesMemory", func(t *testing.T) {
+		a := NewDocumentArena()
+		build(a, 1)
+		a.Reset()
+
+		doc := build(a, 2)
+		assert.True(t, doc.Equal(expected(2)))
+
+		allocs := testing.AllocsPerRun(100, func() {
+			a.Reset()
+			doc := a.Make(4)
+			doc.Append(a.Int64("a", 1))
+			doc.Append(a.Double("b", 2))
+			doc.Append(a.SubDocument("c", a.Make(1).Append(a.Boolean("d", true))))
+		})
+		assert.Zero(t, allocs)
+	})
+}
@@ -0,0 +1,111 @@
+package bsonx
+
+import (
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// These constants are the binary subtypes defined by the BSON
+// specification. Subtypes from BinaryUserDefined to 0xff are
+// available for application specific data.
+const (
+	BinaryGeneric     byte = 0x00
+	BinaryFunction    byte = 0x01
+	BinaryOld         byte = 0x02
+	BinaryUUIDOld     byte = 0x03
+	BinaryUUID        byte = 0x04
+	BinaryMD5         byte = 0x05
+	BinaryUserDefined byte = 0x80
+)
+
+// UUIDSize is the length of the payload of UUID (and MD5) binary
+// values.
+const UUIDSize = 16
+
+// ValidateBinary returns an error if the subtype is not defined by
+// the BSON specification, or if the length of the payload does not
+// match the subtype: UUID and MD5 values must hold exactly 16 bytes.
+func ValidateBinary(subtype byte, data []byte) error {
+	if subtype > BinaryMD5 && subtype < BinaryUserDefined {
+		return errors.Wrapf(bsonerr.InvalidBinarySubtype, "subtype %#x", subtype)
+	}
+
+	return validateBinaryLength(subtype, len(data))
+}
+
+func validateBinaryLength(subtype byte, size int) error {
+	switch subtype {
+	case BinaryUUIDOld, BinaryUUID, BinaryMD5:
+		if size != UUIDSize {
+			return errors.Wrapf(bsonerr.InvalidBinaryLength, "subtype %#x must have %d bytes, not %d", subtype, UUIDSize, size)
+		}
+	}
+
+	return nil
+}
+
+// UUID creates a binary element with the UUID subtype (0x04).
+func (ElementConstructor) UUID(key string, uuid [16]byte) *Element {
+	return EC.BinaryWithSubtype(key, uuid[:], BinaryUUID)
+}
+
+// BinaryWithSubtypeErr is the same as BinaryWithSubtype, except that
+// it returns an error, as ValidateBinary does, if the subtype and the
+// length of the payload are not valid together.
+func (ElementConstructor) BinaryWithSubtypeErr(key string, b []byte, btype byte) (*Element, error) {
+	if err := ValidateBinary(btype, b); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return EC.BinaryWithSubtype(key, b, btype), nil
+}
+
+// UUID creates a binary value with the UUID subtype (0x04).
+func (ValueConstructor) UUID(uuid [16]byte) *Value {
+	return EC.UUID("", uuid).value
+}
+
+// BinaryWithSubtypeErr is the same as BinaryWithSubtype, except that
+// it returns an error if the subtype and the length of the payload are
+// not valid together.
+func (ValueConstructor) BinaryWithSubtypeErr(b []byte, btype byte) (*Value, error) {
+	elem, err := EC.BinaryWithSubtypeErr("", b, btype)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return elem.value, nil
+}
+
+// UUID returns the UUID that the value holds. It panics if the value
+// is not a binary value with the UUID subtype (0x04) and a 16 byte
+// payload.
+func (v *Value) UUID() [16]byte {
+	uuid, ok := v.UUIDOK()
+	if !ok {
+		if v == nil || v.offset == 0 || v.data == nil {
+			panic(bsonerr.UninitializedElement)
+		}
+		if v.Type() != bsontype.Binary {
+			panic(bsonerr.ElementType{"compact.Element.UUID", v.Type()})
+		}
+		panic(errors.Wrap(bsonerr.InvalidBinaryLength, "value is not a UUID"))
+	}
+
+	return uuid
+}
+
+// UUIDOK is the same as UUID, except it returns a boolean instead of
+// panicking.
+func (v *Value) UUIDOK() ([16]byte, bool) {
+	var uuid [16]byte
+
+	subtype, data, ok := v.BinaryOK()
+	if !ok || subtype != BinaryUUID || len(data) != UUIDSize {
+		return uuid, false
+	}
+
+	copy(uuid[:], data)
+	return uuid, true
+}
@@ -0,0 +1,106 @@
+package bsonx
+
+import (
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUUID(t *testing.T) {
+	uuid := [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+
+	t.Run("Constructors", func(t *testing.T) {
+		value := VC.UUID(uuid)
+		subtype, data := value.Binary()
+		assert.Equal(t, BinaryUUID, subtype)
+		assert.Equal(t, uuid[:], data)
+		assert.Equal(t, uuid, value.UUID())
+
+		elem := EC.UUID("id", uuid)
+		assert.Equal(t, "id", elem.Key())
+		assert.Equal(t, uuid, elem.Value().UUID())
+	})
+	t.Run("RoundTrip", func(t *testing.T) {
+		data, err := NewDocument(EC.UUID("id", uuid)).MarshalBSON()
+		require.NoError(t, err)
+		doc, err := ReadDocument(data)
+		require.NoError(t, err)
+
+		out, ok := doc.Lookup("id").UUIDOK()
+		require.True(t, ok)
+		assert.Equal(t, uuid, out)
+	})
+	t.Run("NotUUID", func(t *testing.T) {
+		for name, value := range map[string]*Value{
+			"Nil":     nil,
+			"String":  VC.String("foo"),
+			"Generic": VC.Binary(uuid[:]),
+			"OldUUID": VC.BinaryWithSubtype(uuid[:], BinaryUUIDOld),
+			"Short":   VC.BinaryWithSubtype(uuid[:8], BinaryUUID),
+		} {
+			_, ok := value.UUIDOK()
+			assert.False(t, ok, name)
+			assert.Panics(t, func() { value.UUID() }, name)
+		}
+	})
+}
+
+func TestValidateBinary(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		subtype byte
+		size    int
+		err     error
+	}{
+		{name: "Generic", subtype: BinaryGeneric, size: 3},
+		{name: "EmptyGeneric", subtype: BinaryGeneric, size: 0},
+		{name: "UUID", subtype: BinaryUUID, size: 16},
+		{name: "OldUUID", subtype: BinaryUUIDOld, size: 16},
+		{name: "MD5", subtype: BinaryMD5, size: 16},
+		{name: "UserDefined", subtype: BinaryUserDefined, size: 7},
+		{name: "ShortUUID", subtype: BinaryUUID, size: 15, err: bsonerr.InvalidBinaryLength},
+		{name: "LongUUID", subtype: BinaryUUID, size: 17, err: bsonerr.InvalidBinaryLength},
+		{name: "ShortOldUUID", subtype: BinaryUUIDOld, size: 4, err: bsonerr.InvalidBinaryLength},
+		{name: "LongMD5", subtype: BinaryMD5, size: 32, err: bsonerr.InvalidBinaryLength},
+		{name: "UndefinedSubtype", subtype: 0x10, size: 16, err: bsonerr.InvalidBinarySubtype},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			payload := make([]byte, test.size)
+			err := ValidateBinary(test.subtype, payload)
+			assert.Equal(t, test.err, errors.Cause(err))
+
+			elem, err := EC.BinaryWithSubtypeErr("foo", payload, test.subtype)
+			assert.Equal(t, test.err, errors.Cause(err))
+			value, verr := VC.BinaryWithSubtypeErr(payload, test.subtype)
+			assert.Equal(t, test.err, errors.Cause(verr))
+
+			if test.err != nil {
+				assert.Nil(t, elem)
+				assert.Nil(t, value)
+				return
+			}
+
+			subtype, data := value.Binary()
+			assert.Equal(t, test.subtype, subtype)
+			assert.Equal(t, payload, data)
+		})
+	}
+	t.Run("ReadDocument", func(t *testing.T) {
+		// encode a generic binary value, and change the subtype
+		// byte, which follows the document length, type, key, and
+		// binary length, to the UUID subtype.
+		data, err := NewDocument(EC.Binary("id", make([]byte, 10))).MarshalBSON()
+		require.NoError(t, err)
+		require.Equal(t, BinaryGeneric, data[12])
+		data[12] = BinaryUUID
+
+		_, err = ReadDocument(data)
+		assert.Equal(t, bsonerr.InvalidBinaryLength, errors.Cause(err))
+
+		_, err = Reader(data).Validate()
+		assert.Equal(t, bsonerr.InvalidBinaryLength, errors.Cause(err))
+	})
+}
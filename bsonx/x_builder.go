@@ -0,0 +1,261 @@
+package bsonx
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/pkg/errors"
+)
+
+// DocumentBuilder constructs documents from values that may not be
+// valid, without panicking. The Append methods return the builder so
+// that calls can be chained, and record the first error that they
+// encounter; once the builder has an error, later calls do nothing,
+// and Build returns the error.
+//
+// In addition to the errors that the Err constructors return, the
+// builder rejects keys and regular expressions that contain null
+// bytes, which the EC constructors encode as invalid BSON, and nil
+// elements, documents and arrays, which make Append and later
+// operations on the document panic.
+type DocumentBuilder struct {
+	doc *Document
+	err error
+}
+
+// NewDocumentBuilder returns an empty builder.
+func NewDocumentBuilder() *DocumentBuilder {
+	return &DocumentBuilder{doc: NewDocument()}
+}
+
+// Err returns the first error that the builder encountered, if any.
+func (b *DocumentBuilder) Err() error { return b.err }
+
+// Build returns the document, or the first error that the builder
+// encountered. Build also validates the document, and returns an
+// error if its encoded size is larger than a BSON document can
+// represent. The builder should not be used after calling Build.
+func (b *DocumentBuilder) Build() (*Document, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	if _, err := b.doc.Validate(); err != nil {
+		return nil, errors.Wrap(err, "problem validating document")
+	}
+
+	return b.doc, nil
+}
+
+// Append adds elements to the document, which must not be nil, and
+// must have valid keys. If any of the elements is nil, Append adds
+// none of them.
+func (b *DocumentBuilder) Append(elems ...*Element) *DocumentBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	for _, elem := range elems {
+		if elem == nil {
+			b.err = errors.WithStack(bsonerr.NilElement)
+			return b
+		}
+	}
+
+	for _, elem := range elems {
+		elem := elem
+		b.add(elem.Key(), func() (*Element, error) { return elem, nil })
+	}
+
+	return b
+}
+
+// AppendErr adds an element that a constructor that can fail (e.g.
+// EC.InterfaceErr) returns, so that calls to those constructors can
+// be chained:
+//
+//	builder.AppendErr(EC.InterfaceErr("value", value))
+func (b *DocumentBuilder) AppendErr(elem *Element, err error) *DocumentBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	if err != nil {
+		b.err = errors.Wrap(err, "problem constructing element")
+		return b
+	}
+
+	return b.Append(elem)
+}
+
+// add validates the key, and then appends the element that the
+// constructor returns, unless the builder already has an error. Keys
+// are validated before calling the constructor, which may panic on
+// invalid keys.
+func (b *DocumentBuilder) add(key string, constructor func() (*Element, error)) *DocumentBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	if strings.IndexByte(key, 0) >= 0 {
+		b.err = errors.Wrapf(bsonerr.InvalidKey, "key %q contains a null byte", key)
+		return b
+	}
+
+	if uint64(b.doc.Len()) >= MaxDocumentElements {
+		b.err = errors.WithStack(bsonerr.TooManyElements)
+		return b
+	}
+
+	elem, err := constructor()
+	if err != nil {
+		b.err = errors.Wrapf(err, "problem constructing element '%s'", key)
+		return b
+	}
+	if elem == nil {
+		b.err = errors.Wrapf(bsonerr.NilElement, "element '%s'", key)
+		return b
+	}
+
+	b.doc.Append(elem)
+	return b
+}
+
+// wrap adapts a constructor that cannot fail for add.
+func wrap(elem func() *Element) func() (*Element, error) {
+	return func() (*Element, error) { return elem(), nil }
+}
+
+// Double appends a double element.
+func (b *DocumentBuilder) Double(key string, f float64) *DocumentBuilder {
+	return b.add(key, wrap(func() *Element { return EC.Double(key, f) }))
+}
+
+// String appends a string element.
+func (b *DocumentBuilder) String(key, val string) *DocumentBuilder {
+	return b.add(key, wrap(func() *Element { return EC.String(key, val) }))
+}
+
+// Boolean appends a boolean element.
+func (b *DocumentBuilder) Boolean(key string, val bool) *DocumentBuilder {
+	return b.add(key, wrap(func() *Element { return EC.Boolean(key, val) }))
+}
+
+// Int32 appends a 32-bit integer element.
+func (b *DocumentBuilder) Int32(key string, i int32) *DocumentBuilder {
+	return b.add(key, wrap(func() *Element { return EC.Int32(key, i) }))
+}
+
+// Int64 appends a 64-bit integer element.
+func (b *DocumentBuilder) Int64(key string, i int64) *DocumentBuilder {
+	return b.add(key, wrap(func() *Element { return EC.Int64(key, i) }))
+}
+
+// Int appends an integer element, which is a 32-bit integer if the
+// value fits, as with EC.Int.
+func (b *DocumentBuilder) Int(key string, i int) *DocumentBuilder {
+	return b.add(key, wrap(func() *Element { return EC.Int(key, i) }))
+}
+
+// DateTime appends a datetime element, in milliseconds since the
+// epoch.
+func (b *DocumentBuilder) DateTime(key string, dt int64) *DocumentBuilder {
+	return b.add(key, wrap(func() *Element { return EC.DateTime(key, dt) }))
+}
+
+// Time appends a datetime element.
+func (b *DocumentBuilder) Time(key string, t time.Time) *DocumentBuilder {
+	return b.add(key, wrap(func() *Element { return EC.Time(key, t) }))
+}
+
+// Timestamp appends a timestamp element.
+func (b *DocumentBuilder) Timestamp(key string, t, i uint32) *DocumentBuilder {
+	return b.add(key, wrap(func() *Element { return EC.Timestamp(key, t, i) }))
+}
+
+// Null appends a null element.
+func (b *DocumentBuilder) Null(key string) *DocumentBuilder {
+	return b.add(key, wrap(func() *Element { return EC.Null(key) }))
+}
+
+// Binary appends a binary element with the generic subtype.
+func (b *DocumentBuilder) Binary(key string, data []byte) *DocumentBuilder {
+	return b.BinaryWithSubtype(key, data, BinaryGeneric)
+}
+
+// BinaryWithSubtype appends a binary element, and records an error if
+// the subtype and payload are not valid together, as ValidateBinary
+// does.
+func (b *DocumentBuilder) BinaryWithSubtype(key string, data []byte, subtype byte) *DocumentBuilder {
+	return b.add(key, func() (*Element, error) { return EC.BinaryWithSubtypeErr(key, data, subtype) })
+}
+
+// UUID appends a binary element with the UUID subtype.
+func (b *DocumentBuilder) UUID(key string, uuid [16]byte) *DocumentBuilder {
+	return b.add(key, wrap(func() *Element { return EC.UUID(key, uuid) }))
+}
+
+// Regex appends a regular expression element, and records an error if
+// the pattern or options contain null bytes.
+func (b *DocumentBuilder) Regex(key, pattern, options string) *DocumentBuilder {
+	return b.add(key, func() (*Element, error) {
+		if strings.IndexByte(pattern, 0) >= 0 || strings.IndexByte(options, 0) >= 0 {
+			return nil, errors.New("regular expressions cannot contain null bytes")
+		}
+		return EC.Regex(key, pattern, options), nil
+	})
+}
+
+// SubDocument appends an embedded document, which must not be nil.
+func (b *DocumentBuilder) SubDocument(key string, doc *Document) *DocumentBuilder {
+	return b.add(key, func() (*Element, error) {
+		if doc == nil {
+			return nil, errors.WithStack(bsonerr.NilDocument)
+		}
+		return EC.SubDocument(key, doc), nil
+	})
+}
+
+// Builder appends the document that another builder builds, and
+// records the other builder's error, if it has one.
+func (b *DocumentBuilder) Builder(key string, sub *DocumentBuilder) *DocumentBuilder {
+	return b.add(key, func() (*Element, error) {
+		if sub == nil {
+			return nil, errors.WithStack(bsonerr.NilDocument)
+		}
+		doc, err := sub.Build()
+		if err != nil {
+			return nil, err
+		}
+		return EC.SubDocument(key, doc), nil
+	})
+}
+
+// Array appends an array, which must not be nil.
+func (b *DocumentBuilder) Array(key string, array *Array) *DocumentBuilder {
+	return b.add(key, func() (*Element, error) {
+		if array == nil {
+			return nil, errors.New("array is nil")
+		}
+		return EC.Array(key, array), nil
+	})
+}
+
+// Interface appends an element for an arbitrary value, and records an
+// error, rather than appending a null element, if the value cannot be
+// converted, as with EC.InterfaceErr.
+func (b *DocumentBuilder) Interface(key string, value interface{}) *DocumentBuilder {
+	return b.add(key, func() (*Element, error) { return EC.InterfaceErr(key, value) })
+}
+
+// Marshaler appends an embedded document from a value that implements
+// the Marshaler interface.
+func (b *DocumentBuilder) Marshaler(key string, val Marshaler) *DocumentBuilder {
+	return b.add(key, func() (*Element, error) {
+		if val == nil {
+			return nil, errors.New("marshaler is nil")
+		}
+		return EC.MarshalerErr(key, val)
+	})
+}
@@ -0,0 +1,147 @@
+package bsonx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentBuilder(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		now := time.Now().Round(time.Millisecond)
+		uuid := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+		doc, err := NewDocumentBuilder().
+			Double("double", 1.5).
+			String("string", "foo").
+			Boolean("bool", true).
+			Int32("int32", 32).
+			Int64("int64", 64).
+			Int("int", 42).
+			DateTime("datetime", 1000).
+			Time("time", now).
+			Timestamp("ts", 1, 2).
+			Null("null").
+			Binary("binary", []byte("bar")).
+			UUID("uuid", uuid).
+			Regex("regex", "^a", "i").
+			SubDocument("doc", NewDocument(EC.Int64("a", 1))).
+			Builder("nested", NewDocumentBuilder().Int64("b", 2)).
+			Array("array", NewArray(VC.Int64(1), VC.Int64(2))).
+			Interface("iface", int64(3)).
+			Append(EC.String("appended", "baz")).
+			AppendErr(EC.InterfaceErr("appendErr", "qux")).
+			Build()
+		require.NoError(t, err)
+		require.Equal(t, 19, doc.Len())
+
+		data, err := doc.MarshalBSON()
+		require.NoError(t, err)
+		out, err := ReadDocument(data)
+		require.NoError(t, err)
+		assert.True(t, doc.Equal(out))
+
+		assert.Equal(t, 1.5, out.Lookup("double").Double())
+		assert.Equal(t, "foo", out.Lookup("string").StringValue())
+		assert.Equal(t, now, out.Lookup("time").Time())
+		assert.Equal(t, uuid, out.Lookup("uuid").UUID())
+		assert.EqualValues(t, 2, out.Lookup("nested").MutableDocument().Lookup("b").Int64())
+		assert.Equal(t, "qux", out.Lookup("appendErr").StringValue())
+	})
+	t.Run("Empty", func(t *testing.T) {
+		doc, err := NewDocumentBuilder().Build()
+		require.NoError(t, err)
+		assert.Equal(t, 0, doc.Len())
+	})
+	for _, test := range []struct {
+		name  string
+		build func(*DocumentBuilder) *DocumentBuilder
+		cause error
+	}{
+		{
+			name:  "NullByteInKey",
+			build: func(b *DocumentBuilder) *DocumentBuilder { return b.Int64("a\x00b", 1) },
+			cause: bsonerr.InvalidKey,
+		},
+		{
+			name:  "NullByteInAppendedKey",
+			build: func(b *DocumentBuilder) *DocumentBuilder { return b.Append(EC.Int64("a\x00b", 1)) },
+			cause: bsonerr.InvalidKey,
+		},
+		{
+			name:  "NilElement",
+			build: func(b *DocumentBuilder) *DocumentBuilder { return b.Append(EC.Int64("a", 1), nil) },
+			cause: bsonerr.NilElement,
+		},
+		{
+			name:  "NilDocument",
+			build: func(b *DocumentBuilder) *DocumentBuilder { return b.SubDocument("doc", nil) },
+			cause: bsonerr.NilDocument,
+		},
+		{
+			name:  "NilBuilder",
+			build: func(b *DocumentBuilder) *DocumentBuilder { return b.Builder("doc", nil) },
+			cause: bsonerr.NilDocument,
+		},
+		{
+			name: "NestedBuilderError",
+			build: func(b *DocumentBuilder) *DocumentBuilder {
+				return b.Builder("doc", NewDocumentBuilder().SubDocument("inner", nil))
+			},
+			cause: bsonerr.NilDocument,
+		},
+		{
+			name: "InvalidBinary",
+			build: func(b *DocumentBuilder) *DocumentBuilder {
+				return b.BinaryWithSubtype("id", []byte("short"), BinaryUUID)
+			},
+			cause: bsonerr.InvalidBinaryLength,
+		},
+		{
+			name:  "NullByteInRegex",
+			build: func(b *DocumentBuilder) *DocumentBuilder { return b.Regex("regex", "a\x00", "") },
+		},
+		{
+			name:  "NilArray",
+			build: func(b *DocumentBuilder) *DocumentBuilder { return b.Array("array", nil) },
+		},
+		{
+			name:  "UnsupportedInterface",
+			build: func(b *DocumentBuilder) *DocumentBuilder { return b.Interface("chan", make(chan int)) },
+		},
+		{
+			name:  "NilMarshaler",
+			build: func(b *DocumentBuilder) *DocumentBuilder { return b.Marshaler("m", nil) },
+		},
+		{
+			name: "AppendErr",
+			build: func(b *DocumentBuilder) *DocumentBuilder {
+				return b.AppendErr(nil, errors.WithStack(bsonerr.OutOfBounds))
+			},
+			cause: bsonerr.OutOfBounds,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			builder := test.build(NewDocumentBuilder().Int64("first", 1))
+			require.Error(t, builder.Err())
+			if test.cause != nil {
+				assert.Equal(t, test.cause, errors.Cause(builder.Err()))
+			}
+
+			// later calls do not replace the first error, or
+			// add elements.
+			first := builder.Err()
+			builder.SubDocument("nil", nil).Int64("last", 2)
+			assert.Equal(t, first, builder.Err())
+			assert.Equal(t, 1, builder.doc.Len())
+
+			doc, err := builder.Build()
+			assert.Nil(t, doc)
+			assert.Equal(t, first, err)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package bsonx
+
+import "sync/atomic"
+
+// Clone returns a copy of the document that, unlike Copy, shares the
+// storage of its elements and index with the document until either
+// document is modified: the first modification of a shared document
+// copies its storage, so that cloning a document that is only read
+// (e.g. the reference document of a chunk) does not allocate storage
+// for its elements.
+//
+// As with Copy, the clone shares its elements with the document, so
+// changes to the values of elements, or to embedded documents, are
+// visible in both documents. Clones of documents built from a
+// DocumentArena share the memory of the arena, and must not be used
+// after the arena is Reset.
+func (d *Document) Clone() *Document {
+	if d == nil {
+		return nil
+	}
+
+	atomic.StoreUint32(&d.shared, 1)
+	doc := &Document{
+		IgnoreNilInsert: d.IgnoreNilInsert,
+		KeyIndex:        d.KeyIndex,
+		elems:           d.elems,
+		index:           d.index,
+		shared:          1,
+	}
+	if keys, _ := d.keys.Load().(keyIndex); keys != nil {
+		doc.keys.Store(keys)
+	}
+
+	return doc
+}
+
+// own copies the storage of the document, if it's shared with a
+// clone, so that it can be modified. Methods that modify the elems or
+// index slices in place, or append to them, must call own first, which
+// also discards the document's key index.
+func (d *Document) own() {
+	d.resetKeyIndex()
+	if atomic.LoadUint32(&d.shared) == 0 {
+		return
+	}
+
+	elems := make([]*Element, len(d.elems), cap(d.elems))
+	index := make([]uint32, len(d.index), cap(d.index))
+	copy(elems, d.elems)
+	copy(index, d.index)
+
+	d.elems, d.index = elems, index
+	atomic.StoreUint32(&d.shared, 0)
+}
@@ -0,0 +1,96 @@
+package bsonx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentClone(t *testing.T) {
+	base := func() *Document {
+		return NewDocument(
+			EC.Int32("a", 1),
+			EC.String("host", "one"),
+			EC.ArrayFromElements("list", VC.Int32(1), VC.Int32(2)),
+		)
+	}
+
+	var doc *Document
+	assert.Nil(t, doc.Clone())
+
+	t.Run("Shared", func(t *testing.T) {
+		doc := base()
+		clone := doc.Clone()
+		assert.True(t, clone.Equal(doc))
+		assert.Equal(t, &doc.elems[0], &clone.elems[0], "storage is shared")
+
+		// reads don't copy the storage.
+		assert.Equal(t, "one", clone.Lookup("host").StringValue())
+		assert.Equal(t, &doc.elems[0], &clone.elems[0])
+	})
+	for name, mutate := range map[string]func(*Document){
+		"Append":  func(d *Document) { d.Append(EC.Int32("b", 2)) },
+		"Prepend": func(d *Document) { d.Prepend(EC.Int32("b", 2)) },
+		"Set":     func(d *Document) { d.Set(EC.String("host", "two")) },
+		"Delete":  func(d *Document) { d.Delete("a") },
+		"Reset":   func(d *Document) { d.Reset() },
+		"Concat":  func(d *Document) { require.NoError(t, d.Concat(NewDocument(EC.Int32("b", 2)))) },
+		"SetPath": func(d *Document) { require.NoError(t, d.SetPath("mem.resident", VC.Int64(10))) },
+		"Unmarshal": func(d *Document) {
+			require.NoError(t, d.UnmarshalBSON([]byte{0x0c, 0, 0, 0, 0x10, 'b', 0, 0x02, 0, 0, 0, 0}))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Run("Clone", func(t *testing.T) {
+				doc := base()
+				clone := doc.Clone()
+				mutate(clone)
+
+				assert.True(t, doc.Equal(base()), "the original is not modified")
+				assert.False(t, clone.Equal(base()))
+			})
+			t.Run("Original", func(t *testing.T) {
+				doc := base()
+				clone := doc.Clone()
+				mutate(doc)
+
+				assert.True(t, clone.Equal(base()), "the clone is not modified")
+				assert.False(t, doc.Equal(base()))
+			})
+		})
+	}
+	t.Run("Array", func(t *testing.T) {
+		doc := base()
+		clone := doc.Clone()
+		list := doc.Lookup("list").MutableArray()
+		cloned := list.doc.Clone()
+
+		(&Array{cloned}).Set(0, VC.Int32(10)).Delete(1)
+		assert.Equal(t, 2, list.Len())
+		assert.EqualValues(t, 1, list.Lookup(0).Int32())
+		assert.True(t, clone.Equal(doc))
+	})
+	t.Run("Chained", func(t *testing.T) {
+		doc := base()
+		first := doc.Clone()
+		second := first.Clone()
+
+		first.Set(EC.Int32("a", 2))
+		second.Set(EC.Int32("a", 3))
+		assert.EqualValues(t, 1, doc.Lookup("a").Int32())
+		assert.EqualValues(t, 2, first.Lookup("a").Int32())
+		assert.EqualValues(t, 3, second.Lookup("a").Int32())
+	})
+	t.Run("Allocations", func(t *testing.T) {
+		doc := DC.Make(64)
+		for i := 0; i < 64; i++ {
+			doc.Append(EC.Int32(string(rune('a'+i)), int32(i)))
+		}
+
+		clone := testing.AllocsPerRun(10, func() { _ = doc.Clone().Lookup("a") })
+		copied := testing.AllocsPerRun(10, func() { _ = doc.Copy().Lookup("a") })
+		assert.True(t, clone <= 1, "%v", clone)
+		assert.True(t, clone < copied, "%v < %v", clone, copied)
+	})
+}
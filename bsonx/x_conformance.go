@@ -0,0 +1,364 @@
+package bsonx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+)
+
+// ConformanceClass classifies encoded BSON by how it conforms to the
+// BSON specification, using the categories of the BSON corpus in the
+// MongoDB specifications repository.
+type ConformanceClass int
+
+const (
+	// ConformanceValid is the class of canonical BSON.
+	ConformanceValid ConformanceClass = iota
+
+	// ConformanceDegenerate is the class of BSON that decoders
+	// accept, but that a conforming encoder would not produce,
+	// (e.g. array keys that are not the indexes of the elements,
+	// or regular expression options that are not sorted.)
+	ConformanceDegenerate
+
+	// ConformanceInvalid is the class of BSON that decoders must
+	// reject (e.g. truncated values, inconsistent lengths, or
+	// strings that are not valid UTF-8.)
+	ConformanceInvalid
+)
+
+func (c ConformanceClass) String() string {
+	switch c {
+	case ConformanceValid:
+		return "valid"
+	case ConformanceDegenerate:
+		return "degenerate"
+	case ConformanceInvalid:
+		return "invalid"
+	default:
+		return fmt.Sprintf("ConformanceClass(%d)", int(c))
+	}
+}
+
+// ConformanceIssue describes a single deviation from the BSON
+// specification.
+type ConformanceIssue struct {
+	Class ConformanceClass
+	// Offset is the position in the input of the document or
+	// element with the issue.
+	Offset int
+	// Path holds the dot separated keys of the element with the
+	// issue, and is empty for issues with the top level document.
+	Path    string
+	Message string
+}
+
+func (i ConformanceIssue) String() string {
+	if i.Path == "" {
+		return fmt.Sprintf("%s at offset %d: %s", i.Class, i.Offset, i.Message)
+	}
+	return fmt.Sprintf("%s at offset %d (%s): %s", i.Class, i.Offset, i.Path, i.Message)
+}
+
+// ConformanceReport is the result of CheckConformance.
+type ConformanceReport struct {
+	// Class is the most severe class of the issues, or
+	// ConformanceValid if there are none.
+	Class  ConformanceClass
+	Issues []ConformanceIssue
+}
+
+// CheckConformance checks that the input holds exactly one BSON
+// document that conforms to the BSON specification, and reports every
+// deviation that it finds. Degenerate encodings do not prevent the
+// check from continuing, but the check stops at the first issue that
+// makes the input invalid, as the layout of the rest of the input is
+// not known.
+//
+// Unlike ReadDocument and Reader.Validate, which only check enough of
+// the input to decode it, CheckConformance validates every value, and
+// is meant for tools that classify suspicious inputs.
+func CheckConformance(raw []byte) ConformanceReport {
+	c := &conformanceChecker{data: raw}
+
+	size, ok := c.document(0, len(raw), "", false)
+	if ok && size != len(raw) {
+		c.invalid(size, "", "%d bytes after the end of the document", len(raw)-size)
+	}
+
+	out := ConformanceReport{Issues: c.issues}
+	for _, issue := range c.issues {
+		if issue.Class > out.Class {
+			out.Class = issue.Class
+		}
+	}
+	return out
+}
+
+type conformanceChecker struct {
+	data   []byte
+	issues []ConformanceIssue
+}
+
+func (c *conformanceChecker) invalid(offset int, path, msg string, args ...interface{}) {
+	c.issues = append(c.issues, ConformanceIssue{
+		Class:   ConformanceInvalid,
+		Offset:  offset,
+		Path:    path,
+		Message: fmt.Sprintf(msg, args...),
+	})
+}
+
+func (c *conformanceChecker) degenerate(offset int, path, msg string, args ...interface{}) {
+	c.issues = append(c.issues, ConformanceIssue{
+		Class:   ConformanceDegenerate,
+		Offset:  offset,
+		Path:    path,
+		Message: fmt.Sprintf(msg, args...),
+	})
+}
+
+func (c *conformanceChecker) int32At(pos int) int {
+	return int(int32(binary.LittleEndian.Uint32(c.data[pos:])))
+}
+
+// length reads the int32 length prefix at the position, which must be
+// at least min, and must not extend past end.
+func (c *conformanceChecker) length(pos, end, min int, path, name string) (int, bool) {
+	if pos+4 > end {
+		c.invalid(pos, path, "%s length is truncated", name)
+		return 0, false
+	}
+
+	size := c.int32At(pos)
+	if size < min {
+		c.invalid(pos, path, "%s length %d is less than %d", name, size, min)
+		return 0, false
+	}
+	if size > end-pos {
+		c.invalid(pos, path, "%s length %d exceeds the %d remaining bytes", name, size, end-pos)
+		return 0, false
+	}
+	return size, true
+}
+
+// document checks the document or array at the position, which must
+// end before end, and returns its size.
+func (c *conformanceChecker) document(pos, end int, path string, array bool) (int, bool) {
+	name := "document"
+	if array {
+		name = "array"
+	}
+
+	size, ok := c.length(pos, end, MinDocumentSize, path, name)
+	if !ok {
+		return 0, false
+	}
+	end = pos + size
+
+	if c.data[end-1] != 0x00 {
+		c.invalid(end-1, path, "%s is not null terminated", name)
+		return 0, false
+	}
+
+	idx := 0
+	for elem := pos + 4; elem < end-1; idx++ {
+		next, ok := c.element(elem, end-1, path, array, idx)
+		if !ok {
+			return 0, false
+		}
+		elem = next
+	}
+
+	return size, true
+}
+
+// element checks the element at the position, which must end before
+// end, and returns the position of the next element.
+func (c *conformanceChecker) element(pos, end int, parent string, array bool, idx int) (int, bool) {
+	t := bsontype.Type(c.data[pos])
+	if t == 0x00 {
+		c.invalid(pos, parent, "null terminator before the end of the document")
+		return 0, false
+	}
+
+	key, next, ok := c.cstring(pos+1, end, parent, "key")
+	if !ok {
+		return 0, false
+	}
+	path := key
+	if parent != "" {
+		path = parent + "." + key
+	}
+	if array && key != strconv.Itoa(idx) {
+		c.degenerate(pos, path, "array key '%s' is not the index %d", key, idx)
+	}
+
+	if size, ok := FixedValueSize(t); ok {
+		if next+size > end {
+			c.invalid(pos, path, "%s value is truncated", t)
+			return 0, false
+		}
+		if t == bsontype.Boolean && c.data[next] > 1 {
+			c.invalid(pos, path, "boolean value is %d", c.data[next])
+			return 0, false
+		}
+		return next + size, true
+	}
+
+	switch t {
+	case bsontype.String, bsontype.JavaScript, bsontype.Symbol:
+		return c.str(next, end, path, t.String())
+	case bsontype.EmbeddedDocument, bsontype.Array:
+		size, ok := c.document(next, end, path, t == bsontype.Array)
+		if !ok {
+			return 0, false
+		}
+		return next + size, true
+	case bsontype.Binary:
+		return c.binary(next, end, path)
+	case bsontype.Regex:
+		return c.regex(next, end, path)
+	case bsontype.DBPointer:
+		next, ok = c.str(next, end, path, "db pointer namespace")
+		if !ok {
+			return 0, false
+		}
+		if next+12 > end {
+			c.invalid(pos, path, "db pointer id is truncated")
+			return 0, false
+		}
+		return next + 12, true
+	case bsontype.CodeWithScope:
+		return c.codeWithScope(next, end, path)
+	default:
+		c.invalid(pos, path, "unknown element type 0x%02x", byte(t))
+		return 0, false
+	}
+}
+
+func (c *conformanceChecker) cstring(pos, end int, path, name string) (string, int, bool) {
+	stop := pos
+	for stop < end && c.data[stop] != 0x00 {
+		stop++
+	}
+	if stop >= end {
+		c.invalid(pos, path, "%s is not null terminated", name)
+		return "", 0, false
+	}
+
+	value := string(c.data[pos:stop])
+	if !utf8.ValidString(value) {
+		c.invalid(pos, path, "%s is not valid UTF-8", name)
+		return "", 0, false
+	}
+	return value, stop + 1, true
+}
+
+// str checks a length prefixed string, which must hold at least its
+// null terminator.
+func (c *conformanceChecker) str(pos, end int, path, name string) (int, bool) {
+	size, ok := c.length(pos, end, 1, path, name)
+	if !ok {
+		return 0, false
+	}
+
+	if pos+4+size > end {
+		c.invalid(pos, path, "%s of %d bytes is truncated", name, size)
+		return 0, false
+	}
+
+	value := c.data[pos+4 : pos+4+size]
+	if value[size-1] != 0x00 {
+		c.invalid(pos, path, "%s is not null terminated", name)
+		return 0, false
+	}
+	if !utf8.Valid(value[:size-1]) {
+		c.invalid(pos, path, "%s is not valid UTF-8", name)
+		return 0, false
+	}
+	return pos + 4 + size, true
+}
+
+func (c *conformanceChecker) binary(pos, end int, path string) (int, bool) {
+	size, ok := c.length(pos, end, 0, path, "binary")
+	if !ok {
+		return 0, false
+	}
+	if pos+BinaryHeaderSize+size > end {
+		c.invalid(pos, path, "binary value of %d bytes is truncated", size)
+		return 0, false
+	}
+
+	if c.data[pos+4] == 0x02 {
+		// the old binary subtype repeats the length of the
+		// data inside of the value.
+		if size < 4 {
+			c.invalid(pos, path, "old binary value is too short for its length")
+			return 0, false
+		}
+		if inner := c.int32At(pos + BinaryHeaderSize); inner != size-4 {
+			c.invalid(pos, path, "old binary length %d does not match the value length %d", inner, size-4)
+			return 0, false
+		}
+	}
+
+	return pos + BinaryHeaderSize + size, true
+}
+
+func (c *conformanceChecker) regex(pos, end int, path string) (int, bool) {
+	_, next, ok := c.cstring(pos, end, path, "regex pattern")
+	if !ok {
+		return 0, false
+	}
+	options, next, ok := c.cstring(next, end, path, "regex options")
+	if !ok {
+		return 0, false
+	}
+
+	for idx := 1; idx < len(options); idx++ {
+		if options[idx] <= options[idx-1] {
+			c.degenerate(pos, path, "regex options '%s' are not in alphabetical order", options)
+			break
+		}
+	}
+	if strings.Trim(options, "ilmsux") != "" {
+		c.degenerate(pos, path, "regex options '%s' include unknown options", options)
+	}
+
+	return next, true
+}
+
+func (c *conformanceChecker) codeWithScope(pos, end int, path string) (int, bool) {
+	// the length covers itself, the code string (at least five
+	// bytes), and the scope document (at least five bytes.)
+	size, ok := c.length(pos, end, 14, path, "code with scope")
+	if !ok {
+		return 0, false
+	}
+	stop := pos + size
+
+	next, ok := c.str(pos+4, stop, path, "code with scope code")
+	if !ok {
+		return 0, false
+	}
+
+	scope, ok := c.length(next, stop, MinDocumentSize, path, "code with scope scope")
+	if !ok {
+		return 0, false
+	}
+	if next+scope != stop {
+		c.invalid(pos, path, "code with scope length %d does not match the length of its contents", size)
+		return 0, false
+	}
+
+	if _, ok = c.document(next, stop, path+".$scope", false); !ok {
+		return 0, false
+	}
+
+	return stop, true
+}
@@ -0,0 +1,118 @@
+package bsonx
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The files in testdata/bson-corpus use the format of the BSON corpus
+// in the MongoDB specifications repository, and hold a subset of its
+// cases for the types that have structural rules. Files from the
+// corpus can be added to the directory as they are.
+type conformanceCorpusFile struct {
+	Description string `json:"description"`
+	Valid       []struct {
+		Description    string  `json:"description"`
+		CanonicalBSON  string  `json:"canonical_bson"`
+		DegenerateBSON *string `json:"degenerate_bson"`
+	} `json:"valid"`
+	DecodeErrors []struct {
+		Description string `json:"description"`
+		BSON        string `json:"bson"`
+	} `json:"decodeErrors"`
+}
+
+func TestConformanceCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "bson-corpus", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	check := func(t *testing.T, data string, expected ConformanceClass) {
+		raw, err := hex.DecodeString(data)
+		require.NoError(t, err)
+
+		report := CheckConformance(raw)
+		assert.Equal(t, expected, report.Class, "%v", report.Issues)
+		if expected == ConformanceValid {
+			assert.Empty(t, report.Issues)
+		} else {
+			assert.NotEmpty(t, report.Issues)
+		}
+	}
+
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		require.NoError(t, err)
+
+		corpus := conformanceCorpusFile{}
+		require.NoError(t, json.Unmarshal(data, &corpus))
+
+		t.Run(corpus.Description, func(t *testing.T) {
+			for _, test := range corpus.Valid {
+				t.Run(test.Description, func(t *testing.T) {
+					check(t, test.CanonicalBSON, ConformanceValid)
+					if test.DegenerateBSON != nil {
+						check(t, *test.DegenerateBSON, ConformanceDegenerate)
+					}
+				})
+			}
+			for _, test := range corpus.DecodeErrors {
+				t.Run(test.Description, func(t *testing.T) {
+					check(t, test.BSON, ConformanceInvalid)
+				})
+			}
+		})
+	}
+}
+
+func TestCheckConformance(t *testing.T) {
+	t.Run("EncodedDocuments", func(t *testing.T) {
+		for name, doc := range map[string]*Document{
+			"Empty":  NewDocument(),
+			"Nested": NewDocument(EC.SubDocumentFromElements("a", EC.ArrayFromElements("b", VC.Int32(1), VC.String("c")))),
+			"Mixed":  NewDocument(EC.Double("a", 1.5), EC.Boolean("b", true), EC.Null("c"), EC.Regex("d", "x", "im"), EC.Binary("e", []byte{1, 2})),
+			"Large":  makeLargeDocument(1000, false),
+		} {
+			t.Run(name, func(t *testing.T) {
+				data, err := doc.MarshalBSON()
+				require.NoError(t, err)
+
+				report := CheckConformance(data)
+				assert.Equal(t, ConformanceValid, report.Class)
+				assert.Empty(t, report.Issues)
+			})
+		}
+	})
+	t.Run("ReportsPathAndOffset", func(t *testing.T) {
+		data, err := NewDocument(EC.SubDocumentFromElements("a", EC.Boolean("b", true))).MarshalBSON()
+		require.NoError(t, err)
+		// the value of the boolean is the byte before the
+		// terminators of the two documents.
+		data[len(data)-3] = 2
+
+		report := CheckConformance(data)
+		require.Len(t, report.Issues, 1)
+		assert.Equal(t, ConformanceInvalid, report.Issues[0].Class)
+		assert.Equal(t, "a.b", report.Issues[0].Path)
+		assert.Equal(t, 11, report.Issues[0].Offset)
+	})
+	t.Run("ReportsEveryDegenerateIssue", func(t *testing.T) {
+		data, err := NewDocument(
+			EC.Regex("a", "x", "mi"),
+			EC.Regex("b", "x", "iz"),
+		).MarshalBSON()
+		require.NoError(t, err)
+
+		report := CheckConformance(data)
+		assert.Equal(t, ConformanceDegenerate, report.Class)
+		require.Len(t, report.Issues, 2)
+		assert.Equal(t, "a", report.Issues[0].Path)
+		assert.Equal(t, "b", report.Issues[1].Path)
+	})
+}
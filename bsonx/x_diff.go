@@ -0,0 +1,141 @@
+package bsonx
+
+import (
+	"strconv"
+
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+)
+
+// ChangeType describes how a value differs between two documents.
+type ChangeType int
+
+// The types of changes that Diff reports.
+const (
+	ChangeAdded ChangeType = iota + 1
+	ChangeRemoved
+	ChangeModified
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// Change is a difference between two documents. Path is the dot
+// separated path of the value (see LookupPath). Old is nil for added
+// values and New is nil for removed values.
+type Change struct {
+	Type ChangeType
+	Path string
+	Old  *Value
+	New  *Value
+}
+
+// Diff returns the differences between the document and another
+// document, as the changes that turn the document into the other
+// document. Embedded documents and arrays are compared recursively,
+// so that changes describe the values that differ, rather than the
+// documents that contain them, except when a value changes type.
+//
+// Documents are compared canonically: the order of keys does not
+// matter, and when a document has more than one element with a key,
+// only the first is compared, as with Lookup. Array elements are
+// compared by their index. Values of different types, including
+// numbers of different types, are not equal.
+//
+// Changes to the values of the document are in document order,
+// followed by the values that are only in the other document, in the
+// order of the other document. A nil document is the same as an
+// empty document. Diff returns nil if the documents are equivalent.
+func (d *Document) Diff(other *Document) []Change {
+	return diffDocuments(nil, "", d, other)
+}
+
+// Equivalent returns true if the documents have the same values
+// regardless of the order of their keys, (i.e. Diff does not report
+// any changes.) Use Equal to also compare the order of keys.
+func (d *Document) Equivalent(other *Document) bool { return len(d.Diff(other)) == 0 }
+
+func diffPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func diffDocuments(out []Change, prefix string, d, other *Document) []Change {
+	if d == nil {
+		d = DC.Make(0)
+	}
+	if other == nil {
+		other = DC.Make(0)
+	}
+
+	seen := make(map[string]struct{}, len(d.elems))
+	for _, elem := range d.elems {
+		key := elem.Key()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		path := diffPath(prefix, key)
+		match := other.LookupElement(key)
+		if match == nil {
+			out = append(out, Change{Type: ChangeRemoved, Path: path, Old: d.LookupElement(key).Value()})
+			continue
+		}
+
+		out = diffValues(out, path, d.LookupElement(key).Value(), match.Value())
+	}
+
+	for _, elem := range other.elems {
+		key := elem.Key()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		out = append(out, Change{Type: ChangeAdded, Path: diffPath(prefix, key), New: other.LookupElement(key).Value()})
+	}
+
+	return out
+}
+
+func diffArrays(out []Change, prefix string, a, other *Array) []Change {
+	for idx := 0; idx < a.Len() || idx < other.Len(); idx++ {
+		path := diffPath(prefix, strconv.Itoa(idx))
+		switch {
+		case idx >= other.Len():
+			out = append(out, Change{Type: ChangeRemoved, Path: path, Old: a.Lookup(uint(idx))})
+		case idx >= a.Len():
+			out = append(out, Change{Type: ChangeAdded, Path: path, New: other.Lookup(uint(idx))})
+		default:
+			out = diffValues(out, path, a.Lookup(uint(idx)), other.Lookup(uint(idx)))
+		}
+	}
+
+	return out
+}
+
+func diffValues(out []Change, path string, v1, v2 *Value) []Change {
+	switch {
+	case v1.Type() != v2.Type():
+	case v1.Type() == bsontype.EmbeddedDocument:
+		return diffDocuments(out, path, v1.MutableDocument(), v2.MutableDocument())
+	case v1.Type() == bsontype.Array:
+		return diffArrays(out, path, v1.MutableArray(), v2.MutableArray())
+	case v1.Equal(v2):
+		return out
+	}
+
+	return append(out, Change{Type: ChangeModified, Path: path, Old: v1, New: v2})
+}
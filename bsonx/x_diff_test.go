@@ -0,0 +1,99 @@
+package bsonx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertChanges(t *testing.T, expected, actual []Change) {
+	require.Len(t, actual, len(expected))
+	for idx := range expected {
+		assert.Equal(t, expected[idx].Type, actual[idx].Type, "%d", idx)
+		assert.Equal(t, expected[idx].Path, actual[idx].Path, "%d", idx)
+		assert.True(t, expected[idx].Old.Equal(actual[idx].Old), "%d: %s", idx, actual[idx].Old)
+		assert.True(t, expected[idx].New.Equal(actual[idx].New), "%d: %s", idx, actual[idx].New)
+	}
+}
+
+func TestDocumentDiff(t *testing.T) {
+	t.Run("Equivalent", func(t *testing.T) {
+		doc := makePathDocument()
+		assert.Nil(t, doc.Diff(makePathDocument()))
+		assert.True(t, doc.Equivalent(makePathDocument()))
+
+		data, err := doc.MarshalBSON()
+		require.NoError(t, err)
+		read, err := ReadDocument(data)
+		require.NoError(t, err)
+		assert.True(t, doc.Equivalent(read))
+	})
+	t.Run("KeyOrder", func(t *testing.T) {
+		d1 := NewDocument(EC.Int32("a", 1), EC.SubDocumentFromElements("b", EC.String("x", "1"), EC.String("y", "2")))
+		d2 := NewDocument(EC.SubDocumentFromElements("b", EC.String("y", "2"), EC.String("x", "1")), EC.Int32("a", 1))
+		assert.True(t, d1.Equivalent(d2))
+		assert.False(t, d1.Equal(d2))
+	})
+	t.Run("Nil", func(t *testing.T) {
+		var doc *Document
+		assert.Nil(t, doc.Diff(nil))
+		assert.True(t, doc.Equivalent(NewDocument()))
+
+		assertChanges(t, []Change{{Type: ChangeAdded, Path: "a", New: VC.Int32(1)}}, doc.Diff(NewDocument(EC.Int32("a", 1))))
+	})
+	t.Run("Changes", func(t *testing.T) {
+		d1 := makePathDocument()
+		d2 := NewDocument(
+			EC.SubDocumentFromElements("b",
+				EC.String("c", "bar"),
+				EC.ArrayFromElements("d",
+					VC.Int64(10),
+					VC.DocumentFromElements(EC.Int64("e", 42), EC.Boolean("f", true)),
+				),
+			),
+			EC.String("g", "new"),
+		)
+
+		assertChanges(t, []Change{
+			{Type: ChangeRemoved, Path: "a", Old: VC.Int32(1)},
+			{Type: ChangeModified, Path: "b.c", Old: VC.String("foo"), New: VC.String("bar")},
+			{Type: ChangeModified, Path: "b.d.0", Old: VC.Int32(10), New: VC.Int64(10)},
+			{Type: ChangeAdded, Path: "b.d.1.f", New: VC.Boolean(true)},
+			{Type: ChangeRemoved, Path: "b.d.2", Old: VC.ArrayFromValues(VC.Int32(7), VC.Int32(8))},
+			{Type: ChangeAdded, Path: "g", New: VC.String("new")},
+		}, d1.Diff(d2))
+
+		// the reverse diff has the opposite changes.
+		reverse := d2.Diff(d1)
+		require.Len(t, reverse, 6)
+		assert.Equal(t, ChangeModified, reverse[0].Type)
+		assert.Equal(t, "b.c", reverse[0].Path)
+		assert.Equal(t, ChangeRemoved, reverse[2].Type)
+		assert.Equal(t, "b.d.1.f", reverse[2].Path)
+		assert.Equal(t, ChangeAdded, reverse[5].Type)
+		assert.Equal(t, "a", reverse[5].Path)
+	})
+	t.Run("TypeChange", func(t *testing.T) {
+		d1 := NewDocument(EC.SubDocumentFromElements("a", EC.Int32("b", 1)))
+		d2 := NewDocument(EC.ArrayFromElements("a", VC.Int32(1)))
+
+		assertChanges(t, []Change{{
+			Type: ChangeModified,
+			Path: "a",
+			Old:  VC.DocumentFromElements(EC.Int32("b", 1)),
+			New:  VC.ArrayFromValues(VC.Int32(1)),
+		}}, d1.Diff(d2))
+	})
+	t.Run("DuplicateKeys", func(t *testing.T) {
+		d1 := NewDocument(EC.Int32("a", 1), EC.Int32("a", 2))
+		d2 := NewDocument(EC.Int32("a", 1))
+		assert.True(t, d1.Equivalent(d2))
+	})
+	t.Run("ChangeTypeString", func(t *testing.T) {
+		assert.Equal(t, "added", ChangeAdded.String())
+		assert.Equal(t, "removed", ChangeRemoved.String())
+		assert.Equal(t, "modified", ChangeModified.String())
+		assert.Equal(t, "unknown", ChangeType(0).String())
+	})
+}
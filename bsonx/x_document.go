@@ -1,6 +1,7 @@
 package bsonx
 
 import (
+	"bytes"
 	"sort"
 
 	"github.com/mongodb/ftdc/bsonx/bsonerr"
@@ -36,20 +37,37 @@ func (d *Document) Sorted() *Document {
 	return DC.Elements(elems...)
 }
 
+// LookupElement returns the first element in the document with the
+// specified key, or nil if there is no such element. Lookups use the
+// document's index, and take logarithmic time in the number of
+// elements, or constant time for large documents with KeyIndex set.
 func (d *Document) LookupElement(key string) *Element {
-	iter := d.Iterator()
-	for iter.Next() {
-		elem := iter.Element()
-		elemKey, ok := elem.KeyOK()
-		if !ok {
-			continue
+	if d == nil {
+		panic(bsonerr.NilDocument)
+	}
+
+	if position, ok := d.lookupKeyIndex(key); ok {
+		if position < 0 {
+			return nil
 		}
-		if elemKey == key {
-			return elem
+		return d.elems[position]
+	}
+
+	target := []byte(key + "\x00")
+	i := sort.Search(len(d.index), func(i int) bool { return bytes.Compare(d.keyFromIndex(i), target) >= 0 })
+
+	// elements with the same key are adjacent in the index, but
+	// not in document order, so find the earliest.
+	var elem *Element
+	position := -1
+	for ; i < len(d.index) && bytes.Equal(d.keyFromIndex(i), target); i++ {
+		if position < 0 || int(d.index[i]) < position {
+			position = int(d.index[i])
+			elem = d.elems[position]
 		}
 	}
 
-	return nil
+	return elem
 }
 
 func (d *Document) Lookup(key string) *Value {
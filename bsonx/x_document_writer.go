@@ -0,0 +1,225 @@
+package bsonx
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/pkg/errors"
+)
+
+// DocumentWriter serializes a document to a writer as its elements
+// are appended, rather than building the document in memory, so that
+// writing a very large document (e.g. a large metadata document)
+// holds no more than one element, and a small buffer, in memory.
+//
+// BSON documents begin with their length, which the writer cannot
+// know until the document is complete, so the writer writes a
+// placeholder, and seeks back to patch the length of each document
+// when it is ended, which requires an io.WriteSeeker (e.g. an
+// *os.File.)
+//
+// The first error that the writer encounters is returned by every
+// later call.
+type DocumentWriter struct {
+	out    io.WriteSeeker
+	count  *countingWriter
+	buf    *bufio.Writer
+	s      documentStreamer
+	base   int64
+	frames []documentFrame
+	err    error
+}
+
+// documentFrame is an open document, or array, in a DocumentWriter.
+type documentFrame struct {
+	offset int64
+	array  bool
+	count  int
+}
+
+// NewDocumentWriter begins a document at the current position of the
+// writer. Call Close to complete the document.
+func NewDocumentWriter(w io.WriteSeeker) (*DocumentWriter, error) {
+	pos, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem finding the position of the writer")
+	}
+
+	dw := &DocumentWriter{
+		out:   w,
+		count: &countingWriter{w: w},
+		base:  pos,
+	}
+	dw.buf = bufio.NewWriterSize(dw.count, streamBufferSize)
+	dw.s = documentStreamer{w: dw.buf, scratch: make([]byte, 0, 32)}
+
+	if err = dw.begin(false); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return dw, nil
+}
+
+// Append writes the elements to the current document, or array, in
+// the order given. In arrays, the keys of the elements are replaced
+// with their indexes.
+func (w *DocumentWriter) Append(elems ...*Element) error {
+	if err := w.check(); err != nil {
+		return err
+	}
+
+	for _, elem := range elems {
+		if elem == nil || elem.value == nil || elem.value.data == nil {
+			return w.fail(bsonerr.UninitializedElement)
+		}
+
+		frame := &w.frames[len(w.frames)-1]
+		if frame.array {
+			if err := w.writeKey(elem.value.data[elem.value.start], ""); err != nil {
+				return w.fail(err)
+			}
+		}
+
+		if err := w.s.writeElement(elem, !frame.array); err != nil {
+			return w.fail(err)
+		}
+		frame.count++
+	}
+
+	return nil
+}
+
+// StartDocument begins an embedded document with the key in the
+// current document, to which later elements are appended, until the
+// matching call to End.
+func (w *DocumentWriter) StartDocument(key string) error { return w.start('\x03', key) }
+
+// StartArray begins an array with the key in the current document,
+// to which later elements are appended, until the matching call to
+// End.
+func (w *DocumentWriter) StartArray(key string) error { return w.start('\x04', key) }
+
+// End completes the embedded document, or array, begun by the last
+// call to StartDocument or StartArray.
+func (w *DocumentWriter) End() error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	if len(w.frames) == 1 {
+		return w.fail(errors.New("no embedded document or array to end"))
+	}
+
+	return w.end()
+}
+
+// Close completes any embedded documents and arrays that have not been
+// ended, and then the document. Close does not close the underlying
+// writer, and leaves its position at the end of the document.
+func (w *DocumentWriter) Close() error {
+	if err := w.check(); err != nil {
+		return err
+	}
+
+	for len(w.frames) > 0 {
+		if err := w.end(); err != nil {
+			return err
+		}
+	}
+
+	w.err = errors.New("document writer is closed")
+	return nil
+}
+
+func (w *DocumentWriter) check() error {
+	if w.err != nil {
+		return w.err
+	}
+	return nil
+}
+
+func (w *DocumentWriter) fail(err error) error {
+	w.err = errors.WithStack(err)
+	return w.err
+}
+
+// pos returns the position in the writer of the next byte written.
+func (w *DocumentWriter) pos() int64 { return w.base + w.count.n + int64(w.buf.Buffered()) }
+
+func (w *DocumentWriter) write(b []byte) error {
+	_, err := w.buf.Write(b)
+	return err
+}
+
+// writeKey writes the type and key of an element in the current
+// document, or the index of the element in the current array.
+func (w *DocumentWriter) writeKey(t byte, key string) error {
+	frame := w.frames[len(w.frames)-1]
+	if frame.array {
+		key = strconv.Itoa(frame.count)
+	} else if strings.IndexByte(key, 0) >= 0 {
+		return errors.Errorf("key '%s' contains a null byte", key)
+	}
+
+	header := append(append(append(w.s.scratch[:0], t), key...), 0)
+	w.s.scratch = header[:0]
+	return w.write(header)
+}
+
+func (w *DocumentWriter) start(t byte, key string) error {
+	if err := w.check(); err != nil {
+		return err
+	}
+
+	if err := w.writeKey(t, key); err != nil {
+		return w.fail(err)
+	}
+	w.frames[len(w.frames)-1].count++
+
+	if err := w.begin(t == '\x04'); err != nil {
+		return w.fail(err)
+	}
+	return nil
+}
+
+// begin writes the placeholder for the length of a document, and
+// makes the document the current document.
+func (w *DocumentWriter) begin(array bool) error {
+	w.frames = append(w.frames, documentFrame{offset: w.pos(), array: array})
+	return w.write([]byte{0, 0, 0, 0})
+}
+
+// end terminates the current document, and patches its length.
+func (w *DocumentWriter) end() error {
+	frame := w.frames[len(w.frames)-1]
+	w.frames = w.frames[:len(w.frames)-1]
+
+	if err := w.write([]byte{0}); err != nil {
+		return w.fail(err)
+	}
+
+	end := w.pos()
+	size := end - frame.offset
+	if size > math.MaxInt32 {
+		return w.fail(errors.Errorf("document of %d bytes is too large", size))
+	}
+
+	if err := w.buf.Flush(); err != nil {
+		return w.fail(err)
+	}
+	if _, err := w.out.Seek(frame.offset, io.SeekStart); err != nil {
+		return w.fail(err)
+	}
+	header := []byte{byte(size), byte(size >> 8), byte(size >> 16), byte(size >> 24)}
+	if _, err := w.out.Write(header); err != nil {
+		return w.fail(err)
+	}
+	if _, err := w.out.Seek(end, io.SeekStart); err != nil {
+		return w.fail(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package bsonx
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentWriter(t *testing.T) {
+	large := strings.Repeat("x", 3*streamBufferSize)
+	expected := NewDocument(
+		EC.String("host", "example"),
+		EC.SubDocumentFromElements("params",
+			EC.Int32("a", 1),
+			EC.String("large", large),
+			EC.ArrayFromElements("list", VC.Int64(1), VC.String("two"), VC.DocumentFromElements(EC.Boolean("three", true))),
+		),
+		EC.ArrayFromElements("empty"),
+		EC.Double("last", 1.5),
+	)
+	expectedBytes, err := expected.MarshalBSON()
+	require.NoError(t, err)
+
+	newFile := func(t *testing.T) *os.File {
+		file, err := ioutil.TempFile("", "bsonx-writer-")
+		require.NoError(t, err)
+		return file
+	}
+	readBack := func(t *testing.T, file *os.File, offset int64) []byte {
+		_, err := file.Seek(offset, io.SeekStart)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(file)
+		require.NoError(t, err)
+		return data
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		file := newFile(t)
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		// the document begins at the current position of the
+		// writer.
+		_, err := file.Write([]byte("prefix"))
+		require.NoError(t, err)
+
+		w, err := NewDocumentWriter(file)
+		require.NoError(t, err)
+		require.NoError(t, w.Append(EC.String("host", "example")))
+		require.NoError(t, w.StartDocument("params"))
+		require.NoError(t, w.Append(EC.Int32("a", 1), EC.String("large", large)))
+		require.NoError(t, w.StartArray("list"))
+		require.NoError(t, w.Append(EC.Int64("ignored", 1), EC.String("keys", "two")))
+		require.NoError(t, w.StartDocument("ignored"))
+		require.NoError(t, w.Append(EC.Boolean("three", true)))
+		require.NoError(t, w.End())
+		require.NoError(t, w.End())
+		require.NoError(t, w.End())
+		require.NoError(t, w.StartArray("empty"))
+		require.NoError(t, w.End())
+		require.NoError(t, w.Append(EC.Double("last", 1.5)))
+		require.NoError(t, w.Close())
+		assert.Error(t, w.Append(EC.Int32("after", 1)))
+
+		data := readBack(t, file, 6)
+		assert.Equal(t, expectedBytes, data)
+
+		doc, err := ReadDocument(data)
+		require.NoError(t, err)
+		assert.True(t, expected.Equal(doc))
+	})
+	t.Run("CloseEndsOpenDocuments", func(t *testing.T) {
+		file := newFile(t)
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		w, err := NewDocumentWriter(file)
+		require.NoError(t, err)
+		require.NoError(t, w.StartDocument("a"))
+		require.NoError(t, w.StartArray("b"))
+		require.NoError(t, w.Append(EC.Int32("", 1)))
+		require.NoError(t, w.Close())
+
+		doc, err := ReadDocument(readBack(t, file, 0))
+		require.NoError(t, err)
+		assert.True(t, NewDocument(EC.SubDocumentFromElements("a", EC.ArrayFromElements("b", VC.Int32(1)))).Equal(doc))
+	})
+	t.Run("Errors", func(t *testing.T) {
+		file := newFile(t)
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		w, err := NewDocumentWriter(file)
+		require.NoError(t, err)
+		assert.Error(t, w.End(), "cannot end the root document")
+		assert.Error(t, w.Close(), "errors are sticky")
+
+		w, err = NewDocumentWriter(file)
+		require.NoError(t, err)
+		assert.Error(t, w.StartDocument("bad\x00key"))
+
+		w, err = NewDocumentWriter(file)
+		require.NoError(t, err)
+		assert.Error(t, w.Append(&Element{}))
+	})
+}
@@ -1,3 +1,16 @@
 package bsonx
 
+import "github.com/mongodb/ftdc/bsonx/bsonerr"
+
 func (e *Element) SetValue(v *Value) { e.value = v }
+
+// AppendKey appends the key of the element to dst, and returns the
+// extended buffer, without allocating a string for the key. It panics
+// if the element is uninitialized.
+func (e *Element) AppendKey(dst []byte) []byte {
+	if e == nil || e.value == nil || e.value.offset == 0 || e.value.data == nil {
+		panic(bsonerr.UninitializedElement)
+	}
+
+	return append(dst, e.value.data[e.value.start+1:e.value.offset-1]...)
+}
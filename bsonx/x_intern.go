@@ -0,0 +1,84 @@
+package bsonx
+
+import (
+	"io"
+	"sync"
+)
+
+// KeyInterner is a table of element keys, used while parsing
+// documents so that identical keys across many documents share a
+// single string allocation. A KeyInterner is intended to be scoped to
+// a decoding session (e.g. reading a single FTDC file) and retains
+// every distinct key it has seen until it is discarded or Reset.
+//
+// KeyInterners are safe for concurrent use.
+type KeyInterner struct {
+	mu   sync.RWMutex
+	keys map[string]string
+}
+
+// NewKeyInterner constructs an empty KeyInterner.
+func NewKeyInterner() *KeyInterner {
+	return &KeyInterner{keys: map[string]string{}}
+}
+
+// Intern returns the canonical string for the key, adding it to the
+// table if it has not been seen before.
+func (ki *KeyInterner) Intern(key []byte) string {
+	ki.mu.RLock()
+	str, ok := ki.keys[string(key)]
+	ki.mu.RUnlock()
+	if ok {
+		return str
+	}
+
+	ki.mu.Lock()
+	defer ki.mu.Unlock()
+
+	if str, ok = ki.keys[string(key)]; ok {
+		return str
+	}
+
+	str = string(key)
+	ki.keys[str] = str
+
+	return str
+}
+
+// Len returns the number of distinct keys in the table.
+func (ki *KeyInterner) Len() int {
+	ki.mu.RLock()
+	defer ki.mu.RUnlock()
+
+	return len(ki.keys)
+}
+
+// Reset removes all keys from the table. Documents parsed before the
+// table was reset are not affected.
+func (ki *KeyInterner) Reset() {
+	ki.mu.Lock()
+	defer ki.mu.Unlock()
+
+	ki.keys = map[string]string{}
+}
+
+// ReadDocumentInterned is the same as ReadDocument, except that the
+// keys of the document, and of any documents or arrays nested within
+// it, are interned in the provided table. If the interner is nil,
+// keys are not interned.
+func ReadDocumentInterned(b []byte, interner *KeyInterner) (*Document, error) {
+	doc := new(Document)
+	if err := doc.unmarshalBSON(b, interner); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// ReadFromInterned is the same as ReadFrom, except that the keys of
+// the document, and of any documents or arrays nested within it, are
+// interned in the provided table. If the interner is nil, keys are
+// not interned.
+func (d *Document) ReadFromInterned(r io.Reader, interner *KeyInterner) (int64, error) {
+	return d.readFrom(r, interner)
+}
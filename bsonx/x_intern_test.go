@@ -0,0 +1,113 @@
+package bsonx
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stringData(s string) uintptr {
+	return (*(*[2]uintptr)(unsafe.Pointer(&s)))[0]
+}
+
+func TestKeyInterner(t *testing.T) {
+	makeDoc := func(n int64) *Document {
+		return NewDocument(
+			EC.Int64("counter", n),
+			EC.SubDocument("nested", NewDocument(
+				EC.String("name", "value"),
+				EC.Array("list", NewArray(VC.Document(NewDocument(EC.Int32("inner", 1))))),
+			)),
+		)
+	}
+
+	t.Run("Intern", func(t *testing.T) {
+		ki := NewKeyInterner()
+		a := ki.Intern([]byte("key"))
+		b := ki.Intern([]byte("key"))
+		assert.Equal(t, "key", a)
+		assert.Equal(t, stringData(a), stringData(b))
+		assert.Equal(t, 1, ki.Len())
+
+		assert.Equal(t, "", ki.Intern([]byte{}))
+		assert.Equal(t, 2, ki.Len())
+
+		ki.Reset()
+		assert.Equal(t, 0, ki.Len())
+		assert.NotEqual(t, stringData(a), stringData(ki.Intern([]byte("key"))))
+	})
+	t.Run("SharedAcrossDocuments", func(t *testing.T) {
+		ki := NewKeyInterner()
+
+		docs := []*Document{}
+		for i := int64(0); i < 3; i++ {
+			raw, err := makeDoc(i).MarshalBSON()
+			require.NoError(t, err)
+			doc, err := ReadDocumentInterned(raw, ki)
+			require.NoError(t, err)
+			docs = append(docs, doc)
+		}
+
+		first := docs[0].ElementAt(0).Key()
+		firstNested := docs[0].Lookup("nested").MutableDocument().ElementAt(1).Key()
+		for idx, doc := range docs {
+			assert.True(t, makeDoc(int64(idx)).Equal(doc))
+
+			assert.Equal(t, stringData(first), stringData(doc.ElementAt(0).Key()))
+
+			nested := doc.Lookup("nested").MutableDocument()
+			assert.Equal(t, "list", nested.ElementAt(1).Key())
+			assert.Equal(t, stringData(firstNested), stringData(nested.ElementAt(1).Key()))
+
+			inner, err := nested.LookupErr("list")
+			require.NoError(t, err)
+			elem := inner.MutableArray().doc.ElementAt(0).Value().MutableDocument().ElementAt(0)
+			assert.Equal(t, "inner", elem.Key())
+			assert.Equal(t, "inner", elem.Clone().Key())
+		}
+
+		assert.Equal(t, 6, ki.Len())
+	})
+	t.Run("ReadFrom", func(t *testing.T) {
+		ki := NewKeyInterner()
+		raw, err := makeDoc(42).MarshalBSON()
+		require.NoError(t, err)
+
+		doc := &Document{}
+		n, err := doc.ReadFromInterned(bytes.NewReader(raw), ki)
+		require.NoError(t, err)
+		assert.EqualValues(t, len(raw), n)
+		assert.True(t, makeDoc(42).Equal(doc))
+		assert.Equal(t, 2, ki.Len())
+
+		out, err := doc.MarshalBSON()
+		require.NoError(t, err)
+		assert.Equal(t, raw, out)
+	})
+	t.Run("NilInterner", func(t *testing.T) {
+		raw, err := makeDoc(1).MarshalBSON()
+		require.NoError(t, err)
+		doc, err := ReadDocumentInterned(raw, nil)
+		require.NoError(t, err)
+		assert.True(t, makeDoc(1).Equal(doc))
+	})
+	t.Run("Concurrent", func(t *testing.T) {
+		ki := NewKeyInterner()
+		wg := &sync.WaitGroup{}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, key := range []string{"a", "b", "c", "a"} {
+					assert.Equal(t, key, ki.Intern([]byte(key)))
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 3, ki.Len())
+	})
+}
@@ -1 +1,345 @@
 package bsonx
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MarshalExtJSON renders the document as MongoDB Extended JSON (v2),
+// using the canonical format, which preserves the type of every
+// value, when canonical is true, and the relaxed format, which renders
+// numbers and dates as native JSON values where possible, otherwise.
+func (d *Document) MarshalExtJSON(canonical bool) ([]byte, error) {
+	if d == nil {
+		return nil, bsonerr.NilDocument
+	}
+
+	data, err := d.MarshalBSON()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out, err := bson.MarshalExtJSON(bson.Raw(data), canonical, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem rendering extended json")
+	}
+
+	return out, nil
+}
+
+// UnmarshalExtJSON replaces the contents of the document with the
+// document in the MongoDB Extended JSON (v2) data. When canonical is
+// true, the data must be in the canonical format; otherwise, it may be
+// in either the canonical or the relaxed format.
+func (d *Document) UnmarshalExtJSON(data []byte, canonical bool) error {
+	if d == nil {
+		return bsonerr.NilDocument
+	}
+
+	var raw bson.Raw
+	if err := bson.UnmarshalExtJSON(data, canonical, &raw); err != nil {
+		return errors.Wrap(err, "problem parsing extended json")
+	}
+
+	d.Reset()
+
+	return errors.WithStack(d.UnmarshalBSON(raw))
+}
+
+// ToJSONRaw renders the document as plain JSON, for consumers that do
+// not understand Extended JSON. Integers are rendered as integer
+// literals, which preserves int64 values that a float64 cannot
+// represent exactly (those above 2^53), and doubles are always
+// rendered with a fractional part or exponent (e.g. 1.0), so that
+// FromJSONRaw can tell the two apart. Values that have no native JSON
+// representation (e.g. dates, object ids, and non-finite doubles) are
+// rendered as relaxed Extended JSON.
+func (d *Document) ToJSONRaw() (json.RawMessage, error) {
+	if d == nil {
+		return nil, bsonerr.NilDocument
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeRawDocument(buf, d); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return json.RawMessage(buf.Bytes()), nil
+}
+
+// FromJSONRaw replaces the contents of the document with the JSON
+// object in the data, as rendered by ToJSONRaw. Integer literals
+// become int64 values, and fail to parse if they do not fit in an
+// int64, and other numbers become doubles. Objects whose first key
+// begins with "$" are read as relaxed Extended JSON values.
+func (d *Document) FromJSONRaw(data json.RawMessage) error {
+	if d == nil {
+		return bsonerr.NilDocument
+	}
+
+	doc, err := readRawDocument(data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	d.Reset()
+	d.Append(doc.elems...)
+
+	return nil
+}
+
+func writeRawDocument(buf *bytes.Buffer, d *Document) error {
+	_ = buf.WriteByte('{')
+	iter := d.Iterator()
+	for idx := 0; iter.Next(); idx++ {
+		elem := iter.Element()
+		if idx > 0 {
+			_ = buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(elem.Key())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, _ = buf.Write(key)
+		_ = buf.WriteByte(':')
+
+		if err = writeRawValue(buf, elem.Value()); err != nil {
+			return errors.Wrapf(err, "problem rendering '%s'", elem.Key())
+		}
+	}
+	_ = buf.WriteByte('}')
+
+	return errors.WithStack(iter.Err())
+}
+
+func writeRawValue(buf *bytes.Buffer, v *Value) error {
+	switch v.Type() {
+	case bsontype.Int32:
+		_, _ = buf.WriteString(strconv.FormatInt(int64(v.Int32()), 10))
+	case bsontype.Int64:
+		_, _ = buf.WriteString(strconv.FormatInt(v.Int64(), 10))
+	case bsontype.Double:
+		f := v.Double()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return errors.WithStack(writeExtJSONValue(buf, v))
+		}
+		out := strconv.FormatFloat(f, 'g', -1, 64)
+		_, _ = buf.WriteString(out)
+		if !strings.ContainsAny(out, ".eE") {
+			_, _ = buf.WriteString(".0")
+		}
+	case bsontype.String:
+		out, err := json.Marshal(v.StringValue())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, _ = buf.Write(out)
+	case bsontype.Boolean:
+		_, _ = buf.WriteString(strconv.FormatBool(v.Boolean()))
+	case bsontype.Null:
+		_, _ = buf.WriteString("null")
+	case bsontype.EmbeddedDocument:
+		return errors.WithStack(writeRawDocument(buf, v.MutableDocument()))
+	case bsontype.Array:
+		_ = buf.WriteByte('[')
+		iter := v.MutableArray().Iterator()
+		for idx := 0; iter.Next(); idx++ {
+			if idx > 0 {
+				_ = buf.WriteByte(',')
+			}
+			if err := writeRawValue(buf, iter.Value()); err != nil {
+				return errors.Wrapf(err, "problem rendering array element %d", idx)
+			}
+		}
+		_ = buf.WriteByte(']')
+		return errors.WithStack(iter.Err())
+	default:
+		return errors.WithStack(writeExtJSONValue(buf, v))
+	}
+
+	return nil
+}
+
+// extJSONValueKey is the key of the documents used to convert single
+// values to and from Extended JSON.
+const extJSONValueKey = "v"
+
+func writeExtJSONValue(buf *bytes.Buffer, v *Value) error {
+	out, err := NewDocument(EC.FromValue(extJSONValueKey, v)).MarshalExtJSON(false)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var wrapper map[string]json.RawMessage
+	if err = json.Unmarshal(out, &wrapper); err != nil {
+		return errors.WithStack(err)
+	}
+	_, _ = buf.Write(wrapper[extJSONValueKey])
+
+	return nil
+}
+
+func newRawDecoder(data []byte) *json.Decoder {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return errors.Wrap(err, "problem parsing json")
+	}
+	if tok != delim {
+		return errors.Errorf("expected '%s', found '%v'", delim, tok)
+	}
+	return nil
+}
+
+func readRawDocument(data []byte) (*Document, error) {
+	dec := newRawDecoder(data)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out := NewDocument()
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "problem parsing json")
+		}
+		key := tok.(string)
+
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			return nil, errors.Wrapf(err, "problem parsing '%s'", key)
+		}
+		value, err := readRawValue(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem parsing '%s'", key)
+		}
+		out.Append(EC.FromValue(key, value))
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after document")
+	}
+
+	return out, nil
+}
+
+func readRawArray(data []byte) (*Array, error) {
+	dec := newRawDecoder(data)
+	if err := expectDelim(dec, '['); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out := NewArray()
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, errors.Wrapf(err, "problem parsing array element %d", out.Len())
+		}
+		value, err := readRawValue(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem parsing array element %d", out.Len())
+		}
+		out.Append(value)
+	}
+
+	return out, errors.WithStack(expectDelim(dec, ']'))
+}
+
+func readRawValue(data json.RawMessage) (*Value, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("empty json value")
+	}
+
+	switch data[0] {
+	case '{':
+		if isExtJSONValue(data) {
+			return readExtJSONValue(data)
+		}
+		doc, err := readRawDocument(data)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return VC.Document(doc), nil
+	case '[':
+		arr, err := readRawArray(data)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return VC.Array(arr), nil
+	}
+
+	tok, err := newRawDecoder(data).Token()
+	if err != nil {
+		return nil, errors.Wrap(err, "problem parsing json")
+	}
+
+	switch v := tok.(type) {
+	case nil:
+		return VC.Null(), nil
+	case bool:
+		return VC.Boolean(v), nil
+	case string:
+		return VC.String(v), nil
+	case json.Number:
+		if !strings.ContainsAny(v.String(), ".eE") {
+			i, err := v.Int64()
+			if err != nil {
+				return nil, errors.Wrapf(err, "integer '%s' does not fit in an int64", v)
+			}
+			return VC.Int64(i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid double '%s'", v)
+		}
+		return VC.Double(f), nil
+	default:
+		return nil, errors.Errorf("unexpected json token '%v'", tok)
+	}
+}
+
+// isExtJSONValue reports whether the first key of the object begins
+// with "$".
+func isExtJSONValue(data []byte) bool {
+	dec := newRawDecoder(data)
+	if _, err := dec.Token(); err != nil {
+		return false
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return false
+	}
+	key, ok := tok.(string)
+	return ok && strings.HasPrefix(key, "$")
+}
+
+func readExtJSONValue(data []byte) (*Value, error) {
+	wrapper := make([]byte, 0, len(data)+8)
+	wrapper = append(wrapper, `{"`+extJSONValueKey+`":`...)
+	wrapper = append(wrapper, data...)
+	wrapper = append(wrapper, '}')
+
+	doc := NewDocument()
+	if err := doc.UnmarshalExtJSON(wrapper, false); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return doc.Lookup(extJSONValueKey), nil
+}
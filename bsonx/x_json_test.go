@@ -0,0 +1,160 @@
+package bsonx
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/mongodb/ftdc/bsonx/decimal"
+	"github.com/mongodb/ftdc/bsonx/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtJSON(t *testing.T) {
+	dec, err := decimal.ParseDecimal128("1.5")
+	require.NoError(t, err)
+
+	doc := NewDocument(
+		EC.Int32("int32", 42),
+		EC.Int64("int64", 1<<40),
+		EC.Double("double", 2.5),
+		EC.String("string", "value"),
+		EC.Boolean("bool", true),
+		EC.Null("null"),
+		EC.Time("time", time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)),
+		EC.ObjectID("oid", types.NewObjectID()),
+		EC.Binary("binary", []byte{1, 2, 3}),
+		EC.Regex("regex", "^a", "i"),
+		EC.Timestamp("timestamp", 10, 1),
+		EC.Decimal128("decimal", dec),
+		EC.SubDocument("nested", NewDocument(EC.Int64("a", 1))),
+		EC.Array("array", NewArray(VC.Int32(1), VC.String("two"))),
+	)
+
+	for name, canonical := range map[string]bool{"Canonical": true, "Relaxed": false} {
+		t.Run(name, func(t *testing.T) {
+			out, err := doc.MarshalExtJSON(canonical)
+			require.NoError(t, err)
+
+			if canonical {
+				assert.Contains(t, string(out), `"int32":{"$numberInt":"42"}`)
+				assert.Contains(t, string(out), `"time":{"$date":{"$numberLong":"1527811200000"}}`)
+			} else {
+				assert.Contains(t, string(out), `"int32":42`)
+				assert.Contains(t, string(out), `"time":{"$date":"2018-06-01T00:00:00Z"}`)
+			}
+
+			// the document is replaced rather than appended to.
+			parsed := NewDocument(EC.Int32("existing", 1))
+			require.NoError(t, parsed.UnmarshalExtJSON(out, canonical))
+			assert.Nil(t, parsed.LookupElement("existing"))
+			assert.Equal(t, doc.Len(), parsed.Len())
+
+			if canonical {
+				assert.True(t, doc.Equal(parsed))
+			} else {
+				// relaxed json doesn't preserve the widths of
+				// integers that fit in an int32.
+				assert.EqualValues(t, 42, parsed.Lookup("int32").Interface())
+				assert.Equal(t, doc.Lookup("string").StringValue(), parsed.Lookup("string").StringValue())
+				assert.EqualValues(t, 1, parsed.Lookup("nested").MutableDocument().Lookup("a").Interface())
+			}
+		})
+	}
+	t.Run("Nil", func(t *testing.T) {
+		var doc *Document
+		_, err := doc.MarshalExtJSON(true)
+		assert.Error(t, err)
+		assert.Error(t, doc.UnmarshalExtJSON([]byte("{}"), true))
+	})
+	t.Run("InvalidJSON", func(t *testing.T) {
+		doc := NewDocument()
+		assert.Error(t, doc.UnmarshalExtJSON([]byte(`{"a":`), false))
+		assert.Error(t, doc.UnmarshalExtJSON([]byte(`[1, 2]`), false))
+	})
+}
+
+func TestJSONRaw(t *testing.T) {
+	doc := NewDocument(
+		EC.Int32("int32", 42),
+		EC.Int64("large", 1<<53+1),
+		EC.Int64("max", math.MaxInt64),
+		EC.Double("whole", 2),
+		EC.Double("fraction", 0.001),
+		EC.Double("nan", math.NaN()),
+		EC.String("string", "value"),
+		EC.Boolean("bool", true),
+		EC.Null("null"),
+		EC.Time("time", time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)),
+		EC.SubDocument("nested", NewDocument(EC.Int64("a", math.MinInt64))),
+		EC.Array("array", NewArray(VC.Int32(1), VC.Double(1), VC.String("two"))),
+	)
+
+	out, err := doc.ToJSONRaw()
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `"large":9007199254740993`)
+	assert.Contains(t, string(out), `"max":9223372036854775807`)
+	assert.Contains(t, string(out), `"whole":2.0`)
+	assert.Contains(t, string(out), `"fraction":0.001`)
+	assert.Contains(t, string(out), `"nan":{"$numberDouble":"NaN"}`)
+	assert.Contains(t, string(out), `"time":{"$date":"2018-06-01T00:00:00Z"}`)
+	assert.Contains(t, string(out), `"array":[1,1.0,"two"]`)
+
+	// the output is valid json.
+	var generic map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &generic))
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		parsed := NewDocument(EC.Int32("existing", 1))
+		require.NoError(t, parsed.FromJSONRaw(out))
+		assert.Nil(t, parsed.LookupElement("existing"))
+		require.Equal(t, doc.Len(), parsed.Len())
+
+		// integers are read as int64 values.
+		assert.Equal(t, bsontype.Int64, parsed.Lookup("int32").Type())
+		assert.Equal(t, int64(42), parsed.Lookup("int32").Int64())
+		assert.Equal(t, int64(1<<53+1), parsed.Lookup("large").Int64())
+		assert.Equal(t, int64(math.MaxInt64), parsed.Lookup("max").Int64())
+		assert.Equal(t, int64(math.MinInt64), parsed.Lookup("nested").MutableDocument().Lookup("a").Int64())
+		assert.Equal(t, bsontype.Double, parsed.Lookup("whole").Type())
+		assert.Equal(t, 2.0, parsed.Lookup("whole").Double())
+		assert.Equal(t, 0.001, parsed.Lookup("fraction").Double())
+		assert.True(t, math.IsNaN(parsed.Lookup("nan").Double()))
+		assert.Equal(t, "value", parsed.Lookup("string").StringValue())
+		assert.True(t, parsed.Lookup("bool").Boolean())
+		assert.Equal(t, bsontype.Null, parsed.Lookup("null").Type())
+		assert.True(t, doc.Lookup("time").Equal(parsed.Lookup("time")))
+
+		arr := parsed.Lookup("array").MutableArray()
+		require.Equal(t, 3, arr.Len())
+		assert.Equal(t, bsontype.Double, arr.Lookup(1).Type())
+
+		// the order of the keys is preserved.
+		again, err := parsed.ToJSONRaw()
+		require.NoError(t, err)
+		assert.Equal(t, string(out), string(again))
+	})
+	t.Run("Nil", func(t *testing.T) {
+		var doc *Document
+		_, err := doc.ToJSONRaw()
+		assert.Error(t, err)
+		assert.Error(t, doc.FromJSONRaw([]byte("{}")))
+	})
+	t.Run("InvalidJSON", func(t *testing.T) {
+		doc := NewDocument(EC.Int32("existing", 1))
+		for _, data := range []string{
+			`{"a":`,
+			`[1, 2]`,
+			`{"a": 1} {}`,
+			`{"a": 18446744073709551615}`,
+			`{"a": [1, }`,
+		} {
+			assert.Error(t, doc.FromJSONRaw([]byte(data)), data)
+		}
+		// the document is unchanged when parsing fails.
+		assert.Equal(t, 1, doc.Len())
+	})
+}
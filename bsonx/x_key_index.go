@@ -0,0 +1,51 @@
+package bsonx
+
+// keyIndex maps the keys of a document to the position of the first
+// element with each key. Key indexes are not modified once they're
+// built, so documents share them with their copies and clones.
+type keyIndex map[string]int
+
+// KeyIndexThreshold is the number of elements above which the
+// lookups of documents with KeyIndex set use a key index. Scanning
+// the sorted index is faster for smaller documents.
+const KeyIndexThreshold = 16
+
+// lookupKeyIndex returns the position of the first element with the
+// key, using the document's key index, which it builds if the
+// document was modified since the last lookup. The second value is
+// false if the document does not use a key index.
+func (d *Document) lookupKeyIndex(key string) (int, bool) {
+	if !d.KeyIndex || len(d.elems) <= KeyIndexThreshold {
+		return 0, false
+	}
+
+	keys, _ := d.keys.Load().(keyIndex)
+	if keys == nil {
+		keys = make(keyIndex, len(d.elems))
+		for idx, elem := range d.elems {
+			key := elem.Key()
+			if _, ok := keys[key]; !ok {
+				keys[key] = idx
+			}
+		}
+
+		// concurrent lookups may build the index more than
+		// once, but the indexes are equivalent.
+		d.keys.Store(keys)
+	}
+
+	position, ok := keys[key]
+	if !ok {
+		return -1, true
+	}
+	return position, true
+}
+
+// resetKeyIndex discards the document's key index, if any, so that
+// the next lookup rebuilds it. Methods that modify the elements of
+// the document must call resetKeyIndex, which own does.
+func (d *Document) resetKeyIndex() {
+	if keys, _ := d.keys.Load().(keyIndex); keys != nil {
+		d.keys.Store(keyIndex(nil))
+	}
+}
@@ -0,0 +1,138 @@
+package bsonx
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentKeyIndex(t *testing.T) {
+	base := func() *Document {
+		doc := NewDocument()
+		for i := 0; i < 4*KeyIndexThreshold; i++ {
+			doc.Append(EC.Int32(fmt.Sprintf("key%d", i), int32(i)))
+		}
+		doc.KeyIndex = true
+		return doc
+	}
+
+	t.Run("Lookup", func(t *testing.T) {
+		doc := base()
+		assert.Nil(t, doc.keys.Load())
+		for i := 0; i < doc.Len(); i++ {
+			assert.EqualValues(t, i, doc.Lookup(fmt.Sprintf("key%d", i)).Int32())
+		}
+		assert.NotNil(t, doc.keys.Load())
+		assert.Nil(t, doc.Lookup("missing"))
+		assert.Nil(t, doc.LookupElement("key"))
+
+		_, err := doc.LookupErr("missing")
+		assert.Error(t, err)
+	})
+	t.Run("Duplicates", func(t *testing.T) {
+		doc := base()
+		doc.Append(EC.String("key3", "later"))
+		assert.EqualValues(t, 3, doc.Lookup("key3").Int32())
+
+		doc.Prepend(EC.String("key3", "earlier"))
+		assert.Equal(t, "earlier", doc.Lookup("key3").StringValue())
+	})
+	t.Run("SmallDocuments", func(t *testing.T) {
+		doc := NewDocument(EC.Int32("a", 1), EC.Int32("b", 2))
+		doc.KeyIndex = true
+		assert.EqualValues(t, 2, doc.Lookup("b").Int32())
+		assert.Nil(t, doc.keys.Load(), "small documents are not indexed")
+	})
+	for name, test := range map[string]func(*Document) func(*testing.T){
+		"Append": func(d *Document) func(*testing.T) {
+			d.Append(EC.Int32("new", 1))
+			return func(t *testing.T) { assert.EqualValues(t, 1, d.Lookup("new").Int32()) }
+		},
+		"Prepend": func(d *Document) func(*testing.T) {
+			d.Prepend(EC.Int32("new", 1))
+			return func(t *testing.T) {
+				assert.EqualValues(t, 1, d.Lookup("new").Int32())
+				assert.EqualValues(t, 5, d.Lookup("key5").Int32())
+			}
+		},
+		"Set": func(d *Document) func(*testing.T) {
+			d.Set(EC.String("key5", "replaced"))
+			return func(t *testing.T) { assert.Equal(t, "replaced", d.Lookup("key5").StringValue()) }
+		},
+		"Delete": func(d *Document) func(*testing.T) {
+			d.Delete("key2")
+			return func(t *testing.T) {
+				assert.Nil(t, d.Lookup("key2"))
+				assert.EqualValues(t, 5, d.Lookup("key5").Int32())
+			}
+		},
+		"Reset": func(d *Document) func(*testing.T) {
+			d.Reset()
+			return func(t *testing.T) { assert.Nil(t, d.Lookup("key5")) }
+		},
+		"Unmarshal": func(d *Document) func(*testing.T) {
+			data, err := base().MarshalBSON()
+			require.NoError(t, err)
+			d.Reset()
+			require.NoError(t, d.UnmarshalBSON(data))
+			return func(t *testing.T) { assert.EqualValues(t, 5, d.Lookup("key5").Int32()) }
+		},
+	} {
+		t.Run("Invalidate"+name, func(t *testing.T) {
+			doc := base()
+			require.NotNil(t, doc.Lookup("key5"))
+			require.NotNil(t, doc.keys.Load())
+
+			test(doc)(t)
+		})
+	}
+	t.Run("CopiesAndClones", func(t *testing.T) {
+		doc := base()
+		require.NotNil(t, doc.Lookup("key1"))
+
+		for _, other := range []*Document{doc.Copy(), doc.Clone()} {
+			assert.True(t, other.KeyIndex)
+			other.Delete("key1")
+			assert.Nil(t, other.Lookup("key1"))
+			assert.EqualValues(t, 2, other.Lookup("key2").Int32())
+		}
+
+		assert.EqualValues(t, 1, doc.Lookup("key1").Int32())
+		assert.EqualValues(t, 2, doc.Lookup("key2").Int32())
+	})
+	t.Run("ConcurrentLookups", func(t *testing.T) {
+		doc := base()
+		wg := &sync.WaitGroup{}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < doc.Len(); j++ {
+					assert.EqualValues(t, j, doc.Lookup(fmt.Sprintf("key%d", j)).Int32())
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+func BenchmarkDocumentLookup(b *testing.B) {
+	doc := NewDocument()
+	keys := make([]string, 500)
+	for idx := range keys {
+		keys[idx] = fmt.Sprintf("metric%03d", idx)
+		doc.Append(EC.Int64(keys[idx], int64(idx)))
+	}
+
+	for _, indexed := range []bool{false, true} {
+		doc.KeyIndex = indexed
+		b.Run(fmt.Sprintf("KeyIndex=%t", indexed), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = doc.Lookup(keys[i%len(keys)])
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package bsonx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeLargeDocument(size int, shuffle bool) *Document {
+	keys := make([]int, size)
+	for idx := range keys {
+		keys[idx] = idx
+	}
+	if shuffle {
+		rand.New(rand.NewSource(int64(size))).Shuffle(size, func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	}
+
+	doc := DC.Make(size)
+	for _, key := range keys {
+		doc.Append(EC.Int64(fmt.Sprintf("metric.%07d", key), int64(key)))
+	}
+	return doc
+}
+
+func TestDocumentLimits(t *testing.T) {
+	t.Run("Index", func(t *testing.T) {
+		doc := makeLargeDocument(20000, true)
+		data, err := doc.MarshalBSON()
+		require.NoError(t, err)
+
+		read, err := ReadDocument(data)
+		require.NoError(t, err)
+		assert.True(t, doc.Equal(read))
+		for _, key := range []int{0, 1, 9999, 19999} {
+			assert.EqualValues(t, key, read.Lookup(fmt.Sprintf("metric.%07d", key)).Int64())
+		}
+	})
+	t.Run("DuplicateKeys", func(t *testing.T) {
+		doc := NewDocument(EC.Int32("b", 1), EC.Int32("a", 2), EC.Int32("b", 3), EC.Int32("a", 4))
+		data, err := doc.MarshalBSON()
+		require.NoError(t, err)
+
+		read, err := ReadDocument(data)
+		require.NoError(t, err)
+		assert.True(t, doc.Equal(read))
+		assert.Equal(t, int32(2), doc.Lookup("a").Int32())
+		assert.Equal(t, int32(2), read.Lookup("a").Int32())
+		assert.Equal(t, int32(1), read.Lookup("b").Int32())
+	})
+	t.Run("ArrayDelete", func(t *testing.T) {
+		array := NewArray(VC.Int32(1), VC.Int32(2), VC.Int32(3))
+		require.NotNil(t, array.Delete(0))
+		require.NotNil(t, array.Delete(1))
+		array.Append(VC.Int32(4), VC.Int32(5))
+		array.Prepend(VC.Int32(0))
+
+		require.Equal(t, 4, array.Len())
+		for idx, expected := range []int32{0, 2, 4, 5} {
+			assert.Equal(t, expected, array.Lookup(uint(idx)).Int32())
+		}
+		_, err := array.Validate()
+		assert.NoError(t, err)
+	})
+	t.Run("ManyElements", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("skipping large document test in short mode")
+		}
+
+		size := 300000
+		doc := makeLargeDocument(size, false)
+		data, err := doc.MarshalBSON()
+		require.NoError(t, err)
+
+		read, err := ReadDocument(data)
+		require.NoError(t, err)
+		require.Equal(t, size, read.Len())
+		assert.EqualValues(t, size-1, read.Lookup(fmt.Sprintf("metric.%07d", size-1)).Int64())
+		assert.EqualValues(t, size-1, read.ElementAt(uint(size-1)).Value().Int64())
+
+		elem := read.Delete(fmt.Sprintf("metric.%07d", 0))
+		require.NotNil(t, elem)
+		assert.Equal(t, size-1, read.Len())
+		assert.EqualValues(t, 1, read.ElementAt(0).Value().Int64())
+		assert.EqualValues(t, size-1, read.Lookup(fmt.Sprintf("metric.%07d", size-1)).Int64())
+	})
+	t.Run("TooLarge", func(t *testing.T) {
+		// the same 1MB subdocument is referenced many times,
+		// so the encoded size exceeds the maximum without
+		// allocating the encoded document.
+		sub := NewDocument(EC.Binary("data", make([]byte, 1<<20)))
+		doc := NewDocument()
+		array := NewArray()
+		for i := 0; i < MaxDocumentSize>>20+1; i++ {
+			doc.Append(EC.SubDocument(fmt.Sprint(i), sub))
+			array.Append(VC.Document(sub))
+		}
+
+		_, err := doc.Validate()
+		assert.Equal(t, bsonerr.DocumentTooLarge, err)
+		_, err = doc.MarshalBSON()
+		assert.Error(t, err)
+
+		_, err = array.Validate()
+		assert.Equal(t, bsonerr.DocumentTooLarge, err)
+
+		_, err = NewDocument(EC.Array("array", array)).Validate()
+		assert.Equal(t, bsonerr.DocumentTooLarge, err)
+	})
+	t.Run("NegativeLengths", func(t *testing.T) {
+		for name, valueType := range map[string]byte{
+			"String":     '\x02',
+			"JavaScript": '\x0D',
+			"Symbol":     '\x0E',
+			"Binary":     '\x05',
+			"DBPointer":  '\x0C',
+			"Document":   '\x03',
+			"Array":      '\x04',
+		} {
+			t.Run(name, func(t *testing.T) {
+				// a document with one element, "a", whose
+				// length is -16, followed by padding.
+				r := make(Reader, 32)
+				binary.LittleEndian.PutUint32(r[0:4], uint32(len(r)))
+				r[4] = valueType
+				r[5], r[6] = 'a', '\x00'
+				binary.LittleEndian.PutUint32(r[7:11], uint32(0xfffffff0))
+
+				_, err := r.Validate()
+				assert.Error(t, err)
+
+				_, err = ReadDocument(r)
+				assert.Error(t, err)
+			})
+		}
+	})
+}
+
+func BenchmarkLargeDocument(b *testing.B) {
+	for _, size := range []int{1000, 100000, 500000} {
+		doc := makeLargeDocument(size, true)
+		data, err := doc.MarshalBSON()
+		require.NoError(b, err)
+		key := fmt.Sprintf("metric.%07d", size/2)
+
+		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
+			b.Run("AppendSorted", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_ = makeLargeDocument(size, false)
+				}
+			})
+			b.Run("Read", func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					if _, err := ReadDocument(data); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run("Marshal", func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					if _, err := doc.MarshalBSON(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run("Lookup", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if doc.Lookup(key) == nil {
+						b.Fatal("missing key")
+					}
+				}
+			})
+			b.Run("RecursiveLookup", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if doc.RecursiveLookup(key) == nil {
+						b.Fatal("missing key")
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package bsonx
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+)
+
+// NumberMode determines the Go types of the numeric values that
+// ToMapDeep produces.
+type NumberMode int
+
+const (
+	// NumbersNative converts numbers to their native types:
+	// int32, int64, and float64.
+	NumbersNative NumberMode = iota
+	// NumbersInt64 converts integers to int64, and doubles to
+	// float64.
+	NumbersInt64
+	// NumbersFloat64 converts every number to float64, as
+	// encoding/json does, which loses the precision of integers
+	// above 2^53.
+	NumbersFloat64
+	// NumbersJSON converts every number, including decimals, to a
+	// json.Number, which preserves the value exactly. Non-finite
+	// doubles and decimals, which json.Number cannot represent,
+	// remain float64 and decimal.Decimal128 values.
+	NumbersJSON
+)
+
+// MapOptions controls the conversion of documents to maps by
+// ToMapDeep.
+type MapOptions struct {
+	Numbers NumberMode
+
+	// Times converts date time values to time.Time values, rather
+	// than to milliseconds since the Unix epoch.
+	Times bool
+}
+
+// ToMapDeep converts the document to a map of strings to native Go
+// values, converting embedded documents to map[string]interface{}
+// and arrays to []interface{}, at every level, and numbers to the
+// types that the options specify. Other values are converted as by
+// Value.Interface.
+func (d *Document) ToMapDeep(opts MapOptions) map[string]interface{} {
+	if d == nil {
+		return nil
+	}
+
+	out := make(map[string]interface{}, d.Len())
+	iter := d.Iterator()
+	for iter.Next() {
+		elem := iter.Element()
+		out[elem.Key()] = elem.Value().toNative(opts)
+	}
+
+	return out
+}
+
+// ToSliceDeep converts the array to a slice of native Go values, as
+// Document.ToMapDeep converts documents.
+func (a *Array) ToSliceDeep(opts MapOptions) []interface{} {
+	if a == nil {
+		return nil
+	}
+
+	out := make([]interface{}, 0, a.Len())
+	iter := a.Iterator()
+	for iter.Next() {
+		out = append(out, iter.Value().toNative(opts))
+	}
+
+	return out
+}
+
+func (v *Value) toNative(opts MapOptions) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	switch v.Type() {
+	case bsontype.EmbeddedDocument:
+		return v.MutableDocument().ToMapDeep(opts)
+	case bsontype.Array:
+		return v.MutableArray().ToSliceDeep(opts)
+	case bsontype.DateTime:
+		if opts.Times {
+			return v.Time()
+		}
+		return convertInt(v.DateTime(), opts.Numbers)
+	case bsontype.Int32:
+		if opts.Numbers == NumbersNative {
+			return v.Int32()
+		}
+		return convertInt(int64(v.Int32()), opts.Numbers)
+	case bsontype.Int64:
+		return convertInt(v.Int64(), opts.Numbers)
+	case bsontype.Double:
+		f := v.Double()
+		if opts.Numbers == NumbersJSON && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+		return f
+	case bsontype.Decimal128:
+		d := v.Decimal128()
+		if str := d.String(); opts.Numbers == NumbersJSON && str != "NaN" && !strings.HasSuffix(str, "Infinity") {
+			return json.Number(str)
+		}
+		return d
+	default:
+		return v.Interface()
+	}
+}
+
+func convertInt(n int64, mode NumberMode) interface{} {
+	switch mode {
+	case NumbersFloat64:
+		return float64(n)
+	case NumbersJSON:
+		return json.Number(strconv.FormatInt(n, 10))
+	default:
+		return n
+	}
+}
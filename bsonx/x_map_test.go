@@ -0,0 +1,81 @@
+package bsonx
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToMapDeep(t *testing.T) {
+	ts := time.Date(2019, time.March, 1, 12, 0, 0, 0, time.UTC)
+	doc := NewDocument(
+		EC.Int32("i32", 7),
+		EC.Int64("i64", 1<<60+1),
+		EC.Double("f", 1.5),
+		EC.Double("inf", math.Inf(1)),
+		EC.Time("ts", ts),
+		EC.String("s", "value"),
+		EC.SubDocumentFromElements("sub",
+			EC.Int32("n", 1),
+			EC.ArrayFromElements("arr",
+				VC.Int64(2),
+				VC.DocumentFromElements(EC.Double("x", 0.25)),
+				VC.ArrayFromValues(VC.Int32(3)),
+			),
+		),
+	)
+
+	t.Run("Nil", func(t *testing.T) {
+		var d *Document
+		assert.Nil(t, d.ToMapDeep(MapOptions{}))
+		var a *Array
+		assert.Nil(t, a.ToSliceDeep(MapOptions{}))
+	})
+	t.Run("Native", func(t *testing.T) {
+		out := doc.ToMapDeep(MapOptions{})
+		assert.Equal(t, int32(7), out["i32"])
+		assert.Equal(t, int64(1<<60+1), out["i64"])
+		assert.Equal(t, 1.5, out["f"])
+		assert.Equal(t, ts.UnixNano()/int64(time.Millisecond), out["ts"])
+		assert.Equal(t, "value", out["s"])
+
+		sub, ok := out["sub"].(map[string]interface{})
+		require.True(t, ok)
+		assert.Equal(t, int32(1), sub["n"])
+		assert.Equal(t, []interface{}{
+			int64(2),
+			map[string]interface{}{"x": 0.25},
+			[]interface{}{int32(3)},
+		}, sub["arr"])
+	})
+	t.Run("Int64", func(t *testing.T) {
+		out := doc.ToMapDeep(MapOptions{Numbers: NumbersInt64, Times: true})
+		assert.Equal(t, int64(7), out["i32"])
+		assert.Equal(t, 1.5, out["f"])
+		assert.True(t, ts.Equal(out["ts"].(time.Time)))
+		arr := out["sub"].(map[string]interface{})["arr"].([]interface{})
+		assert.Equal(t, []interface{}{int64(3)}, arr[2])
+	})
+	t.Run("Float64", func(t *testing.T) {
+		out := doc.ToMapDeep(MapOptions{Numbers: NumbersFloat64})
+		assert.Equal(t, float64(7), out["i32"])
+		assert.Equal(t, float64(1<<60), out["i64"])
+		assert.Equal(t, float64(1), out["sub"].(map[string]interface{})["n"])
+	})
+	t.Run("JSON", func(t *testing.T) {
+		out := doc.ToMapDeep(MapOptions{Numbers: NumbersJSON})
+		assert.Equal(t, json.Number("7"), out["i32"])
+		assert.Equal(t, json.Number("1152921504606846977"), out["i64"])
+		assert.Equal(t, json.Number("1.5"), out["f"])
+		assert.Equal(t, math.Inf(1), out["inf"])
+
+		delete(out, "inf")
+		data, err := json.Marshal(out)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"i64":1152921504606846977`)
+	})
+}
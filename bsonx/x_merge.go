@@ -0,0 +1,125 @@
+package bsonx
+
+// MergeStrategy determines how Merge resolves keys that both documents
+// have.
+type MergeStrategy int
+
+// The strategies that Merge supports.
+const (
+	// MergeOverwrite replaces the values of the document with the
+	// values of the other document.
+	MergeOverwrite MergeStrategy = iota
+	// MergeKeep keeps the values of the document, and ignores the
+	// values of the other document.
+	MergeKeep
+	// MergeDeep merges embedded documents recursively, and
+	// otherwise replaces the values of the document with the
+	// values of the other document, as MergeOverwrite does.
+	MergeDeep
+)
+
+func (s MergeStrategy) String() string {
+	switch s {
+	case MergeOverwrite:
+		return "overwrite"
+	case MergeKeep:
+		return "keep"
+	case MergeDeep:
+		return "deep"
+	default:
+		return "unknown"
+	}
+}
+
+// Concatenated returns a new document with the elements of the
+// document followed by the elements of the other documents, in order,
+// without modifying any of the documents. Unlike Concat, keys that
+// more than one document has are repeated in the new document. As
+// with Copy, the new document shares its elements with the original
+// documents. Nil documents are treated as empty documents.
+func (d *Document) Concatenated(others ...*Document) *Document {
+	elems := d.elementsOrNil()
+	size := len(elems)
+	for _, other := range others {
+		size += len(other.elementsOrNil())
+	}
+
+	out := DC.Make(size).Append(elems...)
+	for _, other := range others {
+		out.Append(other.elementsOrNil()...)
+	}
+
+	return out
+}
+
+// elementsOrNil returns the elements of the document, or nil for nil
+// documents.
+func (d *Document) elementsOrNil() []*Element {
+	if d == nil {
+		return nil
+	}
+	return d.elems
+}
+
+// Merge returns a new document with the elements of the document and
+// the other document, without modifying either document. Keys that
+// only one document has keep their values, and the strategy resolves
+// keys that both documents have. Elements are in the order of the
+// document, followed by the elements that only the other document
+// has, in the order of the other document.
+//
+// Keys are matched as with Lookup: when a document has more than one
+// element with a key, only the first is merged, and the others are
+// kept as they are, in the document, or omitted, in the other
+// document. As with Copy, the new document shares its elements with
+// the original documents, except for merged embedded documents. Nil
+// documents are treated as empty documents.
+func (d *Document) Merge(other *Document, strategy MergeStrategy) *Document {
+	elems, otherElems := d.elementsOrNil(), other.elementsOrNil()
+	out := DC.Make(len(elems) + len(otherElems))
+
+	otherIndex := make(map[string]int, len(otherElems))
+	for idx := len(otherElems) - 1; idx >= 0; idx-- {
+		otherIndex[otherElems[idx].Key()] = idx
+	}
+
+	seen := make(map[string]bool, len(elems)+len(otherElems))
+	for _, elem := range elems {
+		key := elem.Key()
+		otherIdx, ok := otherIndex[key]
+		if ok && !seen[key] {
+			elem = mergeElement(elem, otherElems[otherIdx], strategy)
+		}
+		seen[key] = true
+
+		out.Append(elem)
+	}
+
+	for _, elem := range otherElems {
+		if key := elem.Key(); !seen[key] {
+			seen[key] = true
+			out.Append(elem)
+		}
+	}
+
+	return out
+}
+
+func mergeElement(elem, other *Element, strategy MergeStrategy) *Element {
+	switch strategy {
+	case MergeKeep:
+		return elem
+	case MergeDeep:
+		doc, ok := elem.Value().MutableDocumentOK()
+		if !ok {
+			return other
+		}
+		otherDoc, ok := other.Value().MutableDocumentOK()
+		if !ok {
+			return other
+		}
+		return EC.SubDocument(elem.Key(), doc.Merge(otherDoc, strategy))
+	default:
+		return other
+	}
+}
@@ -0,0 +1,124 @@
+package bsonx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentConcatenated(t *testing.T) {
+	d1 := NewDocument(EC.Int32("a", 1), EC.Int32("b", 2))
+	d2 := NewDocument(EC.Int32("b", 3))
+	d3 := NewDocument(EC.String("c", "x"))
+
+	out := d1.Concatenated(d2, nil, d3)
+	assert.True(t, out.Equal(NewDocument(EC.Int32("a", 1), EC.Int32("b", 2), EC.Int32("b", 3), EC.String("c", "x"))))
+	assert.Equal(t, 2, d1.Len(), "documents are not modified")
+	assert.Equal(t, 1, d2.Len())
+
+	out.Append(EC.Int32("d", 4))
+	assert.Equal(t, 2, d1.Len())
+
+	var doc *Document
+	assert.Equal(t, 1, doc.Concatenated(d2).Len())
+	assert.Equal(t, 0, doc.Concatenated().Len())
+}
+
+func TestDocumentMerge(t *testing.T) {
+	base := func() *Document {
+		return NewDocument(
+			EC.Int32("a", 1),
+			EC.SubDocumentFromElements("mem",
+				EC.Int64("resident", 10),
+				EC.Int64("virtual", 20),
+			),
+			EC.String("host", "one"),
+			EC.Int32("a", 2),
+		)
+	}
+	other := func() *Document {
+		return NewDocument(
+			EC.SubDocumentFromElements("mem",
+				EC.Int64("virtual", 30),
+				EC.Int64("mapped", 40),
+			),
+			EC.String("host", "two"),
+			EC.Boolean("ok", true),
+			EC.String("host", "three"),
+		)
+	}
+
+	t.Run("Overwrite", func(t *testing.T) {
+		d := base()
+		out := d.Merge(other(), MergeOverwrite)
+		assert.True(t, out.Equal(NewDocument(
+			EC.Int32("a", 1),
+			EC.SubDocumentFromElements("mem",
+				EC.Int64("virtual", 30),
+				EC.Int64("mapped", 40),
+			),
+			EC.String("host", "two"),
+			EC.Int32("a", 2),
+			EC.Boolean("ok", true),
+		)), out.String())
+		assert.True(t, d.Equal(base()), "documents are not modified")
+	})
+	t.Run("Keep", func(t *testing.T) {
+		out := base().Merge(other(), MergeKeep)
+		expected := base()
+		expected.Append(EC.Boolean("ok", true))
+		assert.True(t, out.Equal(expected), out.String())
+	})
+	t.Run("Deep", func(t *testing.T) {
+		d := base()
+		out := d.Merge(other(), MergeDeep)
+		assert.True(t, out.Equal(NewDocument(
+			EC.Int32("a", 1),
+			EC.SubDocumentFromElements("mem",
+				EC.Int64("resident", 10),
+				EC.Int64("virtual", 30),
+				EC.Int64("mapped", 40),
+			),
+			EC.String("host", "two"),
+			EC.Int32("a", 2),
+			EC.Boolean("ok", true),
+		)), out.String())
+		assert.True(t, d.Equal(base()), "embedded documents are not modified")
+	})
+	t.Run("DeepTypeChange", func(t *testing.T) {
+		d := NewDocument(EC.SubDocumentFromElements("a", EC.Int32("b", 1)))
+		out := d.Merge(NewDocument(EC.Int32("a", 2)), MergeDeep)
+		assert.True(t, out.Equal(NewDocument(EC.Int32("a", 2))))
+
+		out = NewDocument(EC.Int32("a", 2)).Merge(d, MergeDeep)
+		assert.True(t, out.Equal(d))
+	})
+	t.Run("ReadDocuments", func(t *testing.T) {
+		data, err := base().MarshalBSON()
+		require.NoError(t, err)
+		d, err := ReadDocument(data)
+		require.NoError(t, err)
+		data, err = other().MarshalBSON()
+		require.NoError(t, err)
+		o, err := ReadDocument(data)
+		require.NoError(t, err)
+
+		out := d.Merge(o, MergeDeep)
+		assert.Equal(t, int64(10), out.RecursiveLookup("mem", "resident").Int64())
+		assert.Equal(t, int64(30), out.RecursiveLookup("mem", "virtual").Int64())
+	})
+	t.Run("Nil", func(t *testing.T) {
+		var doc *Document
+		out := doc.Merge(base(), MergeKeep)
+		assert.Equal(t, 3, out.Len(), "repeated keys of the other document are omitted")
+		assert.Equal(t, int32(1), out.Lookup("a").Int32())
+		assert.True(t, base().Merge(nil, MergeOverwrite).Equal(base()))
+	})
+	t.Run("Strategies", func(t *testing.T) {
+		assert.Equal(t, "overwrite", MergeOverwrite.String())
+		assert.Equal(t, "keep", MergeKeep.String())
+		assert.Equal(t, "deep", MergeDeep.String())
+		assert.Equal(t, "unknown", MergeStrategy(42).String())
+	})
+}
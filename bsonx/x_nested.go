@@ -0,0 +1,255 @@
+package bsonx
+
+import (
+	"strconv"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/mongodb/ftdc/bsonx/elements"
+)
+
+// nestedFrame is a document, or array, whose elements are being
+// validated or written. Validation and serialization of documents use
+// an explicit stack of frames, rather than recursion, so that deeply
+// nested documents do not exhaust the call stack.
+type nestedFrame struct {
+	doc   *Document
+	array bool
+	idx   int
+
+	// slot is the position of the size of the document in the
+	// sizes recorded by validation, header is the size of the
+	// element that holds the document, excluding the document
+	// itself, and size is the size of the document so far.
+	slot   int
+	header uint32
+	size   uint32
+}
+
+func (opts ValidationOptions) maxDepth() int {
+	if opts.MaxDepth <= 0 {
+		return validateMaxDepthDefault
+	}
+	return opts.MaxDepth
+}
+
+// validateNested validates the document, or array, and the documents
+// embedded in it, and returns its size. When sizes is not nil, it
+// records the size of the value of every element, in the order that
+// writeNested writes them, where the size of an embedded document (or
+// of the scope of JavaScript code) is the size of the document. The
+// top level document has a depth of one, and a maxDepth of zero
+// disables the limit.
+func validateNested(d *Document, array bool, maxDepth int, sizes *[]uint32) (uint32, error) {
+	if d == nil {
+		return 0, bsonerr.NilDocument
+	}
+
+	record := func(size uint32) int {
+		if sizes == nil {
+			return -1
+		}
+		*sizes = append(*sizes, size)
+		return len(*sizes) - 1
+	}
+
+	// Header and Footer
+	stack := []nestedFrame{{doc: d, array: array, slot: -1, size: 4 + 1}}
+	for {
+		frame := &stack[len(stack)-1]
+		if frame.idx == len(frame.doc.elems) {
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return frame.size, nil
+			}
+
+			if sizes != nil {
+				(*sizes)[frame.slot] = frame.size
+			}
+			parent := &stack[len(stack)-1]
+			if uint64(parent.size)+uint64(frame.header)+uint64(frame.size) > MaxDocumentSize {
+				return 0, bsonerr.DocumentTooLarge
+			}
+			parent.size += frame.header + frame.size
+			continue
+		}
+
+		idx := frame.idx
+		frame.idx++
+
+		elem := frame.doc.elems[idx]
+		if elem == nil {
+			return 0, bsonerr.NilElement
+		}
+		v := elem.value
+		if v == nil || v.data == nil {
+			return 0, bsonerr.UninitializedElement
+		}
+
+		// type and key
+		var header uint32 = 1
+		if frame.array {
+			header += uint32(len(strconv.Itoa(idx))) + 1
+		} else {
+			n, err := elem.validateKey()
+			if err != nil {
+				return 0, err
+			}
+			header += n
+		}
+
+		var child *Document
+		switch v.data[v.start] {
+		case '\x03', '\x04':
+			child = v.d
+		case '\x0F':
+			if v.d == nil {
+				break
+			}
+			n, err := v.validateScopeCode(false)
+			if err != nil {
+				return 0, err
+			}
+			header += n
+			child = v.d
+		}
+
+		if child != nil {
+			if maxDepth > 0 && len(stack) >= maxDepth {
+				return 0, bsonerr.MaxDepthExceeded
+			}
+			stack = append(stack, nestedFrame{
+				doc:    child,
+				array:  v.data[v.start] == '\x04',
+				slot:   record(0),
+				header: header,
+				size:   4 + 1,
+			})
+			continue
+		}
+
+		n, err := v.validate(false)
+		if err != nil {
+			return 0, err
+		}
+		record(n)
+		if uint64(frame.size)+uint64(header)+uint64(n) > MaxDocumentSize {
+			return 0, bsonerr.DocumentTooLarge
+		}
+		frame.size += header + n
+	}
+}
+
+// writeNested writes the document, or array, of the given size to the
+// slice at the start position, using the sizes recorded by
+// validateNested, and returns the number of bytes written.
+func writeNested(d *Document, array bool, size uint32, sizes []uint32, start uint, b []byte) (int64, error) {
+	if len(b) < int(start)+int(size) {
+		return 0, newErrTooSmall()
+	}
+
+	pos := start
+	n, err := elements.Int32.Encode(pos, b, int32(size))
+	pos += uint(n)
+	if err != nil {
+		return int64(pos - start), err
+	}
+
+	stack := []nestedFrame{{doc: d, array: array}}
+	next := 0
+	for len(stack) > 0 {
+		frame := &stack[len(stack)-1]
+		if frame.idx == len(frame.doc.elems) {
+			n, err = elements.Byte.Encode(pos, b, '\x00')
+			pos += uint(n)
+			if err != nil {
+				return int64(pos - start), err
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		idx := frame.idx
+		frame.idx++
+
+		elem := frame.doc.elems[idx]
+		v := elem.value
+		vsize := sizes[next]
+		next++
+
+		if frame.array {
+			b[pos] = v.data[v.start]
+			pos++
+			pos += uint(copy(b[pos:], strconv.Itoa(idx)))
+			b[pos] = '\x00'
+			pos++
+		} else {
+			pos += uint(copy(b[pos:], v.data[v.start:v.offset]))
+		}
+
+		t := v.data[v.start]
+		switch {
+		case (t == '\x03' || t == '\x04') && v.d != nil:
+		case t == '\x0F' && v.d != nil:
+			// the length of code with scope is not known until
+			// the scope is validated, so it is recorded in the
+			// element as it is written.
+			codeLength := readi32(v.data[v.offset+4 : v.offset+8])
+			_, err = elements.Int32.Encode(uint(v.offset), v.data, 4+4+codeLength+int32(vsize))
+			if err != nil {
+				return int64(pos - start), err
+			}
+			pos += uint(copy(b[pos:], v.data[v.offset:v.offset+8+uint32(codeLength)]))
+		default:
+			n, err := elem.writeByteSlice(false, pos, v.offset-v.start+vsize, b)
+			pos += uint(n)
+			if err != nil {
+				return int64(pos - start), err
+			}
+			continue
+		}
+
+		n, err = elements.Int32.Encode(pos, b, int32(vsize))
+		pos += uint(n)
+		if err != nil {
+			return int64(pos - start), err
+		}
+		stack = append(stack, nestedFrame{doc: v.d, array: t == '\x04'})
+	}
+
+	return int64(pos - start), nil
+}
+
+// marshalNested validates the document, or array, and writes it to a
+// new slice.
+func marshalNested(d *Document, array bool, maxDepth int) ([]byte, error) {
+	sizes := []uint32{}
+	size, err := validateNested(d, array, maxDepth, &sizes)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, size)
+	if _, err = writeNested(d, array, size, sizes, 0, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// writeNestedByteSlice writes the document, or array, of the given
+// size to the slice at the start position.
+func writeNestedByteSlice(d *Document, array bool, start uint, size uint32, b []byte) (int64, error) {
+	if d == nil {
+		return 0, bsonerr.NilDocument
+	}
+	if len(b) < int(start)+int(size) {
+		return 0, newErrTooSmall()
+	}
+
+	// callers validate documents before writing them, so the
+	// depth of the document is not limited here.
+	sizes := []uint32{}
+	if _, err := validateNested(d, array, 0, &sizes); err != nil {
+		return 0, err
+	}
+	return writeNested(d, array, size, sizes, start, b)
+}
@@ -0,0 +1,129 @@
+package bsonx
+
+import (
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nestedDocument returns a document with the given depth, whose
+// levels alternate between embedded documents, arrays, and the
+// scopes of JavaScript code.
+func nestedDocument(depth int) *Document {
+	var inner *Value
+	for level := depth - 1; level >= 0; level-- {
+		if level%3 == 1 {
+			values := []*Value{VC.Int32(int32(level))}
+			if inner != nil {
+				values = append(values, inner)
+			}
+			inner = VC.Array(NewArray(values...))
+			continue
+		}
+
+		doc := NewDocument(EC.Int32("level", int32(level)))
+		if inner != nil {
+			doc.Append(EC.FromValue("inner", inner))
+		}
+		doc.Append(EC.Boolean("after", true))
+
+		if level%3 == 2 {
+			inner = VC.CodeWithScope("function() {}", doc)
+		} else {
+			inner = VC.Document(doc)
+		}
+	}
+	return inner.MutableDocument()
+}
+
+func TestNestedDocuments(t *testing.T) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		for _, depth := range []int{1, 2, 3, 10, 2048} {
+			doc := nestedDocument(depth)
+
+			size, err := doc.Validate()
+			require.NoError(t, err, "depth %d", depth)
+			data, err := doc.MarshalBSON()
+			require.NoError(t, err, "depth %d", depth)
+			assert.EqualValues(t, size, len(data))
+
+			out, err := ReadDocument(data)
+			require.NoError(t, err)
+			again, err := out.MarshalBSON()
+			require.NoError(t, err)
+			assert.Equal(t, data, again)
+		}
+	})
+	t.Run("Elements", func(t *testing.T) {
+		doc := nestedDocument(100)
+		data, err := doc.MarshalBSON()
+		require.NoError(t, err)
+
+		elem := EC.SubDocument("nested", doc)
+		size, err := elem.Validate()
+		require.NoError(t, err)
+		elemData, err := elem.MarshalBSON()
+		require.NoError(t, err)
+		assert.EqualValues(t, size, len(elemData))
+		assert.Equal(t, data, elemData[len(elemData)-len(data):])
+
+		arr := NewArray(VC.Document(doc), VC.Double(1.5))
+		arrData, err := arr.MarshalBSON()
+		require.NoError(t, err)
+		read, err := ReadDocument(arrData)
+		require.NoError(t, err)
+		assert.True(t, read.Lookup("0").MutableDocument().Equal(doc))
+		assert.Equal(t, 1.5, read.Lookup("1").Double())
+	})
+	t.Run("WriteDocument", func(t *testing.T) {
+		doc := nestedDocument(50)
+		data, err := doc.MarshalBSON()
+		require.NoError(t, err)
+
+		buf := make([]byte, len(data)+8)
+		n, err := doc.WriteDocument(8, buf)
+		require.NoError(t, err)
+		assert.EqualValues(t, len(data), n)
+		assert.Equal(t, data, buf[8:])
+
+		_, err = doc.WriteDocument(9, buf)
+		assert.Error(t, err)
+	})
+	t.Run("MaxDepth", func(t *testing.T) {
+		doc := nestedDocument(2049)
+		_, err := doc.Validate()
+		assert.Equal(t, bsonerr.MaxDepthExceeded, errors.Cause(err))
+		_, err = doc.MarshalBSON()
+		assert.Equal(t, bsonerr.MaxDepthExceeded, errors.Cause(err))
+
+		_, err = doc.ValidateWithOptions(ValidationOptions{MaxDepth: 2049})
+		assert.NoError(t, err)
+		data, err := doc.MarshalBSONWithOptions(ValidationOptions{MaxDepth: 4096})
+		require.NoError(t, err)
+		assert.NotEmpty(t, data)
+
+		doc = nestedDocument(10)
+		_, err = doc.ValidateWithOptions(ValidationOptions{MaxDepth: 10})
+		assert.NoError(t, err)
+		_, err = doc.ValidateWithOptions(ValidationOptions{MaxDepth: 9})
+		assert.Equal(t, bsonerr.MaxDepthExceeded, errors.Cause(err))
+		_, err = doc.MarshalBSONWithOptions(ValidationOptions{MaxDepth: 9})
+		assert.Equal(t, bsonerr.MaxDepthExceeded, errors.Cause(err))
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		var doc *Document
+		_, err := doc.ValidateWithOptions(ValidationOptions{})
+		assert.Equal(t, bsonerr.NilDocument, err)
+		_, err = doc.MarshalBSONWithOptions(ValidationOptions{})
+		assert.Equal(t, bsonerr.NilDocument, err)
+
+		doc = NewDocument(EC.SubDocument("a", NewDocument(EC.SubDocument("b", &Document{elems: []*Element{nil}}))))
+		_, err = doc.Validate()
+		assert.Equal(t, bsonerr.NilElement, err)
+		_, err = doc.MarshalBSON()
+		assert.Equal(t, bsonerr.NilElement, err)
+	})
+}
@@ -0,0 +1,182 @@
+package bsonx
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// LookupPath returns the value at the dot separated path (e.g.
+// "a.b.3.c"), which traverses embedded documents by key and arrays by
+// index, or nil if there is no such value. As with Lookup, the first
+// element with a key is used when a document has more than one.
+func (d *Document) LookupPath(path string) *Value {
+	value, err := d.LookupPathErr(path)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+// LookupPathErr is the same as LookupPath, except that it returns an
+// error that describes why the path does not exist: ElementNotFound
+// for missing keys, OutOfBounds for missing array indexes,
+// InvalidArrayKey for array path components that are not indexes, and
+// InvalidDepthTraversal for paths that continue past a value that is
+// not a document or array.
+func (d *Document) LookupPathErr(path string) (*Value, error) {
+	if d == nil {
+		return nil, bsonerr.NilDocument
+	}
+
+	keys, err := splitPath(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	value, err := lookupPathKey(d, false, keys[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem finding '%s'", keys[0])
+	}
+
+	for idx, key := range keys[1:] {
+		container, array, err := pathContainer(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem traversing '%s'", strings.Join(keys[:idx+1], "."))
+		}
+
+		if value, err = lookupPathKey(container, array, key); err != nil {
+			return nil, errors.Wrapf(err, "problem finding '%s'", strings.Join(keys[:idx+2], "."))
+		}
+	}
+
+	return value, nil
+}
+
+// SetPath sets the value at the dot separated path (e.g. "a.b.3.c"),
+// replacing the existing value, if any. Documents on the path that do
+// not exist are created, and a path component that is one past the
+// end of an array appends to the array. SetPath returns an error, and
+// does not modify the document, if the path traverses a value that is
+// not a document or array, or an array index that does not exist.
+func (d *Document) SetPath(path string, value *Value) error {
+	if d == nil {
+		return bsonerr.NilDocument
+	}
+	if _, err := EC.FromValueErr(path, value); err != nil {
+		return errors.WithStack(err)
+	}
+
+	keys, err := splitPath(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// find the deepest existing container on the path before
+	// making any changes, so that errors leave the document as it
+	// was.
+	container, array := d, false
+	depth := 0
+	for ; depth < len(keys)-1; depth++ {
+		next, err := lookupPathKey(container, array, keys[depth])
+		if errors.Cause(err) == bsonerr.ElementNotFound || (array && errors.Cause(err) == bsonerr.OutOfBounds) {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "problem finding '%s'", strings.Join(keys[:depth+1], "."))
+		}
+
+		if container, array, err = pathContainer(next); err != nil {
+			return errors.Wrapf(err, "problem traversing '%s'", strings.Join(keys[:depth+1], "."))
+		}
+	}
+
+	// build the missing documents from the bottom up, and insert
+	// them, with the value, at the deepest existing container.
+	for idx := len(keys) - 1; idx > depth; idx-- {
+		value = VC.Document(NewDocument(EC.FromValue(keys[idx], value)))
+	}
+
+	return errors.Wrapf(setPathKey(container, array, keys[depth], value),
+		"problem setting '%s'", strings.Join(keys[:depth+1], "."))
+}
+
+func splitPath(path string) ([]string, error) {
+	if path == "" {
+		return nil, bsonerr.EmptyKey
+	}
+
+	keys := strings.Split(path, ".")
+	for _, key := range keys {
+		if key == "" {
+			return nil, errors.Wrapf(bsonerr.EmptyKey, "path '%s' has an empty component", path)
+		}
+	}
+	return keys, nil
+}
+
+// pathContainer returns the document that holds the elements of an
+// embedded document or array value, and whether the value is an array.
+func pathContainer(value *Value) (*Document, bool, error) {
+	switch value.Type() {
+	case bsontype.EmbeddedDocument:
+		return value.MutableDocument(), false, nil
+	case bsontype.Array:
+		return value.MutableArray().doc, true, nil
+	default:
+		return nil, false, errors.Wrapf(bsonerr.InvalidDepthTraversal, "cannot traverse %s value", value.Type())
+	}
+}
+
+func parseArrayIndex(key string) (uint, error) {
+	index, err := strconv.ParseUint(key, 10, 0)
+	if err != nil {
+		return 0, errors.Wrapf(bsonerr.InvalidArrayKey, "'%s' is not an array index", key)
+	}
+	return uint(index), nil
+}
+
+func lookupPathKey(container *Document, array bool, key string) (*Value, error) {
+	if !array {
+		return container.LookupErr(key)
+	}
+
+	index, err := parseArrayIndex(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return (&Array{doc: container}).LookupErr(index)
+}
+
+func setPathKey(container *Document, array bool, key string, value *Value) error {
+	if !array {
+		elem := EC.FromValue(key, value)
+		if first := container.LookupElement(key); first != nil {
+			// replace the first element with the key, which is
+			// the one that Lookup returns, in place.
+			*first = *elem
+			return nil
+		}
+		container.Append(elem)
+		return nil
+	}
+
+	index, err := parseArrayIndex(key)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	arr := &Array{doc: container}
+	switch {
+	case index < uint(arr.Len()):
+		arr.Set(index, value)
+	case index == uint(arr.Len()):
+		arr.Append(value)
+	default:
+		return errors.Wrapf(bsonerr.OutOfBounds, "index %d is past the end of an array of %d values", index, arr.Len())
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package bsonx
+
+import (
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makePathDocument() *Document {
+	return NewDocument(
+		EC.Int32("a", 1),
+		EC.SubDocumentFromElements("b",
+			EC.String("c", "foo"),
+			EC.ArrayFromElements("d",
+				VC.Int32(10),
+				VC.DocumentFromElements(EC.Int64("e", 42)),
+				VC.ArrayFromValues(VC.Int32(7), VC.Int32(8)),
+			),
+		),
+	)
+}
+
+func TestLookupPath(t *testing.T) {
+	for name, doc := range map[string]func(t *testing.T) *Document{
+		"Constructed": func(t *testing.T) *Document { return makePathDocument() },
+		"Read": func(t *testing.T) *Document {
+			data, err := makePathDocument().MarshalBSON()
+			require.NoError(t, err)
+			doc, err := ReadDocument(data)
+			require.NoError(t, err)
+			return doc
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Run("Found", func(t *testing.T) {
+				doc := doc(t)
+				assert.EqualValues(t, 1, doc.LookupPath("a").Int32())
+				assert.Equal(t, "foo", doc.LookupPath("b.c").StringValue())
+				assert.EqualValues(t, 10, doc.LookupPath("b.d.0").Int32())
+				assert.EqualValues(t, 42, doc.LookupPath("b.d.1.e").Int64())
+				assert.EqualValues(t, 8, doc.LookupPath("b.d.2.1").Int32())
+				assert.Equal(t, 3, doc.LookupPath("b.d").MutableArray().Len())
+			})
+			t.Run("Errors", func(t *testing.T) {
+				doc := doc(t)
+				for path, expected := range map[string]error{
+					"":        bsonerr.EmptyKey,
+					"b..c":    bsonerr.EmptyKey,
+					"z":       bsonerr.ElementNotFound,
+					"b.z":     bsonerr.ElementNotFound,
+					"b.d.3":   bsonerr.OutOfBounds,
+					"b.d.x":   bsonerr.InvalidArrayKey,
+					"b.d.-1":  bsonerr.InvalidArrayKey,
+					"a.b":     bsonerr.InvalidDepthTraversal,
+					"b.d.0.e": bsonerr.InvalidDepthTraversal,
+				} {
+					value, err := doc.LookupPathErr(path)
+					assert.Nil(t, value, path)
+					assert.Equal(t, expected, errors.Cause(err), path)
+					assert.Nil(t, doc.LookupPath(path), path)
+				}
+			})
+		})
+	}
+	t.Run("NilDocument", func(t *testing.T) {
+		var doc *Document
+		_, err := doc.LookupPathErr("a")
+		assert.Equal(t, bsonerr.NilDocument, err)
+	})
+}
+
+func TestSetPath(t *testing.T) {
+	for name, doc := range map[string]func(t *testing.T) *Document{
+		"Constructed": func(t *testing.T) *Document { return makePathDocument() },
+		"Read": func(t *testing.T) *Document {
+			data, err := makePathDocument().MarshalBSON()
+			require.NoError(t, err)
+			doc, err := ReadDocument(data)
+			require.NoError(t, err)
+			return doc
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// roundTrip checks that the changes survive
+			// encoding, as embedded documents that were read
+			// from bytes are decoded lazily.
+			roundTrip := func(t *testing.T, doc *Document) *Document {
+				data, err := doc.MarshalBSON()
+				require.NoError(t, err)
+				out, err := ReadDocument(data)
+				require.NoError(t, err)
+				return out
+			}
+
+			t.Run("Replace", func(t *testing.T) {
+				doc := doc(t)
+				require.NoError(t, doc.SetPath("b.d.1.e", VC.String("bar")))
+				require.NoError(t, doc.SetPath("b.d.2.0", VC.Int32(70)))
+				require.NoError(t, doc.SetPath("a", VC.Int32(2)))
+
+				doc = roundTrip(t, doc)
+				assert.Equal(t, "bar", doc.LookupPath("b.d.1.e").StringValue())
+				assert.EqualValues(t, 70, doc.LookupPath("b.d.2.0").Int32())
+				assert.EqualValues(t, 2, doc.LookupPath("a").Int32())
+				assert.Equal(t, 2, doc.Len())
+			})
+			t.Run("Create", func(t *testing.T) {
+				doc := doc(t)
+				require.NoError(t, doc.SetPath("b.f", VC.Int32(3)))
+				require.NoError(t, doc.SetPath("x.y.z", VC.Int32(4)))
+				require.NoError(t, doc.SetPath("b.d.3", VC.Int32(5)))
+				require.NoError(t, doc.SetPath("b.d.4.g.h", VC.Int32(6)))
+
+				doc = roundTrip(t, doc)
+				assert.EqualValues(t, 3, doc.LookupPath("b.f").Int32())
+				assert.EqualValues(t, 4, doc.LookupPath("x.y.z").Int32())
+				assert.EqualValues(t, 5, doc.LookupPath("b.d.3").Int32())
+				assert.EqualValues(t, 6, doc.LookupPath("b.d.4.g.h").Int32())
+				assert.Equal(t, 5, doc.LookupPath("b.d").MutableArray().Len())
+			})
+			t.Run("Errors", func(t *testing.T) {
+				doc := doc(t)
+				expected, err := doc.MarshalBSON()
+				require.NoError(t, err)
+
+				for path, cause := range map[string]error{
+					"":          bsonerr.EmptyKey,
+					"b.":        bsonerr.EmptyKey,
+					"a.b":       bsonerr.InvalidDepthTraversal,
+					"b.c.d.e":   bsonerr.InvalidDepthTraversal,
+					"b.d.x":     bsonerr.InvalidArrayKey,
+					"b.d.5":     bsonerr.OutOfBounds,
+					"b.d.5.e.f": bsonerr.OutOfBounds,
+				} {
+					err := doc.SetPath(path, VC.Int32(1))
+					assert.Equal(t, cause, errors.Cause(err), path)
+				}
+				assert.Error(t, doc.SetPath("a", nil))
+
+				actual, err := doc.MarshalBSON()
+				require.NoError(t, err)
+				assert.Equal(t, expected, actual)
+			})
+		})
+	}
+}
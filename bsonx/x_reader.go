@@ -0,0 +1,213 @@
+package bsonx
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+)
+
+// RawValue is a view of a value in the bytes of a BSON document. The
+// Data slice holds the encoded value (without the type or the key of
+// its element), and shares the memory of the document, so it is only
+// valid as long as the document's bytes are not modified.
+//
+// The accessors of RawValue do not allocate, and return false when
+// the value has a different type.
+type RawValue struct {
+	Type bsontype.Type
+	Data []byte
+}
+
+// DoubleOK returns the value of a double.
+func (v RawValue) DoubleOK() (float64, bool) {
+	if v.Type != bsontype.Double || len(v.Data) < 8 {
+		return 0, false
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(v.Data)), true
+}
+
+// Int32OK returns the value of a 32-bit integer.
+func (v RawValue) Int32OK() (int32, bool) {
+	if v.Type != bsontype.Int32 || len(v.Data) < 4 {
+		return 0, false
+	}
+	return readi32(v.Data), true
+}
+
+// Int64OK returns the value of a 64-bit integer.
+func (v RawValue) Int64OK() (int64, bool) {
+	if v.Type != bsontype.Int64 || len(v.Data) < 8 {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(v.Data)), true
+}
+
+// BooleanOK returns the value of a boolean.
+func (v RawValue) BooleanOK() (bool, bool) {
+	if v.Type != bsontype.Boolean || len(v.Data) < 1 {
+		return false, false
+	}
+	return v.Data[0] == '\x01', true
+}
+
+// DateTimeOK returns the value of a datetime, as milliseconds since
+// the Unix epoch.
+func (v RawValue) DateTimeOK() (int64, bool) {
+	if v.Type != bsontype.DateTime || len(v.Data) < 8 {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(v.Data)), true
+}
+
+// TimestampOK returns the time and increment of a timestamp.
+func (v RawValue) TimestampOK() (uint32, uint32, bool) {
+	if v.Type != bsontype.Timestamp || len(v.Data) < 8 {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint32(v.Data[4:]), binary.LittleEndian.Uint32(v.Data), true
+}
+
+// StringBytesOK returns the bytes of a string, without the null
+// terminator, and without copying them.
+func (v RawValue) StringBytesOK() ([]byte, bool) {
+	if v.Type != bsontype.String || len(v.Data) < 5 {
+		return nil, false
+	}
+	return v.Data[4 : len(v.Data)-1], true
+}
+
+// BinaryOK returns the subtype and the data of a binary value, without
+// copying the data.
+func (v RawValue) BinaryOK() (byte, []byte, bool) {
+	if v.Type != bsontype.Binary || len(v.Data) < 5 {
+		return 0, nil, false
+	}
+	if v.Data[4] == 0x02 && len(v.Data) >= 9 {
+		return v.Data[4], v.Data[9:], true
+	}
+	return v.Data[4], v.Data[5:], true
+}
+
+// DocumentOK returns an embedded document as a Reader.
+func (v RawValue) DocumentOK() (Reader, bool) {
+	if v.Type != bsontype.EmbeddedDocument {
+		return nil, false
+	}
+	return Reader(v.Data), true
+}
+
+// ArrayOK returns an array as a Reader, whose keys are the indexes of
+// the array.
+func (v RawValue) ArrayOK() (Reader, bool) {
+	if v.Type != bsontype.Array {
+		return nil, false
+	}
+	return Reader(v.Data), true
+}
+
+// Value returns a copy of the value as a *Value, which allocates.
+func (v RawValue) Value() *Value {
+	data := make([]byte, 2+len(v.Data))
+	data[0] = byte(v.Type)
+	copy(data[2:], v.Data)
+	return &Value{start: 0, offset: 2, data: data}
+}
+
+// ReaderIterator iterates over the elements of a Reader without
+// allocating: the key and value of each element are views of the
+// bytes of the Reader. Nested documents and arrays are not validated
+// until they are iterated, which makes a ReaderIterator suitable for
+// hot paths that visit every element of a document, such as hashing
+// keys and extracting values.
+//
+// The zero value is ready to use after a call to Reset, so a single
+// iterator (e.g. on the stack) may be reused for many documents.
+type ReaderIterator struct {
+	r     Reader
+	pos   uint32
+	end   uint32
+	key   []byte
+	value RawValue
+	size  Value
+	err   error
+}
+
+// NewReaderIterator returns an iterator over the elements of the
+// Reader, which returns an error if the Reader is too small for the
+// length of its document.
+func NewReaderIterator(r Reader) (*ReaderIterator, error) {
+	iter := &ReaderIterator{}
+	if err := iter.Reset(r); err != nil {
+		return nil, err
+	}
+	return iter, nil
+}
+
+// Reset starts iterating over the elements of another Reader.
+func (iter *ReaderIterator) Reset(r Reader) error {
+	*iter = ReaderIterator{}
+	if len(r) < 5 {
+		return newErrTooSmall()
+	}
+	givenLength := readi32(r[0:4])
+	if givenLength < 5 || len(r) < int(givenLength) {
+		return bsonerr.InvalidLength
+	}
+
+	iter.r = r
+	iter.pos = 4
+	iter.end = uint32(givenLength)
+	return nil
+}
+
+// Next advances to the next element, and returns false at the end of
+// the document, or if the element is invalid, in which case Err
+// returns the error.
+func (iter *ReaderIterator) Next() bool {
+	if iter.err != nil || iter.r == nil {
+		return false
+	}
+	if iter.pos >= iter.end {
+		iter.err = bsonerr.InvalidReadOnlyDocument
+		return false
+	}
+	if iter.r[iter.pos] == '\x00' {
+		return false
+	}
+
+	start := iter.pos
+	n, err := iter.r.validateKey(start+1, iter.end)
+	if err != nil {
+		iter.err = err
+		return false
+	}
+	offset := start + 1 + n
+
+	// measure the value with the size-only validation of a
+	// reused Value, which doesn't allocate.
+	iter.size.start = start
+	iter.size.offset = offset
+	iter.size.data = iter.r[:iter.end]
+	n, err = iter.size.validate(true)
+	if err != nil {
+		iter.err = err
+		return false
+	}
+
+	iter.key = iter.r[start+1 : offset-1]
+	iter.value = RawValue{Type: bsontype.Type(iter.r[start]), Data: iter.r[offset : offset+n]}
+	iter.pos = offset + n
+	return true
+}
+
+// Key returns the key of the current element, which shares the
+// memory of the Reader.
+func (iter *ReaderIterator) Key() []byte { return iter.key }
+
+// Value returns the value of the current element.
+func (iter *ReaderIterator) Value() RawValue { return iter.value }
+
+// Err returns the error that stopped the iterator, if any.
+func (iter *ReaderIterator) Err() error { return iter.err }
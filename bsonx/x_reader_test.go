@@ -0,0 +1,164 @@
+package bsonx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderIterator(t *testing.T) {
+	doc := NewDocument(
+		EC.Double("double", 1.5),
+		EC.String("string", "value"),
+		EC.SubDocumentFromElements("doc", EC.Int32("inner", 7), EC.Boolean("flag", true)),
+		EC.ArrayFromElements("array", VC.Int64(1), VC.Int64(2)),
+		EC.Binary("binary", []byte{1, 2, 3}),
+		EC.ObjectID("oid", [12]byte{1}),
+		EC.Boolean("bool", true),
+		EC.Time("time", time.Unix(1000, 0)),
+		EC.Null("null"),
+		EC.Regex("regex", "^a", "i"),
+		EC.Int32("int32", 32),
+		EC.Timestamp("ts", 10, 20),
+		EC.Int64("int64", 64),
+		EC.MinKey("min"),
+	)
+	data, err := doc.MarshalBSON()
+	require.NoError(t, err)
+
+	t.Run("Elements", func(t *testing.T) {
+		iter, err := NewReaderIterator(data)
+		require.NoError(t, err)
+
+		expected := doc.Iterator()
+		count := 0
+		for iter.Next() {
+			require.True(t, expected.Next())
+			elem := expected.Element()
+			assert.Equal(t, elem.Key(), string(iter.Key()))
+			assert.Equal(t, elem.Value().Type(), iter.Value().Type)
+			assert.True(t, elem.Value().Equal(iter.Value().Value()), elem.Key())
+			count++
+		}
+		require.NoError(t, iter.Err())
+		assert.Equal(t, doc.Len(), count)
+	})
+	t.Run("Accessors", func(t *testing.T) {
+		values := map[string]RawValue{}
+		iter, err := NewReaderIterator(data)
+		require.NoError(t, err)
+		for iter.Next() {
+			values[string(iter.Key())] = iter.Value()
+		}
+		require.NoError(t, iter.Err())
+
+		f, ok := values["double"].DoubleOK()
+		assert.True(t, ok)
+		assert.Equal(t, 1.5, f)
+		s, ok := values["string"].StringBytesOK()
+		assert.True(t, ok)
+		assert.Equal(t, "value", string(s))
+		i32, ok := values["int32"].Int32OK()
+		assert.True(t, ok)
+		assert.EqualValues(t, 32, i32)
+		i64, ok := values["int64"].Int64OK()
+		assert.True(t, ok)
+		assert.EqualValues(t, 64, i64)
+		b, ok := values["bool"].BooleanOK()
+		assert.True(t, ok)
+		assert.True(t, b)
+		ms, ok := values["time"].DateTimeOK()
+		assert.True(t, ok)
+		assert.EqualValues(t, 1000000, ms)
+		ts, inc, ok := values["ts"].TimestampOK()
+		assert.True(t, ok)
+		assert.EqualValues(t, 10, ts)
+		assert.EqualValues(t, 20, inc)
+		subtype, bin, ok := values["binary"].BinaryOK()
+		assert.True(t, ok)
+		assert.EqualValues(t, 0, subtype)
+		assert.Equal(t, []byte{1, 2, 3}, bin)
+
+		_, ok = values["int32"].Int64OK()
+		assert.False(t, ok)
+		_, ok = values["string"].DocumentOK()
+		assert.False(t, ok)
+
+		sub, ok := values["doc"].DocumentOK()
+		require.True(t, ok)
+		iter, err = NewReaderIterator(sub)
+		require.NoError(t, err)
+		require.True(t, iter.Next())
+		assert.Equal(t, "inner", string(iter.Key()))
+		require.True(t, iter.Next())
+		assert.Equal(t, "flag", string(iter.Key()))
+		assert.False(t, iter.Next())
+		assert.NoError(t, iter.Err())
+
+		array, ok := values["array"].ArrayOK()
+		require.True(t, ok)
+		require.NoError(t, iter.Reset(array))
+		keys := []string{}
+		for iter.Next() {
+			keys = append(keys, string(iter.Key()))
+			assert.Equal(t, bsontype.Int64, iter.Value().Type)
+		}
+		assert.Equal(t, []string{"0", "1"}, keys)
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := NewReaderIterator([]byte{5, 0, 0})
+		assert.Error(t, err)
+		_, err = NewReaderIterator([]byte{10, 0, 0, 0, 0})
+		assert.Error(t, err)
+
+		// truncate the value of the last element.
+		invalid := append([]byte{}, data...)
+		invalid[0] = byte(len(data) - 4)
+		iter, err := NewReaderIterator(invalid)
+		require.NoError(t, err)
+		for iter.Next() {
+		}
+		assert.Error(t, iter.Err())
+
+		var zero ReaderIterator
+		assert.False(t, zero.Next())
+	})
+	t.Run("ZeroAllocations", func(t *testing.T) {
+		var iter ReaderIterator
+		var sum int64
+		allocs := testing.AllocsPerRun(100, func() {
+			if err := iter.Reset(data); err != nil {
+				panic(err)
+			}
+			for iter.Next() {
+				sum += int64(len(iter.Key()))
+				if v, ok := iter.Value().Int64OK(); ok {
+					sum += v
+				}
+			}
+		})
+		assert.Zero(t, allocs)
+		assert.NotZero(t, sum)
+	})
+}
+
+func BenchmarkReaderIterator(b *testing.B) {
+	data, err := NewDocument(
+		EC.Int64("a", 1),
+		EC.SubDocumentFromElements("b", EC.Int64("c", 2), EC.Double("d", 3)),
+		EC.Time("e", time.Now()),
+	).MarshalBSON()
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var iter ReaderIterator
+	for i := 0; i < b.N; i++ {
+		_ = iter.Reset(data)
+		for iter.Next() {
+		}
+	}
+}
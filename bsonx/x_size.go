@@ -0,0 +1,131 @@
+package bsonx
+
+import (
+	"math"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+)
+
+// These constants describe the fixed components of the BSON layout,
+// and are useful, in combination with the Size* helpers, for
+// computing the exact size of encoded documents before allocating
+// buffers.
+const (
+	// DocumentHeaderSize is the size of the int32 length prefix
+	// of a document or array.
+	DocumentHeaderSize = 4
+
+	// DocumentTrailerSize is the size of the null byte that
+	// terminates every document or array.
+	DocumentTrailerSize = 1
+
+	// MinDocumentSize is the size of an empty document or array.
+	MinDocumentSize = DocumentHeaderSize + DocumentTrailerSize
+
+	// ElementTypeSize is the size of the type byte that begins
+	// every element.
+	ElementTypeSize = 1
+
+	// StringHeaderSize is the size of the int32 length prefix of
+	// string, javascript, and symbol values.
+	StringHeaderSize = 4
+
+	// BinaryHeaderSize is the size of the int32 length prefix and
+	// the subtype byte of binary values. Values with the (old)
+	// binary subtype 0x02 have an additional int32 length.
+	BinaryHeaderSize = 4 + 1
+
+	// MaxDocumentSize is the largest encoded size of a document
+	// or array, as limited by the int32 length prefix.
+	MaxDocumentSize = math.MaxInt32
+
+	// MaxDocumentElements is the largest number of elements
+	// that a Document can hold in memory. Because every element
+	// occupies at least two bytes, documents with this many
+	// elements always exceed MaxDocumentSize when encoded.
+	MaxDocumentElements = math.MaxUint32
+)
+
+// FixedValueSize returns the size of the encoded value for types
+// that always have the same size. The second value is false for
+// variable length types (strings, documents, arrays, binary, etc.)
+func FixedValueSize(t bsontype.Type) (int, bool) {
+	switch t {
+	case bsontype.Undefined, bsontype.Null, bsontype.MinKey, bsontype.MaxKey:
+		return 0, true
+	case bsontype.Boolean:
+		return 1, true
+	case bsontype.Int32:
+		return 4, true
+	case bsontype.Double, bsontype.DateTime, bsontype.Timestamp, bsontype.Int64:
+		return 8, true
+	case bsontype.ObjectID:
+		return 12, true
+	case bsontype.Decimal128:
+		return 16, true
+	default:
+		return 0, false
+	}
+}
+
+// SizeOfElementHeader returns the size of the type byte and key (a
+// null terminated c-string) of an element.
+func SizeOfElementHeader(key string) int { return ElementTypeSize + len(key) + 1 }
+
+// SizeOfString returns the size of the encoded string value,
+// including the length prefix and the null terminator. The size of
+// javascript and symbol values are computed the same way.
+func SizeOfString(s string) int { return StringHeaderSize + len(s) + 1 }
+
+// SizeOfBinary returns the size of an encoded binary value with the
+// provided payload and subtype.
+func SizeOfBinary(b []byte, subtype byte) int {
+	if subtype == 2 {
+		return BinaryHeaderSize + 4 + len(b)
+	}
+
+	return BinaryHeaderSize + len(b)
+}
+
+// SizeOfValue returns the encoded size of the value, not including
+// the type byte or the key.
+func SizeOfValue(v *Value) (int, error) {
+	if v == nil {
+		return 0, bsonerr.UninitializedElement
+	}
+
+	size, err := v.valueSize()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(size), nil
+}
+
+// SizeOfElement returns the encoded size of an element with the
+// given key and value, including the type byte and the key.
+func SizeOfElement(key string, v *Value) (int, error) {
+	size, err := SizeOfValue(v)
+	if err != nil {
+		return 0, err
+	}
+
+	return SizeOfElementHeader(key) + size, nil
+}
+
+// SizeOfDocument returns the encoded size of a document made of the
+// given elements, including the document's length prefix and null
+// terminator.
+func SizeOfDocument(elems ...*Element) (int, error) {
+	total := MinDocumentSize
+	for _, elem := range elems {
+		size, err := elem.Validate()
+		if err != nil {
+			return 0, err
+		}
+		total += int(size)
+	}
+
+	return total, nil
+}
@@ -0,0 +1,94 @@
+package bsonx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/mongodb/ftdc/bsonx/decimal"
+	"github.com/mongodb/ftdc/bsonx/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeHelpers(t *testing.T) {
+	t.Run("Elements", func(t *testing.T) {
+		for name, elem := range map[string]*Element{
+			"Double":        EC.Double("double", 4.2),
+			"String":        EC.String("string", "hello world"),
+			"EmptyString":   EC.String("", ""),
+			"SubDocument":   EC.SubDocument("doc", NewDocument(EC.Int32("a", 1), EC.String("b", "c"))),
+			"Array":         EC.Array("array", NewArray(VC.Int64(1), VC.String("two"))),
+			"Binary":        EC.Binary("bin", []byte("payload")),
+			"BinarySubtype": EC.BinaryWithSubtype("bin", []byte("payload"), 2),
+			"Undefined":     EC.Undefined("undef"),
+			"ObjectID":      EC.ObjectID("oid", types.NewObjectID()),
+			"Boolean":       EC.Boolean("bool", true),
+			"DateTime":      EC.Time("time", time.Now()),
+			"Null":          EC.Null("null"),
+			"Regex":         EC.Regex("regex", "^foo", "i"),
+			"JavaScript":    EC.JavaScript("js", "function() {}"),
+			"Symbol":        EC.Symbol("sym", "symbol"),
+			"CodeWithScope": EC.CodeWithScope("cws", "var x", NewDocument(EC.Int32("x", 1))),
+			"Int32":         EC.Int32("i32", 42),
+			"Timestamp":     EC.Timestamp("ts", 1, 2),
+			"Int64":         EC.Int64("i64", 42),
+			"Decimal":       EC.Decimal128("dec", decimal.NewDecimal128(1, 2)),
+			"MinKey":        EC.MinKey("min"),
+			"MaxKey":        EC.MaxKey("max"),
+		} {
+			t.Run(name, func(t *testing.T) {
+				out, err := elem.MarshalBSON()
+				require.NoError(t, err)
+
+				size, err := SizeOfElement(elem.Key(), elem.Value())
+				require.NoError(t, err)
+				assert.Equal(t, len(out), size)
+
+				valSize, err := SizeOfValue(elem.Value())
+				require.NoError(t, err)
+				assert.Equal(t, len(out)-SizeOfElementHeader(elem.Key()), valSize)
+
+				if fixed, ok := FixedValueSize(elem.Value().Type()); ok {
+					assert.Equal(t, fixed, valSize)
+				}
+			})
+		}
+	})
+	t.Run("Document", func(t *testing.T) {
+		elems := []*Element{
+			EC.Int64("a", 1),
+			EC.String("b", "two"),
+			EC.SubDocument("c", NewDocument(EC.Double("d", 3))),
+		}
+		out, err := NewDocument(elems...).MarshalBSON()
+		require.NoError(t, err)
+
+		size, err := SizeOfDocument(elems...)
+		require.NoError(t, err)
+		assert.Equal(t, len(out), size)
+
+		size, err = SizeOfDocument()
+		require.NoError(t, err)
+		assert.Equal(t, MinDocumentSize, size)
+	})
+	t.Run("VariableTypes", func(t *testing.T) {
+		assert.Equal(t, len("foo")+5, SizeOfString("foo"))
+		assert.Equal(t, 8, SizeOfBinary([]byte("foo"), 0))
+		assert.Equal(t, 12, SizeOfBinary([]byte("foo"), 2))
+
+		for _, bt := range []bsontype.Type{bsontype.String, bsontype.EmbeddedDocument,
+			bsontype.Array, bsontype.Binary, bsontype.Regex, bsontype.CodeWithScope} {
+			_, ok := FixedValueSize(bt)
+			assert.False(t, ok, "%s", bt)
+		}
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := SizeOfValue(nil)
+		assert.Error(t, err)
+		_, err = SizeOfElement("foo", &Value{})
+		assert.Error(t, err)
+		_, err = SizeOfDocument(nil)
+		assert.Error(t, err)
+	})
+}
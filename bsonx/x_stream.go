@@ -0,0 +1,165 @@
+package bsonx
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/pkg/errors"
+)
+
+const streamBufferSize = 4096
+
+var streamWriterPool = &sync.Pool{
+	New: func() interface{} { return bufio.NewWriterSize(nil, streamBufferSize) },
+}
+
+// WriteDocumentTo serializes the document to the writer, element by
+// element, without first rendering the entire document into a single
+// buffer, as WriteTo and MarshalBSON do. Elements are staged in a
+// small buffer that is shared between calls, and large elements are
+// written directly from the document's storage. This reduces the
+// memory overhead of writing very large documents, particularly
+// when the writer is a file or network connection.
+//
+// Returns the number of bytes written, and the first error
+// encountered, which may leave a partial document in the writer.
+func (d *Document) WriteDocumentTo(w io.Writer) (int64, error) {
+	if d == nil {
+		return 0, bsonerr.NilDocument
+	}
+
+	size, err := d.Validate()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	out := &countingWriter{w: w}
+	buf := streamWriterPool.Get().(*bufio.Writer)
+	buf.Reset(out)
+	defer func() {
+		buf.Reset(nil)
+		streamWriterPool.Put(buf)
+	}()
+
+	s := &documentStreamer{w: buf, scratch: make([]byte, 0, 32)}
+	if err = s.writeDocument(d, size, false); err != nil {
+		return out.n, errors.WithStack(err)
+	}
+
+	return out.n, errors.WithStack(buf.Flush())
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+type documentStreamer struct {
+	w       *bufio.Writer
+	scratch []byte
+}
+
+func (s *documentStreamer) write(b []byte) error {
+	_, err := s.w.Write(b)
+	return err
+}
+
+func (s *documentStreamer) writeByte(b byte) error { return s.w.WriteByte(b) }
+
+// writeDocument writes the elements of a document with a header of the
+// specified size. The keys of the elements of arrays are replaced
+// with their indexes.
+func (s *documentStreamer) writeDocument(d *Document, size uint32, array bool) error {
+	var header [4]byte
+	header[0] = byte(size)
+	header[1] = byte(size >> 8)
+	header[2] = byte(size >> 16)
+	header[3] = byte(size >> 24)
+	if err := s.write(header[:]); err != nil {
+		return err
+	}
+
+	for idx, elem := range d.elems {
+		if elem == nil || elem.value == nil || elem.value.data == nil {
+			return bsonerr.UninitializedElement
+		}
+
+		if array {
+			if err := s.writeByte(elem.value.data[elem.value.start]); err != nil {
+				return err
+			}
+			if err := s.write(strconv.AppendInt(s.scratch[:0], int64(idx), 10)); err != nil {
+				return err
+			}
+			if err := s.writeByte(0); err != nil {
+				return err
+			}
+		}
+
+		if err := s.writeElement(elem, !array); err != nil {
+			return err
+		}
+	}
+
+	return s.writeByte(0)
+}
+
+// writeElement writes an element, with or without its type and key.
+func (s *documentStreamer) writeElement(elem *Element, key bool) error {
+	v := elem.value
+	start := v.start
+	if !key {
+		start = v.offset
+	}
+
+	switch v.data[v.start] {
+	case '\x03', '\x04':
+		if v.d == nil {
+			break
+		}
+
+		if key {
+			if err := s.write(v.data[v.start:v.offset]); err != nil {
+				return err
+			}
+		}
+
+		size, err := v.validate(false)
+		if err != nil {
+			return err
+		}
+
+		return s.writeDocument(v.d, size, v.data[v.start] == '\x04')
+	case '\x0F':
+		// code with scope values may need to be rewritten, so
+		// render them in the scratch buffer.
+		size, err := elem.Validate()
+		if err != nil {
+			return err
+		}
+		if uint32(cap(s.scratch)) < size {
+			s.scratch = make([]byte, size)
+		}
+		n, err := elem.writeByteSlice(key, 0, size, s.scratch[:size])
+		if err != nil {
+			return err
+		}
+		return s.write(s.scratch[:n])
+	}
+
+	size, err := elem.Validate()
+	if err != nil {
+		return err
+	}
+
+	return s.write(v.data[start : v.start+size])
+}
@@ -0,0 +1,76 @@
+package bsonx
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type limitedWriter struct {
+	limit int
+	bytes.Buffer
+}
+
+func (w *limitedWriter) Write(b []byte) (int, error) {
+	if w.Len()+len(b) > w.limit {
+		return 0, errors.New("writer is full")
+	}
+	return w.Buffer.Write(b)
+}
+
+func TestWriteDocumentTo(t *testing.T) {
+	nested := NewDocument(
+		EC.String("name", "value"),
+		EC.Array("list", NewArray(
+			VC.Int32(1),
+			VC.Document(NewDocument(EC.Int64("inner", 2))),
+			VC.ArrayFromValues(VC.String("a"), VC.String("b")),
+		)),
+	)
+
+	large := NewDocument()
+	for i := 0; i < 1000; i++ {
+		large.Append(EC.String(strings.Repeat("k", i%20+1), strings.Repeat("v", i)))
+	}
+
+	raw, err := nested.MarshalBSON()
+	require.NoError(t, err)
+	read, err := ReadDocument(raw)
+	require.NoError(t, err)
+
+	for name, doc := range map[string]*Document{
+		"Empty":  NewDocument(),
+		"Flat":   NewDocument(EC.Int64("a", 1), EC.Double("b", 2.5), EC.Boolean("c", true)),
+		"Nested": NewDocument(EC.Int64("a", 1), EC.SubDocument("nested", nested), EC.Null("null")),
+		"Read":   NewDocument(EC.SubDocument("read", read), EC.Array("list", NewArray(VC.Document(read)))),
+		"Code":   NewDocument(EC.CodeWithScope("code", "function() {}", NewDocument(EC.Int32("x", 1)))),
+		"Large":  large,
+	} {
+		t.Run(name, func(t *testing.T) {
+			expected, err := doc.MarshalBSON()
+			require.NoError(t, err)
+
+			buf := &bytes.Buffer{}
+			n, err := doc.WriteDocumentTo(buf)
+			require.NoError(t, err)
+			assert.EqualValues(t, len(expected), n)
+			assert.Equal(t, expected, buf.Bytes())
+		})
+	}
+	t.Run("Nil", func(t *testing.T) {
+		var doc *Document
+		_, err := doc.WriteDocumentTo(&bytes.Buffer{})
+		assert.Error(t, err)
+	})
+	t.Run("WriterError", func(t *testing.T) {
+		w := &limitedWriter{limit: 1024}
+		n, err := large.WriteDocumentTo(w)
+		assert.Error(t, err)
+		assert.True(t, n <= int64(w.limit))
+		assert.True(t, w.Len() <= w.limit)
+	})
+}
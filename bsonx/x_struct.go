@@ -0,0 +1,530 @@
+package bsonx
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/mongodb/ftdc/bsonx/decimal"
+	"github.com/mongodb/ftdc/bsonx/types"
+	"github.com/pkg/errors"
+)
+
+// Marshal converts a struct, or a map with string keys, into a
+// Document, using reflection.
+//
+// The keys of struct fields are the lower cased field names, unless
+// the field has a "bson" tag, which follows the conventions of the
+// official driver: `bson:"name,omitempty,inline"`, where a name of
+// "-" skips the field, omitempty skips fields with zero values, and
+// inline merges the fields of an embedded struct into the
+// surrounding document. Unexported fields are skipped.
+//
+// Values are converted as follows: integer types that always fit in
+// 32 bits become int32 values, and other integers become int64 values;
+// floats become doubles; time.Time values become date times, and
+// time.Duration values become int64 nanoseconds; byte slices become
+// binary values; other slices and arrays become arrays; structs and
+// maps become sub-documents; nil pointers, interfaces, slices and maps
+// become nulls. *Document, *Array, types.ObjectID,
+// types.Timestamp, decimal.Decimal128, and Marshaler values are
+// used directly.
+func Marshal(in interface{}) (*Document, error) {
+	if doc, ok := in.(*Document); ok {
+		if doc == nil {
+			return nil, errors.New("cannot marshal a nil document")
+		}
+		return doc, nil
+	}
+	if m, ok := in.(Marshaler); ok {
+		doc, err := DC.MarshalerErr(m)
+		return doc, errors.WithStack(err)
+	}
+
+	rv := reflect.ValueOf(in)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, errors.New("cannot marshal a nil value")
+		}
+		rv = rv.Elem()
+	}
+
+	doc := NewDocument()
+	switch rv.Kind() {
+	case reflect.Struct:
+		if err := marshalStruct(doc, rv); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	case reflect.Map:
+		if err := marshalMap(doc, rv); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	default:
+		return nil, errors.Errorf("cannot marshal a value of type %T as a document", in)
+	}
+
+	return doc, nil
+}
+
+// Unmarshal populates the struct, or map with string keys, that out
+// points to, from the document. It uses the same field names and tags
+// as Marshal. Keys in the document without a corresponding field are
+// ignored, as are fields without a corresponding key.
+//
+// Numeric values are converted between integer and floating point
+// types as long as the value is representable in the destination
+// type. Values are assigned to interface{} fields using the
+// Value.Interface method.
+func Unmarshal(doc *Document, out interface{}) error {
+	if doc == nil {
+		return errors.New("cannot unmarshal a nil document")
+	}
+
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.Errorf("cannot unmarshal into non-pointer type %T", out)
+	}
+
+	return errors.WithStack(unmarshalDocument(doc, rv.Elem()))
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// struct field handling
+
+type structField struct {
+	key       string
+	index     []int
+	omitEmpty bool
+}
+
+var structFieldCache = &sync.Map{}
+
+func getStructFields(t reflect.Type) ([]structField, error) {
+	if fields, ok := structFieldCache.Load(t); ok {
+		return fields.([]structField), nil
+	}
+
+	fields := []structField{}
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+
+		tag := field.Tag.Get("bson")
+		if tag == "-" {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		info := structField{
+			key:   parts[0],
+			index: field.Index,
+		}
+		if info.key == "" {
+			info.key = strings.ToLower(field.Name)
+		}
+
+		var inline bool
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "omitempty":
+				info.omitEmpty = true
+			case "inline":
+				inline = true
+			}
+		}
+
+		// the fields of unexported embedded structs are still
+		// accessible when inlined.
+		if field.PkgPath != "" && !(inline && field.Anonymous) {
+			continue
+		}
+
+		if inline {
+			if field.Type.Kind() != reflect.Struct {
+				return nil, errors.Errorf("cannot inline field '%s' of type %s", field.Name, field.Type)
+			}
+
+			inner, err := getStructFields(field.Type)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			for _, f := range inner {
+				f.index = append(append([]int{}, field.Index...), f.index...)
+				fields = append(fields, f)
+			}
+			continue
+		}
+
+		fields = append(fields, info)
+	}
+
+	structFieldCache.Store(t, fields)
+	return fields, nil
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// marshaling
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	durationType  = reflect.TypeOf(time.Duration(0))
+	objectIDType  = reflect.TypeOf(types.ObjectID{})
+	timestampType = reflect.TypeOf(types.Timestamp{})
+	decimalType   = reflect.TypeOf(decimal.Decimal128{})
+	documentType  = reflect.TypeOf(&Document{})
+	arrayType     = reflect.TypeOf(&Array{})
+	marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	byteSliceType = reflect.TypeOf([]byte{})
+)
+
+func marshalStruct(doc *Document, rv reflect.Value) error {
+	fields, err := getStructFields(rv.Type())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, field := range fields {
+		fv := rv.FieldByIndex(field.index)
+		if field.omitEmpty && fv.IsZero() {
+			continue
+		}
+
+		elem, err := marshalValue(field.key, fv)
+		if err != nil {
+			return errors.Wrapf(err, "problem marshaling field '%s'", field.key)
+		}
+		doc.Append(elem)
+	}
+
+	return nil
+}
+
+func marshalMap(doc *Document, rv reflect.Value) error {
+	if rv.Type().Key().Kind() != reflect.String {
+		return errors.Errorf("cannot marshal map with %s keys", rv.Type().Key())
+	}
+
+	keys := rv.MapKeys()
+	names := make([]string, len(keys))
+	for idx := range keys {
+		names[idx] = keys[idx].String()
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		elem, err := marshalValue(name, rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key())))
+		if err != nil {
+			return errors.Wrapf(err, "problem marshaling key '%s'", name)
+		}
+		doc.Append(elem)
+	}
+
+	return nil
+}
+
+func marshalValue(key string, rv reflect.Value) (*Element, error) {
+	if !rv.IsValid() {
+		return EC.Null(key), nil
+	}
+
+	switch rv.Type() {
+	case timeType:
+		return EC.Time(key, rv.Interface().(time.Time)), nil
+	case durationType:
+		return EC.Int64(key, rv.Int()), nil
+	case objectIDType:
+		return EC.ObjectID(key, rv.Interface().(types.ObjectID)), nil
+	case timestampType:
+		ts := rv.Interface().(types.Timestamp)
+		return EC.Timestamp(key, ts.T, ts.I), nil
+	case decimalType:
+		return EC.Decimal128(key, rv.Interface().(decimal.Decimal128)), nil
+	case documentType:
+		if rv.IsNil() {
+			return EC.Null(key), nil
+		}
+		return EC.SubDocument(key, rv.Interface().(*Document)), nil
+	case arrayType:
+		if rv.IsNil() {
+			return EC.Null(key), nil
+		}
+		return EC.Array(key, rv.Interface().(*Array)), nil
+	case byteSliceType:
+		if rv.IsNil() {
+			return EC.Null(key), nil
+		}
+		return EC.Binary(key, rv.Bytes()), nil
+	}
+
+	if rv.Type().Implements(marshalerType) && (rv.Kind() != reflect.Ptr || !rv.IsNil()) {
+		return EC.MarshalerErr(key, rv.Interface().(Marshaler))
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return EC.Boolean(key, rv.Bool()), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return EC.Int32(key, int32(rv.Int())), nil
+	case reflect.Int, reflect.Int64:
+		return EC.Int64(key, rv.Int()), nil
+	case reflect.Uint8, reflect.Uint16:
+		return EC.Int32(key, int32(rv.Uint())), nil
+	case reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, errors.Errorf("BSON only has signed integer types and %d overflows an int64", rv.Uint())
+		}
+		return EC.Int64(key, int64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return EC.Double(key, rv.Float()), nil
+	case reflect.String:
+		return EC.String(key, rv.String()), nil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return EC.Null(key), nil
+		}
+		return marshalValue(key, rv.Elem())
+	case reflect.Struct:
+		doc := NewDocument()
+		if err := marshalStruct(doc, rv); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return EC.SubDocument(key, doc), nil
+	case reflect.Map:
+		if rv.IsNil() {
+			return EC.Null(key), nil
+		}
+		doc := NewDocument()
+		if err := marshalMap(doc, rv); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return EC.SubDocument(key, doc), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return EC.Null(key), nil
+		}
+		array := NewArray()
+		for idx := 0; idx < rv.Len(); idx++ {
+			elem, err := marshalValue("", rv.Index(idx))
+			if err != nil {
+				return nil, errors.Wrapf(err, "problem marshaling index %d", idx)
+			}
+			array.Append(elem.Value())
+		}
+		return EC.Array(key, array), nil
+	default:
+		return nil, errors.Errorf("cannot marshal values of type %s", rv.Type())
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// unmarshaling
+
+func unmarshalDocument(doc *Document, rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Struct:
+		fields, err := getStructFields(rv.Type())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		iter := doc.Iterator()
+		for iter.Next() {
+			elem := iter.Element()
+			key := elem.Key()
+			for _, field := range fields {
+				if field.key != key {
+					continue
+				}
+				if err := unmarshalValue(elem.Value(), rv.FieldByIndex(field.index)); err != nil {
+					return errors.Wrapf(err, "problem unmarshaling field '%s'", key)
+				}
+				break
+			}
+		}
+
+		return errors.WithStack(iter.Err())
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return errors.Errorf("cannot unmarshal into map with %s keys", rv.Type().Key())
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+
+		iter := doc.Iterator()
+		for iter.Next() {
+			elem := iter.Element()
+			val := reflect.New(rv.Type().Elem()).Elem()
+			if err := unmarshalValue(elem.Value(), val); err != nil {
+				return errors.Wrapf(err, "problem unmarshaling key '%s'", elem.Key())
+			}
+			rv.SetMapIndex(reflect.ValueOf(elem.Key()).Convert(rv.Type().Key()), val)
+		}
+
+		return errors.WithStack(iter.Err())
+	case reflect.Interface:
+		if rv.NumMethod() == 0 {
+			rv.Set(reflect.ValueOf(doc.Copy()))
+			return nil
+		}
+	}
+
+	return errors.Errorf("cannot unmarshal a document into %s", rv.Type())
+}
+
+func unmarshalValue(v *Value, rv reflect.Value) error {
+	vtype := v.Type()
+
+	if vtype == bsontype.Null || vtype == bsontype.Undefined {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	switch rv.Type() {
+	case timeType:
+		switch vtype {
+		case bsontype.DateTime:
+			rv.Set(reflect.ValueOf(v.Time()))
+			return nil
+		case bsontype.Timestamp:
+			t, _ := v.Timestamp()
+			rv.Set(reflect.ValueOf(time.Unix(int64(t), 0)))
+			return nil
+		}
+	case objectIDType:
+		if vtype == bsontype.ObjectID {
+			rv.Set(reflect.ValueOf(v.ObjectID()))
+			return nil
+		}
+	case timestampType:
+		if vtype == bsontype.Timestamp {
+			t, i := v.Timestamp()
+			rv.Set(reflect.ValueOf(types.Timestamp{T: t, I: i}))
+			return nil
+		}
+	case decimalType:
+		if vtype == bsontype.Decimal128 {
+			rv.Set(reflect.ValueOf(v.Decimal128()))
+			return nil
+		}
+	case documentType:
+		if doc, ok := v.MutableDocumentOK(); ok {
+			rv.Set(reflect.ValueOf(doc.Copy()))
+			return nil
+		}
+	case arrayType:
+		if array, ok := v.MutableArrayOK(); ok {
+			rv.Set(reflect.ValueOf(array))
+			return nil
+		}
+	case byteSliceType:
+		if _, data, ok := v.BinaryOK(); ok {
+			rv.SetBytes(append([]byte{}, data...))
+			return nil
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		if b, ok := v.BooleanOK(); ok {
+			rv.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := valueToInt64(v); ok {
+			if rv.OverflowInt(i) {
+				return errors.Errorf("value %d overflows %s", i, rv.Type())
+			}
+			rv.SetInt(i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, ok := valueToInt64(v); ok {
+			if i < 0 || rv.OverflowUint(uint64(i)) {
+				return errors.Errorf("value %d overflows %s", i, rv.Type())
+			}
+			rv.SetUint(uint64(i))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch vtype {
+		case bsontype.Double:
+			rv.SetFloat(v.Double())
+			return nil
+		case bsontype.Int32:
+			rv.SetFloat(float64(v.Int32()))
+			return nil
+		case bsontype.Int64:
+			rv.SetFloat(float64(v.Int64()))
+			return nil
+		}
+	case reflect.String:
+		switch vtype {
+		case bsontype.String:
+			rv.SetString(v.StringValue())
+			return nil
+		case bsontype.Symbol:
+			rv.SetString(v.Symbol())
+			return nil
+		}
+	case reflect.Ptr:
+		ptr := reflect.New(rv.Type().Elem())
+		if err := unmarshalValue(v, ptr.Elem()); err != nil {
+			return errors.WithStack(err)
+		}
+		rv.Set(ptr)
+		return nil
+	case reflect.Interface:
+		if rv.NumMethod() == 0 {
+			rv.Set(reflect.ValueOf(v.Interface()))
+			return nil
+		}
+	case reflect.Struct, reflect.Map:
+		if doc, ok := v.MutableDocumentOK(); ok {
+			return errors.WithStack(unmarshalDocument(doc, rv))
+		}
+	case reflect.Slice, reflect.Array:
+		array, ok := v.MutableArrayOK()
+		if !ok {
+			break
+		}
+
+		if rv.Kind() == reflect.Slice {
+			rv.Set(reflect.MakeSlice(rv.Type(), array.Len(), array.Len()))
+		} else if array.Len() > rv.Len() {
+			return errors.Errorf("array of length %d does not fit in %s", array.Len(), rv.Type())
+		}
+
+		for idx := 0; idx < array.Len(); idx++ {
+			if err := unmarshalValue(array.Lookup(uint(idx)), rv.Index(idx)); err != nil {
+				return errors.Wrapf(err, "problem unmarshaling index %d", idx)
+			}
+		}
+		return nil
+	}
+
+	return errors.Errorf("cannot unmarshal %s value into %s", vtype, rv.Type())
+}
+
+func valueToInt64(v *Value) (int64, bool) {
+	switch v.Type() {
+	case bsontype.Int32:
+		return int64(v.Int32()), true
+	case bsontype.Int64:
+		return v.Int64(), true
+	case bsontype.Double:
+		f := v.Double()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(f), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,161 @@
+package bsonx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type structTestInner struct {
+	Value int64 `bson:"value"`
+}
+
+type structTestEmbedded struct {
+	Shared string `bson:"shared"`
+}
+
+type structTestCase struct {
+	Name               string                     `bson:"name"`
+	Count              int                        `bson:"count"`
+	Small              int16                      `bson:"small"`
+	Unsigned           uint32                     `bson:"unsigned"`
+	Ratio              float64                    `bson:"ratio"`
+	Enabled            bool                       `bson:"enabled"`
+	Untagged           string                     ``
+	Skipped            string                     `bson:"-"`
+	Empty              string                     `bson:"empty,omitempty"`
+	When               time.Time                  `bson:"when"`
+	Elapsed            time.Duration              `bson:"elapsed"`
+	ID                 types.ObjectID             `bson:"_id"`
+	Data               []byte                     `bson:"data"`
+	Tags               []string                   `bson:"tags"`
+	Fixed              [2]int32                   `bson:"fixed"`
+	Inner              structTestInner            `bson:"inner"`
+	Pointer            *structTestInner           `bson:"pointer"`
+	NilPtr             *structTestInner           `bson:"nil_ptr"`
+	Map                map[string]int64           `bson:"map"`
+	Nested             map[string]structTestInner `bson:"nested"`
+	Any                interface{}                `bson:"any"`
+	Doc                *Document                  `bson:"doc"`
+	unexported         string
+	structTestEmbedded `bson:",inline"`
+}
+
+func TestStructMarshaling(t *testing.T) {
+	when := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	in := structTestCase{
+		Name:               "test",
+		Count:              42,
+		Small:              -3,
+		Unsigned:           1 << 31,
+		Ratio:              0.5,
+		Enabled:            true,
+		Untagged:           "untagged",
+		Skipped:            "skipped",
+		When:               when,
+		Elapsed:            time.Second,
+		ID:                 types.NewObjectID(),
+		Data:               []byte("data"),
+		Tags:               []string{"a", "b"},
+		Fixed:              [2]int32{1, 2},
+		Inner:              structTestInner{Value: 1},
+		Pointer:            &structTestInner{Value: 2},
+		Map:                map[string]int64{"b": 2, "a": 1},
+		Nested:             map[string]structTestInner{"x": {Value: 3}},
+		Any:                "any",
+		Doc:                NewDocument(EC.Int32("a", 1)),
+		unexported:         "unexported",
+		structTestEmbedded: structTestEmbedded{Shared: "shared"},
+	}
+
+	doc, err := Marshal(in)
+	require.NoError(t, err)
+
+	t.Run("Marshal", func(t *testing.T) {
+		assert.Equal(t, "test", doc.Lookup("name").StringValue())
+		assert.Equal(t, int64(42), doc.Lookup("count").Int64())
+		assert.Equal(t, int32(-3), doc.Lookup("small").Int32())
+		assert.Equal(t, int64(1<<31), doc.Lookup("unsigned").Int64())
+		assert.Equal(t, 0.5, doc.Lookup("ratio").Double())
+		assert.True(t, doc.Lookup("enabled").Boolean())
+		assert.Equal(t, "untagged", doc.Lookup("untagged").StringValue())
+		assert.Nil(t, doc.LookupElement("skipped"))
+		assert.Nil(t, doc.LookupElement("-"))
+		assert.Nil(t, doc.LookupElement("empty"))
+		assert.Nil(t, doc.LookupElement("unexported"))
+		assert.True(t, when.Equal(doc.Lookup("when").Time()))
+		assert.Equal(t, int64(time.Second), doc.Lookup("elapsed").Int64())
+		assert.Equal(t, in.ID, doc.Lookup("_id").ObjectID())
+		_, data := doc.Lookup("data").Binary()
+		assert.Equal(t, []byte("data"), data)
+		assert.Equal(t, 2, doc.Lookup("tags").MutableArray().Len())
+		assert.Equal(t, 2, doc.Lookup("fixed").MutableArray().Len())
+		assert.Equal(t, int64(1), doc.Lookup("inner").MutableDocument().Lookup("value").Int64())
+		assert.Equal(t, int64(2), doc.Lookup("pointer").MutableDocument().Lookup("value").Int64())
+		assert.Equal(t, "null", doc.Lookup("nil_ptr").Type().String())
+		assert.Equal(t, "a", doc.Lookup("map").MutableDocument().ElementAt(0).Key())
+		assert.Equal(t, "shared", doc.Lookup("shared").StringValue())
+	})
+	t.Run("RoundTrip", func(t *testing.T) {
+		out := structTestCase{Skipped: "preserved", NilPtr: &structTestInner{}}
+		require.NoError(t, Unmarshal(doc, &out))
+
+		assert.Equal(t, "preserved", out.Skipped)
+		assert.Empty(t, out.unexported)
+		assert.Nil(t, out.NilPtr)
+		assert.True(t, when.Equal(out.When))
+		assert.True(t, in.Doc.Equal(out.Doc))
+
+		in.Skipped, in.unexported, in.When, in.Doc = out.Skipped, "", out.When, out.Doc
+		assert.Equal(t, in, out)
+	})
+	t.Run("Map", func(t *testing.T) {
+		doc, err := Marshal(map[string]interface{}{"b": int32(1), "a": "two"})
+		require.NoError(t, err)
+		assert.Equal(t, "a", doc.ElementAt(0).Key())
+
+		out := map[string]interface{}{}
+		require.NoError(t, Unmarshal(doc, &out))
+		assert.Equal(t, map[string]interface{}{"b": int32(1), "a": "two"}, out)
+	})
+	t.Run("NumericConversion", func(t *testing.T) {
+		var out struct {
+			Int   int8    `bson:"int"`
+			Float float32 `bson:"float"`
+			Uint  uint    `bson:"uint"`
+		}
+		require.NoError(t, Unmarshal(NewDocument(EC.Double("int", 4), EC.Int64("float", 3), EC.Int32("uint", 2)), &out))
+		assert.EqualValues(t, 4, out.Int)
+		assert.EqualValues(t, 3, out.Float)
+		assert.EqualValues(t, 2, out.Uint)
+
+		assert.Error(t, Unmarshal(NewDocument(EC.Int64("int", 1000)), &out))
+		assert.Error(t, Unmarshal(NewDocument(EC.Double("int", 1.5)), &out))
+		assert.Error(t, Unmarshal(NewDocument(EC.Int32("uint", -1)), &out))
+		assert.Error(t, Unmarshal(NewDocument(EC.String("int", "one")), &out))
+	})
+	t.Run("Errors", func(t *testing.T) {
+		_, err := Marshal(nil)
+		assert.Error(t, err)
+		_, err = Marshal((*structTestCase)(nil))
+		assert.Error(t, err)
+		_, err = Marshal(42)
+		assert.Error(t, err)
+		_, err = Marshal(map[int]string{1: "one"})
+		assert.Error(t, err)
+		_, err = Marshal(struct{ C chan int }{})
+		assert.Error(t, err)
+		_, err = Marshal(struct{ U uint64 }{U: 1 << 63})
+		assert.Error(t, err)
+
+		var out structTestCase
+		assert.Error(t, Unmarshal(nil, &out))
+		assert.Error(t, Unmarshal(doc, out))
+		assert.Error(t, Unmarshal(doc, (*structTestCase)(nil)))
+		var num int
+		assert.Error(t, Unmarshal(doc, &num))
+	})
+}
@@ -0,0 +1,118 @@
+package bsonx
+
+import (
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+)
+
+// DBRef is a reference to a document, in the DBRef convention: an
+// embedded document with "$ref", "$id", and optionally "$db" fields,
+// which replaces the deprecated DBPointer type.
+type DBRef struct {
+	Collection string
+	ID         *Value
+	DB         string
+}
+
+// DBRef creates an embedded document element with the given key that
+// holds the reference, in the order of the DBRef convention. The ID of
+// the reference must not be nil, and the document has no "$db" field
+// if the DB of the reference is empty.
+func (ElementConstructor) DBRef(key string, ref DBRef) *Element {
+	return EC.SubDocument(key, ref.document())
+}
+
+// DBRef creates an embedded document value that holds the reference.
+func (ValueConstructor) DBRef(ref DBRef) *Value {
+	return VC.Document(ref.document())
+}
+
+func (r DBRef) document() *Document {
+	doc := DC.Make(3).Append(
+		EC.String("$ref", r.Collection),
+		EC.FromValue("$id", r.ID),
+	)
+	if r.DB != "" {
+		doc.Append(EC.String("$db", r.DB))
+	}
+	return doc
+}
+
+// DBRef returns the reference the Value represents. It panics if the
+// value is not an embedded document that follows the DBRef convention.
+func (v *Value) DBRef() DBRef {
+	ref, ok := v.DBRefOK()
+	if !ok {
+		if v == nil || v.offset == 0 || v.data == nil {
+			panic(bsonerr.UninitializedElement)
+		}
+		panic(bsonerr.ElementType{"compact.Element.DBRef", bsontype.Type(v.data[v.start])})
+	}
+	return ref
+}
+
+// DBRefOK is the same as DBRef, except that it returns a boolean
+// instead of panicking. Embedded documents follow the DBRef
+// convention if they have a string "$ref" field and an "$id" field,
+// and their "$db" field, if any, is a string.
+func (v *Value) DBRefOK() (DBRef, bool) {
+	doc, ok := v.MutableDocumentOK()
+	if !ok {
+		return DBRef{}, false
+	}
+
+	collection, ok := doc.Lookup("$ref").StringValueOK()
+	if !ok {
+		return DBRef{}, false
+	}
+	id := doc.LookupElement("$id")
+	if id == nil {
+		return DBRef{}, false
+	}
+
+	ref := DBRef{Collection: collection, ID: id.Value()}
+	if db := doc.LookupElement("$db"); db != nil {
+		if ref.DB, ok = db.Value().StringValueOK(); !ok {
+			return DBRef{}, false
+		}
+	}
+
+	return ref, true
+}
+
+// SymbolOK is the same as Symbol, except that it returns a boolean
+// instead of panicking.
+func (v *Value) SymbolOK() (string, bool) {
+	if v == nil || v.offset == 0 || v.data == nil || bsontype.Type(v.data[v.start]) != bsontype.Symbol {
+		return "", false
+	}
+	return v.Symbol(), true
+}
+
+// RegexOK is the same as Regex, except that it returns a boolean
+// instead of panicking.
+func (v *Value) RegexOK() (pattern, options string, ok bool) {
+	if v == nil || v.offset == 0 || v.data == nil || bsontype.Type(v.data[v.start]) != bsontype.Regex {
+		return "", "", false
+	}
+	pattern, options = v.Regex()
+	return pattern, options, true
+}
+
+// SetJavaScriptScope replaces the scope of the JavaScript code with
+// scope the Value represents, keeping its code. Changes to the
+// document returned by MutableJavaScriptWithScope also modify the
+// scope. It panics if the value is a BSON type other than JavaScript
+// code with scope.
+func (v *Value) SetJavaScriptScope(scope *Document) {
+	if v == nil || v.offset == 0 || v.data == nil {
+		panic(bsonerr.UninitializedElement)
+	}
+	if v.data[v.start] != '\x0F' {
+		panic(bsonerr.ElementType{"compact.Element.JavaScriptWithScope", bsontype.Type(v.data[v.start])})
+	}
+	if scope == nil {
+		scope = DC.New()
+	}
+	v.d = scope
+}
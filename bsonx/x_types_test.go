@@ -0,0 +1,134 @@
+package bsonx
+
+import (
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBRef(t *testing.T) {
+	oid := types.NewObjectID()
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		doc := DC.Elements(
+			EC.DBRef("owner", DBRef{Collection: "users", ID: VC.ObjectID(oid), DB: "accounts"}),
+			EC.DBRef("local", DBRef{Collection: "groups", ID: VC.Int32(42)}),
+		)
+		data, err := doc.MarshalBSON()
+		require.NoError(t, err)
+		doc, err = ReadDocument(data)
+		require.NoError(t, err)
+
+		owner := doc.Lookup("owner").MutableDocument()
+		assert.Equal(t, []string{"$ref", "$id", "$db"}, []string{
+			owner.ElementAt(0).Key(), owner.ElementAt(1).Key(), owner.ElementAt(2).Key(),
+		})
+
+		ref := doc.Lookup("owner").DBRef()
+		assert.Equal(t, "users", ref.Collection)
+		assert.Equal(t, oid, ref.ID.ObjectID())
+		assert.Equal(t, "accounts", ref.DB)
+
+		ref, ok := doc.Lookup("local").DBRefOK()
+		require.True(t, ok)
+		assert.Equal(t, "groups", ref.Collection)
+		assert.EqualValues(t, 42, ref.ID.Int32())
+		assert.Empty(t, ref.DB)
+		assert.Equal(t, 2, doc.Lookup("local").MutableDocument().Len())
+
+		assert.True(t, VC.DBRef(ref).Equal(doc.Lookup("local")))
+	})
+	t.Run("NotReferences", func(t *testing.T) {
+		for name, value := range map[string]*Value{
+			"String":    VC.String("users"),
+			"NoID":      VC.DocumentFromElements(EC.String("$ref", "users")),
+			"NoRef":     VC.DocumentFromElements(EC.Int32("$id", 1)),
+			"IntRef":    VC.DocumentFromElements(EC.Int32("$ref", 1), EC.Int32("$id", 1)),
+			"IntDB":     VC.DocumentFromElements(EC.String("$ref", "users"), EC.Int32("$id", 1), EC.Int32("$db", 1)),
+			"DBPointer": VC.DBPointer("db.users", oid),
+		} {
+			_, ok := value.DBRefOK()
+			assert.False(t, ok, name)
+			assert.Panics(t, func() { value.DBRef() }, name)
+		}
+
+		var value *Value
+		_, ok := value.DBRefOK()
+		assert.False(t, ok)
+		assert.Panics(t, func() { value.DBRef() })
+	})
+}
+
+func TestValueAccessorParity(t *testing.T) {
+	t.Run("Symbol", func(t *testing.T) {
+		symbol, ok := VC.Symbol("sym").SymbolOK()
+		assert.True(t, ok)
+		assert.Equal(t, "sym", symbol)
+
+		_, ok = VC.String("sym").SymbolOK()
+		assert.False(t, ok)
+		var value *Value
+		_, ok = value.SymbolOK()
+		assert.False(t, ok)
+	})
+	t.Run("Regex", func(t *testing.T) {
+		pattern, options, ok := VC.Regex("^a.*", "i").RegexOK()
+		assert.True(t, ok)
+		assert.Equal(t, "^a.*", pattern)
+		assert.Equal(t, "i", options)
+
+		_, _, ok = VC.String("^a.*").RegexOK()
+		assert.False(t, ok)
+	})
+	t.Run("JavaScriptScope", func(t *testing.T) {
+		elem := EC.CodeWithScope("fn", "function() { return x; }", DC.Elements(EC.Int32("x", 1)))
+		elem.Value().SetJavaScriptScope(DC.Elements(EC.Int32("x", 2), EC.String("y", "z")))
+
+		doc := DC.Elements(elem)
+		data, err := doc.MarshalBSON()
+		require.NoError(t, err)
+		doc, err = ReadDocument(data)
+		require.NoError(t, err)
+
+		code, scope := doc.Lookup("fn").MutableJavaScriptWithScope()
+		assert.Equal(t, "function() { return x; }", code)
+		assert.EqualValues(t, 2, scope.Lookup("x").Int32())
+		assert.Equal(t, "z", scope.Lookup("y").StringValue())
+
+		// the scope document that the value returns is live.
+		scope.Append(EC.Boolean("w", true))
+		data, err = doc.MarshalBSON()
+		require.NoError(t, err)
+		doc, err = ReadDocument(data)
+		require.NoError(t, err)
+		_, scope = doc.Lookup("fn").MutableJavaScriptWithScope()
+		assert.Equal(t, 3, scope.Len())
+
+		doc.Lookup("fn").SetJavaScriptScope(nil)
+		_, reader := doc.Lookup("fn").ReaderJavaScriptWithScope()
+		assert.Len(t, reader, 5)
+
+		assert.Panics(t, func() { VC.JavaScript("x").SetJavaScriptScope(DC.New()) })
+		var value *Value
+		assert.Panics(t, func() { value.SetJavaScriptScope(DC.New()) })
+	})
+	t.Run("Timestamp", func(t *testing.T) {
+		ts := types.Timestamp{T: 100, I: 7}
+		next := ts.Increment()
+		assert.Equal(t, types.Timestamp{T: 100, I: 8}, next)
+		assert.Equal(t, -1, ts.Compare(next))
+		assert.Equal(t, 1, next.Compare(ts))
+		assert.Equal(t, 0, ts.Compare(ts))
+		assert.Equal(t, -1, types.Timestamp{T: 99, I: 10}.Compare(ts))
+
+		last := types.Timestamp{T: 100, I: ^uint32(0)}
+		assert.Equal(t, types.Timestamp{T: 101, I: 1}, last.Increment())
+		assert.Equal(t, 1, last.Increment().Compare(last))
+
+		value := VC.Timestamp(next.T, next.I)
+		tt, i := value.Timestamp()
+		assert.Equal(t, next, types.Timestamp{T: tt, I: i})
+	})
+}
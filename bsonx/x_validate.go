@@ -0,0 +1,305 @@
+package bsonx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/pkg/errors"
+)
+
+// ValidationOptions configures validation, including detailed
+// validation, and serialization that validates documents first.
+type ValidationOptions struct {
+	// MaxDepth is the maximum nesting depth of documents and
+	// arrays, where the top level document has a depth of 1. If
+	// zero, the default limit of 2048 applies.
+	MaxDepth int
+}
+
+// ValidationError describes a single violation found by detailed
+// validation.
+type ValidationError struct {
+	// Path identifies the element (or document) with the
+	// violation, with the indexes of array elements in brackets
+	// (e.g. "serverStatus.wiredTiger.cache[3]".) The path of the
+	// top level document is empty.
+	Path string
+	// Offset is the position, in bytes, of the element (or
+	// document) from the beginning of the validated data.
+	Offset int
+	// Expected and Actual are the size that the data declares and
+	// the size that is available or was found, in bytes, for
+	// violations that concern sizes, and are zero otherwise.
+	Expected int
+	Actual   int
+	// Err is the underlying error (e.g. bsonerr.InvalidLength.)
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "<document>"
+	}
+
+	out := fmt.Sprintf("%s at offset %d: %v", path, e.Offset, e.Err)
+	if e.Expected != 0 || e.Actual != 0 {
+		out += fmt.Sprintf(" (expected %d bytes, found %d)", e.Expected, e.Actual)
+	}
+	return out
+}
+
+// Cause returns the underlying error, for use with errors.Cause.
+func (e *ValidationError) Cause() error { return e.Err }
+
+// ValidationErrors holds all of the violations found by detailed
+// validation, in the order of the data.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for idx := range e {
+		msgs[idx] = e[idx].Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+var (
+	errMaxDepth          = errors.New("maximum depth exceeded")
+	errMissingTerminator = errors.New("document is missing its terminator")
+	errEarlyTerminator   = errors.New("document terminator precedes the end of the document")
+	errUnknownType       = errors.New("unknown element type")
+)
+
+// ValidateDetailed validates the document, as Validate does, but
+// reports every violation that it finds, with the path and position
+// of the element involved, rather than only the first. When the
+// structure of an embedded document or array is invalid, its
+// remaining elements are skipped, and validation continues after it
+// if its declared length is consistent with the enclosing document.
+//
+// ValidateDetailed returns nil if the document is valid, and
+// ValidationErrors otherwise.
+func (r Reader) ValidateDetailed(opts ValidationOptions) error {
+	v := &detailedValidator{data: r, maxDepth: opts.MaxDepth}
+	if v.maxDepth <= 0 {
+		v.maxDepth = validateMaxDepthDefault
+	}
+
+	v.document(0, len(r), "", 1, false)
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// ValidateDetailed marshals the document and validates the result
+// with Reader.ValidateDetailed.
+func (d *Document) ValidateDetailed(opts ValidationOptions) error {
+	data, err := d.MarshalBSON()
+	if err != nil {
+		return errors.Wrap(err, "problem marshaling document")
+	}
+
+	return Reader(data).ValidateDetailed(opts)
+}
+
+type detailedValidator struct {
+	data     []byte
+	maxDepth int
+	errs     ValidationErrors
+}
+
+func (v *detailedValidator) fail(path string, offset, expected, actual int, err error) {
+	v.errs = append(v.errs, &ValidationError{
+		Path:     path,
+		Offset:   offset,
+		Expected: expected,
+		Actual:   actual,
+		Err:      err,
+	})
+}
+
+// document validates the document (or array) that begins at start
+// and must end by limit, and returns its declared length, and false if
+// the length is inconsistent with the enclosing data, in which case
+// the enclosing document cannot be validated any further.
+func (v *detailedValidator) document(start, limit int, path string, depth int, array bool) (int, bool) {
+	if limit-start < 5 {
+		v.fail(path, start, 5, limit-start, bsonerr.InvalidLength)
+		return 0, false
+	}
+
+	length := int(readi32(v.data[start : start+4]))
+	if length < 5 {
+		v.fail(path, start, 5, length, bsonerr.InvalidLength)
+		return 0, false
+	}
+	if length > limit-start {
+		v.fail(path, start, length, limit-start, bsonerr.InvalidLength)
+		return 0, false
+	}
+	if depth > v.maxDepth {
+		v.fail(path, start, 0, 0, errors.Wrapf(errMaxDepth, "depth %d exceeds %d", depth, v.maxDepth))
+		return length, true
+	}
+
+	end := start + length
+	for pos := start + 4; ; {
+		if pos >= end {
+			v.fail(path, start, length, pos-start, errMissingTerminator)
+			break
+		}
+
+		elemType := v.data[pos]
+		if elemType == 0 {
+			if pos != end-1 {
+				v.fail(path, start, length, pos+1-start, errEarlyTerminator)
+			}
+			break
+		}
+
+		keyEnd := pos + 1
+		for keyEnd < end && v.data[keyEnd] != 0 {
+			keyEnd++
+		}
+		if keyEnd >= end {
+			v.fail(path, pos, 0, 0, bsonerr.InvalidKey)
+			break
+		}
+
+		key := string(v.data[pos+1 : keyEnd])
+		elemPath := key
+		switch {
+		case array:
+			elemPath = path + "[" + key + "]"
+		case path != "":
+			elemPath = path + "." + key
+		}
+
+		size, ok := v.value(elemType, keyEnd+1, end, elemPath, pos, depth)
+		if !ok {
+			break
+		}
+		pos = keyEnd + 1 + size
+	}
+
+	return length, true
+}
+
+// value validates the value of an element, which begins at start and
+// must end by limit, and returns its size, and false if the size
+// cannot be determined.
+func (v *detailedValidator) value(t byte, start, limit int, path string, offset, depth int) (int, bool) {
+	available := limit - start
+	fixed := func(size int) (int, bool) {
+		if size > available {
+			v.fail(path, offset, size, available, newErrTooSmall())
+			return 0, false
+		}
+		return size, true
+	}
+
+	switch t {
+	case '\x06', '\x0A', '\xFF', '\x7F': // undefined, null, min and max keys
+		return 0, true
+	case '\x01', '\x09', '\x11', '\x12': // double, date time, timestamp, int64
+		return fixed(8)
+	case '\x10': // int32
+		return fixed(4)
+	case '\x07': // object id
+		return fixed(12)
+	case '\x13': // decimal
+		return fixed(16)
+	case '\x08':
+		size, ok := fixed(1)
+		if ok && v.data[start] > 1 {
+			v.fail(path, offset, 0, 0, bsonerr.InvalidBooleanType)
+		}
+		return size, ok
+	case '\x02', '\x0D', '\x0E': // string, javascript, symbol
+		return v.str(start, limit, path, offset)
+	case '\x0C': // db pointer
+		size, ok := v.str(start, limit, path, offset)
+		if !ok {
+			return 0, false
+		}
+		oid, ok := v.value('\x07', start+size, limit, path, offset, depth)
+		return size + oid, ok
+	case '\x0B': // regex
+		size := 0
+		for i := 0; i < 2; i++ {
+			n := v.cstring(start+size, limit)
+			if n < 0 {
+				v.fail(path, offset, 0, 0, bsonerr.InvalidString)
+				return 0, false
+			}
+			size += n
+		}
+		return size, true
+	case '\x05': // binary
+		if _, ok := fixed(5); !ok {
+			return 0, false
+		}
+		length := int(readi32(v.data[start : start+4]))
+		if length < 0 || 5+length > available {
+			v.fail(path, offset, 5+length, available, bsonerr.InvalidBinaryLength)
+			return 0, false
+		}
+		return 5 + length, true
+	case '\x03', '\x04':
+		return v.document(start, limit, path, depth+1, t == '\x04')
+	case '\x0F': // code with scope
+		if _, ok := fixed(4); !ok {
+			return 0, false
+		}
+		length := int(readi32(v.data[start : start+4]))
+		if length < 14 || length > available {
+			v.fail(path, offset, length, available, bsonerr.InvalidLength)
+			return 0, false
+		}
+		code, ok := v.str(start+4, start+length, path, offset)
+		if !ok {
+			return length, true
+		}
+		if scope, ok := v.document(start+4+code, start+length, path, depth+1, false); ok && 4+code+scope != length {
+			v.fail(path, offset, length, 4+code+scope, bsonerr.InvalidLength)
+		}
+		return length, true
+	default:
+		v.fail(path, offset, 0, 0, errors.Wrapf(errUnknownType, "type 0x%02x", t))
+		return 0, false
+	}
+}
+
+// str validates a length prefixed string, and returns its size,
+// including the length.
+func (v *detailedValidator) str(start, limit int, path string, offset int) (int, bool) {
+	available := limit - start
+	if available < 4 {
+		v.fail(path, offset, 4, available, newErrTooSmall())
+		return 0, false
+	}
+
+	length := int(readi32(v.data[start : start+4]))
+	if length < 1 || 4+length > available {
+		v.fail(path, offset, 4+length, available, bsonerr.InvalidLength)
+		return 0, false
+	}
+	if v.data[start+4+length-1] != 0 {
+		v.fail(path, offset, 0, 0, bsonerr.InvalidString)
+	}
+	return 4 + length, true
+}
+
+// cstring returns the size of the null terminated string at start,
+// including the terminator, or -1 if it is not terminated by limit.
+func (v *detailedValidator) cstring(start, limit int) int {
+	for pos := start; pos < limit; pos++ {
+		if v.data[pos] == 0 {
+			return pos + 1 - start
+		}
+	}
+	return -1
+}
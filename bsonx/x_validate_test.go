@@ -0,0 +1,114 @@
+package bsonx
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx/bsonerr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDetailed(t *testing.T) {
+	doc := NewDocument(
+		EC.SubDocumentFromElements("serverStatus",
+			EC.SubDocumentFromElements("wiredTiger",
+				EC.ArrayFromElements("cache", VC.String("v0"), VC.String("v1"), VC.String("v2"), VC.String("v3"), VC.String("v4")),
+				EC.Int64("pages", 42),
+			),
+			EC.Boolean("ok", true),
+		),
+		EC.String("host", "example"),
+	)
+	data, err := doc.MarshalBSON()
+	require.NoError(t, err)
+
+	corrupt := func(t *testing.T, marker string, delta int, value byte) []byte {
+		out := append([]byte{}, data...)
+		idx := bytes.Index(out, []byte(marker))
+		require.True(t, idx >= 0)
+		out[idx+delta] = value
+		return out
+	}
+	violations := func(t *testing.T, err error) ValidationErrors {
+		require.Error(t, err)
+		errs, ok := err.(ValidationErrors)
+		require.True(t, ok)
+		return errs
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		assert.NoError(t, Reader(data).ValidateDetailed(ValidationOptions{}))
+		assert.NoError(t, doc.ValidateDetailed(ValidationOptions{}))
+	})
+	t.Run("StringLength", func(t *testing.T) {
+		// the length of the string precedes its value
+		out := corrupt(t, "v3\x00", -4, 100)
+		_, err := Reader(out).Validate()
+		assert.Error(t, err)
+
+		errs := violations(t, Reader(out).ValidateDetailed(ValidationOptions{}))
+		require.Len(t, errs, 1)
+		assert.Equal(t, "serverStatus.wiredTiger.cache[3]", errs[0].Path)
+		assert.Equal(t, bytes.Index(out, []byte("\x023\x00")), errs[0].Offset)
+		assert.Equal(t, 104, errs[0].Expected)
+		assert.True(t, errs[0].Actual < errs[0].Expected)
+		assert.Equal(t, bsonerr.InvalidLength, errors.Cause(errs[0]))
+		assert.Contains(t, errs[0].Error(), "serverStatus.wiredTiger.cache[3]")
+	})
+	t.Run("MultipleViolations", func(t *testing.T) {
+		out := corrupt(t, "v3\x00", -4, 100)
+		idx := bytes.Index(out, []byte("ok\x00"))
+		out[idx+3] = 2
+
+		errs := violations(t, Reader(out).ValidateDetailed(ValidationOptions{}))
+		require.Len(t, errs, 2)
+		assert.Equal(t, "serverStatus.wiredTiger.cache[3]", errs[0].Path)
+		assert.Equal(t, "serverStatus.ok", errs[1].Path)
+		assert.Equal(t, bsonerr.InvalidBooleanType, errs[1].Err)
+	})
+	t.Run("DocumentLength", func(t *testing.T) {
+		errs := violations(t, Reader(data[:len(data)-3]).ValidateDetailed(ValidationOptions{}))
+		require.Len(t, errs, 1)
+		assert.Equal(t, "", errs[0].Path)
+		assert.Equal(t, 0, errs[0].Offset)
+		assert.Equal(t, len(data), errs[0].Expected)
+		assert.Equal(t, len(data)-3, errs[0].Actual)
+		assert.Contains(t, errs[0].Error(), "<document>")
+	})
+	t.Run("EmbeddedLength", func(t *testing.T) {
+		// the length of the wiredTiger document follows its key
+		out := corrupt(t, "wiredTiger\x00", 11, data[bytes.Index(data, []byte("wiredTiger\x00"))+11]+1)
+
+		errs := violations(t, Reader(out).ValidateDetailed(ValidationOptions{}))
+		require.NotEmpty(t, errs)
+		assert.Equal(t, "serverStatus.wiredTiger", errs[0].Path)
+	})
+	t.Run("MaxDepth", func(t *testing.T) {
+		nested := NewDocument(EC.Int32("leaf", 1))
+		for _, key := range []string{"d", "c", "b", "a"} {
+			nested = NewDocument(EC.SubDocument(key, nested))
+		}
+		deep, err := nested.MarshalBSON()
+		require.NoError(t, err)
+
+		assert.NoError(t, Reader(deep).ValidateDetailed(ValidationOptions{}))
+		assert.NoError(t, Reader(deep).ValidateDetailed(ValidationOptions{MaxDepth: 5}))
+
+		errs := violations(t, Reader(deep).ValidateDetailed(ValidationOptions{MaxDepth: 3}))
+		require.Len(t, errs, 1)
+		assert.Equal(t, "a.b.c", errs[0].Path)
+		assert.Contains(t, errs[0].Error(), "maximum depth exceeded")
+	})
+	t.Run("UnknownType", func(t *testing.T) {
+		idx := bytes.Index(data, []byte("host\x00"))
+		out := append([]byte{}, data...)
+		out[idx-1] = 0x42
+
+		errs := violations(t, Reader(out).ValidateDetailed(ValidationOptions{}))
+		require.Len(t, errs, 1)
+		assert.Equal(t, "host", errs[0].Path)
+		assert.Equal(t, idx-1, errs[0].Offset)
+	})
+}
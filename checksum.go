@@ -0,0 +1,65 @@
+package ftdc
+
+import (
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// Chunks written by this package hold the CRC32 (Castagnoli) checksum
+// of their uncompressed payload in the "checksum" field of the chunk
+// document, which readers verify before decoding the payload. Chunks
+// without the field, such as those that mongod writes, are not
+// verified. Encrypted chunks do not hold a checksum, as a checksum of
+// the plaintext would reveal information about it, and the encryption
+// already authenticates the payload.
+const checksumField = "checksum"
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func payloadChecksum(payload []byte) uint32 { return crc32.Checksum(payload, castagnoli) }
+
+// ChecksumError is the cause (see errors.Cause) of the error of an
+// iterator that read a chunk whose payload does not match its
+// checksum, which indicates that the chunk is corrupt.
+type ChecksumError struct {
+	// ID is the _id (i.e. start time) of the chunk.
+	ID       time.Time
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for chunk '%s': expected %#08x, got %#08x",
+		e.ID.Format(time.RFC3339Nano), e.Expected, e.Actual)
+}
+
+// verifyChecksum returns a ChecksumError if the chunk document has a
+// checksum that does not match the payload.
+func verifyChecksum(doc *bsonx.Document, payload []byte) error {
+	elem := doc.LookupElement(checksumField)
+	if elem == nil {
+		return nil
+	}
+
+	if elem.Value().Type() != bsontype.Int64 {
+		return errors.New("checksum field is not an int64")
+	}
+	expected := elem.Value().Int64()
+
+	actual := payloadChecksum(payload)
+	if expected != int64(actual) {
+		id, _ := doc.Lookup("_id").TimeOK()
+		return &ChecksumError{
+			ID:       id,
+			Expected: uint32(expected),
+			Actual:   actual,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkChecksum(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	collector := NewBaseCollector(100)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, collector.Add(randFlatDocument(10)))
+	}
+	data, err := collector.Resolve()
+	require.NoError(t, err)
+
+	chunkDocument := func(t *testing.T) *bsonx.Document {
+		doc, err := bsonx.ReadDocument(data)
+		require.NoError(t, err)
+		return doc
+	}
+	// rewrite replaces the payload of the chunk with the output
+	// of the function, and returns the encoded chunk document.
+	rewrite := func(t *testing.T, doc *bsonx.Document, modify func([]byte)) []byte {
+		_, compressed := doc.Lookup("data").Binary()
+		payload, err := decompressBuffer(CompressionZlib, compressed)
+		require.NoError(t, err)
+		modify(payload)
+		compressed, err = compressBuffer(CompressionZlib, payload)
+		require.NoError(t, err)
+		doc.Set(bsonx.EC.Binary("data", compressed))
+
+		out, err := doc.MarshalBSON()
+		require.NoError(t, err)
+		return out
+	}
+	read := func(data []byte) (int, error) {
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		count := 0
+		for iter.Next() {
+			count++
+		}
+		return count, iter.Err()
+	}
+
+	t.Run("Written", func(t *testing.T) {
+		elem := chunkDocument(t).LookupElement(checksumField)
+		require.NotNil(t, elem)
+		assert.NotZero(t, elem.Value().Int64())
+
+		count, err := read(data)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+	t.Run("Mismatch", func(t *testing.T) {
+		doc := chunkDocument(t)
+		expected := uint32(doc.Lookup(checksumField).Int64())
+		id := doc.Lookup("_id").Time()
+		corrupt := rewrite(t, doc, func(payload []byte) { payload[len(payload)-1] ^= 0xff })
+
+		count, err := read(corrupt)
+		assert.Zero(t, count)
+		require.Error(t, err)
+		checksumErr, ok := errors.Cause(err).(*ChecksumError)
+		require.True(t, ok, "%+v", err)
+		assert.Equal(t, expected, checksumErr.Expected)
+		assert.NotEqual(t, expected, checksumErr.Actual)
+		assert.True(t, id.Equal(checksumErr.ID))
+		assert.Contains(t, checksumErr.Error(), "checksum mismatch")
+
+		// the error surfaces through document iterators.
+		iter := ReadMetrics(ctx, bytes.NewReader(corrupt))
+		defer iter.Close()
+		assert.False(t, iter.Next())
+		_, ok = errors.Cause(iter.Err()).(*ChecksumError)
+		assert.True(t, ok, "%+v", iter.Err())
+	})
+	t.Run("Unchecked", func(t *testing.T) {
+		// chunks without checksums, e.g. those that mongod
+		// writes, are read without verification.
+		doc := chunkDocument(t)
+		doc.Delete(checksumField)
+		out := rewrite(t, doc, func([]byte) {})
+
+		count, err := read(out)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+	t.Run("InvalidField", func(t *testing.T) {
+		doc := chunkDocument(t)
+		doc.Set(bsonx.EC.String(checksumField, "abc"))
+		out, err := doc.MarshalBSON()
+		require.NoError(t, err)
+
+		_, err = read(out)
+		require.Error(t, err)
+		_, ok := errors.Cause(err).(*ChecksumError)
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,61 @@
+//go:build arrow
+// +build arrow
+
+package ftdc
+
+import (
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// ToArrow converts the chunk into an Apache Arrow record batch, with
+// one row per sample and one column per metric, named by the
+// metric's flattened key. Double metrics become float64 columns, and
+// all other metrics become int64 columns, using the same
+// representation as the Values of the metric (e.g. milliseconds
+// since the epoch for date time values.)
+//
+// The record is allocated with the provided allocator, or the
+// default Go allocator if the pool is nil. Callers must Release the
+// record when they are done with it.
+//
+// Support for Arrow requires building with the "arrow" build tag.
+func (c *Chunk) ToArrow(pool memory.Allocator) (arrow.Record, error) {
+	if pool == nil {
+		pool = memory.DefaultAllocator
+	}
+
+	fields := make([]arrow.Field, len(c.Metrics))
+	for idx := range c.Metrics {
+		m := &c.Metrics[idx]
+		if len(m.Values) != c.nPoints {
+			return nil, errors.Errorf("metric '%s' has %d values, expected %d", m.Key(), len(m.Values), c.nPoints)
+		}
+
+		fields[idx] = arrow.Field{Name: m.Key(), Type: arrow.PrimitiveTypes.Int64}
+		if m.originalType == bsontype.Double {
+			fields[idx].Type = arrow.PrimitiveTypes.Float64
+		}
+	}
+
+	builder := array.NewRecordBuilder(pool, arrow.NewSchema(fields, nil))
+	defer builder.Release()
+
+	for idx := range c.Metrics {
+		m := &c.Metrics[idx]
+		switch b := builder.Field(idx).(type) {
+		case *array.Float64Builder:
+			b.Reserve(c.nPoints)
+			for _, v := range m.Values {
+				b.UnsafeAppend(restoreFloat(v))
+			}
+		case *array.Int64Builder:
+			b.AppendValues(m.Values, nil)
+		}
+	}
+
+	return builder.NewRecord(), nil
+}
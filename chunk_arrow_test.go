@@ -0,0 +1,70 @@
+//go:build arrow
+// +build arrow
+
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkToArrow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	collector := NewBaseCollector(10)
+	for i := int64(0); i < 10; i++ {
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.Int64("counter", i*10),
+			bsonx.EC.Int32("gauge", int32(-i)),
+			bsonx.EC.Double("ratio", 0.5),
+			bsonx.EC.SubDocument("nested", bsonx.NewDocument(bsonx.EC.Boolean("flag", i%2 == 0))),
+		)))
+	}
+	payload, err := collector.Resolve()
+	require.NoError(t, err)
+
+	iter := ReadChunks(ctx, bytes.NewBuffer(payload))
+	defer iter.Close()
+	require.True(t, iter.Next())
+	chunk := iter.Chunk()
+
+	pool := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer pool.AssertSize(t, 0)
+
+	record, err := chunk.ToArrow(pool)
+	require.NoError(t, err)
+	defer record.Release()
+
+	assert.EqualValues(t, chunk.Size(), record.NumRows())
+	require.EqualValues(t, chunk.Len(), record.NumCols())
+
+	schema := record.Schema()
+	for idx, name := range []string{"counter", "gauge", "ratio", "nested.flag"} {
+		assert.Equal(t, name, schema.Field(idx).Name)
+	}
+	assert.Equal(t, arrow.PrimitiveTypes.Int64, schema.Field(0).Type)
+	assert.Equal(t, arrow.PrimitiveTypes.Float64, schema.Field(2).Type)
+
+	counters := record.Column(0).(*array.Int64)
+	for i := 0; i < counters.Len(); i++ {
+		assert.Equal(t, chunk.Metrics[0].Values[i], counters.Value(i))
+	}
+	assert.Equal(t, 0.5, record.Column(2).(*array.Float64).Value(0))
+	assert.EqualValues(t, 1, record.Column(3).(*array.Int64).Value(0))
+
+	t.Run("DefaultAllocator", func(t *testing.T) {
+		record, err := chunk.ToArrow(nil)
+		require.NoError(t, err)
+		defer record.Release()
+		assert.EqualValues(t, chunk.Size(), record.NumRows())
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/export"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// converters write the chunks of an iterator in an output format.
+var converters = map[string]func(context.Context, *ftdc.ChunkIterator, io.Writer) error{
+	"csv":  ftdc.WriteCSV,
+	"json": writeJSON,
+	"jsonl": func(ctx context.Context, iter *ftdc.ChunkIterator, w io.Writer) error {
+		return ftdc.WriteJSONL(ctx, iter, w, ftdc.JSONLOptions{})
+	},
+	"parquet": func(ctx context.Context, iter *ftdc.ChunkIterator, w io.Writer) error {
+		return export.WriteParquet(ctx, iter, w, export.ParquetOptions{})
+	},
+	"lp": func(ctx context.Context, iter *ftdc.ChunkIterator, w io.Writer) error {
+		return export.WriteLineProtocol(ctx, iter, w, export.LPOptions{})
+	},
+}
+
+func runConvert(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	input := &inputFlags{}
+	fs := newFlagSet("convert", "<file>...", input, stderr)
+	format := fs.String("format", "csv", "the output `format`: csv, json, jsonl (flat json), parquet, or lp (line protocol)")
+	output := fs.String("output", "", "write the output to this `file`, rather than to standard output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	convert, ok := converters[*format]
+	if !ok {
+		return errors.Errorf("unknown output format '%s'", *format)
+	}
+
+	iter, closer, err := input.open(ctx, fs.Args())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer closer()
+
+	out := stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return errors.Wrapf(err, "problem creating '%s'", *output)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	buf := bufio.NewWriter(out)
+	if err = convert(ctx, iter, buf); err != nil {
+		return errors.Wrapf(err, "problem converting to %s", *format)
+	}
+	if err = buf.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if file, ok := out.(*os.File); ok && *output != "" {
+		return errors.WithStack(file.Close())
+	}
+	return nil
+}
+
+// writeJSON writes each sample as a line of extended JSON, with
+// flattened keys.
+func writeJSON(ctx context.Context, iter *ftdc.ChunkIterator, w io.Writer) error {
+	for iter.Next() {
+		samples := iter.Chunk().Iterator(ctx)
+		for samples.Next() {
+			data, err := bson.MarshalExtJSON(samples.Document(), false, false)
+			if err != nil {
+				samples.Close()
+				return errors.WithStack(err)
+			}
+			if _, err = w.Write(append(data, '\n')); err != nil {
+				samples.Close()
+				return errors.WithStack(err)
+			}
+		}
+		err := samples.Err()
+		samples.Close()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return errors.WithStack(iter.Err())
+}
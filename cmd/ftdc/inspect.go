@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// metricInfo describes a metric for the inspect command.
+type metricInfo struct {
+	key    string
+	typ    string
+	chunks int
+}
+
+func runInspect(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	input := &inputFlags{}
+	fs := newFlagSet("inspect", "<file>...", input, stderr)
+	noMetadata := fs.Bool("no-metadata", false, "do not print the metadata documents")
+	noMetrics := fs.Bool("no-metrics", false, "do not print the metrics")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	iter, closer, err := input.open(ctx, fs.Args())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer closer()
+
+	// metrics are listed in the order in which they first appear.
+	var metrics []*metricInfo
+	seen := map[string]*metricInfo{}
+	for iter.Next() {
+		for _, m := range iter.Chunk().Metrics {
+			key := m.Key()
+			info, ok := seen[key]
+			if !ok {
+				info = &metricInfo{key: key, typ: m.Type().String()}
+				seen[key] = info
+				metrics = append(metrics, info)
+			}
+			info.chunks++
+		}
+	}
+	if err = iter.Err(); err != nil {
+		return errors.Wrap(err, "problem reading chunks")
+	}
+
+	if !*noMetadata {
+		fmt.Fprintln(stdout, "metadata:")
+		for _, entry := range iter.MetadataHistory() {
+			data, err := bson.MarshalExtJSON(entry.Document, false, false)
+			if err != nil {
+				return errors.Wrap(err, "problem rendering metadata")
+			}
+			fmt.Fprintf(stdout, "  %s %s\n", entry.Timestamp.UTC().Format(time.RFC3339Nano), data)
+		}
+	}
+
+	if !*noMetrics {
+		if !*noMetadata {
+			fmt.Fprintln(stdout)
+		}
+
+		descriptors := iter.MetricDescriptors()
+		tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY\tTYPE\tCHUNKS\tUNIT\tKIND\tDESCRIPTION")
+		for _, info := range metrics {
+			desc := descriptors[info.key]
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", info.key, info.typ, info.chunks, desc.Unit, desc.Kind, desc.Description)
+		}
+		if err = tw.Flush(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+// Command ftdc inspects and converts FTDC data files.
+//
+// Usage:
+//
+//	ftdc stats [flags] <file>...
+//	ftdc inspect [flags] <file>...
+//	ftdc convert [flags] <file>...
+//
+// Every command reads the files in order, as a single stream of
+// chunks, and accepts the -start, -end, and -keys flags to limit the
+// data to a time range and to the metrics whose keys match a set of
+// glob patterns. Run "ftdc <command> -h" for the flags of a command.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+const usage = `usage: ftdc <command> [flags] <file>...
+
+commands:
+  stats     print the size, samples, and time range of each chunk
+  inspect   print the metadata and the metrics of the data
+  convert   convert the data to csv, json, jsonl, parquet, or line protocol
+`
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, "ftdc:", err)
+		}
+		os.Exit(2)
+	}
+}
+
+type command func(context.Context, []string, io.Writer, io.Writer) error
+
+var commands = map[string]command{
+	"stats":   runStats,
+	"inspect": runInspect,
+	"convert": runConvert,
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return errors.New("no command specified")
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		if args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+			fmt.Fprint(stdout, usage)
+			return nil
+		}
+		fmt.Fprint(stderr, usage)
+		return errors.Errorf("unknown command '%s'", args[0])
+	}
+
+	return cmd(ctx, args[1:], stdout, stderr)
+}
+
+// inputFlags are the flags, shared by every command, that select the
+// data to read.
+type inputFlags struct {
+	start string
+	end   string
+	keys  string
+}
+
+func (f *inputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.start, "start", "", "only read samples collected at or after this `time` (RFC 3339)")
+	fs.StringVar(&f.end, "end", "", "only read samples collected before this `time` (RFC 3339)")
+	fs.StringVar(&f.keys, "keys", "", "only read metrics whose keys match these comma separated glob `patterns`")
+}
+
+// open returns an iterator over the chunks in the files, in order,
+// filtered by the flags, and a function that closes the files.
+func (f *inputFlags) open(ctx context.Context, paths []string) (*ftdc.ChunkIterator, func(), error) {
+	if len(paths) == 0 {
+		return nil, nil, errors.New("no input files specified")
+	}
+
+	start, err := parseTime(f.start)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid start time")
+	}
+	end, err := parseTime(f.end)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid end time")
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		return nil, nil, errors.New("start time must be before end time")
+	}
+
+	var matcher ftdc.KeyMatcher
+	if f.keys != "" {
+		if matcher, err = ftdc.NewGlobMatcher(strings.Split(f.keys, ",")...); err != nil {
+			return nil, nil, errors.Wrap(err, "invalid key patterns")
+		}
+	}
+
+	files := make([]*os.File, 0, len(paths))
+	closer := func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}
+	readers := make([]io.Reader, 0, len(paths))
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			closer()
+			return nil, nil, errors.Wrapf(err, "problem opening '%s'", path)
+		}
+		files = append(files, file)
+		readers = append(readers, file)
+	}
+
+	iter := ftdc.NewFilteredChunkIterator(ctx, io.MultiReader(readers...), start, end, matcher)
+	return iter, func() { iter.Close(); closer() }, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, value)
+	return ts, errors.WithStack(err)
+}
+
+// newFlagSet returns a flag set for the command, which writes its
+// usage, and the usage of the input flags, to stderr.
+func newFlagSet(name, args string, input *inputFlags, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: ftdc %s [flags] %s\n\nflags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	input.register(fs)
+	return fs
+}
+
+// sampleTimes returns the time range of the chunk, from its first date
+// time metric, or false if the chunk has no date time metric.
+func sampleTimes(chunk *ftdc.Chunk) (time.Time, time.Time, bool) {
+	for _, m := range chunk.Metrics {
+		if m.Type() != bsontype.DateTime || len(m.Values) == 0 {
+			continue
+		}
+		return msTime(m.Values[0]), msTime(m.Values[len(m.Values)-1]), true
+	}
+
+	return time.Time{}, time.Time{}, false
+}
+
+func msTime(ms int64) time.Time {
+	return time.Unix(ms/1000, ms%1000*int64(time.Millisecond)).UTC()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestData(t *testing.T, dir string) string {
+	collector := ftdc.NewBaseCollector(10)
+	require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "example"))))
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.Time("ts", start.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("ops", int64(i*10)),
+			bsonx.EC.SubDocumentFromElements("mem", bsonx.EC.Int64("rss", 1024)),
+		)))
+	}
+
+	data, err := collector.Resolve()
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "metrics.ftdc")
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+	return path
+}
+
+func TestCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftdc-cmd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := writeTestData(t, dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exec := func(args ...string) (string, error) {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		err := run(ctx, args, stdout, stderr)
+		return stdout.String(), err
+	}
+
+	t.Run("Usage", func(t *testing.T) {
+		_, err := exec()
+		assert.Error(t, err)
+		_, err = exec("frobnicate")
+		assert.Error(t, err)
+		out, err := exec("help")
+		assert.NoError(t, err)
+		assert.Contains(t, out, "convert")
+	})
+	t.Run("Stats", func(t *testing.T) {
+		out, err := exec("stats", path)
+		require.NoError(t, err)
+		assert.Contains(t, out, "2020-01-01T00:00:00Z")
+		assert.Contains(t, out, "2020-01-01T00:00:04Z")
+		assert.Contains(t, out, "total")
+	})
+	t.Run("Inspect", func(t *testing.T) {
+		out, err := exec("inspect", path)
+		require.NoError(t, err)
+		assert.Contains(t, out, `"host":"example"`)
+		assert.Contains(t, out, "mem.rss")
+	})
+	t.Run("InspectKeys", func(t *testing.T) {
+		out, err := exec("inspect", "-no-metadata", "-keys", "mem.*", path)
+		require.NoError(t, err)
+		assert.Contains(t, out, "mem.rss")
+		assert.NotContains(t, out, "ops")
+		assert.NotContains(t, out, "example")
+	})
+	t.Run("ConvertJSON", func(t *testing.T) {
+		out, err := exec("convert", "-format", "json", "-start", "2020-01-01T00:00:02Z", path)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		assert.Len(t, lines, 3)
+	})
+	t.Run("ConvertJSONL", func(t *testing.T) {
+		out, err := exec("convert", "-format", "jsonl", "-start", "2020-01-01T00:00:02Z", path)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		assert.Len(t, lines, 3)
+		assert.Contains(t, lines[0], `"ts":"2020-01-01T00:00:02.000Z"`)
+		assert.Contains(t, lines[0], `"mem.rss":`)
+	})
+	t.Run("ConvertCSV", func(t *testing.T) {
+		output := filepath.Join(dir, "out.csv")
+		_, err := exec("convert", "-output", output, path)
+		require.NoError(t, err)
+		data, err := ioutil.ReadFile(output)
+		require.NoError(t, err)
+		assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 6)
+	})
+	t.Run("InvalidFlags", func(t *testing.T) {
+		_, err := exec("convert", "-format", "xml", path)
+		assert.Error(t, err)
+		_, err = exec("stats", "-start", "yesterday", path)
+		assert.Error(t, err)
+		_, err = exec("stats")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func runStats(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	input := &inputFlags{}
+	fs := newFlagSet("stats", "<file>...", input, stderr)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	iter, closer, err := input.open(ctx, fs.Args())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer closer()
+
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHUNK\tID\tSAMPLES\tMETRICS\tPAYLOAD\tFIRST\tLAST")
+
+	var (
+		chunks  int
+		samples int
+		payload int
+		first   time.Time
+		last    time.Time
+	)
+	for iter.Next() {
+		chunk := iter.Chunk()
+
+		start, end := "-", "-"
+		if from, to, ok := sampleTimes(chunk); ok {
+			start, end = from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano)
+			if first.IsZero() {
+				first = from
+			}
+			last = to
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d\t%s\t%s\n", chunks, chunk.ID().UTC().Format(time.RFC3339Nano),
+			chunk.Size(), chunk.Len(), chunk.PayloadSize(), start, end)
+
+		chunks++
+		samples += chunk.Size()
+		payload += chunk.PayloadSize()
+	}
+	if err = iter.Err(); err != nil {
+		return errors.Wrap(err, "problem reading chunks")
+	}
+
+	fmt.Fprintf(tw, "total\t\t%d\t\t%d\t%s\t%s\n", samples, payload, formatTime(first), formatTime(last))
+
+	return errors.WithStack(tw.Flush())
+}
+
+func formatTime(ts time.Time) string {
+	if ts.IsZero() {
+		return "-"
+	}
+	return ts.Format(time.RFC3339Nano)
+}
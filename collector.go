@@ -1,5 +1,7 @@
 package ftdc
 
+import "github.com/pkg/errors"
+
 // Collector describes the interface for collecting and constructing
 // FTDC data series. Implementations may have different efficiencies
 // and handling of schema changes.
@@ -33,6 +35,45 @@ type Collector interface {
 	Info() CollectorInfo
 }
 
+// StatsCollector describes collectors that report statistics about
+// the chunks that they produce. All of the collectors in this package
+// implement it; use a type assertion to read the statistics of a
+// Collector.
+type StatsCollector interface {
+	Collector
+
+	// Stats reports on the state of the collector and on the
+	// chunks that it has produced, for monitoring.
+	Stats() CollectorStats
+}
+
+// SnapshotCollector describes collectors that can render the samples
+// that they hold without resolving them. All of the collectors in
+// this package implement it; use a type assertion to take a snapshot
+// of a Collector.
+type SnapshotCollector interface {
+	Collector
+
+	// Snapshot renders the existing documents as Resolve does,
+	// without modifying the state of the collector, so that you
+	// can read all of the data collected so far while the
+	// collector continues to accumulate samples into the same
+	// chunk. Unlike Resolve, snapshots are not counted in the
+	// collector's statistics.
+	Snapshot() ([]byte, error)
+}
+
+// snapshotCollector takes a snapshot of a collector, or returns an
+// error if the collector does not implement SnapshotCollector.
+func snapshotCollector(c Collector) ([]byte, error) {
+	sc, ok := c.(SnapshotCollector)
+	if !ok {
+		return nil, errors.Errorf("collector of type %T does not support snapshots", c)
+	}
+
+	return sc.Snapshot()
+}
+
 // CollectorInfo reports on the current state of the collector and
 // provides introspection into the current state of the collector for
 // testing, transparency, and to support more complex collector
@@ -40,4 +81,9 @@ type Collector interface {
 type CollectorInfo struct {
 	MetricsCount int
 	SampleCount  int
+
+	// Dropped is the number of samples that the collector has
+	// discarded, rather than collected, which is only reported by
+	// collectors that may drop samples (e.g. buffered collectors.)
+	Dropped int64
 }
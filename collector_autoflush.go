@@ -0,0 +1,366 @@
+package ftdc
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+// AutoFlushOptions configure the triggers that write the chunks of an
+// auto flushing collector. A chunk is written when any trigger fires.
+type AutoFlushOptions struct {
+	// MaxSamples is the number of samples after which a chunk is
+	// written, which must be positive.
+	MaxSamples int
+	// MaxBytes is the size, in bytes, of the uncompressed payload
+	// of a chunk, estimated as samples are added, after which the
+	// chunk is written. Compressed chunks are usually much
+	// smaller. Zero disables the trigger.
+	MaxBytes int
+	// MaxAge is the length of time after the first sample of a
+	// chunk was added at which the chunk is written, even if no
+	// further samples are added. Zero disables the trigger.
+	MaxAge time.Duration
+}
+
+// Validate ensures that the options are reasonable.
+func (opts *AutoFlushOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(opts.MaxSamples < 1, "max samples must be positive")
+	catcher.NewWhen(opts.MaxBytes < 0, "max bytes must not be negative")
+	catcher.NewWhen(opts.MaxAge < 0, "max age must not be negative")
+	return catcher.Resolve()
+}
+
+// autoFlushQueueSize is the number of chunks that may wait to be
+// written before Add blocks.
+const autoFlushQueueSize = 4
+
+type autoFlushCollector struct {
+	ctx    context.Context
+	opts   AutoFlushOptions
+	output io.Writer
+	queue  chan *betterCollector
+
+	// mu protects the current chunk and the triggers.
+	mu       sync.Mutex
+	current  *betterCollector
+	metadata *bsonx.Document
+	count    int
+	gen      int
+	timer    *time.Timer
+
+	// pending is the number of chunks that have been queued but
+	// not yet written, and drained is signaled as it decreases.
+	// queued is the number of chunks sent, or about to be sent, to
+	// the background goroutine, and closed is set once it stops
+	// accepting chunks. catcher holds the errors from writing
+	// queued chunks.
+	pendingMu sync.Mutex
+	pending   int
+	queued    int
+	closed    bool
+	drained   *sync.Cond
+	catcher   grip.Catcher
+
+	statsMu sync.Mutex
+	stats   collectorStats
+}
+
+// NewAutoFlushCollector provides a streaming collector (see
+// NewStreamingCollector) that writes a chunk to the writer when the
+// chunk has the maximum number of samples, when the estimated size of
+// its payload reaches the maximum size, or when its first sample
+// reaches the maximum age, so that callers do not have to flush the
+// collector themselves. Returns an error if the options are not valid.
+//
+// Chunks are resolved and written by a background goroutine, so Add
+// does not wait for chunks to be compressed or written, unless
+// several chunks are already waiting to be written. Errors writing
+// chunks are logged, and returned by the next call to Add or Flush,
+// and the chunks are discarded.
+//
+// Flush writes the current chunk and waits until every chunk has
+// been written. The background goroutine exits when the context is
+// canceled, after writing the chunks that are waiting to be written,
+// and Add returns an error afterwards, so call Flush before canceling
+// the context to write the last chunk. The collector is safe for
+// concurrent use.
+func NewAutoFlushCollector(ctx context.Context, opts AutoFlushOptions, writer io.Writer) (Collector, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+	if writer == nil {
+		return nil, errors.New("invalid writer")
+	}
+
+	c := &autoFlushCollector{
+		ctx:     ctx,
+		opts:    opts,
+		output:  writer,
+		queue:   make(chan *betterCollector, autoFlushQueueSize),
+		catcher: grip.NewBasicCatcher(),
+	}
+	c.drained = sync.NewCond(&c.pendingMu)
+	c.current = c.newChunk()
+
+	go c.worker()
+
+	return c, nil
+}
+
+func (c *autoFlushCollector) newChunk() *betterCollector {
+	chunk := &betterCollector{
+		maxDeltas: c.opts.MaxSamples,
+		trackSize: c.opts.MaxBytes > 0,
+	}
+	if c.metadata != nil {
+		chunk.metadata = c.metadata
+	}
+	return chunk
+}
+
+func (c *autoFlushCollector) worker() {
+	for {
+		select {
+		case chunk := <-c.queue:
+			c.pendingMu.Lock()
+			c.queued--
+			c.pendingMu.Unlock()
+			c.write(chunk)
+		case <-c.ctx.Done():
+			// chunks counted before the collector is closed
+			// are sent even if they are not in the queue yet,
+			// so wait for each of them rather than stopping
+			// when the queue is empty.
+			c.pendingMu.Lock()
+			c.closed = true
+			remaining := c.queued
+			c.queued = 0
+			c.pendingMu.Unlock()
+
+			for ; remaining > 0; remaining-- {
+				c.write(<-c.queue)
+			}
+			return
+		}
+	}
+}
+
+// write resolves the chunk and writes it to the output, recording any
+// errors.
+func (c *autoFlushCollector) write(chunk *betterCollector) {
+	data, err := c.resolveChunk(chunk)
+	if err == nil {
+		var n int
+		n, err = c.output.Write(data)
+		if err == nil && n != len(data) {
+			err = errors.New("problem flushing data")
+		}
+		recordFlush(n, err)
+	} else {
+		recordFlush(0, err)
+	}
+
+	grip.Error(message.WrapError(err, message.Fields{
+		"message": "problem writing chunk, which is discarded",
+		"samples": chunk.Info().SampleCount,
+	}))
+
+	c.pendingMu.Lock()
+	c.catcher.Add(err)
+	c.pending--
+	c.drained.Broadcast()
+	c.pendingMu.Unlock()
+}
+
+// resolveChunk resolves the chunk, and records it in the statistics of
+// the collector.
+func (c *autoFlushCollector) resolveChunk(chunk *betterCollector) ([]byte, error) {
+	start := time.Now()
+	data, err := chunk.Resolve()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	stats := chunk.Stats()
+	c.statsMu.Lock()
+	c.stats.record(time.Since(start), 1, stats.PayloadSize, stats.UncompressedPayloadSize)
+	c.statsMu.Unlock()
+
+	return data, nil
+}
+
+// writeErrors returns, and clears, the errors from writing queued chunks.
+func (c *autoFlushCollector) writeErrors() error {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	err := c.catcher.Resolve()
+	if err != nil {
+		c.catcher = grip.NewBasicCatcher()
+	}
+	return err
+}
+
+// rotate queues the current chunk to be written, and starts a new
+// chunk. The caller must hold the lock.
+func (c *autoFlushCollector) rotate() {
+	chunk := c.current
+	c.current = c.newChunk()
+	c.count = 0
+	c.gen++
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+
+	c.pendingMu.Lock()
+	c.pending++
+	closed := c.closed
+	if !closed {
+		c.queued++
+	}
+	c.pendingMu.Unlock()
+
+	if closed {
+		// the background goroutine has exited, so write the
+		// chunk here rather than lose it.
+		c.write(chunk)
+		return
+	}
+	c.queue <- chunk
+}
+
+// expire writes the current chunk if it is the chunk of the generation
+// that started the timer.
+func (c *autoFlushCollector) expire(gen int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gen == gen && c.count > 0 {
+		c.rotate()
+	}
+}
+
+func (c *autoFlushCollector) Add(in interface{}) error {
+	if err := c.ctx.Err(); err != nil {
+		return errors.Wrap(err, "auto flushing collector is closed")
+	}
+	if err := c.writeErrors(); err != nil {
+		return errors.Wrap(err, "problem writing chunks")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.current.Add(in); err != nil {
+		return errors.Wrapf(err, "adding sample #%d", c.count+1)
+	}
+	c.count++
+
+	if c.count == 1 && c.opts.MaxAge > 0 {
+		gen := c.gen
+		c.timer = time.AfterFunc(c.opts.MaxAge, func() { c.expire(gen) })
+	}
+
+	if c.count >= c.opts.MaxSamples || (c.opts.MaxBytes > 0 && c.current.payloadSize >= c.opts.MaxBytes) {
+		c.rotate()
+	}
+
+	return nil
+}
+
+// Flush writes the current chunk, after every queued chunk has been
+// written, and returns any errors from writing chunks.
+func (c *autoFlushCollector) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pendingMu.Lock()
+	for c.pending > 0 {
+		c.drained.Wait()
+	}
+	c.pendingMu.Unlock()
+
+	if c.count > 0 {
+		c.gen++
+		if c.timer != nil {
+			c.timer.Stop()
+			c.timer = nil
+		}
+
+		c.pendingMu.Lock()
+		c.pending++
+		c.pendingMu.Unlock()
+		c.write(c.current)
+		c.current = c.newChunk()
+		c.count = 0
+	}
+
+	return errors.Wrap(c.writeErrors(), "problem writing chunks")
+}
+
+func (c *autoFlushCollector) SetMetadata(in interface{}) error {
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.metadata = doc
+	c.current.metadata = doc
+	return nil
+}
+
+func (c *autoFlushCollector) Resolve() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.resolveChunk(c.current)
+}
+
+func (c *autoFlushCollector) Snapshot() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out, err := c.current.Snapshot()
+	return out, errors.WithStack(err)
+}
+
+func (c *autoFlushCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.current.Reset()
+	c.count = 0
+	c.gen++
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+}
+
+func (c *autoFlushCollector) Info() CollectorInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.current.Info()
+}
+
+func (c *autoFlushCollector) Stats() CollectorStats {
+	info := c.Info()
+
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	return c.stats.export(info)
+}
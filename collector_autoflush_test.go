@@ -0,0 +1,252 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lockedBuffer is a buffer that is safe for concurrent use, which
+// blocks writes while the gate is closed.
+type lockedBuffer struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	gate chan struct{}
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	if b.gate != nil {
+		<-b.gate
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte{}, b.buf.Bytes()...)
+}
+
+func TestAutoFlushCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sample := func(i int) *bsonx.Document {
+		return bsonx.NewDocument(
+			bsonx.EC.Int64("a", int64(i)),
+			bsonx.EC.Int64("b", int64(i*i*1000)),
+			bsonx.EC.Int64("c", 42),
+		)
+	}
+	chunkSizes := func(t *testing.T, data []byte) []int {
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+
+		out := []int{}
+		idx := 0
+		for iter.Next() {
+			chunk := iter.Chunk()
+			for i, value := range chunk.Metrics[0].Values {
+				assert.EqualValues(t, idx+i, value)
+			}
+			idx += chunk.Size()
+			out = append(out, chunk.Size())
+		}
+		require.NoError(t, iter.Err())
+		return out
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for name, opts := range map[string]AutoFlushOptions{
+			"NoSamples":   {},
+			"NegativeAge": {MaxSamples: 10, MaxAge: -time.Second},
+			"NegativeMax": {MaxSamples: 10, MaxBytes: -1},
+		} {
+			_, err := NewAutoFlushCollector(ctx, opts, &bytes.Buffer{})
+			assert.Error(t, err, name)
+		}
+		_, err := NewAutoFlushCollector(ctx, AutoFlushOptions{MaxSamples: 10}, nil)
+		assert.Error(t, err)
+	})
+	t.Run("MaxSamples", func(t *testing.T) {
+		out := &lockedBuffer{}
+		collector, err := NewAutoFlushCollector(ctx, AutoFlushOptions{MaxSamples: 10}, out)
+		require.NoError(t, err)
+		require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "db0"))))
+
+		for i := 0; i < 25; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		assert.Equal(t, 5, collector.Info().SampleCount)
+		require.NoError(t, collector.(*autoFlushCollector).Flush())
+		assert.Zero(t, collector.Info().SampleCount)
+		assert.EqualValues(t, 3, collector.(StatsCollector).Stats().ChunksResolved)
+
+		assert.Equal(t, []int{10, 10, 5}, chunkSizes(t, out.Bytes()))
+
+		iter := ReadChunks(ctx, bytes.NewReader(out.Bytes()))
+		defer iter.Close()
+		for iter.Next() {
+			require.NotNil(t, iter.Chunk().GetMetadata())
+			assert.Equal(t, "db0", iter.Chunk().GetMetadata().Lookup("doc").MutableDocument().Lookup("host").StringValue())
+		}
+		require.NoError(t, iter.Err())
+	})
+	t.Run("MaxBytes", func(t *testing.T) {
+		out := &lockedBuffer{}
+		collector, err := NewAutoFlushCollector(ctx, AutoFlushOptions{MaxSamples: 1000, MaxBytes: 100}, out)
+		require.NoError(t, err)
+
+		for i := 0; i < 100; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		require.NoError(t, collector.(*autoFlushCollector).Flush())
+
+		sizes := chunkSizes(t, out.Bytes())
+		require.True(t, len(sizes) > 2, "%v", sizes)
+		total := 0
+		for _, size := range sizes {
+			total += size
+		}
+		assert.Equal(t, 100, total)
+	})
+	t.Run("MaxAge", func(t *testing.T) {
+		out := &lockedBuffer{}
+		collector, err := NewAutoFlushCollector(ctx, AutoFlushOptions{MaxSamples: 1000, MaxAge: 20 * time.Millisecond}, out)
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		for deadline := time.Now().Add(time.Second); len(out.Bytes()) == 0 && time.Now().Before(deadline); {
+			time.Sleep(5 * time.Millisecond)
+		}
+		assert.Equal(t, []int{3}, chunkSizes(t, out.Bytes()))
+		assert.Zero(t, collector.Info().SampleCount)
+
+		// a chunk that was written before its age is not
+		// written again by the timer of its first sample.
+		require.NoError(t, collector.Add(sample(3)))
+		require.NoError(t, collector.(*autoFlushCollector).Flush())
+		time.Sleep(40 * time.Millisecond)
+		assert.Equal(t, []int{3, 1}, chunkSizes(t, out.Bytes()))
+	})
+	t.Run("Asynchronous", func(t *testing.T) {
+		out := &lockedBuffer{gate: make(chan struct{})}
+		collector, err := NewAutoFlushCollector(ctx, AutoFlushOptions{MaxSamples: 2}, out)
+		require.NoError(t, err)
+
+		// the writer blocks, but the first chunk is held by the
+		// background goroutine, and the others are queued.
+		for i := 0; i < 2*(autoFlushQueueSize+1); i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		assert.Empty(t, out.Bytes())
+
+		close(out.gate)
+		require.NoError(t, collector.(*autoFlushCollector).Flush())
+		assert.Equal(t, []int{2, 2, 2, 2, 2}, chunkSizes(t, out.Bytes()))
+	})
+	t.Run("WriteErrors", func(t *testing.T) {
+		collector, err := NewAutoFlushCollector(ctx, AutoFlushOptions{MaxSamples: 2}, failingWriter{})
+		require.NoError(t, err)
+
+		require.NoError(t, collector.Add(sample(0)))
+		require.NoError(t, collector.Add(sample(1)))
+		assert.Error(t, collector.(*autoFlushCollector).Flush())
+		assert.NoError(t, collector.(*autoFlushCollector).Flush(), "errors are only reported once")
+
+		require.NoError(t, collector.Add(sample(2)))
+		assert.Error(t, collector.(*autoFlushCollector).Flush())
+	})
+	t.Run("Closed", func(t *testing.T) {
+		cctx, ccancel := context.WithCancel(ctx)
+		out := &lockedBuffer{}
+		collector, err := NewAutoFlushCollector(cctx, AutoFlushOptions{MaxSamples: 10}, out)
+		require.NoError(t, err)
+
+		require.NoError(t, collector.Add(sample(0)))
+		ccancel()
+		assert.Error(t, collector.Add(sample(1)))
+		require.NoError(t, collector.(*autoFlushCollector).Flush())
+		assert.Equal(t, []int{1}, chunkSizes(t, out.Bytes()))
+	})
+	t.Run("ExpiresAfterClose", func(t *testing.T) {
+		// the timer rotates the chunk after the context is
+		// canceled, which must neither lose the chunk nor
+		// leave Flush waiting for it.
+		for i := 0; i < 20; i++ {
+			cctx, ccancel := context.WithCancel(ctx)
+			out := &lockedBuffer{}
+			collector, err := NewAutoFlushCollector(cctx, AutoFlushOptions{MaxSamples: 10, MaxAge: 5 * time.Millisecond}, out)
+			require.NoError(t, err)
+
+			require.NoError(t, collector.Add(sample(0)))
+			ccancel()
+			for deadline := time.Now().Add(time.Second); collector.Info().SampleCount > 0 && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+
+			flushed := make(chan error)
+			go func() { flushed <- collector.(*autoFlushCollector).Flush() }()
+			select {
+			case err := <-flushed:
+				require.NoError(t, err)
+			case <-time.After(time.Second):
+				require.FailNow(t, "timed out waiting for flush")
+			}
+			assert.Equal(t, []int{1}, chunkSizes(t, out.Bytes()))
+		}
+	})
+	t.Run("FlushCollector", func(t *testing.T) {
+		collector, err := NewAutoFlushCollector(ctx, AutoFlushOptions{MaxSamples: 10}, &lockedBuffer{})
+		require.NoError(t, err)
+
+		buf := &bytes.Buffer{}
+		for i := 0; i < 4; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+		assert.Equal(t, []int{4}, chunkSizes(t, buf.Bytes()))
+		assert.EqualValues(t, 1, collector.(StatsCollector).Stats().ChunksResolved)
+	})
+}
+
+func TestPayloadSizeEstimate(t *testing.T) {
+	for name, samples := range map[string]func(int) *bsonx.Document{
+		"Constant": func(i int) *bsonx.Document { return bsonx.NewDocument(bsonx.EC.Int64("a", 1)) },
+		"Changing": func(i int) *bsonx.Document { return bsonx.NewDocument(bsonx.EC.Int64("a", int64(i*i*i))) },
+		"Mixed": func(i int) *bsonx.Document {
+			return bsonx.NewDocument(
+				bsonx.EC.Int64("a", int64(i%3)),
+				bsonx.EC.Int64("b", 7),
+				bsonx.EC.Int32("c", int32(i/10)),
+				bsonx.EC.Double("d", float64(i)/3),
+			)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			collector := &betterCollector{maxDeltas: 200, trackSize: true}
+			for i := 0; i < 200; i++ {
+				require.NoError(t, collector.Add(samples(i)))
+
+				payload, err := collector.getPayload(nil)
+				require.NoError(t, err)
+				assert.True(t, collector.payloadSize >= len(payload), "%d >= %d", collector.payloadSize, len(payload))
+				assert.True(t, collector.payloadSize <= len(payload)+4*len(collector.runs), "%d <= %d", collector.payloadSize, len(payload))
+			}
+
+			collector.Reset()
+			assert.Zero(t, collector.payloadSize)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package ftdc
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -9,6 +10,7 @@ import (
 type batchCollector struct {
 	maxSamples int
 	chunks     []*betterCollector
+	stats      collectorStats
 }
 
 // NewBatchCollector constructs a collector implementation that
@@ -40,6 +42,8 @@ func (c *batchCollector) Info() CollectorInfo {
 	return out
 }
 
+func (c *batchCollector) Stats() CollectorStats { return c.stats.export(c.Info()) }
+
 func (c *batchCollector) Reset() {
 	c.chunks = []*betterCollector{&betterCollector{maxDeltas: c.maxSamples}}
 }
@@ -63,11 +67,15 @@ func (c *batchCollector) Add(in interface{}) error {
 	return errors.WithStack(last.Add(doc))
 }
 
-func (c *batchCollector) Resolve() ([]byte, error) {
+func (c *batchCollector) Resolve() ([]byte, error)  { return c.resolve(true) }
+func (c *batchCollector) Snapshot() ([]byte, error) { return c.resolve(false) }
+
+func (c *batchCollector) resolve(record bool) ([]byte, error) {
+	start := time.Now()
 	buf := &bytes.Buffer{}
 
 	for _, chunk := range c.chunks {
-		out, err := chunk.Resolve()
+		out, err := chunk.resolve(record)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -75,5 +83,10 @@ func (c *batchCollector) Resolve() ([]byte, error) {
 		_, _ = buf.Write(out)
 	}
 
+	if record {
+		last := c.chunks[len(c.chunks)-1].stats
+		c.stats.record(time.Since(start), len(c.chunks), last.payloadSize, last.uncompressedSize)
+	}
+
 	return buf.Bytes(), nil
 }
@@ -21,6 +21,7 @@ func BenchmarkCollectorInterface(b *testing.B) {
 				b.Run(test.name, func(b *testing.B) {
 					collector := collect.factory()
 					b.Run("Add", func(b *testing.B) {
+						b.ReportAllocs()
 						for n := 0; n < b.N; n++ {
 							collector.Add(test.docs[n%len(test.docs)])
 						}
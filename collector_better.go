@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
 	"github.com/pkg/errors"
 )
 
@@ -12,10 +13,35 @@ type betterCollector struct {
 	metadata   *bsonx.Document
 	reference  *bsonx.Document
 	startedAt  time.Time
-	lastSample *extractedMetrics
+	start      time.Time
+	lastSample extractedMetrics
+	sample     extractedMetrics
 	deltas     []int64
 	numSamples int
 	maxDeltas  int
+	groupKeys  bool
+	xorFloats  bool
+	dodTimes   bool
+	hot        []bool
+	schema     *SchemaTransition
+	stats      collectorStats
+
+	// trackSize enables the estimate of the size of the payload,
+	// which is the size of the reference document and of the
+	// deltas, with the length of the trailing run of zero deltas
+	// of each metric in runs.
+	trackSize   bool
+	runs        []int
+	payloadSize int
+
+	compression Compression
+	keys        KeyProvider
+	envelope    bool
+
+	// dryRun collectors record an estimate of each chunk, rather
+	// than returning it (see NewDryRunCollector).
+	dryRun   bool
+	estimate ChunkEstimate
 }
 
 // NewBasicCollector provides a basic FTDC data collector that mirrors
@@ -28,6 +54,23 @@ func NewBaseCollector(maxSize int) Collector {
 	}
 }
 
+// NewGroupingCollector provides a collector that is equivalent to the
+// basic collector, except that metrics that do not change within a
+// chunk are grouped together at the end of the chunk's payload, so
+// that they are stored as a single run of zero deltas. This reduces
+// the size of chunks where unchanging metrics are interleaved with
+// changing metrics.
+//
+// Chunks that use this layout record it in the chunk document, and
+// are read transparently by this package, but may not be readable by
+// other FTDC implementations.
+func NewGroupingCollector(maxSize int) Collector {
+	return &betterCollector{
+		maxDeltas: maxSize,
+		groupKeys: true,
+	}
+}
+
 func (c *betterCollector) SetMetadata(in interface{}) error {
 	doc, err := readDocument(in)
 	if err != nil {
@@ -38,9 +81,13 @@ func (c *betterCollector) SetMetadata(in interface{}) error {
 }
 func (c *betterCollector) Reset() {
 	c.reference = nil
-	c.lastSample = nil
+	c.lastSample.reset()
 	c.deltas = nil
+	c.hot = nil
+	c.schema = nil
 	c.numSamples = 0
+	c.runs = nil
+	c.payloadSize = 0
 }
 
 func (c *betterCollector) Info() CollectorInfo {
@@ -49,35 +96,38 @@ func (c *betterCollector) Info() CollectorInfo {
 		num++
 	}
 
-	var metricsCount int
-	if c.lastSample == nil {
-		metricsCount = 0
-	} else {
-		metricsCount = len(c.lastSample.values)
-	}
-
 	return CollectorInfo{
 		SampleCount:  num + c.numSamples,
-		MetricsCount: metricsCount,
+		MetricsCount: len(c.lastSample.values),
 	}
 }
 
+func (c *betterCollector) Stats() CollectorStats { return c.stats.export(c.Info()) }
+
 func (c *betterCollector) Add(in interface{}) error {
 	doc, err := readDocument(in)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	var metrics extractedMetrics
 	if c.reference == nil {
-		c.reference = doc
-		metrics, err = extractMetricsFromDocument(doc)
-		if err != nil {
+		c.lastSample.reset()
+		if err = c.lastSample.extractDocument(doc); err != nil {
+			c.lastSample.reset()
 			return errors.WithStack(err)
 		}
-		c.startedAt = metrics.ts
-		c.lastSample = &metrics
+		c.reference = doc
+		c.startedAt = c.lastSample.ts
+		if !c.start.IsZero() {
+			c.startedAt = c.start
+		}
 		c.deltas = make([]int64, c.maxDeltas*len(c.lastSample.values))
+		c.hot = make([]bool, len(c.lastSample.values))
+		if c.trackSize {
+			size, _ := doc.Validate()
+			c.payloadSize = int(size) + 8
+			c.runs = make([]int, len(c.lastSample.values))
+		}
 		return nil
 	}
 
@@ -85,8 +135,13 @@ func (c *betterCollector) Add(in interface{}) error {
 		return errors.New("collector is overfull")
 	}
 
-	metrics, err = extractMetricsFromDocument(doc)
-	if err != nil {
+	// the metrics of the sample are extracted into a buffer that
+	// is swapped with the last sample once the deltas are
+	// recorded, so that adding samples with the same schema as
+	// the reference document does not allocate.
+	metrics := &c.sample
+	metrics.reset()
+	if err = metrics.extractDocument(doc); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -96,58 +151,197 @@ func (c *betterCollector) Add(in interface{}) error {
 		)
 	}
 
-	var delta int64
-	for idx := range metrics.values {
-		if metrics.types[idx] != c.lastSample.types[idx] {
+	for idx, t := range metrics.types {
+		if t != c.lastSample.types[idx] {
 			return errors.Errorf("unexpected schema change detected for sample types: [current=%v vs previous=%v]",
 				metrics.types, c.lastSample.types)
 		}
-		delta, err = extractDelta(metrics.values[idx], c.lastSample.values[idx])
-		if err != nil {
-			return errors.Wrap(err, "problem parsing data")
+	}
+
+	offset := getOffset(c.maxDeltas, c.numSamples, 0)
+	var delta int64
+	for idx, t := range metrics.types {
+		if c.xorFloats && t == bsontype.Double {
+			delta = xorFloatDelta(metrics.values[idx], c.lastSample.values[idx])
+		} else {
+			delta = extractDelta(t, metrics.values[idx], c.lastSample.values[idx])
+		}
+		c.deltas[offset] = delta
+		offset += c.maxDeltas
+		if delta != 0 {
+			c.hot[idx] = true
+		}
+		if c.trackSize {
+			c.estimateDelta(idx, delta)
 		}
-		c.deltas[getOffset(c.maxDeltas, c.numSamples, idx)] = delta
 	}
 
 	c.numSamples++
-	c.lastSample = &metrics
+	c.lastSample, c.sample = c.sample, c.lastSample
 
 	return nil
 }
 
-func (c *betterCollector) Resolve() ([]byte, error) {
+// estimateDelta adds the encoded size of the next delta of the metric
+// to the estimate of the size of the payload. Runs of zero deltas are
+// counted separately for each metric, so the estimate may exceed the
+// size of the payload, in which runs continue across metrics, by a
+// few bytes for each metric.
+func (c *betterCollector) estimateDelta(idx int, delta int64) {
+	if delta != 0 {
+		c.runs[idx] = 0
+		c.payloadSize += uvarintSize(uint64(delta))
+		return
+	}
+
+	c.runs[idx]++
+	c.payloadSize += zeroRunSize(c.runs[idx]) - zeroRunSize(c.runs[idx]-1)
+}
+
+func (c *betterCollector) Resolve() ([]byte, error)  { return c.resolve(true) }
+func (c *betterCollector) Snapshot() ([]byte, error) { return c.resolve(false) }
+
+// resolve renders the chunk, and records it in the statistics of the
+// collector if record is true.
+func (c *betterCollector) resolve(record bool) ([]byte, error) {
+	start := time.Now()
 	if c.reference == nil {
 		return nil, errors.New("no reference document")
 	}
 
-	data, err := c.getPayload()
+	var cold []byte
+	if c.groupKeys {
+		cold = coldBitmap(c.hot)
+	}
+
+	payload, err := c.getPayload(cold)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
+	data, err := compressBuffer(c.compression, payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem compressing payload")
+	}
+
+	var encryption *bsonx.Document
+	if c.keys != nil {
+		data, encryption, err = sealPayload(c.keys, c.startedAt, data)
+		if err != nil {
+			return nil, errors.Wrap(err, "problem encrypting payload")
+		}
+	}
+
 	buf := bytes.NewBuffer([]byte{})
 	if c.metadata != nil {
-		_, err := bsonx.NewDocument(
-			bsonx.EC.Time("_id", c.startedAt),
-			bsonx.EC.Int32("type", 0),
-			bsonx.EC.SubDocument("doc", c.metadata)).WriteTo(buf)
+		metadata, err := c.metadataDocument()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if c.envelope {
+			err = writeEnveloped(buf, metadata, CompressionZlib, 0, c.startedAt, c.startedAt, "")
+		} else {
+			_, err = metadata.WriteTo(buf)
+		}
 		if err != nil {
 			return nil, errors.Wrap(err, "problem writing metadata document")
 		}
 	}
 
-	_, err = bsonx.NewDocument(
+	chunk := bsonx.NewDocument(
 		bsonx.EC.Time("_id", c.startedAt),
 		bsonx.EC.Int32("type", 1),
-		bsonx.EC.Binary("data", data)).WriteTo(buf)
+		bsonx.EC.Binary("data", data))
+	if encryption == nil {
+		chunk.Append(bsonx.EC.Int64(checksumField, int64(payloadChecksum(payload))))
+	}
+	if cold != nil {
+		chunk.Append(bsonx.EC.Binary(coldMetricsField, cold))
+	}
+	if c.xorFloats && c.hasType(bsontype.Double) {
+		chunk.Append(bsonx.EC.String(floatEncodingField, floatEncodingXOR))
+	}
+	if c.dodTimes && c.hasType(bsontype.DateTime) {
+		chunk.Append(bsonx.EC.String(timeEncodingField, timeEncodingDeltaOfDelta))
+	}
+	if c.compression != CompressionZlib {
+		chunk.Append(bsonx.EC.Int32(compressionField, int32(c.compression)))
+	}
+	if c.schema != nil {
+		chunk.Append(bsonx.EC.SubDocument(schemaTransitionField, c.schema.document()))
+	}
+	if encryption != nil {
+		chunk.Append(bsonx.EC.SubDocument(encryptionField, encryption))
+	}
+
+	if c.envelope {
+		schema, _ := metricKeyHash(c.reference)
+		err = writeEnveloped(buf, chunk, c.compression, c.numSamples+1, c.startedAt, c.lastSample.ts, schema)
+	} else {
+		_, err = chunk.WriteTo(buf)
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, "problem writing metric chunk document")
 	}
 
+	if record {
+		c.stats.record(time.Since(start), 1, len(data), len(payload))
+	}
+
+	if c.dryRun {
+		c.estimate = c.estimateChunk(buf.Len(), len(data), len(payload))
+		return nil, nil
+	}
+
 	return buf.Bytes(), nil
 }
 
-func (c *betterCollector) getPayload() ([]byte, error) {
+// metadataDocument returns the metadata document of the chunk, which
+// holds the encrypted metadata in its data field, for encrypted
+// collectors.
+func (c *betterCollector) metadataDocument() (*bsonx.Document, error) {
+	if c.keys == nil {
+		return bsonx.NewDocument(
+			bsonx.EC.Time("_id", c.startedAt),
+			bsonx.EC.Int32("type", 0),
+			bsonx.EC.SubDocument("doc", c.metadata)), nil
+	}
+
+	data, err := c.metadata.MarshalBSON()
+	if err != nil {
+		return nil, errors.Wrap(err, "problem marshaling metadata document")
+	}
+	data, encryption, err := sealPayload(c.keys, c.startedAt, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem encrypting metadata document")
+	}
+
+	return bsonx.NewDocument(
+		bsonx.EC.Time("_id", c.startedAt),
+		bsonx.EC.Int32("type", 0),
+		bsonx.EC.Binary("data", data),
+		bsonx.EC.SubDocument(encryptionField, encryption)), nil
+}
+
+// hasType reports whether the chunk has any metrics of the type.
+// Chunks without double (or date time) metrics use the standard
+// format, regardless of the float (or time) encoding of the collector.
+func (c *betterCollector) hasType(bt bsontype.Type) bool {
+	for _, t := range c.lastSample.types {
+		if t == bt {
+			return true
+		}
+	}
+	return false
+}
+
+// getPayload returns the uncompressed payload of the chunk.
+func (c *betterCollector) getPayload(cold []byte) ([]byte, error) {
+	order, err := columnOrder(cold, len(c.lastSample.values))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
 	payload := bytes.NewBuffer([]byte{})
 	if _, err := c.reference.WriteTo(payload); err != nil {
 		return nil, errors.Wrap(err, "problem writing reference document")
@@ -156,9 +350,14 @@ func (c *betterCollector) getPayload() ([]byte, error) {
 	payload.Write(encodeSizeValue(uint32(len(c.lastSample.values))))
 	payload.Write(encodeSizeValue(uint32(c.numSamples)))
 	zeroCount := int64(0)
-	for i := 0; i < len(c.lastSample.values); i++ {
-		for j := 0; j < c.numSamples; j++ {
-			delta := c.deltas[getOffset(c.maxDeltas, j, i)]
+	for _, i := range order {
+		offset := getOffset(c.maxDeltas, 0, i)
+		column := c.deltas[offset : offset+c.numSamples]
+		if c.dodTimes && c.lastSample.types[i] == bsontype.DateTime {
+			column = deltaOfDeltas(column)
+		}
+
+		for _, delta := range column {
 
 			if delta == 0 {
 				zeroCount++
@@ -179,10 +378,5 @@ func (c *betterCollector) getPayload() ([]byte, error) {
 		payload.Write(encodeValue(zeroCount - 1))
 	}
 
-	data, err := compressBuffer(payload.Bytes())
-	if err != nil {
-		return nil, errors.Wrap(err, "problem compressing payload")
-	}
-
-	return data, nil
+	return payload.Bytes(), nil
 }
@@ -0,0 +1,236 @@
+package ftdc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// OverflowPolicy determines how a buffered collector handles samples
+// that are added while its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks Add until there is room in the queue,
+	// so that no samples are dropped.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest sample in the queue
+	// to make room for the new sample.
+	OverflowDropOldest
+	// OverflowDropNewest discards the new sample.
+	OverflowDropNewest
+)
+
+type bufferedCollector struct {
+	ctx     context.Context
+	wrapped Collector
+	policy  OverflowPolicy
+	queue   chan interface{}
+	dropped int64
+	catcher grip.Catcher
+
+	// mu serializes operations on the wrapped collector.
+	mu sync.Mutex
+
+	// pending is the number of samples that have been added but
+	// not yet passed to the wrapped collector (or dropped), and
+	// drained is signaled as it decreases.
+	pendingMu sync.Mutex
+	pending   int
+	stopped   bool
+	drained   *sync.Cond
+}
+
+// NewBufferedCollector wraps a collector so that Add places samples
+// in a queue of the specified size, from which a background goroutine
+// adds them to the wrapped collector, so that callers of Add are not
+// delayed by the latency of the wrapped collector (e.g. a streaming
+// collector that writes to a slow disk.) When the queue is full, the
+// policy determines whether Add blocks or a sample is dropped, and
+// Info reports the number of dropped samples. The sample count that
+// Info reports includes the queued samples.
+//
+// Resolve, Snapshot, SetMetadata, and Reset wait until every queued
+// sample has been added to the wrapped collector. Errors from adding
+// queued samples to the wrapped collector are reported by the next
+// call to Resolve.
+//
+// The background goroutine exits when the context is canceled, after
+// adding any queued samples to the wrapped collector, and Add returns
+// an error afterwards. The buffered collector is safe for concurrent
+// use.
+func NewBufferedCollector(ctx context.Context, wrapped Collector, queueSize int, policy OverflowPolicy) Collector {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	c := &bufferedCollector{
+		ctx:     ctx,
+		wrapped: wrapped,
+		policy:  policy,
+		queue:   make(chan interface{}, queueSize),
+		catcher: grip.NewBasicCatcher(),
+	}
+	c.drained = sync.NewCond(&c.pendingMu)
+
+	go c.worker()
+
+	return c
+}
+
+func (c *bufferedCollector) worker() {
+	for {
+		select {
+		case in := <-c.queue:
+			c.add(in)
+		case <-c.ctx.Done():
+			for {
+				select {
+				case in := <-c.queue:
+					c.add(in)
+				default:
+					c.pendingMu.Lock()
+					c.stopped = true
+					c.drained.Broadcast()
+					c.pendingMu.Unlock()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *bufferedCollector) add(in interface{}) {
+	c.mu.Lock()
+	c.catcher.Add(c.wrapped.Add(in))
+	c.mu.Unlock()
+
+	c.done()
+}
+
+// done records that a pending sample has been added or dropped.
+func (c *bufferedCollector) done() {
+	c.pendingMu.Lock()
+	c.pending--
+	c.drained.Broadcast()
+	c.pendingMu.Unlock()
+}
+
+// wait blocks until there are no pending samples, or the background
+// goroutine has exited.
+func (c *bufferedCollector) wait() {
+	c.pendingMu.Lock()
+	for c.pending > 0 && !c.stopped {
+		c.drained.Wait()
+	}
+	c.pendingMu.Unlock()
+}
+
+func (c *bufferedCollector) Add(in interface{}) error {
+	if err := c.ctx.Err(); err != nil {
+		return errors.Wrap(err, "buffered collector is closed")
+	}
+
+	c.pendingMu.Lock()
+	c.pending++
+	c.pendingMu.Unlock()
+
+	switch c.policy {
+	case OverflowDropNewest:
+		select {
+		case c.queue <- in:
+		default:
+			atomic.AddInt64(&c.dropped, 1)
+			c.done()
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case c.queue <- in:
+				return nil
+			default:
+			}
+
+			select {
+			case <-c.queue:
+				atomic.AddInt64(&c.dropped, 1)
+				c.done()
+			default:
+			}
+		}
+	default:
+		select {
+		case c.queue <- in:
+		case <-c.ctx.Done():
+			c.done()
+			return errors.Wrap(c.ctx.Err(), "buffered collector is closed")
+		}
+	}
+
+	return nil
+}
+
+func (c *bufferedCollector) SetMetadata(in interface{}) error {
+	c.wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return errors.WithStack(c.wrapped.SetMetadata(in))
+}
+
+func (c *bufferedCollector) Resolve() ([]byte, error) {
+	c.wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.catcher.Resolve(); err != nil {
+		c.catcher = grip.NewBasicCatcher()
+		return nil, errors.Wrap(err, "problem adding queued samples")
+	}
+
+	out, err := c.wrapped.Resolve()
+	return out, errors.WithStack(err)
+}
+
+func (c *bufferedCollector) Snapshot() ([]byte, error) {
+	c.wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out, err := snapshotCollector(c.wrapped)
+	return out, errors.WithStack(err)
+}
+
+func (c *bufferedCollector) Reset() {
+	c.wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.wrapped.Reset()
+}
+
+func (c *bufferedCollector) Info() CollectorInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info := c.wrapped.Info()
+	info.Dropped += atomic.LoadInt64(&c.dropped)
+
+	c.pendingMu.Lock()
+	if !c.stopped {
+		info.SampleCount += c.pending
+	}
+	c.pendingMu.Unlock()
+
+	return info
+}
+
+func (c *bufferedCollector) Stats() CollectorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return getCollectorStats(c.wrapped)
+}
@@ -0,0 +1,193 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedCollector blocks Add until the gate is opened, to simulate a
+// collector that writes to a slow disk.
+type gatedCollector struct {
+	gate chan struct{}
+	err  error
+	Collector
+}
+
+func (c *gatedCollector) Add(in interface{}) error {
+	<-c.gate
+	if c.err != nil {
+		return c.err
+	}
+	return c.Collector.Add(in)
+}
+
+func TestBufferedCollector(t *testing.T) {
+	newGated := func() *gatedCollector {
+		return &gatedCollector{gate: make(chan struct{}), Collector: NewBaseCollector(1000)}
+	}
+
+	t.Run("AddsInBackground", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		collector := NewBufferedCollector(ctx, NewBaseCollector(1000), 10, OverflowBlock)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, collector.Add(createEventRecord(int64(i), 1, 2, 3)))
+		}
+
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		chunk := iter.Chunk()
+		require.Equal(t, 100, chunk.Size())
+		for i, value := range chunk.Metrics[0].Values {
+			require.EqualValues(t, i, value, "samples are added in order")
+		}
+	})
+	t.Run("AddDoesNotWaitForWrappedCollector", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		wrapped := newGated()
+		collector := NewBufferedCollector(ctx, wrapped, 10, OverflowBlock)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, collector.Add(createEventRecord(int64(i), 1, 2, 3)))
+		}
+		assert.Equal(t, 10, collector.Info().SampleCount)
+
+		close(wrapped.gate)
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+		assert.NotEmpty(t, data)
+	})
+	t.Run("BlockRespectsContext", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		wrapped := newGated()
+		collector := NewBufferedCollector(ctx, wrapped, 1, OverflowBlock)
+
+		// the worker takes the first sample and blocks, the
+		// second fills the queue, and the third blocks.
+		errs := make(chan error)
+		go func() {
+			for i := 0; i < 3; i++ {
+				if err := collector.Add(createEventRecord(int64(i), 1, 2, 3)); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+
+		select {
+		case err := <-errs:
+			t.Fatalf("add returned before the context was canceled: %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		cancel()
+		assert.Error(t, <-errs)
+		close(wrapped.gate)
+		assert.Error(t, collector.Add(createEventRecord(0, 1, 2, 3)))
+		assert.Zero(t, collector.Info().Dropped)
+
+		// queued samples are added when the context is canceled.
+		_, err := collector.Resolve()
+		require.NoError(t, err)
+	})
+	t.Run("DropNewest", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		wrapped := newGated()
+		collector := NewBufferedCollector(ctx, wrapped, 5, OverflowDropNewest)
+		for i := 0; i < 20; i++ {
+			require.NoError(t, collector.Add(createEventRecord(int64(i), 1, 2, 3)))
+		}
+		close(wrapped.gate)
+
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+		dropped := collector.Info().Dropped
+		assert.True(t, dropped >= 14 && dropped <= 15, "dropped %d", dropped)
+
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		values := iter.Chunk().Metrics[0].Values
+		assert.EqualValues(t, 20-dropped, len(values))
+		assert.EqualValues(t, 0, values[0])
+	})
+	t.Run("DropOldest", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		wrapped := newGated()
+		collector := NewBufferedCollector(ctx, wrapped, 5, OverflowDropOldest)
+		for i := 0; i < 20; i++ {
+			require.NoError(t, collector.Add(createEventRecord(int64(i), 1, 2, 3)))
+		}
+		close(wrapped.gate)
+
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+		dropped := collector.Info().Dropped
+		assert.True(t, dropped >= 14 && dropped <= 15, "dropped %d", dropped)
+
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		values := iter.Chunk().Metrics[0].Values
+		require.EqualValues(t, 20-dropped, len(values))
+		assert.EqualValues(t, 19, values[len(values)-1])
+	})
+	t.Run("ReportsErrors", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		wrapped := newGated()
+		wrapped.err = errors.New("add failed")
+		close(wrapped.gate)
+		collector := NewBufferedCollector(ctx, wrapped, 5, OverflowBlock)
+
+		require.NoError(t, collector.Add(createEventRecord(0, 1, 2, 3)))
+		_, err := collector.Resolve()
+		assert.Error(t, err)
+
+		wrapped.err = nil
+		require.NoError(t, collector.Add(createEventRecord(0, 1, 2, 3)))
+		_, err = collector.Resolve()
+		assert.NoError(t, err)
+	})
+	t.Run("Concurrent", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		collector := NewBufferedCollector(ctx, NewBaseCollector(10000), 16, OverflowBlock)
+		wg := &sync.WaitGroup{}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					assert.NoError(t, collector.Add(createEventRecord(1, 1, 2, 3)))
+				}
+			}()
+		}
+		wg.Wait()
+
+		require.NoError(t, collector.SetMetadata(createEventRecord(0, 0, 0, 0)))
+		assert.Equal(t, 800, collector.Info().SampleCount)
+		assert.Zero(t, collector.Info().Dropped)
+	})
+}
@@ -0,0 +1,274 @@
+package ftdc
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CollectorContext is a variant of the Collector interface where the
+// operations that may block (adding samples to streaming collectors,
+// which may flush data, and resolving the collector) take a context,
+// so that callers can cancel or set deadlines on these operations.
+//
+// Use NewCollectorContext to convert any Collector implementation
+// into a CollectorContext, and FlushCollectorContext to write the
+// contents of a CollectorContext to an io.Writer.
+type CollectorContext interface {
+	// SetMetadata sets the metadata document for the collector or
+	// chunk. This has the same semantics as the Collector's
+	// SetMetadata, and respects the context as Add does.
+	SetMetadata(context.Context, interface{}) error
+
+	// Add extracts metrics from a document and appends it to the
+	// current collector, as with Collector's Add method. If the
+	// context is canceled before the operation completes, Add
+	// returns the context's error.
+	Add(context.Context, interface{}) error
+
+	// Resolve renders the existing documents and outputs the full
+	// FTDC chunk as a byte slice. If the context is canceled
+	// before the operation completes, Resolve returns the
+	// context's error.
+	Resolve(context.Context) ([]byte, error)
+
+	// Snapshot renders the existing documents without modifying
+	// the state of the collector, as with Collector's Snapshot
+	// method, and respects the context as Resolve does.
+	Snapshot(context.Context) ([]byte, error)
+
+	// Reset clears the collector for future use. If the context
+	// is canceled before the operation completes, Reset returns
+	// the context's error.
+	Reset(context.Context) error
+
+	// Info reports on the current state of the collector. If an
+	// operation holds the collector, Info does not wait for it,
+	// and instead returns the state of the collector after the
+	// last operation that completed, or when it was wrapped.
+	Info() CollectorInfo
+
+	// Stats reports on the state of the collector and on the
+	// chunks that it has produced. As with Info, Stats does not
+	// wait for a running operation, and returns the statistics
+	// after the last operation that completed.
+	Stats() CollectorStats
+}
+
+type contextCollector struct {
+	collector Collector
+	mu        sync.Mutex
+
+	// lastInfo and lastStats hold the state of the collector
+	// after the last operation, and are protected by statMu rather
+	// than mu, so that they remain available while an operation is
+	// stuck.
+	statMu    sync.Mutex
+	lastInfo  CollectorInfo
+	lastStats CollectorStats
+}
+
+// NewCollectorContext wraps a Collector implementation to produce a
+// CollectorContext. Operations on the underlying collector are
+// serialized and run in a background goroutine, which means that a
+// canceled operation returns to the caller immediately, even if the
+// underlying collector is blocked (e.g. writing to a stuck writer
+// during a streaming flush.)
+//
+// Operations that are abandoned because of a canceled context
+// continue in the background and subsequent operations wait for them
+// to complete (or for their own context to be canceled.) In general,
+// once an operation has been canceled the state of the collector is
+// indeterminate, and you should discard the collector.
+func NewCollectorContext(c Collector) CollectorContext {
+	cc := &contextCollector{collector: c}
+	cc.refresh()
+	return cc
+}
+
+// refresh records the info and statistics of the collector. The
+// caller must hold mu, or otherwise have exclusive access to the
+// collector.
+func (c *contextCollector) refresh() {
+	info := c.collector.Info()
+	stats := getCollectorStats(c.collector)
+
+	c.statMu.Lock()
+	defer c.statMu.Unlock()
+
+	c.lastInfo = info
+	c.lastStats = stats
+}
+
+func (c *contextCollector) do(ctx context.Context, op func()) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		// avoid running operations that were abandoned while
+		// waiting for a previous operation to complete.
+		if ctx.Err() != nil {
+			return
+		}
+
+		op()
+		c.refresh()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+func (c *contextCollector) SetMetadata(ctx context.Context, in interface{}) error {
+	var err error
+	if opErr := c.do(ctx, func() { err = c.collector.SetMetadata(in) }); opErr != nil {
+		return opErr
+	}
+
+	return errors.WithStack(err)
+}
+
+func (c *contextCollector) Reset(ctx context.Context) error {
+	return c.do(ctx, func() { c.collector.Reset() })
+}
+
+func (c *contextCollector) Info() CollectorInfo {
+	if c.mu.TryLock() {
+		c.refresh()
+		c.mu.Unlock()
+	}
+
+	c.statMu.Lock()
+	defer c.statMu.Unlock()
+
+	return c.lastInfo
+}
+
+func (c *contextCollector) Stats() CollectorStats {
+	if c.mu.TryLock() {
+		c.refresh()
+		c.mu.Unlock()
+	}
+
+	c.statMu.Lock()
+	defer c.statMu.Unlock()
+
+	return c.lastStats
+}
+
+func (c *contextCollector) infoContext(ctx context.Context) (CollectorInfo, error) {
+	var info CollectorInfo
+	if err := c.do(ctx, func() { info = c.collector.Info() }); err != nil {
+		return CollectorInfo{}, err
+	}
+
+	return info, nil
+}
+
+func (c *contextCollector) Add(ctx context.Context, in interface{}) error {
+	var err error
+	if opErr := c.do(ctx, func() { err = c.collector.Add(in) }); opErr != nil {
+		return opErr
+	}
+
+	return errors.WithStack(err)
+}
+
+func (c *contextCollector) Resolve(ctx context.Context) ([]byte, error) {
+	var (
+		out []byte
+		err error
+	)
+
+	if opErr := c.do(ctx, func() { out, err = c.collector.Resolve() }); opErr != nil {
+		return nil, opErr
+	}
+
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return out, nil
+}
+
+func (c *contextCollector) Snapshot(ctx context.Context) ([]byte, error) {
+	var (
+		out []byte
+		err error
+	)
+
+	if opErr := c.do(ctx, func() { out, err = snapshotCollector(c.collector) }); opErr != nil {
+		return nil, opErr
+	}
+
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return out, nil
+}
+
+// FlushCollectorContext writes the contents of a collector out to an
+// io.Writer, as FlushCollector, but respects the context's
+// cancellation and deadline. If the write to the underlying writer
+// does not complete before the context is canceled, the function
+// returns the context's error, the write continues in the
+// background, and the collector is not reset.
+func FlushCollectorContext(ctx context.Context, c CollectorContext, writer io.Writer) error {
+	if writer == nil {
+		return errors.New("invalid writer")
+	}
+
+	var info CollectorInfo
+	if cc, ok := c.(*contextCollector); ok {
+		var err error
+		if info, err = cc.infoContext(ctx); err != nil {
+			return errors.WithStack(err)
+		}
+	} else {
+		info = c.Info()
+	}
+
+	if info.SampleCount == 0 {
+		return nil
+	}
+
+	payload, err := c.Resolve(ctx)
+	if err != nil {
+		recordFlush(0, err)
+		return errors.WithStack(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		n, err := writer.Write(payload)
+		if err == nil && n != len(payload) {
+			err = errors.New("problem flushing data")
+		}
+		recordFlush(n, err)
+		errs <- err
+	}()
+
+	select {
+	case err = <-errs:
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "operation aborted while writing payload")
+	}
+
+	return errors.WithStack(c.Reset(ctx))
+}
@@ -0,0 +1,135 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type blockingWriter struct {
+	release chan struct{}
+	bytes.Buffer
+}
+
+func (w *blockingWriter) Write(in []byte) (int, error) {
+	<-w.release
+	return w.Buffer.Write(in)
+}
+
+func TestCollectorContext(t *testing.T) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		collector := NewCollectorContext(NewBaseCollector(100))
+		for i := 0; i < 10; i++ {
+			require.NoError(t, collector.Add(ctx, randFlatDocument(5)))
+		}
+		assert.Equal(t, 10, collector.Info().SampleCount)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, FlushCollectorContext(ctx, collector, buf))
+		assert.Zero(t, collector.Info())
+		assert.NotZero(t, buf.Len())
+
+		iter := ReadMetrics(ctx, buf)
+		count := 0
+		for iter.Next() {
+			count++
+		}
+		require.NoError(t, iter.Err())
+		assert.Equal(t, 10, count)
+	})
+	t.Run("CanceledContext", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		collector := NewCollectorContext(NewBaseCollector(100))
+		assert.Error(t, collector.Add(ctx, randFlatDocument(5)))
+		assert.Zero(t, collector.Info())
+
+		out, err := collector.Resolve(ctx)
+		assert.Error(t, err)
+		assert.Nil(t, out)
+	})
+	t.Run("StuckWriterDuringFlush", func(t *testing.T) {
+		writer := &blockingWriter{release: make(chan struct{})}
+		defer close(writer.release)
+
+		collector := NewCollectorContext(NewBaseCollector(100))
+		require.NoError(t, collector.Add(context.Background(), randFlatDocument(5)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := FlushCollectorContext(ctx, collector, writer)
+		require.Error(t, err)
+		assert.Equal(t, 1, collector.Info().SampleCount)
+	})
+	t.Run("StuckStreamingCollector", func(t *testing.T) {
+		writer := &blockingWriter{release: make(chan struct{})}
+		collector := NewCollectorContext(NewStreamingCollector(2, writer))
+		require.NoError(t, collector.Add(context.Background(), randFlatDocument(5)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		assert.Error(t, collector.Add(ctx, randFlatDocument(5)))
+
+		close(writer.release)
+		assert.NoError(t, collector.Add(context.Background(), randFlatDocument(5)))
+		assert.NotZero(t, writer.Len())
+	})
+	t.Run("StuckOperationDoesNotBlockAccessors", func(t *testing.T) {
+		writer := &blockingWriter{release: make(chan struct{})}
+		defer close(writer.release)
+
+		collector := NewCollectorContext(NewStreamingCollector(2, writer))
+		require.NoError(t, collector.Add(context.Background(), randFlatDocument(5)))
+		assert.Equal(t, 1, collector.Info().SampleCount)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Error(t, collector.Add(ctx, randFlatDocument(5)))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			assert.Equal(t, 1, collector.Info().SampleCount)
+			assert.Zero(t, collector.Stats().ChunksResolved)
+			assert.Error(t, collector.SetMetadata(ctx, randFlatDocument(1)))
+			assert.Error(t, collector.Reset(ctx))
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("accessors blocked behind a stuck operation")
+		}
+	})
+	t.Run("AccessorsBeforeOperations", func(t *testing.T) {
+		base := NewBaseCollector(100)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, base.Add(randFlatDocument(5)))
+		}
+		_, err := base.Resolve()
+		require.NoError(t, err)
+
+		// while another operation holds the collector, the
+		// accessors report the state when it was wrapped.
+		collector := NewCollectorContext(base)
+		collector.(*contextCollector).mu.Lock()
+		assert.Equal(t, 3, collector.Info().SampleCount)
+		assert.Equal(t, 5, collector.Info().MetricsCount)
+		assert.EqualValues(t, 1, collector.Stats().ChunksResolved)
+		collector.(*contextCollector).mu.Unlock()
+	})
+	t.Run("NilWriter", func(t *testing.T) {
+		collector := NewCollectorContext(NewBaseCollector(100))
+		assert.Error(t, FlushCollectorContext(context.Background(), collector, nil))
+	})
+}
@@ -0,0 +1,127 @@
+package ftdc
+
+import (
+	"sort"
+
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+)
+
+// DryRunCollector is a Collector that estimates the size of the chunks
+// that it would produce, rather than producing them, so that you can
+// evaluate the effect of sampling intervals, key filters, and other
+// settings on the size of FTDC data before deploying them.
+type DryRunCollector interface {
+	Collector
+
+	// Estimate returns the estimate of the chunk that the most
+	// recent call to Resolve or Snapshot computed, or an empty
+	// estimate if neither has been called.
+	Estimate() ChunkEstimate
+}
+
+// ChunkEstimate describes the chunk that a DryRunCollector would have
+// produced.
+type ChunkEstimate struct {
+	Samples int
+	Metrics int
+
+	// Size is the number of bytes that Resolve would have
+	// returned, including the metadata document, if any.
+	Size int
+
+	// PayloadSize and UncompressedPayloadSize are the sizes of
+	// the encoded payload of the chunk, and CompressionRatio is
+	// the ratio of the uncompressed size to the compressed size.
+	PayloadSize             int
+	UncompressedPayloadSize int
+	CompressionRatio        float64
+
+	// ReferenceSize is the size of the reference document, which
+	// the uncompressed payload holds in addition to the deltas of
+	// the metrics.
+	ReferenceSize int
+
+	// MetricSizes is the contribution of each metric to the
+	// uncompressed payload, largest first.
+	MetricSizes []MetricSize
+}
+
+// MetricSize is the number of bytes of the encoded deltas of a metric
+// in an uncompressed payload. Runs of zero deltas are counted for
+// each metric separately, so the sizes of metrics that do not change
+// may add up to a few bytes more than the payload, in which runs
+// continue across metrics.
+type MetricSize struct {
+	Key   string
+	Bytes int
+}
+
+// NewDryRunCollector provides a collector that is equivalent to the
+// basic collector, except that Resolve and Snapshot return no data:
+// they compute the chunk, including its compression, and record its
+// estimate, which you read with the Estimate method. Collector
+// statistics (see Stats) count the chunks as if they were produced.
+func NewDryRunCollector(maxSize int) DryRunCollector {
+	return &betterCollector{
+		maxDeltas: maxSize,
+		dryRun:    true,
+	}
+}
+
+func (c *betterCollector) Estimate() ChunkEstimate { return c.estimate }
+
+// estimateChunk returns the estimate of a chunk of the size, in
+// bytes, with payloads of the sizes.
+func (c *betterCollector) estimateChunk(size, payloadSize, uncompressedSize int) ChunkEstimate {
+	out := ChunkEstimate{
+		Samples:                 c.numSamples + 1,
+		Metrics:                 len(c.lastSample.values),
+		Size:                    size,
+		PayloadSize:             payloadSize,
+		UncompressedPayloadSize: uncompressedSize,
+		MetricSizes:             make([]MetricSize, 0, len(c.lastSample.values)),
+	}
+	if payloadSize > 0 {
+		out.CompressionRatio = float64(uncompressedSize) / float64(payloadSize)
+	}
+	if refSize, err := c.reference.Validate(); err == nil {
+		out.ReferenceSize = int(refSize)
+	}
+
+	metrics := metricForDocument(nil, c.reference)
+	for idx := range c.lastSample.values {
+		offset := getOffset(c.maxDeltas, 0, idx)
+		column := c.deltas[offset : offset+c.numSamples]
+		if c.dodTimes && c.lastSample.types[idx] == bsontype.DateTime {
+			column = deltaOfDeltas(column)
+		}
+
+		metric := MetricSize{Bytes: deltasSize(column)}
+		if idx < len(metrics) {
+			metric.Key = metrics[idx].Key()
+		}
+		out.MetricSizes = append(out.MetricSizes, metric)
+	}
+	sort.SliceStable(out.MetricSizes, func(i, j int) bool {
+		return out.MetricSizes[i].Bytes > out.MetricSizes[j].Bytes
+	})
+
+	return out
+}
+
+// deltasSize returns the size of the encoding of the deltas, with runs
+// of zero deltas encoded as they are in payloads.
+func deltasSize(deltas []int64) int {
+	size, run := 0, 0
+	for _, delta := range deltas {
+		if delta == 0 {
+			run++
+			continue
+		}
+
+		size += zeroRunSize(run) + uvarintSize(uint64(delta))
+		run = 0
+	}
+
+	return size + zeroRunSize(run)
+}
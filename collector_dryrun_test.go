@@ -0,0 +1,88 @@
+package ftdc
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunCollector(t *testing.T) {
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	sample := func(i int) *bsonx.Document {
+		return bsonx.NewDocument(
+			bsonx.EC.Time("ts", start.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("counter", int64(i*i*1000)),
+			bsonx.EC.Int64("constant", 42),
+			bsonx.EC.SubDocument("mem", bsonx.NewDocument(bsonx.EC.Int32("resident", int32(i%3)))),
+		)
+	}
+
+	base := NewBaseCollector(100)
+	collector := NewDryRunCollector(100)
+	assert.Zero(t, collector.Estimate().Size)
+	for _, c := range []Collector{base, collector} {
+		require.NoError(t, c.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "example"))))
+		for i := 0; i < 50; i++ {
+			require.NoError(t, c.Add(sample(i)))
+		}
+	}
+
+	expected, err := base.Resolve()
+	require.NoError(t, err)
+
+	out, err := collector.Resolve()
+	require.NoError(t, err)
+	assert.Nil(t, out)
+
+	estimate := collector.Estimate()
+	assert.Equal(t, 50, estimate.Samples)
+	assert.Equal(t, 4, estimate.Metrics)
+	assert.Equal(t, len(expected), estimate.Size)
+	stats := base.(StatsCollector).Stats()
+	assert.Equal(t, stats.PayloadSize, estimate.PayloadSize)
+	assert.Equal(t, stats.UncompressedPayloadSize, estimate.UncompressedPayloadSize)
+	assert.Equal(t, stats.CompressionRatio, estimate.CompressionRatio)
+	assert.True(t, estimate.CompressionRatio > 1)
+
+	t.Run("MetricSizes", func(t *testing.T) {
+		require.Len(t, estimate.MetricSizes, 4)
+		sizes := map[string]int{}
+		for idx, metric := range estimate.MetricSizes {
+			sizes[metric.Key] = metric.Bytes
+			if idx > 0 {
+				assert.True(t, metric.Bytes <= estimate.MetricSizes[idx-1].Bytes, "metrics are sorted")
+			}
+		}
+		require.Len(t, sizes, 4)
+
+		// a metric that never changes is a single run of
+		// zeros, and negative deltas are the largest.
+		assert.Equal(t, 2, sizes["constant"])
+		assert.Equal(t, "mem.resident", estimate.MetricSizes[0].Key)
+		assert.True(t, sizes["counter"] > sizes["ts"])
+
+		// the payload holds the reference document, the
+		// number of metrics and of deltas, and the deltas.
+		total := estimate.ReferenceSize + 8
+		for _, metric := range estimate.MetricSizes {
+			total += metric.Bytes
+		}
+		assert.True(t, total >= estimate.UncompressedPayloadSize, "%d >= %d", total, estimate.UncompressedPayloadSize)
+		assert.True(t, total-estimate.UncompressedPayloadSize <= 2*len(estimate.MetricSizes))
+	})
+	t.Run("Flush", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, FlushCollector(collector, buf))
+		assert.Zero(t, buf.Len())
+		assert.Zero(t, collector.Info().SampleCount)
+		assert.EqualValues(t, 2, collector.(StatsCollector).Stats().ChunksResolved)
+		assert.Equal(t, 50, collector.Estimate().Samples)
+
+		_, err := collector.Resolve()
+		assert.Error(t, err)
+	})
+}
@@ -2,6 +2,7 @@ package ftdc
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -11,6 +12,8 @@ type dynamicCollector struct {
 	chunks     []*batchCollector
 	hash       string
 	currentNum int
+	hasher     schemaHasher
+	stats      collectorStats
 }
 
 // NewDynamicCollector constructs a Collector that records metrics
@@ -40,6 +43,8 @@ func (c *dynamicCollector) Info() CollectorInfo {
 	return out
 }
 
+func (c *dynamicCollector) Stats() CollectorStats { return c.stats.export(c.Info()) }
+
 func (c *dynamicCollector) Reset() {
 	c.chunks = []*batchCollector{newBatchCollector(c.maxSamples)}
 	c.hash = ""
@@ -56,7 +61,7 @@ func (c *dynamicCollector) Add(in interface{}) error {
 	}
 
 	if c.hash == "" {
-		docHash, num := metricKeyHash(doc)
+		docHash, num := c.hasher.hash(doc)
 		c.hash = docHash
 		c.currentNum = num
 		return errors.WithStack(c.chunks[0].Add(doc))
@@ -64,7 +69,7 @@ func (c *dynamicCollector) Add(in interface{}) error {
 
 	lastChunk := c.chunks[len(c.chunks)-1]
 
-	docHash, _ := metricKeyHash(doc)
+	docHash, _ := c.hasher.hash(doc)
 	if c.hash == docHash {
 		return errors.WithStack(lastChunk.Add(doc))
 	}
@@ -75,15 +80,26 @@ func (c *dynamicCollector) Add(in interface{}) error {
 	return errors.WithStack(chunk.Add(doc))
 }
 
-func (c *dynamicCollector) Resolve() ([]byte, error) {
+func (c *dynamicCollector) Resolve() ([]byte, error)  { return c.resolve(true) }
+func (c *dynamicCollector) Snapshot() ([]byte, error) { return c.resolve(false) }
+
+func (c *dynamicCollector) resolve(record bool) ([]byte, error) {
+	start := time.Now()
 	buf := bytes.NewBuffer([]byte{})
+	count := 0
 	for _, chunk := range c.chunks {
-		out, err := chunk.Resolve()
+		out, err := chunk.resolve(record)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 
 		_, _ = buf.Write(out)
+		count += len(chunk.chunks)
+	}
+
+	if record {
+		last := c.chunks[len(c.chunks)-1].stats
+		c.stats.record(time.Since(start), count, last.payloadSize, last.uncompressedSize)
 	}
 
 	return buf.Bytes(), nil
@@ -0,0 +1,130 @@
+package ftdc
+
+import (
+	"fmt"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// KeyFilterOptions configures the key filtering collector. Keys are
+// the flattened, dot-separated names of metrics, as returned by
+// Metric.Key(), and elements of arrays have their index in the input
+// array as the last component of their key.
+//
+// A metric is kept if it matches the Include matcher, or if Include is
+// nil, and does not match the Exclude matcher, so that Exclude takes
+// precedence when a key matches both.
+type KeyFilterOptions struct {
+	Include KeyMatcher
+	Exclude KeyMatcher
+}
+
+// Validate ensures that the filter options are reasonable.
+func (opts KeyFilterOptions) Validate() error {
+	if opts.Include == nil && opts.Exclude == nil {
+		return errors.New("must specify keys to include or exclude")
+	}
+
+	return nil
+}
+
+func (opts KeyFilterOptions) keep(key string) bool {
+	if opts.Include != nil && !opts.Include.MatchKey(key) {
+		return false
+	}
+
+	return opts.Exclude == nil || !opts.Exclude.MatchKey(key)
+}
+
+type keyFilterCollector struct {
+	opts KeyFilterOptions
+	Collector
+}
+
+// NewKeyFilterCollector wraps a collector and removes the metrics
+// whose keys the options do not keep from each document before it
+// reaches the underlying collector, so that the removed metrics are
+// never stored. Embedded documents and arrays that hold no metrics
+// after filtering are removed, and the remaining elements of filtered
+// arrays are shifted to fill the gaps.
+//
+// The collector returns an error during Add if the options are not
+// valid.
+func NewKeyFilterCollector(opts KeyFilterOptions, collector Collector) Collector {
+	return &keyFilterCollector{
+		opts:      opts,
+		Collector: collector,
+	}
+}
+
+func (c *keyFilterCollector) Stats() CollectorStats     { return getCollectorStats(c.Collector) }
+func (c *keyFilterCollector) Snapshot() ([]byte, error) { return snapshotCollector(c.Collector) }
+
+func (c *keyFilterCollector) Add(in interface{}) error {
+	if err := c.opts.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(c.Collector.Add(c.filterDocument("", doc)))
+}
+
+func (c *keyFilterCollector) filterDocument(prefix string, doc *bsonx.Document) *bsonx.Document {
+	out := bsonx.DC.Make(doc.Len())
+
+	iter := doc.Iterator()
+	for iter.Next() {
+		elem := iter.Element()
+		key := elem.Key()
+		if val := c.filterValue(joinKey(prefix, key), elem.Value()); val != nil {
+			out.Append(bsonx.EC.FromValue(key, val))
+		}
+	}
+
+	return out
+}
+
+func (c *keyFilterCollector) filterArray(prefix string, array *bsonx.Array) *bsonx.Array {
+	out := bsonx.MakeArray(array.Len())
+
+	idx := 0
+	iter := array.Iterator()
+	for iter.Next() {
+		if val := c.filterValue(fmt.Sprintf("%s.%d", prefix, idx), iter.Value()); val != nil {
+			out.Append(val)
+		}
+		idx++
+	}
+
+	return out
+}
+
+// filterValue returns the filtered value, or nil if the value should
+// be removed.
+func (c *keyFilterCollector) filterValue(key string, val *bsonx.Value) *bsonx.Value {
+	switch val.Type() {
+	case bsontype.EmbeddedDocument:
+		doc := c.filterDocument(key, val.MutableDocument())
+		if doc.Len() == 0 {
+			return nil
+		}
+		return bsonx.VC.Document(doc)
+	case bsontype.Array:
+		array := c.filterArray(key, val.MutableArray())
+		if array.Len() == 0 {
+			return nil
+		}
+		return bsonx.VC.Array(array)
+	default:
+		if !c.opts.keep(key) {
+			return nil
+		}
+		return val
+	}
+}
@@ -0,0 +1,124 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyFilterCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mustGlob := func(t *testing.T, patterns ...string) KeyMatcher {
+		matcher, err := NewGlobMatcher(patterns...)
+		require.NoError(t, err)
+		return matcher
+	}
+	sample := func(i int64) *bsonx.Document {
+		return bsonx.NewDocument(
+			bsonx.EC.Int64("a", i),
+			bsonx.EC.SubDocumentFromElements("debug",
+				bsonx.EC.Int64("x", i),
+				bsonx.EC.Int64("y", i),
+			),
+			bsonx.EC.SubDocumentFromElements("stats",
+				bsonx.EC.Int64("ops", i),
+				bsonx.EC.Int64("debugOps", i),
+				bsonx.EC.ArrayFromElements("lat", bsonx.VC.Int64(i), bsonx.VC.Int64(i+1), bsonx.VC.Int64(i+2)),
+			),
+		)
+	}
+	// keys returns the keys of the metrics in the files that the
+	// collector writes.
+	keys := func(t *testing.T, collector Collector) []string {
+		buf := &bytes.Buffer{}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		iter := ReadChunks(ctx, buf)
+		defer iter.Close()
+		require.True(t, iter.Next())
+		out := []string{}
+		for _, metric := range iter.Chunk().Metrics {
+			out = append(out, metric.Key())
+		}
+		assert.False(t, iter.Next())
+		require.NoError(t, iter.Err())
+		return out
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		collector := NewKeyFilterCollector(KeyFilterOptions{}, NewBaseCollector(10))
+		assert.Error(t, collector.Add(sample(1)))
+		assert.Zero(t, collector.Info())
+		assert.Error(t, collector.Add(nil))
+	})
+	for name, test := range map[string]struct {
+		opts     func(*testing.T) KeyFilterOptions
+		expected []string
+	}{
+		"Exclude": {
+			opts: func(t *testing.T) KeyFilterOptions {
+				return KeyFilterOptions{Exclude: mustGlob(t, "debug.**", "**.debug*")}
+			},
+			expected: []string{"a", "stats.ops", "stats.lat.0", "stats.lat.1", "stats.lat.2"},
+		},
+		"Include": {
+			opts: func(t *testing.T) KeyFilterOptions {
+				return KeyFilterOptions{Include: mustGlob(t, "stats.*")}
+			},
+			expected: []string{"stats.ops", "stats.debugOps"},
+		},
+		"ExcludeTakesPrecedence": {
+			opts: func(t *testing.T) KeyFilterOptions {
+				return KeyFilterOptions{
+					Include: mustGlob(t, "stats.**"),
+					Exclude: mustGlob(t, "stats.debugOps", "stats.lat.1"),
+				}
+			},
+			expected: []string{"stats.ops", "stats.lat.0", "stats.lat.1"},
+		},
+		"Func": {
+			opts: func(t *testing.T) KeyFilterOptions {
+				return KeyFilterOptions{Include: KeyMatcherFunc(func(key string) bool { return key == "a" })}
+			},
+			expected: []string{"a"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			collector := NewKeyFilterCollector(test.opts(t), NewBaseCollector(10))
+			for i := int64(0); i < 5; i++ {
+				require.NoError(t, collector.Add(sample(i)))
+			}
+			assert.Equal(t, 5, collector.Info().SampleCount)
+			assert.Equal(t, len(test.expected), collector.Info().MetricsCount)
+			assert.Equal(t, test.expected, keys(t, collector))
+		})
+	}
+	t.Run("ArraysShift", func(t *testing.T) {
+		collector := NewKeyFilterCollector(KeyFilterOptions{Exclude: mustGlob(t, "stats.lat.0")}, NewBaseCollector(10))
+		require.NoError(t, collector.Add(sample(10)))
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, FlushCollector(collector, buf))
+		iter := ReadChunks(ctx, buf)
+		defer iter.Close()
+		require.True(t, iter.Next())
+		metrics := iter.Chunk().Metrics
+		require.Len(t, metrics, 7)
+		assert.Equal(t, "stats.lat.0", metrics[5].Key())
+		assert.Equal(t, []int64{11}, metrics[5].Values)
+		assert.Equal(t, "stats.lat.1", metrics[6].Key())
+		assert.Equal(t, []int64{12}, metrics[6].Values)
+	})
+	t.Run("DoesNotModifyInput", func(t *testing.T) {
+		collector := NewKeyFilterCollector(KeyFilterOptions{Exclude: mustGlob(t, "debug.**")}, NewBaseCollector(10))
+		doc := sample(1)
+		require.NoError(t, collector.Add(doc))
+		assert.NotNil(t, doc.Lookup("debug").MutableDocument().Lookup("x"))
+	})
+}
@@ -0,0 +1,222 @@
+package ftdc
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// ArrayPolicy describes how a flattening collector stores the values
+// of arrays.
+type ArrayPolicy string
+
+const (
+	// ArrayExpand stores each element of an array as a metric,
+	// with the index of the element as the last component of its
+	// key. This is the default behavior of collectors.
+	ArrayExpand ArrayPolicy = "expand"
+	// ArraySum stores the sum of the numeric and boolean elements
+	// of an array as a single metric, which is an int64, or a
+	// double if the array has any double elements. Other elements
+	// are ignored, and empty arrays sum to zero.
+	ArraySum ArrayPolicy = "sum"
+	// ArrayFirst stores only the first element of an array, in
+	// place of the array. Empty arrays are removed.
+	ArrayFirst ArrayPolicy = "first"
+	// ArrayLast stores only the last element of an array, in
+	// place of the array. Empty arrays are removed.
+	ArrayLast ArrayPolicy = "last"
+)
+
+// Validate returns an error if the policy is not one of the defined
+// policies.
+func (p ArrayPolicy) Validate() error {
+	switch p {
+	case ArrayExpand, ArraySum, ArrayFirst, ArrayLast:
+		return nil
+	default:
+		return errors.Errorf("invalid array policy '%s'", p)
+	}
+}
+
+// CollectorOptions configures how the flattening collector maps the
+// fields of documents to metrics.
+//
+// Arrays with many, or a varying number of, elements produce many
+// metrics, and change the schema of the chunk whenever their length
+// changes. MaxArrayLength limits the number of elements of expanded
+// arrays that are stored, and the aggregating policies store a single
+// metric for each array.
+type CollectorOptions struct {
+	// Separator, when set, flattens documents before they're
+	// collected: embedded documents and expanded arrays are
+	// replaced by top-level fields, named by joining the keys of
+	// their path with the separator, so that Metric.Key() returns
+	// the joined name (e.g. "opcounters_insert" with "_".) When
+	// empty, documents keep their structure, and readers join
+	// keys with ".".
+	Separator string
+	// Arrays is the policy for arrays, and defaults to
+	// ArrayExpand.
+	Arrays ArrayPolicy
+	// MaxArrayLength, when positive, is the number of elements of
+	// expanded arrays that are stored; subsequent elements are
+	// discarded.
+	MaxArrayLength int
+}
+
+// Validate ensures that the options are reasonable.
+func (opts CollectorOptions) Validate() error {
+	if strings.Contains(opts.Separator, "\x00") {
+		return errors.New("separator must not contain null bytes")
+	}
+	if opts.MaxArrayLength < 0 {
+		return errors.New("max array length must not be negative")
+	}
+	if opts.Arrays != "" {
+		return errors.WithStack(opts.Arrays.Validate())
+	}
+
+	return nil
+}
+
+type flatteningCollector struct {
+	opts CollectorOptions
+	Collector
+}
+
+// NewFlatteningCollector wraps a collector and rewrites each document
+// according to the options before it reaches the underlying
+// collector, to control the keys of the metrics and the handling of
+// arrays. The collector does not detect keys that collide after
+// flattening (e.g. "a_b" and "a.b" with the "_" separator), so choose
+// a separator that does not occur in the keys of the documents.
+// Returns an error if the options are not valid.
+func NewFlatteningCollector(opts CollectorOptions, collector Collector) (Collector, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+
+	return &flatteningCollector{
+		opts:      opts,
+		Collector: collector,
+	}, nil
+}
+
+func (c *flatteningCollector) Stats() CollectorStats     { return getCollectorStats(c.Collector) }
+func (c *flatteningCollector) Snapshot() ([]byte, error) { return snapshotCollector(c.Collector) }
+
+func (c *flatteningCollector) Add(in interface{}) error {
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(c.Collector.Add(c.opts.document(doc)))
+}
+
+func (opts CollectorOptions) document(doc *bsonx.Document) *bsonx.Document {
+	out := bsonx.DC.Make(doc.Len())
+
+	iter := doc.Iterator()
+	for iter.Next() {
+		elem := iter.Element()
+		opts.addValue(out, elem.Key(), elem.Value())
+	}
+
+	return out
+}
+
+// addValue appends the value, with the key, to the document, after
+// applying the options to embedded documents and arrays.
+func (opts CollectorOptions) addValue(out *bsonx.Document, key string, val *bsonx.Value) {
+	switch val.Type() {
+	case bsontype.EmbeddedDocument:
+		doc := val.MutableDocument()
+		if opts.Separator == "" {
+			out.Append(bsonx.EC.SubDocument(key, opts.document(doc)))
+			return
+		}
+
+		iter := doc.Iterator()
+		for iter.Next() {
+			elem := iter.Element()
+			opts.addValue(out, key+opts.Separator+elem.Key(), elem.Value())
+		}
+	case bsontype.Array:
+		array := val.MutableArray()
+		switch opts.Arrays {
+		case ArraySum:
+			out.Append(bsonx.EC.FromValue(key, sumArray(array)))
+		case ArrayFirst:
+			if array.Len() > 0 {
+				opts.addValue(out, key, array.Lookup(0))
+			}
+		case ArrayLast:
+			if array.Len() > 0 {
+				opts.addValue(out, key, array.Lookup(uint(array.Len()-1)))
+			}
+		default:
+			num := array.Len()
+			if opts.MaxArrayLength > 0 && num > opts.MaxArrayLength {
+				num = opts.MaxArrayLength
+			}
+
+			if opts.Separator != "" {
+				for idx := 0; idx < num; idx++ {
+					opts.addValue(out, key+opts.Separator+strconv.Itoa(idx), array.Lookup(uint(idx)))
+				}
+				return
+			}
+
+			elems := bsonx.DC.Make(num)
+			for idx := 0; idx < num; idx++ {
+				opts.addValue(elems, strconv.Itoa(idx), array.Lookup(uint(idx)))
+			}
+			values := bsonx.MakeArray(elems.Len())
+			iter := elems.Iterator()
+			for iter.Next() {
+				values.Append(iter.Element().Value())
+			}
+			out.Append(bsonx.EC.Array(key, values))
+		}
+	default:
+		out.Append(bsonx.EC.FromValue(key, val))
+	}
+}
+
+// sumArray returns the sum of the numeric and boolean elements of the
+// array, as a double if any of the elements are doubles.
+func sumArray(array *bsonx.Array) *bsonx.Value {
+	var (
+		sum       int64
+		floatSum  float64
+		hasDouble bool
+	)
+
+	iter := array.Iterator()
+	for iter.Next() {
+		val := iter.Value()
+		switch val.Type() {
+		case bsontype.Int32:
+			sum += int64(val.Int32())
+		case bsontype.Int64:
+			sum += val.Int64()
+		case bsontype.Boolean:
+			if val.Boolean() {
+				sum++
+			}
+		case bsontype.Double:
+			floatSum += val.Double()
+			hasDouble = true
+		}
+	}
+
+	if hasDouble {
+		return bsonx.VC.Double(floatSum + float64(sum))
+	}
+	return bsonx.VC.Int64(sum)
+}
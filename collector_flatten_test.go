@@ -0,0 +1,169 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlatteningCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sample := func(i int64, lat ...*bsonx.Value) *bsonx.Document {
+		return bsonx.NewDocument(
+			bsonx.EC.Int64("a", i),
+			bsonx.EC.SubDocumentFromElements("stats",
+				bsonx.EC.Int64("ops", i),
+				bsonx.EC.ArrayFromElements("lat", lat...),
+				bsonx.EC.ArrayFromElements("shards",
+					bsonx.VC.DocumentFromElements(bsonx.EC.Int32("conns", int32(i))),
+					bsonx.VC.DocumentFromElements(bsonx.EC.Int32("conns", int32(i+1))),
+				),
+			),
+		)
+	}
+	lat := func(values ...int64) []*bsonx.Value {
+		out := make([]*bsonx.Value, len(values))
+		for idx, v := range values {
+			out[idx] = bsonx.VC.Int64(v)
+		}
+		return out
+	}
+	// metrics returns the metrics in the file that the collector
+	// writes.
+	metrics := func(t *testing.T, collector Collector) []Metric {
+		buf := &bytes.Buffer{}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		iter := ReadChunks(ctx, buf)
+		defer iter.Close()
+		require.True(t, iter.Next())
+		out := iter.Chunk().Metrics
+		assert.False(t, iter.Next())
+		require.NoError(t, iter.Err())
+		return out
+	}
+	keys := func(metrics []Metric) []string {
+		out := []string{}
+		for _, metric := range metrics {
+			out = append(out, metric.Key())
+		}
+		return out
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for _, opts := range []CollectorOptions{
+			{Separator: "\x00"},
+			{MaxArrayLength: -1},
+			{Arrays: "median"},
+		} {
+			collector, err := NewFlatteningCollector(opts, NewBaseCollector(10))
+			assert.Error(t, err)
+			assert.Nil(t, collector)
+		}
+
+		collector, err := NewFlatteningCollector(CollectorOptions{}, NewBaseCollector(10))
+		require.NoError(t, err)
+		assert.Error(t, collector.Add(nil))
+	})
+	for name, test := range map[string]struct {
+		opts     CollectorOptions
+		expected []string
+	}{
+		"Default": {
+			expected: []string{"a", "stats.ops", "stats.lat.0", "stats.lat.1", "stats.lat.2", "stats.shards.0.conns", "stats.shards.1.conns"},
+		},
+		"Separator": {
+			opts:     CollectorOptions{Separator: "_"},
+			expected: []string{"a", "stats_ops", "stats_lat_0", "stats_lat_1", "stats_lat_2", "stats_shards_0_conns", "stats_shards_1_conns"},
+		},
+		"MaxArrayLength": {
+			opts:     CollectorOptions{MaxArrayLength: 1},
+			expected: []string{"a", "stats.ops", "stats.lat.0", "stats.shards.0.conns"},
+		},
+		"MaxArrayLengthSeparator": {
+			opts:     CollectorOptions{Separator: "/", MaxArrayLength: 2},
+			expected: []string{"a", "stats/ops", "stats/lat/0", "stats/lat/1", "stats/shards/0/conns", "stats/shards/1/conns"},
+		},
+		"Sum": {
+			opts:     CollectorOptions{Arrays: ArraySum},
+			expected: []string{"a", "stats.ops", "stats.lat", "stats.shards"},
+		},
+		"First": {
+			opts:     CollectorOptions{Arrays: ArrayFirst},
+			expected: []string{"a", "stats.ops", "stats.lat", "stats.shards.conns"},
+		},
+		"LastSeparator": {
+			opts:     CollectorOptions{Arrays: ArrayLast, Separator: ":"},
+			expected: []string{"a", "stats:ops", "stats:lat", "stats:shards:conns"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			collector, err := NewFlatteningCollector(test.opts, NewBaseCollector(10))
+			require.NoError(t, err)
+			for i := int64(0); i < 5; i++ {
+				require.NoError(t, collector.Add(sample(i, lat(i, i+1, i+2)...)))
+			}
+			assert.Equal(t, 5, collector.Info().SampleCount)
+			assert.Equal(t, len(test.expected), collector.Info().MetricsCount)
+			assert.Equal(t, test.expected, keys(metrics(t, collector)))
+		})
+	}
+	t.Run("Aggregations", func(t *testing.T) {
+		for policy, expected := range map[ArrayPolicy][]int64{
+			ArraySum:   {6, 3, 0},
+			ArrayFirst: {1, 3},
+			ArrayLast:  {3, 3},
+		} {
+			t.Run(string(policy), func(t *testing.T) {
+				collector, err := NewFlatteningCollector(CollectorOptions{Arrays: policy}, NewDynamicCollector(10))
+				require.NoError(t, err)
+				// empty arrays sum to zero, but are removed
+				// by the other policies, which changes the
+				// schema.
+				for _, values := range [][]int64{{1, 2, 3}, {3}, {}} {
+					require.NoError(t, collector.Add(bsonx.NewDocument(
+						bsonx.EC.Int64("n", int64(len(values))),
+						bsonx.EC.ArrayFromElements("lat", lat(values...)...),
+					)))
+				}
+
+				buf := &bytes.Buffer{}
+				require.NoError(t, FlushCollector(collector, buf))
+				iter := ReadMetrics(ctx, buf)
+				defer iter.Close()
+				values := []int64{}
+				for iter.Next() {
+					if val := iter.Document().Lookup("lat"); val != nil {
+						values = append(values, val.Int64())
+					}
+				}
+				require.NoError(t, iter.Err())
+				assert.Equal(t, expected, values)
+			})
+		}
+		t.Run("SumTypes", func(t *testing.T) {
+			sum := sumArray(bsonx.NewArray(bsonx.VC.Int32(1), bsonx.VC.Int64(2), bsonx.VC.Boolean(true), bsonx.VC.String("x")))
+			assert.Equal(t, bsontype.Int64, sum.Type())
+			assert.EqualValues(t, 4, sum.Int64())
+
+			sum = sumArray(bsonx.NewArray(bsonx.VC.Int32(1), bsonx.VC.Double(0.5)))
+			assert.Equal(t, bsontype.Double, sum.Type())
+			assert.Equal(t, 1.5, sum.Double())
+		})
+	})
+	t.Run("DoesNotModifyInput", func(t *testing.T) {
+		collector, err := NewFlatteningCollector(CollectorOptions{Separator: "_", Arrays: ArraySum}, NewBaseCollector(10))
+		require.NoError(t, err)
+		doc := sample(1, lat(1, 2)...)
+		expected := doc.Copy()
+		require.NoError(t, collector.Add(doc))
+		assert.True(t, doc.Equal(expected))
+	})
+}
@@ -0,0 +1,98 @@
+package ftdc
+
+import (
+	"io"
+	"time"
+)
+
+// CollectorHooks are callbacks that observe the operations of a
+// collector, so that you can emit telemetry about collectors (e.g.
+// the latency of samples, or slow flushes) without modifying their
+// implementation. Any hook may be nil. Hooks are called synchronously,
+// after the operation that they observe, and should return quickly.
+type CollectorHooks struct {
+	// OnAdd is called after each call to the collector's Add
+	// method, with the duration and the error of the call.
+	OnAdd func(duration time.Duration, err error)
+
+	// OnFlush is called after each call to the collector's
+	// Resolve method, with the number of samples in the
+	// collector, the size of the resolved chunk, in bytes, and the
+	// duration and the error of the call.
+	OnFlush func(samples, size int, duration time.Duration, err error)
+
+	// OnChunkWritten is called after each write to a writer
+	// wrapped with the Writer method, with the size of the data,
+	// in bytes, and the duration and the error of the write.
+	OnChunkWritten func(size int, duration time.Duration, err error)
+}
+
+type hookedCollector struct {
+	hooks CollectorHooks
+	Collector
+}
+
+// NewHookedCollector wraps a collector so that the hooks observe its
+// Add and Resolve operations.
+//
+// Collectors that write chunks themselves (e.g. streaming
+// collectors) resolve those chunks internally, without calling the
+// wrapper's Resolve method. To observe those chunks, create the
+// collector with a writer wrapped by CollectorHooks.Writer, which
+// calls OnChunkWritten for every chunk that the collector writes.
+func NewHookedCollector(collector Collector, hooks CollectorHooks) Collector {
+	return &hookedCollector{
+		hooks:     hooks,
+		Collector: collector,
+	}
+}
+
+func (c *hookedCollector) Stats() CollectorStats     { return getCollectorStats(c.Collector) }
+func (c *hookedCollector) Snapshot() ([]byte, error) { return snapshotCollector(c.Collector) }
+
+func (c *hookedCollector) Add(in interface{}) error {
+	if c.hooks.OnAdd == nil {
+		return c.Collector.Add(in)
+	}
+
+	start := time.Now()
+	err := c.Collector.Add(in)
+	c.hooks.OnAdd(time.Since(start), err)
+	return err
+}
+
+func (c *hookedCollector) Resolve() ([]byte, error) {
+	if c.hooks.OnFlush == nil {
+		return c.Collector.Resolve()
+	}
+
+	samples := c.Collector.Info().SampleCount
+	start := time.Now()
+	data, err := c.Collector.Resolve()
+	c.hooks.OnFlush(samples, len(data), time.Since(start), err)
+	return data, err
+}
+
+// Writer wraps the writer so that the OnChunkWritten hook observes
+// every write. Collectors write each chunk with a single write, so
+// the hook observes each chunk that a collector writes to the
+// writer. If the hook is nil, Writer returns the writer.
+func (h CollectorHooks) Writer(w io.Writer) io.Writer {
+	if h.OnChunkWritten == nil {
+		return w
+	}
+
+	return &hookedWriter{hook: h.OnChunkWritten, writer: w}
+}
+
+type hookedWriter struct {
+	hook   func(int, time.Duration, error)
+	writer io.Writer
+}
+
+func (w *hookedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := w.writer.Write(p)
+	w.hook(n, time.Since(start), err)
+	return n, err
+}
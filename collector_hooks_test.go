@@ -0,0 +1,77 @@
+package ftdc
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectorHooks(t *testing.T) {
+	var (
+		adds      int
+		addErrors int
+		flushes   []int
+		written   []int
+	)
+	hooks := CollectorHooks{
+		OnAdd: func(dur time.Duration, err error) {
+			adds++
+			if err != nil {
+				addErrors++
+			}
+		},
+		OnFlush: func(samples, size int, dur time.Duration, err error) {
+			assert.NoError(t, err)
+			assert.True(t, size > 0)
+			flushes = append(flushes, samples)
+		},
+		OnChunkWritten: func(size int, dur time.Duration, err error) {
+			written = append(written, size)
+		},
+	}
+
+	t.Run("Collector", func(t *testing.T) {
+		collector := NewHookedCollector(NewBaseCollector(10), hooks)
+		for i := 0; i < 5; i++ {
+			require.NoError(t, collector.Add(randFlatDocument(3)))
+		}
+		assert.Error(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("different", 1))))
+
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+		assert.NotEmpty(t, data)
+
+		assert.Equal(t, 6, adds)
+		assert.Equal(t, 1, addErrors)
+		assert.Equal(t, []int{5}, flushes)
+		assert.Equal(t, 5, collector.Info().SampleCount)
+	})
+	t.Run("Writer", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		collector := NewStreamingCollector(2, hooks.Writer(buf))
+		for i := 0; i < 5; i++ {
+			require.NoError(t, collector.Add(randFlatDocument(3)))
+		}
+		require.Len(t, written, 2)
+		assert.Equal(t, buf.Len(), written[0]+written[1])
+
+		var writeErr error
+		w := CollectorHooks{OnChunkWritten: func(_ int, _ time.Duration, err error) { writeErr = err }}.Writer(failingWriter{})
+		_, err := w.Write([]byte("chunk"))
+		assert.Error(t, err)
+		assert.Equal(t, err, writeErr)
+	})
+	t.Run("NilHooks", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		assert.True(t, CollectorHooks{}.Writer(buf) == buf)
+
+		collector := NewHookedCollector(NewBaseCollector(10), CollectorHooks{})
+		require.NoError(t, collector.Add(randFlatDocument(3)))
+		_, err := collector.Resolve()
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,293 @@
+package ftdc
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+)
+
+const (
+	journalMetadata int32 = 0
+	journalSample   int32 = 1
+)
+
+// JournalingCollector is a Collector that records the samples that it
+// has not yet flushed in a journal file, so that they can be
+// recovered with RecoverCollector if the process exits before the
+// collector is flushed.
+type JournalingCollector interface {
+	Collector
+
+	// Close closes the journal file. If the collector holds no
+	// unflushed samples, the journal file is removed.
+	Close() error
+}
+
+type journalingCollector struct {
+	path     string
+	file     *os.File
+	size     int64
+	offsets  []int64
+	metadata *bsonx.Document
+	Collector
+}
+
+// NewJournalingCollector wraps a collector, typically a streaming
+// collector, and writes every document passed to Add to a journal
+// file at the specified path before adding it to the wrapped
+// collector. The journal only holds the samples that the wrapped
+// collector has not yet flushed: it is truncated when the collector
+// is flushed, either by FlushCollector or, for streaming collectors,
+// during Add.
+//
+// Journal writes are not synced to disk, so the journal protects
+// against the process exiting or being killed, but not against the
+// loss of the host.
+//
+// An existing journal at the path is replaced, so you must recover
+// any samples in it with RecoverCollector before constructing a new
+// journaling collector.
+func NewJournalingCollector(path string, collector Collector) (JournalingCollector, error) {
+	if collector == nil {
+		return nil, errors.New("must specify a collector")
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening journal '%s'", path)
+	}
+
+	return &journalingCollector{
+		path:      path,
+		file:      file,
+		Collector: collector,
+	}, nil
+}
+
+func (c *journalingCollector) Stats() CollectorStats     { return getCollectorStats(c.Collector) }
+func (c *journalingCollector) Snapshot() ([]byte, error) { return snapshotCollector(c.Collector) }
+
+func (c *journalingCollector) SetMetadata(in interface{}) error {
+	if in == nil {
+		c.metadata = nil
+		return errors.WithStack(c.Collector.SetMetadata(in))
+	}
+
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err = c.Collector.SetMetadata(doc); err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.metadata = doc
+	_, err = c.write(journalMetadata, doc)
+	return errors.Wrap(err, "problem journaling metadata")
+}
+
+func (c *journalingCollector) Add(in interface{}) error {
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	offset := c.size
+	if _, err = c.write(journalSample, doc); err != nil {
+		return errors.Wrap(err, "problem journaling sample")
+	}
+	c.offsets = append(c.offsets, offset)
+
+	if err = c.Collector.Add(doc); err != nil {
+		// the collector rejected the sample, so remove it from the
+		// journal so that it's not recovered later.
+		c.offsets = c.offsets[:len(c.offsets)-1]
+		if terr := c.truncate(offset); terr != nil {
+			return errors.Wrapf(err, "problem removing rejected sample from journal: %s", terr.Error())
+		}
+		return errors.WithStack(err)
+	}
+
+	// if the collector flushed any samples, it holds fewer than
+	// the journal, and only the most recent samples remain.
+	if pending := c.Collector.Info().SampleCount; pending < len(c.offsets) {
+		return errors.WithStack(c.compact(pending))
+	}
+
+	return nil
+}
+
+func (c *journalingCollector) Reset() {
+	c.Collector.Reset()
+	// Reset cannot return an error; a journal that isn't
+	// truncated holds samples that were flushed, which are
+	// recovered as duplicates.
+	_ = c.compact(0)
+}
+
+func (c *journalingCollector) Close() error {
+	pending := len(c.offsets)
+	if err := c.file.Close(); err != nil {
+		return errors.Wrapf(err, "problem closing journal '%s'", c.path)
+	}
+
+	if pending == 0 {
+		return errors.Wrapf(os.Remove(c.path), "problem removing journal '%s'", c.path)
+	}
+
+	return nil
+}
+
+func (c *journalingCollector) write(entryType int32, doc *bsonx.Document) (int64, error) {
+	n, err := bsonx.NewDocument(
+		bsonx.EC.Int32("type", entryType),
+		bsonx.EC.SubDocument("doc", doc),
+	).WriteTo(c.file)
+	c.size += n
+
+	return n, errors.WithStack(err)
+}
+
+// truncate discards the end of the journal, starting at the offset.
+func (c *journalingCollector) truncate(offset int64) error {
+	if err := c.file.Truncate(offset); err != nil {
+		return errors.Wrap(err, "problem truncating journal")
+	}
+	if _, err := c.file.Seek(offset, io.SeekStart); err != nil {
+		return errors.Wrap(err, "problem truncating journal")
+	}
+	c.size = offset
+
+	return nil
+}
+
+// compact rewrites the journal so that it only holds the metadata and
+// the most recent samples.
+func (c *journalingCollector) compact(keep int) error {
+	if keep > len(c.offsets) {
+		keep = len(c.offsets)
+	}
+
+	var (
+		tail  []byte
+		sizes []int64
+	)
+	if keep > 0 {
+		offsets := c.offsets[len(c.offsets)-keep:]
+		tail = make([]byte, c.size-offsets[0])
+		if _, err := c.file.ReadAt(tail, offsets[0]); err != nil {
+			return errors.Wrap(err, "problem reading journal")
+		}
+		for idx := range offsets {
+			if idx+1 < len(offsets) {
+				sizes = append(sizes, offsets[idx+1]-offsets[idx])
+			} else {
+				sizes = append(sizes, c.size-offsets[idx])
+			}
+		}
+	}
+
+	if err := c.truncate(0); err != nil {
+		return errors.WithStack(err)
+	}
+	c.offsets = c.offsets[:0]
+
+	if c.metadata != nil {
+		if _, err := c.write(journalMetadata, c.metadata); err != nil {
+			return errors.Wrap(err, "problem journaling metadata")
+		}
+	}
+
+	if len(tail) == 0 {
+		return nil
+	}
+
+	start := c.size
+	n, err := c.file.Write(tail)
+	c.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "problem rewriting journal")
+	}
+
+	for _, size := range sizes {
+		c.offsets = append(c.offsets, start)
+		start += size
+	}
+
+	return nil
+}
+
+// RecoverCollector reads the journal written by a journaling collector
+// and returns a collector that holds the samples that the journaling
+// collector had not flushed, along with its metadata. Flush the
+// returned collector (e.g. with FlushCollector) to persist the
+// recovered samples.
+//
+// A partially written sample at the end of the journal, as left by a
+// process that exited during a write, is ignored.
+func RecoverCollector(path string) (Collector, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening journal '%s'", path)
+	}
+	defer file.Close()
+
+	var (
+		metadata *bsonx.Document
+		samples  []*bsonx.Document
+	)
+
+	buf := bufio.NewReader(file)
+	for {
+		entry, err := readBufBSON(buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem reading journal '%s'", path)
+		}
+
+		doc, ok := entry.Lookup("doc").MutableDocumentOK()
+		if !ok {
+			return nil, errors.Errorf("malformed entry in journal '%s'", path)
+		}
+
+		entryType, ok := entry.Lookup("type").Int32OK()
+		if !ok {
+			return nil, errors.Errorf("malformed entry in journal '%s'", path)
+		}
+
+		switch entryType {
+		case journalMetadata:
+			metadata = doc
+		case journalSample:
+			samples = append(samples, doc)
+		default:
+			return nil, errors.Errorf("unknown entry in journal '%s'", path)
+		}
+	}
+
+	size := len(samples)
+	if size == 0 {
+		size = 1
+	}
+
+	collector := NewDynamicCollector(size)
+	if metadata != nil {
+		if err = collector.SetMetadata(metadata); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	for idx, doc := range samples {
+		if err = collector.Add(doc); err != nil {
+			return nil, errors.Wrapf(err, "problem recovering sample %d", idx)
+		}
+	}
+
+	return collector, nil
+}
@@ -0,0 +1,143 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func recoveredSamples(t *testing.T, ctx context.Context, path string) ([]*bsonx.Document, *bsonx.Document) {
+	collector, err := RecoverCollector(path)
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, FlushCollector(collector, buf))
+
+	iter := ReadChunks(ctx, buf)
+	defer iter.Close()
+
+	var metadata *bsonx.Document
+	out := []*bsonx.Document{}
+	for iter.Next() {
+		chunk := iter.Chunk()
+		metadata = chunk.GetMetadata()
+		samples := chunk.Iterator(ctx)
+		for samples.Next() {
+			out = append(out, samples.Document())
+		}
+		require.NoError(t, samples.Err())
+		samples.Close()
+	}
+	require.NoError(t, iter.Err())
+
+	return out, metadata
+}
+
+func TestJournalingCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "ftdc-journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sample := func(i int) *bsonx.Document {
+		return bsonx.NewDocument(bsonx.EC.Int64("a", int64(i)), bsonx.EC.Int64("b", int64(i*2)))
+	}
+
+	t.Run("InvalidCollector", func(t *testing.T) {
+		collector, err := NewJournalingCollector(filepath.Join(dir, "invalid"), nil)
+		assert.Error(t, err)
+		assert.Nil(t, collector)
+	})
+	t.Run("RecoverMissing", func(t *testing.T) {
+		collector, err := RecoverCollector(filepath.Join(dir, "missing"))
+		assert.Error(t, err)
+		assert.Nil(t, collector)
+	})
+	t.Run("Streaming", func(t *testing.T) {
+		path := filepath.Join(dir, "streaming")
+		output := &bytes.Buffer{}
+		collector, err := NewJournalingCollector(path, NewStreamingCollector(10, output))
+		require.NoError(t, err)
+		require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("process", "test"))))
+
+		for i := 0; i < 25; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		assert.NotZero(t, output.Len())
+
+		// recover without closing, as if the process had exited.
+		samples, metadata := recoveredSamples(t, ctx, path)
+		require.Len(t, samples, 5)
+		for idx, doc := range samples {
+			assert.True(t, sample(20+idx).Equal(doc))
+		}
+		require.NotNil(t, metadata)
+		assert.Equal(t, "test", metadata.Lookup("doc").MutableDocument().Lookup("process").StringValue())
+
+		t.Run("PartialWrite", func(t *testing.T) {
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+			require.NoError(t, err)
+			data, err := sample(100).MarshalBSON()
+			require.NoError(t, err)
+			_, err = f.Write(data[:len(data)/2])
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			samples, _ := recoveredSamples(t, ctx, path)
+			assert.Len(t, samples, 5)
+		})
+
+		require.NoError(t, FlushCollector(collector, output))
+		samples, _ = recoveredSamples(t, ctx, path)
+		assert.Len(t, samples, 0)
+
+		require.NoError(t, collector.Close())
+		_, err = os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run("SchemaChange", func(t *testing.T) {
+		path := filepath.Join(dir, "dynamic")
+		collector, err := NewJournalingCollector(path, NewStreamingDynamicCollector(10, &bytes.Buffer{}))
+		require.NoError(t, err)
+
+		for i := 0; i < 5; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		other := bsonx.NewDocument(bsonx.EC.Int64("c", 42))
+		require.NoError(t, collector.Add(other))
+
+		samples, _ := recoveredSamples(t, ctx, path)
+		require.Len(t, samples, 1)
+		assert.True(t, other.Equal(samples[0]))
+
+		require.NoError(t, collector.Close())
+		_, err = os.Stat(path)
+		assert.NoError(t, err)
+	})
+	t.Run("RejectedSample", func(t *testing.T) {
+		path := filepath.Join(dir, "rejected")
+		collector, err := NewJournalingCollector(path, NewBaseCollector(2))
+		require.NoError(t, err)
+		defer collector.Close()
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		assert.Error(t, collector.Add(sample(3)))
+
+		samples, _ := recoveredSamples(t, ctx, path)
+		require.Len(t, samples, 3)
+		for idx, doc := range samples {
+			assert.True(t, sample(idx).Equal(doc))
+		}
+	})
+}
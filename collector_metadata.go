@@ -0,0 +1,227 @@
+package ftdc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// Metadata History
+//
+// Collectors write a single metadata document, which SetMetadata
+// replaces. Metadata collectors instead record a history of
+// timestamped metadata documents (e.g. build info, followed by host
+// info, followed by every configuration reload) in the "history"
+// array of the metadata document that they pass to the wrapped
+// collector. The fields of the most recent document are also copied
+// to the top level of the metadata document, so that readers that are
+// not aware of the history see the current metadata.
+const metadataHistoryField = "history"
+
+// MetadataEntry is a metadata document and the time at which it was
+// recorded.
+type MetadataEntry struct {
+	Timestamp time.Time
+	Document  *bsonx.Document
+}
+
+func (e MetadataEntry) document() *bsonx.Document {
+	return bsonx.NewDocument(
+		bsonx.EC.Time("ts", e.Timestamp),
+		bsonx.EC.SubDocument("doc", e.Document),
+	)
+}
+
+func readMetadataEntry(doc *bsonx.Document) (MetadataEntry, error) {
+	out := MetadataEntry{}
+
+	var ok bool
+	if out.Timestamp, ok = doc.Lookup("ts").TimeOK(); !ok {
+		return out, errors.New("metadata entry has no timestamp")
+	}
+	if out.Document, ok = doc.Lookup("doc").MutableDocumentOK(); !ok {
+		return out, errors.New("metadata entry has no document")
+	}
+
+	return out, nil
+}
+
+// MetadataCollector is a Collector that holds a history of metadata
+// documents rather than a single document.
+type MetadataCollector interface {
+	Collector
+
+	// AppendMetadata adds a metadata document, and the time at
+	// which it was recorded, to the end of the history. Chunks
+	// that the collector resolves after the call hold the entire
+	// history.
+	AppendMetadata(time.Time, interface{}) error
+
+	// MetadataHistory returns the metadata documents in the
+	// history, oldest first.
+	MetadataHistory() []MetadataEntry
+}
+
+type metadataCollector struct {
+	history []MetadataEntry
+	Collector
+}
+
+// NewMetadataCollector wraps a collector so that it records a history
+// of metadata documents, which you add with AppendMetadata. Use
+// ChunkIterator.MetadataHistory to read the history back.
+//
+// SetMetadata replaces the history with a single document, recorded
+// at the current time, or clears it, if the document is nil.
+func NewMetadataCollector(collector Collector) MetadataCollector {
+	return &metadataCollector{Collector: collector}
+}
+
+func (c *metadataCollector) Stats() CollectorStats     { return getCollectorStats(c.Collector) }
+func (c *metadataCollector) Snapshot() ([]byte, error) { return snapshotCollector(c.Collector) }
+
+func (c *metadataCollector) SetMetadata(in interface{}) error {
+	if in == nil {
+		c.history = nil
+		return errors.WithStack(c.Collector.SetMetadata(nil))
+	}
+
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(c.setHistory([]MetadataEntry{{Timestamp: time.Now(), Document: doc}}))
+}
+
+func (c *metadataCollector) AppendMetadata(ts time.Time, in interface{}) error {
+	if in == nil {
+		return errors.New("cannot append a nil metadata document")
+	}
+
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	history := make([]MetadataEntry, len(c.history), len(c.history)+1)
+	copy(history, c.history)
+
+	return errors.WithStack(c.setHistory(append(history, MetadataEntry{Timestamp: ts, Document: doc})))
+}
+
+func (c *metadataCollector) MetadataHistory() []MetadataEntry { return c.history }
+
+func (c *metadataCollector) setHistory(history []MetadataEntry) error {
+	current := history[len(history)-1].Document
+	if current.LookupElement(metadataHistoryField) != nil {
+		return errors.Errorf("metadata documents cannot have a '%s' field", metadataHistoryField)
+	}
+
+	entries := bsonx.NewArray()
+	for _, entry := range history {
+		entries.Append(bsonx.VC.Document(entry.document()))
+	}
+
+	metadata := current.Copy()
+	metadata.Append(bsonx.EC.Array(metadataHistoryField, entries))
+
+	if err := c.Collector.SetMetadata(metadata); err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.history = history
+	return nil
+}
+
+// metadataHistory returns the metadata history recorded in the
+// metadata of the chunk, or, for chunks that were not written by a
+// metadata collector, a single entry with the metadata document, if
+// any, and the time at which it was written.
+func (c *Chunk) metadataHistory() ([]MetadataEntry, error) {
+	metadata := c.userMetadata()
+	if metadata == nil {
+		return nil, nil
+	}
+
+	elem := metadata.LookupElement(metadataHistoryField)
+	if elem == nil {
+		ts, _ := c.metadata.Lookup("_id").TimeOK()
+		return []MetadataEntry{{Timestamp: ts, Document: metadata}}, nil
+	}
+
+	history, ok := elem.Value().MutableArrayOK()
+	if !ok {
+		return nil, errors.New("metadata history field is not an array")
+	}
+
+	out := make([]MetadataEntry, 0, history.Len())
+	iter := history.Iterator()
+	for iter.Next() {
+		value := iter.Value()
+		if value.Type() != bsontype.EmbeddedDocument {
+			return nil, errors.Errorf("metadata entry %d is not a document", len(out))
+		}
+
+		entry, err := readMetadataEntry(value.MutableDocument())
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem reading metadata entry %d", len(out))
+		}
+		out = append(out, entry)
+	}
+
+	return out, nil
+}
+
+// metadataLog accumulates the distinct metadata entries of the chunks
+// that an iterator returns, in order. Every chunk written by a
+// metadata collector holds the entire history, and every chunk
+// written by other collectors holds the same metadata document with a
+// different timestamp, so entries are identified by their contents.
+type metadataLog struct {
+	last    *bsonx.Document
+	seen    map[string]struct{}
+	entries []MetadataEntry
+}
+
+func (l *metadataLog) add(chunk *Chunk) error {
+	if chunk.metadata == nil || chunk.metadata == l.last {
+		return nil
+	}
+	l.last = chunk.metadata
+
+	history, err := chunk.metadataHistory()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if l.seen == nil {
+		l.seen = map[string]struct{}{}
+	}
+
+	// entries in a history are distinguished by their
+	// timestamps, as the same document may be recorded more than
+	// once, (e.g. when a configuration is reloaded and reverted.)
+	timestamped := chunk.userMetadata().LookupElement(metadataHistoryField) != nil
+	for _, entry := range history {
+		data, err := entry.Document.MarshalBSON()
+		if err != nil {
+			return errors.Wrap(err, "problem encoding metadata document")
+		}
+
+		key := string(data)
+		if timestamped {
+			key = fmt.Sprint(entry.Timestamp.UnixNano(), key)
+		}
+		if _, ok := l.seen[key]; ok {
+			continue
+		}
+
+		l.seen[key] = struct{}{}
+		l.entries = append(l.entries, entry)
+	}
+
+	return nil
+}
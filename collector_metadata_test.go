@@ -0,0 +1,119 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(i int) *bsonx.Document {
+		return bsonx.NewDocument(bsonx.EC.Int64("a", int64(i)))
+	}
+	readHistory := func(t *testing.T, data []byte) []MetadataEntry {
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		for iter.Next() {
+			require.NotNil(t, iter.Chunk())
+		}
+		require.NoError(t, iter.Err())
+		return iter.MetadataHistory()
+	}
+
+	t.Run("AppendMetadata", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		collector := NewMetadataCollector(NewBaseCollector(10))
+		require.NoError(t, collector.AppendMetadata(base, bsonx.NewDocument(bsonx.EC.String("build", "v1"))))
+		require.NoError(t, collector.AppendMetadata(base.Add(time.Second), bsonx.NewDocument(bsonx.EC.String("host", "example"))))
+		require.Len(t, collector.MetadataHistory(), 2)
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		// the same configuration is recorded twice, and both
+		// entries are kept.
+		config := bsonx.NewDocument(bsonx.EC.Int32("level", 1))
+		require.NoError(t, collector.AppendMetadata(base.Add(time.Minute), config))
+		for i := 0; i < 10; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+		require.NoError(t, collector.AppendMetadata(base.Add(time.Hour), config))
+		for i := 0; i < 10; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		history := readHistory(t, buf.Bytes())
+		require.Len(t, history, 4)
+		for idx, expected := range []time.Duration{0, time.Second, time.Minute, time.Hour} {
+			assert.True(t, base.Add(expected).Equal(history[idx].Timestamp), "entry %d", idx)
+		}
+		assert.Equal(t, "v1", history[0].Document.Lookup("build").StringValue())
+		assert.Equal(t, "example", history[1].Document.Lookup("host").StringValue())
+		assert.EqualValues(t, 1, history[3].Document.Lookup("level").Int32())
+	})
+	t.Run("CurrentMetadata", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		collector := NewMetadataCollector(NewBaseCollector(10))
+		require.NoError(t, collector.AppendMetadata(base, bsonx.NewDocument(bsonx.EC.String("host", "first"))))
+		require.NoError(t, collector.AppendMetadata(base, bsonx.NewDocument(bsonx.EC.String("host", "second"))))
+		require.NoError(t, collector.Add(sample(0)))
+		require.NoError(t, FlushCollector(collector, buf))
+
+		// readers that don't know about the history see the most
+		// recent document.
+		iter := ReadChunks(ctx, buf)
+		defer iter.Close()
+		require.True(t, iter.Next())
+		assert.Equal(t, "second", iter.Chunk().GetMetadata().Lookup("doc").MutableDocument().Lookup("host").StringValue())
+	})
+	t.Run("SetMetadataReplacesHistory", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		collector := NewMetadataCollector(NewBaseCollector(10))
+		require.NoError(t, collector.AppendMetadata(base, bsonx.NewDocument(bsonx.EC.String("host", "first"))))
+		require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "second"))))
+		require.Len(t, collector.MetadataHistory(), 1)
+
+		require.NoError(t, collector.Add(sample(0)))
+		require.NoError(t, FlushCollector(collector, buf))
+		history := readHistory(t, buf.Bytes())
+		require.Len(t, history, 1)
+		assert.Equal(t, "second", history[0].Document.Lookup("host").StringValue())
+	})
+	t.Run("Errors", func(t *testing.T) {
+		collector := NewMetadataCollector(NewBaseCollector(10))
+		assert.Error(t, collector.AppendMetadata(base, nil))
+		assert.Error(t, collector.AppendMetadata(base, map[string]string{"a": "b"}))
+		assert.Error(t, collector.AppendMetadata(base, bsonx.NewDocument(bsonx.EC.Int32(metadataHistoryField, 1))))
+		assert.Empty(t, collector.MetadataHistory())
+	})
+	t.Run("PlainMetadata", func(t *testing.T) {
+		// chunks from ordinary collectors repeat their metadata
+		// document, which is reported once per change.
+		buf := &bytes.Buffer{}
+		collector := NewBaseCollector(10)
+		for _, host := range []string{"first", "first", "second"} {
+			require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", host))))
+			require.NoError(t, collector.Add(sample(0)))
+			require.NoError(t, FlushCollector(collector, buf))
+		}
+
+		history := readHistory(t, buf.Bytes())
+		require.Len(t, history, 2)
+		assert.Equal(t, "first", history[0].Document.Lookup("host").StringValue())
+		assert.Equal(t, "second", history[1].Document.Lookup("host").StringValue())
+		assert.False(t, history[0].Timestamp.IsZero())
+	})
+}
@@ -0,0 +1,79 @@
+package ftdc
+
+import (
+	"github.com/pkg/errors"
+)
+
+// RotatingFileCollector is a streaming collector that writes its
+// chunks to a directory of files, which it rotates and prunes
+// according to its RotationOptions, in the same way as the mongod
+// "diagnostic.data" directory. Schema changes between samples start a
+// new chunk, as with the streaming dynamic collector.
+//
+// Because the collector holds an open file, you must call Close when
+// you are done with it, which writes the remaining samples to the
+// current file. Like other collectors, it is not safe for concurrent
+// use.
+type RotatingFileCollector struct {
+	writer *rotatingWriter
+	Collector
+}
+
+// NewRotatingFileCollector returns a collector that writes chunks of
+// opts.SampleCount samples to files in the directory, which is created
+// if it does not exist.
+func NewRotatingFileCollector(dir string, opts RotationOptions) (*RotatingFileCollector, error) {
+	writer, err := newRotatingWriter(dir, opts)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &RotatingFileCollector{
+		writer:    writer,
+		Collector: NewStreamingDynamicCollector(writer.opts.SampleCount, writer),
+	}, nil
+}
+
+// SetMetadata sets the metadata document that is written at the
+// beginning of every file, starting with the next file that the
+// collector creates.
+func (c *RotatingFileCollector) SetMetadata(in interface{}) error {
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.writer.metadata = doc
+	return nil
+}
+
+// Flush writes the buffered samples to the current file, as a chunk
+// that holds fewer than SampleCount samples.
+func (c *RotatingFileCollector) Flush() error {
+	return errors.WithStack(FlushCollector(c.Collector, c.writer))
+}
+
+// Rotate writes the buffered samples to the current file, and closes
+// it, so that subsequent samples are written to a new file.
+func (c *RotatingFileCollector) Rotate() error {
+	if err := c.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(c.writer.rotate())
+}
+
+// Close writes the buffered samples to the current file, and closes
+// it. Adding samples after Close creates a new file.
+func (c *RotatingFileCollector) Close() error { return c.Rotate() }
+
+// Stats reports the statistics of the underlying streaming collector.
+func (c *RotatingFileCollector) Stats() CollectorStats { return getCollectorStats(c.Collector) }
+
+// Snapshot renders the buffered samples, which are not yet written to
+// the current file.
+func (c *RotatingFileCollector) Snapshot() ([]byte, error) { return snapshotCollector(c.Collector) }
+
+// CurrentFile returns the name of the file that the collector is
+// writing to, or an empty string if there is no open file.
+func (c *RotatingFileCollector) CurrentFile() string { return c.writer.name }
@@ -0,0 +1,125 @@
+package ftdc
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFileCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "ftdc-rotating-collector")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sample := func(i int) *bsonx.Document {
+		return bsonx.NewDocument(bsonx.EC.Int64("a", int64(i)), bsonx.EC.Int64("b", int64(i*2)))
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		_, err := NewRotatingFileCollector(dir, RotationOptions{SampleCount: -1})
+		assert.Error(t, err)
+		_, err = NewRotatingFileCollector(dir, RotationOptions{Prefix: "a/b"})
+		assert.Error(t, err)
+	})
+	t.Run("RotatesAndPrunes", func(t *testing.T) {
+		path := filepath.Join(dir, "prune")
+
+		metadata := bsonx.NewDocument(bsonx.EC.String("host", "example"))
+
+		// measure the size of a file holding the metadata and
+		// one chunk, so that files rotate after two chunks, and
+		// two files fit within the total size.
+		probe, err := NewRotatingFileCollector(filepath.Join(dir, "probe"), RotationOptions{SampleCount: 10})
+		require.NoError(t, err)
+		require.NoError(t, probe.SetMetadata(metadata))
+		for i := 0; i < 10; i++ {
+			require.NoError(t, probe.Add(sample(i)))
+		}
+		require.NoError(t, probe.Close())
+		files, err := probe.writer.files()
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		size := files[0].Size()
+
+		collector, err := NewRotatingFileCollector(path, RotationOptions{
+			SampleCount:  10,
+			MaxFileSize:  size + 1,
+			MaxTotalSize: size * 4,
+		})
+		require.NoError(t, err)
+		require.NoError(t, collector.SetMetadata(metadata))
+
+		for i := 0; i < 100; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		require.NoError(t, collector.Close())
+		assert.Empty(t, collector.CurrentFile())
+
+		files, err = collector.writer.files()
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+		for _, info := range files {
+			num, metadata := countSamples(t, ctx, filepath.Join(path, info.Name()))
+			assert.Equal(t, 20, num)
+			require.NotNil(t, metadata)
+			assert.Equal(t, "example", metadata.Lookup("doc").MutableDocument().Lookup("host").StringValue())
+		}
+	})
+	t.Run("FlushAndRotate", func(t *testing.T) {
+		path := filepath.Join(dir, "flush")
+		collector, err := NewRotatingFileCollector(path, RotationOptions{})
+		require.NoError(t, err)
+
+		for i := 0; i < 5; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		require.NoError(t, collector.Flush())
+		first := collector.CurrentFile()
+		require.NotEmpty(t, first)
+		num, _ := countSamples(t, ctx, first)
+		assert.Equal(t, 5, num)
+
+		require.NoError(t, collector.Add(sample(5)))
+		require.NoError(t, collector.Rotate())
+		assert.Empty(t, collector.CurrentFile())
+		num, _ = countSamples(t, ctx, first)
+		assert.Equal(t, 6, num)
+
+		require.NoError(t, collector.Add(sample(6)))
+		require.NoError(t, collector.Close())
+
+		files, err := collector.writer.files()
+		require.NoError(t, err)
+		assert.Len(t, files, 2)
+	})
+	t.Run("RotatesOnInterval", func(t *testing.T) {
+		path := filepath.Join(dir, "interval")
+		collector, err := NewRotatingFileCollector(path, RotationOptions{
+			SampleCount:    1,
+			RotateInterval: time.Millisecond,
+		})
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+			time.Sleep(2 * time.Millisecond)
+		}
+		require.NoError(t, collector.Close())
+
+		// files are rotated after the write that exceeds the
+		// interval, so the first file holds two samples.
+		files, err := collector.writer.files()
+		require.NoError(t, err)
+		assert.Len(t, files, 2)
+	})
+}
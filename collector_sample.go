@@ -3,6 +3,8 @@ package ftdc
 import (
 	"time"
 
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/mongodb/grip"
 	"github.com/pkg/errors"
 )
 
@@ -23,6 +25,9 @@ func NewSamplingCollector(minimumInterval time.Duration, collector Collector) Co
 	}
 }
 
+func (c *samplingCollector) Stats() CollectorStats     { return getCollectorStats(c.Collector) }
+func (c *samplingCollector) Snapshot() ([]byte, error) { return snapshotCollector(c.Collector) }
+
 func (c *samplingCollector) Add(d interface{}) error {
 	if time.Since(c.lastCollection) < c.minimumInterval {
 		return nil
@@ -32,3 +37,154 @@ func (c *samplingCollector) Add(d interface{}) error {
 
 	return errors.WithStack(c.Collector.Add(d))
 }
+
+// AdaptiveSamplingOptions configures an adaptive sampling collector.
+type AdaptiveSamplingOptions struct {
+	// MinInterval and MaxInterval bound the sampling interval,
+	// which starts at the maximum. Both must be positive.
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// Threshold is the change in a numeric (int32, int64, or
+	// double) metric, since the last recorded document, that
+	// causes the collector to record a document and tighten the
+	// interval. The threshold must not be zero, and should
+	// usually be relative, so that it applies to metrics of any
+	// magnitude.
+	Threshold Threshold
+	// Factor is the factor by which the interval grows after each
+	// recorded document without changes, and shrinks after each
+	// recorded document with changes. Defaults to 2.
+	Factor float64
+}
+
+// Validate ensures that the options are reasonable, and sets default
+// values.
+func (opts *AdaptiveSamplingOptions) Validate() error {
+	if opts.Factor == 0 {
+		opts.Factor = 2
+	}
+
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(opts.MinInterval <= 0, "minimum interval must be positive")
+	catcher.NewWhen(opts.MaxInterval < opts.MinInterval, "maximum interval must not be less than minimum interval")
+	catcher.NewWhen(opts.Threshold.isZero(), "must specify a threshold")
+	catcher.NewWhen(opts.Threshold.Absolute < 0 || opts.Threshold.Relative < 0, "threshold values must not be negative")
+	catcher.NewWhen(opts.Factor <= 1, "factor must be greater than one")
+
+	return catcher.Resolve()
+}
+
+type adaptiveSamplingCollector struct {
+	opts           AdaptiveSamplingOptions
+	interval       time.Duration
+	lastCollection time.Time
+	last           extractedMetrics
+	now            func() time.Time
+	Collector
+}
+
+// NewAdaptiveSamplingCollector wraps a collector, like the sampling
+// collector, but adapts the sampling interval to the data: documents
+// in which a numeric metric has changed beyond the threshold, since
+// the last recorded document, are recorded as soon as the minimum
+// interval has elapsed, and tighten the interval, while documents
+// without such changes are only recorded once the current interval
+// has elapsed, and relax the interval, up to the maximum interval.
+// Bursts of activity are recorded at high resolution, while idle
+// periods are not.
+//
+// Documents whose schema differs from the last recorded document are
+// treated as changed. The collector returns an error during Add if
+// the options are not valid.
+func NewAdaptiveSamplingCollector(opts AdaptiveSamplingOptions, collector Collector) Collector {
+	return &adaptiveSamplingCollector{
+		opts:      opts,
+		interval:  opts.MaxInterval,
+		now:       time.Now,
+		Collector: collector,
+	}
+}
+
+func (c *adaptiveSamplingCollector) Stats() CollectorStats     { return getCollectorStats(c.Collector) }
+func (c *adaptiveSamplingCollector) Snapshot() ([]byte, error) { return snapshotCollector(c.Collector) }
+
+func (c *adaptiveSamplingCollector) Reset() {
+	c.interval = c.opts.MaxInterval
+	c.lastCollection = time.Time{}
+	c.last = extractedMetrics{}
+	c.Collector.Reset()
+}
+
+func (c *adaptiveSamplingCollector) Add(in interface{}) error {
+	if err := c.opts.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	now := c.now()
+	first := c.lastCollection.IsZero()
+	elapsed := now.Sub(c.lastCollection)
+	if !first && elapsed < c.opts.MinInterval {
+		return nil
+	}
+
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	metrics, err := extractMetricsFromDocument(doc)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	changed := !first && c.changed(metrics)
+	if !first && !changed && elapsed < c.interval {
+		return nil
+	}
+
+	if err = c.Collector.Add(doc); err != nil {
+		return errors.WithStack(err)
+	}
+
+	switch {
+	case first:
+	case changed:
+		c.interval = time.Duration(float64(c.interval) / c.opts.Factor)
+	default:
+		c.interval = time.Duration(float64(c.interval) * c.opts.Factor)
+	}
+	if c.interval < c.opts.MinInterval {
+		c.interval = c.opts.MinInterval
+	}
+	if c.interval > c.opts.MaxInterval {
+		c.interval = c.opts.MaxInterval
+	}
+
+	c.lastCollection = now
+	c.last = metrics
+
+	return nil
+}
+
+// changed reports whether any numeric metric has changed beyond the
+// threshold since the last recorded document.
+func (c *adaptiveSamplingCollector) changed(metrics extractedMetrics) bool {
+	if len(metrics.types) != len(c.last.types) {
+		return true
+	}
+
+	for idx, t := range metrics.types {
+		if t != c.last.types[idx] {
+			return true
+		}
+
+		switch t {
+		case bsontype.Int32, bsontype.Int64, bsontype.Double:
+			if c.opts.Threshold.exceeded(c.last.number(idx), metrics.number(idx)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -4,7 +4,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/mongodb/ftdc/bsonx"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSamplingCollector(t *testing.T) {
@@ -23,3 +25,97 @@ func TestSamplingCollector(t *testing.T) {
 	info = collector.Info()
 	assert.Equal(t, 5, info.SampleCount)
 }
+
+func TestAdaptiveSamplingCollector(t *testing.T) {
+	opts := AdaptiveSamplingOptions{
+		MinInterval: time.Second,
+		MaxInterval: 8 * time.Second,
+		Threshold:   Threshold{Relative: 0.1},
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for name, invalid := range map[string]AdaptiveSamplingOptions{
+			"Empty":             {},
+			"ZeroMinimum":       {MaxInterval: time.Second, Threshold: Threshold{Relative: 0.1}},
+			"MaximumBelowMin":   {MinInterval: time.Second, MaxInterval: time.Millisecond, Threshold: Threshold{Relative: 0.1}},
+			"NoThreshold":       {MinInterval: time.Second, MaxInterval: time.Minute},
+			"NegativeThreshold": {MinInterval: time.Second, MaxInterval: time.Minute, Threshold: Threshold{Relative: -1, Absolute: 1}},
+			"SmallFactor":       {MinInterval: time.Second, MaxInterval: time.Minute, Threshold: Threshold{Relative: 0.1}, Factor: 0.5},
+		} {
+			collector := NewAdaptiveSamplingCollector(invalid, NewBaseCollector(10))
+			assert.Error(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("a", 1))), name)
+			assert.Zero(t, collector.Info().SampleCount, name)
+		}
+	})
+
+	// add adds a document with the value at the offset from the
+	// start, and reports whether the collector recorded it.
+	start := time.Now()
+	newCollector := func() (Collector, func(t *testing.T, offset time.Duration, value int64) bool) {
+		collector := NewAdaptiveSamplingCollector(opts, NewDynamicCollector(100))
+		var now time.Time
+		collector.(*adaptiveSamplingCollector).now = func() time.Time { return now }
+
+		return collector, func(t *testing.T, offset time.Duration, value int64) bool {
+			now = start.Add(offset)
+			before := collector.Info().SampleCount
+			require.NoError(t, collector.Add(bsonx.NewDocument(
+				bsonx.EC.Int64("value", value),
+				bsonx.EC.String("host", "example"),
+			)))
+			return collector.Info().SampleCount > before
+		}
+	}
+
+	t.Run("Idle", func(t *testing.T) {
+		_, add := newCollector()
+		assert.True(t, add(t, 0, 100), "the first document is recorded")
+
+		// flat documents are recorded at the maximum interval.
+		recorded := []time.Duration{}
+		for offset := time.Second; offset <= 40*time.Second; offset += time.Second {
+			if add(t, offset, 100) {
+				recorded = append(recorded, offset)
+			}
+		}
+		assert.Equal(t, []time.Duration{8 * time.Second, 16 * time.Second, 24 * time.Second, 32 * time.Second, 40 * time.Second}, recorded)
+	})
+	t.Run("Burst", func(t *testing.T) {
+		collector, add := newCollector()
+		require.True(t, add(t, 0, 100))
+
+		// changes are recorded once the minimum interval has
+		// elapsed, regardless of the current interval.
+		assert.False(t, add(t, 500*time.Millisecond, 200))
+		assert.True(t, add(t, time.Second, 200))
+		assert.True(t, add(t, 2*time.Second, 400))
+		assert.True(t, add(t, 3*time.Second, 800))
+		assert.Equal(t, time.Second, collector.(*adaptiveSamplingCollector).interval)
+
+		// once the burst is over, the interval relaxes from
+		// the minimum, and small changes do not count.
+		recorded := []time.Duration{}
+		for offset := 4 * time.Second; offset <= 30*time.Second; offset += time.Second {
+			if add(t, offset, 800+int64(offset/time.Second)) {
+				recorded = append(recorded, offset)
+			}
+		}
+		assert.Equal(t, []time.Duration{4 * time.Second, 6 * time.Second, 10 * time.Second, 18 * time.Second, 26 * time.Second}, recorded)
+	})
+	t.Run("SchemaChange", func(t *testing.T) {
+		collector, add := newCollector()
+		require.True(t, add(t, 0, 100))
+
+		now := start.Add(time.Second)
+		collector.(*adaptiveSamplingCollector).now = func() time.Time { return now }
+		require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("value", 100), bsonx.EC.Int64("other", 1))))
+		assert.Equal(t, 2, collector.Info().SampleCount)
+	})
+	t.Run("Reset", func(t *testing.T) {
+		collector, add := newCollector()
+		require.True(t, add(t, 0, 100))
+		collector.Reset()
+		assert.Zero(t, collector.Info().SampleCount)
+		assert.True(t, add(t, time.Millisecond, 100))
+	})
+}
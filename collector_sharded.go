@@ -0,0 +1,197 @@
+package ftdc
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type shardedCollector struct {
+	shards []*collectorShard
+
+	// stats is protected by the lock of the first shard.
+	stats collectorStats
+}
+
+type collectorShard struct {
+	mu        sync.Mutex
+	collector Collector
+}
+
+// NewShardedCollector provides a collector that is safe for concurrent
+// use, and that scales with the number of goroutines that add samples
+// to it. Samples are added to one of a number of shards, each of which
+// is a dynamic collector (see NewDynamicCollector) with its own lock,
+// so that concurrent calls to Add rarely wait for each other. If
+// shards is less than 1, the collector uses one shard per CPU.
+//
+// Samples are added to the first shard that is not in use, so
+// samples that are not added concurrently are kept in order, in the
+// first shard. Resolve returns the chunks of every shard, one shard
+// after another, so samples that are added concurrently are not in
+// the order in which they were added. Use the timestamps of the
+// samples to order them, if needed. Metadata is written with the
+// chunks of every shard.
+func NewShardedCollector(maxSamples, shards int) Collector {
+	if shards < 1 {
+		shards = runtime.NumCPU()
+	}
+
+	c := &shardedCollector{shards: make([]*collectorShard, shards)}
+	for idx := range c.shards {
+		c.shards[idx] = &collectorShard{collector: NewDynamicCollector(maxSamples)}
+	}
+
+	return c
+}
+
+// lockAll locks every shard, in order, and returns a function that
+// unlocks them.
+func (c *shardedCollector) lockAll() func() {
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+	}
+
+	return func() {
+		for _, shard := range c.shards {
+			shard.mu.Unlock()
+		}
+	}
+}
+
+func (c *shardedCollector) SetMetadata(in interface{}) error {
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer c.lockAll()()
+
+	for _, shard := range c.shards {
+		if err = shard.collector.SetMetadata(doc); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func (c *shardedCollector) Add(in interface{}) error {
+	// convert the document before taking a lock, as this is the
+	// most expensive part of adding samples for many input types.
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// use the first shard that is not in use, so that samples
+	// that are not added concurrently stay in the same shard, or
+	// wait for the first shard if they are all in use.
+	for _, shard := range c.shards {
+		if shard.mu.TryLock() {
+			err = shard.collector.Add(doc)
+			shard.mu.Unlock()
+			return errors.WithStack(err)
+		}
+	}
+
+	shard := c.shards[0]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	return errors.WithStack(shard.collector.Add(doc))
+}
+
+func (c *shardedCollector) Resolve() ([]byte, error) {
+	defer c.lockAll()()
+
+	start := time.Now()
+	buf := &bytes.Buffer{}
+	var (
+		count int64
+		last  CollectorStats
+	)
+	for _, shard := range c.shards {
+		if shard.collector.Info().SampleCount == 0 {
+			continue
+		}
+
+		before := getCollectorStats(shard.collector).ChunksResolved
+		out, err := shard.collector.Resolve()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		_, _ = buf.Write(out)
+
+		last = getCollectorStats(shard.collector)
+		count += last.ChunksResolved - before
+	}
+
+	if buf.Len() == 0 {
+		return nil, errors.New("no samples")
+	}
+
+	c.stats.record(time.Since(start), int(count), last.PayloadSize, last.UncompressedPayloadSize)
+
+	return buf.Bytes(), nil
+}
+
+// Snapshot renders the samples of every shard, as Resolve does,
+// without recording the chunks in the statistics of the collector.
+func (c *shardedCollector) Snapshot() ([]byte, error) {
+	defer c.lockAll()()
+
+	buf := &bytes.Buffer{}
+	for _, shard := range c.shards {
+		if shard.collector.Info().SampleCount == 0 {
+			continue
+		}
+
+		out, err := snapshotCollector(shard.collector)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		_, _ = buf.Write(out)
+	}
+
+	if buf.Len() == 0 {
+		return nil, errors.New("no samples")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c *shardedCollector) Reset() {
+	defer c.lockAll()()
+
+	for _, shard := range c.shards {
+		shard.collector.Reset()
+	}
+}
+
+func (c *shardedCollector) Stats() CollectorStats {
+	info := c.Info()
+
+	c.shards[0].mu.Lock()
+	defer c.shards[0].mu.Unlock()
+
+	return c.stats.export(info)
+}
+
+func (c *shardedCollector) Info() CollectorInfo {
+	defer c.lockAll()()
+
+	// shards hold samples with the same metrics, so report the
+	// count of the largest shard rather than a sum across shards.
+	out := CollectorInfo{}
+	for _, shard := range c.shards {
+		info := shard.collector.Info()
+		if info.MetricsCount > out.MetricsCount {
+			out.MetricsCount = info.MetricsCount
+		}
+		out.SampleCount += info.SampleCount
+	}
+	return out
+}
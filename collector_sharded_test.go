@@ -0,0 +1,123 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("Sequential", func(t *testing.T) {
+		collector := NewShardedCollector(100, 4)
+		for i := 0; i < 50; i++ {
+			require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("a", int64(i)))))
+		}
+		assert.Equal(t, 50, collector.Info().SampleCount)
+
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		// samples that are not added concurrently stay in order.
+		iter := ReadMetrics(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		idx := 0
+		for iter.Next() {
+			assert.Equal(t, int64(idx), iter.Document().Lookup("a").Int64())
+			idx++
+		}
+		require.NoError(t, iter.Err())
+		assert.Equal(t, 50, idx)
+	})
+	t.Run("Concurrent", func(t *testing.T) {
+		collector := NewShardedCollector(10, 0)
+		require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "test"))))
+
+		const workers = 8
+		const samples = 200
+		wg := &sync.WaitGroup{}
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < samples; i++ {
+					assert.NoError(t, collector.Add(bsonx.NewDocument(
+						bsonx.EC.Int64("worker", int64(w)),
+						bsonx.EC.Int64("sample", int64(i)),
+					)))
+				}
+			}(w)
+		}
+		wg.Wait()
+		assert.Equal(t, workers*samples, collector.Info().SampleCount)
+
+		metrics := 0
+		for _, shard := range collector.(*shardedCollector).shards {
+			if count := shard.collector.Info().MetricsCount; count > metrics {
+				metrics = count
+			}
+		}
+		assert.Equal(t, metrics, collector.Info().MetricsCount)
+
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		seen := map[int64]int{}
+		chunks := ReadChunks(ctx, bytes.NewReader(data))
+		defer chunks.Close()
+		for chunks.Next() {
+			chunk := chunks.Chunk()
+			require.NotNil(t, chunk.GetMetadata())
+			for _, v := range chunk.Metrics[0].Values {
+				seen[v]++
+			}
+		}
+		require.NoError(t, chunks.Err())
+		require.Len(t, seen, workers)
+		for w, count := range seen {
+			assert.Equal(t, samples, count, "worker %d", w)
+		}
+
+		collector.Reset()
+		assert.Zero(t, collector.Info().SampleCount)
+	})
+}
+
+func BenchmarkShardedCollector(b *testing.B) {
+	doc := randFlatDocument(20)
+	for _, test := range []struct {
+		name      string
+		collector Collector
+	}{
+		{name: "Sharded", collector: NewShardedCollector(1000, 0)},
+		{name: "Mutex", collector: &lockedCollector{Collector: NewDynamicCollector(1000)}},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := test.collector.Add(doc); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+type lockedCollector struct {
+	mu sync.Mutex
+	Collector
+}
+
+func (c *lockedCollector) Add(in interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Collector.Add(in)
+}
@@ -0,0 +1,97 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectorSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	countSamples := func(t *testing.T, data []byte) int {
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+
+		var count int
+		for iter.Next() {
+			count += iter.Chunk().Size()
+		}
+		require.NoError(t, iter.Err())
+		return count
+	}
+
+	for name, factory := range map[string]func() Collector{
+		"Base":      func() Collector { return NewBaseCollector(100) },
+		"Batch":     func() Collector { return NewBatchCollector(4) },
+		"Dynamic":   func() Collector { return NewDynamicCollector(4) },
+		"Sharded":   func() Collector { return NewShardedCollector(100, 2) },
+		"Streaming": func() Collector { return NewStreamingCollector(100, &bytes.Buffer{}) },
+		"Hooked":    func() Collector { return NewHookedCollector(NewBaseCollector(100), CollectorHooks{}) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			collector, ok := factory().(SnapshotCollector)
+			require.True(t, ok)
+			for i := 0; i < 5; i++ {
+				require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("a", int64(i)), bsonx.EC.Int64("b", 1))))
+			}
+
+			snapshot, err := collector.Snapshot()
+			require.NoError(t, err)
+			assert.Equal(t, 5, countSamples(t, snapshot))
+			assert.Equal(t, 5, collector.Info().SampleCount)
+			assert.Zero(t, collector.(StatsCollector).Stats().ChunksResolved)
+
+			// the collector continues to accumulate samples
+			// after the snapshot.
+			for i := 5; i < 8; i++ {
+				require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("a", int64(i)), bsonx.EC.Int64("b", 1))))
+			}
+			snapshot, err = collector.Snapshot()
+			require.NoError(t, err)
+			assert.Equal(t, 8, countSamples(t, snapshot))
+
+			resolved, err := collector.Resolve()
+			require.NoError(t, err)
+			assert.Equal(t, snapshot, resolved)
+			assert.NotZero(t, collector.(StatsCollector).Stats().ChunksResolved)
+		})
+	}
+	t.Run("Uncompressed", func(t *testing.T) {
+		collector := NewUncompressedCollectorBSON(10).(SnapshotCollector)
+		_, err := collector.Snapshot()
+		assert.Error(t, err)
+
+		require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("a", 1))))
+		snapshot, err := collector.Snapshot()
+		require.NoError(t, err)
+		assert.NotEmpty(t, snapshot)
+		assert.Equal(t, 1, collector.Info().SampleCount)
+		assert.Zero(t, collector.(StatsCollector).Stats().ChunksResolved)
+	})
+	t.Run("Context", func(t *testing.T) {
+		collector := NewCollectorContext(NewBaseCollector(10))
+		require.NoError(t, collector.Add(ctx, bsonx.NewDocument(bsonx.EC.Int64("a", 1))))
+		snapshot, err := collector.Snapshot(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, countSamples(t, snapshot))
+
+		canceled, stop := context.WithCancel(ctx)
+		stop()
+		_, err = collector.Snapshot(canceled)
+		assert.Error(t, err)
+	})
+	t.Run("Unsupported", func(t *testing.T) {
+		// wrapping hides the Snapshot method of the collector.
+		collector := NewCollectorContext(struct{ Collector }{NewBaseCollector(10)})
+		require.NoError(t, collector.Add(ctx, bsonx.NewDocument(bsonx.EC.Int64("a", 1))))
+		_, err := collector.Snapshot(ctx)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "does not support snapshots")
+	})
+}
@@ -0,0 +1,121 @@
+package ftdc
+
+import (
+	"sort"
+	"time"
+)
+
+// CollectorStats reports on the state of a collector and on the chunks
+// that it has produced, to support monitoring collectors in
+// production, for example to alert when a collector produces
+// unexpectedly large chunks or slows down.
+//
+// Statistics about resolved chunks persist when the collector is
+// reset.
+type CollectorStats struct {
+	// SampleCount and MetricsCount are the same as the values
+	// that Info reports.
+	SampleCount  int
+	MetricsCount int
+
+	// ChunksResolved is the total number of chunks that the
+	// collector has produced.
+	ChunksResolved int64
+
+	// PayloadSize and UncompressedPayloadSize are the sizes, in
+	// bytes, of the encoded payload of the last chunk that the
+	// collector produced, and CompressionRatio is the ratio of
+	// the uncompressed size to the compressed size. All three
+	// are zero if the collector has not produced a chunk.
+	PayloadSize             int
+	UncompressedPayloadSize int
+	CompressionRatio        float64
+
+	// FlushLatency describes the duration of recent calls to
+	// Resolve.
+	FlushLatency FlushLatency
+}
+
+// FlushLatency summarizes the duration of the most recent successful
+// calls to a collector's Resolve method.
+type FlushLatency struct {
+	Count int
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// getCollectorStats returns the statistics of a collector, or, for
+// collectors that do not implement StatsCollector, only the counts
+// that Info reports.
+func getCollectorStats(c Collector) CollectorStats {
+	if sc, ok := c.(StatsCollector); ok {
+		return sc.Stats()
+	}
+
+	info := c.Info()
+	return CollectorStats{SampleCount: info.SampleCount, MetricsCount: info.MetricsCount}
+}
+
+// flushLatencyWindow is the number of calls to Resolve that flush
+// latency percentiles are computed from.
+const flushLatencyWindow = 128
+
+// collectorStats tracks the statistics of the chunks that a collector
+// resolves, and is embedded in collector implementations.
+type collectorStats struct {
+	chunks           int64
+	payloadSize      int
+	uncompressedSize int
+	latencies        []time.Duration
+	next             int
+}
+
+// record adds the results of a successful call to Resolve that
+// produced the number of chunks, the last of which had the specified
+// payload sizes.
+func (s *collectorStats) record(latency time.Duration, chunks, payloadSize, uncompressedSize int) {
+	s.chunks += int64(chunks)
+	s.payloadSize = payloadSize
+	s.uncompressedSize = uncompressedSize
+
+	if len(s.latencies) < flushLatencyWindow {
+		s.latencies = append(s.latencies, latency)
+		return
+	}
+	s.latencies[s.next] = latency
+	s.next = (s.next + 1) % flushLatencyWindow
+}
+
+func (s *collectorStats) export(info CollectorInfo) CollectorStats {
+	out := CollectorStats{
+		SampleCount:             info.SampleCount,
+		MetricsCount:            info.MetricsCount,
+		ChunksResolved:          s.chunks,
+		PayloadSize:             s.payloadSize,
+		UncompressedPayloadSize: s.uncompressedSize,
+	}
+	if s.payloadSize > 0 {
+		out.CompressionRatio = float64(s.uncompressedSize) / float64(s.payloadSize)
+	}
+
+	if len(s.latencies) == 0 {
+		return out
+	}
+
+	sorted := make([]time.Duration, len(s.latencies))
+	copy(sorted, s.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p int) time.Duration { return sorted[(len(sorted)-1)*p/100] }
+
+	out.FlushLatency = FlushLatency{
+		Count: len(sorted),
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P99:   percentile(99),
+		Max:   sorted[len(sorted)-1],
+	}
+
+	return out
+}
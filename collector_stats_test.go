@@ -0,0 +1,96 @@
+package ftdc
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectorStats(t *testing.T) {
+	t.Run("Tracker", func(t *testing.T) {
+		stats := &collectorStats{}
+		assert.Zero(t, stats.export(CollectorInfo{}))
+
+		for i := 1; i <= flushLatencyWindow+100; i++ {
+			stats.record(time.Duration(i)*time.Millisecond, 2, 100, 400)
+		}
+
+		out := stats.export(CollectorInfo{SampleCount: 3, MetricsCount: 4})
+		assert.Equal(t, 3, out.SampleCount)
+		assert.Equal(t, 4, out.MetricsCount)
+		assert.EqualValues(t, 2*(flushLatencyWindow+100), out.ChunksResolved)
+		assert.Equal(t, 100, out.PayloadSize)
+		assert.Equal(t, 400, out.UncompressedPayloadSize)
+		assert.Equal(t, 4.0, out.CompressionRatio)
+
+		// only the most recent flushes are counted.
+		assert.Equal(t, flushLatencyWindow, out.FlushLatency.Count)
+		assert.Equal(t, 228*time.Millisecond, out.FlushLatency.Max)
+		assert.Equal(t, 164*time.Millisecond, out.FlushLatency.P50)
+		assert.Equal(t, 215*time.Millisecond, out.FlushLatency.P90)
+		assert.Equal(t, 226*time.Millisecond, out.FlushLatency.P99)
+	})
+	t.Run("Collectors", func(t *testing.T) {
+		for name, collector := range map[string]Collector{
+			"Base":         NewBaseCollector(100),
+			"Batch":        NewBatchCollector(10),
+			"Dynamic":      NewDynamicCollector(10),
+			"Sharded":      NewShardedCollector(10, 2),
+			"Uncompressed": NewUncompressedCollectorBSON(100),
+			"Streaming":    NewStreamingCollector(100, &bytes.Buffer{}),
+		} {
+			t.Run(name, func(t *testing.T) {
+				sc, ok := collector.(StatsCollector)
+				require.True(t, ok)
+				assert.Zero(t, sc.Stats())
+
+				docs := createEventRecord(1, 2, 3, 4)
+				for i := 0; i < 25; i++ {
+					require.NoError(t, collector.Add(docs))
+				}
+				stats := sc.Stats()
+				assert.Equal(t, collector.Info().SampleCount, stats.SampleCount)
+				assert.Equal(t, collector.Info().MetricsCount, stats.MetricsCount)
+				assert.Zero(t, stats.ChunksResolved)
+
+				_, err := collector.Resolve()
+				require.NoError(t, err)
+				stats = sc.Stats()
+				assert.True(t, stats.ChunksResolved >= 1)
+				assert.True(t, stats.PayloadSize > 0)
+				assert.True(t, stats.UncompressedPayloadSize > 0)
+				assert.True(t, stats.CompressionRatio > 0)
+				assert.Equal(t, 1, stats.FlushLatency.Count)
+
+				// statistics about chunks persist when the
+				// collector is reset.
+				collector.Reset()
+				assert.Equal(t, stats.ChunksResolved, sc.Stats().ChunksResolved)
+				assert.Zero(t, sc.Stats().SampleCount)
+			})
+		}
+	})
+	t.Run("ChunkCount", func(t *testing.T) {
+		collector := NewBatchCollector(10).(StatsCollector)
+		for i := 0; i < 25; i++ {
+			require.NoError(t, collector.Add(randFlatDocument(5)))
+		}
+		_, err := collector.Resolve()
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, collector.Stats().ChunksResolved)
+	})
+	t.Run("CompressionRatio", func(t *testing.T) {
+		collector := NewBaseCollector(1000).(StatsCollector)
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, collector.Add(createEventRecord(int64(i), int64(2*i), 3, 4)))
+		}
+		_, err := collector.Resolve()
+		require.NoError(t, err)
+
+		// regular deltas compress well.
+		assert.True(t, collector.Stats().CompressionRatio > 2, "%+v", collector.Stats())
+	})
+}
@@ -33,7 +33,23 @@ func newStreamingCollector(maxSamples int, writer io.Writer) *streamingCollector
 	}
 }
 
+func (c *streamingCollector) Stats() CollectorStats     { return getCollectorStats(c.Collector) }
+func (c *streamingCollector) Snapshot() ([]byte, error) { return snapshotCollector(c.Collector) }
+
 func (c *streamingCollector) Reset() { c.count = 0; c.Collector.Reset() }
+
+// Flush writes the samples that the collector holds to its writer, as
+// a chunk that holds fewer than the maximum number of samples.
+func (c *streamingCollector) Flush() error { return FlushCollector(c, c.output) }
+
+// setSchemaTransition records a schema change in the next chunk
+// written by the collector.
+func (c *streamingCollector) setSchemaTransition(t *SchemaTransition) {
+	if collector, ok := c.Collector.(*betterCollector); ok {
+		collector.schema = t
+	}
+}
+
 func (c *streamingCollector) Add(in interface{}) error {
 	if err := c.Collector.Add(in); err != nil {
 		return errors.Wrapf(err, "adding sample #%d", c.count+1)
@@ -62,16 +78,18 @@ func FlushCollector(c Collector, writer io.Writer) error {
 	}
 	payload, err := c.Resolve()
 	if err != nil {
+		recordFlush(0, err)
 		return errors.WithStack(err)
 	}
 
 	n, err := writer.Write(payload)
+	if err == nil && n != len(payload) {
+		err = errors.New("problem flushing data")
+	}
+	recordFlush(n, err)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	if n != len(payload) {
-		return errors.New("problem flushing data")
-	}
 	c.Reset()
 	return nil
 }
@@ -80,6 +98,10 @@ type streamingDynamicCollector struct {
 	output      io.Writer
 	hash        string
 	metricCount int
+	trackSchema bool
+	lastHash    string
+	samples     int64
+	hasher      schemaHasher
 	*streamingCollector
 }
 
@@ -94,35 +116,63 @@ func NewStreamingDynamicCollector(max int, writer io.Writer) Collector {
 	}
 }
 
+// NewStreamingSchemaTrackingCollector has the same semantics as the
+// streaming dynamic collector, but records every change to the schema
+// of the collected documents in the first chunk written after the
+// change, including changes between flushes. Use the
+// SchemaTransitions method of ChunkIterator, or the SchemaTransition
+// method of Chunk, to relate the series in chunks on either side of a
+// change.
+func NewStreamingSchemaTrackingCollector(max int, writer io.Writer) Collector {
+	return &streamingDynamicCollector{
+		output:             writer,
+		trackSchema:        true,
+		streamingCollector: newStreamingCollector(max, writer),
+	}
+}
+
 func (c *streamingDynamicCollector) Reset() {
 	c.streamingCollector = newStreamingCollector(c.streamingCollector.maxSamples, c.output)
 	c.metricCount = 0
 	c.hash = ""
 }
 
+func (c *streamingDynamicCollector) Flush() error { return FlushCollector(c, c.output) }
+
 func (c *streamingDynamicCollector) Add(in interface{}) error {
 	doc, err := readDocument(in)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	docHash, num := metricKeyHash(doc)
+	docHash, num := c.hasher.hash(doc)
 	if c.hash == "" {
-		c.hash = docHash
-		c.metricCount = num
 		if c.streamingCollector.count > 0 {
 			if err := FlushCollector(c, c.output); err != nil {
 				return errors.WithStack(err)
 			}
 		}
-		return errors.WithStack(c.streamingCollector.Add(doc))
-	}
-
-	if c.metricCount != num || c.hash != docHash {
+	} else if c.metricCount != num || c.hash != docHash {
 		if err := FlushCollector(c, c.output); err != nil {
 			return errors.WithStack(err)
 		}
 	}
+	c.hash = docHash
+	c.metricCount = num
+
+	if c.trackSchema && c.lastHash != "" && c.lastHash != docHash {
+		c.streamingCollector.setSchemaTransition(&SchemaTransition{
+			PreviousHash: c.lastHash,
+			Hash:         docHash,
+			Sample:       c.samples,
+		})
+	}
 
-	return errors.WithStack(c.streamingCollector.Add(doc))
+	if err := c.streamingCollector.Add(doc); err != nil {
+		return errors.WithStack(err)
+	}
+	c.lastHash = docHash
+	c.samples++
+
+	return nil
 }
@@ -0,0 +1,118 @@
+package ftdc
+
+import (
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// flusher is implemented by collectors that write their own chunks,
+// such as streaming and rotating file collectors.
+type flusher interface {
+	Flush() error
+}
+
+type teeCollector struct {
+	collectors []Collector
+}
+
+// NewTeeCollector returns a collector that forwards every sample and
+// metadata document to each of the collectors (e.g. a collector that
+// writes to a local file, and a collector that ships data over the
+// network), so that they all receive the same samples. Samples are
+// decoded once, and passed to every collector even if some of them
+// return errors, which are reported together.
+//
+// The first collector is the primary collector: Resolve returns its
+// chunk, and Snapshot, Info, and Stats report on it. The other
+// collectors must write their own chunks: during Resolve, the tee
+// flushes collectors that can write their pending samples (streaming
+// collectors and RotatingFileCollector), and reports their errors
+// with the error from the primary collector. Reset resets every
+// collector.
+//
+// It is not safe to use any of the collectors directly while the tee
+// is in use.
+func NewTeeCollector(collectors ...Collector) Collector {
+	return &teeCollector{collectors: collectors}
+}
+
+func (c *teeCollector) forward(in interface{}, op func(Collector, interface{}) error) error {
+	if len(c.collectors) == 0 {
+		return errors.New("tee collector has no collectors")
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for idx, collector := range c.collectors {
+		catcher.Wrapf(op(collector, in), "collector %d", idx)
+	}
+	return resolveErrors(catcher)
+}
+
+func (c *teeCollector) Add(in interface{}) error {
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return c.forward(doc, Collector.Add)
+}
+
+func (c *teeCollector) SetMetadata(in interface{}) error {
+	if in != nil {
+		doc, err := readDocument(in)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		in = doc
+	}
+
+	return c.forward(in, Collector.SetMetadata)
+}
+
+func (c *teeCollector) Resolve() ([]byte, error) {
+	if len(c.collectors) == 0 {
+		return nil, errors.New("tee collector has no collectors")
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for idx, collector := range c.collectors[1:] {
+		if f, ok := collector.(flusher); ok {
+			catcher.Wrapf(f.Flush(), "problem flushing collector %d", idx+1)
+		}
+	}
+
+	data, err := c.collectors[0].Resolve()
+	catcher.Add(err)
+
+	return data, resolveErrors(catcher)
+}
+
+func (c *teeCollector) Snapshot() ([]byte, error) {
+	if len(c.collectors) == 0 {
+		return nil, errors.New("tee collector has no collectors")
+	}
+
+	return snapshotCollector(c.collectors[0])
+}
+
+func (c *teeCollector) Reset() {
+	for _, collector := range c.collectors {
+		collector.Reset()
+	}
+}
+
+func (c *teeCollector) Info() CollectorInfo {
+	if len(c.collectors) == 0 {
+		return CollectorInfo{}
+	}
+
+	return c.collectors[0].Info()
+}
+
+func (c *teeCollector) Stats() CollectorStats {
+	if len(c.collectors) == 0 {
+		return CollectorStats{}
+	}
+
+	return getCollectorStats(c.collectors[0])
+}
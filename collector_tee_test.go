@@ -0,0 +1,103 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeeCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	samples := func(t *testing.T, data []byte) []int64 {
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+
+		out := []int64{}
+		for iter.Next() {
+			out = append(out, iter.Chunk().Metrics[0].Values...)
+		}
+		require.NoError(t, iter.Err())
+		return out
+	}
+
+	t.Run("NoCollectors", func(t *testing.T) {
+		collector := NewTeeCollector()
+		assert.Error(t, collector.Add(createEventRecord(1, 1, 2, 3)))
+		_, err := collector.Resolve()
+		assert.Error(t, err)
+		assert.Zero(t, collector.Info().SampleCount)
+	})
+	t.Run("Forwards", func(t *testing.T) {
+		primary, secondary := NewBaseCollector(100), NewBaseCollector(100)
+		collector := NewTeeCollector(primary, secondary)
+		require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "example"))))
+		for i := 0; i < 10; i++ {
+			require.NoError(t, collector.Add(createEventRecord(int64(i), 1, 2, 3)))
+		}
+		assert.Equal(t, 10, collector.Info().SampleCount)
+		assert.Equal(t, 10, secondary.Info().SampleCount)
+
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+		other, err := secondary.Resolve()
+		require.NoError(t, err)
+		assert.Equal(t, samples(t, other), samples(t, data))
+
+		iter := ReadChunks(ctx, bytes.NewReader(other))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		assert.Equal(t, "example", iter.Chunk().userMetadata().Lookup("host").StringValue())
+	})
+	t.Run("FlushesStreamingCollectors", func(t *testing.T) {
+		shipped := &bytes.Buffer{}
+		collector := NewTeeCollector(NewBaseCollector(100), NewStreamingCollector(4, shipped))
+		for i := 0; i < 10; i++ {
+			require.NoError(t, collector.Add(createEventRecord(int64(i), 1, 2, 3)))
+		}
+
+		local := &bytes.Buffer{}
+		require.NoError(t, FlushCollector(collector, local))
+		assert.Len(t, samples(t, local.Bytes()), 10)
+		assert.Equal(t, samples(t, local.Bytes()), samples(t, shipped.Bytes()))
+		assert.Zero(t, collector.Info().SampleCount)
+	})
+	t.Run("AggregatesErrors", func(t *testing.T) {
+		failing := &gatedCollector{gate: make(chan struct{}), err: errors.New("add failed"), Collector: NewBaseCollector(100)}
+		close(failing.gate)
+		secondary := NewBaseCollector(100)
+		collector := NewTeeCollector(failing, secondary)
+
+		err := collector.Add(createEventRecord(1, 1, 2, 3))
+		require.Error(t, err)
+		assert.Equal(t, failing.err, errors.Cause(err))
+		assert.Equal(t, 1, secondary.Info().SampleCount, "other collectors receive samples")
+
+		flushErr := errors.New("flush failed")
+		collector = NewTeeCollector(NewBaseCollector(100), &failingFlushCollector{err: flushErr, Collector: NewBaseCollector(100)})
+		require.NoError(t, collector.Add(createEventRecord(1, 1, 2, 3)))
+		data, err := collector.Resolve()
+		require.Error(t, err)
+		assert.Equal(t, flushErr, errors.Cause(err))
+		assert.NotEmpty(t, data, "the primary collector is resolved")
+	})
+	t.Run("InvalidSample", func(t *testing.T) {
+		secondary := NewBaseCollector(100)
+		collector := NewTeeCollector(NewBaseCollector(100), secondary)
+		assert.Error(t, collector.Add(map[string]interface{}{"a": 1}))
+		assert.Zero(t, secondary.Info().SampleCount)
+	})
+}
+
+type failingFlushCollector struct {
+	err error
+	Collector
+}
+
+func (c *failingFlushCollector) Flush() error { return c.err }
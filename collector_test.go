@@ -61,6 +61,11 @@ func TestCollectorInterface(t *testing.T) {
 					if len(test.docs) > 0 {
 						assert.NoError(t, err)
 						assert.NotZero(t, out)
+
+						stats := collector.(StatsCollector).Stats()
+						assert.True(t, stats.ChunksResolved > 0)
+						assert.True(t, stats.PayloadSize > 0)
+						assert.Equal(t, 1, stats.FlushLatency.Count)
 					} else {
 						assert.Error(t, err)
 						assert.Zero(t, out)
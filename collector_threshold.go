@@ -0,0 +1,212 @@
+package ftdc
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// Threshold describes the minimum change in a metric's value, since
+// the last recorded value, required to record a new value. A change
+// must exceed either the Absolute or the Relative (as a fraction of
+// the last recorded value) threshold to be recorded. Zero values
+// disable the corresponding check.
+type Threshold struct {
+	Absolute float64
+	Relative float64
+}
+
+func (t Threshold) isZero() bool { return t.Absolute == 0 && t.Relative == 0 }
+
+func (t Threshold) exceeded(last, current float64) bool {
+	if t.isZero() {
+		return true
+	}
+
+	diff := math.Abs(current - last)
+	if t.Absolute > 0 && diff > t.Absolute {
+		return true
+	}
+
+	if t.Relative > 0 {
+		if last == 0 {
+			return diff != 0
+		}
+
+		if diff/math.Abs(last) > t.Relative {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ThresholdOptions configures the threshold collector. The Default
+// threshold applies to all numeric metrics that do not have a
+// threshold in the Keys map. Keys are the flattened, dot-separated
+// names of metrics, as returned by Metric.Key().
+type ThresholdOptions struct {
+	Default Threshold
+	Keys    map[string]Threshold
+}
+
+// Validate ensures that the threshold options are reasonable.
+func (opts ThresholdOptions) Validate() error {
+	if opts.Default.Absolute < 0 || opts.Default.Relative < 0 {
+		return errors.New("default threshold values must not be negative")
+	}
+
+	for k, t := range opts.Keys {
+		if t.Absolute < 0 || t.Relative < 0 {
+			return errors.Errorf("threshold values for '%s' must not be negative", k)
+		}
+	}
+
+	return nil
+}
+
+func (opts ThresholdOptions) get(key string) Threshold {
+	if t, ok := opts.Keys[key]; ok {
+		return t
+	}
+
+	return opts.Default
+}
+
+type thresholdCollector struct {
+	opts ThresholdOptions
+	last map[string]*bsonx.Value
+	Collector
+}
+
+// NewThresholdCollector wraps a collector and filters the numeric
+// (int32, int64, and double) metrics in each document before they
+// reach the underlying collector: a metric's value is only recorded
+// when it has moved beyond the configured threshold since the last
+// recorded value, otherwise the last recorded value is repeated.
+//
+// Because FTDC stores each sample as deltas from the previous sample,
+// repeated values are stored as (run length encoded) zero deltas,
+// and readers will see the last recorded value carried forward
+// without any special handling.
+//
+// The collector returns an error during Add if the options are not
+// valid.
+func NewThresholdCollector(opts ThresholdOptions, collector Collector) Collector {
+	return &thresholdCollector{
+		opts:      opts,
+		last:      map[string]*bsonx.Value{},
+		Collector: collector,
+	}
+}
+
+func (c *thresholdCollector) Stats() CollectorStats     { return getCollectorStats(c.Collector) }
+func (c *thresholdCollector) Snapshot() ([]byte, error) { return snapshotCollector(c.Collector) }
+
+func (c *thresholdCollector) Reset() {
+	c.last = map[string]*bsonx.Value{}
+	c.Collector.Reset()
+}
+
+func (c *thresholdCollector) Add(in interface{}) error {
+	if err := c.opts.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(c.Collector.Add(c.filterDocument("", doc)))
+}
+
+func (c *thresholdCollector) filterDocument(prefix string, doc *bsonx.Document) *bsonx.Document {
+	out := bsonx.DC.Make(doc.Len())
+
+	iter := doc.Iterator()
+	for iter.Next() {
+		elem := iter.Element()
+		key := elem.Key()
+		out.Append(bsonx.EC.FromValue(key, c.filterValue(joinKey(prefix, key), elem.Value())))
+	}
+
+	return out
+}
+
+func (c *thresholdCollector) filterArray(prefix string, array *bsonx.Array) *bsonx.Array {
+	out := bsonx.MakeArray(array.Len())
+
+	idx := 0
+	iter := array.Iterator()
+	for iter.Next() {
+		out.Append(c.filterValue(fmt.Sprintf("%s.%d", prefix, idx), iter.Value()))
+		idx++
+	}
+
+	return out
+}
+
+func (c *thresholdCollector) filterValue(key string, val *bsonx.Value) *bsonx.Value {
+	var current float64
+
+	switch val.Type() {
+	case bsontype.EmbeddedDocument:
+		return bsonx.VC.Document(c.filterDocument(key, val.MutableDocument()))
+	case bsontype.Array:
+		return bsonx.VC.Array(c.filterArray(key, val.MutableArray()))
+	case bsontype.Int32:
+		current = float64(val.Int32())
+	case bsontype.Int64:
+		current = float64(val.Int64())
+	case bsontype.Double:
+		current = val.Double()
+	default:
+		return val
+	}
+
+	last, ok := c.last[key]
+	if !ok || last.Type() != val.Type() || c.opts.get(key).exceeded(numericValue(last), current) {
+		// callers may reuse or modify the input document, so
+		// store a copy of the value rather than the value itself.
+		c.last[key] = copyNumericValue(val)
+		return val
+	}
+
+	return last
+}
+
+func copyNumericValue(val *bsonx.Value) *bsonx.Value {
+	switch val.Type() {
+	case bsontype.Int32:
+		return bsonx.VC.Int32(val.Int32())
+	case bsontype.Int64:
+		return bsonx.VC.Int64(val.Int64())
+	default:
+		return bsonx.VC.Double(val.Double())
+	}
+}
+
+func numericValue(val *bsonx.Value) float64 {
+	switch val.Type() {
+	case bsontype.Int32:
+		return float64(val.Int32())
+	case bsontype.Int64:
+		return float64(val.Int64())
+	case bsontype.Double:
+		return val.Double()
+	default:
+		return 0
+	}
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "." + key
+}
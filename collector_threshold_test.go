@@ -0,0 +1,135 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThresholdCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("Threshold", func(t *testing.T) {
+		for name, test := range map[string]struct {
+			threshold Threshold
+			last      float64
+			current   float64
+			expected  bool
+		}{
+			"Disabled":               {last: 1, current: 1, expected: true},
+			"AbsoluteBelow":          {threshold: Threshold{Absolute: 10}, last: 100, current: 105},
+			"AbsoluteAbove":          {threshold: Threshold{Absolute: 10}, last: 100, current: 111, expected: true},
+			"AbsoluteNegativeChange": {threshold: Threshold{Absolute: 10}, last: 100, current: 89, expected: true},
+			"RelativeBelow":          {threshold: Threshold{Relative: 0.1}, last: 100, current: 109},
+			"RelativeAbove":          {threshold: Threshold{Relative: 0.1}, last: 100, current: 111, expected: true},
+			"RelativeFromZero":       {threshold: Threshold{Relative: 0.1}, last: 0, current: 1, expected: true},
+			"RelativeStaticZero":     {threshold: Threshold{Relative: 0.1}, last: 0, current: 0},
+			"EitherExceeded":         {threshold: Threshold{Relative: 0.5, Absolute: 1}, last: 100, current: 102, expected: true},
+		} {
+			t.Run(name, func(t *testing.T) {
+				assert.Equal(t, test.expected, test.threshold.exceeded(test.last, test.current))
+			})
+		}
+	})
+	t.Run("InvalidOptions", func(t *testing.T) {
+		collector := NewThresholdCollector(ThresholdOptions{Default: Threshold{Absolute: -1}}, NewBaseCollector(10))
+		assert.Error(t, collector.Add(randFlatDocument(2)))
+		assert.Zero(t, collector.Info())
+
+		collector = NewThresholdCollector(ThresholdOptions{Keys: map[string]Threshold{"a": {Relative: -1}}}, NewBaseCollector(10))
+		assert.Error(t, collector.Add(randFlatDocument(2)))
+	})
+	t.Run("CarryForward", func(t *testing.T) {
+		opts := ThresholdOptions{
+			Default: Threshold{Absolute: 5},
+			Keys: map[string]Threshold{
+				"nested.exact": {},
+			},
+		}
+		collector := NewThresholdCollector(opts, NewBaseCollector(10))
+
+		inputs := [][3]int64{{100, 1, 10}, {102, 2, 11}, {110, 3, 12}, {111, 4, 20}}
+		expected := [][3]int64{{100, 1, 10}, {100, 2, 10}, {110, 3, 10}, {110, 4, 20}}
+
+		for _, in := range inputs {
+			require.NoError(t, collector.Add(bsonx.NewDocument(
+				bsonx.EC.Int64("gauge", in[0]),
+				bsonx.EC.SubDocument("nested", bsonx.NewDocument(bsonx.EC.Int64("exact", in[1]))),
+				bsonx.EC.Array("array", bsonx.NewArray(bsonx.VC.Int32(int32(in[2])))),
+			)))
+		}
+
+		out, err := collector.Resolve()
+		require.NoError(t, err)
+
+		iter := ReadMetrics(ctx, bytes.NewBuffer(out))
+		idx := 0
+		for iter.Next() {
+			doc := iter.Document()
+			require.True(t, idx < len(expected))
+			assert.Equal(t, expected[idx][0], doc.Lookup("gauge").Int64())
+			assert.Equal(t, expected[idx][1], doc.Lookup("nested.exact").Int64())
+			assert.EqualValues(t, expected[idx][2], doc.Lookup("array.0").Int32())
+			idx++
+		}
+		require.NoError(t, iter.Err())
+		assert.Equal(t, len(expected), idx)
+	})
+	t.Run("NonNumericPassThrough", func(t *testing.T) {
+		collector := NewThresholdCollector(ThresholdOptions{Default: Threshold{Absolute: 100}}, NewBaseCollector(10))
+		for _, val := range []bool{true, false} {
+			require.NoError(t, collector.Add(bsonx.NewDocument(
+				bsonx.EC.Boolean("flag", val),
+				bsonx.EC.Double("value", 1),
+			)))
+		}
+		out, err := collector.Resolve()
+		require.NoError(t, err)
+
+		iter := ReadMetrics(ctx, bytes.NewBuffer(out))
+		var flags []bool
+		for iter.Next() {
+			flags = append(flags, iter.Document().Lookup("flag").Boolean())
+		}
+		require.NoError(t, iter.Err())
+		assert.Equal(t, []bool{true, false}, flags)
+	})
+	t.Run("ReusedInputBuffer", func(t *testing.T) {
+		collector := NewThresholdCollector(ThresholdOptions{Default: Threshold{Absolute: 5}}, NewBaseCollector(10))
+
+		buf, err := bsonx.NewDocument(bsonx.EC.Int64("a", 100)).MarshalBSON()
+		require.NoError(t, err)
+		require.NoError(t, collector.Add(buf))
+
+		// overwrite the first input in place, which must not
+		// change the recorded value.
+		reused, err := bsonx.NewDocument(bsonx.EC.Int64("a", 200)).MarshalBSON()
+		require.NoError(t, err)
+		copy(buf, reused)
+
+		require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("a", 102))))
+
+		out, err := collector.Resolve()
+		require.NoError(t, err)
+
+		iter := ReadMetrics(ctx, bytes.NewBuffer(out))
+		var values []int64
+		for iter.Next() {
+			values = append(values, iter.Document().Lookup("a").Int64())
+		}
+		require.NoError(t, iter.Err())
+		assert.Equal(t, []int64{100, 100}, values)
+	})
+	t.Run("Reset", func(t *testing.T) {
+		collector := NewThresholdCollector(ThresholdOptions{Default: Threshold{Absolute: 100}}, NewBaseCollector(10))
+		require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("a", 1))))
+		collector.Reset()
+		assert.Zero(t, collector.Info())
+		assert.Len(t, collector.(*thresholdCollector).last, 0)
+	})
+}
@@ -3,6 +3,7 @@ package ftdc
 import (
 	"bytes"
 	"io"
+	"time"
 
 	"github.com/mongodb/ftdc/bsonx"
 	"github.com/pkg/errors"
@@ -142,6 +143,7 @@ type uncompressedCollector struct {
 	metricCount int
 	metadata    *bsonx.Document
 	samples     []*bsonx.Document
+	stats       collectorStats
 }
 
 func (c *uncompressedCollector) Reset() {
@@ -156,6 +158,8 @@ func (c *uncompressedCollector) Info() CollectorInfo {
 	}
 }
 
+func (c *uncompressedCollector) Stats() CollectorStats { return c.stats.export(c.Info()) }
+
 func (c *uncompressedCollector) SetMetadata(in interface{}) error {
 	doc, err := readDocument(in)
 	if err != nil {
@@ -188,11 +192,15 @@ func (c *uncompressedCollector) Add(in interface{}) error {
 	return nil
 }
 
-func (c *uncompressedCollector) Resolve() ([]byte, error) {
+func (c *uncompressedCollector) Resolve() ([]byte, error)  { return c.resolve(true) }
+func (c *uncompressedCollector) Snapshot() ([]byte, error) { return c.resolve(false) }
+
+func (c *uncompressedCollector) resolve(record bool) ([]byte, error) {
 	if len(c.samples) == 0 {
 		return nil, errors.New("no data")
 	}
 
+	start := time.Now()
 	buf := bytes.NewBuffer([]byte{})
 
 	if c.metadata != nil {
@@ -207,6 +215,10 @@ func (c *uncompressedCollector) Resolve() ([]byte, error) {
 		}
 	}
 
+	if record {
+		c.stats.record(time.Since(start), 1, buf.Len(), buf.Len())
+	}
+
 	return buf.Bytes(), nil
 }
 
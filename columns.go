@@ -0,0 +1,81 @@
+package ftdc
+
+import (
+	"context"
+	"io"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// ReadColumns reads the values of the metrics with the specified keys
+// from an FTDC data source, and returns a map of the keys to the
+// values of each metric, in collection order. Keys are fully qualified
+// dot-separated paths, as returned by Metric.Key.
+//
+// ReadColumns only stores and expands the values of the requested
+// metrics, and is much less expensive than reading every metric when
+// only a few metrics are needed. The values are in the format
+// described by Metric.Type, and metrics that are absent from some
+// chunks (e.g. because of schema changes) have fewer values than
+// metrics that are present in every chunk. Keys that are not present
+// in any chunk are omitted from the output.
+func ReadColumns(ctx context.Context, r io.Reader, keys []string) (map[string][]int64, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("must specify at least one key")
+	}
+
+	include := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		include[key] = struct{}{}
+	}
+	filter := func(m *Metric) bool {
+		_, ok := include[m.Key()]
+		return ok
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	catcher := grip.NewBasicCatcher()
+	ipc := make(chan *bsonx.Document)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		catcher.Add(readDiagnostic(ctx, r, ipc))
+	}()
+
+	out := map[string][]int64{}
+	interner := bsonx.NewKeyInterner()
+	for doc := range ipc {
+		if !isNum(1, doc.Lookup("type")) {
+			continue
+		}
+
+		chunk, err := readChunk(doc, nil, interner, filter)
+		recordDecode(err)
+		if err != nil {
+			catcher.Add(err)
+			break
+		}
+
+		for _, metric := range chunk.Metrics {
+			key := metric.Key()
+			out[key] = append(out[key], metric.Values...)
+		}
+	}
+
+	// stop the reader, and wait for it to exit, in case decoding
+	// failed before the end of the input.
+	cancel()
+	for range ipc {
+	}
+	<-done
+
+	if catcher.HasErrors() {
+		return nil, errors.WithStack(catcher.Resolve())
+	}
+
+	return out, nil
+}
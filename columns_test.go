@@ -0,0 +1,139 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadColumns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// samples with 50 metrics, where most metrics never change,
+	// so that runs of zero deltas span columns, and a schema
+	// change part way through.
+	sample := func(i int, extra bool) *bsonx.Document {
+		doc := bsonx.NewDocument()
+		for j := 0; j < 50; j++ {
+			value := int64(j)
+			if j%10 == 0 {
+				value = int64(i * j)
+			}
+			doc.Append(bsonx.EC.Int64(fmt.Sprintf("m%02d", j), value))
+		}
+		doc.Append(bsonx.EC.SubDocument("nested", bsonx.NewDocument(
+			bsonx.EC.Double("ratio", float64(i)/4),
+			bsonx.EC.Int32("count", int32(i%7)),
+		)))
+		if extra {
+			doc.Append(bsonx.EC.Int64("extra", int64(i)))
+		}
+		return doc
+	}
+
+	for _, test := range []struct {
+		name      string
+		collector Collector
+	}{
+		{name: "Dynamic", collector: NewDynamicCollector(30)},
+		{name: "Grouping", collector: NewGroupingCollector(200)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if test.name == "Grouping" {
+					require.NoError(t, test.collector.Add(sample(i, false)))
+					continue
+				}
+				require.NoError(t, test.collector.Add(sample(i, i >= 70)))
+			}
+			data, err := test.collector.Resolve()
+			require.NoError(t, err)
+
+			// build the expected values from the full chunks.
+			expected := map[string][]int64{}
+			iter := ReadChunks(ctx, bytes.NewReader(data))
+			for iter.Next() {
+				for _, metric := range iter.Chunk().Metrics {
+					expected[metric.Key()] = append(expected[metric.Key()], metric.Values...)
+				}
+			}
+			require.NoError(t, iter.Err())
+			iter.Close()
+
+			keys := []string{"m00", "m10", "m07", "nested.ratio", "nested.count", "extra", "missing"}
+			columns, err := ReadColumns(ctx, bytes.NewReader(data), keys)
+			require.NoError(t, err)
+
+			assert.NotContains(t, columns, "missing")
+			for _, key := range keys {
+				assert.Equal(t, expected[key], columns[key], key)
+			}
+			assert.Len(t, columns["m10"], 100)
+			assert.EqualValues(t, 990, columns["m10"][99])
+			if test.name == "Dynamic" {
+				assert.Len(t, columns["extra"], 30)
+			}
+		})
+	}
+	t.Run("NoKeys", func(t *testing.T) {
+		columns, err := ReadColumns(ctx, &bytes.Buffer{}, nil)
+		assert.Error(t, err)
+		assert.Nil(t, columns)
+	})
+	t.Run("Corrupt", func(t *testing.T) {
+		collector := NewBaseCollector(10)
+		for i := 0; i < 5; i++ {
+			require.NoError(t, collector.Add(sample(i, false)))
+		}
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		columns, err := ReadColumns(ctx, bytes.NewReader(data[:len(data)-10]), []string{"m00"})
+		assert.Error(t, err)
+		assert.Nil(t, columns)
+	})
+}
+
+func BenchmarkReadColumns(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	collector := NewBaseCollector(1000)
+	for i := 0; i < 1000; i++ {
+		doc := bsonx.DC.Make(1500)
+		for j := 0; j < 1500; j++ {
+			doc.Append(bsonx.EC.Int64(fmt.Sprintf("metric%04d", j), int64(i*(j%5))))
+		}
+		require.NoError(b, collector.Add(doc))
+	}
+	data, err := collector.Resolve()
+	require.NoError(b, err)
+
+	b.Run("ReadColumns", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ReadColumns(ctx, bytes.NewReader(data), []string{"metric0001", "metric0002"}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("ReadChunks", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			iter := ReadChunks(ctx, bytes.NewReader(data))
+			for iter.Next() {
+				_ = iter.Chunk()
+			}
+			if err := iter.Err(); err != nil {
+				b.Fatal(err)
+			}
+			iter.Close()
+		}
+	})
+}
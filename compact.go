@@ -0,0 +1,138 @@
+package ftdc
+
+import (
+	"context"
+	"io"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// CompactChunks reads every chunk from the iterator and writes its
+// samples to the output, merging adjacent chunks that have the same
+// schema and metadata into chunks of up to targetSamples samples,
+// which decode faster and compress better than the many small chunks
+// that collectors which flush on short intervals produce. Chunks with
+// more than targetSamples samples are split.
+//
+// The output chunks are written by a float preserving collector (see
+// NewFloatPreservingCollector), so that compaction does not truncate
+// double values. Each output chunk has the _id of the input chunk that
+// holds its first sample.
+func CompactChunks(ctx context.Context, iter *ChunkIterator, out io.Writer, targetSamples int) error {
+	if targetSamples < 1 {
+		return errors.New("target samples must be positive")
+	}
+
+	c := &compactor{
+		output: out,
+		target: targetSamples,
+	}
+
+	for iter.Next() {
+		if err := c.add(ctx, iter.Chunk()); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(c.flush())
+}
+
+// compactor accumulates the samples of chunks with the same schema and
+// metadata in a collector.
+type compactor struct {
+	output    io.Writer
+	target    int
+	collector Collector
+	samples   int
+	metadata  *bsonx.Document
+	keys      []string
+	types     []bsontype.Type
+}
+
+func (c *compactor) add(ctx context.Context, chunk *Chunk) error {
+	metadata := chunk.userMetadata()
+	if c.collector != nil && !c.compatible(chunk, metadata) {
+		if err := c.flush(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if c.collector == nil {
+		c.metadata = metadata
+		c.keys = make([]string, len(chunk.Metrics))
+		c.types = make([]bsontype.Type, len(chunk.Metrics))
+		for idx := range chunk.Metrics {
+			c.keys[idx] = chunk.Metrics[idx].Key()
+			c.types[idx] = chunk.Metrics[idx].Type()
+		}
+	}
+
+	samples := chunk.StructuredIterator(ctx)
+	defer samples.Close()
+
+	for samples.Next() {
+		if c.samples == c.target {
+			if err := c.flush(); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		if c.collector == nil {
+			// collectors otherwise start chunks at the time
+			// of their first sample, which would be the time
+			// of the compaction.
+			c.collector = newFloatPreservingCollector(c.target, chunk.ID())
+			if c.metadata != nil {
+				if err := c.collector.SetMetadata(c.metadata); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+		}
+
+		if err := c.collector.Add(samples.Document()); err != nil {
+			return errors.Wrap(err, "problem adding sample to compacted chunk")
+		}
+		c.samples++
+	}
+
+	return errors.WithStack(samples.Err())
+}
+
+// compatible reports whether the chunk has the same schema and
+// metadata as the chunks in the collector.
+func (c *compactor) compatible(chunk *Chunk, metadata *bsonx.Document) bool {
+	if len(chunk.Metrics) != len(c.keys) {
+		return false
+	}
+	for idx := range chunk.Metrics {
+		if chunk.Metrics[idx].Type() != c.types[idx] || chunk.Metrics[idx].Key() != c.keys[idx] {
+			return false
+		}
+	}
+
+	if metadata == nil || c.metadata == nil {
+		return metadata == c.metadata
+	}
+	return metadata.Equal(c.metadata)
+}
+
+// flush writes the accumulated samples as a chunk, and keeps the schema
+// and metadata of the chunk for the next chunk.
+func (c *compactor) flush() error {
+	if c.collector == nil {
+		return nil
+	}
+
+	if err := FlushCollector(c.collector, c.output); err != nil {
+		return errors.Wrap(err, "problem writing compacted chunk")
+	}
+	c.collector = nil
+	c.samples = 0
+
+	return nil
+}
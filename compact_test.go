@@ -0,0 +1,115 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactChunks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	source := &bytes.Buffer{}
+	write := func(host string, start, count int, extra bool) {
+		collector := NewStreamingCollector(3, source)
+		require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", host))))
+		for i := start; i < start+count; i++ {
+			doc := bsonx.NewDocument(
+				bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+				bsonx.EC.Int64("counter", int64(i)),
+			)
+			if extra {
+				doc.Append(bsonx.EC.Int32("extra", int32(i)))
+			}
+			require.NoError(t, collector.Add(doc))
+		}
+		require.NoError(t, FlushCollector(collector, source))
+	}
+	write("a", 0, 20, false)
+	write("a", 20, 7, true)
+	write("b", 27, 5, true)
+
+	readAll := func(t *testing.T, data []byte) []*Chunk {
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+
+		chunks := []*Chunk{}
+		for iter.Next() {
+			chunks = append(chunks, iter.Chunk())
+		}
+		require.NoError(t, iter.Err())
+		return chunks
+	}
+
+	original := readAll(t, source.Bytes())
+	require.True(t, len(original) > 10)
+
+	t.Run("InvalidTarget", func(t *testing.T) {
+		assert.Error(t, CompactChunks(ctx, ReadChunks(ctx, bytes.NewReader(source.Bytes())), &bytes.Buffer{}, 0))
+	})
+	t.Run("Merges", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, CompactChunks(ctx, ReadChunks(ctx, bytes.NewReader(source.Bytes())), out, 8))
+
+		compacted := readAll(t, out.Bytes())
+		sizes := make([]int, len(compacted))
+		for idx, chunk := range compacted {
+			sizes[idx] = chunk.Size()
+		}
+		assert.Equal(t, []int{8, 8, 4, 7, 5}, sizes)
+
+		hosts := []string{"a", "a", "a", "a", "b"}
+		for idx, chunk := range compacted {
+			assert.Equal(t, hosts[idx], chunk.userMetadata().Lookup("host").StringValue())
+		}
+
+		var counter int64
+		for _, chunk := range compacted {
+			for _, value := range chunk.Metrics[1].Values {
+				assert.Equal(t, counter, value)
+				counter++
+			}
+		}
+		assert.EqualValues(t, 32, counter)
+		assert.True(t, compacted[0].ID().Equal(original[0].ID()))
+	})
+	t.Run("KeepsChunkIDs", func(t *testing.T) {
+		// the chunks start well before the compaction, so that
+		// the _id of the compacted chunks cannot be the time
+		// that they were collected.
+		in := &bytes.Buffer{}
+		for _, start := range []time.Duration{0, time.Hour} {
+			collector := &betterCollector{maxDeltas: 5, start: base.Add(start)}
+			for i := 0; i < 5; i++ {
+				require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("counter", int64(i)))))
+			}
+			require.NoError(t, FlushCollector(collector, in))
+		}
+
+		for target, ids := range map[int][]time.Time{
+			4:  {base, base, base.Add(time.Hour)},
+			10: {base},
+		} {
+			out := &bytes.Buffer{}
+			require.NoError(t, CompactChunks(ctx, ReadChunks(ctx, bytes.NewReader(in.Bytes())), out, target))
+
+			compacted := readAll(t, out.Bytes())
+			require.Len(t, compacted, len(ids))
+			for idx, chunk := range compacted {
+				assert.True(t, ids[idx].Equal(chunk.ID()), "%d: %s", target, chunk.ID())
+			}
+		}
+	})
+	t.Run("EmptyInput", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, CompactChunks(ctx, ReadChunks(ctx, bytes.NewReader(nil)), out, 8))
+		assert.Zero(t, out.Len())
+	})
+}
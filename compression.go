@@ -0,0 +1,219 @@
+package ftdc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pierrec/lz4/v4"
+	"github.com/pkg/errors"
+)
+
+// Compression identifies the codec that compresses the payload of a
+// metrics chunk. The standard payload, which is what mongod writes,
+// is compressed with zlib. Snappy and LZ4 compress and decompress
+// payloads several times faster than zlib, in exchange for larger
+// chunks, which suits high frequency collection.
+//
+// Chunks that use another codec hold its identifier in the "codec"
+// field of the chunk document, and are read transparently by this
+// package, but are not readable by other FTDC implementations.
+type Compression byte
+
+// The compression codecs. Their values are stored in chunk documents
+// and must not change.
+const (
+	CompressionZlib   Compression = 0
+	CompressionSnappy Compression = 1
+	CompressionLZ4    Compression = 2
+)
+
+const compressionField = "codec"
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionZlib:
+		return "zlib"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionLZ4:
+		return "lz4"
+	default:
+		return "unknown"
+	}
+}
+
+// Validate returns an error if the codec is not supported.
+func (c Compression) Validate() error {
+	switch c {
+	case CompressionZlib, CompressionSnappy, CompressionLZ4:
+		return nil
+	default:
+		return errors.Errorf("unsupported compression codec %d", c)
+	}
+}
+
+// NewCompressedCollector provides a collector that is equivalent to
+// the basic collector, except that it compresses the payloads of
+// chunks with the specified codec.
+func NewCompressedCollector(maxSize int, codec Compression) Collector {
+	return &betterCollector{
+		maxDeltas:   maxSize,
+		compression: codec,
+	}
+}
+
+// NewStreamingCompressedCollector provides a streaming collector (see
+// NewStreamingCollector) that compresses the payloads of chunks with
+// the specified codec.
+func NewStreamingCompressedCollector(maxSamples int, codec Compression, writer io.Writer) Collector {
+	c := newStreamingCollector(maxSamples, writer)
+	c.Collector.(*betterCollector).compression = codec
+	return c
+}
+
+// readCompression returns the codec of the chunk document.
+func readCompression(doc *bsonx.Document) (Compression, error) {
+	elem := doc.LookupElement(compressionField)
+	if elem == nil {
+		return CompressionZlib, nil
+	}
+
+	codec, ok := elem.Value().Int32OK()
+	if !ok {
+		return 0, errors.New("compression codec field is not an int32")
+	}
+	if codec < 0 || codec > 0xff {
+		return 0, errors.Errorf("unsupported compression codec %d", codec)
+	}
+
+	out := Compression(codec)
+	return out, errors.WithStack(out.Validate())
+}
+
+// compressBuffer compresses a payload with the codec, prefixed with
+// the length of the uncompressed payload.
+func compressBuffer(codec Compression, input []byte) ([]byte, error) {
+	switch codec {
+	case CompressionZlib:
+		buf := bytes.NewBuffer([]byte{})
+		buf.Write(encodeSizeValue(uint32(len(input))))
+
+		zbuf := getZlibWriter(buf)
+		defer zlibWriterPool.Put(zbuf)
+		if _, err := zbuf.Write(input); err != nil {
+			return nil, err
+		}
+		if err := zbuf.Close(); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	case CompressionSnappy:
+		out := make([]byte, 4, 4+snappy.MaxEncodedLen(len(input)))
+		binary.LittleEndian.PutUint32(out, uint32(len(input)))
+
+		return append(out, snappy.Encode(nil, input)...), nil
+	case CompressionLZ4:
+		out := make([]byte, 4+lz4.CompressBlockBound(len(input)))
+		binary.LittleEndian.PutUint32(out, uint32(len(input)))
+
+		var compressor lz4.Compressor
+		n, err := compressor.CompressBlock(input, out[4:])
+		if err != nil {
+			return nil, errors.Wrap(err, "problem compressing lz4 payload")
+		}
+
+		return out[:4+n], nil
+	default:
+		return nil, errors.WithStack(codec.Validate())
+	}
+}
+
+// decompressBuffer returns the payload that compressBuffer
+// compressed.
+func decompressBuffer(codec Compression, data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errors.New("compressed payload is too short")
+	}
+	size := int(binary.LittleEndian.Uint32(data))
+
+	var (
+		out []byte
+		err error
+	)
+
+	switch codec {
+	case CompressionZlib:
+		z, err := getZlibReader(bytes.NewBuffer(data[4:]))
+		if err != nil {
+			return nil, errors.Wrap(err, "problem building zlib reader")
+		}
+		defer zlibReaderPool.Put(z)
+		// the standard format does not require the length
+		// prefix to be exact, so it's not checked.
+		out, err = ioutil.ReadAll(z)
+		return out, errors.Wrap(err, "problem decompressing zlib payload")
+	case CompressionSnappy:
+		if out, err = snappy.Decode(nil, data[4:]); err != nil {
+			return nil, errors.Wrap(err, "problem decompressing snappy payload")
+		}
+	case CompressionLZ4:
+		// the block format does not record the decompressed
+		// size, so the length prefix sizes the buffer, which
+		// must not be implausibly large for the payload.
+		if size > 255*len(data) {
+			return nil, errors.Errorf("lz4 payload of %d bytes cannot hold %d bytes", len(data)-4, size)
+		}
+		out = make([]byte, size)
+		var n int
+		if n, err = lz4.UncompressBlock(data[4:], out); err != nil {
+			return nil, errors.Wrap(err, "problem decompressing lz4 payload")
+		}
+		out = out[:n]
+	default:
+		return nil, errors.WithStack(codec.Validate())
+	}
+
+	if len(out) != size {
+		return nil, errors.Errorf("decompressed payload has %d bytes, expected %d", len(out), size)
+	}
+
+	return out, nil
+}
+
+// zlib compressors and decompressors allocate large windows, so they
+// are pooled between chunks rather than created for each chunk.
+var (
+	zlibWriterPool sync.Pool
+	zlibReaderPool sync.Pool
+)
+
+func getZlibWriter(w io.Writer) *zlib.Writer {
+	if z, ok := zlibWriterPool.Get().(*zlib.Writer); ok {
+		recordPoolGet(true)
+		z.Reset(w)
+		return z
+	}
+
+	recordPoolGet(false)
+	return zlib.NewWriter(w)
+}
+
+func getZlibReader(r io.Reader) (io.ReadCloser, error) {
+	if z, ok := zlibReaderPool.Get().(io.ReadCloser); ok {
+		recordPoolGet(true)
+		if err := z.(zlib.Resetter).Reset(r, nil); err != nil {
+			return nil, err
+		}
+		return z, nil
+	}
+
+	recordPoolGet(false)
+	return zlib.NewReader(r)
+}
@@ -0,0 +1,213 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"os/exec"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLZ4Payload(t *testing.T) {
+	random := make([]byte, 1<<16)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog. "), 1000)
+	runs := append(bytes.Repeat([]byte{0}, 10000), bytes.Repeat([]byte{1, 2}, 10000)...)
+
+	inputs := map[string][]byte{
+		"Empty":  {},
+		"Short":  []byte("abc"),
+		"Random": random,
+		"Text":   text,
+		"Runs":   runs,
+		"Mixed":  append(append([]byte{}, random[:1000]...), text...),
+	}
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			compressed, err := compressBuffer(CompressionLZ4, input)
+			require.NoError(t, err)
+			assert.EqualValues(t, len(input), binary.LittleEndian.Uint32(compressed))
+
+			out, err := decompressBuffer(CompressionLZ4, compressed)
+			require.NoError(t, err)
+			assert.Equal(t, len(input), len(out))
+			assert.True(t, bytes.Equal(input, out))
+		})
+	}
+	t.Run("CompressesRepetitiveData", func(t *testing.T) {
+		for _, input := range [][]byte{text, runs} {
+			compressed, err := compressBuffer(CompressionLZ4, input)
+			require.NoError(t, err)
+			assert.True(t, len(compressed) < len(input)/10)
+		}
+	})
+	t.Run("ReferenceBlock", func(t *testing.T) {
+		// a block written by the reference lz4 tool.
+		block, err := hex.DecodeString("5f66746463200500107f6d657472696373080000507472696373")
+		require.NoError(t, err)
+		expected := "ftdc ftdc ftdc ftdc ftdc ftdc ftdc ftdc metrics metrics metrics metrics"
+
+		out, err := decompressBuffer(CompressionLZ4, append(encodeSizeValue(uint32(len(expected))), block...))
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(out))
+	})
+	t.Run("ReferenceTool", func(t *testing.T) {
+		if _, err := exec.LookPath("lz4"); err != nil {
+			t.Skip("lz4 is not installed")
+		}
+
+		for name, input := range inputs {
+			compressed, err := compressBuffer(CompressionLZ4, input)
+			require.NoError(t, err)
+
+			// wrap the block in a frame with one independent
+			// block of up to 4MB, no checksums, and an end mark.
+			frame := []byte{0x04, 0x22, 0x4d, 0x18, 0x60, 0x70, 0x73}
+			frame = append(frame, encodeSizeValue(uint32(len(compressed)-4))...)
+			frame = append(frame, compressed[4:]...)
+			frame = append(frame, 0, 0, 0, 0)
+
+			cmd := exec.Command("lz4", "-d", "-c")
+			cmd.Stdin = bytes.NewReader(frame)
+			out, err := cmd.Output()
+			require.NoError(t, err, name)
+			assert.True(t, bytes.Equal(input, out), name)
+		}
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		compressed, err := compressBuffer(CompressionLZ4, text)
+		require.NoError(t, err)
+		size := encodeSizeValue(uint32(len(text)))
+
+		for name, data := range map[string][]byte{
+			"WrongSize":       append(encodeSizeValue(uint32(len(text)-1)), compressed[4:]...),
+			"LargerSize":      append(encodeSizeValue(uint32(len(text)+1)), compressed[4:]...),
+			"Truncated":       compressed[:len(compressed)/2],
+			"ZeroOffset":      append(encodeSizeValue(5), 0x10, 'a', 0, 0),
+			"OffsetTooLarge":  append(encodeSizeValue(5), 0x10, 'a', 2, 0),
+			"MissingOffset":   append(encodeSizeValue(5), 0x10, 'a', 1),
+			"MissingLength":   append(encodeSizeValue(20), 0xf0),
+			"ImplausibleSize": append(encodeSizeValue(1<<30), 0x00),
+			"NoBlock":         size,
+		} {
+			_, err := decompressBuffer(CompressionLZ4, data)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestCompressedCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	samples := make([]*bsonx.Document, 100)
+	for idx := range samples {
+		samples[idx] = bsonx.NewDocument(
+			bsonx.EC.Int64("counter", int64(idx*10)),
+			bsonx.EC.Int64("gauge", rand.Int63n(1000)),
+			bsonx.EC.Double("ratio", float64(idx)/2),
+			bsonx.EC.SubDocumentFromElements("nested", bsonx.EC.Int32("static", 42)),
+		)
+	}
+	readChunk := func(t *testing.T, data []byte) *Chunk {
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		chunk := iter.Chunk()
+		require.False(t, iter.Next())
+		require.NoError(t, iter.Err())
+		return chunk
+	}
+	// the chunks of every codec must hold the same metrics as the
+	// chunk of the basic collector.
+	expected := func() *Chunk {
+		collector := NewBaseCollector(len(samples))
+		for _, doc := range samples {
+			require.NoError(t, collector.Add(doc))
+		}
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+		return readChunk(t, data)
+	}()
+	assertSamples := func(t *testing.T, chunk *Chunk) {
+		require.Equal(t, len(samples), chunk.Size())
+		require.Len(t, chunk.Metrics, len(expected.Metrics))
+		for idx, metric := range chunk.Metrics {
+			assert.Equal(t, expected.Metrics[idx].Key(), metric.Key())
+			assert.Equal(t, expected.Metrics[idx].Values, metric.Values, metric.Key())
+		}
+	}
+	chunkDocument := func(t *testing.T, data []byte) *bsonx.Document {
+		doc, err := bsonx.ReadDocument(data)
+		require.NoError(t, err)
+		return doc
+	}
+
+	for _, codec := range []Compression{CompressionZlib, CompressionSnappy, CompressionLZ4} {
+		t.Run(codec.String(), func(t *testing.T) {
+			t.Run("RoundTrip", func(t *testing.T) {
+				collector := NewCompressedCollector(len(samples), codec)
+				for _, doc := range samples {
+					require.NoError(t, collector.Add(doc))
+				}
+				data, err := collector.Resolve()
+				require.NoError(t, err)
+
+				elem := chunkDocument(t, data).LookupElement(compressionField)
+				if codec == CompressionZlib {
+					assert.Nil(t, elem, "zlib chunks use the standard format")
+				} else {
+					require.NotNil(t, elem)
+					assert.EqualValues(t, codec, elem.Value().Int32())
+				}
+
+				assertSamples(t, readChunk(t, data))
+			})
+			t.Run("Streaming", func(t *testing.T) {
+				buf := &bytes.Buffer{}
+				collector := NewStreamingCompressedCollector(len(samples), codec, buf)
+				for _, doc := range samples {
+					require.NoError(t, collector.Add(doc))
+				}
+				require.NoError(t, FlushCollector(collector, buf))
+
+				assertSamples(t, readChunk(t, buf.Bytes()))
+			})
+		})
+	}
+	t.Run("UnsupportedCodec", func(t *testing.T) {
+		collector := NewCompressedCollector(len(samples), Compression(100))
+		require.NoError(t, collector.Add(samples[0]))
+		_, err := collector.Resolve()
+		assert.Error(t, err)
+	})
+	t.Run("InvalidChunks", func(t *testing.T) {
+		collector := NewCompressedCollector(len(samples), CompressionSnappy)
+		require.NoError(t, collector.Add(samples[0]))
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		for name, codec := range map[string]*bsonx.Value{
+			"Unknown":      bsonx.VC.Int32(100),
+			"OutOfRange":   bsonx.VC.Int32(1000),
+			"WrongType":    bsonx.VC.String("snappy"),
+			"WrongDecoder": bsonx.VC.Int32(int32(CompressionLZ4)),
+		} {
+			doc := chunkDocument(t, data)
+			doc.Set(bsonx.EC.FromValue(compressionField, codec))
+			out, err := doc.MarshalBSON()
+			require.NoError(t, err)
+
+			iter := ReadChunks(ctx, bytes.NewReader(out))
+			assert.False(t, iter.Next(), name)
+			assert.Error(t, iter.Err(), name)
+			iter.Close()
+		}
+	})
+}
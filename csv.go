@@ -26,16 +26,22 @@ func (c *Chunk) getFieldNames() []string {
 func (c *Chunk) getRecord(i int) []string {
 	fields := make([]string, len(c.Metrics))
 	for idx, m := range c.Metrics {
-		switch m.originalType {
-		case bsontype.Double, bsontype.Int32, bsontype.Int64, bsontype.Boolean, bsontype.Timestamp:
-			fields[idx] = strconv.FormatInt(m.Values[i], 10)
-		case bsontype.DateTime:
-			fields[idx] = time.Unix(m.Values[i]/1000, 0).Format(time.RFC3339)
-		}
+		fields[idx] = m.csvValue(i)
 	}
 	return fields
 }
 
+func (m *Metric) csvValue(i int) string {
+	switch m.originalType {
+	case bsontype.Double, bsontype.Int32, bsontype.Int64, bsontype.Boolean, bsontype.Timestamp:
+		return strconv.FormatInt(m.Values[i], 10)
+	case bsontype.DateTime:
+		return time.Unix(m.Values[i]/1000, 0).Format(time.RFC3339)
+	default:
+		return ""
+	}
+}
+
 // WriteCSV exports the contents of a stream of chunks as CSV. Returns
 // an error if the number of metrics changes between points, or if
 // there are any errors writing data.
@@ -75,6 +81,97 @@ func WriteCSV(ctx context.Context, iter *ChunkIterator, writer io.Writer) error
 	return nil
 }
 
+// WriteCSVUnified exports the contents of a stream of chunks as CSV,
+// like WriteCSV, but supports streams in which the schema changes
+// (e.g. data collected across restarts of a process.) The header holds
+// every metric that appears in any chunk, in the order in which they
+// first appear, and the fields of the metrics that a chunk does not
+// have are empty.
+//
+// Because the header depends on every chunk, WriteCSVUnified reads
+// the stream twice: seekable iterators (see NewSeekableChunkIterator)
+// are rewound for the second pass, and the chunks of other iterators
+// are held in memory until they are written.
+func WriteCSVUnified(ctx context.Context, iter *ChunkIterator, writer io.Writer) error {
+	seekable := iter.Len() >= 0
+
+	var (
+		header  []string
+		columns = map[string]int{}
+		chunks  []*Chunk
+	)
+	for iter.Next() {
+		if ctx.Err() != nil {
+			return errors.New("operation aborted")
+		}
+
+		chunk := iter.Chunk()
+		for _, m := range chunk.Metrics {
+			key := m.Key()
+			if _, ok := columns[key]; !ok {
+				columns[key] = len(header)
+				header = append(header, key)
+			}
+		}
+		if !seekable {
+			chunks = append(chunks, chunk)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return errors.Wrap(err, "problem reading chunks")
+	}
+	if len(header) == 0 {
+		return nil
+	}
+
+	csvw := csv.NewWriter(writer)
+	if err := csvw.Write(header); err != nil {
+		return errors.Wrap(err, "problem writing field names")
+	}
+
+	write := func(chunk *Chunk) error {
+		record := make([]string, len(header))
+		for i := 0; i < chunk.nPoints; i++ {
+			for idx := range record {
+				record[idx] = ""
+			}
+			for _, m := range chunk.Metrics {
+				record[columns[m.Key()]] = m.csvValue(i)
+			}
+			if err := csvw.Write(record); err != nil {
+				return errors.Wrapf(err, "problem writing csv record %d of %d", i, chunk.nPoints)
+			}
+		}
+		csvw.Flush()
+		return errors.Wrap(csvw.Error(), "problem flushing csv data")
+	}
+
+	if !seekable {
+		for _, chunk := range chunks {
+			if ctx.Err() != nil {
+				return errors.New("operation aborted")
+			}
+			if err := write(chunk); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	}
+
+	if err := iter.Seek(0); err != nil {
+		return errors.Wrap(err, "problem rewinding chunks")
+	}
+	for iter.Next() {
+		if ctx.Err() != nil {
+			return errors.New("operation aborted")
+		}
+		if err := write(iter.Chunk()); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.Wrap(iter.Err(), "problem reading chunks")
+}
+
 func getCSVFile(prefix string, count int) (io.WriteCloser, error) {
 	fn := fmt.Sprintf("%s.%d.csv", prefix, count)
 	writer, err := os.Create(fn)
@@ -56,6 +56,49 @@ func TestWriteCSVIntegration(t *testing.T) {
 
 		require.Error(t, err)
 	})
+	t.Run("WriteUnifiedWithSchemaChange", func(t *testing.T) {
+		// the second schema adds a metric, and the third drops
+		// one of the original metrics.
+		buf := &bytes.Buffer{}
+		collector := NewBaseCollector(10)
+		for _, doc := range []*bsonx.Document{
+			bsonx.NewDocument(bsonx.EC.Int64("a", 1), bsonx.EC.Int64("b", 2)),
+			bsonx.NewDocument(bsonx.EC.Int64("a", 3), bsonx.EC.Int64("b", 4), bsonx.EC.Int64("c", 5)),
+			bsonx.NewDocument(bsonx.EC.Int64("a", 6), bsonx.EC.Int64("c", 7)),
+		} {
+			require.NoError(t, collector.Add(doc))
+			require.NoError(t, FlushCollector(collector, buf))
+		}
+		data := buf.Bytes()
+		expected := [][]string{{"a", "b", "c"}, {"1", "2", ""}, {"3", "4", "5"}, {"6", "", "7"}}
+
+		for name, iter := range map[string]func(t *testing.T) *ChunkIterator{
+			"Streaming": func(t *testing.T) *ChunkIterator { return ReadChunks(ctx, bytes.NewReader(data)) },
+			"Seekable": func(t *testing.T) *ChunkIterator {
+				iter, err := NewSeekableChunkIterator(ctx, bytes.NewReader(data), int64(len(data)))
+				require.NoError(t, err)
+				return iter
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				out := &bytes.Buffer{}
+				require.NoError(t, WriteCSVUnified(ctx, iter(t), out))
+
+				records, err := csv.NewReader(out).ReadAll()
+				require.NoError(t, err)
+				assert.Equal(t, expected, records)
+			})
+		}
+	})
+	t.Run("WriteUnifiedMatchesWriteCSV", func(t *testing.T) {
+		data := newChunk(10)
+		unified := &bytes.Buffer{}
+		require.NoError(t, WriteCSVUnified(ctx, ReadChunks(ctx, bytes.NewReader(data)), unified))
+
+		out := &bytes.Buffer{}
+		require.NoError(t, WriteCSV(ctx, ReadChunks(ctx, bytes.NewReader(data)), out))
+		assert.Equal(t, out.String(), unified.String())
+	})
 }
 
 func TestReadCSVIntegration(t *testing.T) {
@@ -0,0 +1,166 @@
+package ftdc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// Deduplicator detects samples that were already ingested, for
+// pipelines that may deliver the same chunks or samples more than
+// once (e.g. shipping layers with at-least-once delivery.) Samples are
+// identified by their source, their timestamp, and the hash of their
+// schema, and the deduplicator remembers a bounded number of the most
+// recently recorded samples, so redeliveries that arrive after more
+// than that number of other samples are not detected.
+//
+// The timestamp of a sample is the value of its first date time
+// metric. Samples without a date time metric cannot be identified,
+// and are never considered duplicates.
+//
+// Deduplicators are safe for concurrent use.
+type Deduplicator struct {
+	mu         sync.Mutex
+	seen       map[dedupKey]struct{}
+	window     []dedupKey
+	next       int
+	duplicates int
+}
+
+type dedupKey struct {
+	source string
+	ts     int64
+	schema string
+}
+
+// NewDeduplicator returns a deduplicator that remembers the specified
+// number of samples.
+func NewDeduplicator(window int) (*Deduplicator, error) {
+	if window < 1 {
+		return nil, errors.New("window must be at least one sample")
+	}
+
+	return &Deduplicator{
+		seen:   make(map[dedupKey]struct{}, window),
+		window: make([]dedupKey, 0, window),
+	}, nil
+}
+
+// Seen records a sample, identified by its source, timestamp, and
+// schema hash, and reports whether the sample was already recorded.
+func (d *Deduplicator) Seen(source string, ts time.Time, schema string) bool {
+	key := dedupKey{source: source, ts: ts.UnixNano(), schema: schema}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.seen[key]; ok {
+		d.duplicates++
+		return true
+	}
+
+	if len(d.window) < cap(d.window) {
+		d.window = append(d.window, key)
+	} else {
+		delete(d.seen, d.window[d.next])
+		d.window[d.next] = key
+		d.next = (d.next + 1) % len(d.window)
+	}
+	d.seen[key] = struct{}{}
+
+	return false
+}
+
+// Duplicates returns the number of duplicate samples that the
+// deduplicator has detected.
+func (d *Deduplicator) Duplicates() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.duplicates
+}
+
+// SeenSample records a sample document from the source, and reports
+// whether the sample was already recorded.
+func (d *Deduplicator) SeenSample(source string, doc *bsonx.Document) (bool, error) {
+	ts, ok, err := sampleTime(doc)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if !ok {
+		return false, nil
+	}
+
+	schema, _ := metricKeyHash(doc)
+	return d.Seen(source, ts, schema), nil
+}
+
+// sampleTime returns the value of the first date time metric of the
+// document, in the order that collectors extract metrics, and false if
+// the document does not have a date time metric.
+func sampleTime(doc *bsonx.Document) (time.Time, bool, error) {
+	iter := doc.Iterator()
+	for iter.Next() {
+		val := iter.Element().Value()
+
+		var sub *bsonx.Document
+		switch val.Type() {
+		case bsontype.DateTime:
+			return val.Time(), true, nil
+		case bsontype.EmbeddedDocument:
+			sub = val.MutableDocument()
+		case bsontype.Array:
+			sub = val.MutableArrayDocument()
+		default:
+			continue
+		}
+
+		if ts, ok, err := sampleTime(sub); ok || err != nil {
+			return ts, ok, err
+		}
+	}
+
+	return time.Time{}, false, errors.WithStack(iter.Err())
+}
+
+type dedupCollector struct {
+	dedup  *Deduplicator
+	source string
+	Collector
+}
+
+// NewDeduplicatingCollector wraps a collector so that samples that the
+// deduplicator has already recorded for the source are dropped rather
+// than added to the collector. Use one deduplicator for all of the
+// collectors that write to an archive, and the chunk iterator and
+// StructuredIterator to add the samples of received chunks.
+func NewDeduplicatingCollector(dedup *Deduplicator, source string, collector Collector) Collector {
+	return &dedupCollector{
+		dedup:     dedup,
+		source:    source,
+		Collector: collector,
+	}
+}
+
+func (c *dedupCollector) Stats() CollectorStats     { return getCollectorStats(c.Collector) }
+func (c *dedupCollector) Snapshot() ([]byte, error) { return snapshotCollector(c.Collector) }
+
+func (c *dedupCollector) Add(in interface{}) error {
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	seen, err := c.dedup.SeenSample(c.source, doc)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if seen {
+		return nil
+	}
+
+	return errors.WithStack(c.Collector.Add(doc))
+}
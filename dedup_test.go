@@ -0,0 +1,124 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicator(t *testing.T) {
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(i int) *bsonx.Document {
+		return bsonx.NewDocument(
+			bsonx.EC.SubDocument("host", bsonx.NewDocument(
+				bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+			)),
+			bsonx.EC.Int64("value", int64(i)),
+		)
+	}
+
+	t.Run("InvalidWindow", func(t *testing.T) {
+		_, err := NewDeduplicator(0)
+		assert.Error(t, err)
+	})
+	t.Run("Keys", func(t *testing.T) {
+		dedup, err := NewDeduplicator(10)
+		require.NoError(t, err)
+
+		assert.False(t, dedup.Seen("a", base, "schema"))
+		assert.True(t, dedup.Seen("a", base, "schema"))
+		assert.False(t, dedup.Seen("b", base, "schema"))
+		assert.False(t, dedup.Seen("a", base.Add(time.Millisecond), "schema"))
+		assert.False(t, dedup.Seen("a", base, "other"))
+		assert.Equal(t, 1, dedup.Duplicates())
+	})
+	t.Run("Window", func(t *testing.T) {
+		dedup, err := NewDeduplicator(3)
+		require.NoError(t, err)
+
+		for i := 0; i < 4; i++ {
+			assert.False(t, dedup.Seen("a", base.Add(time.Duration(i)*time.Second), ""))
+		}
+		// the first sample has been evicted, and the rest are
+		// still remembered.
+		assert.False(t, dedup.Seen("a", base, ""))
+		assert.True(t, dedup.Seen("a", base.Add(3*time.Second), ""))
+		assert.Len(t, dedup.seen, 3)
+	})
+	t.Run("Samples", func(t *testing.T) {
+		dedup, err := NewDeduplicator(10)
+		require.NoError(t, err)
+
+		seen, err := dedup.SeenSample("a", sample(1))
+		require.NoError(t, err)
+		assert.False(t, seen)
+		seen, err = dedup.SeenSample("a", sample(1))
+		require.NoError(t, err)
+		assert.True(t, seen)
+
+		// the schema is part of the key.
+		doc := sample(1)
+		doc.Append(bsonx.EC.Int64("extra", 1))
+		seen, err = dedup.SeenSample("a", doc)
+		require.NoError(t, err)
+		assert.False(t, seen)
+
+		// samples without timestamps are never duplicates.
+		untimed := bsonx.NewDocument(bsonx.EC.Int64("value", 1))
+		for i := 0; i < 2; i++ {
+			seen, err = dedup.SeenSample("a", untimed)
+			require.NoError(t, err)
+			assert.False(t, seen)
+		}
+	})
+	t.Run("Collector", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// simulate a redelivered chunk, which overlaps with
+		// the previous chunk.
+		deliveries := [][]int{{0, 1, 2, 3, 4}, {3, 4, 5, 6}, {0, 1, 2, 3, 4}}
+		received := &bytes.Buffer{}
+		for _, delivery := range deliveries {
+			collector := NewBaseCollector(len(delivery))
+			for _, i := range delivery {
+				require.NoError(t, collector.Add(sample(i)))
+			}
+			require.NoError(t, FlushCollector(collector, received))
+		}
+
+		dedup, err := NewDeduplicator(100)
+		require.NoError(t, err)
+		collector := NewDeduplicatingCollector(dedup, "host", NewBatchCollector(100))
+
+		chunks := ReadChunks(ctx, bytes.NewReader(received.Bytes()))
+		defer chunks.Close()
+		for chunks.Next() {
+			samples := chunks.Chunk().StructuredIterator(ctx)
+			for samples.Next() {
+				require.NoError(t, collector.Add(samples.Document()))
+			}
+			require.NoError(t, samples.Err())
+			samples.Close()
+		}
+		require.NoError(t, chunks.Err())
+		assert.Equal(t, 7, collector.Info().SampleCount)
+		assert.Equal(t, 7, dedup.Duplicates())
+
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+		values := []int64{}
+		iter := ReadMetrics(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		for iter.Next() {
+			values = append(values, iter.Document().Lookup("value").Int64())
+		}
+		require.NoError(t, iter.Err())
+		assert.Equal(t, []int64{0, 1, 2, 3, 4, 5, 6}, values)
+	})
+}
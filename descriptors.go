@@ -0,0 +1,261 @@
+package ftdc
+
+import (
+	"sort"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// Metric Descriptors
+//
+// Descriptor collectors record the unit, kind, and description of
+// metrics, keyed by the flattened name of the metric (see
+// Metric.Key), in the "descriptors" array of the metadata document
+// that they pass to the wrapped collector, so that readers (e.g.
+// exporters that build Prometheus or OpenTelemetry metrics) can
+// interpret the values of the metrics.
+const metricDescriptorsField = "descriptors"
+
+// MetricKind describes how the values of a metric change over time.
+type MetricKind string
+
+const (
+	// MetricKindUnknown is the kind of metrics without a
+	// descriptor, or with a descriptor that doesn't specify one.
+	MetricKindUnknown MetricKind = ""
+	// MetricKindCounter is the kind of metrics that only
+	// increase, except when they're reset.
+	MetricKindCounter MetricKind = "counter"
+	// MetricKindGauge is the kind of metrics whose values may
+	// increase or decrease.
+	MetricKindGauge MetricKind = "gauge"
+)
+
+// Validate returns an error if the kind is not a known kind.
+func (k MetricKind) Validate() error {
+	switch k {
+	case MetricKindUnknown, MetricKindCounter, MetricKindGauge:
+		return nil
+	default:
+		return errors.Errorf("invalid metric kind '%s'", k)
+	}
+}
+
+// MetricDescriptor describes the values of a metric.
+type MetricDescriptor struct {
+	// Unit is the unit of the values (e.g. "ms" or "bytes"), and
+	// is empty for dimensionless values.
+	Unit        string
+	Kind        MetricKind
+	Description string
+}
+
+func (d MetricDescriptor) document(key string) *bsonx.Document {
+	return bsonx.NewDocument(
+		bsonx.EC.String("key", key),
+		bsonx.EC.String("unit", d.Unit),
+		bsonx.EC.String("kind", string(d.Kind)),
+		bsonx.EC.String("description", d.Description),
+	)
+}
+
+func readMetricDescriptor(doc *bsonx.Document) (string, MetricDescriptor, error) {
+	out := MetricDescriptor{}
+
+	key, ok := doc.Lookup("key").StringValueOK()
+	if !ok || key == "" {
+		return "", out, errors.New("metric descriptor has no key")
+	}
+	out.Unit, _ = doc.Lookup("unit").StringValueOK()
+	kind, _ := doc.Lookup("kind").StringValueOK()
+	out.Kind = MetricKind(kind)
+	out.Description, _ = doc.Lookup("description").StringValueOK()
+
+	return key, out, nil
+}
+
+// DescriptorCollector is a Collector that records descriptors of its
+// metrics in the metadata of the chunks that it writes.
+type DescriptorCollector interface {
+	Collector
+
+	// Describe records the descriptor of the metric with the
+	// flattened name, replacing an existing descriptor of the
+	// metric. Chunks that the collector resolves after the call
+	// hold the descriptor.
+	Describe(key string, desc MetricDescriptor) error
+
+	// Descriptors returns the descriptors that the collector
+	// records, by flattened name.
+	Descriptors() map[string]MetricDescriptor
+}
+
+type descriptorCollector struct {
+	metadata    *bsonx.Document
+	descriptors map[string]MetricDescriptor
+	Collector
+}
+
+// NewDescriptorCollector wraps a collector so that it records the
+// descriptors of metrics, which you add with Describe, in the
+// metadata document. Descriptors are keyed by the flattened names
+// of metrics, and may describe metrics that the collector never
+// collects. Use ChunkIterator.MetricDescriptors or
+// Chunk.MetricDescriptors to read the descriptors back.
+//
+// SetMetadata sets the rest of the metadata document, and preserves
+// the descriptors.
+func NewDescriptorCollector(collector Collector) DescriptorCollector {
+	return &descriptorCollector{
+		Collector:   collector,
+		descriptors: map[string]MetricDescriptor{},
+	}
+}
+
+func (c *descriptorCollector) Stats() CollectorStats     { return getCollectorStats(c.Collector) }
+func (c *descriptorCollector) Snapshot() ([]byte, error) { return snapshotCollector(c.Collector) }
+
+func (c *descriptorCollector) SetMetadata(in interface{}) error {
+	var doc *bsonx.Document
+	if in != nil {
+		var err error
+		if doc, err = readDocument(in); err != nil {
+			return errors.WithStack(err)
+		}
+		if doc.LookupElement(metricDescriptorsField) != nil {
+			return errors.Errorf("metadata documents cannot have a '%s' field", metricDescriptorsField)
+		}
+	}
+
+	return errors.WithStack(c.setMetadata(doc, c.descriptors))
+}
+
+func (c *descriptorCollector) Describe(key string, desc MetricDescriptor) error {
+	if key == "" {
+		return errors.New("metric descriptors must have a key")
+	}
+	if err := desc.Kind.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	descriptors := make(map[string]MetricDescriptor, len(c.descriptors)+1)
+	for k, v := range c.descriptors {
+		descriptors[k] = v
+	}
+	descriptors[key] = desc
+
+	return errors.WithStack(c.setMetadata(c.metadata, descriptors))
+}
+
+func (c *descriptorCollector) Descriptors() map[string]MetricDescriptor {
+	out := make(map[string]MetricDescriptor, len(c.descriptors))
+	for k, v := range c.descriptors {
+		out[k] = v
+	}
+	return out
+}
+
+func (c *descriptorCollector) setMetadata(doc *bsonx.Document, descriptors map[string]MetricDescriptor) error {
+	var metadata *bsonx.Document
+	if len(descriptors) > 0 {
+		keys := make([]string, 0, len(descriptors))
+		for key := range descriptors {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		entries := bsonx.NewArray()
+		for _, key := range keys {
+			entries.Append(bsonx.VC.Document(descriptors[key].document(key)))
+		}
+
+		metadata = bsonx.NewDocument()
+		if doc != nil {
+			metadata = doc.Copy()
+		}
+		metadata.Append(bsonx.EC.Array(metricDescriptorsField, entries))
+	} else if doc != nil {
+		metadata = doc
+	}
+
+	var err error
+	if metadata == nil {
+		err = c.Collector.SetMetadata(nil)
+	} else {
+		err = c.Collector.SetMetadata(metadata)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.metadata = doc
+	c.descriptors = descriptors
+	return nil
+}
+
+// MetricDescriptors returns the descriptors of metrics recorded in the
+// metadata of the chunk, by flattened name, which is empty for chunks
+// that were not written by a descriptor collector.
+func (c *Chunk) MetricDescriptors() (map[string]MetricDescriptor, error) {
+	out := map[string]MetricDescriptor{}
+
+	metadata := c.userMetadata()
+	if metadata == nil {
+		return out, nil
+	}
+	elem := metadata.LookupElement(metricDescriptorsField)
+	if elem == nil {
+		return out, nil
+	}
+
+	entries, ok := elem.Value().MutableArrayOK()
+	if !ok {
+		return nil, errors.New("metric descriptors field is not an array")
+	}
+
+	iter := entries.Iterator()
+	for iter.Next() {
+		value := iter.Value()
+		if value.Type() != bsontype.EmbeddedDocument {
+			return nil, errors.Errorf("metric descriptor %d is not a document", len(out))
+		}
+
+		key, desc, err := readMetricDescriptor(value.MutableDocument())
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem reading metric descriptor %d", len(out))
+		}
+		out[key] = desc
+	}
+
+	return out, nil
+}
+
+// descriptorLog accumulates the metric descriptors of the chunks that
+// an iterator returns. Descriptors in later chunks replace the
+// descriptors of the same metrics in earlier chunks.
+type descriptorLog struct {
+	last        *bsonx.Document
+	descriptors map[string]MetricDescriptor
+}
+
+func (l *descriptorLog) add(chunk *Chunk) error {
+	if chunk.metadata == nil || chunk.metadata == l.last {
+		return nil
+	}
+	l.last = chunk.metadata
+
+	descriptors, err := chunk.MetricDescriptors()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if l.descriptors == nil {
+		l.descriptors = map[string]MetricDescriptor{}
+	}
+	for key, desc := range descriptors {
+		l.descriptors[key] = desc
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescriptorCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sample := func(i int) *bsonx.Document {
+		return bsonx.NewDocument(
+			bsonx.EC.Int64("ops", int64(i)),
+			bsonx.EC.SubDocumentFromElements("mem", bsonx.EC.Int64("resident", int64(i*1024))),
+		)
+	}
+	latency := MetricDescriptor{Unit: "ms", Kind: MetricKindGauge, Description: "operation latency"}
+	ops := MetricDescriptor{Kind: MetricKindCounter, Description: "operations"}
+	resident := MetricDescriptor{Unit: "bytes", Kind: MetricKindGauge}
+
+	t.Run("Describe", func(t *testing.T) {
+		collector := NewDescriptorCollector(NewBaseCollector(10))
+		require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "example"))))
+		require.NoError(t, collector.Describe("ops", ops))
+		require.NoError(t, collector.Describe("mem.resident", latency))
+		require.NoError(t, collector.Describe("mem.resident", resident))
+
+		assert.Error(t, collector.Describe("", ops))
+		assert.Error(t, collector.Describe("ops", MetricDescriptor{Kind: "histogram"}))
+		assert.Error(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.Int32(metricDescriptorsField, 1))))
+		assert.Equal(t, map[string]MetricDescriptor{"ops": ops, "mem.resident": resident}, collector.Descriptors())
+
+		buf := &bytes.Buffer{}
+		for i := 0; i < 10; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		iter := ReadChunks(ctx, bytes.NewReader(buf.Bytes()))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		chunk := iter.Chunk()
+		descriptors, err := chunk.MetricDescriptors()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]MetricDescriptor{"ops": ops, "mem.resident": resident}, descriptors)
+		for _, m := range chunk.Metrics {
+			_, ok := descriptors[m.Key()]
+			assert.True(t, ok, m.Key())
+		}
+
+		// the rest of the metadata is preserved.
+		assert.Equal(t, "example", chunk.userMetadata().Lookup("host").StringValue())
+		assert.Equal(t, descriptors, iter.MetricDescriptors())
+		assert.False(t, iter.Next())
+		require.NoError(t, iter.Err())
+	})
+	t.Run("Iterator", func(t *testing.T) {
+		collector := NewDescriptorCollector(NewBaseCollector(10))
+		buf := &bytes.Buffer{}
+		require.NoError(t, collector.Describe("ops", ops))
+		for i := 0; i < 10; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		// setting the metadata keeps the descriptors, and later
+		// descriptors replace earlier ones.
+		require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "example"))))
+		require.NoError(t, collector.Describe("ops", latency))
+		require.NoError(t, collector.Describe("mem.resident", resident))
+		for i := 0; i < 10; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		iter := ReadChunks(ctx, bytes.NewReader(buf.Bytes()))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		assert.Equal(t, map[string]MetricDescriptor{"ops": ops}, iter.MetricDescriptors())
+		require.True(t, iter.Next())
+		assert.Equal(t, map[string]MetricDescriptor{"ops": latency, "mem.resident": resident}, iter.MetricDescriptors())
+		assert.False(t, iter.Next())
+		require.NoError(t, iter.Err())
+	})
+	t.Run("WithoutDescriptors", func(t *testing.T) {
+		collector := NewBaseCollector(10)
+		require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "example"))))
+		require.NoError(t, collector.Add(sample(1)))
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		descriptors, err := iter.Chunk().MetricDescriptors()
+		require.NoError(t, err)
+		assert.Empty(t, descriptors)
+		assert.Empty(t, iter.MetricDescriptors())
+	})
+	t.Run("InvalidDescriptors", func(t *testing.T) {
+		chunk := &Chunk{metadata: bsonx.NewDocument(bsonx.EC.SubDocumentFromElements("doc",
+			bsonx.EC.ArrayFromElements(metricDescriptorsField, bsonx.VC.String("ops"))))}
+		_, err := chunk.MetricDescriptors()
+		assert.Error(t, err)
+
+		chunk = &Chunk{metadata: bsonx.NewDocument(bsonx.EC.SubDocumentFromElements("doc",
+			bsonx.EC.ArrayFromElements(metricDescriptorsField, bsonx.VC.DocumentFromElements(bsonx.EC.String("unit", "ms")))))}
+		_, err = chunk.MetricDescriptors()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,194 @@
+package ftdc
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+const (
+	// diagnosticFilePrefix is the prefix of the names of the files
+	// that mongod writes in its diagnostic.data directory, which
+	// is followed by the time at which the file was created (e.g.
+	// "metrics.2019-03-27T14-37-41Z-00000").
+	diagnosticFilePrefix = "metrics."
+
+	// diagnosticInterimFile is the name of the file that holds the
+	// samples that mongod has collected, but not yet written to
+	// the current file.
+	diagnosticInterimFile = "metrics.interim"
+)
+
+// ReadDirectory returns a ChunkIterator for the contents of a mongod
+// diagnostic.data directory, which holds the chunks of every
+// "metrics.<timestamp>" file, in the order in which the files were
+// created, followed by the chunks in the "metrics.interim" file, if
+// it exists, that are more recent than the chunks in the other
+// files. The interim file holds the chunk that mongod has not yet
+// written to the current file, when mongod is running or did not
+// shut down cleanly, and otherwise duplicates chunks in the other
+// files.
+//
+// Because mongod may be writing to the most recent file and to the
+// interim file, an incomplete document at the end of either is
+// ignored, while errors in other files are returned by the Err
+// method of the iterator. ReadDirectory returns an error if the
+// directory holds no FTDC files.
+func ReadDirectory(ctx context.Context, dir string) (*ChunkIterator, error) {
+	files, interim, err := diagnosticDataFiles(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	iter := &ChunkIterator{
+		catcher: grip.NewBasicCatcher(),
+		pipe:    make(chan *Chunk, 2),
+	}
+
+	ipc := make(chan *bsonx.Document)
+	ctx, iter.cancel = context.WithCancel(ctx)
+
+	go func() {
+		iter.catcher.Add(readDiagnosticDirectory(ctx, files, interim, ipc))
+	}()
+
+	go func() {
+		iter.catcher.Add(readChunks(ctx, ipc, iter.pipe))
+	}()
+
+	return iter, nil
+}
+
+// diagnosticDataFiles returns the paths of the metrics files in the
+// directory, sorted by name, which orders them by the time that they
+// were created, and the path of the interim file, which is empty if
+// the directory does not have one.
+func diagnosticDataFiles(dir string) ([]string, string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "problem reading directory")
+	}
+
+	var (
+		files   []string
+		interim string
+	)
+	for _, info := range infos {
+		name := info.Name()
+		if !info.Mode().IsRegular() || !strings.HasPrefix(name, diagnosticFilePrefix) {
+			continue
+		}
+		if name == diagnosticInterimFile {
+			interim = filepath.Join(dir, name)
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	sort.Strings(files)
+
+	if len(files) == 0 && interim == "" {
+		return nil, "", errors.Errorf("no FTDC files in '%s'", dir)
+	}
+
+	return files, interim, nil
+}
+
+// readDiagnosticDirectory sends the documents in the files, in order,
+// followed by the documents of the interim file, except for chunks
+// that are not more recent than the last chunk of the other files.
+func readDiagnosticDirectory(ctx context.Context, files []string, interim string, ch chan<- *bsonx.Document) error {
+	defer close(ch)
+
+	var last time.Time
+	send := func(doc *bsonx.Document) bool {
+		select {
+		case ch <- doc:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for idx, path := range files {
+		err := readDiagnosticFile(path, idx == len(files)-1, func(doc *bsonx.Document) bool {
+			if isNum(1, doc.Lookup("type")) {
+				if id, ok := doc.Lookup("_id").TimeOK(); ok && id.After(last) {
+					last = id
+				}
+			}
+			return send(doc)
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+
+	if interim == "" {
+		return nil
+	}
+
+	return errors.WithStack(readDiagnosticFile(interim, true, func(doc *bsonx.Document) bool {
+		if isNum(1, doc.Lookup("type")) {
+			if id, ok := doc.Lookup("_id").TimeOK(); ok && !id.After(last) {
+				return true
+			}
+		}
+		return send(doc)
+	}))
+}
+
+// readDiagnosticFile calls the function with each document in the
+// file, until the function returns false. If partial is true, an
+// incomplete document at the end of the file, or a zeroed region
+// after the last document, ends the file without an error.
+func readDiagnosticFile(path string, partial bool, fn func(*bsonx.Document) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		// mongod replaces the interim file, so it may be
+		// removed after the directory is read.
+		if partial && os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "problem opening '%s'", path)
+	}
+	defer f.Close()
+
+	buf := bufio.NewReader(f)
+	for {
+		header, err := buf.Peek(4)
+		if err == io.EOF && len(header) == 0 {
+			return nil
+		}
+		if err == nil && int32(binary.LittleEndian.Uint32(header)) < 5 {
+			err = errors.New("invalid document size")
+		}
+		if err == nil {
+			var doc *bsonx.Document
+			if doc, err = readBufBSON(buf); err == nil {
+				if !fn(doc) {
+					return nil
+				}
+				continue
+			}
+		}
+
+		if partial {
+			return nil
+		}
+		return errors.Wrapf(err, "problem reading '%s'", path)
+	}
+}
@@ -0,0 +1,117 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadDirectory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "ftdc-diagnostic-data")
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, os.RemoveAll(dir)) }()
+
+	// chunks returns a file with a metadata document and a chunk
+	// of ten samples for each start time, in seconds, which is
+	// also the _id of both documents, as in the files that mongod
+	// writes.
+	chunks := func(t *testing.T, starts ...int) []byte {
+		buf := &bytes.Buffer{}
+		for _, start := range starts {
+			collector := &betterCollector{maxDeltas: 10, start: time.Unix(int64(start), 0)}
+			require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "mongod"))))
+			for i := start; i < start+10; i++ {
+				require.NoError(t, collector.Add(bsonx.NewDocument(
+					bsonx.EC.Time("start", time.Unix(int64(i), 0)),
+					bsonx.EC.Int64("counter", int64(i)),
+				)))
+			}
+			require.NoError(t, FlushCollector(collector, buf))
+		}
+		return buf.Bytes()
+	}
+	write := func(t *testing.T, name string, data []byte) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), data, 0644))
+	}
+	starts := func(t *testing.T) []int64 {
+		iter, err := ReadDirectory(ctx, dir)
+		require.NoError(t, err)
+		defer iter.Close()
+
+		out := []int64{}
+		for iter.Next() {
+			chunk := iter.Chunk()
+			require.NotNil(t, chunk.GetMetadata())
+			out = append(out, chunk.Metrics[1].Values[0])
+		}
+		require.NoError(t, iter.Err())
+		return out
+	}
+
+	_, err = ReadDirectory(ctx, dir)
+	assert.Error(t, err, "empty directory")
+	_, err = ReadDirectory(ctx, filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+
+	// files are written out of order, and are read in the order
+	// of their names.
+	write(t, "metrics.2020-01-01T00-01-00Z-00000", chunks(t, 20, 30))
+	write(t, "metrics.2020-01-01T00-00-00Z-00000", chunks(t, 0, 10))
+	write(t, "README", []byte("not ftdc data"))
+	assert.Equal(t, []int64{0, 10, 20, 30}, starts(t))
+
+	t.Run("Interim", func(t *testing.T) {
+		// the interim file duplicates the last chunk of the
+		// current file, and holds a more recent chunk.
+		write(t, diagnosticInterimFile, chunks(t, 30, 40))
+		assert.Equal(t, []int64{0, 10, 20, 30, 40}, starts(t))
+	})
+	t.Run("PartialDocuments", func(t *testing.T) {
+		current := chunks(t, 20, 30)
+		write(t, "metrics.2020-01-01T00-01-00Z-00000", current[:len(current)-10])
+		interim := chunks(t, 40)
+		write(t, diagnosticInterimFile, append(interim, make([]byte, 64)...))
+
+		// the last chunk of the current file is incomplete, so
+		// it's missing.
+		assert.Equal(t, []int64{0, 10, 20, 40}, starts(t))
+	})
+	t.Run("CorruptFile", func(t *testing.T) {
+		first := chunks(t, 0, 10)
+		write(t, "metrics.2020-01-01T00-00-00Z-00000", first[:len(first)-10])
+
+		iter, err := ReadDirectory(ctx, dir)
+		require.NoError(t, err)
+		defer iter.Close()
+		count := 0
+		for iter.Next() {
+			count++
+		}
+		assert.Equal(t, 1, count)
+		assert.Error(t, iter.Err())
+	})
+	t.Run("OnlyInterim", func(t *testing.T) {
+		other, err := ioutil.TempDir(dir, "interim")
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(other, diagnosticInterimFile), chunks(t, 50), 0644))
+
+		iter, err := ReadDirectory(ctx, other)
+		require.NoError(t, err)
+		defer iter.Close()
+		require.True(t, iter.Next())
+		assert.EqualValues(t, 50, iter.Chunk().Metrics[1].Values[0])
+		assert.False(t, iter.Next())
+		assert.NoError(t, iter.Err())
+	})
+}
@@ -0,0 +1,190 @@
+package ftdc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+)
+
+// KeyProvider supplies the AES keys that encrypt and decrypt chunks.
+// Keys must be 16, 24, or 32 bytes long, to use AES-128, AES-192, or
+// AES-256.
+//
+// Encrypted chunks record the identifier of their key, but not the
+// key itself, so providers may rotate keys, as long as they can
+// return the keys of existing chunks.
+type KeyProvider interface {
+	// EncryptionKey returns the key that encrypts new chunks,
+	// and its identifier.
+	EncryptionKey() (id string, key []byte, err error)
+
+	// DecryptionKey returns the key with the identifier.
+	DecryptionKey(id string) ([]byte, error)
+}
+
+type staticKeyProvider struct {
+	id  string
+	key []byte
+}
+
+// NewStaticKeyProvider returns a KeyProvider that always uses the
+// same key.
+func NewStaticKeyProvider(id string, key []byte) KeyProvider {
+	return &staticKeyProvider{id: id, key: key}
+}
+
+func (p *staticKeyProvider) EncryptionKey() (string, []byte, error) { return p.id, p.key, nil }
+
+func (p *staticKeyProvider) DecryptionKey(id string) ([]byte, error) {
+	if id != p.id {
+		return nil, errors.Errorf("unknown encryption key '%s'", id)
+	}
+	return p.key, nil
+}
+
+// NewEncryptedCollector provides a collector that is equivalent to the
+// basic collector, except that it encrypts the payload of each chunk,
+// and the metadata document, with AES-GCM, using the encryption key of
+// the provider and a random nonce, which is stored in the chunk
+// document. The _id of the chunk is authenticated with the payload.
+//
+// Encrypted chunks are not readable by other FTDC implementations. To
+// read them, pass the key provider to ReadChunksWithOptions; other
+// readers return an error for encrypted chunks.
+func NewEncryptedCollector(maxSize int, keys KeyProvider) Collector {
+	return &betterCollector{
+		maxDeltas: maxSize,
+		keys:      keys,
+	}
+}
+
+// NewStreamingEncryptedCollector provides a streaming collector (see
+// NewStreamingCollector) that encrypts chunks, as with
+// NewEncryptedCollector.
+func NewStreamingEncryptedCollector(maxSamples int, keys KeyProvider, writer io.Writer) Collector {
+	c := newStreamingCollector(maxSamples, writer)
+	c.Collector.(*betterCollector).keys = keys
+	return c
+}
+
+// encryptionField is the sub-document of encrypted chunk and metadata
+// documents that holds the identifier of the key and the nonce.
+const encryptionField = "encryption"
+
+func newChunkCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem building cipher")
+	}
+	gcm, err := cipher.NewGCM(block)
+	return gcm, errors.Wrap(err, "problem building cipher")
+}
+
+// encryptionData is the additional authenticated data of a sealed
+// payload, which binds the payload to the document's _id.
+func encryptionData(id time.Time) []byte {
+	out := make([]byte, 8)
+	binary.LittleEndian.PutUint64(out, uint64(epochMs(id)))
+	return out
+}
+
+// sealPayload encrypts the payload, and returns the encrypted payload
+// and the encryption document to store with it.
+func sealPayload(keys KeyProvider, id time.Time, payload []byte) ([]byte, *bsonx.Document, error) {
+	keyID, key, err := keys.EncryptionKey()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "problem getting encryption key")
+	}
+	gcm, err := newChunkCipher(key)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, errors.Wrap(err, "problem generating nonce")
+	}
+
+	return gcm.Seal(nil, nonce, payload, encryptionData(id)),
+		bsonx.NewDocument(bsonx.EC.String("key", keyID), bsonx.EC.Binary("nonce", nonce)),
+		nil
+}
+
+// openPayload decrypts the payload of a document that sealPayload
+// encrypted.
+func openPayload(keys KeyProvider, doc *bsonx.Document, payload []byte) ([]byte, error) {
+	if keys == nil {
+		return nil, errors.New("data is encrypted, but no key provider was specified")
+	}
+
+	header, ok := doc.Lookup(encryptionField).MutableDocumentOK()
+	if !ok {
+		return nil, errors.New("encryption field is not a document")
+	}
+	keyID, ok := header.Lookup("key").StringValueOK()
+	if !ok {
+		return nil, errors.New("encryption key is not a string")
+	}
+	_, nonce, ok := header.Lookup("nonce").BinaryOK()
+	if !ok {
+		return nil, errors.New("encryption nonce is not binary")
+	}
+
+	key, err := keys.DecryptionKey(keyID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem getting decryption key '%s'", keyID)
+	}
+	gcm, err := newChunkCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.Errorf("encryption nonce has %d bytes, expected %d", len(nonce), gcm.NonceSize())
+	}
+
+	id, _ := doc.Lookup("_id").TimeOK()
+	out, err := gcm.Open(nil, nonce, payload, encryptionData(id))
+	return out, errors.Wrap(err, "problem decrypting data")
+}
+
+// decryptDocument returns the document with its payload decrypted, if
+// it is an encrypted chunk or metadata document, and otherwise
+// returns the document unmodified.
+func decryptDocument(doc *bsonx.Document, keys KeyProvider) (*bsonx.Document, error) {
+	if doc.LookupElement(encryptionField) == nil {
+		return doc, nil
+	}
+
+	_, data, ok := doc.Lookup("data").BinaryOK()
+	if !ok {
+		return nil, errors.New("encrypted data is not binary")
+	}
+	payload, err := openPayload(keys, doc, data)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out := doc.Clone()
+	out.Delete(encryptionField)
+
+	// metadata documents store the encrypted metadata document
+	// in the data field, rather than in the doc field.
+	if isNum(0, doc.Lookup("type")) {
+		metadata, err := bsonx.ReadDocument(payload)
+		if err != nil {
+			return nil, errors.Wrap(err, "problem reading decrypted metadata")
+		}
+		out.Delete("data")
+		out.Append(bsonx.EC.SubDocument("doc", metadata))
+		return out, nil
+	}
+
+	out.Set(bsonx.EC.Binary("data", payload))
+	return out, nil
+}
@@ -0,0 +1,253 @@
+package ftdc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+)
+
+// Chunk Envelopes
+//
+// The documents in FTDC data (i.e. format v1) are not preceded by any
+// header, so FTDC files are impossible to identify, or validate,
+// without decoding them. Collectors that write format v2 (see
+// NewEnvelopeCollector) precede each document with an envelope
+// header, which identifies the data, and describes the chunk that
+// follows it without decoding it:
+//
+//	magic    [8]byte  "\x89FTDC\r\n\x1a"
+//	version  uint16   2
+//	codec    uint16   the compression codec of the payload
+//	samples  uint32   the number of samples in the chunk
+//	start    int64    the collection time of the first sample (ms since epoch)
+//	end      int64    the collection time of the last sample (ms since epoch)
+//	schema   uint64   the schema hash (see Chunk.SchemaHash)
+//	size     uint32   the size of the document that follows
+//	checksum uint32   CRC32 (Castagnoli) of the preceding fields
+//	                  of the header and of the document
+//
+// with integers in little endian order. The headers of metadata
+// documents have no samples, no schema, and the time of the chunk
+// for both the start and end times.
+//
+// Readers in this package negotiate the format of each document: they
+// accept data in either format, or a mix of both (e.g. files that
+// were appended to by different collectors). Readers that read data
+// sequentially (e.g. ReadChunks) verify the envelopes that they read,
+// while the seekable and indexed iterators skip them.
+
+const (
+	envelopeVersion    = 2
+	envelopeHeaderSize = 48
+)
+
+var envelopeMagic = []byte("\x89FTDC\r\n\x1a")
+
+// NewEnvelopeCollector provides a collector that is equivalent to the
+// basic collector, except that it writes data in format v2, in which
+// each document is preceded by an envelope header.
+func NewEnvelopeCollector(maxSize int) Collector {
+	return &betterCollector{
+		maxDeltas: maxSize,
+		envelope:  true,
+	}
+}
+
+// NewStreamingEnvelopeCollector provides a streaming collector (see
+// NewStreamingCollector) that writes data in format v2, in which each
+// document is preceded by an envelope header.
+func NewStreamingEnvelopeCollector(maxSamples int, writer io.Writer) Collector {
+	c := newStreamingCollector(maxSamples, writer)
+	c.Collector.(*betterCollector).envelope = true
+	return c
+}
+
+// ChunkEnvelope describes a document in FTDC data in format v2, as read
+// from its envelope header by ParseChunkEnvelope.
+type ChunkEnvelope struct {
+	Version uint16
+	Codec   Compression
+	// Samples is the number of samples in the chunk, and is zero
+	// for metadata documents.
+	Samples int
+	Start   time.Time
+	End     time.Time
+	// SchemaHash is the schema hash of the chunk, in the format of
+	// Chunk.SchemaHash, and is empty for metadata documents.
+	SchemaHash string
+	// Size is the size of the document that follows the header.
+	Size     int
+	Checksum uint32
+}
+
+// HasChunkEnvelope reports whether the data begins with the magic bytes
+// of an envelope header, i.e. whether it is FTDC data in format v2.
+func HasChunkEnvelope(data []byte) bool { return bytes.HasPrefix(data, envelopeMagic) }
+
+// ParseChunkEnvelope reads an envelope header from the beginning of the
+// data. Returns an error if the data is not an envelope header, or if
+// the header has an unsupported version or codec. The checksum of the
+// header is verified when the document that follows it is read.
+func ParseChunkEnvelope(data []byte) (*ChunkEnvelope, error) {
+	if !HasChunkEnvelope(data) {
+		return nil, errors.New("data does not begin with a chunk envelope")
+	}
+	if len(data) < envelopeHeaderSize {
+		return nil, errors.Errorf("chunk envelope of %d bytes is truncated", len(data))
+	}
+
+	version := binary.LittleEndian.Uint16(data[8:])
+	if version != envelopeVersion {
+		return nil, errors.Errorf("unsupported chunk envelope version %d", version)
+	}
+	codec := binary.LittleEndian.Uint16(data[10:])
+	if codec > 0xff || Compression(codec).Validate() != nil {
+		return nil, errors.Errorf("unsupported compression codec %d", codec)
+	}
+
+	out := &ChunkEnvelope{
+		Version:  version,
+		Codec:    Compression(codec),
+		Samples:  int(binary.LittleEndian.Uint32(data[12:])),
+		Start:    timeEpocMs(int64(binary.LittleEndian.Uint64(data[16:]))),
+		End:      timeEpocMs(int64(binary.LittleEndian.Uint64(data[24:]))),
+		Size:     int(binary.LittleEndian.Uint32(data[40:])),
+		Checksum: binary.LittleEndian.Uint32(data[44:]),
+	}
+	if schema := binary.LittleEndian.Uint64(data[32:]); schema != 0 || out.Samples != 0 {
+		out.SchemaHash = fmt.Sprintf("%016x", schema)
+	}
+	if out.Size < bsonx.MinDocumentSize {
+		return nil, errors.Errorf("invalid document size %d in chunk envelope", out.Size)
+	}
+
+	return out, nil
+}
+
+// verify returns an error if the document does not match the envelope
+// header, including a ChecksumError if the checksum of the header
+// and the document does not match the checksum in the header.
+func (e *ChunkEnvelope) verify(header, doc []byte) error {
+	if len(doc) != e.Size {
+		return errors.Errorf("document of %d bytes does not match chunk envelope of %d bytes", len(doc), e.Size)
+	}
+
+	actual := crc32.Update(crc32.Checksum(header[:envelopeHeaderSize-4], castagnoli), castagnoli, doc)
+	if actual != e.Checksum {
+		return &ChecksumError{ID: e.Start, Expected: e.Checksum, Actual: actual}
+	}
+
+	return nil
+}
+
+// envelopeHeader returns the envelope header for the document.
+func envelopeHeader(doc []byte, codec Compression, samples int, start, end time.Time, schema string) ([]byte, error) {
+	header := make([]byte, envelopeHeaderSize)
+	copy(header, envelopeMagic)
+	binary.LittleEndian.PutUint16(header[8:], envelopeVersion)
+	binary.LittleEndian.PutUint16(header[10:], uint16(codec))
+	binary.LittleEndian.PutUint32(header[12:], uint32(samples))
+	binary.LittleEndian.PutUint64(header[16:], uint64(epochMs(start)))
+	binary.LittleEndian.PutUint64(header[24:], uint64(epochMs(end)))
+	if schema != "" {
+		hash, err := strconv.ParseUint(schema, 16, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid schema hash '%s'", schema)
+		}
+		binary.LittleEndian.PutUint64(header[32:], hash)
+	}
+	binary.LittleEndian.PutUint32(header[40:], uint32(len(doc)))
+
+	checksum := crc32.Update(crc32.Checksum(header[:envelopeHeaderSize-4], castagnoli), castagnoli, doc)
+	binary.LittleEndian.PutUint32(header[44:], checksum)
+
+	return header, nil
+}
+
+// writeEnveloped writes the document to the buffer, preceded by its
+// envelope header.
+func writeEnveloped(buf *bytes.Buffer, doc *bsonx.Document, codec Compression, samples int, start, end time.Time, schema string) error {
+	data, err := doc.MarshalBSON()
+	if err != nil {
+		return errors.Wrap(err, "problem marshaling document")
+	}
+
+	header, err := envelopeHeader(data, codec, samples, start, end, schema)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, _ = buf.Write(header)
+	_, _ = buf.Write(data)
+	return nil
+}
+
+// readBufEnvelope reads the envelope header, if there is one, at the
+// current position of the reader, and returns the envelope and the
+// document that follows it, which it verifies against the envelope.
+// Returns nil values if the reader is not positioned at an envelope
+// header.
+func readBufEnvelope(buf *bufio.Reader) (*ChunkEnvelope, []byte, error) {
+	prefix, _ := buf.Peek(len(envelopeMagic))
+	if !HasChunkEnvelope(prefix) {
+		return nil, nil, nil
+	}
+
+	header := make([]byte, envelopeHeaderSize)
+	if _, err := io.ReadFull(buf, header); err != nil {
+		return nil, nil, errors.Wrap(unexpectedEOF(err), "problem reading chunk envelope")
+	}
+	envelope, err := ParseChunkEnvelope(header)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	doc := make([]byte, envelope.Size)
+	if _, err = io.ReadFull(buf, doc); err != nil {
+		return nil, nil, errors.Wrap(unexpectedEOF(err), "problem reading enveloped document")
+	}
+	if err = envelope.verify(header, doc); err != nil {
+		return nil, nil, err
+	}
+
+	return envelope, doc, nil
+}
+
+// readEnvelopedDocument parses the document that follows an envelope
+// header, and ensures that its codec matches the envelope.
+func readEnvelopedDocument(envelope *ChunkEnvelope, data []byte) (*bsonx.Document, error) {
+	doc, err := bsonx.ReadDocument(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem reading enveloped document")
+	}
+
+	if isNum(1, doc.Lookup("type")) {
+		codec, err := readCompression(doc)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if codec != envelope.Codec {
+			return nil, errors.Errorf("chunk compressed with %s does not match its envelope (%s)", codec, envelope.Codec)
+		}
+	}
+
+	return doc, nil
+}
+
+// unexpectedEOF converts the end of the data within an envelope, or
+// its document, to io.ErrUnexpectedEOF, so that readers do not treat
+// truncated data as the end of the data.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
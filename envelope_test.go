@@ -0,0 +1,210 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkEnvelope(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	capture := func(t *testing.T, collector Collector, buf *bytes.Buffer, first, samples int) {
+		for i := first; i < first+samples; i++ {
+			require.NoError(t, collector.Add(bsonx.NewDocument(
+				bsonx.EC.Time("ts", start.Add(time.Duration(i)*time.Second)),
+				bsonx.EC.Int64("counter", int64(i*i)),
+				bsonx.EC.SubDocument("mem", bsonx.NewDocument(bsonx.EC.Int32("resident", int32(i)))),
+			)))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+	}
+	readAll := func(t *testing.T, iter *ChunkIterator) []*Chunk {
+		defer iter.Close()
+		chunks := []*Chunk{}
+		for iter.Next() {
+			chunks = append(chunks, iter.Chunk())
+		}
+		require.NoError(t, iter.Err())
+		return chunks
+	}
+	metadata := bsonx.NewDocument(bsonx.EC.String("host", "example"))
+
+	v1 := &bytes.Buffer{}
+	collector := NewStreamingCollector(10, v1)
+	require.NoError(t, collector.SetMetadata(metadata))
+	capture(t, collector, v1, 0, 25)
+
+	// envelope times have millisecond precision.
+	collected := time.Now().Truncate(time.Millisecond)
+	v2 := &bytes.Buffer{}
+	collector = NewStreamingEnvelopeCollector(10, v2)
+	require.NoError(t, collector.SetMetadata(metadata))
+	capture(t, collector, v2, 0, 25)
+	data := v2.Bytes()
+	finished := time.Now()
+
+	t.Run("Header", func(t *testing.T) {
+		require.True(t, HasChunkEnvelope(data))
+		assert.False(t, HasChunkEnvelope(v1.Bytes()))
+
+		// the metadata document has an envelope with no samples.
+		envelope, err := ParseChunkEnvelope(data)
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, envelope.Version)
+		assert.Zero(t, envelope.Samples)
+		assert.Empty(t, envelope.SchemaHash)
+		assert.False(t, envelope.Start.Before(collected))
+		assert.False(t, envelope.Start.After(finished))
+		first := envelope.Start
+
+		// followed by the first chunk, which is described by
+		// its envelope.
+		offset := envelopeHeaderSize + envelope.Size
+		envelope, err = ParseChunkEnvelope(data[offset:])
+		require.NoError(t, err)
+		assert.Equal(t, CompressionZlib, envelope.Codec)
+		assert.Equal(t, 10, envelope.Samples)
+		assert.True(t, first.Equal(envelope.Start))
+		assert.False(t, envelope.End.Before(envelope.Start))
+		assert.False(t, envelope.End.After(finished))
+
+		chunks := readAll(t, ReadChunks(ctx, bytes.NewReader(data)))
+		require.Len(t, chunks, 3)
+		assert.Equal(t, chunks[0].SchemaHash(), envelope.SchemaHash)
+	})
+	t.Run("RoundTrip", func(t *testing.T) {
+		expected := readAll(t, ReadChunks(ctx, bytes.NewReader(v1.Bytes())))
+		for name, iter := range map[string]func() *ChunkIterator{
+			"ReadChunks": func() *ChunkIterator { return ReadChunks(ctx, bytes.NewReader(data)) },
+			"Seekable": func() *ChunkIterator {
+				iter, err := NewSeekableChunkIterator(ctx, bytes.NewReader(data), int64(len(data)))
+				require.NoError(t, err)
+				return iter
+			},
+			"Indexed": func() *ChunkIterator {
+				index := &bytes.Buffer{}
+				require.NoError(t, BuildIndex(ctx, bytes.NewReader(data), index))
+				iter, err := NewIndexedIterator(ctx, bytes.NewReader(data), int64(len(data)), index, time.Time{}, time.Time{})
+				require.NoError(t, err)
+				return iter
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				chunks := readAll(t, iter())
+				require.Len(t, chunks, len(expected))
+				for idx, chunk := range chunks {
+					require.Len(t, chunk.Metrics, len(expected[idx].Metrics))
+					for m := range chunk.Metrics {
+						assert.Equal(t, expected[idx].Metrics[m].Key(), chunk.Metrics[m].Key())
+						assert.Equal(t, expected[idx].Metrics[m].Values, chunk.Metrics[m].Values)
+					}
+					assert.True(t, chunk.userMetadata().Equal(expected[idx].userMetadata()))
+				}
+			})
+		}
+	})
+	t.Run("Mixed", func(t *testing.T) {
+		// files may hold documents in both formats, e.g. when
+		// they are appended to by different collectors.
+		mixed := &bytes.Buffer{}
+		capture(t, NewStreamingEnvelopeCollector(10, mixed), mixed, 0, 10)
+		capture(t, NewStreamingCollector(10, mixed), mixed, 10, 10)
+		capture(t, NewStreamingEnvelopeCollector(10, mixed), mixed, 20, 5)
+
+		chunks := readAll(t, ReadChunks(ctx, bytes.NewReader(mixed.Bytes())))
+		require.Len(t, chunks, 3)
+		assert.Equal(t, int64(400), chunks[2].Metrics[1].Values[0])
+	})
+	t.Run("Codec", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		collector := NewStreamingEnvelopeCollector(10, buf)
+		collector.(*streamingCollector).Collector.(*betterCollector).compression = CompressionSnappy
+		capture(t, collector, buf, 0, 10)
+
+		envelope, err := ParseChunkEnvelope(buf.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, CompressionSnappy, envelope.Codec)
+		assert.Len(t, readAll(t, ReadChunks(ctx, bytes.NewReader(buf.Bytes()))), 1)
+	})
+	t.Run("Corrupt", func(t *testing.T) {
+		read := func(data []byte) error {
+			iter := ReadChunks(ctx, bytes.NewReader(data))
+			defer iter.Close()
+			for iter.Next() {
+			}
+			return iter.Err()
+		}
+
+		// a change to the document fails the checksum.
+		corrupt := append([]byte{}, data...)
+		corrupt[len(corrupt)-10] ^= 0xff
+		err := read(corrupt)
+		require.Error(t, err)
+		_, ok := errors.Cause(err).(*ChecksumError)
+		assert.True(t, ok, "%+v", err)
+
+		// as does a change to the header.
+		corrupt = append([]byte{}, data...)
+		corrupt[20] ^= 0xff
+		assert.Error(t, read(corrupt))
+
+		// unsupported versions and truncated data are errors.
+		corrupt = append([]byte{}, data...)
+		binary.LittleEndian.PutUint16(corrupt[8:], 3)
+		assert.Error(t, read(corrupt))
+		assert.Error(t, read(data[:len(data)-1]))
+		assert.Error(t, read(data[:20]))
+
+		_, err = ParseChunkEnvelope(data[:20])
+		assert.Error(t, err)
+		_, err = ParseChunkEnvelope(v1.Bytes())
+		assert.Error(t, err)
+	})
+	t.Run("Tail", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "ftdc-envelope")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "metrics")
+		offset := envelopeHeaderSize + 10
+		require.NoError(t, ioutil.WriteFile(path, data[:offset], 0644))
+
+		iter, err := NewTailingChunkIterator(ctx, path, time.Millisecond)
+		require.NoError(t, err)
+		defer iter.Close()
+
+		// the rest of the data is written after the iterator
+		// has seen a partial document.
+		time.Sleep(10 * time.Millisecond)
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		_, err = f.Write(data[offset:])
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		for i := 0; i < 3; i++ {
+			next := make(chan bool)
+			go func() { next <- iter.Next() }()
+			select {
+			case ok := <-next:
+				require.True(t, ok)
+			case <-time.After(time.Second):
+				require.FailNow(t, "timed out waiting for chunk")
+			}
+			assert.Equal(t, int64(100*i*i), iter.Chunk().Metrics[1].Values[0])
+		}
+	})
+}
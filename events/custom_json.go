@@ -0,0 +1,277 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/ftdc"
+	"github.com/pkg/errors"
+)
+
+// JSON Custom Collector
+//
+// The JSON custom collector accepts arbitrary JSON objects, rather
+// than Custom values, for producers (e.g. plugins) that report their
+// statistics as JSON. Each object is flattened to dotted keys (e.g.
+// {"cache": {"hits": 1}} becomes "cache.hits", and the elements of
+// arrays become "key.0", "key.1", ...), and the collector infers the
+// type of each key from the values that it has seen:
+//
+//   - integers are stored as int64,
+//   - numbers with a fraction or exponent, and integers that do not
+//     fit in an int64, are stored as float64,
+//   - booleans are stored as bools.
+//
+// An integer key is promoted to a float key the first time that a
+// float value is added for it, and afterwards integer values for the
+// key are stored as floats. No other type changes are allowed, and
+// values of other types (e.g. strings) are not supported, as FTDC
+// only stores numeric metrics: in these cases, Add returns a
+// *JSONTypeError and the object is not added.
+//
+// The schema of the collector holds every key it has seen, so that
+// the documents passed to the underlying collector have the same
+// metrics, and keys missing from an object, or with null values, are
+// added with the zero value of their type. The schema persists across
+// calls to Reset.
+
+// JSONKind is the type of a key in the schema of a JSON custom
+// collector.
+type JSONKind int
+
+// The kinds of keys that the JSON custom collector stores.
+const (
+	JSONKindUnknown JSONKind = iota
+	JSONKindBool
+	JSONKindInt
+	JSONKindFloat
+)
+
+func (k JSONKind) String() string {
+	switch k {
+	case JSONKindBool:
+		return "bool"
+	case JSONKindInt:
+		return "int"
+	case JSONKindFloat:
+		return "float"
+	default:
+		return "unknown"
+	}
+}
+
+// JSONTypeError is returned by the JSON custom collector for values
+// that are not supported, or that are not compatible with the type of
+// the key in the schema of the collector.
+type JSONTypeError struct {
+	// Key is the flattened key of the value.
+	Key string
+	// Schema is the type of the key in the schema, or
+	// JSONKindUnknown if the key is not in the schema.
+	Schema JSONKind
+	// Value is the decoded JSON value.
+	Value interface{}
+}
+
+func (e *JSONTypeError) Error() string {
+	kind := jsonKindOf(e.Value)
+	if kind == JSONKindUnknown {
+		return fmt.Sprintf("value of type '%T' for key '%s' is not supported", e.Value, e.Key)
+	}
+
+	return fmt.Sprintf("%s value for key '%s' is not compatible with the %s type of the key", kind, e.Key, e.Schema)
+}
+
+type jsonCustomCollector struct {
+	schema map[string]JSONKind
+	keys   []string
+	ftdc.Collector
+}
+
+// NewJSONCustomCollector wraps a collector so that its Add method
+// accepts JSON objects, as []byte, json.RawMessage, or string values,
+// or objects decoded into a map[string]interface{}, and passes them
+// to the underlying collector as Custom values with an inferred
+// schema.
+//
+// As with most collectors, the JSON custom collector is not safe for
+// concurrent use.
+func NewJSONCustomCollector(collector ftdc.Collector) ftdc.Collector {
+	return &jsonCustomCollector{
+		schema:    map[string]JSONKind{},
+		Collector: collector,
+	}
+}
+
+func (c *jsonCustomCollector) Add(in interface{}) error {
+	var (
+		obj map[string]interface{}
+		err error
+	)
+
+	switch v := in.(type) {
+	case []byte:
+		obj, err = decodeJSONObject(v)
+	case json.RawMessage:
+		obj, err = decodeJSONObject(v)
+	case string:
+		obj, err = decodeJSONObject([]byte(v))
+	case map[string]interface{}:
+		obj = v
+	default:
+		return errors.Errorf("type '%T' is not a JSON object", in)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	values := map[string]interface{}{}
+	if err = flattenJSON("", obj, values); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// validate the entire object before updating the schema, so that
+	// rejected objects do not change it.
+	kinds := make(map[string]JSONKind, len(values))
+	for key, value := range values {
+		kind := jsonKindOf(value)
+		if kind == JSONKindUnknown {
+			return &JSONTypeError{Key: key, Schema: c.schema[key], Value: value}
+		}
+		if !jsonKindCompatible(c.schema[key], kind) {
+			return &JSONTypeError{Key: key, Schema: c.schema[key], Value: value}
+		}
+		kinds[key] = kind
+	}
+
+	for key, kind := range kinds {
+		switch current, ok := c.schema[key]; {
+		case !ok:
+			c.schema[key] = kind
+			c.keys = append(c.keys, key)
+		case current == JSONKindInt && kind == JSONKindFloat:
+			c.schema[key] = JSONKindFloat
+		}
+	}
+	sort.Strings(c.keys)
+
+	doc := MakeCustom(len(c.keys))
+	for _, key := range c.keys {
+		doc = append(doc, CustomPoint{Name: key, Value: jsonValue(c.schema[key], values[key])})
+	}
+
+	return errors.WithStack(c.Collector.Add(doc))
+}
+
+func decodeJSONObject(data []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	obj := map[string]interface{}{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, errors.Wrap(err, "problem decoding JSON object")
+	}
+	if dec.More() {
+		return nil, errors.New("JSON input holds more than one value")
+	}
+
+	return obj, nil
+}
+
+// flattenJSON adds the values of the object to out, by their
+// flattened keys, converting numbers to int64 or float64 values. Null
+// values are omitted.
+func flattenJSON(prefix string, obj map[string]interface{}, out map[string]interface{}) error {
+	for key, value := range obj {
+		if strings.Contains(key, ".") {
+			return errors.Errorf("key '%s%s' contains a '.'", prefix, key)
+		}
+		if err := flattenJSONValue(prefix+key, value, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func flattenJSONValue(key string, value interface{}, out map[string]interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		return flattenJSON(key+".", v, out)
+	case []interface{}:
+		for idx := range v {
+			if err := flattenJSONValue(key+"."+strconv.Itoa(idx), v[idx], out); err != nil {
+				return err
+			}
+		}
+		return nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			out[key] = n
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return errors.Wrapf(err, "problem parsing number for key '%s'", key)
+		}
+		out[key] = f
+	case int:
+		out[key] = int64(v)
+	case int32:
+		out[key] = int64(v)
+	case float32:
+		out[key] = float64(v)
+	default:
+		out[key] = v
+	}
+	return nil
+}
+
+func jsonKindOf(value interface{}) JSONKind {
+	switch value.(type) {
+	case bool:
+		return JSONKindBool
+	case int64:
+		return JSONKindInt
+	case float64:
+		return JSONKindFloat
+	default:
+		return JSONKindUnknown
+	}
+}
+
+// jsonKindCompatible returns true if a value of the kind may be added
+// for a key of the schema kind, which is JSONKindUnknown for new keys.
+func jsonKindCompatible(schema, kind JSONKind) bool {
+	if schema == JSONKindUnknown || schema == kind {
+		return true
+	}
+	return schema != JSONKindBool && kind != JSONKindBool
+}
+
+// jsonValue returns the value, converted to the kind of its key, or
+// the zero value of the kind for missing values.
+func jsonValue(kind JSONKind, value interface{}) interface{} {
+	switch kind {
+	case JSONKindBool:
+		v, _ := value.(bool)
+		return v
+	case JSONKindInt:
+		v, _ := value.(int64)
+		return v
+	default:
+		switch v := value.(type) {
+		case int64:
+			return float64(v)
+		case float64:
+			return v
+		default:
+			return float64(0)
+		}
+	}
+}
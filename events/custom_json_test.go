@@ -0,0 +1,131 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mongodb/ftdc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONCustomCollector(t *testing.T) {
+	t.Run("Flattens", func(t *testing.T) {
+		mock := &MockCollector{}
+		c := NewJSONCustomCollector(mock)
+
+		require.NoError(t, c.Add([]byte(`{"ops": 10, "cache": {"hits": 4, "ratio": 0.5}, "up": true, "lat": [1, 2], "none": null}`)))
+		require.Len(t, mock.Data, 1)
+
+		doc, ok := mock.Data[0].(Custom)
+		require.True(t, ok)
+		assert.Equal(t, Custom{
+			{Name: "cache.hits", Value: int64(4)},
+			{Name: "cache.ratio", Value: 0.5},
+			{Name: "lat.0", Value: int64(1)},
+			{Name: "lat.1", Value: int64(2)},
+			{Name: "ops", Value: int64(10)},
+			{Name: "up", Value: true},
+		}, doc)
+	})
+	t.Run("Inputs", func(t *testing.T) {
+		mock := &MockCollector{}
+		c := NewJSONCustomCollector(mock)
+
+		assert.NoError(t, c.Add(`{"a": 1}`))
+		assert.NoError(t, c.Add(json.RawMessage(`{"a": 2}`)))
+		assert.NoError(t, c.Add(map[string]interface{}{"a": 3}))
+		assert.Len(t, mock.Data, 3)
+
+		assert.Error(t, c.Add(42))
+		assert.Error(t, c.Add(`[1, 2]`))
+		assert.Error(t, c.Add(`{"a": 1} {"a": 2}`))
+		assert.Error(t, c.Add(`{"a.b": 1}`))
+		assert.Len(t, mock.Data, 3)
+	})
+	t.Run("PromotesIntegers", func(t *testing.T) {
+		mock := &MockCollector{}
+		c := NewJSONCustomCollector(mock)
+
+		require.NoError(t, c.Add(`{"a": 1}`))
+		require.NoError(t, c.Add(`{"a": 1.5}`))
+		require.NoError(t, c.Add(`{"a": 2}`))
+		require.NoError(t, c.Add(`{"a": 18446744073709551615}`))
+		require.Len(t, mock.Data, 4)
+
+		assert.Equal(t, int64(1), mock.Data[0].(Custom)[0].Value)
+		assert.Equal(t, 1.5, mock.Data[1].(Custom)[0].Value)
+		assert.Equal(t, 2.0, mock.Data[2].(Custom)[0].Value)
+		assert.Equal(t, 18446744073709551615.0, mock.Data[3].(Custom)[0].Value)
+	})
+	t.Run("FillsMissingKeys", func(t *testing.T) {
+		mock := &MockCollector{}
+		c := NewJSONCustomCollector(mock)
+
+		require.NoError(t, c.Add(`{"a": 1, "b": true, "c": 0.5}`))
+		require.NoError(t, c.Add(`{"d": 4, "c": null}`))
+		require.Len(t, mock.Data, 2)
+
+		assert.Equal(t, Custom{
+			{Name: "a", Value: int64(0)},
+			{Name: "b", Value: false},
+			{Name: "c", Value: 0.0},
+			{Name: "d", Value: int64(4)},
+		}, mock.Data[1])
+	})
+	t.Run("RejectsIncompatibleValues", func(t *testing.T) {
+		mock := &MockCollector{}
+		c := NewJSONCustomCollector(mock)
+		require.NoError(t, c.Add(`{"a": 1, "b": true}`))
+
+		for _, test := range []struct {
+			input  string
+			key    string
+			schema JSONKind
+		}{
+			{input: `{"a": true}`, key: "a", schema: JSONKindInt},
+			{input: `{"b": 1}`, key: "b", schema: JSONKindBool},
+			{input: `{"b": 1.5}`, key: "b", schema: JSONKindBool},
+			{input: `{"a": 1, "c": {"d": "name"}}`, key: "c.d", schema: JSONKindUnknown},
+		} {
+			err := c.Add(test.input)
+			require.Error(t, err, test.input)
+
+			typeErr, ok := err.(*JSONTypeError)
+			require.True(t, ok, test.input)
+			assert.Equal(t, test.key, typeErr.Key)
+			assert.Equal(t, test.schema, typeErr.Schema)
+		}
+
+		// rejected objects do not change the schema.
+		require.NoError(t, c.Add(`{"a": 2}`))
+		require.Len(t, mock.Data, 2)
+		assert.Equal(t, Custom{
+			{Name: "a", Value: int64(2)},
+			{Name: "b", Value: false},
+		}, mock.Data[1])
+	})
+	t.Run("RoundTrip", func(t *testing.T) {
+		c := NewJSONCustomCollector(ftdc.NewBaseCollector(100))
+		for i := 0; i < 10; i++ {
+			require.NoError(t, c.Add(map[string]interface{}{"count": i, "nested": map[string]interface{}{"ok": i%2 == 0}}))
+		}
+
+		data, err := c.Resolve()
+		require.NoError(t, err)
+
+		iter := ftdc.ReadChunks(context.Background(), bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		chunk := iter.Chunk()
+		assert.Equal(t, 10, chunk.Size())
+		require.Len(t, chunk.Metrics, 2)
+		assert.Equal(t, "count", chunk.Metrics[0].Key())
+		assert.Equal(t, "nested.ok", chunk.Metrics[1].Key())
+		assert.EqualValues(t, 9, chunk.Metrics[0].Values[9])
+		assert.False(t, iter.Next())
+		assert.NoError(t, iter.Err())
+	})
+}
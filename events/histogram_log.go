@@ -0,0 +1,145 @@
+package events
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/hdrhist"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DumpHDRLogs writes the histograms in a sequence of PerformanceHDR
+// points to the writer in the HdrHistogram interval log format
+// (version 1.3), so that tools that read histogram logs, like
+// HistogramLogProcessor and hdr-plot, can process latency data that
+// was recorded in FTDC.
+//
+// The iterator must return structured documents, as from
+// ftdc.ReadStructuredMetrics. Each histogram in a point is written as
+// a separate interval, tagged with its name (e.g. "timers.duration"),
+// that starts at the point's timestamp and ends at the next point's
+// timestamp. Interval maxima for timers are in milliseconds.
+func DumpHDRLogs(iter ftdc.Iterator, w io.Writer) error {
+	var (
+		prev     *PerformanceHDR
+		start    time.Time
+		interval time.Duration
+	)
+
+	for iter.Next() {
+		point, err := readHistogramPoint(iter)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if prev == nil {
+			start = point.Timestamp
+			if err = writeHDRLogHeader(w, start); err != nil {
+				return errors.WithStack(err)
+			}
+		} else {
+			interval = point.Timestamp.Sub(prev.Timestamp)
+			if err = writeHDRLogIntervals(w, start, interval, prev); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		prev = point
+	}
+
+	if err := iter.Err(); err != nil {
+		return errors.Wrap(err, "problem iterating histograms")
+	}
+
+	// the last point has no successor, so assume that it's as
+	// long as the interval before it.
+	if prev != nil {
+		return errors.WithStack(writeHDRLogIntervals(w, start, interval, prev))
+	}
+
+	return nil
+}
+
+func readHistogramPoint(iter ftdc.Iterator) (*PerformanceHDR, error) {
+	data, err := iter.Document().MarshalBSON()
+	if err != nil {
+		return nil, errors.Wrap(err, "problem marshaling document")
+	}
+
+	point := &PerformanceHDR{}
+	if err = bson.Unmarshal(data, point); err != nil {
+		return nil, errors.Wrap(err, "problem reading histogram point")
+	}
+
+	for _, hist := range point.histograms() {
+		if hist.value != nil {
+			return point, nil
+		}
+	}
+
+	return nil, errors.New("document does not contain histograms, iterators must return structured documents")
+}
+
+type namedHistogram struct {
+	tag   string
+	ratio float64
+	value *hdrhist.Histogram
+}
+
+// histograms returns the histograms in the point in a fixed order,
+// with the tags and the ratio of their values to the units of the
+// interval maxima in histogram logs.
+func (p *PerformanceHDR) histograms() []namedHistogram {
+	ms := float64(time.Millisecond)
+
+	return []namedHistogram{
+		{tag: "counters.number", ratio: 1, value: p.Counters.Number},
+		{tag: "counters.operations", ratio: 1, value: p.Counters.Operations},
+		{tag: "counters.size", ratio: 1, value: p.Counters.Size},
+		{tag: "counters.errors", ratio: 1, value: p.Counters.Errors},
+		{tag: "timers.duration", ratio: ms, value: p.Timers.Duration},
+		{tag: "timers.total", ratio: ms, value: p.Timers.Total},
+	}
+}
+
+func writeHDRLogHeader(w io.Writer, start time.Time) error {
+	_, err := fmt.Fprintf(w, "#[Histogram log format version 1.3]\n#[StartTime: %.3f (seconds since epoch), %s]\n%s\n",
+		epochSeconds(start), start.UTC().Format(time.RFC1123),
+		`"StartTimestamp","Interval_Length","Interval_Max","Interval_Compressed_Histogram"`)
+
+	return errors.Wrap(err, "problem writing histogram log header")
+}
+
+func writeHDRLogIntervals(w io.Writer, start time.Time, interval time.Duration, point *PerformanceHDR) error {
+	offset := point.Timestamp.Sub(start).Seconds()
+
+	for _, hist := range point.histograms() {
+		if hist.value == nil {
+			continue
+		}
+
+		data, err := hist.value.EncodeCompressed()
+		if err != nil {
+			return errors.Wrapf(err, "problem encoding '%s' histogram", hist.tag)
+		}
+
+		var max int64
+		if hist.value.TotalCount() > 0 {
+			max = hist.value.Max()
+		}
+
+		if _, err = fmt.Fprintf(w, "Tag=%s,%.3f,%.3f,%.3f,%s\n", hist.tag, offset, interval.Seconds(),
+			float64(max)/hist.ratio, base64.StdEncoding.EncodeToString(data)); err != nil {
+			return errors.Wrap(err, "problem writing histogram log")
+		}
+	}
+
+	return nil
+}
+
+func epochSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
@@ -0,0 +1,111 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/hdrhist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpHDRLogs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the default histograms track values with five significant
+	// figures, which makes them too large to collect quickly in a
+	// test, so use small histograms.
+	newPoint := func(ts time.Time, dur time.Duration) *PerformanceHDR {
+		point := &PerformanceHDR{
+			Timestamp: ts,
+			Counters: PerformanceCountersHDR{
+				Number:     hdrhist.New(1, 1000, 2),
+				Operations: hdrhist.New(1, 1000, 2),
+				Size:       hdrhist.New(1, 1000, 2),
+				Errors:     hdrhist.New(1, 1000, 2),
+			},
+			Timers: PerformanceTimersHDR{
+				Duration: hdrhist.New(int64(time.Microsecond), int64(time.Minute), 2),
+				Total:    hdrhist.New(int64(time.Microsecond), int64(time.Minute), 2),
+			},
+		}
+		require.NoError(t, point.Counters.Number.RecordValue(1))
+		require.NoError(t, point.Timers.Duration.RecordValues(int64(dur), 10))
+		return point
+	}
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	collector := ftdc.NewBaseCollector(10)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, collector.Add(newPoint(base.Add(time.Duration(i)*time.Second), time.Duration(i+1)*time.Millisecond)))
+	}
+	data, err := collector.Resolve()
+	require.NoError(t, err)
+
+	t.Run("Structured", func(t *testing.T) {
+		iter := ftdc.ReadStructuredMetrics(ctx, bytes.NewReader(data))
+		defer iter.Close()
+
+		out := &bytes.Buffer{}
+		require.NoError(t, DumpHDRLogs(iter, out))
+
+		lines := []string{}
+		scanner := bufio.NewScanner(out)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		require.NoError(t, scanner.Err())
+		require.Len(t, lines, 3+3*6)
+
+		assert.Equal(t, "#[Histogram log format version 1.3]", lines[0])
+		assert.True(t, strings.HasPrefix(lines[1], "#[StartTime: 1527811200.000 (seconds since epoch)"), lines[1])
+		assert.Equal(t, `"StartTimestamp","Interval_Length","Interval_Max","Interval_Compressed_Histogram"`, lines[2])
+
+		for i := 0; i < 3; i++ {
+			for j, tag := range []string{"counters.number", "counters.operations", "counters.size", "counters.errors", "timers.duration", "timers.total"} {
+				fields := strings.Split(lines[3+i*6+j], ",")
+				require.Len(t, fields, 5)
+				assert.Equal(t, "Tag="+tag, fields[0])
+				assert.Equal(t, []string{"0.000", "1.000", "2.000"}[i], fields[1])
+				assert.Equal(t, "1.000", fields[2])
+
+				raw, err := base64.StdEncoding.DecodeString(fields[4])
+				require.NoError(t, err)
+				hist, err := hdrhist.DecodeCompressed(raw)
+				require.NoError(t, err)
+
+				switch tag {
+				case "counters.number":
+					assert.EqualValues(t, 1, hist.TotalCount())
+					assert.Equal(t, "1.000", fields[3])
+				case "timers.duration":
+					assert.EqualValues(t, 10, hist.TotalCount())
+					assert.InDelta(t, float64(i+1), hist.ValueAtQuantile(50)/int64(time.Millisecond), 0.1)
+					assert.True(t, strings.HasPrefix(fields[3], []string{"1.0", "2.0", "3.0"}[i]), fields[3])
+				default:
+					assert.Zero(t, hist.TotalCount())
+					assert.Equal(t, "0.000", fields[3])
+				}
+			}
+		}
+	})
+	t.Run("Empty", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, DumpHDRLogs(ftdc.ReadStructuredMetrics(ctx, bytes.NewReader(nil)), out))
+		assert.Zero(t, out.Len())
+	})
+	t.Run("Flattened", func(t *testing.T) {
+		iter := ftdc.ReadMetrics(ctx, bytes.NewReader(data))
+		defer iter.Close()
+
+		assert.Error(t, DumpHDRLogs(iter, &bytes.Buffer{}))
+	})
+}
@@ -11,9 +11,19 @@
 // in state or other information about the environment including the
 // number threads used in the test, or a failed Boolean when a test is
 // aware of its own failure.
+//
+// Workloads may also attach their own counters to events in the
+// Extras block, which holds named values alongside the fixed counters.
 package events
 
-import "time"
+import (
+	"sort"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
 
 // Performance represents a single raw event in a metrics collection
 // system for performance metric collection system.
@@ -25,6 +35,57 @@ type Performance struct {
 	Counters  PerformanceCounters `bson:"counters" json:"counters" yaml:"counters"`
 	Timers    PerformanceTimers   `bson:"timers" json:"timers" yaml:"timers"`
 	Gauges    PerformanceGauges   `bson:"gauges" json:"gauges" yaml:"gauges"`
+
+	// Extras holds workload specific counters, which are written,
+	// in the order of their names, to the "extras" document after
+	// the fixed metrics, and omitted when empty. Because the
+	// schema of an FTDC chunk is fixed, every event in a series
+	// should have the same set of extras.
+	Extras map[string]int64 `bson:"extras,omitempty" json:"extras,omitempty" yaml:"extras,omitempty"`
+}
+
+// performanceFields has the fields of Performance without its methods,
+// so that the bson package marshals the fields rather than calling the
+// methods of Performance again.
+type performanceFields Performance
+
+// MarshalBSON encodes the event, with the extras in the order of their
+// names, so that events with the same extras always have the same
+// schema.
+func (p Performance) MarshalBSON() ([]byte, error) {
+	extras := p.Extras
+	p.Extras = nil
+
+	data, err := bson.Marshal(performanceFields(p))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(extras) == 0 {
+		return data, nil
+	}
+
+	doc, err := bsonx.ReadDocument(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem reading event")
+	}
+
+	keys := make([]string, 0, len(extras))
+	for key := range extras {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	block := bsonx.DC.Make(len(keys))
+	for _, key := range keys {
+		block.Append(bsonx.EC.Int64(key, extras[key]))
+	}
+	doc.Append(bsonx.EC.SubDocument("extras", block))
+
+	return doc.MarshalBSON()
+}
+
+func (p *Performance) UnmarshalBSON(b []byte) error {
+	return bson.Unmarshal(b, (*performanceFields)(p))
 }
 
 // PerformanceCounters refer to the number of operations/events or total
@@ -0,0 +1,106 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPerformanceExtras(t *testing.T) {
+	newPoint := func(i int64, extras map[string]int64) Performance {
+		return Performance{
+			Timestamp: time.Date(2018, 6, 1, 12, 0, int(i), 0, time.UTC),
+			ID:        i,
+			Counters:  PerformanceCounters{Number: i, Operations: i * 2},
+			Extras:    extras,
+		}
+	}
+	keys := func(t *testing.T, data []byte) []string {
+		doc, err := bsonx.ReadDocument(data)
+		require.NoError(t, err)
+		out := []string{}
+		iter := doc.Iterator()
+		for iter.Next() {
+			out = append(out, iter.Element().Key())
+		}
+		require.NoError(t, iter.Err())
+		return out
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		data, err := newPoint(1, nil).MarshalBSON()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ts", "id", "counters", "timers", "gauges"}, keys(t, data))
+
+		data, err = newPoint(1, map[string]int64{}).MarshalBSON()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ts", "id", "counters", "timers", "gauges"}, keys(t, data))
+	})
+	t.Run("Ordering", func(t *testing.T) {
+		extras := map[string]int64{}
+		for _, key := range []string{"zeta", "alpha", "mu", "beta", "omega", "gamma"} {
+			extras[key] = int64(len(key))
+		}
+
+		for i := 0; i < 10; i++ {
+			data, err := newPoint(1, extras).MarshalBSON()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"ts", "id", "counters", "timers", "gauges", "extras"}, keys(t, data))
+
+			doc, err := bsonx.ReadDocument(data)
+			require.NoError(t, err)
+			block, err := doc.Lookup("extras").MutableDocument().MarshalBSON()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"alpha", "beta", "gamma", "mu", "omega", "zeta"}, keys(t, block))
+		}
+	})
+	t.Run("RoundTrip", func(t *testing.T) {
+		point := newPoint(3, map[string]int64{"cache_hits": 40, "cache_misses": 2})
+		data, err := bson.Marshal(point)
+		require.NoError(t, err)
+
+		out := Performance{}
+		require.NoError(t, bson.Unmarshal(data, &out))
+		assert.Equal(t, point.Extras, out.Extras)
+		assert.Equal(t, point.Counters, out.Counters)
+		assert.True(t, point.Timestamp.Equal(out.Timestamp))
+	})
+	t.Run("Collector", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		collector := ftdc.NewBaseCollector(100)
+		for i := int64(0); i < 10; i++ {
+			require.NoError(t, collector.Add(newPoint(i, map[string]int64{
+				"retries":  i % 3,
+				"conflict": i * 10,
+			})))
+		}
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		iter := ftdc.ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		chunk := iter.Chunk()
+		assert.Equal(t, 10, chunk.Size())
+
+		metrics := map[string][]int64{}
+		for _, m := range chunk.Metrics {
+			metrics[m.Key()] = m.Values
+		}
+		require.Len(t, metrics["extras.conflict"], 10)
+		require.Len(t, metrics["extras.retries"], 10)
+		assert.Equal(t, int64(90), metrics["extras.conflict"][9])
+		assert.Equal(t, int64(2), metrics["extras.retries"][5])
+		assert.False(t, iter.Next())
+		require.NoError(t, iter.Err())
+	})
+}
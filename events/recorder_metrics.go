@@ -0,0 +1,159 @@
+package events
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// MetricRecorder is a companion to Recorder for application metrics
+// that are not timed operations, and which are identified by name
+// rather than mapped onto the fields of the Performance type.
+type MetricRecorder interface {
+	// SetGauge replaces the value of the named gauge, which
+	// reports the current value of some quantity (e.g. the length
+	// of a queue, or the size of a cache.)
+	SetGauge(name string, value int64)
+
+	// IncCounter adds the delta to the named counter, which
+	// reports the total number of events (e.g. requests served)
+	// since the recorder was created.
+	IncCounter(name string, delta int64)
+
+	// Flush records the current value of every gauge and counter,
+	// and returns all errors since the last flush.
+	Flush() error
+}
+
+type metricStream struct {
+	collector     ftdc.Collector
+	interval      time.Duration
+	lastCollected time.Time
+	gauges        namedValues
+	counters      namedValues
+	catcher       grip.Catcher
+	mu            sync.Mutex
+}
+
+// NewMetricRecorder returns a MetricRecorder that persists, if the
+// interval has elapsed when a gauge or counter is updated, a document
+// that holds the time and the current value of every gauge and
+// counter, e.g.:
+//
+//	{ ts: <date>, gauges: { queue: 4 }, counters: { requests: 1024 } }
+//
+// Counters hold the total of their deltas since the recorder was
+// created, and are never reset, so that their rates may be derived
+// from the collected data (e.g. with ftdc.Rate.) Gauges hold their
+// most recent value.
+//
+// Names must not be empty or contain dots. Gauges and counters are
+// recorded in the order in which they're first used, and once used,
+// are recorded in every subsequent document, so the schema of the
+// documents only changes when a new name is used. Use a collector
+// that supports schema changes (e.g. ftdc.NewDynamicCollector) if the
+// names are not known in advance.
+//
+// Unlike most recorders, the metric recorder is safe for concurrent
+// use.
+func NewMetricRecorder(collector ftdc.Collector, interval time.Duration) MetricRecorder {
+	return &metricStream{
+		collector:     collector,
+		interval:      interval,
+		lastCollected: time.Now(),
+		gauges:        namedValues{index: map[string]int{}},
+		counters:      namedValues{index: map[string]int{}},
+		catcher:       grip.NewExtendedCatcher(),
+	}
+}
+
+func (r *metricStream) SetGauge(name string, value int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.validName(name) {
+		*r.gauges.get(name) = value
+		r.record()
+	}
+}
+
+func (r *metricStream) IncCounter(name string, delta int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.validName(name) {
+		*r.counters.get(name) += delta
+		r.record()
+	}
+}
+
+func (r *metricStream) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.gauges.names) > 0 || len(r.counters.names) > 0 {
+		r.catcher.Add(r.collector.Add(r.document()))
+	}
+	r.lastCollected = time.Now()
+
+	err := r.catcher.Resolve()
+	r.catcher = grip.NewExtendedCatcher()
+	return errors.WithStack(err)
+}
+
+func (r *metricStream) validName(name string) bool {
+	if name == "" || strings.Contains(name, ".") {
+		r.catcher.Errorf("invalid metric name '%s'", name)
+		return false
+	}
+	return true
+}
+
+func (r *metricStream) record() {
+	if time.Since(r.lastCollected) < r.interval {
+		return
+	}
+
+	r.catcher.Add(r.collector.Add(r.document()))
+	r.lastCollected = time.Now()
+}
+
+func (r *metricStream) document() *bsonx.Document {
+	return bsonx.NewDocument(
+		bsonx.EC.Time("ts", time.Now()),
+		bsonx.EC.SubDocument("gauges", r.gauges.document()),
+		bsonx.EC.SubDocument("counters", r.counters.document()),
+	)
+}
+
+// namedValues holds values by name, in the order in which the names
+// were first used.
+type namedValues struct {
+	names  []string
+	values []int64
+	index  map[string]int
+}
+
+func (v *namedValues) get(name string) *int64 {
+	idx, ok := v.index[name]
+	if !ok {
+		idx = len(v.names)
+		v.index[name] = idx
+		v.names = append(v.names, name)
+		v.values = append(v.values, 0)
+	}
+	return &v.values[idx]
+}
+
+func (v *namedValues) document() *bsonx.Document {
+	doc := bsonx.DC.Make(len(v.names))
+	for idx, name := range v.names {
+		doc.Append(bsonx.EC.Int64(name, v.values[idx]))
+	}
+	return doc
+}
@@ -0,0 +1,110 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricRecorder(t *testing.T) {
+	t.Run("FlushRecordsValues", func(t *testing.T) {
+		collector := &MockCollector{}
+		r := NewMetricRecorder(collector, time.Hour)
+
+		r.SetGauge("queue", 4)
+		r.IncCounter("requests", 10)
+		r.IncCounter("requests", 5)
+		r.SetGauge("queue", 2)
+		r.IncCounter("errors", 1)
+		assert.Len(t, collector.Data, 0)
+
+		require.NoError(t, r.Flush())
+		require.Len(t, collector.Data, 1)
+
+		doc := collector.Data[0].(*bsonx.Document)
+		require.Equal(t, 3, doc.Len())
+		assert.Equal(t, "ts", doc.ElementAt(0).Key())
+		assert.Equal(t, int64(2), doc.LookupPath("gauges.queue").Int64())
+		assert.Equal(t, int64(15), doc.LookupPath("counters.requests").Int64())
+		assert.Equal(t, int64(1), doc.LookupPath("counters.errors").Int64())
+	})
+	t.Run("CountersAreCumulative", func(t *testing.T) {
+		collector := &MockCollector{}
+		r := NewMetricRecorder(collector, time.Hour)
+
+		r.IncCounter("requests", 10)
+		require.NoError(t, r.Flush())
+		r.IncCounter("requests", 5)
+		r.SetGauge("queue", 1)
+		require.NoError(t, r.Flush())
+		require.Len(t, collector.Data, 2)
+
+		first := collector.Data[0].(*bsonx.Document)
+		second := collector.Data[1].(*bsonx.Document)
+		assert.Equal(t, int64(10), first.LookupPath("counters.requests").Int64())
+		assert.Equal(t, 0, first.Lookup("gauges").MutableDocument().Len())
+		assert.Equal(t, int64(15), second.LookupPath("counters.requests").Int64())
+		assert.Equal(t, int64(1), second.LookupPath("gauges.queue").Int64())
+	})
+	t.Run("RecordsOnInterval", func(t *testing.T) {
+		collector := &MockCollector{}
+		r := NewMetricRecorder(collector, 0)
+
+		r.SetGauge("queue", 1)
+		r.IncCounter("requests", 1)
+		assert.Len(t, collector.Data, 2)
+	})
+	t.Run("EmptyFlush", func(t *testing.T) {
+		collector := &MockCollector{}
+		r := NewMetricRecorder(collector, time.Hour)
+		assert.NoError(t, r.Flush())
+		assert.Len(t, collector.Data, 0)
+	})
+	t.Run("InvalidNames", func(t *testing.T) {
+		collector := &MockCollector{}
+		r := NewMetricRecorder(collector, time.Hour)
+
+		r.SetGauge("", 1)
+		r.IncCounter("a.b", 1)
+		r.IncCounter("ok", 1)
+		assert.Error(t, r.Flush())
+		require.Len(t, collector.Data, 1)
+
+		doc := collector.Data[0].(*bsonx.Document)
+		assert.Equal(t, 0, doc.Lookup("gauges").MutableDocument().Len())
+		assert.Equal(t, 1, doc.Lookup("counters").MutableDocument().Len())
+		assert.NoError(t, r.Flush())
+	})
+	t.Run("CollectorErrors", func(t *testing.T) {
+		collector := &MockCollector{AddError: errors.New("add failed")}
+		r := NewMetricRecorder(collector, 0)
+		r.IncCounter("requests", 1)
+		assert.Error(t, r.Flush())
+	})
+	t.Run("Concurrent", func(t *testing.T) {
+		collector := &MockCollector{}
+		r := NewMetricRecorder(collector, time.Hour)
+
+		wg := &sync.WaitGroup{}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					r.IncCounter("requests", 1)
+					r.SetGauge("workers", 8)
+				}
+			}()
+		}
+		wg.Wait()
+
+		require.NoError(t, r.Flush())
+		require.Len(t, collector.Data, 1)
+		assert.Equal(t, int64(800), collector.Data[0].(*bsonx.Document).LookupPath("counters.requests").Int64())
+	})
+}
@@ -0,0 +1,184 @@
+//go:build otel
+// +build otel
+
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// OpenTelemetryOptions configure the instruments created by
+// NewOpenTelemetryRecorder.
+type OpenTelemetryOptions struct {
+	// Prefix is prepended, with a ".", to the names of the
+	// instruments. Defaults to "ftdc.events".
+	Prefix string
+	// Attributes are attached to every measurement, and should
+	// identify the workload or operation that the recorder
+	// tracks.
+	Attributes []attribute.KeyValue
+}
+
+type otelRecorder struct {
+	recorder Recorder
+	started  time.Time
+	ctx      context.Context
+	attrs    metric.MeasurementOption
+
+	ops        metric.Int64Counter
+	size       metric.Int64Counter
+	errors     metric.Int64Counter
+	iterations metric.Int64Counter
+	state      metric.Int64Gauge
+	workers    metric.Int64Gauge
+	failed     metric.Int64Gauge
+	duration   metric.Float64Histogram
+	total      metric.Float64Histogram
+}
+
+// NewOpenTelemetryRecorder wraps a recorder so that, in addition to
+// the data that the wrapped recorder writes to its collector, every
+// event is also reported to instruments created by a meter from the
+// provider, for export via OpenTelemetry (e.g. OTLP). Counters are
+// reported as counters, the state, workers, and failed gauges as
+// gauges, and durations as histograms, in seconds. The total duration
+// of an iteration is measured from the last call to Begin, Reset, or
+// End, as in the other recorders.
+//
+// IDs and timestamps are only passed to the wrapped recorder, because
+// OpenTelemetry records the time of each measurement itself, and
+// using IDs as attributes would create a time series per ID.
+//
+// The OpenTelemetry recorder is not safe for concurrent access. Support
+// for OpenTelemetry requires building with the "otel" build tag.
+func NewOpenTelemetryRecorder(r Recorder, provider metric.MeterProvider, opts OpenTelemetryOptions) (Recorder, error) {
+	if r == nil {
+		return nil, errors.New("must specify a recorder")
+	}
+	if provider == nil {
+		return nil, errors.New("must specify a meter provider")
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "ftdc.events"
+	}
+
+	meter := provider.Meter("github.com/mongodb/ftdc/events")
+	name := func(n string) string { return opts.Prefix + "." + n }
+
+	out := &otelRecorder{
+		recorder: r,
+		ctx:      context.Background(),
+		attrs:    metric.WithAttributes(opts.Attributes...),
+	}
+
+	var err error
+	if out.ops, err = meter.Int64Counter(name("operations"), metric.WithDescription("logical operations")); err != nil {
+		return nil, errors.Wrap(err, "problem creating operations counter")
+	}
+	if out.size, err = meter.Int64Counter(name("size"), metric.WithDescription("size of the data processed"), metric.WithUnit("By")); err != nil {
+		return nil, errors.Wrap(err, "problem creating size counter")
+	}
+	if out.errors, err = meter.Int64Counter(name("errors"), metric.WithDescription("errors encountered")); err != nil {
+		return nil, errors.Wrap(err, "problem creating errors counter")
+	}
+	if out.iterations, err = meter.Int64Counter(name("iterations"), metric.WithDescription("completed iterations")); err != nil {
+		return nil, errors.Wrap(err, "problem creating iterations counter")
+	}
+	if out.state, err = meter.Int64Gauge(name("state"), metric.WithDescription("workload state")); err != nil {
+		return nil, errors.Wrap(err, "problem creating state gauge")
+	}
+	if out.workers, err = meter.Int64Gauge(name("workers"), metric.WithDescription("active workers")); err != nil {
+		return nil, errors.Wrap(err, "problem creating workers gauge")
+	}
+	if out.failed, err = meter.Int64Gauge(name("failed"), metric.WithDescription("1 if the workload has failed")); err != nil {
+		return nil, errors.Wrap(err, "problem creating failed gauge")
+	}
+	if out.duration, err = meter.Float64Histogram(name("duration"), metric.WithDescription("duration of operations"), metric.WithUnit("s")); err != nil {
+		return nil, errors.Wrap(err, "problem creating duration histogram")
+	}
+	if out.total, err = meter.Float64Histogram(name("total_duration"), metric.WithDescription("total duration of iterations"), metric.WithUnit("s")); err != nil {
+		return nil, errors.Wrap(err, "problem creating total duration histogram")
+	}
+
+	return out, nil
+}
+
+func (r *otelRecorder) SetID(id int64)      { r.recorder.SetID(id) }
+func (r *otelRecorder) SetTime(t time.Time) { r.recorder.SetTime(t) }
+func (r *otelRecorder) Flush() error        { return r.recorder.Flush() }
+
+func (r *otelRecorder) Begin() {
+	r.recorder.Begin()
+	r.started = time.Now()
+}
+
+func (r *otelRecorder) Reset() {
+	r.recorder.Reset()
+	r.started = time.Now()
+}
+
+func (r *otelRecorder) End(dur time.Duration) {
+	r.recorder.End(dur)
+
+	r.iterations.Add(r.ctx, 1, r.attrs)
+	r.duration.Record(r.ctx, dur.Seconds(), r.attrs)
+	if !r.started.IsZero() {
+		r.total.Record(r.ctx, time.Since(r.started).Seconds(), r.attrs)
+	}
+	r.started = time.Now()
+}
+
+func (r *otelRecorder) SetTotalDuration(dur time.Duration) {
+	r.recorder.SetTotalDuration(dur)
+	r.total.Record(r.ctx, dur.Seconds(), r.attrs)
+}
+
+func (r *otelRecorder) SetDuration(dur time.Duration) {
+	r.recorder.SetDuration(dur)
+	r.duration.Record(r.ctx, dur.Seconds(), r.attrs)
+}
+
+func (r *otelRecorder) IncOps(val int64) {
+	r.recorder.IncOps(val)
+	r.ops.Add(r.ctx, val, r.attrs)
+}
+
+func (r *otelRecorder) IncSize(val int64) {
+	r.recorder.IncSize(val)
+	r.size.Add(r.ctx, val, r.attrs)
+}
+
+func (r *otelRecorder) IncError(val int64) {
+	r.recorder.IncError(val)
+	r.errors.Add(r.ctx, val, r.attrs)
+}
+
+func (r *otelRecorder) IncIterations(val int64) {
+	r.recorder.IncIterations(val)
+	r.iterations.Add(r.ctx, val, r.attrs)
+}
+
+func (r *otelRecorder) SetState(val int64) {
+	r.recorder.SetState(val)
+	r.state.Record(r.ctx, val, r.attrs)
+}
+
+func (r *otelRecorder) SetWorkers(val int64) {
+	r.recorder.SetWorkers(val)
+	r.workers.Record(r.ctx, val, r.attrs)
+}
+
+func (r *otelRecorder) SetFailed(val bool) {
+	r.recorder.SetFailed(val)
+
+	var failed int64
+	if val {
+		failed = 1
+	}
+	r.failed.Record(r.ctx, failed, r.attrs)
+}
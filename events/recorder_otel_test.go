@@ -0,0 +1,97 @@
+//go:build otel
+// +build otel
+
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestOpenTelemetryRecorder(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		_, err := NewOpenTelemetryRecorder(nil, provider, OpenTelemetryOptions{})
+		assert.Error(t, err)
+		_, err = NewOpenTelemetryRecorder(NewSingleRecorder(&MockCollector{}), nil, OpenTelemetryOptions{})
+		assert.Error(t, err)
+	})
+
+	collector := &MockCollector{}
+	r, err := NewOpenTelemetryRecorder(NewSingleRecorder(collector), provider, OpenTelemetryOptions{
+		Attributes: []attribute.KeyValue{attribute.String("workload", "test")},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		r.Begin()
+		r.IncOps(2)
+		r.IncSize(100)
+		r.SetWorkers(4)
+		r.End(time.Second)
+	}
+	r.IncError(1)
+	r.SetFailed(true)
+	require.NoError(t, r.Flush())
+
+	// the wrapped recorder still writes to its collector.
+	require.Len(t, collector.Data, 1)
+	point, ok := collector.Data[0].(Performance)
+	require.True(t, ok)
+	assert.EqualValues(t, 10, point.Counters.Number)
+	assert.EqualValues(t, 20, point.Counters.Operations)
+	assert.Equal(t, 10*time.Second, point.Timers.Duration)
+
+	data := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(context.Background(), &data))
+	require.Len(t, data.ScopeMetrics, 1)
+
+	metrics := map[string]metricdata.Aggregation{}
+	for _, m := range data.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m.Data
+	}
+
+	sum := func(name string) int64 {
+		agg, ok := metrics[name].(metricdata.Sum[int64])
+		require.True(t, ok, name)
+		require.Len(t, agg.DataPoints, 1)
+		value, ok := agg.DataPoints[0].Attributes.Value("workload")
+		require.True(t, ok)
+		assert.Equal(t, "test", value.AsString())
+		return agg.DataPoints[0].Value
+	}
+	gauge := func(name string) int64 {
+		agg, ok := metrics[name].(metricdata.Gauge[int64])
+		require.True(t, ok, name)
+		require.Len(t, agg.DataPoints, 1)
+		return agg.DataPoints[0].Value
+	}
+
+	assert.EqualValues(t, 20, sum("ftdc.events.operations"))
+	assert.EqualValues(t, 1000, sum("ftdc.events.size"))
+	assert.EqualValues(t, 1, sum("ftdc.events.errors"))
+	assert.EqualValues(t, 10, sum("ftdc.events.iterations"))
+	assert.EqualValues(t, 4, gauge("ftdc.events.workers"))
+	assert.EqualValues(t, 1, gauge("ftdc.events.failed"))
+
+	duration, ok := metrics["ftdc.events.duration"].(metricdata.Histogram[float64])
+	require.True(t, ok)
+	require.Len(t, duration.DataPoints, 1)
+	assert.EqualValues(t, 10, duration.DataPoints[0].Count)
+	assert.Equal(t, 10.0, duration.DataPoints[0].Sum)
+
+	total, ok := metrics["ftdc.events.total_duration"].(metricdata.Histogram[float64])
+	require.True(t, ok)
+	require.Len(t, total.DataPoints, 1)
+	assert.EqualValues(t, 10, total.DataPoints[0].Count)
+}
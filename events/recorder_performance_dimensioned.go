@@ -0,0 +1,198 @@
+package events
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// DimensionedRecorder aggregates events separately for each
+// combination of the values of a set of dimensions (e.g. the type of
+// operation and the shard), and records the aggregated events of
+// every combination in a single document.
+type DimensionedRecorder interface {
+	// Dimension returns the recorder that aggregates the events
+	// for the combination of dimension values, which must have
+	// one value for each dimension of the recorder, in order.
+	// Values must not be empty or contain dots. The Flush method
+	// of the returned recorder flushes every combination.
+	Dimension(values ...string) Recorder
+
+	// Flush records the aggregated events of every combination,
+	// as with the Flush method of the grouped recorder, and
+	// returns all errors since the last flush.
+	Flush() error
+}
+
+type dimensionedStream struct {
+	collector     ftdc.Collector
+	dimensions    []string
+	interval      time.Duration
+	lastCollected time.Time
+	points        []*dimensionPoint
+	index         map[string]*dimensionPoint
+	catcher       grip.Catcher
+}
+
+// NewDimensionedRecorder provides a variant of the grouped recorder
+// (see NewGroupedRecorder) that aggregates events separately for each
+// combination of dimension values, and persists, if the interval has
+// elapsed when any combination ends an event, a document that holds
+// the counters, timers, and gauges of each combination nested under
+// its values. For example, with the dimensions "op" and "shard", the
+// operation counter of inserts on shard0 has the flattened key
+// "insert.shard0.counters.ops".
+//
+// Combinations are recorded in the order in which they're first used,
+// and once a combination is used, it is recorded in every subsequent
+// document, so the schema of the documents only changes when a new
+// combination is used. Use a collector that supports schema changes
+// (e.g. NewDynamicCollector) if the combinations are not known in
+// advance.
+//
+// The dimensioned recorder, and the recorders of its combinations,
+// are not safe for concurrent access.
+func NewDimensionedRecorder(collector ftdc.Collector, interval time.Duration, dimensions ...string) DimensionedRecorder {
+	return &dimensionedStream{
+		collector:     collector,
+		dimensions:    dimensions,
+		interval:      interval,
+		lastCollected: time.Now(),
+		index:         map[string]*dimensionPoint{},
+		catcher:       grip.NewExtendedCatcher(),
+	}
+}
+
+func (r *dimensionedStream) Dimension(values ...string) Recorder {
+	if len(values) != len(r.dimensions) {
+		r.catcher.Errorf("expected %d dimension values %v, got %d", len(r.dimensions), r.dimensions, len(values))
+		return &dimensionPoint{parent: r, discard: true}
+	}
+	for _, value := range values {
+		if value == "" || strings.Contains(value, ".") {
+			r.catcher.Errorf("invalid dimension value '%s'", value)
+			return &dimensionPoint{parent: r, discard: true}
+		}
+	}
+
+	key := strings.Join(values, ".")
+	if point, ok := r.index[key]; ok {
+		return point
+	}
+
+	point := &dimensionPoint{parent: r, values: values}
+	r.index[key] = point
+	r.points = append(r.points, point)
+	return point
+}
+
+func (r *dimensionedStream) document() *bsonx.Document {
+	ts := time.Now()
+	for _, point := range r.points {
+		if point.point.Timestamp.After(ts) {
+			ts = point.point.Timestamp
+		}
+	}
+
+	doc := bsonx.NewDocument(bsonx.EC.Time("ts", ts))
+	for _, point := range r.points {
+		parent := doc
+		for _, value := range point.values {
+			if elem := parent.LookupElement(value); elem != nil {
+				parent = elem.Value().MutableDocument()
+				continue
+			}
+
+			next := bsonx.NewDocument()
+			parent.Append(bsonx.EC.SubDocument(value, next))
+			parent = next
+		}
+
+		p := point.point
+		parent.Append(
+			bsonx.EC.Int64("id", p.ID),
+			bsonx.EC.SubDocumentFromElements("counters",
+				bsonx.EC.Int64("n", p.Counters.Number),
+				bsonx.EC.Int64("ops", p.Counters.Operations),
+				bsonx.EC.Int64("size", p.Counters.Size),
+				bsonx.EC.Int64("errors", p.Counters.Errors)),
+			bsonx.EC.SubDocumentFromElements("timers",
+				bsonx.EC.Int64("dur", int64(p.Timers.Duration)),
+				bsonx.EC.Int64("total", int64(p.Timers.Total))),
+			bsonx.EC.SubDocumentFromElements("gauges",
+				bsonx.EC.Int64("state", p.Gauges.State),
+				bsonx.EC.Int64("workers", p.Gauges.Workers),
+				bsonx.EC.Boolean("failed", p.Gauges.Failed)),
+		)
+	}
+
+	return doc
+}
+
+func (r *dimensionedStream) end() {
+	if time.Since(r.lastCollected) < r.interval {
+		return
+	}
+
+	r.catcher.Add(r.collector.Add(r.document()))
+	r.lastCollected = time.Now()
+}
+
+func (r *dimensionedStream) Flush() error {
+	if len(r.points) > 0 {
+		r.catcher.Add(r.collector.Add(r.document()))
+	}
+	r.lastCollected = time.Now()
+
+	for _, point := range r.points {
+		point.point = Performance{
+			Gauges: point.point.Gauges,
+		}
+		point.started = time.Time{}
+	}
+
+	err := r.catcher.Resolve()
+	r.catcher = grip.NewExtendedCatcher()
+	return errors.WithStack(err)
+}
+
+// dimensionPoint is the recorder of a combination of dimension
+// values. Recorders for invalid combinations discard their events.
+type dimensionPoint struct {
+	parent  *dimensionedStream
+	values  []string
+	started time.Time
+	point   Performance
+	discard bool
+}
+
+func (r *dimensionPoint) Reset()                             { r.started = time.Now() }
+func (r *dimensionPoint) Begin()                             { r.started = time.Now() }
+func (r *dimensionPoint) IncOps(val int64)                   { r.point.Counters.Operations += val }
+func (r *dimensionPoint) IncIterations(val int64)            { r.point.Counters.Number += val }
+func (r *dimensionPoint) IncSize(val int64)                  { r.point.Counters.Size += val }
+func (r *dimensionPoint) IncError(val int64)                 { r.point.Counters.Errors += val }
+func (r *dimensionPoint) SetState(val int64)                 { r.point.Gauges.State = val }
+func (r *dimensionPoint) SetWorkers(val int64)               { r.point.Gauges.Workers = val }
+func (r *dimensionPoint) SetFailed(val bool)                 { r.point.Gauges.Failed = val }
+func (r *dimensionPoint) SetID(val int64)                    { r.point.ID = val }
+func (r *dimensionPoint) SetTime(t time.Time)                { r.point.Timestamp = t }
+func (r *dimensionPoint) SetDuration(dur time.Duration)      { r.point.Timers.Duration += dur }
+func (r *dimensionPoint) SetTotalDuration(dur time.Duration) { r.point.Timers.Total += dur }
+func (r *dimensionPoint) Flush() error                       { return r.parent.Flush() }
+func (r *dimensionPoint) End(dur time.Duration) {
+	r.point.Counters.Number++
+	if !r.started.IsZero() {
+		r.point.Timers.Total += time.Since(r.started)
+		r.started = time.Time{}
+	}
+	r.point.Timers.Duration += dur
+
+	if !r.discard {
+		r.parent.end()
+	}
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDimensionedRecorder(t *testing.T) {
+	t.Run("Document", func(t *testing.T) {
+		collector := &MockCollector{}
+		r := NewDimensionedRecorder(collector, time.Hour, "op", "shard")
+
+		insert := r.Dimension("insert", "shard0")
+		insert.Begin()
+		insert.IncOps(10)
+		insert.SetWorkers(4)
+		insert.End(time.Second)
+
+		update := r.Dimension("update", "shard1")
+		update.IncOps(3)
+		update.IncError(1)
+		update.End(time.Millisecond)
+
+		other := r.Dimension("insert", "shard1")
+		other.End(time.Minute)
+
+		assert.True(t, insert == r.Dimension("insert", "shard0"))
+		assert.Len(t, collector.Data, 0, "the interval has not elapsed")
+
+		require.NoError(t, r.Flush())
+		require.Len(t, collector.Data, 1)
+		doc, ok := collector.Data[0].(*bsonx.Document)
+		require.True(t, ok)
+
+		assert.EqualValues(t, 10, doc.LookupPath("insert.shard0.counters.ops").Int64())
+		assert.EqualValues(t, 1, doc.LookupPath("insert.shard0.counters.n").Int64())
+		assert.EqualValues(t, time.Second, doc.LookupPath("insert.shard0.timers.dur").Int64())
+		assert.True(t, doc.LookupPath("insert.shard0.timers.total").Int64() > 0)
+		assert.EqualValues(t, 4, doc.LookupPath("insert.shard0.gauges.workers").Int64())
+		assert.EqualValues(t, 3, doc.LookupPath("update.shard1.counters.ops").Int64())
+		assert.EqualValues(t, 1, doc.LookupPath("update.shard1.counters.errors").Int64())
+		assert.EqualValues(t, time.Minute, doc.LookupPath("insert.shard1.timers.dur").Int64())
+
+		// combinations are nested, in the order of first use.
+		keys := []string{}
+		iter := doc.Iterator()
+		for iter.Next() {
+			keys = append(keys, iter.Element().Key())
+		}
+		assert.Equal(t, []string{"ts", "insert", "update"}, keys)
+		assert.Equal(t, 2, doc.Lookup("insert").MutableDocument().Len())
+
+		// flushing resets counters, but not gauges, and keeps
+		// every combination.
+		require.NoError(t, r.Flush())
+		require.Len(t, collector.Data, 2)
+		doc = collector.Data[1].(*bsonx.Document)
+		assert.EqualValues(t, 0, doc.LookupPath("insert.shard0.counters.ops").Int64())
+		assert.EqualValues(t, 4, doc.LookupPath("insert.shard0.gauges.workers").Int64())
+		assert.NotNil(t, doc.LookupPath("update.shard1"))
+	})
+	t.Run("Interval", func(t *testing.T) {
+		collector := &MockCollector{}
+		r := NewDimensionedRecorder(collector, 0, "op")
+
+		r.Dimension("insert").End(time.Second)
+		r.Dimension("query").End(time.Second)
+		require.Len(t, collector.Data, 2)
+		assert.Equal(t, 2, collector.Data[0].(*bsonx.Document).Len())
+		assert.Nil(t, collector.Data[0].(*bsonx.Document).LookupElement("query"))
+		assert.NotNil(t, collector.Data[1].(*bsonx.Document).LookupElement("query"))
+
+		// the recorder of a combination flushes every
+		// combination.
+		require.NoError(t, r.Dimension("query").Flush())
+		assert.Len(t, collector.Data, 3)
+	})
+	t.Run("InvalidDimensions", func(t *testing.T) {
+		collector := &MockCollector{}
+		r := NewDimensionedRecorder(collector, 0, "op", "shard")
+
+		for _, values := range [][]string{{"insert"}, {"insert", "shard0", "extra"}, {"insert", ""}, {"insert", "a.b"}} {
+			rec := r.Dimension(values...)
+			require.NotNil(t, rec)
+			rec.IncOps(1)
+			rec.End(time.Second)
+		}
+		assert.Len(t, collector.Data, 0)
+		assert.Error(t, r.Flush())
+		assert.Len(t, collector.Data, 0)
+
+		assert.NoError(t, r.Flush(), "errors are reset by flushing")
+	})
+	t.Run("CollectorErrors", func(t *testing.T) {
+		collector := &MockCollector{AddError: errors.New("closed")}
+		r := NewDimensionedRecorder(collector, time.Hour, "op")
+		r.Dimension("insert").End(time.Second)
+		assert.Error(t, r.Flush())
+	})
+	t.Run("RoundTrip", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		collector := ftdc.NewDynamicCollector(100)
+		r := NewDimensionedRecorder(collector, 0, "op")
+		for i := 0; i < 10; i++ {
+			r.Dimension("insert").IncOps(2)
+			r.Dimension("insert").End(time.Millisecond)
+			if i >= 5 {
+				r.Dimension("remove").IncOps(1)
+				r.Dimension("remove").End(time.Millisecond)
+			}
+		}
+		require.NoError(t, r.Flush())
+
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		iter := ftdc.ReadMetrics(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		var last *bsonx.Document
+		for iter.Next() {
+			last = iter.Document()
+		}
+		require.NoError(t, iter.Err())
+		require.NotNil(t, last)
+		assert.EqualValues(t, 20, last.Lookup("insert.counters.ops").Int64())
+		assert.EqualValues(t, 5, last.Lookup("remove.counters.ops").Int64())
+	})
+}
@@ -0,0 +1,155 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// IntervalFlusher is a Recorder that flushes the recorder that it
+// wraps on an interval, in the background.
+type IntervalFlusher interface {
+	Recorder
+
+	// Close stops the background flushes, and then flushes the
+	// wrapped recorder, if there is unflushed data. Close returns
+	// the errors of the flushes since the last call to Flush, and
+	// is safe to call more than once. The recorder remains usable
+	// after Close, but is no longer flushed in the background.
+	Close() error
+}
+
+type intervalFlusher struct {
+	recorder Recorder
+	catcher  grip.Catcher
+	dirty    bool
+	closed   bool
+	stop     chan struct{}
+	done     chan struct{}
+	sync.Mutex
+}
+
+// NewIntervalFlusher wraps a recorder so that a background goroutine
+// calls the recorder's Flush method on the interval, which ensures
+// that the data of workers that go idle reaches the collector, rather
+// than remaining buffered in the recorder until the worker records
+// another event or exits. The flusher only flushes the recorder if
+// it has recorded data since the previous flush, so idle recorders
+// do not add empty points to the collector.
+//
+// Errors from background flushes are reported by the next call to
+// Flush or Close. The flusher is safe for concurrent use, as the
+// background goroutine must synchronize with the callers of the
+// recorder, and you must call Close to stop the background goroutine.
+func NewIntervalFlusher(r Recorder, interval time.Duration) IntervalFlusher {
+	f := &intervalFlusher{
+		recorder: r,
+		catcher:  grip.NewExtendedCatcher(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go f.worker(interval)
+
+	return f
+}
+
+func (f *intervalFlusher) worker(interval time.Duration) {
+	defer close(f.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.Lock()
+			if f.dirty {
+				f.catcher.Add(f.recorder.Flush())
+				f.dirty = false
+			}
+			f.Unlock()
+		}
+	}
+}
+
+func (f *intervalFlusher) Close() error {
+	f.Lock()
+	if !f.closed {
+		f.closed = true
+		close(f.stop)
+	}
+	f.Unlock()
+
+	// wait for the worker without holding the lock, as the worker
+	// may be waiting for the lock to flush the recorder.
+	<-f.done
+
+	f.Lock()
+	defer f.Unlock()
+
+	if f.dirty {
+		f.catcher.Add(f.recorder.Flush())
+		f.dirty = false
+	}
+
+	return f.resolve()
+}
+
+func (f *intervalFlusher) Flush() error {
+	f.Lock()
+	defer f.Unlock()
+
+	f.catcher.Add(f.recorder.Flush())
+	f.dirty = false
+
+	return f.resolve()
+}
+
+// resolve returns the accumulated errors, and resets the catcher. The
+// caller must hold the lock.
+func (f *intervalFlusher) resolve() error {
+	err := f.catcher.Resolve()
+	f.catcher = grip.NewExtendedCatcher()
+	return errors.WithStack(err)
+}
+
+func (f *intervalFlusher) do(op func()) {
+	f.Lock()
+	op()
+	f.Unlock()
+}
+
+// record calls the operation, which records data that the next flush
+// should persist.
+func (f *intervalFlusher) record(op func()) {
+	f.Lock()
+	op()
+	f.dirty = true
+	f.Unlock()
+}
+
+func (f *intervalFlusher) SetID(id int64)      { f.record(func() { f.recorder.SetID(id) }) }
+func (f *intervalFlusher) SetTime(t time.Time) { f.record(func() { f.recorder.SetTime(t) }) }
+func (f *intervalFlusher) SetTotalDuration(val time.Duration) {
+	f.record(func() { f.recorder.SetTotalDuration(val) })
+}
+func (f *intervalFlusher) SetDuration(val time.Duration) {
+	f.record(func() { f.recorder.SetDuration(val) })
+}
+func (f *intervalFlusher) IncOps(val int64) { f.record(func() { f.recorder.IncOps(val) }) }
+func (f *intervalFlusher) IncIterations(val int64) {
+	f.record(func() { f.recorder.IncIterations(val) })
+}
+func (f *intervalFlusher) IncSize(val int64)     { f.record(func() { f.recorder.IncSize(val) }) }
+func (f *intervalFlusher) IncError(val int64)    { f.record(func() { f.recorder.IncError(val) }) }
+func (f *intervalFlusher) SetState(val int64)    { f.record(func() { f.recorder.SetState(val) }) }
+func (f *intervalFlusher) SetWorkers(val int64)  { f.record(func() { f.recorder.SetWorkers(val) }) }
+func (f *intervalFlusher) SetFailed(val bool)    { f.record(func() { f.recorder.SetFailed(val) }) }
+func (f *intervalFlusher) Begin()                { f.do(f.recorder.Begin) }
+func (f *intervalFlusher) Reset()                { f.do(f.recorder.Reset) }
+func (f *intervalFlusher) End(val time.Duration) { f.record(func() { f.recorder.End(val) }) }
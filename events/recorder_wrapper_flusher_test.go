@@ -0,0 +1,72 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntervalFlusher(t *testing.T) {
+	// points returns the number of points in the collector, which
+	// the background goroutine writes to while holding the lock.
+	points := func(f IntervalFlusher, collector *MockCollector) int {
+		impl := f.(*intervalFlusher)
+		impl.Lock()
+		defer impl.Unlock()
+		return len(collector.Data)
+	}
+
+	t.Run("FlushesInBackground", func(t *testing.T) {
+		collector := &MockCollector{}
+		f := NewIntervalFlusher(NewGroupedRecorder(collector, time.Hour), 5*time.Millisecond)
+		defer f.Close()
+
+		f.Begin()
+		f.IncOps(10)
+		f.End(time.Millisecond)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for points(f, collector) == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		require.Equal(t, 1, points(f, collector))
+
+		// idle recorders are not flushed again.
+		time.Sleep(25 * time.Millisecond)
+		assert.Equal(t, 1, points(f, collector))
+	})
+	t.Run("CloseFlushesUnflushedData", func(t *testing.T) {
+		collector := &MockCollector{}
+		f := NewIntervalFlusher(NewGroupedRecorder(collector, time.Hour), time.Hour)
+
+		f.Begin()
+		assert.NoError(t, f.Close())
+		assert.Len(t, collector.Data, 0, "begin does not record data")
+
+		f = NewIntervalFlusher(NewGroupedRecorder(collector, time.Hour), time.Hour)
+		f.IncOps(1)
+		f.End(time.Second)
+		assert.NoError(t, f.Close())
+		assert.Len(t, collector.Data, 1)
+		assert.NoError(t, f.Close())
+		assert.Len(t, collector.Data, 1)
+	})
+	t.Run("ReportsBackgroundErrors", func(t *testing.T) {
+		collector := &MockCollector{AddError: errors.New("add failed")}
+		f := NewIntervalFlusher(NewSingleRecorder(collector), 5*time.Millisecond)
+
+		f.IncOps(1)
+		deadline := time.Now().Add(5 * time.Second)
+		for points(f, collector) == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		err := f.Close()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "add failed")
+		assert.NoError(t, f.Close(), "errors are reported once")
+	})
+}
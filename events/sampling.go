@@ -0,0 +1,276 @@
+package events
+
+import (
+	"container/heap"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Sampling Collectors
+//
+// The sampling collectors bound the number of Performance events that
+// reach an underlying collector, for high rate event streams. Events
+// are grouped into intervals, by their timestamps, and a fixed number
+// of events from each interval is passed to the underlying collector,
+// in timestamp order, when the interval ends or the collector is
+// resolved.
+//
+// The metadata of the underlying collector holds a "sampling"
+// document with the strategy, the total number of events seen and
+// kept, and the sampled fraction, along with the document passed to
+// SetMetadata, if any.
+
+const (
+	samplingReservoir = "reservoir"
+	samplingTail      = "tail"
+)
+
+type samplingCollector struct {
+	collector ftdc.Collector
+	strategy  string
+	interval  time.Duration
+	size      int
+	metadata  *bsonx.Document
+	random    *rand.Rand
+
+	start  time.Time
+	seen   int64
+	events samplePoints
+
+	totalSeen int64
+	totalKept int64
+}
+
+// NewReservoirSamplingCollector wraps a collector, and passes a
+// uniform random sample of at most size Performance events from each
+// interval to the underlying collector. When the interval is zero,
+// all events between calls to Resolve form a single interval.
+//
+// As with most collectors, the sampling collector is not safe for
+// concurrent use.
+func NewReservoirSamplingCollector(collector ftdc.Collector, interval time.Duration, size int) ftdc.Collector {
+	return newSamplingCollector(collector, samplingReservoir, interval, size)
+}
+
+// NewTailSamplingCollector wraps a collector, and passes the size
+// slowest Performance events, by duration, from each interval to the
+// underlying collector, so that outliers are always preserved. When
+// the interval is zero, all events between calls to Resolve form a
+// single interval.
+//
+// As with most collectors, the sampling collector is not safe for
+// concurrent use.
+func NewTailSamplingCollector(collector ftdc.Collector, interval time.Duration, size int) ftdc.Collector {
+	return newSamplingCollector(collector, samplingTail, interval, size)
+}
+
+func newSamplingCollector(collector ftdc.Collector, strategy string, interval time.Duration, size int) *samplingCollector {
+	if size < 1 {
+		size = 1
+	}
+	if interval < 0 {
+		interval = 0
+	}
+
+	return &samplingCollector{
+		collector: collector,
+		strategy:  strategy,
+		interval:  interval,
+		size:      size,
+		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		events:    make(samplePoints, 0, size),
+	}
+}
+
+func (c *samplingCollector) SetMetadata(in interface{}) error {
+	if in == nil {
+		c.metadata = nil
+		return errors.WithStack(c.setMetadata())
+	}
+
+	doc, err := bsonx.DC.InterfaceErr(in)
+	if err != nil {
+		data, merr := bson.Marshal(in)
+		if merr != nil {
+			return errors.Wrap(merr, "problem reading metadata")
+		}
+		if doc, err = bsonx.ReadDocument(data); err != nil {
+			return errors.Wrap(err, "problem reading metadata")
+		}
+	}
+	c.metadata = doc
+
+	return errors.WithStack(c.setMetadata())
+}
+
+func (c *samplingCollector) setMetadata() error {
+	doc := bsonx.NewDocument()
+	if c.metadata != nil {
+		doc = c.metadata.Copy()
+	}
+
+	var fraction float64
+	if c.totalSeen > 0 {
+		fraction = float64(c.totalKept) / float64(c.totalSeen)
+	}
+
+	doc.Set(bsonx.EC.SubDocument("sampling", bsonx.NewDocument(
+		bsonx.EC.String("strategy", c.strategy),
+		bsonx.EC.Int64("interval", int64(c.interval)),
+		bsonx.EC.Int64("size", int64(c.size)),
+		bsonx.EC.Int64("seen", c.totalSeen),
+		bsonx.EC.Int64("kept", c.totalKept),
+		bsonx.EC.Double("fraction", fraction),
+	)))
+
+	return c.collector.SetMetadata(doc)
+}
+
+func (c *samplingCollector) Add(in interface{}) error {
+	var event Performance
+	switch p := in.(type) {
+	case Performance:
+		event = p
+	case *Performance:
+		if p == nil {
+			return errors.New("cannot sample a nil event")
+		}
+		event = *p
+	default:
+		return errors.Errorf("cannot sample events of type %T", in)
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	if c.interval > 0 {
+		start := event.Timestamp.Truncate(c.interval)
+		if c.seen > 0 && !start.Equal(c.start) {
+			if err := c.flushInterval(); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		c.start = start
+	}
+
+	c.seen++
+
+	switch c.strategy {
+	case samplingReservoir:
+		if len(c.events) < c.size {
+			c.events = append(c.events, &event)
+		} else if idx := c.random.Int63n(c.seen); idx < int64(c.size) {
+			c.events[idx] = &event
+		}
+	case samplingTail:
+		if len(c.events) < c.size {
+			heap.Push(&c.events, &event)
+		} else if event.Timers.Duration > c.events[0].Timers.Duration {
+			c.events[0] = &event
+			heap.Fix(&c.events, 0)
+		}
+	}
+
+	return nil
+}
+
+// flushInterval adds the events retained for the current interval to
+// the underlying collector, and updates the sampling metadata.
+func (c *samplingCollector) flushInterval() error {
+	if c.seen == 0 {
+		return nil
+	}
+
+	events := c.events
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+
+	c.totalSeen += c.seen
+	c.seen = 0
+	c.events = make(samplePoints, 0, c.size)
+
+	for idx, event := range events {
+		if err := c.collector.Add(*event); err != nil {
+			c.totalKept += int64(idx)
+			return errors.Wrap(err, "problem adding sampled event")
+		}
+	}
+	c.totalKept += int64(len(events))
+
+	return errors.Wrap(c.setMetadata(), "problem setting sampling metadata")
+}
+
+func (c *samplingCollector) Resolve() ([]byte, error) {
+	if err := c.flushInterval(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out, err := c.collector.Resolve()
+	return out, errors.WithStack(err)
+}
+
+// Snapshot renders the contents of the underlying collector, without
+// the events retained for the current interval, which are only added
+// to the underlying collector when the interval ends. It returns an
+// error if the underlying collector does not support snapshots.
+func (c *samplingCollector) Snapshot() ([]byte, error) {
+	sc, ok := c.collector.(ftdc.SnapshotCollector)
+	if !ok {
+		return nil, errors.Errorf("collector of type %T does not support snapshots", c.collector)
+	}
+
+	out, err := sc.Snapshot()
+	return out, errors.WithStack(err)
+}
+
+func (c *samplingCollector) Reset() {
+	c.collector.Reset()
+	c.events = make(samplePoints, 0, c.size)
+	c.seen = 0
+	c.start = time.Time{}
+}
+
+// Info reports the state of the underlying collector, but includes the
+// events retained for the current interval in the sample count, as
+// these are added to the underlying collector when it is resolved.
+func (c *samplingCollector) Info() ftdc.CollectorInfo {
+	info := c.collector.Info()
+	info.SampleCount += len(c.events)
+	return info
+}
+
+// Stats reports the statistics of the underlying collector, if it
+// reports them, with the sample count of Info.
+func (c *samplingCollector) Stats() ftdc.CollectorStats {
+	var stats ftdc.CollectorStats
+	if sc, ok := c.collector.(ftdc.StatsCollector); ok {
+		stats = sc.Stats()
+	} else {
+		info := c.collector.Info()
+		stats.SampleCount, stats.MetricsCount = info.SampleCount, info.MetricsCount
+	}
+	stats.SampleCount += len(c.events)
+	return stats
+}
+
+// samplePoints implements heap.Interface as a min-heap of events
+// ordered by their duration, for tail sampling. Reservoir sampling
+// uses it as a plain slice.
+type samplePoints []*Performance
+
+func (p samplePoints) Len() int            { return len(p) }
+func (p samplePoints) Less(i, j int) bool  { return p[i].Timers.Duration < p[j].Timers.Duration }
+func (p samplePoints) Swap(i, j int)       { p[i], p[j] = p[j], p[i] }
+func (p *samplePoints) Push(x interface{}) { *p = append(*p, x.(*Performance)) }
+func (p *samplePoints) Pop() interface{} {
+	old := *p
+	item := old[len(old)-1]
+	*p = old[:len(old)-1]
+	return item
+}
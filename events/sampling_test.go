@@ -0,0 +1,144 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSamplingCollectors(t *testing.T) {
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	// 100 events in the first second, with increasing durations,
+	// followed by 3 events in the next second.
+	events := []Performance{}
+	for i := 0; i < 100; i++ {
+		events = append(events, Performance{
+			Timestamp: base.Add(time.Duration(i) * 10 * time.Millisecond),
+			ID:        int64(i),
+			Timers:    PerformanceTimers{Duration: time.Duration(i) * time.Millisecond},
+		})
+	}
+	for i := 0; i < 3; i++ {
+		events = append(events, Performance{
+			Timestamp: base.Add(time.Second + time.Duration(i)*time.Millisecond),
+			ID:        int64(100 + i),
+		})
+	}
+
+	samplingMetadata := func(t *testing.T, c *MockCollector) *bsonx.Document {
+		doc, ok := c.Metadata.(*bsonx.Document)
+		require.True(t, ok)
+		sampling, ok := doc.Lookup("sampling").MutableDocumentOK()
+		require.True(t, ok)
+		return sampling
+	}
+
+	for name, factory := range map[string]func(ftdc.Collector, time.Duration, int) ftdc.Collector{
+		"Reservoir": NewReservoirSamplingCollector,
+		"Tail":      NewTailSamplingCollector,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Run("InvalidEvents", func(t *testing.T) {
+				collector := factory(&MockCollector{}, time.Second, 5)
+				assert.Error(t, collector.Add(bsonx.NewDocument()))
+				assert.Error(t, collector.Add((*Performance)(nil)))
+			})
+			t.Run("Interval", func(t *testing.T) {
+				mock := &MockCollector{}
+				collector := factory(mock, time.Second, 5)
+				require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("test", name))))
+
+				for _, event := range events[:100] {
+					require.NoError(t, collector.Add(event))
+				}
+				assert.Len(t, mock.Data, 0)
+				assert.Equal(t, 5, collector.Info().SampleCount)
+
+				// the first event in the next interval flushes
+				// the samples for the first interval.
+				require.NoError(t, collector.Add(&events[100]))
+				require.Len(t, mock.Data, 5)
+				for idx, data := range mock.Data {
+					event, ok := data.(Performance)
+					require.True(t, ok)
+					assert.True(t, event.ID < 100)
+					if idx > 0 {
+						assert.True(t, event.Timestamp.After(mock.Data[idx-1].(Performance).Timestamp))
+					}
+					if name == "Tail" {
+						assert.True(t, event.ID >= 95)
+					}
+				}
+
+				sampling := samplingMetadata(t, mock)
+				assert.Equal(t, name, mock.Metadata.(*bsonx.Document).Lookup("test").StringValue())
+				assert.EqualValues(t, 100, sampling.Lookup("seen").Int64())
+				assert.EqualValues(t, 5, sampling.Lookup("kept").Int64())
+				assert.Equal(t, 0.05, sampling.Lookup("fraction").Double())
+
+				for _, event := range events[101:] {
+					require.NoError(t, collector.Add(event))
+				}
+				_, err := collector.Resolve()
+				require.NoError(t, err)
+				assert.Len(t, mock.Data, 8)
+				assert.Equal(t, 1, mock.ResolveCount)
+
+				sampling = samplingMetadata(t, mock)
+				assert.EqualValues(t, 103, sampling.Lookup("seen").Int64())
+				assert.EqualValues(t, 8, sampling.Lookup("kept").Int64())
+			})
+			t.Run("NoInterval", func(t *testing.T) {
+				mock := &MockCollector{}
+				collector := factory(mock, 0, 10)
+				for _, event := range events {
+					require.NoError(t, collector.Add(event))
+				}
+				assert.Len(t, mock.Data, 0)
+
+				_, err := collector.Resolve()
+				require.NoError(t, err)
+				assert.Len(t, mock.Data, 10)
+				assert.EqualValues(t, 103, samplingMetadata(t, mock).Lookup("seen").Int64())
+			})
+			t.Run("AddError", func(t *testing.T) {
+				mock := &MockCollector{AddError: assert.AnError}
+				collector := factory(mock, 0, 10)
+				require.NoError(t, collector.Add(events[0]))
+				_, err := collector.Resolve()
+				assert.Error(t, err)
+			})
+			t.Run("FlushCollector", func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				collector := factory(ftdc.NewBaseCollector(1000), time.Second, 5)
+				for _, event := range events {
+					require.NoError(t, collector.Add(event))
+				}
+
+				buf := &bytes.Buffer{}
+				require.NoError(t, ftdc.FlushCollector(collector, buf))
+				assert.Zero(t, collector.Info().SampleCount)
+
+				iter := ftdc.ReadChunks(ctx, buf)
+				defer iter.Close()
+				count := 0
+				for iter.Next() {
+					chunk := iter.Chunk()
+					count += chunk.Size()
+					require.NotNil(t, chunk.GetMetadata())
+				}
+				require.NoError(t, iter.Err())
+				assert.Equal(t, 8, count)
+			})
+		})
+	}
+}
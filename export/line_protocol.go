@@ -0,0 +1,291 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// DefaultLPMeasurement is the measurement of metrics that do not match
+// any of the rules of the line protocol options.
+const DefaultLPMeasurement = "ftdc"
+
+// LPRule maps the metrics whose keys start with a prefix to a
+// measurement. The components of the key that follow the prefix
+// become, in order, the values of the tags named by TagKeys, and the
+// remainder of the key is the name of the field.
+//
+// For example, the rule {Prefix: "hosts", TagKeys: []string{"host"}}
+// maps the metric "hosts.db0.cpu.user" to the field "cpu.user" of the
+// measurement "hosts", with the tag "host=db0".
+type LPRule struct {
+	// Prefix matches whole components of metric keys, so "a.b"
+	// matches "a.b.c" but not "a.bc".
+	Prefix string
+	// Measurement defaults to the prefix.
+	Measurement string
+	TagKeys     []string
+}
+
+func (r LPRule) match(key string) (tags []string, field string, ok bool) {
+	if !strings.HasPrefix(key, r.Prefix+".") {
+		return nil, "", false
+	}
+
+	parts := strings.SplitN(key[len(r.Prefix)+1:], ".", len(r.TagKeys)+1)
+	if len(parts) <= len(r.TagKeys) {
+		return nil, "", false
+	}
+
+	return parts[:len(r.TagKeys)], parts[len(r.TagKeys)], true
+}
+
+// LPOptions configures the output of WriteLineProtocol.
+type LPOptions struct {
+	// Measurement is the measurement of metrics that do not match
+	// any rule, with their full key as the field name. Defaults
+	// to DefaultLPMeasurement.
+	Measurement string
+	// Rules are checked in order, and the first rule that matches
+	// a metric determines its measurement and tags.
+	Rules []LPRule
+	// Tags are added to every point.
+	Tags map[string]string
+	// TimeKey is the key of the date time metric that holds the
+	// time of each sample. Defaults to the first date time metric
+	// in each chunk. The time metric is not written as a field.
+	TimeKey string
+}
+
+// Validate ensures that the options are reasonable, and sets default
+// values.
+func (opts *LPOptions) Validate() error {
+	if opts.Measurement == "" {
+		opts.Measurement = DefaultLPMeasurement
+	}
+
+	for idx, rule := range opts.Rules {
+		if rule.Prefix == "" {
+			return errors.Errorf("rule %d must specify a prefix", idx)
+		}
+		for _, tag := range rule.TagKeys {
+			if tag == "" {
+				return errors.Errorf("rule '%s' has an empty tag key", rule.Prefix)
+			}
+			if _, ok := opts.Tags[tag]; ok {
+				return errors.Errorf("rule '%s' redefines the tag '%s'", rule.Prefix, tag)
+			}
+		}
+	}
+
+	for key := range opts.Tags {
+		if key == "" {
+			return errors.New("tag keys must not be empty")
+		}
+	}
+
+	return nil
+}
+
+// WriteLineProtocol exports the contents of a stream of chunks in the
+// InfluxDB line protocol, with one line for each measurement and set
+// of tags in each sample, timestamped in nanoseconds.
+//
+// Integer, date time, and timestamp metrics are written as integer
+// fields, double metrics as float fields, and boolean metrics as
+// boolean fields. The line protocol cannot represent NaN or infinite
+// values, so those values are omitted. Returns an error if a chunk
+// does not have a time metric, or if there are any errors writing
+// data.
+func WriteLineProtocol(ctx context.Context, iter *ftdc.ChunkIterator, w io.Writer, opts LPOptions) error {
+	if err := opts.Validate(); err != nil {
+		return errors.Wrap(err, "invalid options")
+	}
+
+	buf := bufio.NewWriter(w)
+	for iter.Next() {
+		if ctx.Err() != nil {
+			return errors.New("operation aborted")
+		}
+
+		if err := writeLineProtocolChunk(buf, iter.Chunk(), &opts); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return errors.Wrap(err, "problem reading chunks")
+	}
+
+	return errors.Wrap(buf.Flush(), "problem writing line protocol")
+}
+
+var (
+	lpMeasurementEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, " ", `\ `)
+	lpKeyEscaper         = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// lpSeries is the measurement and tag set of a line, with the
+// metrics that are its fields.
+type lpSeries struct {
+	prefix  string
+	fields  []string
+	metrics []*ftdc.Metric
+}
+
+func lpTagSet(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := strings.Builder{}
+	for _, key := range keys {
+		out.WriteByte(',')
+		out.WriteString(lpKeyEscaper.Replace(key))
+		out.WriteByte('=')
+		out.WriteString(lpKeyEscaper.Replace(tags[key]))
+	}
+	return out.String()
+}
+
+// lineProtocolSeries groups the metrics of a chunk into series,
+// in the order in which they first appear.
+func lineProtocolSeries(chunk *ftdc.Chunk, opts *LPOptions, timeMetric *ftdc.Metric) []*lpSeries {
+	index := map[string]*lpSeries{}
+	out := []*lpSeries{}
+
+	for idx := range chunk.Metrics {
+		m := &chunk.Metrics[idx]
+		if m == timeMetric {
+			continue
+		}
+
+		key := m.Key()
+		measurement, field := opts.Measurement, key
+		tags := make(map[string]string, len(opts.Tags))
+		for k, v := range opts.Tags {
+			tags[k] = v
+		}
+
+		for _, rule := range opts.Rules {
+			values, name, ok := rule.match(key)
+			if !ok {
+				continue
+			}
+
+			measurement, field = rule.Measurement, name
+			if measurement == "" {
+				measurement = rule.Prefix
+			}
+			for i, tag := range rule.TagKeys {
+				tags[tag] = values[i]
+			}
+			break
+		}
+
+		prefix := lpMeasurementEscaper.Replace(measurement) + lpTagSet(tags)
+		series, ok := index[prefix]
+		if !ok {
+			series = &lpSeries{prefix: prefix}
+			index[prefix] = series
+			out = append(out, series)
+		}
+		series.fields = append(series.fields, lpKeyEscaper.Replace(field))
+		series.metrics = append(series.metrics, m)
+	}
+
+	return out
+}
+
+func lineProtocolTimeMetric(chunk *ftdc.Chunk, key string) *ftdc.Metric {
+	for idx := range chunk.Metrics {
+		m := &chunk.Metrics[idx]
+		if m.Type() != bsontype.DateTime {
+			continue
+		}
+		if key == "" || m.Key() == key {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// appendLineProtocolValue appends the field value, and returns false
+// if the value cannot be represented.
+func appendLineProtocolValue(out []byte, m *ftdc.Metric, value int64) ([]byte, bool) {
+	switch m.Type() {
+	case bsontype.Double:
+		f := math.Float64frombits(uint64(value))
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return out, false
+		}
+		return strconv.AppendFloat(out, f, 'g', -1, 64), true
+	case bsontype.Boolean:
+		return strconv.AppendBool(out, value != 0), true
+	default:
+		return append(strconv.AppendInt(out, value, 10), 'i'), true
+	}
+}
+
+func writeLineProtocolChunk(w *bufio.Writer, chunk *ftdc.Chunk, opts *LPOptions) error {
+	timeMetric := lineProtocolTimeMetric(chunk, opts.TimeKey)
+	if timeMetric == nil {
+		if opts.TimeKey != "" {
+			return errors.Errorf("chunk does not have the date time metric '%s'", opts.TimeKey)
+		}
+		return errors.New("chunk does not have a date time metric")
+	}
+
+	series := lineProtocolSeries(chunk, opts, timeMetric)
+	line := []byte{}
+	for i := 0; i < chunk.Size(); i++ {
+		ts := timeMetric.Values[i] * 1000000
+
+		for _, s := range series {
+			line = append(line[:0], s.prefix...)
+			line = append(line, ' ')
+			fields := 0
+			for idx, m := range s.metrics {
+				if fields > 0 {
+					line = append(line, ',')
+				}
+				mark := len(line)
+				line = append(line, s.fields[idx]...)
+				line = append(line, '=')
+
+				var ok bool
+				if line, ok = appendLineProtocolValue(line, m, m.Values[i]); !ok {
+					line = line[:mark]
+					if fields > 0 {
+						line = line[:mark-1]
+					}
+					continue
+				}
+				fields++
+			}
+			if fields == 0 {
+				continue
+			}
+
+			line = append(line, ' ')
+			line = strconv.AppendInt(line, ts, 10)
+			line = append(line, '\n')
+			if _, err := w.Write(line); err != nil {
+				return errors.Wrap(err, "problem writing line protocol")
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteLineProtocol(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	// doubles are only exact with the float preserving encoding.
+	buf := &bytes.Buffer{}
+	collector := ftdc.NewStreamingFloatPreservingCollector(10, buf)
+	for i := 0; i < 12; i++ {
+		ratio := float64(i) / 2
+		if i == 1 {
+			ratio = math.NaN()
+		}
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("counter", int64(i*1000)),
+			bsonx.EC.Double("ratio", ratio),
+			bsonx.EC.Boolean("flag", i%3 == 0),
+			bsonx.EC.Int32("hosts.db 0.cpu.user", int32(i)),
+			bsonx.EC.Int64("hosts.db 0.conns", 5),
+			bsonx.EC.Int32("hosts.db1.cpu.user", int32(-i)),
+			bsonx.EC.Int64("hosts.db1.conns", 6),
+		)))
+	}
+	require.NoError(t, ftdc.FlushCollector(collector, buf))
+	data := buf.Bytes()
+
+	write := func(t *testing.T, opts LPOptions) []string {
+		out := &bytes.Buffer{}
+		iter := ftdc.ReadChunks(ctx, bytes.NewBuffer(data))
+		defer iter.Close()
+		require.NoError(t, WriteLineProtocol(ctx, iter, out, opts))
+		return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for name, opts := range map[string]LPOptions{
+			"EmptyPrefix":  {Rules: []LPRule{{}}},
+			"EmptyTagKey":  {Rules: []LPRule{{Prefix: "a", TagKeys: []string{""}}}},
+			"DuplicateTag": {Rules: []LPRule{{Prefix: "a", TagKeys: []string{"host"}}}, Tags: map[string]string{"host": "a"}},
+			"EmptyTag":     {Tags: map[string]string{"": "a"}},
+		} {
+			err := WriteLineProtocol(ctx, ftdc.ReadChunks(ctx, bytes.NewBuffer(data)), &bytes.Buffer{}, opts)
+			assert.Error(t, err, name)
+		}
+	})
+	t.Run("Empty", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, WriteLineProtocol(ctx, ftdc.ReadChunks(ctx, &bytes.Buffer{}), out, LPOptions{}))
+		assert.Zero(t, out.Len())
+	})
+	t.Run("Defaults", func(t *testing.T) {
+		lines := write(t, LPOptions{})
+		require.Len(t, lines, 12)
+		assert.Equal(t, "ftdc counter=0i,ratio=0,flag=true,hosts.db\\ 0.cpu.user=0i,hosts.db\\ 0.conns=5i,"+
+			"hosts.db1.cpu.user=0i,hosts.db1.conns=6i 1527811200000000000", lines[0])
+		assert.Equal(t, "ftdc counter=1000i,flag=false,hosts.db\\ 0.cpu.user=1i,hosts.db\\ 0.conns=5i,"+
+			"hosts.db1.cpu.user=-1i,hosts.db1.conns=6i 1527811201000000000", lines[1], "NaN values are omitted")
+		assert.True(t, strings.HasPrefix(lines[2], "ftdc counter=2000i,ratio=1,"))
+	})
+	t.Run("Rules", func(t *testing.T) {
+		lines := write(t, LPOptions{
+			Measurement: "process",
+			Tags:        map[string]string{"cluster": "east,1"},
+			Rules: []LPRule{
+				{Prefix: "hosts", Measurement: "host stats", TagKeys: []string{"host"}},
+			},
+		})
+		require.Len(t, lines, 36)
+		assert.Equal(t, []string{
+			`process,cluster=east\,1 counter=0i,ratio=0,flag=true 1527811200000000000`,
+			`host\ stats,cluster=east\,1,host=db\ 0 cpu.user=0i,conns=5i 1527811200000000000`,
+			`host\ stats,cluster=east\,1,host=db1 cpu.user=0i,conns=6i 1527811200000000000`,
+		}, lines[:3])
+	})
+	t.Run("RuleMatchesWholeComponents", func(t *testing.T) {
+		lines := write(t, LPOptions{Rules: []LPRule{
+			{Prefix: "host"},
+			{Prefix: "hosts.db1", TagKeys: []string{"a", "b", "c"}},
+			{Prefix: "hosts.db1.cpu"},
+		}})
+		require.Len(t, lines, 24)
+		assert.Equal(t, "hosts.db1.cpu user=0i 1527811200000000000", lines[1])
+	})
+	t.Run("TimeKey", func(t *testing.T) {
+		err := WriteLineProtocol(ctx, ftdc.ReadChunks(ctx, bytes.NewBuffer(data)), &bytes.Buffer{}, LPOptions{TimeKey: "missing"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "missing")
+
+		noTime := makeChunks(t, 5, func(i int) *bsonx.Document {
+			return bsonx.NewDocument(bsonx.EC.Int64("counter", int64(i)))
+		})
+		err = WriteLineProtocol(ctx, ftdc.ReadChunks(ctx, bytes.NewBuffer(noTime)), &bytes.Buffer{}, LPOptions{})
+		assert.Error(t, err)
+	})
+}
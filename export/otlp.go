@@ -0,0 +1,413 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// DefaultOTLPScope is the name of the instrumentation scope of
+// exported metrics when the options do not specify one.
+const DefaultOTLPScope = "github.com/mongodb/ftdc"
+
+// OTLPOptions configures the conversion of chunks to OpenTelemetry
+// metrics by WriteOTLP and PushOTLP.
+type OTLPOptions struct {
+	// Resource holds the attributes of the resource (e.g.
+	// "service.name" or "host.name") of every metric.
+	Resource map[string]string
+	// Scope is the name of the instrumentation scope of every
+	// metric. Defaults to DefaultOTLPScope.
+	Scope string
+	// Prefix is prepended, with a ".", to the names of the
+	// metrics, which are otherwise their flattened keys.
+	Prefix string
+	// TimeKey is the key of the date time metric that holds the
+	// time of each sample. Defaults to the first date time metric
+	// in each chunk. The time metric is not exported.
+	TimeKey string
+	// Counters matches the keys of the metrics that are exported
+	// as counters (monotonic, cumulative sums) when the data does
+	// not hold descriptors of the metrics. Other metrics are
+	// exported as gauges. If nil, integer metrics whose values
+	// have never decreased are exported as counters.
+	Counters ftdc.KeyMatcher
+	// Headers are added to the requests of PushOTLP (e.g. for
+	// authentication.)
+	Headers map[string]string
+}
+
+// Validate ensures that the options are reasonable, and sets default
+// values.
+func (opts *OTLPOptions) Validate() error {
+	if opts.Scope == "" {
+		opts.Scope = DefaultOTLPScope
+	}
+
+	for key := range opts.Resource {
+		if key == "" {
+			return errors.New("resource attribute keys must not be empty")
+		}
+	}
+
+	return nil
+}
+
+// WriteOTLP exports the contents of a stream of chunks as
+// OpenTelemetry metrics, in the OTLP protocol buffer format, with one
+// ExportMetricsServiceRequest message for each chunk, prefixed with
+// its length as a 4 byte big-endian integer, as the OpenTelemetry
+// Collector's file exporter writes with the proto format.
+//
+// Each metric of a chunk becomes an OpenTelemetry metric with a data
+// point for each sample. Metrics are exported as counters or gauges
+// according to their descriptors (see ftdc.NewDescriptorCollector),
+// which also provide their units and descriptions, or according to
+// the Counters option for metrics without descriptors. Counters
+// are cumulative from the first sample of the export, or from the
+// last sample at which their value decreased (i.e. the counter was
+// reset.) Double metrics are exported with double values, and all
+// other metrics with integer values.
+//
+// Returns an error if a chunk does not have a time metric, or if
+// there are any errors writing data.
+func WriteOTLP(ctx context.Context, iter *ftdc.ChunkIterator, w io.Writer, opts OTLPOptions) error {
+	return exportOTLP(ctx, iter, opts, func(msg []byte) error {
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint32(size, uint32(len(msg)))
+		if _, err := w.Write(size); err != nil {
+			return errors.Wrap(err, "problem writing OTLP message")
+		}
+		_, err := w.Write(msg)
+		return errors.Wrap(err, "problem writing OTLP message")
+	})
+}
+
+// PushOTLP exports the contents of a stream of chunks, as WriteOTLP
+// does, to an OTLP/HTTP endpoint (e.g.
+// "http://localhost:4318/v1/metrics"), with one request for each
+// chunk. If the client is nil, PushOTLP uses http.DefaultClient.
+//
+// Returns an error if the endpoint rejects a request or any of its
+// data points. To push metrics with OTLP/gRPC, build with the grpc
+// build tag and use PushOTLPGRPC.
+func PushOTLP(ctx context.Context, iter *ftdc.ChunkIterator, client *http.Client, endpoint string, opts OTLPOptions) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return exportOTLP(ctx, iter, opts, func(msg []byte) error {
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(msg))
+		if err != nil {
+			return errors.Wrap(err, "problem creating OTLP request")
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		for key, value := range opts.Headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return errors.Wrap(err, "problem sending OTLP request")
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if err != nil {
+			return errors.Wrap(err, "problem reading OTLP response")
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return errors.Errorf("OTLP endpoint responded with status %d: %s", resp.StatusCode, body)
+		}
+
+		return errors.WithStack(checkOTLPResponse(body))
+	})
+}
+
+func exportOTLP(ctx context.Context, iter *ftdc.ChunkIterator, opts OTLPOptions, send func([]byte) error) error {
+	if err := opts.Validate(); err != nil {
+		return errors.Wrap(err, "invalid options")
+	}
+
+	enc := &otlpEncoder{
+		opts:     &opts,
+		counters: map[string]*otlpCounter{},
+		gauges:   map[string]bool{},
+	}
+
+	for iter.Next() {
+		if ctx.Err() != nil {
+			return errors.New("operation aborted")
+		}
+
+		msg, err := enc.chunk(iter.Chunk(), iter.MetricDescriptors())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err = send(msg); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return errors.Wrap(iter.Err(), "problem reading chunks")
+}
+
+// checkOTLPResponse returns an error if an ExportMetricsServiceResponse
+// reports rejected data points.
+func checkOTLPResponse(body []byte) error {
+	fields, err := readProtoFields(body)
+	if err != nil {
+		return errors.Wrap(err, "problem parsing OTLP response")
+	}
+
+	for _, field := range fields {
+		if field.number != 1 || field.wireType != protoBytes {
+			continue
+		}
+
+		partial, err := readProtoFields(field.data)
+		if err != nil {
+			return errors.Wrap(err, "problem parsing OTLP response")
+		}
+
+		var (
+			rejected uint64
+			message  string
+		)
+		for _, f := range partial {
+			switch f.number {
+			case 1:
+				rejected = f.value
+			case 2:
+				message = string(f.data)
+			}
+		}
+		if rejected > 0 {
+			return errors.Errorf("OTLP endpoint rejected %d data points: %s", rejected, message)
+		}
+	}
+
+	return nil
+}
+
+// otlpCounter tracks the start time of a cumulative counter, and its
+// last value, to detect resets.
+type otlpCounter struct {
+	start uint64
+	last  int64
+}
+
+type otlpEncoder struct {
+	opts     *OTLPOptions
+	counters map[string]*otlpCounter
+	// gauges records the metrics without descriptors that the
+	// heuristic has classified as gauges, which remain gauges.
+	gauges map[string]bool
+}
+
+// OTLP message field numbers.
+const (
+	otlpAggregationCumulative = 2
+
+	otlpRequestResourceMetrics = 1
+
+	otlpResourceMetricsResource = 1
+	otlpResourceMetricsScope    = 2
+	otlpResourceAttributes      = 1
+
+	otlpScopeMetricsScope   = 1
+	otlpScopeMetricsMetrics = 2
+	otlpScopeName           = 1
+
+	otlpKeyValueKey    = 1
+	otlpKeyValueValue  = 2
+	otlpAnyValueString = 1
+
+	otlpMetricName        = 1
+	otlpMetricDescription = 2
+	otlpMetricUnit        = 3
+	otlpMetricGauge       = 5
+	otlpMetricSum         = 7
+
+	otlpDataPoints        = 1
+	otlpSumTemporality    = 2
+	otlpSumMonotonic      = 3
+	otlpPointStartTime    = 2
+	otlpPointTime         = 3
+	otlpPointDoubleValue  = 4
+	otlpPointIntegerValue = 6
+)
+
+func (e *otlpEncoder) chunk(chunk *ftdc.Chunk, descriptors map[string]ftdc.MetricDescriptor) ([]byte, error) {
+	timeMetric := lineProtocolTimeMetric(chunk, e.opts.TimeKey)
+	if timeMetric == nil {
+		if e.opts.TimeKey != "" {
+			return nil, errors.Errorf("chunk does not have the date time metric '%s'", e.opts.TimeKey)
+		}
+		return nil, errors.New("chunk does not have a date time metric")
+	}
+
+	times := make([]uint64, len(timeMetric.Values))
+	for idx, ms := range timeMetric.Values {
+		times[idx] = uint64(ms) * uint64(1000000)
+	}
+
+	out := &protoWriter{}
+	out.message(otlpRequestResourceMetrics, func(rm *protoWriter) {
+		rm.message(otlpResourceMetricsResource, func(res *protoWriter) {
+			keys := make([]string, 0, len(e.opts.Resource))
+			for key := range e.opts.Resource {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				res.message(otlpResourceAttributes, func(kv *protoWriter) {
+					kv.str(otlpKeyValueKey, key)
+					kv.message(otlpKeyValueValue, func(v *protoWriter) {
+						v.str(otlpAnyValueString, e.opts.Resource[key])
+					})
+				})
+			}
+		})
+
+		rm.message(otlpResourceMetricsScope, func(sm *protoWriter) {
+			sm.message(otlpScopeMetricsScope, func(scope *protoWriter) {
+				scope.str(otlpScopeName, e.opts.Scope)
+			})
+
+			for idx := range chunk.Metrics {
+				m := &chunk.Metrics[idx]
+				if m == timeMetric {
+					continue
+				}
+
+				sm.message(otlpScopeMetricsMetrics, func(metric *protoWriter) {
+					e.metric(metric, m, descriptors[m.Key()], times)
+				})
+			}
+		})
+	})
+
+	return out.bytes(), nil
+}
+
+func (e *otlpEncoder) metric(w *protoWriter, m *ftdc.Metric, desc ftdc.MetricDescriptor, times []uint64) {
+	key := m.Key()
+	name := key
+	if e.opts.Prefix != "" {
+		name = e.opts.Prefix + "." + key
+	}
+
+	w.str(otlpMetricName, name)
+	if desc.Description != "" {
+		w.str(otlpMetricDescription, desc.Description)
+	}
+	if desc.Unit != "" {
+		w.str(otlpMetricUnit, desc.Unit)
+	}
+
+	if !e.isCounter(m, desc) {
+		w.message(otlpMetricGauge, func(gauge *protoWriter) {
+			for idx, value := range m.Values {
+				gauge.message(otlpDataPoints, func(point *protoWriter) {
+					point.fixed64(otlpPointTime, times[idx])
+					otlpPointValue(point, m.Type(), value)
+				})
+			}
+		})
+		return
+	}
+
+	counter, ok := e.counters[key]
+	if !ok && len(times) > 0 {
+		counter = &otlpCounter{start: times[0]}
+		if len(m.Values) > 0 {
+			counter.last = m.Values[0]
+		}
+		e.counters[key] = counter
+	}
+
+	w.message(otlpMetricSum, func(sum *protoWriter) {
+		for idx, value := range m.Values {
+			if otlpCounterReset(m.Type(), counter.last, value) {
+				counter.start = times[idx]
+			}
+			counter.last = value
+
+			sum.message(otlpDataPoints, func(point *protoWriter) {
+				point.fixed64(otlpPointStartTime, counter.start)
+				point.fixed64(otlpPointTime, times[idx])
+				otlpPointValue(point, m.Type(), value)
+			})
+		}
+		sum.uvarint(otlpSumTemporality, otlpAggregationCumulative)
+		sum.boolean(otlpSumMonotonic, true)
+	})
+}
+
+// isCounter determines whether the metric is exported as a counter,
+// from its descriptor, the Counters option, or the heuristic.
+func (e *otlpEncoder) isCounter(m *ftdc.Metric, desc ftdc.MetricDescriptor) bool {
+	switch desc.Kind {
+	case ftdc.MetricKindCounter:
+		return true
+	case ftdc.MetricKindGauge:
+		return false
+	}
+
+	switch m.Type() {
+	case bsontype.Int32, bsontype.Int64, bsontype.Double:
+	default:
+		return false
+	}
+
+	if e.opts.Counters != nil {
+		return e.opts.Counters.MatchKey(m.Key())
+	}
+
+	if m.Type() == bsontype.Double || e.gauges[m.Key()] {
+		return false
+	}
+
+	previous := int64(math.MinInt64)
+	if counter, ok := e.counters[m.Key()]; ok {
+		previous = counter.last
+	}
+	for _, value := range m.Values {
+		if value < previous {
+			e.gauges[m.Key()] = true
+			delete(e.counters, m.Key())
+			return false
+		}
+		previous = value
+	}
+
+	return true
+}
+
+func otlpCounterReset(t bsontype.Type, previous, current int64) bool {
+	if t == bsontype.Double {
+		return math.Float64frombits(uint64(current)) < math.Float64frombits(uint64(previous))
+	}
+	return current < previous
+}
+
+func otlpPointValue(w *protoWriter, t bsontype.Type, value int64) {
+	if t == bsontype.Double {
+		w.double(otlpPointDoubleValue, math.Float64frombits(uint64(value)))
+		return
+	}
+	w.fixed64(otlpPointIntegerValue, uint64(value))
+}
@@ -0,0 +1,61 @@
+//go:build grpc
+// +build grpc
+
+package export
+
+import (
+	"context"
+
+	"github.com/mongodb/ftdc"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+const otlpExportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+// PushOTLPGRPC exports the contents of a stream of chunks, as WriteOTLP
+// does, to an OTLP/gRPC endpoint (e.g. an OpenTelemetry Collector
+// listening on port 4317), with one Export call for each chunk.
+//
+// Returns an error if the endpoint rejects a call or any of its data
+// points.
+func PushOTLPGRPC(ctx context.Context, iter *ftdc.ChunkIterator, conn grpc.ClientConnInterface, opts OTLPOptions, callOpts ...grpc.CallOption) error {
+	callOpts = append([]grpc.CallOption{grpc.ForceCodec(rawProtoCodec{})}, callOpts...)
+
+	return exportOTLP(ctx, iter, opts, func(msg []byte) error {
+		resp := &rawProtoMessage{}
+		if err := conn.Invoke(ctx, otlpExportMethod, &rawProtoMessage{data: msg}, resp, callOpts...); err != nil {
+			return errors.Wrap(err, "problem exporting OTLP metrics")
+		}
+
+		return errors.WithStack(checkOTLPResponse(resp.data))
+	})
+}
+
+// rawProtoMessage holds an encoded protocol buffer message.
+type rawProtoMessage struct {
+	data []byte
+}
+
+// rawProtoCodec passes encoded messages through, so that the exporter
+// does not depend on generated OTLP types.
+type rawProtoCodec struct{}
+
+func (rawProtoCodec) Name() string { return "proto" }
+
+func (rawProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(*rawProtoMessage)
+	if !ok {
+		return nil, errors.Errorf("cannot marshal %T", v)
+	}
+	return msg.data, nil
+}
+
+func (rawProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(*rawProtoMessage)
+	if !ok {
+		return errors.Errorf("cannot unmarshal into %T", v)
+	}
+	msg.data = append([]byte(nil), data...)
+	return nil
+}
@@ -0,0 +1,288 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type otlpTestPoint struct {
+	start  uint64
+	time   uint64
+	double float64
+	int    int64
+}
+
+type otlpTestMetric struct {
+	name        string
+	description string
+	unit        string
+	sum         bool
+	monotonic   bool
+	points      []otlpTestPoint
+}
+
+type otlpTestRequest struct {
+	resource map[string]string
+	scope    string
+	metrics  map[string]otlpTestMetric
+}
+
+func fieldsOf(t *testing.T, data []byte) []protoField {
+	fields, err := readProtoFields(data)
+	require.NoError(t, err)
+	return fields
+}
+
+func decodeOTLPRequest(t *testing.T, data []byte) otlpTestRequest {
+	out := otlpTestRequest{resource: map[string]string{}, metrics: map[string]otlpTestMetric{}}
+
+	request := fieldsOf(t, data)
+	require.Len(t, request, 1)
+	for _, rm := range fieldsOf(t, request[0].data) {
+		for _, f := range fieldsOf(t, rm.data) {
+			switch {
+			case rm.number == otlpResourceMetricsResource:
+				var key, value string
+				for _, kv := range fieldsOf(t, f.data) {
+					if kv.number == otlpKeyValueKey {
+						key = string(kv.data)
+					} else {
+						value = string(fieldsOf(t, kv.data)[0].data)
+					}
+				}
+				out.resource[key] = value
+			case f.number == otlpScopeMetricsScope:
+				out.scope = string(fieldsOf(t, f.data)[0].data)
+			case f.number == otlpScopeMetricsMetrics:
+				metric := decodeOTLPMetric(t, f.data)
+				out.metrics[metric.name] = metric
+			}
+		}
+	}
+
+	return out
+}
+
+func decodeOTLPMetric(t *testing.T, data []byte) otlpTestMetric {
+	out := otlpTestMetric{}
+	for _, f := range fieldsOf(t, data) {
+		switch f.number {
+		case otlpMetricName:
+			out.name = string(f.data)
+		case otlpMetricDescription:
+			out.description = string(f.data)
+		case otlpMetricUnit:
+			out.unit = string(f.data)
+		case otlpMetricGauge, otlpMetricSum:
+			out.sum = f.number == otlpMetricSum
+			for _, df := range fieldsOf(t, f.data) {
+				switch df.number {
+				case otlpDataPoints:
+					point := otlpTestPoint{}
+					for _, pf := range fieldsOf(t, df.data) {
+						switch pf.number {
+						case otlpPointStartTime:
+							point.start = pf.value
+						case otlpPointTime:
+							point.time = pf.value
+						case otlpPointDoubleValue:
+							point.double = math.Float64frombits(pf.value)
+						case otlpPointIntegerValue:
+							point.int = int64(pf.value)
+						}
+					}
+					out.points = append(out.points, point)
+				case otlpSumTemporality:
+					assert.EqualValues(t, otlpAggregationCumulative, df.value)
+				case otlpSumMonotonic:
+					out.monotonic = df.value == 1
+				}
+			}
+		}
+	}
+	return out
+}
+
+func TestWriteOTLP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	buf := &bytes.Buffer{}
+	// doubles are only exact with the float preserving encoding.
+	collector := ftdc.NewDescriptorCollector(ftdc.NewFloatPreservingCollector(100))
+	require.NoError(t, collector.Describe("ops", ftdc.MetricDescriptor{Kind: ftdc.MetricKindCounter, Description: "operations"}))
+	require.NoError(t, collector.Describe("mem.resident", ftdc.MetricDescriptor{Kind: ftdc.MetricKindGauge, Unit: "bytes"}))
+	for i := 0; i < 10; i++ {
+		ops := int64(i * 10)
+		if i >= 7 {
+			// the process restarted.
+			ops = int64(i - 7)
+		}
+		conns := int64(5)
+		if i == 8 {
+			conns = 4
+		}
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("ops", ops),
+			bsonx.EC.Int64("total", int64(i)),
+			bsonx.EC.Int64("conns", conns),
+			bsonx.EC.Double("ratio", float64(i)/2),
+			bsonx.EC.SubDocumentFromElements("mem", bsonx.EC.Int64("resident", int64(100-i))),
+		)))
+		if i == 4 {
+			require.NoError(t, ftdc.FlushCollector(collector, buf))
+		}
+	}
+	require.NoError(t, ftdc.FlushCollector(collector, buf))
+	data := buf.Bytes()
+
+	write := func(t *testing.T, opts OTLPOptions) []otlpTestRequest {
+		out := &bytes.Buffer{}
+		iter := ftdc.ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		require.NoError(t, WriteOTLP(ctx, iter, out, opts))
+
+		requests := []otlpTestRequest{}
+		for raw := out.Bytes(); len(raw) > 0; {
+			require.True(t, len(raw) >= 4)
+			size := int(binary.BigEndian.Uint32(raw))
+			require.True(t, len(raw) >= 4+size)
+			requests = append(requests, decodeOTLPRequest(t, raw[4:4+size]))
+			raw = raw[4+size:]
+		}
+		return requests
+	}
+	nanos := func(i int) uint64 { return uint64(base.Add(time.Duration(i) * time.Second).UnixNano()) }
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		err := WriteOTLP(ctx, ftdc.ReadChunks(ctx, bytes.NewReader(data)), &bytes.Buffer{}, OTLPOptions{Resource: map[string]string{"": "a"}})
+		assert.Error(t, err)
+	})
+	t.Run("MissingTimeKey", func(t *testing.T) {
+		err := WriteOTLP(ctx, ftdc.ReadChunks(ctx, bytes.NewReader(data)), &bytes.Buffer{}, OTLPOptions{TimeKey: "missing"})
+		assert.Error(t, err)
+	})
+	t.Run("Defaults", func(t *testing.T) {
+		requests := write(t, OTLPOptions{Resource: map[string]string{"service.name": "mongod"}})
+		require.Len(t, requests, 2)
+
+		first := requests[0]
+		assert.Equal(t, map[string]string{"service.name": "mongod"}, first.resource)
+		assert.Equal(t, DefaultOTLPScope, first.scope)
+		assert.Len(t, first.metrics, 5, "the time metric is not exported")
+
+		ops := first.metrics["ops"]
+		assert.True(t, ops.sum)
+		assert.True(t, ops.monotonic)
+		assert.Equal(t, "operations", ops.description)
+		require.Len(t, ops.points, 5)
+		for i, point := range ops.points {
+			assert.Equal(t, nanos(0), point.start)
+			assert.Equal(t, nanos(i), point.time)
+			assert.EqualValues(t, i*10, point.int)
+		}
+
+		resident := first.metrics["mem.resident"]
+		assert.False(t, resident.sum, "descriptors take precedence over the heuristic")
+		assert.Equal(t, "bytes", resident.unit)
+		assert.EqualValues(t, 100, resident.points[0].int)
+		assert.Zero(t, resident.points[0].start)
+
+		assert.True(t, first.metrics["total"].sum)
+		assert.True(t, first.metrics["conns"].sum, "constant integers are counters")
+		ratio := first.metrics["ratio"]
+		assert.False(t, ratio.sum, "doubles are gauges")
+		assert.Equal(t, 2.0, ratio.points[4].double)
+
+		second := requests[1]
+		ops = second.metrics["ops"]
+		require.Len(t, ops.points, 5)
+		assert.Equal(t, nanos(0), ops.points[0].start, "counters are cumulative across chunks")
+		assert.Equal(t, nanos(7), ops.points[2].start, "counters restart when they decrease")
+		assert.Equal(t, nanos(7), ops.points[4].start)
+		assert.EqualValues(t, 2, ops.points[4].int)
+
+		assert.Equal(t, nanos(0), second.metrics["total"].points[4].start)
+		assert.False(t, second.metrics["conns"].sum, "integers that decrease are gauges")
+	})
+	t.Run("Counters", func(t *testing.T) {
+		requests := write(t, OTLPOptions{
+			Prefix:   "mongod",
+			Scope:    "test",
+			Counters: ftdc.KeyMatcherFunc(func(key string) bool { return key == "ratio" }),
+		})
+		require.Len(t, requests, 2)
+		for _, request := range requests {
+			assert.Equal(t, "test", request.scope)
+			assert.True(t, request.metrics["mongod.ratio"].sum)
+			assert.False(t, request.metrics["mongod.total"].sum)
+			assert.True(t, request.metrics["mongod.ops"].sum)
+		}
+	})
+	t.Run("Aborted", func(t *testing.T) {
+		cctx, ccancel := context.WithCancel(ctx)
+		ccancel()
+		err := WriteOTLP(cctx, ftdc.ReadChunks(ctx, bytes.NewReader(data)), &bytes.Buffer{}, OTLPOptions{})
+		assert.Error(t, err)
+	})
+	t.Run("Push", func(t *testing.T) {
+		var (
+			bodies  [][]byte
+			headers []string
+		)
+		response := []byte{}
+		status := http.StatusOK
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			bodies = append(bodies, body)
+			headers = append(headers, r.Header.Get("Authorization"))
+			assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+
+			w.WriteHeader(status)
+			_, _ = w.Write(response)
+		}))
+		defer server.Close()
+
+		push := func() error {
+			iter := ftdc.ReadChunks(ctx, bytes.NewReader(data))
+			defer iter.Close()
+			return PushOTLP(ctx, iter, server.Client(), server.URL+"/v1/metrics", OTLPOptions{
+				Headers: map[string]string{"Authorization": "token"},
+			})
+		}
+
+		require.NoError(t, push())
+		require.Len(t, bodies, 2)
+		assert.Equal(t, []string{"token", "token"}, headers)
+		assert.Len(t, decodeOTLPRequest(t, bodies[1]).metrics, 5)
+
+		partial := &protoWriter{}
+		partial.message(1, func(w *protoWriter) {
+			w.uvarint(1, 3)
+			w.str(2, "invalid points")
+		})
+		response = partial.bytes()
+		err := push()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid points")
+
+		response = []byte{}
+		status = http.StatusBadRequest
+		assert.Error(t, push())
+	})
+}
@@ -0,0 +1,402 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// ParquetCompression describes the codec used to compress the data
+// pages in a parquet file.
+type ParquetCompression int
+
+const (
+	// ParquetCompressionNone writes uncompressed data pages.
+	ParquetCompressionNone ParquetCompression = iota
+	// ParquetCompressionGzip compresses data pages with gzip.
+	ParquetCompressionGzip
+)
+
+// DefaultParquetRowGroupSize is the number of samples written to each
+// row group of a parquet file when the options do not specify a row
+// group size.
+const DefaultParquetRowGroupSize = 64 * 1024
+
+// ParquetOptions configures the output of WriteParquet.
+type ParquetOptions struct {
+	// RowGroupSize is the maximum number of samples in each row
+	// group. Larger row groups compress better but use more
+	// memory while writing. Defaults to
+	// DefaultParquetRowGroupSize.
+	RowGroupSize int
+	// Compression sets the codec used for the data pages.
+	Compression ParquetCompression
+}
+
+// Validate ensures that the options are reasonable, and sets default
+// values.
+func (opts *ParquetOptions) Validate() error {
+	if opts.RowGroupSize < 0 {
+		return errors.New("row group size must not be negative")
+	}
+	if opts.RowGroupSize == 0 {
+		opts.RowGroupSize = DefaultParquetRowGroupSize
+	}
+
+	switch opts.Compression {
+	case ParquetCompressionNone, ParquetCompressionGzip:
+	default:
+		return errors.Errorf("invalid parquet compression '%d'", opts.Compression)
+	}
+
+	return nil
+}
+
+// WriteParquet exports the contents of a stream of chunks as a
+// parquet file, with one row per sample and one column per metric,
+// named by the metric's flattened key. Column types follow the types
+// of the original values: int32, int64, double, and boolean values
+// map to the equivalent parquet types, date time values are written
+// as int64 millisecond timestamps, and timestamp values are written
+// as two int64 columns.
+//
+// As with WriteCSV, returns an error if the metrics change between
+// chunks, or if there are any errors writing data.
+func WriteParquet(ctx context.Context, iter *ftdc.ChunkIterator, w io.Writer, opts ParquetOptions) error {
+	if err := opts.Validate(); err != nil {
+		return errors.Wrap(err, "invalid options")
+	}
+
+	pw := &parquetWriter{
+		writer: w,
+		opts:   opts,
+	}
+
+	if err := pw.write([]byte(parquetMagic)); err != nil {
+		return errors.Wrap(err, "problem writing parquet header")
+	}
+
+	for iter.Next() {
+		if ctx.Err() != nil {
+			return errors.New("operation aborted")
+		}
+
+		if err := pw.addChunk(iter.Chunk()); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return errors.Wrap(err, "problem reading chunks")
+	}
+
+	if err := pw.flushRowGroup(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.Wrap(pw.writeFooter(), "problem writing parquet footer")
+}
+
+const parquetMagic = "PAR1"
+
+// parquet physical types, converted types, and other enum values
+// from the parquet format specification.
+const (
+	parquetBoolean = 0
+	parquetInt32   = 1
+	parquetInt64   = 2
+	parquetDouble  = 5
+
+	parquetConvertedTimestampMillis = 9
+
+	parquetRepetitionRequired = 0
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+
+	parquetCodecUncompressed = 0
+	parquetCodecGzip         = 2
+
+	parquetPageTypeData = 0
+)
+
+type parquetColumn struct {
+	name      string
+	btype     bsontype.Type
+	physical  int32
+	converted int32
+	values    []int64
+}
+
+type parquetColumnChunk struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+}
+
+type parquetRowGroup struct {
+	numRows int64
+	size    int64
+	columns []parquetColumnChunk
+}
+
+type parquetWriter struct {
+	writer    io.Writer
+	opts      ParquetOptions
+	offset    int64
+	schema    bool
+	columns   []*parquetColumn
+	rows      int
+	numRows   int64
+	rowGroups []parquetRowGroup
+}
+
+func (pw *parquetWriter) write(data []byte) error {
+	n, err := pw.writer.Write(data)
+	pw.offset += int64(n)
+	if err == nil && n != len(data) {
+		err = io.ErrShortWrite
+	}
+
+	return errors.WithStack(err)
+}
+
+func (pw *parquetWriter) setSchema(chunk *ftdc.Chunk) error {
+	pw.schema = true
+	pw.columns = make([]*parquetColumn, len(chunk.Metrics))
+	for idx := range chunk.Metrics {
+		m := &chunk.Metrics[idx]
+		col := &parquetColumn{
+			name:      m.Key(),
+			btype:     m.Type(),
+			converted: -1,
+			values:    make([]int64, 0, pw.opts.RowGroupSize),
+		}
+
+		switch m.Type() {
+		case bsontype.Boolean:
+			col.physical = parquetBoolean
+		case bsontype.Int32:
+			col.physical = parquetInt32
+		case bsontype.Int64, bsontype.Timestamp:
+			col.physical = parquetInt64
+		case bsontype.DateTime:
+			col.physical = parquetInt64
+			col.converted = parquetConvertedTimestampMillis
+		case bsontype.Double:
+			col.physical = parquetDouble
+		default:
+			return errors.Errorf("metric '%s' has unsupported type %s", col.name, m.Type())
+		}
+
+		pw.columns[idx] = col
+	}
+
+	return nil
+}
+
+func (pw *parquetWriter) addChunk(chunk *ftdc.Chunk) error {
+	if !pw.schema {
+		if err := pw.setSchema(chunk); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if len(chunk.Metrics) != len(pw.columns) {
+		return errors.New("unexpected schema change detected")
+	}
+	for idx := range chunk.Metrics {
+		m := &chunk.Metrics[idx]
+		if m.Key() != pw.columns[idx].name || m.Type() != pw.columns[idx].btype {
+			return errors.New("unexpected schema change detected")
+		}
+	}
+
+	for start := 0; start < chunk.Size(); {
+		end := start + pw.opts.RowGroupSize - pw.rows
+		if end > chunk.Size() {
+			end = chunk.Size()
+		}
+
+		for idx, col := range pw.columns {
+			col.values = append(col.values, chunk.Metrics[idx].Values[start:end]...)
+		}
+		pw.rows += end - start
+		start = end
+
+		if pw.rows >= pw.opts.RowGroupSize {
+			if err := pw.flushRowGroup(); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (pw *parquetWriter) flushRowGroup() error {
+	if pw.rows == 0 {
+		return nil
+	}
+
+	rg := parquetRowGroup{
+		numRows: int64(pw.rows),
+		columns: make([]parquetColumnChunk, len(pw.columns)),
+	}
+
+	for idx, col := range pw.columns {
+		cc, err := pw.writeColumnChunk(col)
+		if err != nil {
+			return errors.Wrapf(err, "problem writing column '%s'", col.name)
+		}
+		rg.columns[idx] = cc
+		rg.size += cc.uncompressed
+		col.values = col.values[:0]
+	}
+
+	pw.rowGroups = append(pw.rowGroups, rg)
+	pw.numRows += int64(pw.rows)
+	pw.rows = 0
+
+	return nil
+}
+
+// writeColumnChunk writes the buffered values of a column as a single
+// plain-encoded data page. All columns are required, so the page does
+// not have repetition or definition levels.
+func (pw *parquetWriter) writeColumnChunk(col *parquetColumn) (parquetColumnChunk, error) {
+	data := encodePlain(col)
+	page := data
+
+	if pw.opts.Compression == ParquetCompressionGzip {
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		if _, err := gz.Write(data); err != nil {
+			return parquetColumnChunk{}, errors.Wrap(err, "problem compressing page")
+		}
+		if err := gz.Close(); err != nil {
+			return parquetColumnChunk{}, errors.Wrap(err, "problem compressing page")
+		}
+		page = buf.Bytes()
+	}
+
+	header := &thriftWriter{}
+	header.structBegin()
+	header.i32Field(1, parquetPageTypeData)
+	header.i32Field(2, int32(len(data)))
+	header.i32Field(3, int32(len(page)))
+	header.structField(5, func() {
+		header.i32Field(1, int32(len(col.values)))
+		header.i32Field(2, parquetEncodingPlain)
+		header.i32Field(3, parquetEncodingRLE)
+		header.i32Field(4, parquetEncodingRLE)
+	})
+	header.structEnd()
+
+	cc := parquetColumnChunk{
+		offset:       pw.offset,
+		uncompressed: int64(len(header.bytes()) + len(data)),
+		compressed:   int64(len(header.bytes()) + len(page)),
+	}
+
+	if err := pw.write(header.bytes()); err != nil {
+		return cc, errors.Wrap(err, "problem writing page header")
+	}
+	if err := pw.write(page); err != nil {
+		return cc, errors.Wrap(err, "problem writing page")
+	}
+
+	return cc, nil
+}
+
+func encodePlain(col *parquetColumn) []byte {
+	switch col.physical {
+	case parquetBoolean:
+		out := make([]byte, (len(col.values)+7)/8)
+		for idx, v := range col.values {
+			if v != 0 {
+				out[idx/8] |= 1 << uint(idx%8)
+			}
+		}
+		return out
+	case parquetInt32:
+		out := make([]byte, 4*len(col.values))
+		for idx, v := range col.values {
+			binary.LittleEndian.PutUint32(out[4*idx:], uint32(int32(v)))
+		}
+		return out
+	default:
+		// int64 values and doubles, which are stored as the
+		// binary representation of the float.
+		out := make([]byte, 8*len(col.values))
+		for idx, v := range col.values {
+			binary.LittleEndian.PutUint64(out[8*idx:], uint64(v))
+		}
+		return out
+	}
+}
+
+func (pw *parquetWriter) writeFooter() error {
+	codec := int32(parquetCodecUncompressed)
+	if pw.opts.Compression == ParquetCompressionGzip {
+		codec = parquetCodecGzip
+	}
+
+	meta := &thriftWriter{}
+	meta.structBegin()
+	meta.i32Field(1, 1)
+	meta.structListField(2, len(pw.columns)+1, func(idx int) {
+		if idx == 0 {
+			meta.stringField(4, "schema")
+			meta.i32Field(5, int32(len(pw.columns)))
+			return
+		}
+
+		col := pw.columns[idx-1]
+		meta.i32Field(1, col.physical)
+		meta.i32Field(3, parquetRepetitionRequired)
+		meta.stringField(4, col.name)
+		if col.converted >= 0 {
+			meta.i32Field(6, col.converted)
+		}
+	})
+	meta.i64Field(3, pw.numRows)
+	meta.structListField(4, len(pw.rowGroups), func(idx int) {
+		rg := pw.rowGroups[idx]
+		meta.structListField(1, len(rg.columns), func(cidx int) {
+			cc := rg.columns[cidx]
+			col := pw.columns[cidx]
+			meta.i64Field(2, cc.offset)
+			meta.structField(3, func() {
+				meta.i32Field(1, col.physical)
+				meta.i32ListField(2, parquetEncodingPlain, parquetEncodingRLE)
+				meta.stringListField(3, col.name)
+				meta.i32Field(4, codec)
+				meta.i64Field(5, rg.numRows)
+				meta.i64Field(6, cc.uncompressed)
+				meta.i64Field(7, cc.compressed)
+				meta.i64Field(9, cc.offset)
+			})
+		})
+		meta.i64Field(2, rg.size)
+		meta.i64Field(3, rg.numRows)
+	})
+	meta.stringField(6, "github.com/mongodb/ftdc")
+	meta.structEnd()
+
+	if err := pw.write(meta.bytes()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	trailer := make([]byte, 4, 4+len(parquetMagic))
+	binary.LittleEndian.PutUint32(trailer, uint32(len(meta.bytes())))
+	trailer = append(trailer, parquetMagic...)
+
+	return errors.WithStack(pw.write(trailer))
+}
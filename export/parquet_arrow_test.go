@@ -0,0 +1,125 @@
+//go:build arrow
+// +build arrow
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteParquetArrowReader reads the writer's output back with the
+// reference arrow parquet implementation, rather than the thrift
+// helpers in parquet_test.go, to check that the files are readable by
+// other tools.
+func TestWriteParquetArrowReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	data := makeChunks(t, 25, func(i int) *bsonx.Document {
+		return bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("counter", int64(i*1000)),
+			bsonx.EC.Int32("gauge", int32(-i)),
+			bsonx.EC.Boolean("flag", i%3 == 0),
+			bsonx.EC.Double("ratio", float64(i)/4),
+			bsonx.EC.SubDocument("sub", bsonx.NewDocument(bsonx.EC.Int64("value", int64(i)))),
+		)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, WriteParquet(ctx, ftdc.ReadChunks(ctx, &bytes.Buffer{}), out, ParquetOptions{}))
+
+		rdr, err := file.NewParquetReader(bytes.NewReader(out.Bytes()))
+		require.NoError(t, err)
+		defer rdr.Close()
+		assert.EqualValues(t, 0, rdr.NumRows())
+		assert.Equal(t, 0, rdr.NumRowGroups())
+	})
+	for name, opts := range map[string]ParquetOptions{
+		"Defaults":        {},
+		"SmallRowGroups":  {RowGroupSize: 7},
+		"Gzip":            {Compression: ParquetCompressionGzip},
+		"GzipSmallGroups": {RowGroupSize: 4, Compression: ParquetCompressionGzip},
+	} {
+		t.Run(name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			require.NoError(t, WriteParquet(ctx, ftdc.ReadChunks(ctx, bytes.NewBuffer(data)), out, opts))
+			require.NoError(t, opts.Validate())
+
+			rdr, err := file.NewParquetReader(bytes.NewReader(out.Bytes()))
+			require.NoError(t, err)
+			defer rdr.Close()
+			assert.EqualValues(t, 25, rdr.NumRows())
+			assert.Equal(t, (25+opts.RowGroupSize-1)/opts.RowGroupSize, rdr.NumRowGroups())
+
+			fr, err := pqarrow.NewFileReader(rdr, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+			require.NoError(t, err)
+			table, err := fr.ReadTable(ctx)
+			require.NoError(t, err)
+			defer table.Release()
+
+			names := []string{}
+			for _, field := range table.Schema().Fields() {
+				names = append(names, field.Name)
+			}
+			require.Equal(t, []string{"ts", "counter", "gauge", "flag", "ratio", "sub.value"}, names)
+			assert.Equal(t, arrow.FixedWidthTypes.Timestamp_ms.ID(), table.Schema().Field(0).Type.ID())
+
+			expected := make([][]int64, len(names))
+			iter := ftdc.ReadChunks(ctx, bytes.NewBuffer(data))
+			for iter.Next() {
+				for idx, m := range iter.Chunk().Metrics {
+					expected[idx] = append(expected[idx], m.Values...)
+				}
+			}
+			iter.Close()
+			require.NoError(t, iter.Err())
+
+			for idx := range names {
+				values := []int64{}
+				for _, chunk := range table.Column(idx).Data().Chunks() {
+					for i := 0; i < chunk.Len(); i++ {
+						switch arr := chunk.(type) {
+						case *array.Timestamp:
+							values = append(values, int64(arr.Value(i)))
+						case *array.Int64:
+							values = append(values, arr.Value(i))
+						case *array.Int32:
+							values = append(values, int64(arr.Value(i)))
+						case *array.Boolean:
+							if arr.Value(i) {
+								values = append(values, 1)
+							} else {
+								values = append(values, 0)
+							}
+						case *array.Float64:
+							values = append(values, int64(math.Float64bits(arr.Value(i))))
+						default:
+							t.Fatalf("unexpected column type %T", chunk)
+						}
+					}
+				}
+				assert.Equal(t, expected[idx], values, names[idx])
+			}
+
+			ts := table.Column(0).Data().Chunk(0).(*array.Timestamp)
+			assert.True(t, base.Equal(ts.Value(0).ToTime(arrow.Millisecond)))
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeChunks(t *testing.T, num int, doc func(int) *bsonx.Document) []byte {
+	buf := &bytes.Buffer{}
+	collector := ftdc.NewStreamingCollector(10, buf)
+	for i := 0; i < num; i++ {
+		require.NoError(t, collector.Add(doc(i)))
+	}
+	require.NoError(t, ftdc.FlushCollector(collector, buf))
+
+	return buf.Bytes()
+}
+
+// thriftReader decodes the thrift compact protocol into generic
+// maps, keyed by field id, to inspect the parquet metadata.
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftBoolTrue, thriftBoolFalse:
+		return typ == thriftBoolTrue
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := int(r.uvarint())
+		r.pos += n
+		return string(r.buf[r.pos-n : r.pos])
+	case thriftList:
+		header := r.buf[r.pos]
+		r.pos++
+		size, elemType := int(header>>4), header&0xf
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		out := make([]interface{}, size)
+		for i := range out {
+			out[i] = r.value(elemType)
+		}
+		return out
+	case thriftStruct:
+		return r.readStruct()
+	default:
+		panic("unsupported thrift type")
+	}
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	out := map[int16]interface{}{}
+	var last int16
+	for {
+		header := r.buf[r.pos]
+		r.pos++
+		if header == 0 {
+			return out
+		}
+
+		if delta := int16(header >> 4); delta != 0 {
+			last += delta
+		} else {
+			last = int16(r.varint())
+		}
+		out[last] = r.value(header & 0xf)
+	}
+}
+
+func readFooter(t *testing.T, data []byte) map[int16]interface{} {
+	require.True(t, len(data) > 12)
+	require.Equal(t, parquetMagic, string(data[:4]))
+	require.Equal(t, parquetMagic, string(data[len(data)-4:]))
+
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	r := &thriftReader{buf: data, pos: len(data) - 8 - size}
+	meta := r.readStruct()
+	require.Equal(t, len(data)-8, r.pos)
+
+	return meta
+}
+
+func TestWriteParquet(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	data := makeChunks(t, 25, func(i int) *bsonx.Document {
+		return bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("counter", int64(i*1000)),
+			bsonx.EC.Int32("gauge", int32(-i)),
+			bsonx.EC.Boolean("flag", i%3 == 0),
+			bsonx.EC.SubDocument("sub", bsonx.NewDocument(bsonx.EC.Int64("value", int64(i)))),
+		)
+	})
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for _, opts := range []ParquetOptions{{RowGroupSize: -1}, {Compression: 42}} {
+			err := WriteParquet(ctx, ftdc.ReadChunks(ctx, bytes.NewBuffer(data)), &bytes.Buffer{}, opts)
+			assert.Error(t, err)
+		}
+	})
+	t.Run("Empty", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, WriteParquet(ctx, ftdc.ReadChunks(ctx, &bytes.Buffer{}), out, ParquetOptions{}))
+
+		meta := readFooter(t, out.Bytes())
+		assert.EqualValues(t, 0, meta[3])
+		assert.Len(t, meta[2], 1)
+	})
+	t.Run("SchemaChange", func(t *testing.T) {
+		other := makeChunks(t, 10, func(i int) *bsonx.Document {
+			return bsonx.NewDocument(bsonx.EC.Int64("other", int64(i)))
+		})
+
+		iter := ftdc.ReadChunks(ctx, bytes.NewBuffer(append(append([]byte{}, data...), other...)))
+		defer iter.Close()
+		err := WriteParquet(ctx, iter, &bytes.Buffer{}, ParquetOptions{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "schema change")
+	})
+	for name, opts := range map[string]ParquetOptions{
+		"Defaults":         {},
+		"SmallRowGroups":   {RowGroupSize: 7},
+		"Gzip":             {Compression: ParquetCompressionGzip},
+		"GzipSmallGroups":  {RowGroupSize: 4, Compression: ParquetCompressionGzip},
+		"ChunkSizedGroups": {RowGroupSize: 10},
+	} {
+		t.Run(name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			require.NoError(t, WriteParquet(ctx, ftdc.ReadChunks(ctx, bytes.NewBuffer(data)), out, opts))
+			require.NoError(t, opts.Validate())
+
+			meta := readFooter(t, out.Bytes())
+			assert.EqualValues(t, 25, meta[3])
+
+			schema := meta[2].([]interface{})
+			require.Len(t, schema, 6)
+			assert.EqualValues(t, 5, schema[0].(map[int16]interface{})[5])
+			names := []string{}
+			for _, elem := range schema[1:] {
+				names = append(names, elem.(map[int16]interface{})[4].(string))
+			}
+			assert.Equal(t, []string{"ts", "counter", "gauge", "flag", "sub.value"}, names)
+			assert.EqualValues(t, parquetConvertedTimestampMillis, schema[1].(map[int16]interface{})[6])
+
+			rowGroups := meta[4].([]interface{})
+			assert.Len(t, rowGroups, (25+opts.RowGroupSize-1)/opts.RowGroupSize)
+
+			// read back the counter column and check its values
+			counters := []int64{}
+			for _, rg := range rowGroups {
+				column := rg.(map[int16]interface{})[1].([]interface{})[1].(map[int16]interface{})
+				colMeta := column[3].(map[int16]interface{})
+				assert.Equal(t, []interface{}{"counter"}, colMeta[3])
+
+				r := &thriftReader{buf: out.Bytes(), pos: int(colMeta[9].(int64))}
+				header := r.readStruct()
+				page := out.Bytes()[r.pos : r.pos+int(header[3].(int64))]
+				if opts.Compression == ParquetCompressionGzip {
+					gz, err := gzip.NewReader(bytes.NewReader(page))
+					require.NoError(t, err)
+					page, err = ioutil.ReadAll(gz)
+					require.NoError(t, err)
+				}
+				require.Len(t, page, int(header[2].(int64)))
+
+				for i := 0; i < len(page); i += 8 {
+					counters = append(counters, int64(binary.LittleEndian.Uint64(page[i:])))
+				}
+			}
+
+			require.Len(t, counters, 25)
+			for idx, v := range counters {
+				assert.EqualValues(t, idx*1000, v)
+			}
+		})
+	}
+}
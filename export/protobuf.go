@@ -0,0 +1,128 @@
+package export
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// protocol buffer wire types.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// protoWriter is a minimal encoder for the protocol buffer wire
+// format, with support for the subset of the format required to write
+// OTLP metrics. Embedded messages are encoded into a separate writer
+// and appended with their length.
+type protoWriter struct {
+	buf []byte
+}
+
+func (w *protoWriter) bytes() []byte { return w.buf }
+
+func (w *protoWriter) reset() { w.buf = w.buf[:0] }
+
+func (w *protoWriter) tag(field int, wireType int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field)<<3|uint64(wireType))
+}
+
+func (w *protoWriter) uvarint(field int, v uint64) {
+	w.tag(field, protoVarint)
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *protoWriter) boolean(field int, v bool) {
+	if v {
+		w.uvarint(field, 1)
+	} else {
+		w.uvarint(field, 0)
+	}
+}
+
+func (w *protoWriter) fixed64(field int, v uint64) {
+	w.tag(field, protoFixed64)
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, v)
+}
+
+func (w *protoWriter) double(field int, v float64) { w.fixed64(field, math.Float64bits(v)) }
+
+func (w *protoWriter) data(field int, v []byte) {
+	w.tag(field, protoBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+func (w *protoWriter) str(field int, v string) {
+	w.tag(field, protoBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+// message appends an embedded message, which the function writes.
+func (w *protoWriter) message(field int, fn func(*protoWriter)) {
+	child := &protoWriter{}
+	fn(child)
+	w.data(field, child.buf)
+}
+
+// protoField is a single field of an encoded message, as read by
+// readProtoFields. Varint and fixed values are stored in value, and
+// length delimited values in data.
+type protoField struct {
+	number   int
+	wireType int
+	value    uint64
+	data     []byte
+}
+
+// readProtoFields decodes the fields of a message, without
+// interpreting their values.
+func readProtoFields(buf []byte) ([]protoField, error) {
+	out := []protoField{}
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errors.New("invalid field key")
+		}
+		buf = buf[n:]
+
+		field := protoField{number: int(key >> 3), wireType: int(key & 7)}
+		switch field.wireType {
+		case protoVarint:
+			if field.value, n = binary.Uvarint(buf); n <= 0 {
+				return nil, errors.Errorf("invalid varint for field %d", field.number)
+			}
+			buf = buf[n:]
+		case protoFixed64:
+			if len(buf) < 8 {
+				return nil, errors.Errorf("truncated field %d", field.number)
+			}
+			field.value = binary.LittleEndian.Uint64(buf)
+			buf = buf[8:]
+		case protoFixed32:
+			if len(buf) < 4 {
+				return nil, errors.Errorf("truncated field %d", field.number)
+			}
+			field.value = uint64(binary.LittleEndian.Uint32(buf))
+			buf = buf[4:]
+		case protoBytes:
+			size, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < size {
+				return nil, errors.Errorf("truncated field %d", field.number)
+			}
+			field.data = buf[n : n+int(size)]
+			buf = buf[n+int(size):]
+		default:
+			return nil, errors.Errorf("unsupported wire type %d for field %d", field.wireType, field.number)
+		}
+
+		out = append(out, field)
+	}
+
+	return out, nil
+}
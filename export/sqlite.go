@@ -0,0 +1,260 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SQLiteTimeColumn is the name of the column that holds the
+	// time of each sample, in milliseconds since the Unix epoch,
+	// in the tables written by WriteSQLite.
+	SQLiteTimeColumn = "timestamp"
+
+	// sqliteMaxColumns is the default limit on the number of
+	// columns of a table (i.e. SQLITE_MAX_COLUMN).
+	sqliteMaxColumns = 2000
+)
+
+// WriteSQLite exports the contents of a stream of chunks as a SQLite
+// database file at the path, replacing the file if it exists. Each
+// schema (see Chunk.SchemaHash) has a table, named "metrics_<hash>",
+// with one row per sample, and one column per metric, named by the
+// metric's flattened key, in addition to the SQLiteTimeColumn, which
+// is indexed. The time of each sample is the value of the first date
+// time metric of its chunk, and the values of date time metrics are
+// written as milliseconds since the Unix epoch, so that samples can
+// be queried as:
+//
+//	SELECT datetime(timestamp / 1000, 'unixepoch'), "opcounters.insert"
+//	FROM metrics_<hash> ORDER BY timestamp
+//
+// Schemas with more metrics than fit in a SQLite table are split
+// between several tables, named "metrics_<hash>_2", and so on, which
+// share the rowids of their samples. Metric keys that differ only in
+// case, which SQLite does not distinguish, have a numeric suffix.
+//
+// Returns an error, and removes the file, if a chunk does not have a
+// date time metric, or if there are any errors reading chunks or
+// writing the file.
+func WriteSQLite(ctx context.Context, iter *ftdc.ChunkIterator, path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening file %s", path)
+	}
+
+	err = writeSQLite(ctx, iter, newSQLiteWriter(file))
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = errors.Wrapf(closeErr, "problem closing file %s", path)
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+type sqliteTable struct {
+	name    string
+	metrics []int
+	columns []string
+	types   []string
+	tree    *sqliteTableTree
+}
+
+type sqliteSchema struct {
+	hash    string
+	metrics int
+	tables  []*sqliteTable
+	times   []int64
+}
+
+func writeSQLite(ctx context.Context, iter *ftdc.ChunkIterator, w *sqliteWriter) error {
+	schemas := map[string]*sqliteSchema{}
+	order := []*sqliteSchema{}
+
+	for iter.Next() {
+		if ctx.Err() != nil {
+			return errors.New("operation aborted")
+		}
+
+		chunk := iter.Chunk()
+		hash := chunk.SchemaHash()
+		schema, ok := schemas[hash]
+		if !ok {
+			schema = newSQLiteSchema(w, hash, chunk)
+			schemas[hash] = schema
+			order = append(order, schema)
+		}
+
+		if err := schema.addChunk(chunk); err != nil {
+			return errors.Wrapf(err, "problem writing chunk %s", chunk.ID())
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return errors.Wrap(err, "problem reading chunks")
+	}
+
+	catalog := newSQLiteTableTree(w)
+	var rowid int64
+	for _, schema := range order {
+		keys := schema.indexKeys()
+		for _, table := range schema.tables {
+			root, err := table.tree.close(0)
+			if err != nil {
+				return errors.Wrapf(err, "problem writing table %s", table.name)
+			}
+			index, err := writeSQLiteIndex(w, keys)
+			if err != nil {
+				return errors.Wrapf(err, "problem writing index for table %s", table.name)
+			}
+
+			indexName := table.name + "_" + SQLiteTimeColumn
+			for _, entry := range [][]sqliteValue{
+				{sqliteText("table"), sqliteText(table.name), sqliteText(table.name), sqliteInt(int64(root)), sqliteText(table.createSQL())},
+				{sqliteText("index"), sqliteText(indexName), sqliteText(table.name), sqliteInt(int64(index)),
+					sqliteText(fmt.Sprintf("CREATE INDEX %s ON %s (%s)", sqliteQuote(indexName), sqliteQuote(table.name), sqliteQuote(SQLiteTimeColumn)))},
+			} {
+				rowid++
+				if err := catalog.add(rowid, appendSQLiteRecord(nil, entry...)); err != nil {
+					return errors.Wrap(err, "problem writing schema table")
+				}
+			}
+		}
+	}
+
+	if _, err := catalog.close(1); err != nil {
+		return errors.Wrap(err, "problem writing schema table")
+	}
+
+	return errors.WithStack(w.writeHeader())
+}
+
+func newSQLiteSchema(w *sqliteWriter, hash string, chunk *ftdc.Chunk) *sqliteSchema {
+	schema := &sqliteSchema{hash: hash, metrics: len(chunk.Metrics)}
+
+	var table *sqliteTable
+	var names map[string]bool
+	for idx := range chunk.Metrics {
+		if table == nil || len(table.columns) == sqliteMaxColumns {
+			name := "metrics_" + hash
+			if len(schema.tables) > 0 {
+				name = fmt.Sprintf("%s_%d", name, len(schema.tables)+1)
+			}
+			table = &sqliteTable{
+				name:    name,
+				columns: []string{SQLiteTimeColumn},
+				types:   []string{"INTEGER"},
+				tree:    newSQLiteTableTree(w),
+			}
+			names = map[string]bool{SQLiteTimeColumn: true}
+			schema.tables = append(schema.tables, table)
+		}
+
+		column := chunk.Metrics[idx].Key()
+		for n := 2; names[strings.ToLower(column)]; n++ {
+			column = fmt.Sprintf("%s_%d", chunk.Metrics[idx].Key(), n)
+		}
+		names[strings.ToLower(column)] = true
+
+		table.metrics = append(table.metrics, idx)
+		table.columns = append(table.columns, column)
+		if chunk.Metrics[idx].Type() == bsontype.Double {
+			table.types = append(table.types, "REAL")
+		} else {
+			table.types = append(table.types, "INTEGER")
+		}
+	}
+
+	return schema
+}
+
+func (s *sqliteSchema) addChunk(chunk *ftdc.Chunk) error {
+	if len(chunk.Metrics) != s.metrics {
+		return errors.Errorf("unexpected schema change detected for schema %s", s.hash)
+	}
+
+	var timeMetric *ftdc.Metric
+	for idx := range chunk.Metrics {
+		if chunk.Metrics[idx].Type() == bsontype.DateTime {
+			timeMetric = &chunk.Metrics[idx]
+			break
+		}
+	}
+	if timeMetric == nil {
+		return errors.New("chunk does not have a date time metric")
+	}
+
+	values := []sqliteValue{}
+	record := []byte{}
+	for i := 0; i < chunk.Size(); i++ {
+		ts := timeMetric.Values[i]
+		s.times = append(s.times, ts)
+		rowid := int64(len(s.times))
+
+		for _, table := range s.tables {
+			values = append(values[:0], sqliteInt(ts))
+			for _, idx := range table.metrics {
+				m := &chunk.Metrics[idx]
+				if m.Type() == bsontype.Double {
+					values = append(values, sqliteFloat(math.Float64frombits(uint64(m.Values[i]))))
+				} else {
+					values = append(values, sqliteInt(m.Values[i]))
+				}
+			}
+
+			record = appendSQLiteRecord(record[:0], values...)
+			if err := table.tree.add(rowid, record); err != nil {
+				return errors.Wrapf(err, "problem writing table %s", table.name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// indexKeys returns the keys of the indexes of the time column of the
+// schema's tables, which hold the time and the rowid of each sample,
+// in order.
+func (s *sqliteSchema) indexKeys() [][]byte {
+	rowids := make([]int, len(s.times))
+	for idx := range rowids {
+		rowids[idx] = idx
+	}
+	sort.SliceStable(rowids, func(i, j int) bool { return s.times[rowids[i]] < s.times[rowids[j]] })
+
+	keys := make([][]byte, len(rowids))
+	for idx, row := range rowids {
+		keys[idx] = appendSQLiteRecord(nil, sqliteInt(s.times[row]), sqliteInt(int64(row+1)))
+	}
+	return keys
+}
+
+func (t *sqliteTable) createSQL() string {
+	sql := &strings.Builder{}
+	fmt.Fprintf(sql, "CREATE TABLE %s (", sqliteQuote(t.name))
+	for idx, column := range t.columns {
+		if idx > 0 {
+			sql.WriteString(", ")
+		}
+		sql.WriteString(sqliteQuote(column))
+		sql.WriteString(" ")
+		sql.WriteString(t.types[idx])
+	}
+	sql.WriteString(")")
+	return sql.String()
+}
+
+func sqliteQuote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
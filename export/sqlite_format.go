@@ -0,0 +1,520 @@
+package export
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// This file writes the SQLite database file format, as described in
+// https://www.sqlite.org/fileformat.html, without depending on the
+// SQLite library. The writer builds each table and index b-tree once,
+// from data in key order, rather than inserting rows: table rows are
+// written to leaf pages as they're added, and the interior pages of
+// b-trees are built when the database is closed.
+
+const (
+	sqlitePageSize      = 4096
+	sqliteHeaderSize    = 100
+	sqliteVersionNumber = 3040001
+
+	sqlitePageTableLeaf     = 0x0d
+	sqlitePageTableInterior = 0x05
+	sqlitePageIndexLeaf     = 0x0a
+	sqlitePageIndexInterior = 0x02
+)
+
+// sqlite record serial types, other than integers of different sizes,
+// text, and blobs.
+const (
+	sqliteSerialNull  = 0
+	sqliteSerialFloat = 7
+	sqliteSerialZero  = 8
+	sqliteSerialOne   = 9
+)
+
+// sqliteValue is a value of a column of a record, which is an
+// integer, a float, or text, and is NULL if none of those are set.
+type sqliteValue struct {
+	integer bool
+	float   bool
+	i       int64
+	f       float64
+	text    string
+}
+
+func sqliteInt(i int64) sqliteValue     { return sqliteValue{integer: true, i: i} }
+func sqliteFloat(f float64) sqliteValue { return sqliteValue{float: true, f: f} }
+func sqliteText(s string) sqliteValue   { return sqliteValue{text: s} }
+
+func (v sqliteValue) serialType() (uint64, int) {
+	switch {
+	case v.integer:
+		switch i := v.i; {
+		case i == 0:
+			return sqliteSerialZero, 0
+		case i == 1:
+			return sqliteSerialOne, 0
+		case i >= math.MinInt8 && i <= math.MaxInt8:
+			return 1, 1
+		case i >= math.MinInt16 && i <= math.MaxInt16:
+			return 2, 2
+		case i >= -1<<23 && i < 1<<23:
+			return 3, 3
+		case i >= math.MinInt32 && i <= math.MaxInt32:
+			return 4, 4
+		case i >= -1<<47 && i < 1<<47:
+			return 5, 6
+		default:
+			return 6, 8
+		}
+	case v.float:
+		// sqlite stores NaN as NULL.
+		if math.IsNaN(v.f) {
+			return sqliteSerialNull, 0
+		}
+		return sqliteSerialFloat, 8
+	case v.text != "":
+		return uint64(2*len(v.text) + 13), len(v.text)
+	default:
+		return sqliteSerialNull, 0
+	}
+}
+
+// appendSQLiteRecord appends the values in the sqlite record format:
+// a header, which holds its size and the serial type of each value,
+// followed by the values.
+func appendSQLiteRecord(out []byte, values ...sqliteValue) []byte {
+	types := make([]uint64, len(values))
+	headerSize := 0
+	for idx, v := range values {
+		types[idx], _ = v.serialType()
+		headerSize += sqliteVarintSize(types[idx])
+	}
+
+	// the size of the header includes the varint that holds it.
+	size := headerSize + 1
+	for size != headerSize+sqliteVarintSize(uint64(size)) {
+		size = headerSize + sqliteVarintSize(uint64(size))
+	}
+	headerSize = size
+
+	out = appendSQLiteVarint(out, uint64(headerSize))
+	for _, t := range types {
+		out = appendSQLiteVarint(out, t)
+	}
+
+	var buf [8]byte
+	for idx, v := range values {
+		switch t := types[idx]; {
+		case t == sqliteSerialFloat:
+			binary.BigEndian.PutUint64(buf[:], math.Float64bits(v.f))
+			out = append(out, buf[:]...)
+		case t >= 1 && t <= 6:
+			_, size := v.serialType()
+			binary.BigEndian.PutUint64(buf[:], uint64(v.i))
+			out = append(out, buf[8-size:]...)
+		case t >= 13:
+			out = append(out, v.text...)
+		}
+	}
+
+	return out
+}
+
+// appendSQLiteVarint appends the value as a sqlite varint, which,
+// unlike the varints of encoding/binary, is big endian, and holds 8
+// bits in its ninth byte.
+func appendSQLiteVarint(out []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for idx := 7; idx >= 0; idx-- {
+			buf[idx] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(out, buf[:]...)
+	}
+
+	var buf [8]byte
+	idx := len(buf) - 1
+	buf[idx] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		idx--
+		buf[idx] = byte(v&0x7f) | 0x80
+	}
+	return append(out, buf[idx:]...)
+}
+
+func sqliteVarintSize(v uint64) int {
+	if v > 1<<56-1 {
+		return 9
+	}
+	size := 1
+	for v >>= 7; v > 0; v >>= 7 {
+		size++
+	}
+	return size
+}
+
+// sqliteWriter allocates and writes the pages of a database file.
+// Page 1, which holds the database header and the root of the schema
+// table, is written when the database is closed.
+type sqliteWriter struct {
+	file  *os.File
+	pages uint32
+}
+
+func newSQLiteWriter(file *os.File) *sqliteWriter {
+	return &sqliteWriter{file: file, pages: 1}
+}
+
+func (w *sqliteWriter) allocate() uint32 {
+	w.pages++
+	return w.pages
+}
+
+func (w *sqliteWriter) writePage(pgno uint32, page []byte) error {
+	_, err := w.file.WriteAt(page, int64(pgno-1)*sqlitePageSize)
+	return errors.Wrapf(err, "problem writing page %d", pgno)
+}
+
+// localPayload returns the number of bytes of a payload of the size
+// that are stored in a cell, rather than in overflow pages, for
+// table leaf cells or for index cells.
+func localPayload(size int, index bool) int {
+	usable := sqlitePageSize
+	maxLocal := usable - 35
+	if index {
+		maxLocal = (usable-12)*64/255 - 23
+	}
+	if size <= maxLocal {
+		return size
+	}
+
+	minLocal := (usable-12)*32/255 - 23
+	local := minLocal + (size-minLocal)%(usable-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	return local
+}
+
+// payloadCell appends the part of the payload that is stored in the
+// cell to the cell, and writes the rest of it to overflow pages.
+func (w *sqliteWriter) payloadCell(cell, payload []byte, index bool) ([]byte, error) {
+	local := localPayload(len(payload), index)
+	cell = append(cell, payload[:local]...)
+	if local == len(payload) {
+		return cell, nil
+	}
+
+	rest := payload[local:]
+	next := w.allocate()
+	cell = binary.BigEndian.AppendUint32(cell, next)
+	for len(rest) > 0 {
+		pgno := next
+		page := make([]byte, sqlitePageSize)
+		n := copy(page[4:], rest)
+		rest = rest[n:]
+		if len(rest) > 0 {
+			next = w.allocate()
+			binary.BigEndian.PutUint32(page, next)
+		}
+		if err := w.writePage(pgno, page); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return cell, nil
+}
+
+// sqlitePage builds a b-tree page of the type. The cells of the page
+// are added in key order.
+type sqlitePage struct {
+	kind   byte
+	offset int
+	cells  [][]byte
+	size   int
+	right  uint32
+}
+
+func newSQLitePage(kind byte, pgno uint32) *sqlitePage {
+	p := &sqlitePage{kind: kind}
+	if pgno == 1 {
+		p.offset = sqliteHeaderSize
+	}
+	return p
+}
+
+func (p *sqlitePage) headerSize() int {
+	if p.kind == sqlitePageTableLeaf || p.kind == sqlitePageIndexLeaf {
+		return 8
+	}
+	return 12
+}
+
+// used returns the number of bytes of the page that are in use.
+func (p *sqlitePage) used() int {
+	return p.offset + p.headerSize() + 2*len(p.cells) + p.size
+}
+
+// fits reports whether the page has space for the cell.
+func (p *sqlitePage) fits(cell []byte) bool {
+	return p.used()+2+len(cell) <= sqlitePageSize
+}
+
+func (p *sqlitePage) add(cell []byte) {
+	p.cells = append(p.cells, cell)
+	p.size += len(cell)
+}
+
+// sqlitePageCapacity returns the number of cells of the size that fit
+// in a page of the kind.
+func sqlitePageCapacity(kind byte, pgno uint32, cellSize int) int {
+	p := newSQLitePage(kind, pgno)
+	return (sqlitePageSize - p.offset - p.headerSize()) / (cellSize + 2)
+}
+
+func (p *sqlitePage) render() []byte {
+	page := make([]byte, sqlitePageSize)
+	hdr := page[p.offset:]
+	hdr[0] = p.kind
+	binary.BigEndian.PutUint16(hdr[3:], uint16(len(p.cells)))
+	if p.headerSize() == 12 {
+		binary.BigEndian.PutUint32(hdr[8:], p.right)
+	}
+
+	content := sqlitePageSize
+	for idx, cell := range p.cells {
+		content -= len(cell)
+		copy(page[content:], cell)
+		binary.BigEndian.PutUint16(hdr[p.headerSize()+2*idx:], uint16(content))
+	}
+	binary.BigEndian.PutUint16(hdr[5:], uint16(content))
+
+	return page
+}
+
+// sqliteChild refers to a page of a table b-tree, with the largest
+// rowid in the page's subtree.
+type sqliteChild struct {
+	pgno  uint32
+	rowid int64
+}
+
+// sqliteTableTree writes a table b-tree, with rows that are added in
+// rowid order. Leaf pages are written as they fill, and the interior
+// pages when the tree is closed.
+type sqliteTableTree struct {
+	w        *sqliteWriter
+	leaf     *sqlitePage
+	lastRow  int64
+	children []sqliteChild
+}
+
+func newSQLiteTableTree(w *sqliteWriter) *sqliteTableTree {
+	return &sqliteTableTree{w: w, leaf: newSQLitePage(sqlitePageTableLeaf, 0)}
+}
+
+func (t *sqliteTableTree) add(rowid int64, record []byte) error {
+	cell := appendSQLiteVarint(nil, uint64(len(record)))
+	cell = appendSQLiteVarint(cell, uint64(rowid))
+	cell, err := t.w.payloadCell(cell, record, false)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !t.leaf.fits(cell) {
+		if err := t.flushLeaf(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	t.leaf.add(cell)
+	t.lastRow = rowid
+
+	return nil
+}
+
+func (t *sqliteTableTree) flushLeaf() error {
+	pgno := t.w.allocate()
+	if err := t.w.writePage(pgno, t.leaf.render()); err != nil {
+		return errors.WithStack(err)
+	}
+	t.children = append(t.children, sqliteChild{pgno: pgno, rowid: t.lastRow})
+	t.leaf = newSQLitePage(sqlitePageTableLeaf, 0)
+	return nil
+}
+
+// close writes the rest of the tree, with its root at the page, or at
+// a new page if root is 0, and returns the page number of the root.
+func (t *sqliteTableTree) close(root uint32) (uint32, error) {
+	if len(t.children) == 0 {
+		// the root of the schema table is in page 1, which
+		// also holds the database header, so rows that fit in
+		// a leaf may not fit in the root.
+		if root != 1 || t.leaf.used()+sqliteHeaderSize <= sqlitePageSize {
+			return t.writeRoot(root, t.leaf)
+		}
+		if err := t.flushLeaf(); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	} else if len(t.leaf.cells) > 0 {
+		if err := t.flushLeaf(); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	}
+
+	// each interior cell holds a child page and its largest
+	// rowid, and is at most 13 bytes.
+	const cellSize = 4 + 9
+	children := t.children
+	for {
+		if len(children) <= sqlitePageCapacity(sqlitePageTableInterior, root, cellSize)+1 {
+			return t.writeRoot(root, t.interiorPage(children, root))
+		}
+
+		capacity := sqlitePageCapacity(sqlitePageTableInterior, 0, cellSize) + 1
+		var parents []sqliteChild
+		for _, group := range partitionEvenly(len(children), (len(children)+capacity-1)/capacity) {
+			pgno := t.w.allocate()
+			if err := t.w.writePage(pgno, t.interiorPage(children[:group], 0).render()); err != nil {
+				return 0, errors.WithStack(err)
+			}
+			parents = append(parents, sqliteChild{pgno: pgno, rowid: children[group-1].rowid})
+			children = children[group:]
+		}
+		children = parents
+	}
+}
+
+// interiorPage returns an interior page for the children, the last of
+// which is the right-most child of the page.
+func (t *sqliteTableTree) interiorPage(children []sqliteChild, pgno uint32) *sqlitePage {
+	page := newSQLitePage(sqlitePageTableInterior, pgno)
+	for _, child := range children[:len(children)-1] {
+		cell := binary.BigEndian.AppendUint32(nil, child.pgno)
+		page.add(appendSQLiteVarint(cell, uint64(child.rowid)))
+	}
+	page.right = children[len(children)-1].pgno
+	return page
+}
+
+func (t *sqliteTableTree) writeRoot(root uint32, page *sqlitePage) (uint32, error) {
+	if root == 0 {
+		root = t.w.allocate()
+	}
+	if root == 1 {
+		page.offset = sqliteHeaderSize
+	}
+
+	return root, errors.WithStack(t.w.writePage(root, page.render()))
+}
+
+// writeSQLiteIndex writes an index b-tree of the keys, which are
+// records in key order, and returns the page number of its root. The
+// keys must be small enough to not need overflow pages.
+// Unlike table b-trees, the keys of the interior pages of an index
+// are not repeated in its leaves, so the tree is built from the keys
+// at once, one level at a time: each level holds the keys that
+// separate the pages of the level below.
+func writeSQLiteIndex(w *sqliteWriter, keys [][]byte) (uint32, error) {
+	maxSize := 0
+	for _, key := range keys {
+		if size := sqliteVarintSize(uint64(len(key))) + len(key); size > maxSize {
+			maxSize = size
+		}
+	}
+
+	kind := byte(sqlitePageIndexLeaf)
+	var children []uint32
+	for {
+		cellSize := maxSize
+		if kind == sqlitePageIndexInterior {
+			cellSize += 4
+		}
+		capacity := sqlitePageCapacity(kind, 0, cellSize)
+
+		// pages are separated by one key, and hold at least
+		// one key, with the number of keys spread evenly.
+		numPages := (len(keys) + 1 + capacity) / (capacity + 1)
+
+		var separators [][]byte
+		var pages []uint32
+		remaining := keys
+		for idx, group := range partitionEvenly(len(keys)-(numPages-1), numPages) {
+			page := newSQLitePage(kind, 0)
+			for _, key := range remaining[:group] {
+				var cell []byte
+				if kind == sqlitePageIndexInterior {
+					cell = binary.BigEndian.AppendUint32(cell, children[0])
+					children = children[1:]
+				}
+				cell = appendSQLiteVarint(cell, uint64(len(key)))
+				page.add(append(cell, key...))
+			}
+			if kind == sqlitePageIndexInterior {
+				page.right = children[0]
+				children = children[1:]
+			}
+			remaining = remaining[group:]
+			if idx < numPages-1 {
+				separators = append(separators, remaining[0])
+				remaining = remaining[1:]
+			}
+
+			pgno := w.allocate()
+			if err := w.writePage(pgno, page.render()); err != nil {
+				return 0, errors.WithStack(err)
+			}
+			pages = append(pages, pgno)
+		}
+
+		if numPages == 1 {
+			return pages[0], nil
+		}
+
+		kind = sqlitePageIndexInterior
+		keys, children = separators, pages
+	}
+}
+
+// partitionEvenly splits n items into the number of groups, and
+// returns the sizes of the groups, which differ by at most one.
+func partitionEvenly(n, groups int) []int {
+	out := make([]int, groups)
+	for idx := range out {
+		out[idx] = n / groups
+		if idx < n%groups {
+			out[idx]++
+		}
+	}
+	return out
+}
+
+// writeHeader writes the database header, at the beginning of page 1,
+// which must be written first, as it also holds the root of the
+// schema table.
+func (w *sqliteWriter) writeHeader() error {
+	header := make([]byte, sqliteHeaderSize)
+	copy(header, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(header[16:], sqlitePageSize)
+	header[18] = 1 // file format write version (legacy)
+	header[19] = 1 // file format read version (legacy)
+	header[21] = 64
+	header[22] = 32
+	header[23] = 32
+	binary.BigEndian.PutUint32(header[24:], 1) // file change counter
+	binary.BigEndian.PutUint32(header[28:], w.pages)
+	binary.BigEndian.PutUint32(header[40:], 1) // schema cookie
+	binary.BigEndian.PutUint32(header[44:], 4) // schema format
+	binary.BigEndian.PutUint32(header[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(header[92:], 1) // version valid for
+	binary.BigEndian.PutUint32(header[96:], sqliteVersionNumber)
+
+	_, err := w.file.WriteAt(header, 0)
+	return errors.Wrap(err, "problem writing database header")
+}
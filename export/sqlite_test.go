@@ -0,0 +1,316 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sqliteReader decodes the tables of a SQLite database file, as
+// written by WriteSQLite, to inspect its contents.
+type sqliteReader struct {
+	t    *testing.T
+	data []byte
+}
+
+func (r *sqliteReader) page(pgno uint32) []byte {
+	start := int(pgno-1) * sqlitePageSize
+	require.True(r.t, start+sqlitePageSize <= len(r.data), "page %d is out of range", pgno)
+	return r.data[start : start+sqlitePageSize]
+}
+
+func readSQLiteVarint(buf []byte) (uint64, int) {
+	var v uint64
+	for idx := 0; idx < 8; idx++ {
+		v = v<<7 | uint64(buf[idx]&0x7f)
+		if buf[idx] < 0x80 {
+			return v, idx + 1
+		}
+	}
+	return v<<8 | uint64(buf[8]), 9
+}
+
+// payload returns the payload of a cell, following its overflow pages.
+func (r *sqliteReader) payload(cell []byte, index bool) []byte {
+	size, n := readSQLiteVarint(cell)
+	cell = cell[n:]
+	if !index {
+		_, n = readSQLiteVarint(cell)
+		cell = cell[n:]
+	}
+
+	local := localPayload(int(size), index)
+	out := append([]byte{}, cell[:local]...)
+	if local < int(size) {
+		next := binary.BigEndian.Uint32(cell[local:])
+		for next != 0 {
+			page := r.page(next)
+			next = binary.BigEndian.Uint32(page)
+			rest := int(size) - len(out)
+			if rest > sqlitePageSize-4 {
+				rest = sqlitePageSize - 4
+			}
+			out = append(out, page[4:4+rest]...)
+		}
+	}
+	require.Len(r.t, out, int(size))
+	return out
+}
+
+func (r *sqliteReader) record(payload []byte) []interface{} {
+	headerSize, n := readSQLiteVarint(payload)
+	header := payload[n:headerSize]
+	body := payload[headerSize:]
+
+	out := []interface{}{}
+	for len(header) > 0 {
+		t, n := readSQLiteVarint(header)
+		header = header[n:]
+
+		switch {
+		case t == sqliteSerialNull:
+			out = append(out, nil)
+		case t == sqliteSerialZero || t == sqliteSerialOne:
+			out = append(out, int64(t-sqliteSerialZero))
+		case t == sqliteSerialFloat:
+			out = append(out, math.Float64frombits(binary.BigEndian.Uint64(body)))
+			body = body[8:]
+		case t >= 13 && t%2 == 1:
+			size := int(t-13) / 2
+			out = append(out, string(body[:size]))
+			body = body[size:]
+		default:
+			size := map[uint64]int{1: 1, 2: 2, 3: 3, 4: 4, 5: 6, 6: 8}[t]
+			var v int64
+			for _, b := range body[:size] {
+				v = v<<8 | int64(b)
+			}
+			shift := uint(64 - 8*size)
+			out = append(out, v<<shift>>shift)
+			body = body[size:]
+		}
+	}
+	return out
+}
+
+// rows returns the records of the b-tree with the root, in key order,
+// with the rowids of tables.
+func (r *sqliteReader) rows(pgno uint32) ([]int64, [][]interface{}) {
+	page := r.page(pgno)
+	hdr := page
+	if pgno == 1 {
+		hdr = page[sqliteHeaderSize:]
+	}
+
+	kind := hdr[0]
+	numCells := int(binary.BigEndian.Uint16(hdr[3:]))
+	headerSize := 8
+	if kind == sqlitePageTableInterior || kind == sqlitePageIndexInterior {
+		headerSize = 12
+	}
+	if pgno != 1 && (kind == sqlitePageTableInterior || kind == sqlitePageIndexInterior) {
+		assert.NotZero(r.t, numCells, "interior page %d is empty", pgno)
+	}
+
+	var rowids []int64
+	var records [][]interface{}
+	for idx := 0; idx < numCells; idx++ {
+		cell := page[binary.BigEndian.Uint16(hdr[headerSize+2*idx:]):]
+		switch kind {
+		case sqlitePageTableLeaf:
+			_, n := readSQLiteVarint(cell)
+			rowid, _ := readSQLiteVarint(cell[n:])
+			rowids = append(rowids, int64(rowid))
+			records = append(records, r.record(r.payload(cell, false)))
+		case sqlitePageTableInterior:
+			ids, recs := r.rows(binary.BigEndian.Uint32(cell))
+			rowids, records = append(rowids, ids...), append(records, recs...)
+		case sqlitePageIndexLeaf:
+			records = append(records, r.record(r.payload(cell, true)))
+		case sqlitePageIndexInterior:
+			_, recs := r.rows(binary.BigEndian.Uint32(cell))
+			records = append(records, recs...)
+			records = append(records, r.record(r.payload(cell[4:], true)))
+		default:
+			require.FailNow(r.t, "unexpected page type", "page %d has type %d", pgno, kind)
+		}
+	}
+
+	if headerSize == 12 {
+		ids, recs := r.rows(binary.BigEndian.Uint32(hdr[8:]))
+		rowids, records = append(rowids, ids...), append(records, recs...)
+	}
+
+	return rowids, records
+}
+
+func TestWriteSQLite(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "ftdc-sqlite")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	data := makeChunks(t, 25, func(i int) *bsonx.Document {
+		return bsonx.NewDocument(
+			bsonx.EC.Time("ts", start.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("counter", int64(i*i*1000)),
+			bsonx.EC.Int64("Counter", int64(-i)),
+			bsonx.EC.Boolean("ok", i%2 == 0),
+		)
+	})
+	// a second schema, with doubles, which are only exact with the
+	// float preserving encoding.
+	buf := &bytes.Buffer{}
+	collector := ftdc.NewStreamingFloatPreservingCollector(10, buf)
+	for i := 0; i < 5; i++ {
+		load := float64(i) / 4
+		if i == 1 {
+			load = math.NaN()
+		}
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.Time("ts", start.Add(time.Duration(i)*time.Minute)),
+			bsonx.EC.Double("load", load),
+		)))
+	}
+	require.NoError(t, ftdc.FlushCollector(collector, buf))
+	data = append(data, buf.Bytes()...)
+
+	write := func(t *testing.T, data []byte) (string, *sqliteReader) {
+		path := filepath.Join(dir, strings.Replace(t.Name(), "/", "_", -1)+".db")
+		require.NoError(t, WriteSQLite(ctx, ftdc.ReadChunks(ctx, bytes.NewReader(data)), path))
+
+		out, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(out, []byte("SQLite format 3\x00")))
+		require.Zero(t, len(out)%sqlitePageSize)
+		assert.EqualValues(t, len(out)/sqlitePageSize, binary.BigEndian.Uint32(out[28:]))
+
+		return path, &sqliteReader{t: t, data: out}
+	}
+
+	t.Run("Tables", func(t *testing.T) {
+		_, db := write(t, data)
+		_, schema := db.rows(1)
+		require.Len(t, schema, 4)
+
+		chunks := ftdc.ReadChunks(ctx, bytes.NewReader(data))
+		defer chunks.Close()
+		require.True(t, chunks.Next())
+		name := "metrics_" + chunks.Chunk().SchemaHash()
+
+		assert.Equal(t, []interface{}{"table", name, name}, schema[0][:3])
+		assert.Equal(t, `CREATE TABLE "`+name+`" ("timestamp" INTEGER, "ts" INTEGER, "counter" INTEGER, "Counter_2" INTEGER, "ok" INTEGER)`, schema[0][4])
+		assert.Equal(t, []interface{}{"index", name + "_timestamp", name}, schema[1][:3])
+		assert.Contains(t, schema[2][4], `"load" REAL`)
+
+		rowids, rows := db.rows(uint32(schema[0][3].(int64)))
+		require.Len(t, rows, 25)
+		assert.EqualValues(t, 1, rowids[0])
+		assert.EqualValues(t, 25, rowids[24])
+		ts := start.Add(24*time.Second).UnixNano() / int64(time.Millisecond)
+		assert.Equal(t, []interface{}{ts, ts, int64(24 * 24 * 1000), int64(-24), int64(1)}, rows[24])
+
+		_, rows = db.rows(uint32(schema[2][3].(int64)))
+		require.Len(t, rows, 5)
+		assert.Equal(t, 0.75, rows[3][2])
+		assert.Nil(t, rows[1][2], "NaN is NULL")
+
+		_, keys := db.rows(uint32(schema[1][3].(int64)))
+		require.Len(t, keys, 25)
+		assert.Equal(t, []interface{}{ts, int64(25)}, keys[24])
+	})
+	t.Run("Large", func(t *testing.T) {
+		// enough samples for interior pages, and enough
+		// metrics for overflow pages and split tables.
+		data := makeChunks(t, 1000, func(i int) *bsonx.Document {
+			doc := bsonx.NewDocument(bsonx.EC.Time("ts", start.Add(time.Duration(i%500)*time.Second)))
+			for m := 0; m < sqliteMaxColumns+10; m++ {
+				doc.Append(bsonx.EC.Int64(strings.Repeat("m", 40)+string(rune('a'+m%26))+strings.Repeat("x", m/26), int64(i*m)))
+			}
+			return doc
+		})
+		path, db := write(t, data)
+		_, schema := db.rows(1)
+		require.Len(t, schema, 4)
+		assert.True(t, strings.HasSuffix(schema[2][1].(string), "_2"))
+
+		rowids, rows := db.rows(uint32(schema[0][3].(int64)))
+		require.Len(t, rows, 1000)
+		for idx, row := range rows {
+			require.EqualValues(t, idx+1, rowids[idx])
+			require.Len(t, row, sqliteMaxColumns)
+		}
+		assert.Equal(t, int64(999*1997), rows[999][1999])
+
+		_, rows = db.rows(uint32(schema[2][3].(int64)))
+		require.Len(t, rows, 1000)
+		assert.Len(t, rows[0], 13)
+
+		// the index is in time order, which is not the order
+		// of the rows.
+		_, keys := db.rows(uint32(schema[1][3].(int64)))
+		require.Len(t, keys, 1000)
+		for idx := 1; idx < len(keys); idx++ {
+			require.True(t, keys[idx-1][0].(int64) <= keys[idx][0].(int64))
+		}
+		assert.EqualValues(t, 501, keys[1][1])
+
+		if _, err := exec.LookPath("sqlite3"); err == nil {
+			out, err := exec.Command("sqlite3", path, "PRAGMA integrity_check").CombinedOutput()
+			require.NoError(t, err, string(out))
+			assert.Equal(t, "ok", strings.TrimSpace(string(out)))
+		}
+	})
+	t.Run("Empty", func(t *testing.T) {
+		_, db := write(t, nil)
+		_, schema := db.rows(1)
+		assert.Empty(t, schema)
+	})
+	t.Run("Errors", func(t *testing.T) {
+		path := filepath.Join(dir, "errors.db")
+		data := makeChunks(t, 5, func(i int) *bsonx.Document {
+			return bsonx.NewDocument(bsonx.EC.Int64("counter", int64(i)))
+		})
+		assert.Error(t, WriteSQLite(ctx, ftdc.ReadChunks(ctx, bytes.NewReader(data)), path))
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+
+		assert.Error(t, WriteSQLite(ctx, ftdc.ReadChunks(ctx, bytes.NewReader(data)), filepath.Join(dir, "missing", "out.db")))
+	})
+	t.Run("SQLite", func(t *testing.T) {
+		if _, err := exec.LookPath("sqlite3"); err != nil {
+			t.Skip("sqlite3 is not installed")
+		}
+		path, _ := write(t, data)
+
+		out, err := exec.Command("sqlite3", path, "PRAGMA integrity_check").CombinedOutput()
+		require.NoError(t, err, string(out))
+		assert.Equal(t, "ok", strings.TrimSpace(string(out)))
+
+		chunks := ftdc.ReadChunks(ctx, bytes.NewReader(data))
+		defer chunks.Close()
+		require.True(t, chunks.Next())
+		query := `SELECT count(*), sum(counter), max("Counter_2") FROM metrics_` + chunks.Chunk().SchemaHash() +
+			` WHERE timestamp >= ` + strconv.FormatInt(start.Add(20*time.Second).UnixNano()/int64(time.Millisecond), 10)
+		out, err = exec.Command("sqlite3", path, query).CombinedOutput()
+		require.NoError(t, err, string(out))
+		assert.Equal(t, "5|2430000|-20", strings.TrimSpace(string(out)))
+	})
+}
@@ -0,0 +1,120 @@
+package export
+
+import (
+	"encoding/binary"
+)
+
+// compact protocol type identifiers, as used in field headers and
+// list headers.
+const (
+	thriftBoolTrue  = 1
+	thriftBoolFalse = 2
+	thriftI32       = 5
+	thriftI64       = 6
+	thriftBinary    = 8
+	thriftList      = 9
+	thriftStruct    = 12
+)
+
+// thriftWriter is a minimal encoder for the thrift compact protocol,
+// with support for the subset of the protocol required to write
+// parquet page headers and file metadata.
+type thriftWriter struct {
+	buf     []byte
+	lastIDs []int16
+	lastID  int16
+}
+
+func (w *thriftWriter) bytes() []byte { return w.buf }
+
+func (w *thriftWriter) uvarint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	w.buf = append(w.buf, tmp[:n]...)
+}
+
+func (w *thriftWriter) varint(v int64) { w.uvarint(uint64((v << 1) ^ (v >> 63))) }
+
+func (w *thriftWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - w.lastID; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta<<4)|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.varint(int64(id))
+	}
+	w.lastID = id
+}
+
+func (w *thriftWriter) structBegin() {
+	w.lastIDs = append(w.lastIDs, w.lastID)
+	w.lastID = 0
+}
+
+func (w *thriftWriter) structEnd() {
+	w.buf = append(w.buf, 0)
+	w.lastID = w.lastIDs[len(w.lastIDs)-1]
+	w.lastIDs = w.lastIDs[:len(w.lastIDs)-1]
+}
+
+func (w *thriftWriter) listHeader(size int, elemType byte) {
+	if size < 15 {
+		w.buf = append(w.buf, byte(size<<4)|elemType)
+		return
+	}
+
+	w.buf = append(w.buf, 0xf0|elemType)
+	w.uvarint(uint64(size))
+}
+
+func (w *thriftWriter) i32Field(id int16, v int32) {
+	w.fieldHeader(id, thriftI32)
+	w.varint(int64(v))
+}
+
+func (w *thriftWriter) i64Field(id int16, v int64) {
+	w.fieldHeader(id, thriftI64)
+	w.varint(v)
+}
+
+func (w *thriftWriter) stringField(id int16, v string) {
+	w.fieldHeader(id, thriftBinary)
+	w.str(v)
+}
+
+func (w *thriftWriter) str(v string) {
+	w.uvarint(uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+func (w *thriftWriter) structField(id int16, fn func()) {
+	w.fieldHeader(id, thriftStruct)
+	w.structBegin()
+	fn()
+	w.structEnd()
+}
+
+func (w *thriftWriter) structListField(id int16, size int, fn func(int)) {
+	w.fieldHeader(id, thriftList)
+	w.listHeader(size, thriftStruct)
+	for i := 0; i < size; i++ {
+		w.structBegin()
+		fn(i)
+		w.structEnd()
+	}
+}
+
+func (w *thriftWriter) i32ListField(id int16, vs ...int32) {
+	w.fieldHeader(id, thriftList)
+	w.listHeader(len(vs), thriftI32)
+	for _, v := range vs {
+		w.varint(int64(v))
+	}
+}
+
+func (w *thriftWriter) stringListField(id int16, vs ...string) {
+	w.fieldHeader(id, thriftList)
+	w.listHeader(len(vs), thriftBinary)
+	for _, v := range vs {
+		w.str(v)
+	}
+}
@@ -0,0 +1,84 @@
+package ftdc
+
+import (
+	"io"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+)
+
+// The standard payload stores the deltas of double metrics as the bit
+// patterns of the float64 differences between consecutive samples,
+// which does not reproduce the values of the samples exactly. Chunks
+// written by float preserving collectors instead store the XOR of the
+// bit patterns of consecutive values (as in Gorilla), which
+// reproduces every value exactly, and is zero, and so run-length
+// encoded, when a value does not change.
+//
+// These chunks hold the name of the encoding in the "floats" field of
+// the chunk document, and are read transparently by this package,
+// but may not be readable by other FTDC implementations.
+const (
+	floatEncodingField = "floats"
+	floatEncodingXOR   = "xor"
+)
+
+// NewFloatPreservingCollector provides a collector that is equivalent
+// to the basic collector, except that the values of double metrics
+// survive a round trip exactly, including small fractional values.
+func NewFloatPreservingCollector(maxSize int) Collector {
+	return newFloatPreservingCollector(maxSize, time.Time{})
+}
+
+// newFloatPreservingCollector provides a float preserving collector.
+// If start is not zero, it is the _id of every chunk of the collector,
+// rather than the time that the first sample of the chunk was added.
+func newFloatPreservingCollector(maxSize int, start time.Time) Collector {
+	return &betterCollector{
+		maxDeltas: maxSize,
+		xorFloats: true,
+		start:     start,
+	}
+}
+
+// NewStreamingFloatPreservingCollector provides a streaming collector
+// (see NewStreamingCollector) that writes chunks in the same format as
+// the float preserving collector.
+func NewStreamingFloatPreservingCollector(maxSamples int, writer io.Writer) Collector {
+	c := newStreamingCollector(maxSamples, writer)
+	c.Collector.(*betterCollector).xorFloats = true
+	return c
+}
+
+// xorFloatsEnabled reports whether the chunk document uses the XOR
+// encoding for double metrics.
+func xorFloatsEnabled(doc *bsonx.Document) (bool, error) {
+	elem := doc.LookupElement(floatEncodingField)
+	if elem == nil {
+		return false, nil
+	}
+
+	encoding, ok := elem.Value().StringValueOK()
+	if !ok {
+		return false, errors.New("float encoding field is not a string")
+	}
+	if encoding != floatEncodingXOR {
+		return false, errors.Errorf("unsupported float encoding '%s'", encoding)
+	}
+
+	return true, nil
+}
+
+// xorFloatDelta returns the XOR delta between the extracted values,
+// which hold the bits, of two doubles.
+func xorFloatDelta(current, previous int64) int64 { return current ^ previous }
+
+func unxorFloats(value int64, deltas []int64) []int64 {
+	out := make([]int64, len(deltas)+1)
+	out[0] = value
+	for idx, delta := range deltas {
+		out[idx+1] = out[idx] ^ delta
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFloatPreservingCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	values := []float64{0.001, 0.0015, 0.0015, 1e-9, -0.25, math.Copysign(0, -1), math.Inf(1), math.NaN(), 1 << 60, 0.1}
+	samples := make([]*bsonx.Document, len(values))
+	for idx, value := range values {
+		samples[idx] = bsonx.NewDocument(
+			bsonx.EC.Double("gauge", value),
+			bsonx.EC.Int64("counter", int64(idx*10)),
+		)
+	}
+
+	readValues := func(t *testing.T, data []byte) (*Chunk, []float64) {
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		chunk := iter.Chunk()
+		require.False(t, iter.Next())
+		require.NoError(t, iter.Err())
+
+		require.Len(t, chunk.Metrics, 2)
+		assert.Equal(t, []int64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}, chunk.Metrics[1].Values)
+
+		out := make([]float64, len(chunk.Metrics[0].Values))
+		for idx, v := range chunk.Metrics[0].Values {
+			out[idx] = restoreFloat(v)
+		}
+		return chunk, out
+	}
+	assertExact := func(t *testing.T, out []float64) {
+		require.Len(t, out, len(values))
+		for idx := range values {
+			assert.Equal(t, math.Float64bits(values[idx]), math.Float64bits(out[idx]), "sample %d", idx)
+		}
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		collector := NewFloatPreservingCollector(len(values))
+		for _, doc := range samples {
+			require.NoError(t, collector.Add(doc))
+		}
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		chunk, out := readValues(t, data)
+		assertExact(t, out)
+
+		// restored documents hold the original values.
+		docs := chunk.StructuredIterator(ctx)
+		defer docs.Close()
+		for idx := 0; docs.Next(); idx++ {
+			value := docs.Document().Lookup("gauge").Double()
+			assert.Equal(t, math.Float64bits(values[idx]), math.Float64bits(value), "sample %d", idx)
+		}
+		require.NoError(t, docs.Err())
+	})
+	t.Run("Streaming", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		collector := NewStreamingFloatPreservingCollector(len(values), buf)
+		for _, doc := range samples {
+			require.NoError(t, collector.Add(doc))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		_, out := readValues(t, buf.Bytes())
+		assertExact(t, out)
+	})
+	t.Run("UnchangedValuesCompress", func(t *testing.T) {
+		collector := NewFloatPreservingCollector(1000)
+		base := NewBaseCollector(1000)
+		for i := 0; i < 1000; i++ {
+			doc := bsonx.NewDocument(bsonx.EC.Double("gauge", 0.1))
+			require.NoError(t, collector.Add(doc))
+			require.NoError(t, base.Add(doc))
+		}
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+		baseData, err := base.Resolve()
+		require.NoError(t, err)
+		assert.True(t, len(data) < len(baseData)+32, "%d vs %d", len(data), len(baseData))
+	})
+	t.Run("StandardFormatWithoutFloats", func(t *testing.T) {
+		collector := NewFloatPreservingCollector(10)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("counter", int64(i)))))
+		}
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		doc, err := bsonx.ReadDocument(data)
+		require.NoError(t, err)
+		assert.Nil(t, doc.LookupElement(floatEncodingField))
+	})
+	t.Run("UnsupportedEncoding", func(t *testing.T) {
+		collector := NewFloatPreservingCollector(len(values))
+		for _, doc := range samples {
+			require.NoError(t, collector.Add(doc))
+		}
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		doc, err := bsonx.ReadDocument(data)
+		require.NoError(t, err)
+		require.Equal(t, floatEncodingXOR, doc.Lookup(floatEncodingField).StringValue())
+
+		doc.Set(bsonx.EC.String(floatEncodingField, "gorilla"))
+		data, err = doc.MarshalBSON()
+		require.NoError(t, err)
+
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		assert.False(t, iter.Next())
+		assert.Error(t, iter.Err())
+	})
+}
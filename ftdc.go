@@ -15,13 +15,30 @@ type Chunk struct {
 	nPoints   int
 	id        time.Time
 	metadata  *bsonx.Document
+	periodic  *bsonx.Document
 	reference *bsonx.Document
+	schema    *SchemaTransition
+	payload   []byte
 }
 
 func (c *Chunk) GetMetadata() *bsonx.Document { return c.metadata }
 func (c *Chunk) Size() int                    { return c.nPoints }
 func (c *Chunk) Len() int                     { return len(c.Metrics) }
 
+// ID returns the time at which the chunk was started, which is the
+// _id of the chunk document.
+func (c *Chunk) ID() time.Time { return c.id }
+
+// PayloadSize returns the size, in bytes, of the compressed payload
+// of the chunk document that the chunk was read from, which is zero
+// for chunks derived from other chunks (e.g. trimmed to a time range.)
+func (c *Chunk) PayloadSize() int { return len(c.payload) }
+
+// SchemaTransition returns the schema change that preceded this
+// chunk, for chunks written by a schema tracking collector, and nil
+// otherwise.
+func (c *Chunk) SchemaTransition() *SchemaTransition { return c.schema }
+
 // Iterator returns an iterator that you can use to read documents for
 // each sample period in the chunk. Documents are returned in collection
 // order, with keys flattened and dot-seperated fully qualified
@@ -80,3 +97,10 @@ type Metric struct {
 func (m *Metric) Key() string {
 	return strings.Join(append(m.ParentPath, m.KeyName), ".")
 }
+
+// Type returns the BSON type of the values collected for this
+// metric. Values of double metrics are stored as the IEEE 754 binary
+// representation of the value (see math.Float64frombits), DateTime
+// values as milliseconds since the Unix epoch, and boolean values as
+// 0 or 1.
+func (m *Metric) Type() bsontype.Type { return m.originalType }
@@ -0,0 +1,210 @@
+package hdrhist
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// These cookies identify the V2 encoding of the reference (Java)
+// implementation of HdrHistogram, with the bit that denotes the
+// zig-zag, zero run length encoding of the counts set, which is the
+// format that other HdrHistogram tools read from histogram logs.
+const (
+	encodingCookieV2           int32 = 0x1c849303 | 0x10
+	compressedEncodingCookieV2 int32 = 0x1c849304 | 0x10
+	encodingHeaderSize               = 40
+)
+
+// EncodeCompressed returns the histogram in the compressed V2 binary
+// format of the reference implementation of HdrHistogram, which is
+// the format of the histograms in HdrHistogram interval logs, once
+// encoded as base64.
+func (h *Histogram) EncodeCompressed() ([]byte, error) {
+	payload := &bytes.Buffer{}
+	header := make([]byte, encodingHeaderSize)
+
+	// the reference implementation requires a lowest
+	// trackable value of at least one, which has the same bucket
+	// layout as zero.
+	lowest := h.lowestTrackableValue
+	if lowest < 1 {
+		lowest = 1
+	}
+
+	binary.BigEndian.PutUint32(header[0:], uint32(encodingCookieV2))
+	binary.BigEndian.PutUint32(header[8:], 0) // normalizing index offset
+	binary.BigEndian.PutUint32(header[12:], uint32(h.significantFigures))
+	binary.BigEndian.PutUint64(header[16:], uint64(lowest))
+	binary.BigEndian.PutUint64(header[24:], uint64(h.highestTrackableValue))
+	binary.BigEndian.PutUint64(header[32:], math.Float64bits(1.0)) // integer to double conversion ratio
+
+	// only counts up to the last non-zero count are encoded, and
+	// runs of zeros are encoded as a negative run length.
+	limit := len(h.counts)
+	for limit > 0 && h.counts[limit-1] == 0 {
+		limit--
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	for idx := 0; idx < limit; {
+		count := h.counts[idx]
+		idx++
+		if count < 0 {
+			return nil, errors.Errorf("cannot encode negative count %d at index %d", count, idx-1)
+		}
+
+		if count == 0 {
+			zeros := int64(1)
+			for idx < limit && h.counts[idx] == 0 {
+				zeros++
+				idx++
+			}
+			if zeros > 1 {
+				count = -zeros
+			}
+		}
+
+		payload.Write(buf[:putZigZag(buf, count)])
+	}
+	binary.BigEndian.PutUint32(header[4:], uint32(payload.Len()))
+
+	compressed := &bytes.Buffer{}
+	compressed.Write(make([]byte, 8))
+	zw := zlib.NewWriter(compressed)
+	if _, err := zw.Write(header); err != nil {
+		return nil, errors.Wrap(err, "problem compressing histogram header")
+	}
+	if _, err := zw.Write(payload.Bytes()); err != nil {
+		return nil, errors.Wrap(err, "problem compressing histogram counts")
+	}
+	if err := zw.Close(); err != nil {
+		return nil, errors.Wrap(err, "problem compressing histogram")
+	}
+
+	out := compressed.Bytes()
+	binary.BigEndian.PutUint32(out[0:], uint32(compressedEncodingCookieV2))
+	binary.BigEndian.PutUint32(out[4:], uint32(len(out)-8))
+
+	return out, nil
+}
+
+// DecodeCompressed returns a histogram from the compressed V2 binary
+// format of the reference implementation of HdrHistogram, as produced
+// by EncodeCompressed.
+func DecodeCompressed(in []byte) (*Histogram, error) {
+	if len(in) < 8 {
+		return nil, errors.New("compressed histogram is too short")
+	}
+	if cookie := int32(binary.BigEndian.Uint32(in)); cookie != compressedEncodingCookieV2 {
+		return nil, errors.Errorf("unsupported compressed histogram cookie %#x", cookie)
+	}
+	size := int(binary.BigEndian.Uint32(in[4:]))
+	if size > len(in)-8 {
+		return nil, errors.Errorf("compressed histogram length %d is larger than the %d bytes of data", size, len(in)-8)
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(in[8 : 8+size]))
+	if err != nil {
+		return nil, errors.Wrap(err, "problem decompressing histogram")
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem decompressing histogram")
+	}
+
+	if len(data) < encodingHeaderSize {
+		return nil, errors.New("histogram header is too short")
+	}
+	if cookie := int32(binary.BigEndian.Uint32(data)); cookie != encodingCookieV2 {
+		return nil, errors.Errorf("unsupported histogram cookie %#x", cookie)
+	}
+	payloadSize := int(binary.BigEndian.Uint32(data[4:]))
+	if payloadSize > len(data)-encodingHeaderSize {
+		return nil, errors.Errorf("histogram payload length %d is larger than the %d bytes of data", payloadSize, len(data)-encodingHeaderSize)
+	}
+	if offset := int32(binary.BigEndian.Uint32(data[8:])); offset != 0 {
+		return nil, errors.Errorf("normalizing index offset %d is not supported", offset)
+	}
+	sigfigs := int(binary.BigEndian.Uint32(data[12:]))
+	lowest := int64(binary.BigEndian.Uint64(data[16:]))
+	highest := int64(binary.BigEndian.Uint64(data[24:]))
+	if sigfigs < 1 || sigfigs > 5 {
+		return nil, errors.Errorf("sigfigs must be [1,5] (was %d)", sigfigs)
+	}
+	if lowest < 0 || highest < 2*lowest {
+		return nil, errors.Errorf("invalid trackable range [%d,%d]", lowest, highest)
+	}
+
+	h := New(lowest, highest, sigfigs)
+	payload := data[encodingHeaderSize : encodingHeaderSize+payloadSize]
+	idx := 0
+	for len(payload) > 0 {
+		count, n := getZigZag(payload)
+		if n <= 0 {
+			return nil, errors.New("histogram counts are truncated")
+		}
+		payload = payload[n:]
+
+		if count < 0 {
+			// a run of zeros, which are already zero
+			idx += int(-count)
+			if idx > len(h.counts) {
+				return nil, errors.New("histogram counts exceed the trackable range")
+			}
+			continue
+		}
+
+		if idx >= len(h.counts) {
+			return nil, errors.New("histogram counts exceed the trackable range")
+		}
+		h.counts[idx] = count
+		h.totalCount += count
+		idx++
+	}
+
+	return h, nil
+}
+
+// putZigZag writes the value to the buffer, which must be at least
+// nine bytes long, in the zig-zag LEB128 format used by the reference
+// implementation, where the ninth byte holds eight bits rather than
+// seven. It returns the number of bytes written.
+func putZigZag(buf []byte, value int64) int {
+	v := uint64((value << 1) ^ (value >> 63))
+	for i := 0; i < 8; i++ {
+		if v>>7 == 0 {
+			buf[i] = byte(v)
+			return i + 1
+		}
+		buf[i] = byte(v&0x7f) | 0x80
+		v >>= 7
+	}
+	buf[8] = byte(v)
+	return 9
+}
+
+// getZigZag reads a value written by putZigZag, and returns the value
+// and the number of bytes read, or zero if the buffer is too short.
+func getZigZag(buf []byte) (int64, int) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(buf) {
+			return 0, 0
+		}
+		if i == 8 {
+			v |= uint64(buf[i]) << 56
+			return int64(v>>1) ^ -int64(v&1), 9
+		}
+
+		v |= uint64(buf[i]&0x7f) << uint(7*i)
+		if buf[i]&0x80 == 0 {
+			return int64(v>>1) ^ -int64(v&1), i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,121 @@
+package hdrhist_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mongodb/ftdc/hdrhist"
+)
+
+func TestEncodeCompressedRoundTrip(t *testing.T) {
+	for name, h := range map[string]*hdrhist.Histogram{
+		"Empty":      hdrhist.New(1, 1000, 3),
+		"Uniform":    hdrhist.New(1, 10000000, 3),
+		"Sparse":     hdrhist.New(1000, 60000000000, 5),
+		"LargeCount": hdrhist.New(1, 1000, 2),
+	} {
+		switch name {
+		case "Uniform":
+			for i := 0; i < 100000; i++ {
+				if err := h.RecordValue(int64(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		case "Sparse":
+			for _, v := range []int64{1000, 5000000, 5000001, 60000000000} {
+				if err := h.RecordValue(v); err != nil {
+					t.Fatal(err)
+				}
+			}
+		case "LargeCount":
+			// counts this large need all nine bytes of
+			// the zig-zag encoding.
+			if err := h.RecordValues(500, 1<<62); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		data, err := h.EncodeCompressed()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		out, err := hdrhist.DecodeCompressed(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !out.Equals(h) {
+			t.Errorf("%s: decoded histogram is not equivalent", name)
+		}
+	}
+}
+
+func TestEncodeCompressedFormat(t *testing.T) {
+	h := hdrhist.New(0, 1000, 3)
+	if err := h.RecordValues(3, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := h.EncodeCompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cookie := binary.BigEndian.Uint32(data); cookie != 0x1c849314 {
+		t.Fatalf("compressed cookie was %#x", cookie)
+	}
+	if size := binary.BigEndian.Uint32(data[4:]); int(size) != len(data)-8 {
+		t.Fatalf("compressed length was %d, but expected %d", size, len(data)-8)
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(data[8:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		0x1c, 0x84, 0x93, 0x13, // cookie
+		0, 0, 0, 2, // payload length
+		0, 0, 0, 0, // normalizing index offset
+		0, 0, 0, 3, // significant figures
+		0, 0, 0, 0, 0, 0, 0, 1, // lowest, which must be at least one
+		0, 0, 0, 0, 0, 0, 0x03, 0xe8, // highest
+		0x3f, 0xf0, 0, 0, 0, 0, 0, 0, // conversion ratio of 1.0
+		0x05, // a run of three zero counts
+		0x04, // a count of two
+	}
+	if !bytes.Equal(expected[:40], raw[:40]) {
+		t.Errorf("header was %x, but expected %x", raw[:40], expected[:40])
+	}
+	if !bytes.Equal(expected[40:], raw[40:]) {
+		t.Errorf("payload was %x, but expected %x", raw[40:], expected[40:])
+	}
+}
+
+func TestDecodeCompressedErrors(t *testing.T) {
+	h := hdrhist.New(1, 1000, 3)
+	if err := h.RecordValue(10); err != nil {
+		t.Fatal(err)
+	}
+	data, err := h.EncodeCompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, in := range map[string][]byte{
+		"Empty":     nil,
+		"BadCookie": append([]byte{0, 0, 0, 0}, data[4:]...),
+		"Truncated": data[:len(data)-4],
+		"NotZlib":   append(append([]byte{}, data[:8]...), bytes.Repeat([]byte{0xff}, len(data)-8)...),
+	} {
+		if _, err := hdrhist.DecodeCompressed(in); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
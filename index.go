@@ -0,0 +1,302 @@
+package ftdc
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// Chunk Indexes
+//
+// A chunk index is a small sidecar file that describes the metric
+// chunks of an FTDC file, so that repeated analyses of a large file
+// can read only the chunks that they need, rather than scanning the
+// entire file. Indexes hold a header document:
+//
+//	{ ftdcIndex: 1, size: <int64>, chunks: <int> }
+//
+// with the size of the indexed data, followed by a document for each
+// chunk, in the order of the data:
+//
+//	{ offset: <int64>, size: <int>, metadata: <int64>,
+//	  start: <date>, end: <date>, samples: <int>, metrics: <int>,
+//	  schema: <string> }
+//
+// where metadata is the offset of the metadata document that precedes
+// the chunk, or -1 if there is none.
+const indexVersion = 1
+
+// FileIndex describes the metric chunks of an FTDC data source, as
+// produced by BuildIndex.
+type FileIndex struct {
+	// SourceSize is the size of the indexed data, in bytes.
+	SourceSize int64
+	Chunks     []IndexedChunk
+}
+
+// IndexedChunk describes a single metric chunk in a FileIndex.
+type IndexedChunk struct {
+	// Offset and Size locate the chunk document in the data, and
+	// MetadataOffset locates the metadata document that precedes
+	// the chunk, or is -1 if there is none.
+	Offset         int64
+	Size           int
+	MetadataOffset int64
+	// Start and End are the times of the first and last samples
+	// of the chunk, as derived from its first date time metric, or
+	// the reference time of the chunk if it has no date time
+	// metric.
+	Start   time.Time
+	End     time.Time
+	Samples int
+	Metrics int
+	// SchemaHash identifies the metric keys of the chunk (see
+	// Chunk.SchemaHash): chunks with the same hash have the same
+	// metrics.
+	SchemaHash string
+}
+
+// BuildIndex reads the FTDC data from the reader, and writes an index
+// of its metric chunks to the writer, for use with
+// NewIndexedIterator. Chunks are decoded to determine their time
+// ranges and schemas, so building an index costs about as much as
+// reading the data once.
+//
+// Indexes do not capture periodic metadata, and BuildIndex returns an
+// error for encrypted chunks.
+func BuildIndex(ctx context.Context, r io.Reader, w io.Writer) error {
+	buf := bufio.NewReader(r)
+	keys := bsonx.NewKeyInterner()
+	index := &FileIndex{}
+	metadata := int64(-1)
+
+	var current *bsonx.Document
+	for offset := int64(0); ; {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		// the offsets of documents in format v2 are the offsets
+		// of the documents, after their envelope headers.
+		doc := &bsonx.Document{}
+		var n int64
+		envelope, data, err := readBufEnvelope(buf)
+		switch {
+		case err != nil:
+		case envelope != nil:
+			offset += envelopeHeaderSize
+			n = int64(len(data))
+			doc, err = readEnvelopedDocument(envelope, data)
+		default:
+			n, err = doc.ReadFrom(buf)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "problem reading document at offset %d", offset)
+		}
+
+		switch docType := doc.Lookup("type"); {
+		case isNum(0, docType):
+			metadata = offset
+			current = doc
+		case isNum(1, docType):
+			chunk, err := readChunk(doc, current, keys, nil)
+			recordDecode(err)
+			if err != nil {
+				return errors.Wrapf(err, "problem reading chunk at offset %d", offset)
+			}
+			index.Chunks = append(index.Chunks, indexChunk(chunk, offset, int(n), metadata))
+		}
+
+		offset += n
+		index.SourceSize = offset
+	}
+
+	return errors.WithStack(index.write(w))
+}
+
+func indexChunk(chunk *Chunk, offset int64, size int, metadata int64) IndexedChunk {
+	out := IndexedChunk{
+		Offset:         offset,
+		Size:           size,
+		MetadataOffset: metadata,
+		Start:          chunk.id,
+		End:            chunk.id,
+		Samples:        chunk.Size(),
+		Metrics:        len(chunk.Metrics),
+	}
+	if times := chunk.sampleTimes(); len(times) > 0 {
+		out.Start, out.End = times[0], times[len(times)-1]
+	}
+
+	out.SchemaHash = chunk.SchemaHash()
+
+	return out
+}
+
+func (idx *FileIndex) write(w io.Writer) error {
+	header := bsonx.NewDocument(
+		bsonx.EC.Int32("ftdcIndex", indexVersion),
+		bsonx.EC.Int64("size", idx.SourceSize),
+		bsonx.EC.Int32("chunks", int32(len(idx.Chunks))),
+	)
+	if _, err := header.WriteTo(w); err != nil {
+		return errors.Wrap(err, "problem writing index header")
+	}
+
+	for _, chunk := range idx.Chunks {
+		doc := bsonx.NewDocument(
+			bsonx.EC.Int64("offset", chunk.Offset),
+			bsonx.EC.Int32("size", int32(chunk.Size)),
+			bsonx.EC.Int64("metadata", chunk.MetadataOffset),
+			bsonx.EC.Time("start", chunk.Start),
+			bsonx.EC.Time("end", chunk.End),
+			bsonx.EC.Int32("samples", int32(chunk.Samples)),
+			bsonx.EC.Int32("metrics", int32(chunk.Metrics)),
+			bsonx.EC.String("schema", chunk.SchemaHash),
+		)
+		if _, err := doc.WriteTo(w); err != nil {
+			return errors.Wrap(err, "problem writing index")
+		}
+	}
+
+	return nil
+}
+
+// ReadIndex reads an index written by BuildIndex.
+func ReadIndex(r io.Reader) (*FileIndex, error) {
+	buf := bufio.NewReader(r)
+
+	header, err := readBufBSON(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem reading index header")
+	}
+	if !isNum(indexVersion, header.Lookup("ftdcIndex")) {
+		return nil, errors.New("data is not a supported FTDC index")
+	}
+
+	out := &FileIndex{}
+	var ok bool
+	if out.SourceSize, ok = header.Lookup("size").Int64OK(); !ok {
+		return nil, errors.New("index header has no size")
+	}
+	count, ok := header.Lookup("chunks").Int32OK()
+	if !ok || count < 0 {
+		return nil, errors.New("index header has no chunk count")
+	}
+
+	out.Chunks = make([]IndexedChunk, 0, count)
+	for i := 0; i < int(count); i++ {
+		doc, err := readBufBSON(buf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem reading index entry %d", i)
+		}
+
+		chunk, err := readIndexedChunk(doc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem reading index entry %d", i)
+		}
+		out.Chunks = append(out.Chunks, chunk)
+	}
+
+	return out, nil
+}
+
+func readIndexedChunk(doc *bsonx.Document) (IndexedChunk, error) {
+	catcher := grip.NewBasicCatcher()
+	int64Field := func(key string) int64 {
+		v, ok := doc.Lookup(key).Int64OK()
+		if !ok {
+			catcher.Errorf("field '%s' is missing", key)
+		}
+		return v
+	}
+	int32Field := func(key string) int {
+		v, ok := doc.Lookup(key).Int32OK()
+		if !ok {
+			catcher.Errorf("field '%s' is missing", key)
+		}
+		return int(v)
+	}
+	timeField := func(key string) time.Time {
+		v, ok := doc.Lookup(key).TimeOK()
+		if !ok {
+			catcher.Errorf("field '%s' is missing", key)
+		}
+		return v
+	}
+
+	out := IndexedChunk{
+		Offset:         int64Field("offset"),
+		Size:           int32Field("size"),
+		MetadataOffset: int64Field("metadata"),
+		Start:          timeField("start"),
+		End:            timeField("end"),
+		Samples:        int32Field("samples"),
+		Metrics:        int32Field("metrics"),
+	}
+	var ok bool
+	if out.SchemaHash, ok = doc.Lookup("schema").StringValueOK(); !ok {
+		catcher.New("field 'schema' is missing")
+	}
+
+	return out, catcher.Resolve()
+}
+
+// NewIndexedIterator creates a ChunkIterator for an FTDC data source
+// that supports random access (e.g. an *os.File), with the specified
+// size, using an index of the data source written by BuildIndex, so
+// that the iterator only reads the chunks that contain samples within
+// the [start, end) time range. Use a zero time for either start or
+// end to leave that side of the range unbounded.
+//
+// Unlike NewChunkIteratorWithRange, the chunks are not trimmed to the
+// range. The iterator supports the Seek and Reverse methods, over the
+// chunks within the range, as with NewSeekableChunkIterator. The
+// iterator returns an error if the size of the data source does not
+// match the size of the indexed data, as the index is then stale.
+func NewIndexedIterator(ctx context.Context, r io.ReaderAt, size int64, index io.Reader, start, end time.Time) (*ChunkIterator, error) {
+	fileIndex, err := ReadIndex(index)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if fileIndex.SourceSize != size {
+		return nil, errors.Errorf("index of %d bytes of data does not match data of %d bytes", fileIndex.SourceSize, size)
+	}
+
+	idx := &chunkIndex{
+		source:   r,
+		last:     -1,
+		keys:     bsonx.NewKeyInterner(),
+		metadata: map[int64]*bsonx.Document{},
+	}
+	for _, chunk := range fileIndex.Chunks {
+		if !start.IsZero() && chunk.End.Before(start) {
+			continue
+		}
+		if !end.IsZero() && !chunk.Start.Before(end) {
+			continue
+		}
+
+		idx.chunks = append(idx.chunks, chunkLocation{
+			offset:   chunk.Offset,
+			size:     chunk.Size,
+			metadata: chunk.MetadataOffset,
+		})
+	}
+
+	iter := &ChunkIterator{
+		catcher: grip.NewBasicCatcher(),
+		index:   idx,
+	}
+	idx.ctx, iter.cancel = context.WithCancel(ctx)
+
+	return iter, nil
+}
@@ -0,0 +1,118 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkIndex(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	// five chunks of ten samples, one sample per second, with an
+	// additional metric from the fourth chunk.
+	buf := &bytes.Buffer{}
+	collector := NewBaseCollector(10)
+	require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "example"))))
+	for i := 0; i < 50; i++ {
+		doc := bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("counter", int64(i)),
+		)
+		if i >= 30 {
+			doc.Append(bsonx.EC.Int64("extra", 1))
+		}
+		require.NoError(t, collector.Add(doc))
+
+		if collector.Info().SampleCount == 10 {
+			require.NoError(t, FlushCollector(collector, buf))
+		}
+	}
+	data := buf.Bytes()
+
+	indexBuf := &bytes.Buffer{}
+	require.NoError(t, BuildIndex(ctx, bytes.NewReader(data), indexBuf))
+	indexData := indexBuf.Bytes()
+
+	t.Run("ReadIndex", func(t *testing.T) {
+		index, err := ReadIndex(bytes.NewReader(indexData))
+		require.NoError(t, err)
+		assert.EqualValues(t, len(data), index.SourceSize)
+		require.Len(t, index.Chunks, 5)
+
+		for i, chunk := range index.Chunks {
+			assert.Equal(t, base.Add(time.Duration(i*10)*time.Second), chunk.Start.UTC())
+			assert.Equal(t, base.Add(time.Duration(i*10+9)*time.Second), chunk.End.UTC())
+			assert.Equal(t, 10, chunk.Samples)
+			assert.True(t, chunk.MetadataOffset >= 0)
+			assert.True(t, chunk.Offset > chunk.MetadataOffset)
+		}
+		assert.Equal(t, 2, index.Chunks[0].Metrics)
+		assert.Equal(t, 3, index.Chunks[4].Metrics)
+		assert.Equal(t, index.Chunks[0].SchemaHash, index.Chunks[2].SchemaHash)
+		assert.NotEqual(t, index.Chunks[2].SchemaHash, index.Chunks[3].SchemaHash)
+		assert.Equal(t, index.Chunks[3].SchemaHash, index.Chunks[4].SchemaHash)
+	})
+	t.Run("InvalidIndex", func(t *testing.T) {
+		_, err := ReadIndex(bytes.NewReader(data))
+		assert.Error(t, err)
+		_, err = ReadIndex(bytes.NewReader(indexData[:len(indexData)-10]))
+		assert.Error(t, err)
+	})
+	t.Run("Range", func(t *testing.T) {
+		for _, test := range []struct {
+			name       string
+			start, end time.Time
+			expected   []int64
+		}{
+			{name: "Unbounded", expected: []int64{0, 10, 20, 30, 40}},
+			{name: "Middle", start: base.Add(15 * time.Second), end: base.Add(25 * time.Second), expected: []int64{10, 20}},
+			{name: "ExclusiveEnd", start: base.Add(10 * time.Second), end: base.Add(20 * time.Second), expected: []int64{10}},
+			{name: "OpenEnd", start: base.Add(39 * time.Second), expected: []int64{30, 40}},
+			{name: "OpenStart", end: base.Add(time.Second), expected: []int64{0}},
+			{name: "Empty", start: base.Add(time.Hour), expected: []int64{}},
+		} {
+			t.Run(test.name, func(t *testing.T) {
+				iter, err := NewIndexedIterator(ctx, bytes.NewReader(data), int64(len(data)), bytes.NewReader(indexData), test.start, test.end)
+				require.NoError(t, err)
+				defer iter.Close()
+
+				values := []int64{}
+				for iter.Next() {
+					chunk := iter.Chunk()
+					assert.Equal(t, "example", chunk.GetMetadata().Lookup("doc").MutableDocument().Lookup("host").StringValue())
+					values = append(values, chunk.Metrics[1].Values[0])
+				}
+				require.NoError(t, iter.Err())
+				assert.Equal(t, test.expected, values)
+			})
+		}
+	})
+	t.Run("Reverse", func(t *testing.T) {
+		iter, err := NewIndexedIterator(ctx, bytes.NewReader(data), int64(len(data)), bytes.NewReader(indexData), base.Add(15*time.Second), time.Time{})
+		require.NoError(t, err)
+		defer iter.Close()
+		assert.Equal(t, 4, iter.Len())
+		require.NoError(t, iter.Reverse())
+
+		require.True(t, iter.Next())
+		assert.EqualValues(t, 40, iter.Chunk().Metrics[1].Values[0])
+	})
+	t.Run("StaleIndex", func(t *testing.T) {
+		_, err := NewIndexedIterator(ctx, bytes.NewReader(data[:len(data)-1]), int64(len(data)-1), bytes.NewReader(indexData), time.Time{}, time.Time{})
+		assert.Error(t, err)
+	})
+	t.Run("CanceledBuild", func(t *testing.T) {
+		cctx, ccancel := context.WithCancel(ctx)
+		ccancel()
+		assert.Error(t, BuildIndex(cctx, bytes.NewReader(data), &bytes.Buffer{}))
+	})
+}
@@ -58,6 +58,14 @@ func BenchmarkIterator(b *testing.B) {
 						}
 					}
 				})
+				b.Run("IteratingParallel", func(b *testing.B) {
+					for n := 0; n < b.N; n++ {
+						iter := ReadChunksWithOptions(ctx, bytes.NewBuffer(data), ReadChunksOptions{Workers: -1})
+						for iter.Next() {
+							require.NotNil(b, iter.Chunk())
+						}
+					}
+				})
 			})
 			b.Run("Series", func(b *testing.B) {
 				b.Run("Resolving", func(b *testing.B) {
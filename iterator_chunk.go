@@ -39,11 +39,21 @@ type ChunkIterator struct {
 	closed  bool
 	catcher grip.Catcher
 	count   int
+	schemas []SchemaTransition
+	history metadataLog
+	descs   descriptorLog
+	index   *chunkIndex
+	budget  *memoryBudget
+	held    int64
 }
 
 // ReadChunks creates a ChunkIterator from an underlying FTDC data
 // source.
 func ReadChunks(ctx context.Context, r io.Reader) *ChunkIterator {
+	return readChunksWithKeys(ctx, r, nil)
+}
+
+func readChunksWithKeys(ctx context.Context, r io.Reader, decrypt KeyProvider) *ChunkIterator {
 	iter := &ChunkIterator{
 		catcher: grip.NewBasicCatcher(),
 		pipe:    make(chan *Chunk, 2),
@@ -57,7 +67,7 @@ func ReadChunks(ctx context.Context, r io.Reader) *ChunkIterator {
 	}()
 
 	go func() {
-		iter.catcher.Add(readChunks(ctx, ipc, iter.pipe))
+		iter.catcher.Add(readFilteredChunks(ctx, ipc, iter.pipe, nil, decrypt))
 	}()
 
 	return iter
@@ -67,15 +77,40 @@ func ReadChunks(ctx context.Context, r io.Reader) *ChunkIterator {
 // chunk that is unprocessed. Use the Chunk() method to access the
 // iterator.
 func (iter *ChunkIterator) Next() bool {
+	if iter.index != nil {
+		return iter.nextIndexed()
+	}
+
+	// the consumer is done with the current chunk, so it no
+	// longer counts against the memory budget.
+	if iter.budget != nil {
+		iter.budget.release(iter.held)
+		iter.held = 0
+	}
+
 	next, ok := <-iter.pipe
 	if !ok {
 		return false
 	}
 
-	iter.next = next
+	if iter.budget != nil {
+		iter.held = next.valuesSize()
+	}
+	iter.advance(next)
 	return true
 }
 
+// advance records the chunk as the current chunk, and records the
+// schema changes and metadata in the chunk.
+func (iter *ChunkIterator) advance(next *Chunk) {
+	iter.next = next
+	if next.schema != nil {
+		iter.schemas = append(iter.schemas, *next.schema)
+	}
+	iter.catcher.Add(iter.history.add(next))
+	iter.catcher.Add(iter.descs.add(next))
+}
+
 // Chunk returns a copy of the chunk processed by the iterator. You
 // must call Chunk no more than once per iteration. Additional
 // accesses to Chunk will panic.
@@ -83,6 +118,33 @@ func (iter *ChunkIterator) Chunk() *Chunk {
 	return iter.next
 }
 
+// SchemaTransitions returns the schema changes recorded in the chunks
+// that the iterator has returned so far, in order. Only data written
+// by schema tracking collectors (see
+// NewStreamingSchemaTrackingCollector) records schema changes.
+func (iter *ChunkIterator) SchemaTransitions() []SchemaTransition { return iter.schemas }
+
+// MetadataHistory returns the distinct metadata documents of the
+// chunks that the iterator has returned so far, in order. For data
+// written by metadata collectors (see NewMetadataCollector), this is
+// the history of metadata documents, with the times at which they
+// were recorded, and otherwise it holds the metadata document of each
+// collector with the time of the first chunk that it wrote.
+func (iter *ChunkIterator) MetadataHistory() []MetadataEntry { return iter.history.entries }
+
+// MetricDescriptors returns the descriptors of metrics recorded in the
+// chunks that the iterator has returned so far, by flattened name.
+// Only data written by descriptor collectors (see
+// NewDescriptorCollector) records descriptors, and the descriptors of
+// later chunks replace those of earlier chunks.
+func (iter *ChunkIterator) MetricDescriptors() map[string]MetricDescriptor {
+	out := make(map[string]MetricDescriptor, len(iter.descs.descriptors))
+	for key, desc := range iter.descs.descriptors {
+		out[key] = desc
+	}
+	return out
+}
+
 // Close releases resources of the iterator. Use this method to
 // release those resources if you stop iterating before the iterator
 // is exhausted. Canceling the context that you used to create the
@@ -91,4 +153,4 @@ func (iter *ChunkIterator) Close() { iter.cancel(); iter.closed = true }
 
 // Err returns a non-nil error if the iterator encountered any errors
 // during iteration.
-func (iter *ChunkIterator) Err() error { return iter.catcher.Resolve() }
+func (iter *ChunkIterator) Err() error { return resolveErrors(iter.catcher) }
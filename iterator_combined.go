@@ -30,7 +30,7 @@ func (iter *combinedIterator) Close() {
 	}
 }
 
-func (iter *combinedIterator) Err() error                { return iter.catcher.Resolve() }
+func (iter *combinedIterator) Err() error                { return resolveErrors(iter.catcher) }
 func (iter *combinedIterator) Metadata() *bsonx.Document { return iter.metadata }
 func (iter *combinedIterator) Document() *bsonx.Document { return iter.document }
 
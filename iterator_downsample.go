@@ -0,0 +1,304 @@
+package ftdc
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// Aggregation describes how the samples within a window are combined
+// by a downsampling iterator.
+type Aggregation string
+
+const (
+	// AggregateMean produces the arithmetic mean of the values in
+	// the window, as a double (or date time, for date time
+	// metrics.)
+	AggregateMean Aggregation = "mean"
+	// AggregateMin produces the smallest value in the window.
+	AggregateMin Aggregation = "min"
+	// AggregateMax produces the largest value in the window.
+	AggregateMax Aggregation = "max"
+	// AggregateLast produces the last value in the window.
+	AggregateLast Aggregation = "last"
+	// AggregateSum produces the sum of the values in the window,
+	// as a double for double metrics, and as an int64 otherwise.
+	// Date time metrics use the last value in the window.
+	AggregateSum Aggregation = "sum"
+)
+
+// Validate returns an error if the aggregation is not one of the
+// defined aggregations.
+func (a Aggregation) Validate() error {
+	switch a {
+	case AggregateMean, AggregateMin, AggregateMax, AggregateLast, AggregateSum:
+		return nil
+	default:
+		return errors.Errorf("invalid aggregation '%s'", a)
+	}
+}
+
+type downsamplingIterator struct {
+	closer   context.CancelFunc
+	chunks   *ChunkIterator
+	window   time.Duration
+	agg      Aggregation
+	metadata *bsonx.Document
+	document *bsonx.Document
+	pipe     chan *bsonx.Document
+	catcher  grip.Catcher
+}
+
+// NewDownsamplingIterator returns an iterator of flattened documents,
+// with one document for each window of time that contains samples,
+// where each metric holds the aggregation of its values in that
+// window. Windows are aligned to multiples of the window duration
+// since the Unix epoch, and the first date time metric of each
+// document holds the start of its window.
+//
+// Sample times are derived from the first date time metric in each
+// chunk, and the iterator reports an error for chunks without a date
+// time metric. When the metrics change between chunks, the current
+// window ends and a new window begins.
+//
+// The iterator takes ownership of the chunk iterator, and closes it
+// when the iterator is closed.
+func NewDownsamplingIterator(iter *ChunkIterator, window time.Duration, agg Aggregation) Iterator {
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &downsamplingIterator{
+		closer:  cancel,
+		chunks:  iter,
+		window:  window,
+		agg:     agg,
+		pipe:    make(chan *bsonx.Document, 100),
+		catcher: grip.NewBasicCatcher(),
+	}
+
+	out.catcher.NewWhen(window <= 0, "window must be positive")
+	out.catcher.Add(agg.Validate())
+	if out.catcher.HasErrors() {
+		close(out.pipe)
+		return out
+	}
+
+	go out.worker(ctx)
+	return out
+}
+
+func (iter *downsamplingIterator) Close() {
+	iter.closer()
+	iter.chunks.Close()
+}
+
+func (iter *downsamplingIterator) Err() error                { return iter.catcher.Resolve() }
+func (iter *downsamplingIterator) Metadata() *bsonx.Document { return iter.metadata }
+func (iter *downsamplingIterator) Document() *bsonx.Document { return iter.document }
+
+func (iter *downsamplingIterator) Next() bool {
+	doc, ok := <-iter.pipe
+	if !ok {
+		return false
+	}
+
+	iter.document = doc
+	return true
+}
+
+func (iter *downsamplingIterator) worker(ctx context.Context) {
+	defer close(iter.pipe)
+
+	var current *windowAggregator
+
+	emit := func() bool {
+		if current == nil {
+			return true
+		}
+
+		select {
+		case iter.pipe <- current.document(iter.agg):
+			current = nil
+			return true
+		case <-ctx.Done():
+			iter.catcher.Add(errors.New("operation aborted"))
+			return false
+		}
+	}
+
+	for iter.chunks.Next() {
+		chunk := iter.chunks.Chunk()
+		if metadata := chunk.GetMetadata(); metadata != nil {
+			iter.metadata = metadata
+		}
+
+		times := chunk.sampleTimes()
+		if times == nil {
+			iter.catcher.Add(errors.New("cannot downsample chunk without a date time metric"))
+			return
+		}
+
+		if current != nil && !current.compatible(chunk) {
+			if !emit() {
+				return
+			}
+		}
+
+		for idx, ts := range times {
+			start := ts.Truncate(iter.window)
+			if current != nil && !current.start.Equal(start) {
+				if !emit() {
+					return
+				}
+			}
+
+			if current == nil {
+				current = newWindowAggregator(chunk, start)
+			}
+
+			current.add(chunk, idx)
+		}
+	}
+
+	iter.catcher.Add(iter.chunks.Err())
+	emit()
+}
+
+// windowAggregator accumulates the values of each metric for the
+// samples in a single window.
+type windowAggregator struct {
+	start   time.Time
+	keys    []string
+	types   []bsontype.Type
+	clock   int
+	count   int
+	sums    []float64
+	isums   []int64
+	mins    []int64
+	maxs    []int64
+	lasts   []int64
+	started bool
+}
+
+func newWindowAggregator(chunk *Chunk, start time.Time) *windowAggregator {
+	num := len(chunk.Metrics)
+	agg := &windowAggregator{
+		start: start,
+		keys:  make([]string, num),
+		types: make([]bsontype.Type, num),
+		clock: -1,
+		sums:  make([]float64, num),
+		isums: make([]int64, num),
+		mins:  make([]int64, num),
+		maxs:  make([]int64, num),
+		lasts: make([]int64, num),
+	}
+
+	for idx := range chunk.Metrics {
+		agg.keys[idx] = chunk.Metrics[idx].Key()
+		agg.types[idx] = chunk.Metrics[idx].originalType
+		if agg.clock < 0 && agg.types[idx] == bsontype.DateTime {
+			agg.clock = idx
+		}
+	}
+
+	return agg
+}
+
+// compatible returns true if the chunk has the same metrics as the
+// chunks previously added to the aggregator.
+func (a *windowAggregator) compatible(chunk *Chunk) bool {
+	if len(chunk.Metrics) != len(a.keys) {
+		return false
+	}
+
+	for idx := range chunk.Metrics {
+		if chunk.Metrics[idx].originalType != a.types[idx] || chunk.Metrics[idx].Key() != a.keys[idx] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a *windowAggregator) less(idx int, lhs, rhs int64) bool {
+	if a.types[idx] == bsontype.Double {
+		return restoreFloat(lhs) < restoreFloat(rhs)
+	}
+
+	return lhs < rhs
+}
+
+func (a *windowAggregator) add(chunk *Chunk, sample int) {
+	for idx := range chunk.Metrics {
+		value := chunk.Metrics[idx].Values[sample]
+
+		if a.types[idx] == bsontype.Double {
+			a.sums[idx] += restoreFloat(value)
+		} else {
+			a.sums[idx] += float64(value)
+			a.isums[idx] += value
+		}
+
+		if !a.started || a.less(idx, value, a.mins[idx]) {
+			a.mins[idx] = value
+		}
+		if !a.started || a.less(idx, a.maxs[idx], value) {
+			a.maxs[idx] = value
+		}
+		a.lasts[idx] = value
+	}
+
+	a.started = true
+	a.count++
+}
+
+func (a *windowAggregator) document(agg Aggregation) *bsonx.Document {
+	doc := bsonx.DC.Make(len(a.keys))
+
+	for idx, key := range a.keys {
+		if idx == a.clock {
+			doc.Append(bsonx.EC.Time(key, a.start))
+			continue
+		}
+
+		var (
+			elem *bsonx.Element
+			ok   bool
+		)
+
+		switch agg {
+		case AggregateMin:
+			elem, ok = restoreFlat(a.types[idx], key, a.mins[idx])
+		case AggregateMax:
+			elem, ok = restoreFlat(a.types[idx], key, a.maxs[idx])
+		case AggregateLast:
+			elem, ok = restoreFlat(a.types[idx], key, a.lasts[idx])
+		case AggregateMean:
+			mean := a.sums[idx] / float64(a.count)
+			if a.types[idx] == bsontype.DateTime {
+				elem, ok = bsonx.EC.Time(key, timeEpocMs(int64(math.Round(mean)))), true
+			} else {
+				elem, ok = bsonx.EC.Double(key, mean), true
+			}
+		case AggregateSum:
+			switch a.types[idx] {
+			case bsontype.DateTime:
+				elem, ok = restoreFlat(a.types[idx], key, a.lasts[idx])
+			case bsontype.Double:
+				elem, ok = bsonx.EC.Double(key, a.sums[idx]), true
+			default:
+				elem, ok = bsonx.EC.Int64(key, a.isums[idx]), true
+			}
+		}
+
+		if ok {
+			doc.Append(elem)
+		}
+	}
+
+	return doc
+}
@@ -0,0 +1,151 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownsamplingIterator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	// 30 samples, one per second, in chunks of 7 samples, so that
+	// windows span chunk boundaries.
+	buf := &bytes.Buffer{}
+	collector := NewStreamingCollector(7, buf)
+	for i := 0; i < 30; i++ {
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("counter", int64(i)),
+			bsonx.EC.Int32("gauge", int32(i%4)),
+			bsonx.EC.SubDocument("nested", bsonx.NewDocument(bsonx.EC.Boolean("flag", i == 12))),
+		)))
+	}
+	require.NoError(t, FlushCollector(collector, buf))
+	data := buf.Bytes()
+
+	t.Run("InvalidArguments", func(t *testing.T) {
+		for name, test := range map[string]struct {
+			window time.Duration
+			agg    Aggregation
+		}{
+			"ZeroWindow":     {agg: AggregateMean},
+			"NegativeWindow": {window: -time.Second, agg: AggregateMean},
+			"Aggregation":    {window: time.Second, agg: "median"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				iter := NewDownsamplingIterator(ReadChunks(ctx, bytes.NewBuffer(data)), test.window, test.agg)
+				defer iter.Close()
+				assert.False(t, iter.Next())
+				assert.Error(t, iter.Err())
+			})
+		}
+	})
+	t.Run("NoTimestamps", func(t *testing.T) {
+		iter := NewDownsamplingIterator(ReadChunks(ctx, bytes.NewBuffer(newFlatChunk(t, 10))), time.Second, AggregateMean)
+		defer iter.Close()
+		assert.False(t, iter.Next())
+		assert.Error(t, iter.Err())
+	})
+	for name, test := range map[Aggregation]struct {
+		counter []interface{}
+		gauge   []interface{}
+		flag    []interface{}
+	}{
+		AggregateMean: {
+			counter: []interface{}{4.5, 14.5, 24.5},
+			gauge:   []interface{}{1.3, 1.7, 1.3},
+			flag:    []interface{}{0.0, 0.1, 0.0},
+		},
+		AggregateMin: {
+			counter: []interface{}{int64(0), int64(10), int64(20)},
+			gauge:   []interface{}{int32(0), int32(0), int32(0)},
+			flag:    []interface{}{false, false, false},
+		},
+		AggregateMax: {
+			counter: []interface{}{int64(9), int64(19), int64(29)},
+			gauge:   []interface{}{int32(3), int32(3), int32(3)},
+			flag:    []interface{}{false, true, false},
+		},
+		AggregateLast: {
+			counter: []interface{}{int64(9), int64(19), int64(29)},
+			gauge:   []interface{}{int32(1), int32(3), int32(1)},
+			flag:    []interface{}{false, false, false},
+		},
+		AggregateSum: {
+			counter: []interface{}{int64(45), int64(145), int64(245)},
+			gauge:   []interface{}{int64(13), int64(17), int64(13)},
+			flag:    []interface{}{int64(0), int64(1), int64(0)},
+		},
+	} {
+		t.Run(string(name), func(t *testing.T) {
+			iter := NewDownsamplingIterator(ReadChunks(ctx, bytes.NewBuffer(data)), 10*time.Second, name)
+			defer iter.Close()
+
+			idx := 0
+			for iter.Next() {
+				require.True(t, idx < 3)
+				doc := iter.Document()
+				require.Equal(t, 4, doc.Len())
+
+				assert.True(t, base.Add(time.Duration(idx)*10*time.Second).Equal(doc.Lookup("ts").Time()))
+				for key, expected := range map[string]interface{}{
+					"counter":     test.counter[idx],
+					"gauge":       test.gauge[idx],
+					"nested.flag": test.flag[idx],
+				} {
+					actual := doc.Lookup(key).Interface()
+					if f, ok := expected.(float64); ok {
+						assert.InDelta(t, f, actual, 0.0001, key)
+					} else {
+						assert.Equal(t, expected, actual, key)
+					}
+				}
+				idx++
+			}
+			require.NoError(t, iter.Err())
+			assert.Equal(t, 3, idx)
+		})
+	}
+	t.Run("SchemaChange", func(t *testing.T) {
+		other := &bytes.Buffer{}
+		collector := NewBaseCollector(10)
+		for i := 0; i < 5; i++ {
+			require.NoError(t, collector.Add(bsonx.NewDocument(
+				bsonx.EC.Time("ts", base.Add(time.Duration(30+i)*time.Second)),
+				bsonx.EC.Int64("other", int64(i)),
+			)))
+		}
+		require.NoError(t, FlushCollector(collector, other))
+
+		iter := NewDownsamplingIterator(ReadChunks(ctx, bytes.NewBuffer(append(append([]byte{}, data...), other.Bytes()...))), time.Minute, AggregateLast)
+		defer iter.Close()
+
+		require.True(t, iter.Next())
+		assert.EqualValues(t, 29, iter.Document().Lookup("counter").Int64())
+		require.True(t, iter.Next())
+		assert.EqualValues(t, 4, iter.Document().Lookup("other").Int64())
+		assert.True(t, base.Equal(iter.Document().Lookup("ts").Time()))
+		assert.False(t, iter.Next())
+		assert.NoError(t, iter.Err())
+	})
+}
+
+func newFlatChunk(t *testing.T, num int) []byte {
+	collector := NewBaseCollector(num)
+	for i := 0; i < num; i++ {
+		require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("value", int64(i)))))
+	}
+	out, err := collector.Resolve()
+	require.NoError(t, err)
+
+	return out
+}
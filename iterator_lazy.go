@@ -0,0 +1,297 @@
+package ftdc
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// ReadLazyMetrics returns a document iterator that reads FTDC chunks,
+// and returns the same flattened documents as ReadMetrics. Rather
+// than expanding every value of a chunk before returning its first
+// sample, the iterator keeps the decompressed payload of the current
+// chunk, and decodes the deltas of one sample at a time, when the
+// iterator is advanced, so that the memory used by the iterator is
+// proportional to the size of the payload, rather than to the number
+// of values in the chunk.
+//
+// The iterator decodes samples on the goroutine that calls Next, and
+// does not read ahead of the consumer.
+func ReadLazyMetrics(ctx context.Context, r io.Reader) Iterator {
+	iterctx, cancel := context.WithCancel(ctx)
+	iter := &lazyIterator{
+		closer:  cancel,
+		docs:    make(chan *bsonx.Document),
+		catcher: grip.NewBasicCatcher(),
+	}
+
+	go func() {
+		iter.catcher.Add(readDiagnostic(iterctx, r, iter.docs))
+	}()
+
+	return iter
+}
+
+type lazyIterator struct {
+	closer   context.CancelFunc
+	docs     chan *bsonx.Document
+	chunk    *lazyChunk
+	metadata *bsonx.Document
+	document *bsonx.Document
+	catcher  grip.Catcher
+	failed   bool
+}
+
+func (iter *lazyIterator) Close()                    { iter.closer() }
+func (iter *lazyIterator) Err() error                { return resolveErrors(iter.catcher) }
+func (iter *lazyIterator) Metadata() *bsonx.Document { return iter.metadata }
+func (iter *lazyIterator) Document() *bsonx.Document { return iter.document }
+
+func (iter *lazyIterator) Next() bool {
+	if iter.failed {
+		return false
+	}
+
+	for {
+		if iter.chunk != nil && iter.chunk.hasNext() {
+			doc, err := iter.chunk.next()
+			if err != nil {
+				iter.fail(err)
+				return false
+			}
+
+			iter.document = doc
+			return true
+		}
+		iter.chunk = nil
+
+		doc, ok := <-iter.docs
+		if !ok {
+			return false
+		}
+
+		docType := doc.Lookup("type")
+		if isNum(0, docType) {
+			iter.metadata = doc
+			continue
+		} else if !isNum(1, docType) {
+			continue
+		}
+
+		chunk, err := newLazyChunk(doc)
+		recordDecode(err)
+		if err != nil {
+			iter.fail(err)
+			return false
+		}
+		iter.chunk = chunk
+	}
+}
+
+func (iter *lazyIterator) fail(err error) {
+	iter.catcher.Add(err)
+	iter.failed = true
+	iter.closer()
+}
+
+// lazyChunk decodes the samples of a chunk one at a time, with a
+// cursor into the payload for each column of deltas.
+type lazyChunk struct {
+	metrics []Metric
+	keys    []string
+	columns []deltaCursor
+	xor     bool
+	dod     bool
+	nPoints int
+	sample  int
+}
+
+// deltaCursor holds the position in the payload of the next delta of
+// a column, and the current value of its metric, as well as the
+// previous delta, for columns with delta-of-delta encoding.
+type deltaCursor struct {
+	data    []byte
+	nzeroes uint64
+	value   int64
+	delta   int64
+}
+
+func newLazyChunk(doc *bsonx.Document) (*lazyChunk, error) {
+	_, payload, err := readChunkPayload(doc)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// the payload begins with the reference document, followed by
+	// the number of metrics and the number of deltas, and then
+	// by the deltas of each column.
+	if len(payload) < 4 {
+		return nil, errors.New("payload is too short")
+	}
+	size := int(binary.LittleEndian.Uint32(payload))
+	if size < 5 || size+8 > len(payload) {
+		return nil, errors.Errorf("invalid reference document size %d", size)
+	}
+	ref, err := bsonx.ReadDocument(payload[:size])
+	if err != nil {
+		return nil, errors.Wrap(err, "problem reading reference doc")
+	}
+	metrics := metricForDocument([]string{}, ref)
+
+	nmetrics := int(binary.LittleEndian.Uint32(payload[size:]))
+	ndeltas := int(binary.LittleEndian.Uint32(payload[size+4:]))
+	if nmetrics != len(metrics) {
+		return nil, errors.Errorf("metrics mismatch, file likely corrupt Expected %d, got %d", nmetrics, len(metrics))
+	}
+
+	order, err := readColumnOrder(doc, nmetrics)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	xor, err := xorFloatsEnabled(doc)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	dod, err := dodTimesEnabled(doc)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	chunk := &lazyChunk{
+		metrics: metrics,
+		keys:    make([]string, len(metrics)),
+		columns: make([]deltaCursor, len(metrics)),
+		xor:     xor,
+		dod:     dod,
+		nPoints: ndeltas + 1,
+	}
+
+	// find the start of each column, which also checks that the
+	// payload holds every delta. Runs of zeros span columns, so
+	// each column starts with the zeros that remain from the
+	// previous column.
+	data := payload[size+8:]
+	var nzeroes uint64
+	for _, i := range order {
+		chunk.keys[i] = metrics[i].Key()
+		chunk.columns[i] = deltaCursor{
+			data:    data,
+			nzeroes: nzeroes,
+			value:   metrics[i].startingValue,
+		}
+
+		var n int
+		if n, nzeroes, err = skipDeltaBytes(data, ndeltas, nzeroes); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		data = data[n:]
+	}
+
+	return chunk, nil
+}
+
+func (c *lazyChunk) hasNext() bool { return c.sample < c.nPoints }
+
+// next returns the flattened document of the next sample.
+func (c *lazyChunk) next() (*bsonx.Document, error) {
+	doc := bsonx.DC.Make(len(c.metrics))
+	for i := range c.metrics {
+		if c.sample > 0 {
+			if err := c.advance(i); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+
+		if elem, ok := restoreFlat(c.metrics[i].originalType, c.keys[i], c.columns[i].value); ok {
+			doc.Append(elem)
+		}
+	}
+	c.sample++
+
+	return doc, nil
+}
+
+// advance decodes the next delta of the column of the i-th metric,
+// and updates the value of the column.
+func (c *lazyChunk) advance(i int) error {
+	col := &c.columns[i]
+	delta, err := col.next()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if c.metrics[i].originalType == bsontype.DateTime && c.dod {
+		col.delta += unzigzag(delta)
+		delta = col.delta
+	}
+
+	switch {
+	case c.metrics[i].originalType == bsontype.Double && c.xor:
+		col.value ^= delta
+	case c.metrics[i].originalType == bsontype.Double:
+		col.value = delta
+	default:
+		col.value += delta
+	}
+
+	return nil
+}
+
+func (c *deltaCursor) next() (int64, error) {
+	if c.nzeroes != 0 {
+		c.nzeroes--
+		return 0, nil
+	}
+
+	delta, n := binary.Uvarint(c.data)
+	if n <= 0 {
+		return 0, errors.New("reached unexpected end of encoded integer")
+	}
+	c.data = c.data[n:]
+
+	if delta == 0 {
+		if c.nzeroes, n = binary.Uvarint(c.data); n <= 0 {
+			return 0, errors.New("reached unexpected end of encoded integer")
+		}
+		c.data = c.data[n:]
+	}
+
+	return int64(delta), nil
+}
+
+// skipDeltaBytes is the same as skipDeltas, except that it reads the
+// deltas from a slice, and also returns the number of bytes read.
+func skipDeltaBytes(data []byte, ndeltas int, nzeroes uint64) (int, uint64, error) {
+	var offset int
+	for j := 0; j < ndeltas; {
+		if nzeroes != 0 {
+			n := uint64(ndeltas - j)
+			if nzeroes < n {
+				n = nzeroes
+			}
+			nzeroes -= n
+			j += int(n)
+			continue
+		}
+
+		delta, n := binary.Uvarint(data[offset:])
+		if n <= 0 {
+			return 0, 0, errors.New("reached unexpected end of encoded integer")
+		}
+		offset += n
+		if delta == 0 {
+			if nzeroes, n = binary.Uvarint(data[offset:]); n <= 0 {
+				return 0, 0, errors.New("reached unexpected end of encoded integer")
+			}
+			offset += n
+		}
+		j++
+	}
+
+	return offset, nzeroes, nil
+}
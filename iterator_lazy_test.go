@@ -0,0 +1,107 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLazyMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	readAll := func(t *testing.T, iter Iterator) []*bsonx.Document {
+		defer iter.Close()
+		out := []*bsonx.Document{}
+		for iter.Next() {
+			out = append(out, iter.Document())
+		}
+		require.NoError(t, iter.Err())
+		return out
+	}
+	resolve := func(t *testing.T, collector Collector) []byte {
+		buf := &bytes.Buffer{}
+		for i := 0; i < 250; i++ {
+			doc := bsonx.NewDocument(
+				bsonx.EC.Time("ts", time.Unix(int64(i), 0)),
+				bsonx.EC.Int64("counter", int64(i*i)),
+				bsonx.EC.Int32("constant", 42),
+				bsonx.EC.Boolean("even", i%2 == 0),
+				bsonx.EC.Double("ratio", math.Sqrt(float64(i))),
+				bsonx.EC.SubDocumentFromElements("nested",
+					bsonx.EC.Int64("idle", 0),
+					bsonx.EC.Int64("negative", int64(-i))),
+			)
+			require.NoError(t, collector.Add(doc))
+			if collector.Info().SampleCount == 100 {
+				require.NoError(t, FlushCollector(collector, buf))
+			}
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+		return buf.Bytes()
+	}
+
+	for name, collector := range map[string]Collector{
+		"Base":            NewBaseCollector(1000),
+		"Grouping":        NewGroupingCollector(1000),
+		"FloatPreserving": NewFloatPreservingCollector(1000),
+	} {
+		t.Run(name, func(t *testing.T) {
+			data := resolve(t, collector)
+
+			expected := readAll(t, ReadMetrics(ctx, bytes.NewReader(data)))
+			require.Len(t, expected, 250)
+			actual := readAll(t, ReadLazyMetrics(ctx, bytes.NewReader(data)))
+			require.Len(t, actual, len(expected))
+			for idx := range expected {
+				require.True(t, expected[idx].Equal(actual[idx]), fmt.Sprintf("sample %d: %s != %s", idx, expected[idx], actual[idx]))
+			}
+			assert.Equal(t, int64(-249), actual[249].Lookup("nested.negative").Int64())
+		})
+	}
+	t.Run("Metadata", func(t *testing.T) {
+		collector := NewBaseCollector(10)
+		require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "a"))))
+		require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("a", 1))))
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		iter := ReadLazyMetrics(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		require.NotNil(t, iter.Metadata())
+		assert.Equal(t, "a", iter.Metadata().LookupPath("doc.host").StringValue())
+	})
+	t.Run("CorruptChunk", func(t *testing.T) {
+		data := resolve(t, NewBaseCollector(1000))
+		corrupt, err := bsonx.NewDocument(
+			bsonx.EC.Int32("type", 1),
+			bsonx.EC.Binary("data", []byte("not a zlib stream")),
+		).MarshalBSON()
+		require.NoError(t, err)
+
+		iter := ReadLazyMetrics(ctx, bytes.NewReader(append(append(append([]byte{}, data...), corrupt...), data...)))
+		defer iter.Close()
+		count := 0
+		for iter.Next() {
+			count++
+		}
+		assert.Equal(t, 250, count)
+		assert.Error(t, iter.Err())
+		assert.False(t, iter.Next())
+	})
+	t.Run("EarlyClose", func(t *testing.T) {
+		data := resolve(t, NewBaseCollector(1000))
+		iter := ReadLazyMetrics(ctx, bytes.NewReader(data))
+		require.True(t, iter.Next())
+		iter.Close()
+		assert.NoError(t, iter.Err())
+	})
+}
@@ -0,0 +1,259 @@
+package ftdc
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/mongodb/grip"
+)
+
+// NewChunkIteratorWithRange creates a ChunkIterator that only
+// returns the samples collected within the [start, end) time range.
+//
+// Chunks whose reference time (the _id of the chunk document) falls
+// after the end of the range, or which are followed by a chunk that
+// begins before the start of the range, are skipped without being
+// decompressed. Chunks that overlap the boundaries of the range are
+// decoded and trimmed so that they only contain samples within the
+// range. Sample times are derived from the first date time metric in
+// each chunk; chunks without a date time metric are not trimmed.
+//
+// Use a zero time for either start or end to leave that side of the
+// range unbounded.
+func NewChunkIteratorWithRange(ctx context.Context, r io.Reader, start, end time.Time) *ChunkIterator {
+	iter := &ChunkIterator{
+		catcher: grip.NewBasicCatcher(),
+		pipe:    make(chan *Chunk, 2),
+	}
+
+	ipc := make(chan *bsonx.Document)
+	filtered := make(chan *bsonx.Document)
+	chunks := make(chan *Chunk)
+	ctx, iter.cancel = context.WithCancel(ctx)
+
+	go func() {
+		iter.catcher.Add(readDiagnostic(ctx, r, ipc))
+	}()
+
+	go func() {
+		filterChunkDocumentRange(ctx, ipc, filtered, start, end)
+	}()
+
+	go func() {
+		iter.catcher.Add(readChunks(ctx, filtered, chunks))
+	}()
+
+	go func() {
+		trimChunkRange(ctx, chunks, iter.pipe, start, end)
+	}()
+
+	return iter
+}
+
+// NewFilteredChunkIterator is the same as NewChunkIteratorWithRange,
+// except that the chunks only hold the metrics whose keys match, as
+// with ReadMetricsFiltered, and chunks without matching metrics are
+// skipped. If the matcher is nil, chunks hold every metric.
+//
+// Chunks are only trimmed to the range if the matcher matches a date
+// time metric.
+func NewFilteredChunkIterator(ctx context.Context, r io.Reader, start, end time.Time, matcher KeyMatcher) *ChunkIterator {
+	var include func(*Metric) bool
+	if matcher != nil {
+		include = func(m *Metric) bool { return matcher.MatchKey(m.Key()) }
+	}
+
+	iter := &ChunkIterator{
+		catcher: grip.NewBasicCatcher(),
+		pipe:    make(chan *Chunk, 2),
+	}
+
+	ipc := make(chan *bsonx.Document)
+	filtered := make(chan *bsonx.Document)
+	chunks := make(chan *Chunk)
+	ctx, iter.cancel = context.WithCancel(ctx)
+
+	go func() {
+		iter.catcher.Add(readDiagnostic(ctx, r, ipc))
+	}()
+
+	go func() {
+		filterChunkDocumentRange(ctx, ipc, filtered, start, end)
+	}()
+
+	go func() {
+		iter.catcher.Add(readFilteredChunks(ctx, filtered, chunks, include, nil))
+	}()
+
+	go func() {
+		trimChunkRange(ctx, chunks, iter.pipe, start, end)
+	}()
+
+	return iter
+}
+
+// filterChunkDocumentRange drops metric chunk documents that cannot
+// contain samples in the specified range, without decoding their
+// payload. Other documents (e.g. metadata) pass through unmodified.
+//
+// Because samples in a chunk are collected before the beginning of
+// the following chunk, chunks that begin before the start of the
+// range are held until the next chunk is read to determine if they
+// overlap with the range.
+func filterChunkDocumentRange(ctx context.Context, in <-chan *bsonx.Document, out chan<- *bsonx.Document, start, end time.Time) {
+	defer close(out)
+
+	var pending *bsonx.Document
+
+	send := func(doc *bsonx.Document) bool {
+		select {
+		case out <- doc:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for doc := range in {
+		id, ok := doc.Lookup("_id").TimeOK()
+		if !isNum(1, doc.Lookup("type")) || !ok {
+			if pending != nil {
+				if !send(pending) {
+					return
+				}
+				pending = nil
+			}
+
+			if !send(doc) {
+				return
+			}
+			continue
+		}
+
+		if pending != nil {
+			if start.IsZero() || id.After(start) {
+				if !send(pending) {
+					return
+				}
+			}
+			pending = nil
+		}
+
+		if !end.IsZero() && !id.Before(end) {
+			continue
+		}
+
+		if !start.IsZero() && id.Before(start) {
+			pending = doc
+			continue
+		}
+
+		if !send(doc) {
+			return
+		}
+	}
+
+	if pending != nil {
+		send(pending)
+	}
+}
+
+// trimChunkRange removes samples that fall outside of the time range
+// from chunks, dropping chunks that do not have any samples in the
+// range, or any metrics.
+func trimChunkRange(ctx context.Context, in <-chan *Chunk, out chan<- *Chunk, start, end time.Time) {
+	defer close(out)
+
+	for chunk := range in {
+		if len(chunk.Metrics) == 0 {
+			continue
+		}
+		chunk = chunk.trimRange(start, end)
+		if chunk == nil {
+			continue
+		}
+
+		select {
+		case out <- chunk:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sampleTimes returns the timestamp of each sample in the chunk,
+// using the first date time metric in the chunk. Returns nil if the
+// chunk does not have a date time metric.
+func (c *Chunk) sampleTimes() []time.Time {
+	for _, m := range c.Metrics {
+		if m.originalType != bsontype.DateTime {
+			continue
+		}
+
+		out := make([]time.Time, len(m.Values))
+		for idx, v := range m.Values {
+			out[idx] = timeEpocMs(v)
+		}
+		return out
+	}
+
+	return nil
+}
+
+// trimRange returns a chunk containing only the samples in the
+// [start, end) range, or nil if there are no samples in the range.
+func (c *Chunk) trimRange(start, end time.Time) *Chunk {
+	times := c.sampleTimes()
+	if times == nil {
+		return c
+	}
+
+	first, last := -1, -1
+	for idx, ts := range times {
+		if !start.IsZero() && ts.Before(start) {
+			continue
+		}
+		if !end.IsZero() && !ts.Before(end) {
+			continue
+		}
+
+		if first < 0 {
+			first = idx
+		}
+		last = idx
+	}
+
+	if first < 0 {
+		return nil
+	}
+
+	if first == 0 && last == c.nPoints-1 {
+		return c
+	}
+
+	return c.slice(first, last+1)
+}
+
+// slice returns a copy of the chunk that contains only the samples in
+// the [low, high) range of sample indexes.
+func (c *Chunk) slice(low, high int) *Chunk {
+	out := &Chunk{
+		Metrics:   make([]Metric, len(c.Metrics)),
+		nPoints:   high - low,
+		id:        c.id,
+		metadata:  c.metadata,
+		periodic:  c.periodic,
+		reference: c.reference,
+	}
+
+	for idx, m := range c.Metrics {
+		m.Values = m.Values[low:high]
+		m.startingValue = m.Values[0]
+		out.Metrics[idx] = m
+	}
+
+	return out
+}
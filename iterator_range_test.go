@@ -0,0 +1,127 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkIteratorWithRange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	// three chunks of ten samples, one sample per second
+	buf := &bytes.Buffer{}
+	for start := 0; start < 30; start += 10 {
+		collector := &betterCollector{maxDeltas: 10, start: base.Add(time.Duration(start) * time.Second)}
+		for i := start; i < start+10; i++ {
+			require.NoError(t, collector.Add(bsonx.NewDocument(
+				bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+				bsonx.EC.Int64("counter", int64(i)),
+			)))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+	}
+	data := buf.Bytes()
+
+	sampleTimes := func(t *testing.T, iter *ChunkIterator) []int64 {
+		defer iter.Close()
+
+		out := []int64{}
+		for iter.Next() {
+			chunk := iter.Chunk()
+			times := chunk.sampleTimes()
+			require.Len(t, times, chunk.nPoints)
+			for _, m := range chunk.Metrics {
+				require.Len(t, m.Values, chunk.nPoints)
+			}
+			for idx, ts := range times {
+				out = append(out, int64(ts.Sub(base)/time.Second))
+				assert.EqualValues(t, out[len(out)-1], chunk.Metrics[1].Values[idx])
+			}
+		}
+		require.NoError(t, iter.Err())
+
+		return out
+	}
+
+	seconds := func(low, high int64) []int64 {
+		out := []int64{}
+		for i := low; i < high; i++ {
+			out = append(out, i)
+		}
+		return out
+	}
+
+	at := func(sec int) time.Time { return base.Add(time.Duration(sec) * time.Second) }
+
+	for name, test := range map[string]struct {
+		start    time.Time
+		end      time.Time
+		expected []int64
+	}{
+		"Unbounded":         {expected: seconds(0, 30)},
+		"OpenStart":         {end: at(15), expected: seconds(0, 15)},
+		"OpenEnd":           {start: at(15), expected: seconds(15, 30)},
+		"WithinChunk":       {start: at(12), end: at(17), expected: seconds(12, 17)},
+		"SpanningChunks":    {start: at(5), end: at(25), expected: seconds(5, 25)},
+		"ChunkBoundaries":   {start: at(10), end: at(20), expected: seconds(10, 20)},
+		"BeforeData":        {end: base.Add(-time.Hour), expected: []int64{}},
+		"AfterData":         {start: at(30), expected: []int64{}},
+		"SingleSample":      {start: at(29), end: at(30), expected: []int64{29}},
+		"EndBeforeStart":    {start: at(20), end: at(10), expected: []int64{}},
+		"SubsecondBoundary": {start: at(9).Add(time.Millisecond), end: at(11), expected: []int64{10}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			iter := NewChunkIteratorWithRange(ctx, bytes.NewBuffer(data), test.start, test.end)
+			assert.Equal(t, test.expected, sampleTimes(t, iter))
+		})
+	}
+	t.Run("SkipsChunksOutsideRange", func(t *testing.T) {
+		in := make(chan *bsonx.Document, 10)
+		out := make(chan *bsonx.Document, 10)
+
+		iter := ReadChunks(ctx, bytes.NewBuffer(data))
+		ids := []time.Time{}
+		for iter.Next() {
+			ids = append(ids, iter.Chunk().id)
+			in <- bsonx.NewDocument(
+				bsonx.EC.Time("_id", iter.Chunk().id),
+				bsonx.EC.Int32("type", 1),
+			)
+		}
+		iter.Close()
+		close(in)
+		require.Len(t, ids, 3)
+
+		filterChunkDocumentRange(ctx, in, out, at(12), at(18))
+		docs := []*bsonx.Document{}
+		for doc := range out {
+			docs = append(docs, doc)
+		}
+		require.Len(t, docs, 1)
+		assert.Equal(t, ids[1], docs[0].Lookup("_id").Time())
+	})
+	t.Run("WithoutTimestamps", func(t *testing.T) {
+		collector := NewBaseCollector(10)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("counter", int64(i)))))
+		}
+		out, err := collector.Resolve()
+		require.NoError(t, err)
+
+		iter := NewChunkIteratorWithRange(ctx, bytes.NewBuffer(out), time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		assert.Equal(t, 10, iter.Chunk().nPoints)
+		assert.False(t, iter.Next())
+		assert.NoError(t, iter.Err())
+	})
+}
@@ -0,0 +1,330 @@
+package ftdc
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// chunkIndex holds the locations of the metric chunk documents in a
+// seekable FTDC data source, and the location of the metadata
+// document that precedes each chunk, if any.
+type chunkIndex struct {
+	source   io.ReaderAt
+	ctx      context.Context
+	chunks   []chunkLocation
+	pos      int
+	last     int
+	seeked   bool
+	reverse  bool
+	keys     *bsonx.KeyInterner
+	metadata map[int64]*bsonx.Document
+}
+
+type chunkLocation struct {
+	offset   int64
+	size     int
+	metadata int64
+}
+
+// NewSeekableChunkIterator creates a ChunkIterator for an FTDC data
+// source that supports random access (e.g. an *os.File), with the
+// specified size. The iterator supports the Seek and Reverse methods,
+// which make it possible to read the last chunks of a file without
+// decoding the chunks that precede them.
+//
+// The iterator reads the headers of every document in the data source
+// when it is created, to locate the chunks, but only reads and
+// decodes the payload of a chunk when the iterator reaches it.
+func NewSeekableChunkIterator(ctx context.Context, r io.ReaderAt, size int64) (*ChunkIterator, error) {
+	index := &chunkIndex{
+		source:   r,
+		last:     -1,
+		keys:     bsonx.NewKeyInterner(),
+		metadata: map[int64]*bsonx.Document{},
+	}
+	if err := index.build(size); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	iter := &ChunkIterator{
+		catcher: grip.NewBasicCatcher(),
+		index:   index,
+	}
+	index.ctx, iter.cancel = context.WithCancel(ctx)
+
+	return iter, nil
+}
+
+// build scans the documents in the data source, without reading their
+// contents beyond the type field.
+func (idx *chunkIndex) build(size int64) error {
+	metadata := int64(-1)
+	header := make([]byte, 64)
+
+	for offset := int64(0); offset < size; {
+		n, err := idx.source.ReadAt(header, offset)
+		if err != nil && err != io.EOF {
+			return errors.Wrapf(err, "problem reading document at offset %d", offset)
+		}
+		if n < 5 {
+			return errors.Errorf("truncated document at offset %d", offset)
+		}
+
+		// skip the envelope headers of documents in format v2.
+		if HasChunkEnvelope(header[:n]) {
+			envelope, err := ParseChunkEnvelope(header[:n])
+			if err != nil {
+				return errors.Wrapf(err, "problem reading chunk envelope at offset %d", offset)
+			}
+			if offset+envelopeHeaderSize+int64(envelope.Size) > size {
+				return errors.Errorf("truncated document at offset %d", offset)
+			}
+			offset += envelopeHeaderSize
+			continue
+		}
+
+		docSize := int64(int32(binary.LittleEndian.Uint32(header)))
+		if docSize < 5 || offset+docSize > size {
+			return errors.Errorf("invalid document size %d at offset %d", docSize, offset)
+		}
+
+		docType, ok := scanDocumentType(header[:n])
+		if !ok {
+			// the type field is not near the beginning of the
+			// document, so read all of it.
+			doc, err := idx.read(offset, int(docSize))
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			docType = -1
+			if isNum(0, doc.Lookup("type")) {
+				docType = 0
+			} else if isNum(1, doc.Lookup("type")) {
+				docType = 1
+			}
+		}
+
+		switch docType {
+		case 0:
+			metadata = offset
+		case 1:
+			idx.chunks = append(idx.chunks, chunkLocation{
+				offset:   offset,
+				size:     int(docSize),
+				metadata: metadata,
+			})
+		}
+
+		offset += docSize
+	}
+
+	return nil
+}
+
+// scanDocumentType returns the value of the numeric "type" field of a
+// document from a prefix of the document, if the field, and all of
+// the fields that precede it, have fixed sizes and are within the
+// prefix.
+func scanDocumentType(prefix []byte) (int64, bool) {
+	for pos := 4; pos < len(prefix); {
+		elemType := prefix[pos]
+		if elemType == 0 {
+			return 0, false
+		}
+		pos++
+
+		keyEnd := pos
+		for keyEnd < len(prefix) && prefix[keyEnd] != 0 {
+			keyEnd++
+		}
+		if keyEnd >= len(prefix) {
+			return 0, false
+		}
+		key := string(prefix[pos:keyEnd])
+		pos = keyEnd + 1
+
+		var width int
+		switch elemType {
+		case 0x01, 0x09, 0x11, 0x12: // double, date time, timestamp, int64
+			width = 8
+		case 0x10: // int32
+			width = 4
+		default:
+			return 0, false
+		}
+		if pos+width > len(prefix) {
+			return 0, false
+		}
+
+		if key == "type" {
+			value := prefix[pos : pos+width]
+			switch elemType {
+			case 0x10:
+				return int64(int32(binary.LittleEndian.Uint32(value))), true
+			case 0x12:
+				return int64(binary.LittleEndian.Uint64(value)), true
+			case 0x01:
+				f := math.Float64frombits(binary.LittleEndian.Uint64(value))
+				if f != math.Trunc(f) {
+					return -1, true
+				}
+				return int64(f), true
+			default:
+				return -1, true
+			}
+		}
+		pos += width
+	}
+
+	return 0, false
+}
+
+func (idx *chunkIndex) read(offset int64, size int) (*bsonx.Document, error) {
+	data := make([]byte, size)
+	if _, err := idx.source.ReadAt(data, offset); err != nil && err != io.EOF {
+		return nil, errors.Wrapf(err, "problem reading document at offset %d", offset)
+	}
+
+	doc, err := bsonx.ReadDocument(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem parsing document at offset %d", offset)
+	}
+	return doc, nil
+}
+
+func (idx *chunkIndex) readMetadata(offset int64) (*bsonx.Document, error) {
+	if offset < 0 {
+		return nil, nil
+	}
+	if doc, ok := idx.metadata[offset]; ok {
+		return doc, nil
+	}
+
+	header := make([]byte, 4)
+	if _, err := idx.source.ReadAt(header, offset); err != nil {
+		return nil, errors.Wrapf(err, "problem reading metadata at offset %d", offset)
+	}
+	doc, err := idx.read(offset, int(binary.LittleEndian.Uint32(header)))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	idx.metadata[offset] = doc
+	return doc, nil
+}
+
+// next decodes the chunk at the current position, and advances the
+// position in the direction of iteration.
+func (idx *chunkIndex) next() (*Chunk, error) {
+	if idx.ctx.Err() != nil || idx.pos < 0 || idx.pos >= len(idx.chunks) {
+		return nil, nil
+	}
+
+	loc := idx.chunks[idx.pos]
+	idx.last = idx.pos
+	if idx.reverse {
+		idx.pos--
+	} else {
+		idx.pos++
+	}
+
+	doc, err := idx.read(loc.offset, loc.size)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	metadata, err := idx.readMetadata(loc.metadata)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	chunk, err := readChunk(doc, metadata, idx.keys, nil)
+	recordDecode(err)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return chunk, nil
+}
+
+// Len returns the number of chunks in the data source of a seekable
+// iterator (see NewSeekableChunkIterator), or -1 for other iterators.
+func (iter *ChunkIterator) Len() int {
+	if iter.index == nil {
+		return -1
+	}
+	return len(iter.index.chunks)
+}
+
+// Seek positions a seekable iterator (see NewSeekableChunkIterator) so
+// that the next call to Next returns the chunk at the specified
+// index. Negative indexes count back from the end of the data source,
+// so Seek(-n) positions the iterator at the n-th chunk from the end.
+// Seek returns an error for other iterators, or if the index is out of
+// range.
+func (iter *ChunkIterator) Seek(n int) error {
+	if iter.index == nil {
+		return errors.New("iterator does not support seeking")
+	}
+	if n < 0 {
+		n += len(iter.index.chunks)
+	}
+	if n < 0 || n >= len(iter.index.chunks) {
+		return errors.Errorf("chunk %d is out of range for %d chunks", n, len(iter.index.chunks))
+	}
+
+	iter.index.pos = n
+	iter.index.last = -1
+	iter.index.seeked = true
+	return nil
+}
+
+// Reverse changes the direction of a seekable iterator (see
+// NewSeekableChunkIterator), so that subsequent calls to Next return
+// the chunks that precede the current position, from the last to the
+// first. If the iterator has not returned any chunks, or been
+// positioned with Seek, iteration starts with the last chunk. Reverse
+// returns an error for other iterators.
+func (iter *ChunkIterator) Reverse() error {
+	if iter.index == nil {
+		return errors.New("iterator does not support reverse iteration")
+	}
+	if iter.index.reverse {
+		return nil
+	}
+
+	idx := iter.index
+	idx.reverse = true
+	switch {
+	case idx.last >= 0:
+		// continue from the chunk before the one that was
+		// returned most recently.
+		idx.pos = idx.last - 1
+	case !idx.seeked:
+		idx.pos = len(idx.chunks) - 1
+	}
+
+	return nil
+}
+
+func (iter *ChunkIterator) nextIndexed() bool {
+	if iter.closed {
+		return false
+	}
+
+	next, err := iter.index.next()
+	if err != nil {
+		iter.catcher.Add(err)
+		return false
+	}
+	if next == nil {
+		return false
+	}
+
+	iter.advance(next)
+	return true
+}
@@ -0,0 +1,179 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeekableChunkIterator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	// five chunks of ten samples, one sample per second
+	buf := &bytes.Buffer{}
+	collector := NewBaseCollector(10)
+	require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "example"))))
+	for i := 0; i < 50; i++ {
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("counter", int64(i)),
+		)))
+
+		if collector.Info().SampleCount == 10 {
+			require.NoError(t, FlushCollector(collector, buf))
+		}
+	}
+	data := buf.Bytes()
+
+	open := func(t *testing.T) *ChunkIterator {
+		iter, err := NewSeekableChunkIterator(ctx, bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		require.Equal(t, 5, iter.Len())
+		return iter
+	}
+
+	// firstValues returns the value of the counter in the first
+	// sample of each of the remaining chunks in the iterator.
+	firstValues := func(t *testing.T, iter *ChunkIterator) []int64 {
+		out := []int64{}
+		for iter.Next() {
+			chunk := iter.Chunk()
+			require.Len(t, chunk.Metrics, 2)
+			require.Len(t, chunk.Metrics[1].Values, 10)
+			assert.Equal(t, "example", chunk.GetMetadata().Lookup("doc").MutableDocument().Lookup("host").StringValue())
+			out = append(out, chunk.Metrics[1].Values[0])
+		}
+		require.NoError(t, iter.Err())
+		return out
+	}
+
+	t.Run("Forward", func(t *testing.T) {
+		iter := open(t)
+		defer iter.Close()
+		assert.Equal(t, []int64{0, 10, 20, 30, 40}, firstValues(t, iter))
+	})
+	t.Run("MatchesReadChunks", func(t *testing.T) {
+		iter := open(t)
+		defer iter.Close()
+		stream := ReadChunks(ctx, bytes.NewReader(data))
+		defer stream.Close()
+
+		for stream.Next() {
+			require.True(t, iter.Next())
+			expected, actual := stream.Chunk(), iter.Chunk()
+			assert.Equal(t, expected.nPoints, actual.nPoints)
+			for idx := range expected.Metrics {
+				assert.Equal(t, expected.Metrics[idx].Key(), actual.Metrics[idx].Key())
+				assert.Equal(t, expected.Metrics[idx].Values, actual.Metrics[idx].Values)
+			}
+		}
+		assert.False(t, iter.Next())
+		require.NoError(t, stream.Err())
+		require.NoError(t, iter.Err())
+	})
+	t.Run("Seek", func(t *testing.T) {
+		iter := open(t)
+		defer iter.Close()
+		require.NoError(t, iter.Seek(3))
+		assert.Equal(t, []int64{30, 40}, firstValues(t, iter))
+
+		require.NoError(t, iter.Seek(1))
+		require.True(t, iter.Next())
+		assert.EqualValues(t, 10, iter.Chunk().Metrics[1].Values[0])
+	})
+	t.Run("SeekFromEnd", func(t *testing.T) {
+		iter := open(t)
+		defer iter.Close()
+		require.NoError(t, iter.Seek(-2))
+		assert.Equal(t, []int64{30, 40}, firstValues(t, iter))
+	})
+	t.Run("SeekOutOfRange", func(t *testing.T) {
+		iter := open(t)
+		defer iter.Close()
+		assert.Error(t, iter.Seek(5))
+		assert.Error(t, iter.Seek(-6))
+		assert.Equal(t, []int64{0, 10, 20, 30, 40}, firstValues(t, iter))
+	})
+	t.Run("Reverse", func(t *testing.T) {
+		iter := open(t)
+		defer iter.Close()
+		require.NoError(t, iter.Reverse())
+		assert.Equal(t, []int64{40, 30, 20, 10, 0}, firstValues(t, iter))
+	})
+	t.Run("ReverseAfterSeek", func(t *testing.T) {
+		iter := open(t)
+		defer iter.Close()
+		require.NoError(t, iter.Seek(2))
+		require.NoError(t, iter.Reverse())
+		assert.Equal(t, []int64{20, 10, 0}, firstValues(t, iter))
+	})
+	t.Run("ReverseAfterNext", func(t *testing.T) {
+		iter := open(t)
+		defer iter.Close()
+		require.True(t, iter.Next())
+		require.True(t, iter.Next())
+		require.True(t, iter.Next())
+		require.NoError(t, iter.Reverse())
+		assert.Equal(t, []int64{10, 0}, firstValues(t, iter))
+	})
+	t.Run("Close", func(t *testing.T) {
+		iter := open(t)
+		require.True(t, iter.Next())
+		iter.Close()
+		assert.False(t, iter.Next())
+	})
+	t.Run("StreamingIteratorCannotSeek", func(t *testing.T) {
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		assert.Equal(t, -1, iter.Len())
+		assert.Error(t, iter.Seek(0))
+		assert.Error(t, iter.Reverse())
+	})
+	t.Run("Empty", func(t *testing.T) {
+		iter, err := NewSeekableChunkIterator(ctx, bytes.NewReader(nil), 0)
+		require.NoError(t, err)
+		defer iter.Close()
+		assert.Equal(t, 0, iter.Len())
+		assert.False(t, iter.Next())
+		assert.Error(t, iter.Seek(0))
+	})
+	t.Run("Truncated", func(t *testing.T) {
+		_, err := NewSeekableChunkIterator(ctx, bytes.NewReader(data[:len(data)-10]), int64(len(data)-10))
+		assert.Error(t, err)
+	})
+}
+
+func TestScanDocumentType(t *testing.T) {
+	for name, test := range map[string]struct {
+		doc      *bsonx.Document
+		expected int64
+		found    bool
+	}{
+		"Int32":  {doc: bsonx.NewDocument(bsonx.EC.Time("_id", time.Now()), bsonx.EC.Int32("type", 1)), expected: 1, found: true},
+		"Int64":  {doc: bsonx.NewDocument(bsonx.EC.Int64("type", 0)), expected: 0, found: true},
+		"Double": {doc: bsonx.NewDocument(bsonx.EC.Double("type", 1)), expected: 1, found: true},
+		"AfterVariableLengthField": {
+			doc: bsonx.NewDocument(bsonx.EC.String("name", "x"), bsonx.EC.Int32("type", 1)),
+		},
+		"Missing": {doc: bsonx.NewDocument(bsonx.EC.Int32("other", 1))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := test.doc.MarshalBSON()
+			require.NoError(t, err)
+
+			docType, found := scanDocumentType(data)
+			assert.Equal(t, test.found, found)
+			if found {
+				assert.Equal(t, test.expected, docType)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+//go:build go1.23
+// +build go1.23
+
+package ftdc
+
+import (
+	"iter"
+
+	"github.com/mongodb/ftdc/bsonx"
+)
+
+// Seq returns the remaining chunks of the iterator as a sequence, for
+// use with range-over-func loops and iterator adapters:
+//
+//	for chunk := range iter.Seq() {
+//	    // <manipulate chunk>
+//	}
+//
+//	if err := iter.Err(); err != nil {
+//	    return err
+//	}
+//
+// The sequence advances the iterator, and so can only be ranged over
+// once. As with Next, check Err when the loop completes, and Close
+// the iterator when it is no longer needed, including when the loop
+// breaks before the end of the data.
+func (iter *ChunkIterator) Seq() iter.Seq[*Chunk] {
+	return func(yield func(*Chunk) bool) {
+		for iter.Next() {
+			if !yield(iter.Chunk()) {
+				return
+			}
+		}
+	}
+}
+
+// IteratorSeq returns the remaining documents of a sample iterator
+// (e.g. one returned by ReadMetrics or Chunk.Iterator) as a sequence.
+// As with ChunkIterator.Seq, the sequence advances the iterator, and
+// the caller is responsible for checking Err and for closing the
+// iterator.
+func IteratorSeq(it Iterator) iter.Seq[*bsonx.Document] {
+	return func(yield func(*bsonx.Document) bool) {
+		for it.Next() {
+			if !yield(it.Document()) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+//go:build go1.23
+// +build go1.23
+
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIteratorSeq(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	data := append(newFlatChunk(t, 10), newFlatChunk(t, 5)...)
+
+	t.Run("Chunks", func(t *testing.T) {
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+
+		samples := []int{}
+		for chunk := range iter.Seq() {
+			samples = append(samples, chunk.Size())
+		}
+		require.NoError(t, iter.Err())
+		assert.Equal(t, []int{10, 5}, samples)
+
+		// the sequence consumes the iterator.
+		for range iter.Seq() {
+			assert.Fail(t, "iterator is exhausted")
+		}
+	})
+	t.Run("ChunksBreak", func(t *testing.T) {
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+
+		count := 0
+		for range iter.Seq() {
+			count++
+			break
+		}
+		assert.Equal(t, 1, count)
+
+		// ranging again resumes after the last chunk.
+		for chunk := range iter.Seq() {
+			assert.Equal(t, 5, chunk.Size())
+			count++
+		}
+		require.NoError(t, iter.Err())
+		assert.Equal(t, 2, count)
+	})
+	t.Run("Samples", func(t *testing.T) {
+		iter := ReadMetrics(ctx, bytes.NewReader(data))
+		defer iter.Close()
+
+		values := []int64{}
+		for doc := range IteratorSeq(iter) {
+			values = append(values, doc.Lookup("value").Int64())
+		}
+		require.NoError(t, iter.Err())
+		require.Len(t, values, 15)
+		assert.EqualValues(t, 9, values[9])
+		assert.EqualValues(t, 4, values[14])
+	})
+	t.Run("ChunkSamples", func(t *testing.T) {
+		chunks := ReadChunks(ctx, bytes.NewReader(data))
+		defer chunks.Close()
+
+		var docs []*bsonx.Document
+		for chunk := range chunks.Seq() {
+			iter := chunk.Iterator(ctx)
+			for doc := range IteratorSeq(iter) {
+				docs = append(docs, doc)
+				if len(docs)%3 == 0 {
+					break
+				}
+			}
+			iter.Close()
+		}
+		assert.Len(t, docs, 6)
+	})
+}
@@ -0,0 +1,227 @@
+package ftdc
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// NewTailingChunkIterator creates a ChunkIterator that follows a file
+// that is being written (e.g. mongod's "metrics.interim" file, or the
+// current file of a RotatingFileCollector), and returns chunks as
+// they're written to the file. The iterator checks the file for new
+// data at the poll interval, and returns the chunks in the file when
+// the iterator is created right away.
+//
+// A document at the end of the file that is only partially written
+// is read once the rest of it is written. If the file is truncated or
+// replaced by a new file at the same path, the iterator starts over
+// from the beginning of the new file, which, for files that are
+// rewritten in place, returns chunks that the iterator has already
+// returned.
+//
+// The iterator never reaches the end of the file: Next blocks until
+// there is another chunk, or until you call Close or cancel the
+// context. The file must exist when you create the iterator.
+func NewTailingChunkIterator(ctx context.Context, path string, poll time.Duration) (*ChunkIterator, error) {
+	if poll <= 0 {
+		return nil, errors.New("poll interval must be positive")
+	}
+
+	tail := &fileTail{path: path, poll: poll}
+	if err := tail.open(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	iter := &ChunkIterator{
+		catcher: grip.NewBasicCatcher(),
+		pipe:    make(chan *Chunk, 2),
+	}
+
+	ipc := make(chan *bsonx.Document)
+	ctx, iter.cancel = context.WithCancel(ctx)
+
+	go func() {
+		iter.catcher.Add(tail.follow(ctx, ipc))
+	}()
+
+	go func() {
+		iter.catcher.Add(readChunks(ctx, ipc, iter.pipe))
+	}()
+
+	return iter, nil
+}
+
+// fileTail reads the documents in a file that is being written.
+type fileTail struct {
+	path   string
+	poll   time.Duration
+	file   *os.File
+	info   os.FileInfo
+	offset int64
+}
+
+func (t *fileTail) open() error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening '%s'", t.path)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrapf(err, "problem reading file info for '%s'", t.path)
+	}
+
+	if t.file != nil {
+		t.file.Close()
+	}
+	t.file = file
+	t.info = info
+	t.offset = 0
+	return nil
+}
+
+func (t *fileTail) follow(ctx context.Context, ch chan<- *bsonx.Document) error {
+	defer close(ch)
+	defer t.file.Close()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+
+		for {
+			doc, err := t.next()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if doc == nil {
+				break
+			}
+
+			select {
+			case ch <- doc:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		if err := t.checkReplaced(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		timer.Reset(t.poll)
+	}
+}
+
+// next returns the next document in the file, or nil if the file does
+// not yet hold a complete document at the current offset.
+func (t *fileTail) next() (*bsonx.Document, error) {
+	info, err := t.file.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading file info for '%s'", t.path)
+	}
+	size := info.Size()
+
+	if size < t.offset {
+		// the file was truncated, so start over.
+		t.offset = 0
+	}
+
+	// documents in format v2 are preceded by an envelope header,
+	// and are only read once the header and the document are
+	// complete.
+	start := t.offset
+	var envelope []byte
+	if size-start >= int64(len(envelopeMagic)) {
+		prefix := make([]byte, len(envelopeMagic))
+		if _, err = t.file.ReadAt(prefix, start); err != nil {
+			return nil, errors.Wrapf(err, "problem reading document header at offset %d", start)
+		}
+		if HasChunkEnvelope(prefix) {
+			if size-start < envelopeHeaderSize {
+				return nil, nil
+			}
+			envelope = make([]byte, envelopeHeaderSize)
+			if _, err = t.file.ReadAt(envelope, start); err != nil {
+				return nil, errors.Wrapf(err, "problem reading chunk envelope at offset %d", start)
+			}
+			start += envelopeHeaderSize
+		}
+	}
+
+	if size-start < bsonx.DocumentHeaderSize {
+		return nil, nil
+	}
+
+	header := make([]byte, bsonx.DocumentHeaderSize)
+	if _, err = t.file.ReadAt(header, start); err != nil {
+		return nil, errors.Wrapf(err, "problem reading document header at offset %d", start)
+	}
+
+	length := int64(int32(binary.LittleEndian.Uint32(header)))
+	if length < bsonx.MinDocumentSize {
+		return nil, errors.Errorf("invalid document length %d at offset %d", length, start)
+	}
+	if size-start < length {
+		return nil, nil
+	}
+
+	data := make([]byte, length)
+	if _, err = t.file.ReadAt(data, start); err != nil && err != io.EOF {
+		return nil, errors.Wrapf(err, "problem reading document at offset %d", start)
+	}
+
+	var doc *bsonx.Document
+	if envelope != nil {
+		var parsed *ChunkEnvelope
+		parsed, err = ParseChunkEnvelope(envelope)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem reading chunk envelope at offset %d", t.offset)
+		}
+		if err = parsed.verify(envelope, data); err != nil {
+			return nil, errors.Wrapf(err, "problem reading document at offset %d", start)
+		}
+		doc, err = readEnvelopedDocument(parsed, data)
+	} else {
+		doc, err = bsonx.ReadDocument(data)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem parsing document at offset %d", start)
+	}
+
+	t.offset = start + length
+	return doc, nil
+}
+
+// checkReplaced reopens the file at the path if it is not the file
+// that the tail is reading (e.g. because it was rotated). If there is
+// no file at the path, the tail keeps reading the file that it has,
+// until a new file appears.
+func (t *fileTail) checkReplaced() error {
+	info, err := os.Stat(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "problem reading file info for '%s'", t.path)
+	}
+
+	if os.SameFile(info, t.info) {
+		return nil
+	}
+
+	return errors.WithStack(t.open())
+}
@@ -0,0 +1,171 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTailingChunkIterator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "ftdc-tail")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// newChunks returns the encoded chunks of ten samples each,
+	// where the counter in the first sample of each chunk is the
+	// value in start.
+	newChunks := func(t *testing.T, start ...int64) []byte {
+		buf := &bytes.Buffer{}
+		collector := NewBaseCollector(10)
+		require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "example"))))
+		for _, first := range start {
+			for i := int64(0); i < 10; i++ {
+				require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("counter", first+i))))
+			}
+			require.NoError(t, FlushCollector(collector, buf))
+		}
+		return buf.Bytes()
+	}
+	// nextFirst returns the counter in the first sample of the
+	// next chunk, or fails if there is none within a second.
+	nextFirst := func(t *testing.T, iter *ChunkIterator) int64 {
+		next := make(chan bool)
+		go func() { next <- iter.Next() }()
+		select {
+		case ok := <-next:
+			require.True(t, ok)
+		case <-time.After(time.Second):
+			require.FailNow(t, "timed out waiting for chunk")
+		}
+		chunk := iter.Chunk()
+		require.Len(t, chunk.Metrics, 1)
+		return chunk.Metrics[0].Values[0]
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		_, err := NewTailingChunkIterator(ctx, filepath.Join(dir, "missing"), time.Millisecond)
+		assert.Error(t, err)
+
+		path := filepath.Join(dir, "invalid")
+		require.NoError(t, ioutil.WriteFile(path, nil, 0644))
+		_, err = NewTailingChunkIterator(ctx, path, 0)
+		assert.Error(t, err)
+	})
+	t.Run("FollowsAppends", func(t *testing.T) {
+		path := filepath.Join(dir, "appends")
+		require.NoError(t, ioutil.WriteFile(path, newChunks(t, 0, 10), 0644))
+
+		iter, err := NewTailingChunkIterator(ctx, path, time.Millisecond)
+		require.NoError(t, err)
+		defer iter.Close()
+
+		assert.EqualValues(t, 0, nextFirst(t, iter))
+		assert.EqualValues(t, 10, nextFirst(t, iter))
+		assert.Equal(t, "example", iter.Chunk().GetMetadata().Lookup("doc").MutableDocument().Lookup("host").StringValue())
+
+		// write a chunk in two parts, so that the iterator
+		// sees a partial document at the end of the file.
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		defer file.Close()
+
+		data := newChunks(t, 100)
+		_, err = file.Write(data[:len(data)/2])
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+		_, err = file.Write(data[len(data)/2:])
+		require.NoError(t, err)
+		assert.EqualValues(t, 100, nextFirst(t, iter))
+
+		_, err = file.Write(newChunks(t, 200))
+		require.NoError(t, err)
+		assert.EqualValues(t, 200, nextFirst(t, iter))
+
+		iter.Close()
+		assert.False(t, iter.Next())
+		assert.NoError(t, iter.Err())
+	})
+	t.Run("Replaced", func(t *testing.T) {
+		path := filepath.Join(dir, "replaced")
+		require.NoError(t, ioutil.WriteFile(path, newChunks(t, 0), 0644))
+
+		iter, err := NewTailingChunkIterator(ctx, path, time.Millisecond)
+		require.NoError(t, err)
+		defer iter.Close()
+		assert.EqualValues(t, 0, nextFirst(t, iter))
+
+		tmp := filepath.Join(dir, "replaced.tmp")
+		require.NoError(t, ioutil.WriteFile(tmp, newChunks(t, 50), 0644))
+		require.NoError(t, os.Rename(tmp, path))
+		assert.EqualValues(t, 50, nextFirst(t, iter))
+	})
+	t.Run("Truncated", func(t *testing.T) {
+		path := filepath.Join(dir, "truncated")
+		require.NoError(t, ioutil.WriteFile(path, newChunks(t, 0, 10), 0644))
+
+		iter, err := NewTailingChunkIterator(ctx, path, time.Millisecond)
+		require.NoError(t, err)
+		defer iter.Close()
+		assert.EqualValues(t, 0, nextFirst(t, iter))
+		assert.EqualValues(t, 10, nextFirst(t, iter))
+
+		file, err := os.OpenFile(path, os.O_TRUNC|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		defer file.Close()
+		time.Sleep(10 * time.Millisecond)
+		_, err = file.Write(newChunks(t, 70))
+		require.NoError(t, err)
+		assert.EqualValues(t, 70, nextFirst(t, iter))
+	})
+	t.Run("Corrupt", func(t *testing.T) {
+		path := filepath.Join(dir, "corrupt")
+		require.NoError(t, ioutil.WriteFile(path, []byte{1, 0, 0, 0, 0, 0}, 0644))
+
+		iter, err := NewTailingChunkIterator(ctx, path, time.Millisecond)
+		require.NoError(t, err)
+		defer iter.Close()
+		assert.False(t, iter.Next())
+		assert.Error(t, iter.Err())
+	})
+	t.Run("EnvelopeCodecMismatch", func(t *testing.T) {
+		// envelope each document of a zlib chunk as snappy, so
+		// that the envelopes verify but the chunk does not
+		// decode.
+		buf := &bytes.Buffer{}
+		data := newChunks(t, 0)
+		for len(data) > 0 {
+			size := int(binary.LittleEndian.Uint32(data))
+			doc, err := bsonx.ReadDocument(data[:size])
+			require.NoError(t, err)
+			require.NoError(t, writeEnveloped(buf, doc, CompressionSnappy, 10, time.Now(), time.Now(), ""))
+			data = data[size:]
+		}
+		path := filepath.Join(dir, "mismatch")
+		require.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+
+		iter, err := NewTailingChunkIterator(ctx, path, time.Millisecond)
+		require.NoError(t, err)
+		defer iter.Close()
+		next := make(chan bool)
+		go func() { next <- iter.Next() }()
+		select {
+		case ok := <-next:
+			assert.False(t, ok)
+		case <-time.After(time.Second):
+			require.FailNow(t, "timed out waiting for error")
+		}
+		assert.Error(t, iter.Err())
+	})
+}
@@ -0,0 +1,483 @@
+package ftdc
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// Transform modifies the metrics of the chunks read by a transform
+// iterator (see NewTransformIterator), before they are returned to
+// callers.
+//
+// Transforms may add, remove, reorder, and rename the metrics of the
+// chunk, and replace their values, but must not modify the Values
+// slices of the chunk's metrics in place, as they may be shared with
+// the chunk that the iterator read.
+type Transform interface {
+	Apply(*Chunk) error
+}
+
+// TransformFunc is an adapter that makes a function a Transform.
+type TransformFunc func(*Chunk) error
+
+// Apply calls the function.
+func (f TransformFunc) Apply(chunk *Chunk) error { return f(chunk) }
+
+// NewTransformIterator returns a ChunkIterator that applies the
+// transforms, in order, to each chunk that the iterator reads, so
+// that later transforms see the results of earlier transforms (e.g. a
+// derived metric may refer to renamed metrics.) Use the transform
+// iterator in place of the chunk iterator with any function that
+// reads chunks (e.g. WriteCSV or WriteJSONL.)
+//
+// The documents of the structured iterators of transformed chunks
+// (see Chunk.StructuredIterator) are flat, like those of
+// Chunk.Iterator, as transforms may change the structure of the
+// metrics. The iterator stops, and reports an error, if a transform
+// returns an error.
+//
+// The iterator takes ownership of the chunk iterator, and closes it
+// when the iterator is closed.
+func NewTransformIterator(iter *ChunkIterator, transforms ...Transform) *ChunkIterator {
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &ChunkIterator{
+		catcher: grip.NewBasicCatcher(),
+		pipe:    make(chan *Chunk, 2),
+		cancel: func() {
+			cancel()
+			iter.Close()
+		},
+	}
+
+	go func() {
+		defer close(out.pipe)
+		out.catcher.Add(transformChunks(ctx, iter, out.pipe, transforms))
+	}()
+
+	return out
+}
+
+func transformChunks(ctx context.Context, iter *ChunkIterator, out chan<- *Chunk, transforms []Transform) error {
+	for iter.Next() {
+		chunk := iter.Chunk().transformable()
+		for idx, transform := range transforms {
+			if err := transform.Apply(chunk); err != nil {
+				return errors.Wrapf(err, "problem applying transform #%d", idx+1)
+			}
+		}
+		chunk.reference = flatReference(chunk.Metrics)
+
+		select {
+		case out <- chunk:
+		case <-ctx.Done():
+			return errors.New("operation aborted")
+		}
+	}
+
+	return errors.Wrap(iter.Err(), "problem reading chunks")
+}
+
+// transformable returns a copy of the chunk with its own slice of
+// metrics, which transforms may modify.
+func (c *Chunk) transformable() *Chunk {
+	out := *c
+	out.Metrics = append([]Metric(nil), c.Metrics...)
+	out.payload = nil
+	return &out
+}
+
+// flatReference returns a reference document for the metrics with one
+// element for each metric, keyed by the key of the metric.
+func flatReference(metrics []Metric) *bsonx.Document {
+	doc := bsonx.DC.Make(len(metrics))
+	for _, m := range metrics {
+		var value int64
+		if len(m.Values) > 0 {
+			value = m.Values[0]
+		}
+		elem, _ := restoreFlat(m.originalType, m.Key(), value)
+		doc.Append(elem)
+	}
+	return doc
+}
+
+// setKey replaces the key of the metric.
+func (m *Metric) setKey(key string) {
+	parts := strings.Split(key, ".")
+	m.ParentPath = parts[:len(parts)-1]
+	m.KeyName = parts[len(parts)-1]
+}
+
+// metricValue returns the value of the metric as a float.
+func metricValue(t bsontype.Type, value int64) float64 {
+	if t == bsontype.Double {
+		return restoreFloat(value)
+	}
+	return float64(value)
+}
+
+func renameMetrics(chunk *Chunk, rename func(string) (string, bool)) error {
+	keys := make(map[string]int, len(chunk.Metrics))
+	for idx := range chunk.Metrics {
+		keys[chunk.Metrics[idx].Key()] = idx
+	}
+
+	for idx := range chunk.Metrics {
+		m := &chunk.Metrics[idx]
+		key := m.Key()
+		to, ok := rename(key)
+		if !ok || to == key {
+			continue
+		}
+		if to == "" {
+			return errors.Errorf("cannot rename metric '%s' to an empty key", key)
+		}
+		if other, ok := keys[to]; ok && other != idx {
+			return errors.Errorf("cannot rename metric '%s' to '%s', which already exists", key, to)
+		}
+
+		delete(keys, key)
+		keys[to] = idx
+		m.setKey(to)
+	}
+
+	return nil
+}
+
+// RenameMetric returns a Transform that changes the key of the metric
+// with the from key, if chunks have the metric, to the to key. The
+// transform reports an error if chunks already have a metric with
+// the to key.
+func RenameMetric(from, to string) Transform {
+	return TransformFunc(func(chunk *Chunk) error {
+		return renameMetrics(chunk, func(key string) (string, bool) {
+			return to, key == from
+		})
+	})
+}
+
+// RenameMetricPrefix returns a Transform that replaces the from prefix
+// of keys with the to prefix, e.g. to rename all of the metrics of a
+// document. Prefixes only match whole components of keys, so the
+// "serverStatus.mem" prefix matches "serverStatus.mem.resident" but
+// not "serverStatus.memory". The transform reports an error if a
+// renamed key is the key of another metric.
+func RenameMetricPrefix(from, to string) Transform {
+	return TransformFunc(func(chunk *Chunk) error {
+		return renameMetrics(chunk, func(key string) (string, bool) {
+			switch {
+			case key == from:
+				return to, true
+			case strings.HasPrefix(key, from+"."):
+				if to == "" {
+					return key[len(from)+1:], true
+				}
+				return to + key[len(from):], true
+			default:
+				return "", false
+			}
+		})
+	})
+}
+
+// ScaleMetrics returns a Transform that multiplies the values of the
+// numeric (double, int32, and int64) metrics with keys that match by
+// the factor, e.g. to convert bytes to megabytes (with a factor of
+// 1.0/(1<<20)). Scaled metrics are doubles. Other metrics are not
+// modified.
+func ScaleMetrics(keys KeyMatcher, factor float64) Transform {
+	return TransformFunc(func(chunk *Chunk) error {
+		for idx := range chunk.Metrics {
+			m := &chunk.Metrics[idx]
+			if !isCounterType(m.originalType) || !keys.MatchKey(m.Key()) {
+				continue
+			}
+
+			values := make([]int64, len(m.Values))
+			for i, value := range m.Values {
+				values[i] = normalizeFloat(metricValue(m.originalType, value) * factor)
+			}
+			m.Values = values
+			m.originalType = bsontype.Double
+			if len(values) > 0 {
+				m.startingValue = values[0]
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeriveMetric returns a Transform that adds a double metric with the
+// key to chunks, which holds the value of the expression for each
+// sample. Expressions are arithmetic over numbers and the values of
+// other metrics, with the +, -, *, and / operators and parentheses,
+// e.g.:
+//
+//	(serverStatus.mem.resident - serverStatus.mem.mapped) * 1048576
+//
+// Keys that contain characters other than letters, digits, '_', '$',
+// and '.' must be quoted (e.g. "wiredTiger.cache.bytes read into
+// cache"). The values of boolean metrics are 0 or 1, and those of
+// date time metrics are milliseconds since the Unix epoch. Dividing
+// by zero produces infinite or NaN values.
+//
+// Chunks that do not have every metric of the expression do not have
+// the derived metric. Returns an error if the expression is not
+// valid. The transform reports an error if chunks already have a
+// metric with the key.
+func DeriveMetric(key, expression string) (Transform, error) {
+	if key == "" {
+		return nil, errors.New("derived metrics must have a key")
+	}
+
+	p := &expressionParser{input: expression}
+	expr, err := p.parse()
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem parsing expression '%s'", expression)
+	}
+
+	return TransformFunc(func(chunk *Chunk) error {
+		columns := make([][]float64, len(p.keys))
+		for idx := range chunk.Metrics {
+			m := &chunk.Metrics[idx]
+			mkey := m.Key()
+			if mkey == key {
+				return errors.Errorf("cannot derive metric '%s', which already exists", key)
+			}
+
+			ref, ok := p.keys[mkey]
+			if !ok || columns[ref] != nil {
+				continue
+			}
+			column := make([]float64, len(m.Values))
+			for i, value := range m.Values {
+				column[i] = metricValue(m.originalType, value)
+			}
+			columns[ref] = column
+		}
+
+		for _, column := range columns {
+			if column == nil {
+				return nil
+			}
+		}
+
+		values := make([]int64, chunk.nPoints)
+		for i := range values {
+			values[i] = normalizeFloat(expr.eval(columns, i))
+		}
+
+		derived := Metric{Values: values, originalType: bsontype.Double}
+		derived.setKey(key)
+		if len(values) > 0 {
+			derived.startingValue = values[0]
+		}
+		chunk.Metrics = append(chunk.Metrics, derived)
+		return nil
+	}), nil
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// expressions of derived metrics
+
+type expressionNode interface {
+	eval(columns [][]float64, sample int) float64
+}
+
+type constantNode float64
+
+func (n constantNode) eval([][]float64, int) float64 { return float64(n) }
+
+type metricNode int
+
+func (n metricNode) eval(columns [][]float64, sample int) float64 { return columns[n][sample] }
+
+type negateNode struct{ operand expressionNode }
+
+func (n negateNode) eval(columns [][]float64, sample int) float64 {
+	return -n.operand.eval(columns, sample)
+}
+
+type binaryNode struct {
+	op          byte
+	left, right expressionNode
+}
+
+func (n binaryNode) eval(columns [][]float64, sample int) float64 {
+	left, right := n.left.eval(columns, sample), n.right.eval(columns, sample)
+	switch n.op {
+	case '+':
+		return left + right
+	case '-':
+		return left - right
+	case '*':
+		return left * right
+	default:
+		return left / right
+	}
+}
+
+// expressionParser is a recursive descent parser for the expressions
+// of derived metrics. keys maps the keys of the metrics in the
+// expression to the indexes of their columns.
+type expressionParser struct {
+	input string
+	pos   int
+	keys  map[string]int
+}
+
+func (p *expressionParser) parse() (expressionNode, error) {
+	p.keys = map[string]int{}
+
+	expr, err := p.sum()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if p.peek() != 0 {
+		return nil, errors.Errorf("unexpected '%c' at offset %d", p.peek(), p.pos)
+	}
+	return expr, nil
+}
+
+// peek returns the next character of the input, after any spaces, or
+// zero at the end of the input.
+func (p *expressionParser) peek() byte {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos == len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *expressionParser) sum() (expressionNode, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *expressionParser) product() (expressionNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *expressionParser) unary() (expressionNode, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negateNode{operand: operand}, nil
+	}
+
+	return p.operand()
+}
+
+func (p *expressionParser) operand() (expressionNode, error) {
+	c := p.peek()
+	start := p.pos
+
+	switch {
+	case c == 0:
+		return nil, errors.New("unexpected end of expression")
+	case c == '(':
+		p.pos++
+		expr, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, errors.Errorf("missing ')' for '(' at offset %d", start)
+		}
+		p.pos++
+		return expr, nil
+	case c == '"':
+		end := strings.IndexByte(p.input[start+1:], '"')
+		if end < 0 {
+			return nil, errors.Errorf("unterminated key at offset %d", start)
+		}
+		p.pos = start + end + 2
+		return p.metric(p.input[start+1 : start+end+1])
+	case c == '.' || isDigit(c):
+		for p.pos < len(p.input) && (isDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+			p.pos++
+			if p.pos < len(p.input) && (p.input[p.pos] == '+' || p.input[p.pos] == '-') {
+				p.pos++
+			}
+			for p.pos < len(p.input) && isDigit(p.input[p.pos]) {
+				p.pos++
+			}
+		}
+
+		value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil || math.IsInf(value, 0) {
+			return nil, errors.Errorf("invalid number '%s' at offset %d", p.input[start:p.pos], start)
+		}
+		return constantNode(value), nil
+	case isKeyChar(c):
+		for p.pos < len(p.input) && isKeyChar(p.input[p.pos]) {
+			p.pos++
+		}
+		return p.metric(p.input[start:p.pos])
+	default:
+		return nil, errors.Errorf("unexpected '%c' at offset %d", c, start)
+	}
+}
+
+func (p *expressionParser) metric(key string) (expressionNode, error) {
+	if key == "" {
+		return nil, errors.Errorf("empty key at offset %d", p.pos)
+	}
+
+	idx, ok := p.keys[key]
+	if !ok {
+		idx = len(p.keys)
+		p.keys[key] = idx
+	}
+	return metricNode(idx), nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isKeyChar(c byte) bool {
+	return isDigit(c) || c == '_' || c == '$' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
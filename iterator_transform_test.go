@@ -0,0 +1,193 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformIterator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	// the float preserving collector reproduces the ratios exactly.
+	collector := NewFloatPreservingCollector(100)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.Time("ts", start.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.SubDocument("mem", bsonx.NewDocument(
+				bsonx.EC.Int64("resident", int64(i)<<20),
+				bsonx.EC.Int32("mapped", int32(i)<<10),
+			)),
+			bsonx.EC.Double("ratio", float64(i)/4),
+			bsonx.EC.Boolean("up", i%2 == 0),
+		)))
+	}
+	data, err := collector.Resolve()
+	require.NoError(t, err)
+
+	transform := func(t *testing.T, transforms ...Transform) (*Chunk, error) {
+		iter := NewTransformIterator(ReadChunks(ctx, bytes.NewReader(data)), transforms...)
+		defer iter.Close()
+
+		var chunk *Chunk
+		for iter.Next() {
+			require.Nil(t, chunk)
+			chunk = iter.Chunk()
+		}
+		return chunk, iter.Err()
+	}
+	metric := func(t *testing.T, chunk *Chunk, key string) *Metric {
+		for idx := range chunk.Metrics {
+			if chunk.Metrics[idx].Key() == key {
+				return &chunk.Metrics[idx]
+			}
+		}
+		require.Fail(t, "missing metric", key)
+		return nil
+	}
+	keys := func(chunk *Chunk) []string {
+		out := []string{}
+		for _, m := range chunk.Metrics {
+			out = append(out, m.Key())
+		}
+		return out
+	}
+
+	t.Run("NoTransforms", func(t *testing.T) {
+		chunk, err := transform(t)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ts", "mem.resident", "mem.mapped", "ratio", "up"}, keys(chunk))
+		assert.Equal(t, 10, chunk.Size())
+		assert.Zero(t, chunk.PayloadSize())
+	})
+	t.Run("Rename", func(t *testing.T) {
+		chunk, err := transform(t, RenameMetric("ratio", "stats.ratio"), RenameMetric("missing", "other"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ts", "mem.resident", "mem.mapped", "stats.ratio", "up"}, keys(chunk))
+		assert.Equal(t, []string{"stats"}, metric(t, chunk, "stats.ratio").ParentPath)
+
+		_, err = transform(t, RenameMetric("ratio", "up"))
+		assert.Error(t, err)
+		_, err = transform(t, RenameMetric("ratio", ""))
+		assert.Error(t, err)
+	})
+	t.Run("RenamePrefix", func(t *testing.T) {
+		chunk, err := transform(t, RenameMetricPrefix("mem", "memory.process"), RenameMetricPrefix("rat", "x"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ts", "memory.process.resident", "memory.process.mapped", "ratio", "up"}, keys(chunk))
+
+		chunk, err = transform(t, RenameMetricPrefix("mem", ""))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ts", "resident", "mapped", "ratio", "up"}, keys(chunk))
+
+		_, err = transform(t, RenameMetricPrefix("mem.resident", "ratio"))
+		assert.Error(t, err)
+	})
+	t.Run("Scale", func(t *testing.T) {
+		matcher, err := NewGlobMatcher("mem.*", "ts", "up")
+		require.NoError(t, err)
+		chunk, err := transform(t, ScaleMetrics(matcher, 1.0/(1<<20)))
+		require.NoError(t, err)
+
+		resident := metric(t, chunk, "mem.resident")
+		assert.Equal(t, bsontype.Double, resident.Type())
+		mapped := metric(t, chunk, "mem.mapped")
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, float64(i), restoreFloat(resident.Values[i]))
+			assert.Equal(t, float64(i)/1024, restoreFloat(mapped.Values[i]))
+		}
+		assert.Equal(t, bsontype.DateTime, metric(t, chunk, "ts").Type())
+		assert.Equal(t, bsontype.Boolean, metric(t, chunk, "up").Type())
+	})
+	t.Run("Derive", func(t *testing.T) {
+		derive, err := DeriveMetric("mem.total", `(mem.resident + "mem.mapped" * 1024) / 2 - -ratio * 4`)
+		require.NoError(t, err)
+		chunk, err := transform(t, RenameMetric("up", "status.up"), derive)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ts", "mem.resident", "mem.mapped", "ratio", "status.up", "mem.total"}, keys(chunk))
+
+		total := metric(t, chunk, "mem.total")
+		assert.Equal(t, bsontype.Double, total.Type())
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, float64(i<<20)+float64(i), restoreFloat(total.Values[i]))
+		}
+
+		// derived metrics may refer to renamed metrics, and
+		// division by zero is not an error.
+		derive, err = DeriveMetric("ratio.up", "status.up / (ratio - ratio)")
+		require.NoError(t, err)
+		chunk, err = transform(t, RenameMetric("up", "status.up"), derive)
+		require.NoError(t, err)
+		values := metric(t, chunk, "ratio.up").Values
+		assert.True(t, math.IsInf(restoreFloat(values[0]), 1))
+		assert.True(t, math.IsNaN(restoreFloat(values[1])))
+	})
+	t.Run("DeriveMissingMetric", func(t *testing.T) {
+		derive, err := DeriveMetric("total", "mem.resident + mem.swapped")
+		require.NoError(t, err)
+		chunk, err := transform(t, derive)
+		require.NoError(t, err)
+		assert.Len(t, chunk.Metrics, 5)
+
+		derive, err = DeriveMetric("ratio", "mem.resident")
+		require.NoError(t, err)
+		_, err = transform(t, derive)
+		assert.Error(t, err)
+	})
+	t.Run("InvalidExpressions", func(t *testing.T) {
+		for _, expr := range []string{"", "a +", "(a", "a)", "a * * b", `"a`, `""`, "1e400", "a % b", "1..2"} {
+			_, err := DeriveMetric("x", expr)
+			assert.Error(t, err, expr)
+		}
+		_, err := DeriveMetric("", "a")
+		assert.Error(t, err)
+	})
+	t.Run("TransformErrors", func(t *testing.T) {
+		_, err := transform(t, TransformFunc(func(*Chunk) error { return errors.New("failed") }))
+		require.Error(t, err)
+		assert.True(t, strings.Contains(err.Error(), "failed"))
+	})
+	t.Run("Documents", func(t *testing.T) {
+		derive, err := DeriveMetric("double", "ratio * 2")
+		require.NoError(t, err)
+		chunk, err := transform(t, RenameMetric("mem.resident", "rss"), derive)
+		require.NoError(t, err)
+
+		for _, iter := range []Iterator{chunk.Iterator(ctx), chunk.StructuredIterator(ctx)} {
+			count := 0
+			for iter.Next() {
+				doc := iter.Document()
+				assert.Equal(t, int64(count)<<20, doc.Lookup("rss").Int64())
+				assert.Equal(t, float64(count)/2, doc.Lookup("double").Double())
+				assert.Equal(t, count%2 == 0, doc.Lookup("up").Boolean())
+				count++
+			}
+			iter.Close()
+			assert.Equal(t, 10, count)
+		}
+	})
+	t.Run("Exporters", func(t *testing.T) {
+		iter := NewTransformIterator(ReadChunks(ctx, bytes.NewReader(data)), RenameMetricPrefix("mem", "m"))
+		buf := &bytes.Buffer{}
+		require.NoError(t, WriteJSONL(ctx, iter, buf, JSONLOptions{}))
+		assert.True(t, strings.Contains(buf.String(), `"m.resident":0,"m.mapped":0`), buf.String())
+	})
+	t.Run("Close", func(t *testing.T) {
+		chunks := ReadChunks(ctx, bytes.NewReader(bytes.Repeat(data, 10)))
+		iter := NewTransformIterator(chunks)
+		require.True(t, iter.Next())
+		iter.Close()
+		assert.True(t, chunks.closed)
+	})
+}
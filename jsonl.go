@@ -0,0 +1,168 @@
+package ftdc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// jsonlTimeFormat is RFC 3339 with millisecond precision, which is the
+// precision of date time metrics.
+const jsonlTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// JSONLOptions configures the output of WriteJSONL.
+type JSONLOptions struct {
+	// TimeKey is the key of the date time metric that holds the
+	// time of each sample. Defaults to the first date time metric
+	// in each chunk. The time metric is written as the time field,
+	// rather than as a metric.
+	TimeKey string
+	// TimeField is the name of the field that holds the time of
+	// each sample. Defaults to "ts".
+	TimeField string
+	// Keys selects the metrics that are written. Defaults to all
+	// metrics.
+	Keys KeyMatcher
+}
+
+// Validate ensures that the options are reasonable, and sets default
+// values.
+func (opts *JSONLOptions) Validate() error {
+	if opts.TimeField == "" {
+		opts.TimeField = "ts"
+	}
+	return nil
+}
+
+// WriteJSONL exports the contents of a stream of chunks as newline
+// delimited JSON, with one flat object for each sample, which maps
+// the keys of metrics (as returned by Metric.Key) to their values,
+// e.g.:
+//
+//	{"ts":"2018-06-01T12:00:00.000Z","serverStatus.connections.current":12}
+//
+// Times, including the time field, are written in UTC, in RFC 3339
+// format with millisecond precision. Booleans are written as JSON
+// booleans, and doubles that JSON cannot represent (NaN and infinite
+// values) as null. Each chunk is written as soon as it is read, so
+// that the output can be piped to other tools while the input is
+// read. Returns an error if a chunk does not have a time metric, or if
+// there are any errors writing data.
+func WriteJSONL(ctx context.Context, iter *ChunkIterator, w io.Writer, opts JSONLOptions) error {
+	if err := opts.Validate(); err != nil {
+		return errors.Wrap(err, "invalid options")
+	}
+
+	buf := bufio.NewWriter(w)
+	for iter.Next() {
+		if ctx.Err() != nil {
+			return errors.New("operation aborted")
+		}
+
+		if err := writeJSONLChunk(buf, iter.Chunk(), &opts); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := buf.Flush(); err != nil {
+			return errors.Wrap(err, "problem writing json")
+		}
+	}
+
+	return errors.Wrap(iter.Err(), "problem reading chunks")
+}
+
+func jsonlTimeMetric(chunk *Chunk, key string) *Metric {
+	for idx := range chunk.Metrics {
+		m := &chunk.Metrics[idx]
+		if m.Type() != bsontype.DateTime {
+			continue
+		}
+		if key == "" || m.Key() == key {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func appendJSONLTime(out []byte, value int64) []byte {
+	out = append(out, '"')
+	out = timeEpocMs(value).UTC().AppendFormat(out, jsonlTimeFormat)
+	return append(out, '"')
+}
+
+func appendJSONLValue(out []byte, m *Metric, value int64) []byte {
+	switch m.Type() {
+	case bsontype.Double:
+		f := math.Float64frombits(uint64(value))
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return append(out, "null"...)
+		}
+		return strconv.AppendFloat(out, f, 'g', -1, 64)
+	case bsontype.Boolean:
+		return strconv.AppendBool(out, value != 0)
+	case bsontype.DateTime:
+		return appendJSONLTime(out, value)
+	default:
+		return strconv.AppendInt(out, value, 10)
+	}
+}
+
+func writeJSONLChunk(w *bufio.Writer, chunk *Chunk, opts *JSONLOptions) error {
+	timeMetric := jsonlTimeMetric(chunk, opts.TimeKey)
+	if timeMetric == nil {
+		if opts.TimeKey != "" {
+			return errors.Errorf("chunk does not have the date time metric '%s'", opts.TimeKey)
+		}
+		return errors.New("chunk does not have a date time metric")
+	}
+
+	// the quoted names of the fields are the same for every sample.
+	timeField, err := json.Marshal(opts.TimeField)
+	if err != nil {
+		return errors.Wrap(err, "problem encoding time field name")
+	}
+	metrics := []*Metric{}
+	fields := [][]byte{}
+	for idx := range chunk.Metrics {
+		m := &chunk.Metrics[idx]
+		key := m.Key()
+		if m == timeMetric || (opts.Keys != nil && !opts.Keys.MatchKey(key)) {
+			continue
+		}
+
+		field, err := json.Marshal(key)
+		if err != nil {
+			return errors.Wrapf(err, "problem encoding key '%s'", key)
+		}
+		metrics = append(metrics, m)
+		fields = append(fields, field)
+	}
+
+	line := []byte{}
+	for i := 0; i < chunk.Size(); i++ {
+		line = append(line[:0], '{')
+		line = append(line, timeField...)
+		line = append(line, ':')
+		line = appendJSONLTime(line, timeMetric.Values[i])
+
+		for idx, m := range metrics {
+			line = append(line, ',')
+			line = append(line, fields[idx]...)
+			line = append(line, ':')
+			line = appendJSONLValue(line, m, m.Values[i])
+		}
+
+		line = append(line, '}', '\n')
+		if _, err := w.Write(line); err != nil {
+			return errors.Wrap(err, "problem writing json")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package ftdc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteJSONL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 12, 0, 0, 0, time.UTC)
+	buf := &bytes.Buffer{}
+	collector := NewStreamingFloatPreservingCollector(5, buf)
+	for i := 0; i < 12; i++ {
+		ratio := float64(i) / 4
+		if i == 3 {
+			ratio = math.NaN()
+		}
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second+250*time.Millisecond)),
+			bsonx.EC.SubDocument("conn", bsonx.NewDocument(
+				bsonx.EC.Int64("current", int64(10+i)),
+				bsonx.EC.Double("ratio", ratio),
+				bsonx.EC.Boolean("ok", i%2 == 0),
+			)),
+			bsonx.EC.Time("last", base.Add(-time.Hour)),
+		)))
+	}
+	require.NoError(t, FlushCollector(collector, buf))
+	data := buf.Bytes()
+
+	read := func(t *testing.T, out []byte) []map[string]interface{} {
+		records := []map[string]interface{}{}
+		scanner := bufio.NewScanner(bytes.NewReader(out))
+		for scanner.Scan() {
+			record := map[string]interface{}{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &record), scanner.Text())
+			records = append(records, record)
+		}
+		require.NoError(t, scanner.Err())
+		return records
+	}
+
+	t.Run("Samples", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, WriteJSONL(ctx, ReadChunks(ctx, bytes.NewReader(data)), out, JSONLOptions{}))
+
+		records := read(t, out.Bytes())
+		require.Len(t, records, 12)
+		assert.Equal(t, map[string]interface{}{
+			"ts":           "2018-06-01T12:00:02.250Z",
+			"conn.current": 12.0,
+			"conn.ratio":   0.5,
+			"conn.ok":      true,
+			"last":         "2018-06-01T11:00:00.000Z",
+		}, records[2])
+		assert.Nil(t, records[3]["conn.ratio"])
+		assert.Contains(t, records[3], "conn.ratio")
+		assert.Equal(t, false, records[3]["conn.ok"])
+		assert.Equal(t, "2018-06-01T12:00:11.250Z", records[11]["ts"])
+	})
+	t.Run("Options", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		matcher, err := NewGlobMatcher("conn.current")
+		require.NoError(t, err)
+		require.NoError(t, WriteJSONL(ctx, ReadChunks(ctx, bytes.NewReader(data)), out, JSONLOptions{
+			TimeKey:   "last",
+			TimeField: "@timestamp",
+			Keys:      matcher,
+		}))
+
+		records := read(t, out.Bytes())
+		require.Len(t, records, 12)
+		assert.Equal(t, map[string]interface{}{
+			"@timestamp":   "2018-06-01T11:00:00.000Z",
+			"conn.current": 10.0,
+		}, records[0])
+	})
+	t.Run("MissingTime", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		err := WriteJSONL(ctx, ReadChunks(ctx, bytes.NewReader(data)), out, JSONLOptions{TimeKey: "conn.current"})
+		assert.Error(t, err)
+
+		collector := NewBaseCollector(10)
+		require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("a", 1))))
+		chunk, err := collector.Resolve()
+		require.NoError(t, err)
+		assert.Error(t, WriteJSONL(ctx, ReadChunks(ctx, bytes.NewReader(chunk)), out, JSONLOptions{}))
+	})
+	t.Run("Canceled", func(t *testing.T) {
+		cctx, ccancel := context.WithCancel(ctx)
+		ccancel()
+		out := &bytes.Buffer{}
+		assert.Error(t, WriteJSONL(cctx, ReadChunks(ctx, bytes.NewReader(data)), out, JSONLOptions{}))
+		assert.Zero(t, out.Len())
+	})
+}
@@ -0,0 +1,90 @@
+package ftdc
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// The grouping collector reorders the columns of a chunk's payload so
+// that metrics whose value never changed within the chunk (cold
+// metrics) follow all other (hot) metrics. Because the deltas of cold
+// metrics are all zero, they collapse into a single run in the
+// payload's run-length encoding, regardless of how they were
+// interleaved with hot metrics in the sample documents.
+//
+// When the order differs from the order of the reference document,
+// the chunk document holds a bitmap of the cold metrics in its "cold"
+// field, which the reader uses to restore the original order.
+const coldMetricsField = "cold"
+
+// NewStreamingGroupingCollector provides a streaming collector (see
+// NewStreamingCollector) that writes chunks in the same format as the
+// grouping collector, so that long running collections, which are
+// dominated by metrics that rarely change (e.g. configuration values),
+// store each chunk's unchanging metrics as a single run.
+func NewStreamingGroupingCollector(maxSamples int, writer io.Writer) Collector {
+	c := newStreamingCollector(maxSamples, writer)
+	c.Collector.(*betterCollector).groupKeys = true
+	return c
+}
+
+// coldBitmap returns a bitmap with a bit set for every metric that
+// is not hot, or nil if the cold metrics already follow all hot
+// metrics, in which case the payload uses the standard layout.
+func coldBitmap(hot []bool) []byte {
+	grouped := true
+	seenCold := false
+	for _, h := range hot {
+		if !h {
+			seenCold = true
+		} else if seenCold {
+			grouped = false
+			break
+		}
+	}
+	if grouped {
+		return nil
+	}
+
+	out := make([]byte, (len(hot)+7)/8)
+	for idx, h := range hot {
+		if !h {
+			out[idx/8] |= 1 << uint(idx%8)
+		}
+	}
+
+	return out
+}
+
+// columnOrder returns the order in which the columns of a payload are
+// written, given a cold bitmap: all hot metrics followed by all cold
+// metrics, each in their original order. A nil bitmap produces the
+// standard order.
+func columnOrder(cold []byte, num int) ([]int, error) {
+	out := make([]int, 0, num)
+	if cold == nil {
+		for idx := 0; idx < num; idx++ {
+			out = append(out, idx)
+		}
+		return out, nil
+	}
+
+	if len(cold) != (num+7)/8 {
+		return nil, errors.Errorf("cold metrics bitmap has %d bytes for %d metrics", len(cold), num)
+	}
+
+	isCold := func(idx int) bool { return cold[idx/8]&(1<<uint(idx%8)) != 0 }
+	for idx := 0; idx < num; idx++ {
+		if !isCold(idx) {
+			out = append(out, idx)
+		}
+	}
+	for idx := 0; idx < num; idx++ {
+		if isCold(idx) {
+			out = append(out, idx)
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,132 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnOrder(t *testing.T) {
+	assert.Nil(t, coldBitmap([]bool{true, true, false, false}))
+	assert.Nil(t, coldBitmap([]bool{false, false}))
+	assert.Nil(t, coldBitmap(nil))
+
+	cold := coldBitmap([]bool{false, true, false, false, false, false, false, false, false, true})
+	require.Equal(t, []byte{0xfd, 0x01}, cold)
+
+	order, err := columnOrder(cold, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 9, 0, 2, 3, 4, 5, 6, 7, 8}, order)
+
+	order, err = columnOrder(nil, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2}, order)
+
+	_, err = columnOrder(cold, 20)
+	assert.Error(t, err)
+}
+
+func TestGroupingCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// interleave metrics that never change with metrics that
+	// change in every sample.
+	samples := make([]*bsonx.Document, 100)
+	for i := range samples {
+		doc := bsonx.NewDocument()
+		for j := 0; j < 20; j++ {
+			if j%2 == 0 {
+				doc.Append(bsonx.EC.Int64(string(rune('a'+j)), int64(i*j)))
+			} else {
+				doc.Append(bsonx.EC.Int64(string(rune('a'+j)), int64(j)))
+			}
+		}
+		samples[i] = doc
+	}
+
+	base := NewBaseCollector(len(samples))
+	grouped := NewGroupingCollector(len(samples))
+	for _, doc := range samples {
+		require.NoError(t, base.Add(doc))
+		require.NoError(t, grouped.Add(doc))
+	}
+
+	baseData, err := base.Resolve()
+	require.NoError(t, err)
+	groupedData, err := grouped.Resolve()
+	require.NoError(t, err)
+
+	chunkDoc, err := bsonx.ReadDocument(groupedData)
+	require.NoError(t, err)
+	assert.NotNil(t, chunkDoc.LookupElement(coldMetricsField))
+
+	_, basePayload := mustDocument(t, baseData).Lookup("data").Binary()
+	_, groupedPayload := chunkDoc.Lookup("data").Binary()
+	assert.True(t, len(groupedPayload) < len(basePayload), "%d < %d", len(groupedPayload), len(basePayload))
+
+	iter := ReadMetrics(ctx, bytes.NewBuffer(groupedData))
+	defer iter.Close()
+	idx := 0
+	for iter.Next() {
+		require.True(t, idx < len(samples))
+		assert.True(t, samples[idx].Equal(iter.Document()), "sample %d", idx)
+		idx++
+	}
+	require.NoError(t, iter.Err())
+	assert.Equal(t, len(samples), idx)
+
+	t.Run("Streaming", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		streaming := NewStreamingGroupingCollector(30, buf)
+		for _, doc := range samples {
+			require.NoError(t, streaming.Add(doc))
+		}
+		require.NoError(t, FlushCollector(streaming, buf))
+
+		// every chunk of the stream groups its unchanging
+		// metrics.
+		data := buf.Bytes()
+		num := 0
+		for len(data) > 0 {
+			size := int(binary.LittleEndian.Uint32(data))
+			doc := mustDocument(t, data[:size])
+			assert.NotNil(t, doc.LookupElement(coldMetricsField), "chunk %d", num)
+			data = data[size:]
+			num++
+		}
+		assert.Equal(t, 4, num)
+
+		iter := ReadMetrics(ctx, bytes.NewReader(buf.Bytes()))
+		defer iter.Close()
+		idx := 0
+		for iter.Next() {
+			require.True(t, idx < len(samples))
+			assert.True(t, samples[idx].Equal(iter.Document()), "sample %d", idx)
+			idx++
+		}
+		require.NoError(t, iter.Err())
+		assert.Equal(t, len(samples), idx)
+	})
+	t.Run("InvalidBitmap", func(t *testing.T) {
+		chunkDoc.Set(bsonx.EC.Binary(coldMetricsField, []byte{0xff}))
+		data, err := chunkDoc.MarshalBSON()
+		require.NoError(t, err)
+
+		iter := ReadChunks(ctx, bytes.NewBuffer(data))
+		defer iter.Close()
+		assert.False(t, iter.Next())
+		assert.Error(t, iter.Err())
+	})
+}
+
+func mustDocument(t *testing.T, data []byte) *bsonx.Document {
+	doc, err := bsonx.ReadDocument(data)
+	require.NoError(t, err)
+	return doc
+}
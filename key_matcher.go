@@ -0,0 +1,149 @@
+package ftdc
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// KeyMatcher selects metrics by their keys, which are fully qualified
+// dot-separated paths, as returned by Metric.Key.
+type KeyMatcher interface {
+	MatchKey(key string) bool
+}
+
+// KeyMatcherFunc is an adapter that makes a function a KeyMatcher.
+type KeyMatcherFunc func(key string) bool
+
+// MatchKey calls the function.
+func (f KeyMatcherFunc) MatchKey(key string) bool { return f(key) }
+
+type regexpMatcher []*regexp.Regexp
+
+func (m regexpMatcher) MatchKey(key string) bool {
+	for _, re := range m {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRegexpMatcher returns a KeyMatcher that matches the keys that
+// match any of the regular expressions. As with regexp.MatchString,
+// patterns match substrings of the key unless they are anchored.
+func NewRegexpMatcher(patterns ...string) (KeyMatcher, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("must specify at least one pattern")
+	}
+
+	out := make(regexpMatcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem compiling pattern '%s'", pattern)
+		}
+		out = append(out, re)
+	}
+
+	return out, nil
+}
+
+// NewGlobMatcher returns a KeyMatcher that matches the keys that match
+// any of the glob patterns (e.g. "wiredTiger.cache.*"). Patterns match
+// the entire key: "*" matches any sequence of characters within a
+// single path component, "**" matches any sequence of characters,
+// including across components, and "?" matches any single character
+// other than a dot. All other characters match themselves.
+func NewGlobMatcher(patterns ...string) (KeyMatcher, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("must specify at least one pattern")
+	}
+
+	out := make(regexpMatcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return nil, errors.New("glob patterns cannot be empty")
+		}
+		out = append(out, regexp.MustCompile(globToRegexp(pattern)))
+	}
+
+	return out, nil
+}
+
+func globToRegexp(pattern string) string {
+	out := &strings.Builder{}
+	out.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			out.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			out.WriteString(`[^.]*`)
+		case pattern[i] == '?':
+			out.WriteString(`[^.]`)
+		default:
+			out.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	out.WriteString("$")
+
+	return out.String()
+}
+
+// IteratorFiltered is the same as Iterator, except that the documents
+// only hold the metrics whose keys match, so that the cost of
+// producing documents depends on the number of matching metrics
+// rather than on the number of metrics in the chunk.
+func (c *Chunk) IteratorFiltered(ctx context.Context, matcher KeyMatcher) Iterator {
+	filtered := *c
+	filtered.Metrics = make([]Metric, 0, len(c.Metrics))
+	for _, metric := range c.Metrics {
+		if matcher.MatchKey(metric.Key()) {
+			filtered.Metrics = append(filtered.Metrics, metric)
+		}
+	}
+
+	return filtered.Iterator(ctx)
+}
+
+// ReadMetricsFiltered is the same as ReadMetrics, except that the
+// documents only hold the metrics whose keys match. Only the values of
+// matching metrics are decoded, which is much less expensive than
+// reading every metric when only a few of them are needed. Samples
+// from chunks without matching metrics are empty documents.
+func ReadMetricsFiltered(ctx context.Context, r io.Reader, matcher KeyMatcher) Iterator {
+	include := func(m *Metric) bool { return matcher.MatchKey(m.Key()) }
+
+	iterctx, cancel := context.WithCancel(ctx)
+	chunks := &ChunkIterator{
+		catcher: grip.NewBasicCatcher(),
+		pipe:    make(chan *Chunk, 2),
+		cancel:  cancel,
+	}
+
+	ipc := make(chan *bsonx.Document)
+	go func() {
+		chunks.catcher.Add(readDiagnostic(iterctx, r, ipc))
+	}()
+	go func() {
+		chunks.catcher.Add(readFilteredChunks(iterctx, ipc, chunks.pipe, include, nil))
+	}()
+
+	iter := &combinedIterator{
+		closer:  cancel,
+		chunks:  chunks,
+		flatten: true,
+		pipe:    make(chan *bsonx.Document, 100),
+		catcher: grip.NewBasicCatcher(),
+	}
+
+	go iter.worker(iterctx)
+	return iter
+}
@@ -0,0 +1,151 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyMatchers(t *testing.T) {
+	t.Run("Glob", func(t *testing.T) {
+		matcher, err := NewGlobMatcher("wiredTiger.cache.*", "opcounters.?uery", "network.**")
+		require.NoError(t, err)
+
+		for key, expected := range map[string]bool{
+			"wiredTiger.cache.bytes read into cache": true,
+			"wiredTiger.cache":                       false,
+			"wiredTiger.cache.pages.evicted":         false,
+			"wiredTiger.cacheX.bytes":                false,
+			"opcounters.query":                       true,
+			"opcounters.xquery":                      false,
+			"network.bytesIn":                        true,
+			"network.compression.snappy.bytesIn":     true,
+			"xnetwork.bytesIn":                       false,
+			"connections.current":                    false,
+		} {
+			assert.Equal(t, expected, matcher.MatchKey(key), key)
+		}
+	})
+	t.Run("GlobEscapesMetacharacters", func(t *testing.T) {
+		matcher, err := NewGlobMatcher("a+b.(c)")
+		require.NoError(t, err)
+		assert.True(t, matcher.MatchKey("a+b.(c)"))
+		assert.False(t, matcher.MatchKey("aab.c"))
+	})
+	t.Run("Regexp", func(t *testing.T) {
+		matcher, err := NewRegexpMatcher(`^wiredTiger\.cache\.`, `Latency$`)
+		require.NoError(t, err)
+		assert.True(t, matcher.MatchKey("wiredTiger.cache.pages.evicted"))
+		assert.True(t, matcher.MatchKey("opLatencies.reads.Latency"))
+		assert.False(t, matcher.MatchKey("wiredTiger.log.bytes"))
+	})
+	t.Run("Func", func(t *testing.T) {
+		matcher := KeyMatcherFunc(func(key string) bool { return key == "a" })
+		assert.True(t, matcher.MatchKey("a"))
+		assert.False(t, matcher.MatchKey("b"))
+	})
+	t.Run("Errors", func(t *testing.T) {
+		_, err := NewGlobMatcher()
+		assert.Error(t, err)
+		_, err = NewGlobMatcher("")
+		assert.Error(t, err)
+		_, err = NewRegexpMatcher()
+		assert.Error(t, err)
+		_, err = NewRegexpMatcher("(")
+		assert.Error(t, err)
+	})
+}
+
+func TestFilteredIterators(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	buf := &bytes.Buffer{}
+	collector := NewBaseCollector(10)
+	for i := 0; i < 25; i++ {
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.SubDocumentFromElements("cache",
+				bsonx.EC.Int64("read", int64(i)),
+				bsonx.EC.Double("ratio", float64(i)/2),
+			),
+			bsonx.EC.SubDocumentFromElements("log",
+				bsonx.EC.Int64("bytes", int64(i*100)),
+			),
+			bsonx.EC.Boolean("ok", i%2 == 0),
+		)))
+		if collector.Info().SampleCount == 10 {
+			require.NoError(t, FlushCollector(collector, buf))
+		}
+	}
+	require.NoError(t, FlushCollector(collector, buf))
+	data := buf.Bytes()
+
+	matcher, err := NewGlobMatcher("cache.*", "ok")
+	require.NoError(t, err)
+
+	// check compares the filtered documents to the documents of
+	// the unfiltered iterator, without the log metrics.
+	check := func(t *testing.T, iter Iterator) {
+		defer iter.Close()
+		expected := ReadMetrics(ctx, bytes.NewReader(data))
+		defer expected.Close()
+
+		count := 0
+		for iter.Next() {
+			require.True(t, expected.Next())
+			doc := iter.Document()
+			full := expected.Document()
+
+			assert.Equal(t, 3, doc.Len())
+			assert.Nil(t, doc.Lookup("log.bytes"))
+			for _, key := range []string{"cache.read", "cache.ratio", "ok"} {
+				assert.Equal(t, full.Lookup(key).Interface(), doc.Lookup(key).Interface(), key)
+			}
+			count++
+		}
+		require.NoError(t, iter.Err())
+		assert.Equal(t, 25, count)
+	}
+
+	t.Run("ReadMetricsFiltered", func(t *testing.T) {
+		check(t, ReadMetricsFiltered(ctx, bytes.NewReader(data), matcher))
+	})
+	t.Run("IteratorFiltered", func(t *testing.T) {
+		chunks := ReadChunks(ctx, bytes.NewReader(data))
+		defer chunks.Close()
+
+		count := 0
+		for chunks.Next() {
+			chunk := chunks.Chunk()
+			iter := chunk.IteratorFiltered(ctx, matcher)
+			for iter.Next() {
+				doc := iter.Document()
+				assert.Equal(t, 3, doc.Len())
+				assert.EqualValues(t, count, doc.Lookup("cache.read").Int64())
+				count++
+			}
+			iter.Close()
+
+			// the chunk itself is not modified
+			assert.Len(t, chunk.Metrics, 4)
+		}
+		require.NoError(t, chunks.Err())
+		assert.Equal(t, 25, count)
+	})
+	t.Run("NoMatches", func(t *testing.T) {
+		iter := ReadMetricsFiltered(ctx, bytes.NewReader(data), KeyMatcherFunc(func(string) bool { return false }))
+		defer iter.Close()
+
+		count := 0
+		for iter.Next() {
+			assert.Equal(t, 0, iter.Document().Len())
+			count++
+		}
+		require.NoError(t, iter.Err())
+		assert.Equal(t, 25, count)
+	})
+}
@@ -0,0 +1,72 @@
+package ftdc
+
+import (
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// Periodic Metadata
+//
+// In addition to the metadata document (type 0) at the start of each
+// file and the metric chunks (type 1), newer versions of mongod
+// periodically capture metadata that may change while the server
+// runs (e.g. the server parameters and the feature compatibility
+// version) in documents with a type of 2:
+//
+//	{ _id: <date>, type: 2, count: <int>, doc: <document> }
+//
+// The first capture of each file, with a count of 0, holds the entire
+// document, and later captures only hold the fields that changed
+// since the previous capture.
+const periodicMetadataType = 2
+
+// PeriodicMetadata returns the periodic metadata that mongod captured
+// before the chunk, with the changes of every capture since the last
+// complete capture applied, or nil if the data has no periodic
+// metadata captures.
+func (c *Chunk) PeriodicMetadata() *bsonx.Document { return c.periodic }
+
+// periodicMetadata reconstructs the periodic metadata from the
+// captures that precede each chunk.
+type periodicMetadata struct {
+	doc *bsonx.Document
+}
+
+func (p *periodicMetadata) add(doc *bsonx.Document) error {
+	delta, ok := doc.Lookup("doc").MutableDocumentOK()
+	if !ok {
+		return errors.New("periodic metadata document has no 'doc' document")
+	}
+
+	if p.doc == nil || isNum(0, doc.Lookup("count")) {
+		p.doc = delta
+		return nil
+	}
+
+	// chunks hold the document that was current when they were
+	// read, so the changes are applied to a copy.
+	p.doc = mergeMetadata(p.doc, delta)
+	return nil
+}
+
+// mergeMetadata returns a copy of the document with the fields of the
+// delta replacing those of the document, recursively for embedded
+// documents that both hold.
+func mergeMetadata(doc, delta *bsonx.Document) *bsonx.Document {
+	out := doc.Clone()
+
+	iter := delta.Iterator()
+	for iter.Next() {
+		elem := iter.Element()
+		if elem.Value().Type() == bsontype.EmbeddedDocument {
+			if current, ok := doc.Lookup(elem.Key()).MutableDocumentOK(); ok {
+				out.Set(bsonx.EC.SubDocument(elem.Key(), mergeMetadata(current, elem.Value().MutableDocument())))
+				continue
+			}
+		}
+		out.Set(elem)
+	}
+
+	return out
+}
@@ -0,0 +1,112 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeriodicMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	buf := &bytes.Buffer{}
+	writeDoc := func(doc *bsonx.Document) {
+		_, err := doc.WriteTo(buf)
+		require.NoError(t, err)
+	}
+	writeChunk := func(start int) {
+		collector := NewBaseCollector(10)
+		for i := start; i < start+3; i++ {
+			require.NoError(t, collector.Add(bsonx.NewDocument(
+				bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+				bsonx.EC.Int64("counter", int64(i)),
+			)))
+		}
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+		_, err = buf.Write(data)
+		require.NoError(t, err)
+	}
+	periodic := func(count int32, doc *bsonx.Document) {
+		writeDoc(bsonx.NewDocument(
+			bsonx.EC.Time("_id", base),
+			bsonx.EC.Int32("type", periodicMetadataType),
+			bsonx.EC.Int32("count", count),
+			bsonx.EC.SubDocument("doc", doc),
+		))
+	}
+
+	writeChunk(0)
+	periodic(0, bsonx.NewDocument(
+		bsonx.EC.SubDocumentFromElements("getParameter",
+			bsonx.EC.String("fcv", "6.0"),
+			bsonx.EC.Int32("ttlMonitorEnabled", 1),
+		),
+		bsonx.EC.String("host", "example"),
+	))
+	writeChunk(3)
+	periodic(1, bsonx.NewDocument(
+		bsonx.EC.SubDocumentFromElements("getParameter", bsonx.EC.String("fcv", "7.0")),
+	))
+	writeDoc(bsonx.NewDocument(bsonx.EC.Int32("type", 42), bsonx.EC.String("unknown", "kind")))
+	writeChunk(6)
+
+	check := func(t *testing.T, iter *ChunkIterator) {
+		defer iter.Close()
+
+		chunks := []*Chunk{}
+		for iter.Next() {
+			chunks = append(chunks, iter.Chunk())
+		}
+		require.NoError(t, iter.Err())
+		require.Len(t, chunks, 3)
+
+		assert.Nil(t, chunks[0].PeriodicMetadata())
+
+		first := chunks[1].PeriodicMetadata()
+		require.NotNil(t, first)
+		fcv, err := first.LookupPathErr("getParameter.fcv")
+		require.NoError(t, err)
+		assert.Equal(t, "6.0", fcv.StringValue())
+
+		second := chunks[2].PeriodicMetadata()
+		require.NotNil(t, second)
+		fcv, err = second.LookupPathErr("getParameter.fcv")
+		require.NoError(t, err)
+		assert.Equal(t, "7.0", fcv.StringValue())
+		ttl, err := second.LookupPathErr("getParameter.ttlMonitorEnabled")
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, ttl.Int32())
+		assert.Equal(t, "example", second.Lookup("host").StringValue())
+
+		// earlier chunks keep the metadata of their capture.
+		fcv, err = first.LookupPathErr("getParameter.fcv")
+		require.NoError(t, err)
+		assert.Equal(t, "6.0", fcv.StringValue())
+	}
+
+	t.Run("ReadChunks", func(t *testing.T) {
+		check(t, ReadChunks(ctx, bytes.NewReader(buf.Bytes())))
+	})
+	t.Run("Parallel", func(t *testing.T) {
+		check(t, ReadChunksWithOptions(ctx, bytes.NewReader(buf.Bytes()), ReadChunksOptions{Workers: 4}))
+	})
+	t.Run("InvalidCapture", func(t *testing.T) {
+		data := append([]byte{}, buf.Bytes()...)
+		invalid := bsonx.NewDocument(bsonx.EC.Int32("type", periodicMetadataType), bsonx.EC.Int32("count", 1))
+		raw, err := invalid.MarshalBSON()
+		require.NoError(t, err)
+		iter := ReadChunks(ctx, bytes.NewReader(append(raw, data...)))
+		defer iter.Close()
+		for iter.Next() {
+		}
+		assert.Error(t, iter.Err())
+	})
+}
@@ -0,0 +1,278 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultCgroupRoot is the mount point of the cgroup file system, which
+// is the cgroup of the container for processes that run in a cgroup
+// namespace (e.g. in Kubernetes and Docker).
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// CgroupInfo holds the resource limits and usage of the cgroup (i.e.
+// the container) that a process runs in. Limits that are not set, or
+// that the kernel does not report, are -1. Other metrics that the
+// kernel does not report (e.g. pressure stall information for cgroup
+// v1) are zero.
+type CgroupInfo struct {
+	Version int            `json:"version" bson:"version"`
+	CPU     CgroupCPU      `json:"cpu" bson:"cpu"`
+	Memory  CgroupMemory   `json:"memory" bson:"memory"`
+	IO      CgroupPressure `json:"io" bson:"io"`
+}
+
+// CgroupCPU holds the CPU quota and usage of a cgroup. Times are in
+// microseconds.
+type CgroupCPU struct {
+	Quota            int64          `json:"quota" bson:"quota"`
+	Period           int64          `json:"period" bson:"period"`
+	Usage            int64          `json:"usage" bson:"usage"`
+	Periods          int64          `json:"periods" bson:"periods"`
+	ThrottledPeriods int64          `json:"throttled_periods" bson:"throttled_periods"`
+	ThrottledTime    int64          `json:"throttled_time" bson:"throttled_time"`
+	Pressure         CgroupPressure `json:"pressure" bson:"pressure"`
+}
+
+// CgroupMemory holds the memory limit and usage of a cgroup, in bytes.
+type CgroupMemory struct {
+	Current  int64          `json:"current" bson:"current"`
+	Limit    int64          `json:"limit" bson:"limit"`
+	Pressure CgroupPressure `json:"pressure" bson:"pressure"`
+}
+
+// CgroupPressure holds the pressure stall information of a resource:
+// the total time, in microseconds, that some or all of the tasks in
+// the cgroup were stalled waiting for the resource. The averages are
+// not collected, as they can be derived from the totals.
+type CgroupPressure struct {
+	Some int64 `json:"some" bson:"some"`
+	Full int64 `json:"full" bson:"full"`
+}
+
+// CollectCgroupInfo reads the limits and usage of the cgroup mounted
+// at the root directory, which may use either the unified (v2) or the
+// legacy (v1) hierarchy. Files that the kernel does not provide are
+// ignored.
+func CollectCgroupInfo(root string) (*CgroupInfo, error) {
+	if root == "" {
+		root = DefaultCgroupRoot
+	}
+
+	if _, err := os.Stat(root); err != nil {
+		return nil, errors.Wrapf(err, "problem finding cgroup at '%s'", root)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return collectCgroupV2(root)
+	}
+	return collectCgroupV1(root)
+}
+
+func collectCgroupV2(root string) (*CgroupInfo, error) {
+	out := &CgroupInfo{Version: 2}
+	var err error
+
+	if out.CPU.Quota, out.CPU.Period, err = readCPUMax(filepath.Join(root, "cpu.max")); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	stat, err := readKeyValues(filepath.Join(root, "cpu.stat"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	out.CPU.Usage = stat["usage_usec"]
+	out.CPU.Periods = stat["nr_periods"]
+	out.CPU.ThrottledPeriods = stat["nr_throttled"]
+	out.CPU.ThrottledTime = stat["throttled_usec"]
+
+	if out.Memory.Current, err = readCgroupValue(filepath.Join(root, "memory.current"), 0); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if out.Memory.Limit, err = readCgroupValue(filepath.Join(root, "memory.max"), -1); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for fn, pressure := range map[string]*CgroupPressure{
+		"cpu.pressure":    &out.CPU.Pressure,
+		"memory.pressure": &out.Memory.Pressure,
+		"io.pressure":     &out.IO,
+	} {
+		if *pressure, err = readPressure(filepath.Join(root, fn)); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return out, nil
+}
+
+func collectCgroupV1(root string) (*CgroupInfo, error) {
+	out := &CgroupInfo{Version: 1}
+	var err error
+
+	if out.CPU.Quota, err = readCgroupValue(filepath.Join(root, "cpu", "cpu.cfs_quota_us"), -1); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if out.CPU.Period, err = readCgroupValue(filepath.Join(root, "cpu", "cpu.cfs_period_us"), -1); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	stat, err := readKeyValues(filepath.Join(root, "cpu", "cpu.stat"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	out.CPU.Periods = stat["nr_periods"]
+	out.CPU.ThrottledPeriods = stat["nr_throttled"]
+	out.CPU.ThrottledTime = stat["throttled_time"] / 1000
+
+	usage, err := readCgroupValue(filepath.Join(root, "cpuacct", "cpuacct.usage"), 0)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	out.CPU.Usage = usage / 1000
+
+	if out.Memory.Current, err = readCgroupValue(filepath.Join(root, "memory", "memory.usage_in_bytes"), 0); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if out.Memory.Limit, err = readCgroupValue(filepath.Join(root, "memory", "memory.limit_in_bytes"), -1); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return out, nil
+}
+
+// readCgroupFile returns the contents of a cgroup file, or nil if the
+// file does not exist.
+func readCgroupFile(fn string) ([]byte, error) {
+	data, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading '%s'", fn)
+	}
+	return bytes.TrimSpace(data), nil
+}
+
+// readCgroupValue reads a file that holds a single number, or "max"
+// for limits that are not set, which is returned as -1. The value for
+// missing files is the specified default.
+func readCgroupValue(fn string, missing int64) (int64, error) {
+	data, err := readCgroupFile(fn)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if data == nil {
+		return missing, nil
+	}
+	if string(data) == "max" {
+		return -1, nil
+	}
+
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "problem parsing '%s'", fn)
+	}
+	return value, nil
+}
+
+// readCPUMax reads the quota and period of a cgroup v2 cpu.max file.
+func readCPUMax(fn string) (int64, int64, error) {
+	data, err := readCgroupFile(fn)
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+	if data == nil {
+		return -1, -1, nil
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return 0, 0, errors.Errorf("malformed cpu limit in '%s'", fn)
+	}
+
+	quota := int64(-1)
+	if fields[0] != "max" {
+		if quota, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+			return 0, 0, errors.Wrapf(err, "problem parsing cpu quota in '%s'", fn)
+		}
+	}
+	period, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "problem parsing cpu period in '%s'", fn)
+	}
+
+	return quota, period, nil
+}
+
+// readKeyValues reads a file of "<key> <value>" lines, such as
+// cpu.stat.
+func readKeyValues(fn string) (map[string]int64, error) {
+	data, err := readCgroupFile(fn)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out := map[string]int64{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem parsing '%s' in '%s'", fields[0], fn)
+		}
+		out[fields[0]] = value
+	}
+
+	return out, errors.WithStack(scanner.Err())
+}
+
+// readPressure reads the totals of a pressure stall information file,
+// which has lines of the form:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func readPressure(fn string) (CgroupPressure, error) {
+	out := CgroupPressure{}
+	data, err := readCgroupFile(fn)
+	if err != nil {
+		return out, errors.WithStack(err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var total int64
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "total=") {
+				continue
+			}
+			if total, err = strconv.ParseInt(strings.TrimPrefix(field, "total="), 10, 64); err != nil {
+				return out, errors.Wrapf(err, "problem parsing pressure in '%s'", fn)
+			}
+		}
+
+		switch fields[0] {
+		case "some":
+			out.Some = total
+		case "full":
+			out.Full = total
+		}
+	}
+
+	return out, errors.WithStack(scanner.Err())
+}
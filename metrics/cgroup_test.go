@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCgroupFiles(t *testing.T, root string, files map[string]string) {
+	for fn, content := range files {
+		path := filepath.Join(root, fn)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestCollectCgroupInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftdc-cgroup-")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	t.Run("V2", func(t *testing.T) {
+		root := filepath.Join(dir, "v2")
+		writeCgroupFiles(t, root, map[string]string{
+			"cgroup.controllers": "cpu io memory pids\n",
+			"cpu.max":            "50000 100000\n",
+			"cpu.stat":           "usage_usec 1200\nuser_usec 1000\nsystem_usec 200\nnr_periods 40\nnr_throttled 3\nthrottled_usec 900\n",
+			"memory.current":     "4096\n",
+			"memory.max":         "max\n",
+			"cpu.pressure":       "some avg10=0.00 avg60=0.00 avg300=0.00 total=10\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=5\n",
+			"memory.pressure":    "some avg10=1.50 avg60=0.20 avg300=0.00 total=20\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=8\n",
+		})
+
+		info, err := CollectCgroupInfo(root)
+		require.NoError(t, err)
+		assert.Equal(t, &CgroupInfo{
+			Version: 2,
+			CPU: CgroupCPU{
+				Quota:            50000,
+				Period:           100000,
+				Usage:            1200,
+				Periods:          40,
+				ThrottledPeriods: 3,
+				ThrottledTime:    900,
+				Pressure:         CgroupPressure{Some: 10, Full: 5},
+			},
+			Memory: CgroupMemory{
+				Current:  4096,
+				Limit:    -1,
+				Pressure: CgroupPressure{Some: 20, Full: 8},
+			},
+		}, info)
+	})
+	t.Run("V1", func(t *testing.T) {
+		root := filepath.Join(dir, "v1")
+		writeCgroupFiles(t, root, map[string]string{
+			"cpu/cpu.cfs_quota_us":         "-1\n",
+			"cpu/cpu.cfs_period_us":        "100000\n",
+			"cpu/cpu.stat":                 "nr_periods 40\nnr_throttled 3\nthrottled_time 900000\n",
+			"cpuacct/cpuacct.usage":        "1200000\n",
+			"memory/memory.usage_in_bytes": "4096\n",
+			"memory/memory.limit_in_bytes": "8192\n",
+		})
+
+		info, err := CollectCgroupInfo(root)
+		require.NoError(t, err)
+		assert.Equal(t, &CgroupInfo{
+			Version: 1,
+			CPU: CgroupCPU{
+				Quota:            -1,
+				Period:           100000,
+				Usage:            1200,
+				Periods:          40,
+				ThrottledPeriods: 3,
+				ThrottledTime:    900,
+			},
+			Memory: CgroupMemory{
+				Current: 4096,
+				Limit:   8192,
+			},
+		}, info)
+	})
+	t.Run("MissingFiles", func(t *testing.T) {
+		root := filepath.Join(dir, "empty")
+		writeCgroupFiles(t, root, map[string]string{"cgroup.controllers": ""})
+
+		info, err := CollectCgroupInfo(root)
+		require.NoError(t, err)
+		assert.EqualValues(t, -1, info.CPU.Quota)
+		assert.EqualValues(t, -1, info.Memory.Limit)
+		assert.Zero(t, info.Memory.Current)
+	})
+	t.Run("MalformedFile", func(t *testing.T) {
+		root := filepath.Join(dir, "malformed")
+		writeCgroupFiles(t, root, map[string]string{
+			"cgroup.controllers": "",
+			"memory.current":     "lots\n",
+		})
+
+		_, err := CollectCgroupInfo(root)
+		assert.Error(t, err)
+	})
+	t.Run("MissingRoot", func(t *testing.T) {
+		_, err := CollectCgroupInfo(filepath.Join(dir, "none"))
+		assert.Error(t, err)
+	})
+	t.Run("Generate", func(t *testing.T) {
+		opts := CollectOptions{
+			SkipGolang:    true,
+			SkipSystem:    true,
+			SkipProcess:   true,
+			CollectCgroup: true,
+			CgroupRoot:    filepath.Join(dir, "v1"),
+		}
+		doc := opts.generate(context.Background(), 0)
+		cgroup := doc.Lookup("runtime").MutableDocument().Lookup("cgroup").MutableDocument()
+		assert.EqualValues(t, 1, cgroup.Lookup("version").Interface())
+		assert.EqualValues(t, 4096, cgroup.Lookup("memory").MutableDocument().Lookup("current").Interface())
+	})
+}
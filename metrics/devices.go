@@ -0,0 +1,224 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+)
+
+// DefaultProcRoot is the mount point of the proc file system, from
+// which CollectDeviceStats reads the counters of devices.
+const DefaultProcRoot = "/proc"
+
+// diskSectorSize is the size of the sectors that /proc/diskstats
+// counts, which is always 512 bytes, regardless of the sector size of
+// the device.
+const diskSectorSize = 512
+
+// DeviceFilter selects the block devices and network interfaces, by
+// name, whose counters CollectDeviceStats collects. Patterns use the
+// syntax of path.Match (e.g. "nvme*" or "loop?"). Devices must match
+// one of the Include patterns, if there are any, and must not match
+// any of the Exclude patterns.
+type DeviceFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// Validate checks that the patterns of the filter are well formed.
+func (f DeviceFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid device pattern '%s'", pattern)
+		}
+	}
+	return nil
+}
+
+func (f DeviceFilter) match(name string) bool {
+	for _, pattern := range f.Exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, pattern := range f.Include {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectDeviceStats reads the IO counters of each block device and
+// the traffic counters of each network interface that the filter
+// selects, from the proc file system mounted at the root directory
+// (DefaultProcRoot if empty), and returns them as a document with
+// stable keys, e.g.:
+//
+//	{ disk: { sda: { reads: ..., read_bytes: ... } },
+//	  net: { eth0: { rx_bytes: ..., tx_bytes: ... } } }
+//
+// Devices are sorted by name, so that the schema of the document only
+// changes when devices are added or removed. Dots in device names are
+// replaced with underscores, so that they do not introduce additional
+// levels in flattened keys (e.g. "net.eth0_100.rx_bytes" for a VLAN
+// interface). Times are in milliseconds.
+func CollectDeviceStats(root string, filter DeviceFilter) (*bsonx.Document, error) {
+	if root == "" {
+		root = DefaultProcRoot
+	}
+
+	disks, err := readDiskStats(filepath.Join(root, "diskstats"), filter)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	nics, err := readNetDevStats(filepath.Join(root, "net", "dev"), filter)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return bsonx.NewDocument(
+		bsonx.EC.SubDocument("disk", disks),
+		bsonx.EC.SubDocument("net", nics),
+	), nil
+}
+
+// diskStatsFields are the names of the counters in /proc/diskstats,
+// which follow the major and minor numbers and the name of each
+// device. Fields that are sector counts are converted to bytes.
+var diskStatsFields = []string{
+	"reads",
+	"reads_merged",
+	"read_bytes",
+	"read_time",
+	"writes",
+	"writes_merged",
+	"write_bytes",
+	"write_time",
+	"io_in_progress",
+	"io_time",
+	"weighted_io_time",
+}
+
+func readDiskStats(fn string, filter DeviceFilter) (*bsonx.Document, error) {
+	data, err := readCgroupFile(fn)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	devices := map[string]*bsonx.Document{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3+len(diskStatsFields) {
+			continue
+		}
+
+		name := fields[2]
+		if !filter.match(name) {
+			continue
+		}
+
+		doc := bsonx.DC.Make(len(diskStatsFields))
+		for idx, key := range diskStatsFields {
+			value, err := strconv.ParseInt(fields[3+idx], 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "problem parsing '%s' of device '%s'", key, name)
+			}
+			if key == "read_bytes" || key == "write_bytes" {
+				value *= diskSectorSize
+			}
+			doc.Append(bsonx.EC.Int64(key, value))
+		}
+		devices[name] = doc
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "problem reading '%s'", fn)
+	}
+
+	return deviceDocument(devices), nil
+}
+
+// netDevFields are the names of the counters in /proc/net/dev that
+// are collected, by their position in the receive and transmit
+// columns of each interface.
+var netDevFields = map[int]string{
+	0:  "rx_bytes",
+	1:  "rx_packets",
+	2:  "rx_errors",
+	3:  "rx_dropped",
+	8:  "tx_bytes",
+	9:  "tx_packets",
+	10: "tx_errors",
+	11: "tx_dropped",
+}
+
+var netDevPositions = []int{0, 1, 2, 3, 8, 9, 10, 11}
+
+func readNetDevStats(fn string, filter DeviceFilter) (*bsonx.Document, error) {
+	data, err := readCgroupFile(fn)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	devices := map[string]*bsonx.Document{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// the first two lines are headers, which have no
+		// colon after the interface name.
+		line := scanner.Text()
+		sep := strings.IndexByte(line, ':')
+		if sep < 0 {
+			continue
+		}
+
+		name := strings.TrimSpace(line[:sep])
+		fields := strings.Fields(line[sep+1:])
+		if len(fields) < 16 || !filter.match(name) {
+			continue
+		}
+
+		doc := bsonx.DC.Make(len(netDevPositions))
+		for _, pos := range netDevPositions {
+			value, err := strconv.ParseInt(fields[pos], 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "problem parsing '%s' of interface '%s'", netDevFields[pos], name)
+			}
+			doc.Append(bsonx.EC.Int64(netDevFields[pos], value))
+		}
+		devices[name] = doc
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "problem reading '%s'", fn)
+	}
+
+	return deviceDocument(devices), nil
+}
+
+// deviceDocument returns a document with the documents of the devices,
+// sorted by name.
+func deviceDocument(devices map[string]*bsonx.Document) *bsonx.Document {
+	names := make([]string, 0, len(devices))
+	for name := range devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := bsonx.DC.Make(len(names))
+	for _, name := range names {
+		out.Append(bsonx.EC.SubDocument(strings.Replace(name, ".", "_", -1), devices[name]))
+	}
+	return out
+}
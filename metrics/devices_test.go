@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/ftdc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectDeviceStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftdc-devices-")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	root := filepath.Join(dir, "proc")
+	writeCgroupFiles(t, root, map[string]string{
+		"diskstats": "   7       0 loop0 10 0 20 1 0 0 0 0 0 1 1 0 0 0 0\n" +
+			" 259       0 nvme0n1 100 5 800 40 200 10 1600 80 2 120 130 0 0 0 0\n" +
+			"   8       0 sda 1 2 3 4 5 6 7 8 9 10 11\n",
+		"net/dev": "Inter-|   Receive                                                |  Transmit\n" +
+			" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n" +
+			"    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0\n" +
+			"  eth0:    5000      50    1    2    0     0          0         0     7000      70    3    4    0     0       0          0\n" +
+			"eth0.100:    10      1    0    0    0     0          0         0       20       2    0    0    0     0       0          0\n",
+	})
+
+	t.Run("All", func(t *testing.T) {
+		doc, err := CollectDeviceStats(root, DeviceFilter{})
+		require.NoError(t, err)
+
+		disks := doc.Lookup("disk").MutableDocument()
+		assert.Equal(t, 3, disks.Len())
+		assert.Equal(t, []string{"loop0", "nvme0n1", "sda"}, []string{
+			disks.ElementAt(0).Key(), disks.ElementAt(1).Key(), disks.ElementAt(2).Key(),
+		})
+		nvme := disks.Lookup("nvme0n1").MutableDocument()
+		assert.EqualValues(t, 100, nvme.Lookup("reads").Int64())
+		assert.EqualValues(t, 800*512, nvme.Lookup("read_bytes").Int64())
+		assert.EqualValues(t, 1600*512, nvme.Lookup("write_bytes").Int64())
+		assert.EqualValues(t, 130, nvme.Lookup("weighted_io_time").Int64())
+
+		nics := doc.Lookup("net").MutableDocument()
+		assert.Equal(t, 3, nics.Len())
+		eth0 := nics.Lookup("eth0").MutableDocument()
+		assert.EqualValues(t, 5000, eth0.Lookup("rx_bytes").Int64())
+		assert.EqualValues(t, 2, eth0.Lookup("rx_dropped").Int64())
+		assert.EqualValues(t, 7000, eth0.Lookup("tx_bytes").Int64())
+		assert.EqualValues(t, 4, eth0.Lookup("tx_dropped").Int64())
+		assert.NotNil(t, nics.Lookup("eth0_100"))
+	})
+	t.Run("Filter", func(t *testing.T) {
+		doc, err := CollectDeviceStats(root, DeviceFilter{Include: []string{"nvme*", "eth*"}, Exclude: []string{"*.*"}})
+		require.NoError(t, err)
+
+		disks := doc.Lookup("disk").MutableDocument()
+		assert.Equal(t, 1, disks.Len())
+		assert.NotNil(t, disks.Lookup("nvme0n1"))
+
+		nics := doc.Lookup("net").MutableDocument()
+		assert.Equal(t, 1, nics.Len())
+		assert.NotNil(t, nics.Lookup("eth0"))
+	})
+	t.Run("InvalidFilter", func(t *testing.T) {
+		assert.Error(t, DeviceFilter{Include: []string{"["}}.Validate())
+		assert.NoError(t, DeviceFilter{Include: []string{"sd?"}}.Validate())
+	})
+	t.Run("MissingFiles", func(t *testing.T) {
+		doc, err := CollectDeviceStats(filepath.Join(dir, "none"), DeviceFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 0, doc.Lookup("disk").MutableDocument().Len())
+		assert.Equal(t, 0, doc.Lookup("net").MutableDocument().Len())
+	})
+	t.Run("Generate", func(t *testing.T) {
+		opts := CollectOptions{
+			SkipGolang:     true,
+			SkipSystem:     true,
+			SkipProcess:    true,
+			CollectDevices: true,
+			Devices:        DeviceFilter{Exclude: []string{"loop*", "lo"}},
+			ProcRoot:       root,
+		}
+		doc := opts.generate(context.Background(), 0)
+
+		chunk := ftdc.NewBaseCollector(10)
+		require.NoError(t, chunk.Add(doc))
+		data, err := chunk.Resolve()
+		require.NoError(t, err)
+
+		iter := ftdc.ReadChunks(context.Background(), bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		keys := map[string]bool{}
+		for _, m := range iter.Chunk().Metrics {
+			keys[m.Key()] = true
+		}
+		assert.True(t, keys["runtime.devices.disk.nvme0n1.reads"])
+		assert.True(t, keys["runtime.devices.net.eth0.tx_bytes"])
+		assert.False(t, keys["runtime.devices.disk.loop0.reads"])
+	})
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+)
+
+// GPUStats describes the state of a GPU device at the time it was
+// collected. Fields that the device does not support are zero.
+type GPUStats struct {
+	// Utilization and MemoryUtilization are the percentages of
+	// time, over the device's most recent sample period, during
+	// which kernels were executing on the device, and during
+	// which device memory was being read or written.
+	Utilization       int64
+	MemoryUtilization int64
+	MemoryUsed        int64
+	MemoryTotal       int64
+	// Temperature is the temperature of the GPU die in degrees
+	// Celsius, and Power is the power draw of the device, in
+	// milliwatts.
+	Temperature int64
+	Power       int64
+}
+
+func (s GPUStats) document() *bsonx.Document {
+	return bsonx.NewDocument(
+		bsonx.EC.Int64("utilization", s.Utilization),
+		bsonx.EC.Int64("memory_utilization", s.MemoryUtilization),
+		bsonx.EC.Int64("memory_used_bytes", s.MemoryUsed),
+		bsonx.EC.Int64("memory_total_bytes", s.MemoryTotal),
+		bsonx.EC.Int64("temperature", s.Temperature),
+		bsonx.EC.Int64("power", s.Power),
+	)
+}
+
+// CollectGPUStats reads the utilization, memory, temperature, and
+// power of each GPU device, using NVIDIA's management library (NVML),
+// and returns them as a document keyed by the index of each device,
+// e.g.:
+//
+//	{ 0: { utilization: ..., memory_used_bytes: ..., power: ... },
+//	  1: { ... } }
+//
+// NVML support requires cgo and the "nvml" build tag, and the NVML
+// library (libnvidia-ml.so), which is installed with the NVIDIA
+// driver, at runtime. Without the build tag, or if the library is not
+// available, CollectGPUStats returns an error.
+func CollectGPUStats() (*bsonx.Document, error) {
+	devices, err := readGPUStats()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return gpuDocument(devices), nil
+}
+
+func gpuDocument(devices []GPUStats) *bsonx.Document {
+	doc := bsonx.DC.Make(len(devices))
+	for idx, device := range devices {
+		doc.Append(bsonx.EC.SubDocument(strconv.Itoa(idx), device.document()))
+	}
+	return doc
+}
@@ -0,0 +1,10 @@
+//go:build !nvml
+// +build !nvml
+
+package metrics
+
+import "github.com/pkg/errors"
+
+func readGPUStats() ([]GPUStats, error) {
+	return nil, errors.New("GPU metrics require NVML support, which is enabled by the 'nvml' build tag")
+}
@@ -0,0 +1,90 @@
+//go:build nvml
+// +build nvml
+
+package metrics
+
+import (
+	"sync"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/pkg/errors"
+)
+
+var (
+	nvmlOnce sync.Once
+	nvmlErr  error
+)
+
+// nvmlError converts an NVML return code to an error.
+func nvmlError(ret nvml.Return) error {
+	if ret == nvml.SUCCESS {
+		return nil
+	}
+	return errors.New(nvml.ErrorString(ret))
+}
+
+// nvmlValue returns the value, or zero if the device does not support
+// the field, so that the schema of the document is stable across
+// devices. Other errors are returned.
+func nvmlValue(value int64, ret nvml.Return) (int64, error) {
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return 0, nil
+	}
+	return value, nvmlError(ret)
+}
+
+func readGPUStats() ([]GPUStats, error) {
+	// the library is initialized once, and remains loaded for
+	// the life of the process, as collectors read it for every
+	// sample.
+	nvmlOnce.Do(func() { nvmlErr = nvmlError(nvml.Init()) })
+	if nvmlErr != nil {
+		return nil, errors.Wrap(nvmlErr, "problem initializing NVML")
+	}
+
+	count, ret := nvml.DeviceGetCount()
+	if err := nvmlError(ret); err != nil {
+		return nil, errors.Wrap(err, "problem counting GPU devices")
+	}
+
+	out := make([]GPUStats, count)
+	for idx := range out {
+		if err := readGPUDevice(idx, &out[idx]); err != nil {
+			return nil, errors.Wrapf(err, "problem reading GPU device %d", idx)
+		}
+	}
+
+	return out, nil
+}
+
+func readGPUDevice(idx int, stats *GPUStats) error {
+	device, ret := nvml.DeviceGetHandleByIndex(idx)
+	if err := nvmlError(ret); err != nil {
+		return errors.WithStack(err)
+	}
+
+	var err error
+	utilization, ret := device.GetUtilizationRates()
+	if stats.Utilization, err = nvmlValue(int64(utilization.Gpu), ret); err != nil {
+		return errors.Wrap(err, "problem reading utilization")
+	}
+	stats.MemoryUtilization = int64(utilization.Memory)
+
+	memory, ret := device.GetMemoryInfo()
+	if stats.MemoryUsed, err = nvmlValue(int64(memory.Used), ret); err != nil {
+		return errors.Wrap(err, "problem reading memory")
+	}
+	stats.MemoryTotal = int64(memory.Total)
+
+	temperature, ret := device.GetTemperature(nvml.TEMPERATURE_GPU)
+	if stats.Temperature, err = nvmlValue(int64(temperature), ret); err != nil {
+		return errors.Wrap(err, "problem reading temperature")
+	}
+
+	power, ret := device.GetPowerUsage()
+	if stats.Power, err = nvmlValue(int64(power), ret); err != nil {
+		return errors.Wrap(err, "problem reading power")
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGPUStats(t *testing.T) {
+	devices := []GPUStats{
+		{Utilization: 95, MemoryUtilization: 40, MemoryUsed: 30 << 30, MemoryTotal: 80 << 30, Temperature: 71, Power: 350000},
+		{MemoryTotal: 80 << 30, Temperature: 35},
+	}
+
+	t.Run("Document", func(t *testing.T) {
+		doc := gpuDocument(devices)
+		require.Equal(t, 2, doc.Len())
+		assert.Equal(t, "0", doc.ElementAt(0).Key())
+		assert.Equal(t, "1", doc.ElementAt(1).Key())
+
+		first := doc.Lookup("0").MutableDocument()
+		assert.EqualValues(t, 95, first.Lookup("utilization").Int64())
+		assert.EqualValues(t, 40, first.Lookup("memory_utilization").Int64())
+		assert.EqualValues(t, 30<<30, first.Lookup("memory_used_bytes").Int64())
+		assert.EqualValues(t, 80<<30, first.Lookup("memory_total_bytes").Int64())
+		assert.EqualValues(t, 71, first.Lookup("temperature").Int64())
+		assert.EqualValues(t, 350000, first.Lookup("power").Int64())
+
+		// idle devices have the same schema.
+		second := doc.Lookup("1").MutableDocument()
+		assert.Equal(t, first.Len(), second.Len())
+		assert.EqualValues(t, 0, second.Lookup("utilization").Int64())
+
+		assert.Equal(t, 0, gpuDocument(nil).Len())
+	})
+	t.Run("Keys", func(t *testing.T) {
+		collector := ftdc.NewBaseCollector(10)
+		require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.SubDocument("gpu", gpuDocument(devices)))))
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		iter := ftdc.ReadChunks(context.Background(), bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		keys := map[string]bool{}
+		for _, m := range iter.Chunk().Metrics {
+			keys[m.Key()] = true
+		}
+		assert.Len(t, keys, 12)
+		assert.True(t, keys["gpu.0.utilization"])
+		assert.True(t, keys["gpu.1.power"])
+	})
+	t.Run("Validate", func(t *testing.T) {
+		opts := NewCollectOptions("prefix")
+		opts.SkipGolang, opts.SkipSystem, opts.SkipProcess = true, true, true
+		err := opts.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "gpu")
+		opts.CollectGPU = true
+		assert.NoError(t, opts.Validate())
+	})
+	t.Run("Generate", func(t *testing.T) {
+		// without NVML, or without devices, the GPU metrics
+		// are omitted.
+		opts := CollectOptions{
+			SkipGolang:  true,
+			SkipSystem:  true,
+			SkipProcess: true,
+			CollectGPU:  true,
+		}
+		doc := opts.generate(context.Background(), 0)
+		runtime := doc.Lookup("runtime").MutableDocument()
+
+		if _, err := CollectGPUStats(); err != nil {
+			assert.Nil(t, runtime.Lookup("gpu"))
+		} else {
+			assert.NotNil(t, runtime.Lookup("gpu"))
+		}
+	})
+}
@@ -25,16 +25,56 @@ type Runtime struct {
 	ID        int                    `json:"id" bson:"id"`
 	Timestamp time.Time              `json:"ts" bson:"ts"`
 	PID       int                    `json:"pid" bson:"pid"`
-	Golang    *message.GoRuntimeInfo `json:"golang,omitempty" bson:"golang,omitempty"`
-	System    *message.SystemInfo    `json:"system,omitempty" bson:"system,omitempty"`
-	Process   *message.ProcessInfo   `json:"process,omitempty" bson:"process,omitempty"`
+	Golang    *message.GoRuntimeInfo `json:"golang,omitempty" bson:"golang"`
+	System    *message.SystemInfo    `json:"system,omitempty" bson:"system"`
+	Process   *message.ProcessInfo   `json:"process,omitempty" bson:"process"`
+	Cgroup    *CgroupInfo            `json:"cgroup,omitempty" bson:"cgroup,omitempty"`
+	Metrics   *bsonx.Document        `json:"-" bson:"metrics,omitempty"`
+	Devices   *bsonx.Document        `json:"-" bson:"devices,omitempty"`
+	Tree      *bsonx.Document        `json:"-" bson:"tree,omitempty"`
+	GPU       *bsonx.Document        `json:"-" bson:"gpu,omitempty"`
 }
 
-func (r *Runtime) MarshalBSON() ([]byte, error) { return bson.Marshal(r) }
-func (r *Runtime) UnmarshalBSON(b []byte) error { return bson.Unmarshal(b, r) }
+// runtimeFields has the fields of Runtime without its methods, so
+// that the bson package marshals the fields rather than calling the
+// methods of Runtime again.
+//
+// The golang, system, and process sections are not omitempty, as
+// their collectors embed message.Base, whose IsZero method reports
+// the sections as empty once generate clears their metadata. Skipped
+// sections are nil, and written as null, which holds no metrics.
+type runtimeFields Runtime
+
+func (r *Runtime) MarshalBSON() ([]byte, error) { return bson.Marshal((*runtimeFields)(r)) }
+func (r *Runtime) UnmarshalBSON(b []byte) error { return bson.Unmarshal(b, (*runtimeFields)(r)) }
 
 // CollectOptions are the settings to provide the behavior of
 // the collection process process.
+//
+// The system metrics describe the host, so processes that run in
+// containers should also set CollectCgroup, to collect the limits and
+// usage of the container's cgroup (see CollectCgroupInfo) from
+// CgroupRoot, which defaults to DefaultCgroupRoot.
+//
+// CollectRuntimeMetrics adds the metrics of the runtime/metrics
+// package (see CollectGoRuntimeMetrics), such as the distributions of
+// scheduler latencies and GC pauses, to the fixed set of Go runtime
+// statistics.
+//
+// CollectDevices adds the counters of each block device and network
+// interface that the Devices filter selects (see CollectDeviceStats),
+// read from ProcRoot, which defaults to DefaultProcRoot, as the system
+// metrics only report the totals of all devices.
+//
+// CollectProcessTree adds the CPU, memory, and file descriptor usage
+// of the process with ProcessTreePID, which defaults to the current
+// process, and of each of its descendants (see CollectProcessTree),
+// also read from ProcRoot, as the process metrics only describe a
+// single process. The tree is read again for each sample.
+//
+// CollectGPU adds the utilization, memory, temperature, and power of
+// each GPU device (see CollectGPUStats), which requires NVML support,
+// enabled by the "nvml" build tag.
 type CollectOptions struct {
 	OutputFilePrefix      string
 	SampleCount           int
@@ -43,6 +83,15 @@ type CollectOptions struct {
 	SkipGolang            bool
 	SkipSystem            bool
 	SkipProcess           bool
+	CollectCgroup         bool
+	CgroupRoot            string
+	CollectRuntimeMetrics bool
+	CollectDevices        bool
+	Devices               DeviceFilter
+	ProcRoot              string
+	CollectProcessTree    bool
+	ProcessTreePID        int
+	CollectGPU            bool
 	Collectors            Collectors
 	RunParallelCollectors bool
 }
@@ -83,6 +132,39 @@ func (opts *CollectOptions) generate(ctx context.Context, id int) *bsonx.Documen
 		out.Process.Base = base
 	}
 
+	if opts.CollectCgroup {
+		var err error
+		out.Cgroup, err = CollectCgroupInfo(opts.CgroupRoot)
+		grip.Debug(message.WrapError(err, "problem collecting cgroup metrics"))
+	}
+
+	if opts.CollectRuntimeMetrics {
+		out.Metrics = CollectGoRuntimeMetrics()
+	}
+
+	if opts.CollectDevices {
+		var err error
+		out.Devices, err = CollectDeviceStats(opts.ProcRoot, opts.Devices)
+		grip.Debug(message.WrapError(err, "problem collecting device metrics"))
+	}
+
+	if opts.CollectProcessTree {
+		root := opts.ProcessTreePID
+		if root == 0 {
+			root = pid
+		}
+
+		var err error
+		out.Tree, err = CollectProcessTree(opts.ProcRoot, root)
+		grip.Debug(message.WrapError(err, "problem collecting process tree metrics"))
+	}
+
+	if opts.CollectGPU {
+		var err error
+		out.GPU, err = CollectGPUStats()
+		grip.Debug(message.WrapError(err, "problem collecting GPU metrics"))
+	}
+
 	if len(opts.Collectors) == 0 {
 		return bsonx.DC.Make(1).Append(bsonx.EC.Marshaler("runtime", out))
 	}
@@ -155,8 +237,10 @@ func (opts CollectOptions) Validate() error {
 	catcher.NewWhen(opts.CollectionInterval > opts.FlushInterval,
 		"collection interval must be smaller than flush interval")
 	catcher.NewWhen(opts.SampleCount < 10, "sample count must be at least 10")
-	catcher.NewWhen(opts.SkipGolang && opts.SkipProcess && opts.SkipSystem,
-		"cannot skip all metrics collection, must specify golang, process, or system")
+	catcher.NewWhen(opts.SkipGolang && opts.SkipProcess && opts.SkipSystem && !opts.CollectCgroup && !opts.CollectRuntimeMetrics && !opts.CollectDevices && !opts.CollectProcessTree && !opts.CollectGPU,
+		"cannot skip all metrics collection, must specify golang, process, system, cgroup, runtime, device, process tree, or gpu metrics")
+	catcher.NewWhen(opts.ProcessTreePID < 0, "process tree pid must not be negative")
+	catcher.Add(opts.Devices.Validate())
 	catcher.NewWhen(opts.RunParallelCollectors && len(opts.Collectors) == 0,
 		"cannot run parallel collectors with no collectors specified")
 
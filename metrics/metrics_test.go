@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"runtime"
 	"testing"
 	"time"
@@ -66,7 +67,20 @@ func TestCollectRuntime(t *testing.T) {
 					counter++
 					doc := iter.Document()
 					assert.NotNil(t, doc)
-					assert.Equal(t, doc.Len(), 15)
+					require.True(t, doc.Len() > 3)
+					assert.Equal(t, "runtime.id", doc.ElementAt(0).Key())
+					assert.Equal(t, "runtime.ts", doc.ElementAt(1).Key())
+					assert.Equal(t, "runtime.pid", doc.ElementAt(2).Key())
+
+					sections := map[string]bool{}
+					for i := uint(0); i < uint(doc.Len()); i++ {
+						if parts := strings.SplitN(doc.ElementAt(i).Key(), ".", 3); len(parts) == 3 {
+							sections[parts[1]] = true
+						}
+					}
+					assert.True(t, sections["golang"], "golang metrics")
+					assert.True(t, sections["system"], "system metrics")
+					assert.True(t, sections["process"], "process metrics")
 				}
 				assert.NoError(t, iter.Err())
 				total += counter
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+)
+
+// clockTicksPerSecond is the unit of the CPU times in /proc/[pid]/stat,
+// which is USER_HZ, and is 100 on all common platforms.
+const clockTicksPerSecond = 100
+
+// processStat holds the fields of /proc/[pid]/stat that are collected.
+type processStat struct {
+	pid       int
+	ppid      int
+	userTime  int64
+	sysTime   int64
+	threads   int64
+	vsize     int64
+	rssPages  int64
+	openFiles int64
+}
+
+// CollectProcessTree reads the resource usage of the process with the
+// pid, and of all of its descendants, from the proc file system
+// mounted at the root directory (DefaultProcRoot if empty), and returns
+// it as a document with one sub-document for each process, keyed by
+// pid, e.g.:
+//
+//	{ count: 2,
+//	  processes: { 1234: { ppid: 1, cpu_user: ..., rss: ..., fds: ... },
+//	               1240: { ppid: 1234, ... } } }
+//
+// The tree is read again with each call, so processes appear and
+// disappear as they start and exit, which changes the schema of the
+// document. Processes are sorted by pid. CPU times are in milliseconds
+// and memory sizes are in bytes. The count of open file descriptors is
+// -1 if it cannot be read, as for processes of other users.
+func CollectProcessTree(root string, pid int) (*bsonx.Document, error) {
+	if root == "" {
+		root = DefaultProcRoot
+	}
+
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading '%s'", root)
+	}
+
+	stats := map[int]*processStat{}
+	children := map[int][]int{}
+	for _, entry := range entries {
+		id, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		// processes may exit while the tree is read.
+		stat, err := readProcessStat(filepath.Join(root, entry.Name(), "stat"))
+		if err != nil || stat == nil {
+			continue
+		}
+		stat.pid = id
+		stats[id] = stat
+		children[stat.ppid] = append(children[stat.ppid], id)
+	}
+
+	if _, ok := stats[pid]; !ok {
+		return nil, errors.Errorf("process %d does not exist", pid)
+	}
+
+	tree := []int{}
+	queue := []int{pid}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		tree = append(tree, id)
+		queue = append(queue, children[id]...)
+	}
+	sort.Ints(tree)
+
+	processes := bsonx.DC.Make(len(tree))
+	for _, id := range tree {
+		stat := stats[id]
+		stat.openFiles = countOpenFiles(filepath.Join(root, strconv.Itoa(id), "fd"))
+		processes.Append(bsonx.EC.SubDocument(strconv.Itoa(id), stat.document()))
+	}
+
+	return bsonx.NewDocument(
+		bsonx.EC.Int64("count", int64(len(tree))),
+		bsonx.EC.SubDocument("processes", processes),
+	), nil
+}
+
+func (s *processStat) document() *bsonx.Document {
+	return bsonx.NewDocument(
+		bsonx.EC.Int64("ppid", int64(s.ppid)),
+		bsonx.EC.Int64("cpu_user", s.userTime*1000/clockTicksPerSecond),
+		bsonx.EC.Int64("cpu_system", s.sysTime*1000/clockTicksPerSecond),
+		bsonx.EC.Int64("threads", s.threads),
+		bsonx.EC.Int64("vsize", s.vsize),
+		bsonx.EC.Int64("rss", s.rssPages*int64(os.Getpagesize())),
+		bsonx.EC.Int64("fds", s.openFiles),
+	)
+}
+
+// readProcessStat parses /proc/[pid]/stat, returning nil if the file
+// does not exist.
+func readProcessStat(fn string) (*processStat, error) {
+	data, err := readCgroupFile(fn)
+	if err != nil || data == nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// the command name is in parentheses, and may itself contain
+	// spaces and parentheses, so the fields follow the last one.
+	line := string(data)
+	end := strings.LastIndexByte(line, ')')
+	if end < 0 {
+		return nil, errors.Errorf("malformed '%s'", fn)
+	}
+	fields := strings.Fields(line[end+1:])
+	if len(fields) < 22 {
+		return nil, errors.Errorf("'%s' has %d fields after the command", fn, len(fields))
+	}
+
+	// fields are numbered from the state, which is the third field
+	// of the file.
+	values := [5]int64{}
+	for idx, pos := range []int{11, 12, 17, 20, 21} {
+		values[idx], err = strconv.ParseInt(fields[pos], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem parsing field %d of '%s'", pos+3, fn)
+		}
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem parsing parent pid of '%s'", fn)
+	}
+
+	return &processStat{
+		ppid:     ppid,
+		userTime: values[0],
+		sysTime:  values[1],
+		threads:  values[2],
+		vsize:    values[3],
+		rssPages: values[4],
+	}, nil
+}
+
+func countOpenFiles(dir string) int64 {
+	f, err := os.Open(dir)
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return -1
+	}
+	return int64(len(names))
+}
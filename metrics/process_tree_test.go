@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/ftdc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func processStatLine(pid, ppid int, comm string, utime, threads, rss int) string {
+	return fmt.Sprintf("%d (%s) S %d %d %d 0 -1 4194560 100 0 0 0 %d 25 0 0 20 0 %d 0 1000 4096000 %d 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0\n",
+		pid, comm, ppid, pid, pid, utime, threads, rss)
+}
+
+func TestCollectProcessTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftdc-proc-")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	root := filepath.Join(dir, "proc")
+	writeCgroupFiles(t, root, map[string]string{
+		"1/stat":      processStatLine(1, 0, "init", 10, 1, 100),
+		"100/stat":    processStatLine(100, 1, "agent", 250, 8, 2000),
+		"100/fd/0":    "",
+		"100/fd/1":    "",
+		"100/fd/2":    "",
+		"105/stat":    processStatLine(105, 100, "worker (1)", 50, 2, 500),
+		"105/fd/0":    "",
+		"120/stat":    processStatLine(120, 105, "sh", 1, 1, 10),
+		"99/stat":     processStatLine(99, 1, "other", 5, 1, 10),
+		"self/stat":   processStatLine(100, 1, "agent", 250, 8, 2000),
+		"diskstats":   "",
+		"130/garbage": "",
+	})
+
+	t.Run("Tree", func(t *testing.T) {
+		doc, err := CollectProcessTree(root, 100)
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, doc.Lookup("count").Int64())
+
+		processes := doc.Lookup("processes").MutableDocument()
+		require.Equal(t, 3, processes.Len())
+		assert.Equal(t, []string{"100", "105", "120"}, []string{
+			processes.ElementAt(0).Key(), processes.ElementAt(1).Key(), processes.ElementAt(2).Key(),
+		})
+
+		agent := processes.Lookup("100").MutableDocument()
+		assert.EqualValues(t, 1, agent.Lookup("ppid").Int64())
+		assert.EqualValues(t, 2500, agent.Lookup("cpu_user").Int64())
+		assert.EqualValues(t, 250, agent.Lookup("cpu_system").Int64())
+		assert.EqualValues(t, 8, agent.Lookup("threads").Int64())
+		assert.EqualValues(t, 4096000, agent.Lookup("vsize").Int64())
+		assert.EqualValues(t, 2000*os.Getpagesize(), agent.Lookup("rss").Int64())
+		assert.EqualValues(t, 3, agent.Lookup("fds").Int64())
+
+		worker := processes.Lookup("105").MutableDocument()
+		assert.EqualValues(t, 100, worker.Lookup("ppid").Int64(), "commands with parentheses are parsed")
+		assert.EqualValues(t, 1, worker.Lookup("fds").Int64())
+		assert.EqualValues(t, -1, processes.Lookup("120").MutableDocument().Lookup("fds").Int64())
+	})
+	t.Run("Leaf", func(t *testing.T) {
+		doc, err := CollectProcessTree(root, 120)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, doc.Lookup("count").Int64())
+	})
+	t.Run("MissingProcess", func(t *testing.T) {
+		_, err := CollectProcessTree(root, 4242)
+		assert.Error(t, err)
+		_, err = CollectProcessTree(filepath.Join(dir, "none"), 1)
+		assert.Error(t, err)
+	})
+	t.Run("MalformedStat", func(t *testing.T) {
+		writeCgroupFiles(t, filepath.Join(dir, "malformed"), map[string]string{
+			"short":  "1 (init) S 0 1",
+			"nocomm": "1 init S 0 1",
+			"ppid":   strings.Replace(processStatLine(1, 0, "init", 1, 1, 1), "S 0", "S x", 1),
+		})
+		for _, fn := range []string{"short", "nocomm", "ppid"} {
+			_, err := readProcessStat(filepath.Join(dir, "malformed", fn))
+			assert.Error(t, err, fn)
+		}
+
+		stat, err := readProcessStat(filepath.Join(root, "4242", "stat"))
+		assert.NoError(t, err)
+		assert.Nil(t, stat)
+	})
+	t.Run("Generate", func(t *testing.T) {
+		opts := CollectOptions{
+			SkipGolang:         true,
+			SkipSystem:         true,
+			SkipProcess:        true,
+			CollectProcessTree: true,
+			ProcessTreePID:     100,
+			ProcRoot:           root,
+		}
+		doc := opts.generate(context.Background(), 0)
+
+		chunk := ftdc.NewBaseCollector(10)
+		require.NoError(t, chunk.Add(doc))
+		data, err := chunk.Resolve()
+		require.NoError(t, err)
+
+		iter := ftdc.ReadChunks(context.Background(), bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		keys := map[string]bool{}
+		for _, m := range iter.Chunk().Metrics {
+			keys[m.Key()] = true
+		}
+		assert.True(t, keys["runtime.tree.count"])
+		assert.True(t, keys["runtime.tree.processes.105.rss"])
+		assert.False(t, keys["runtime.tree.processes.99.rss"])
+	})
+	t.Run("Validate", func(t *testing.T) {
+		opts := NewCollectOptions("prefix")
+		opts.SkipGolang, opts.SkipSystem, opts.SkipProcess = true, true, true
+		assert.Error(t, opts.Validate())
+		opts.CollectProcessTree = true
+		assert.NoError(t, opts.Validate())
+		opts.ProcessTreePID = -1
+		assert.Error(t, opts.Validate())
+	})
+	t.Run("Self", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("process trees are only collected from the proc file system")
+		}
+
+		cmd := exec.Command("sleep", "10")
+		require.NoError(t, cmd.Start())
+		defer func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		}()
+
+		doc, err := CollectProcessTree("", os.Getpid())
+		require.NoError(t, err)
+
+		processes := doc.Lookup("processes").MutableDocument()
+		self := processes.Lookup(strconv.Itoa(os.Getpid())).MutableDocument()
+		assert.True(t, self.Lookup("rss").Int64() > 0)
+		assert.True(t, self.Lookup("fds").Int64() > 0)
+
+		child := processes.Lookup(strconv.Itoa(cmd.Process.Pid))
+		require.NotNil(t, child)
+		assert.EqualValues(t, os.Getpid(), child.MutableDocument().Lookup("ppid").Int64())
+	})
+}
@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"math"
+	"runtime/metrics"
+	"strings"
+
+	"github.com/mongodb/ftdc/bsonx"
+)
+
+// runtimeMetricQuantiles are the quantiles that summarize histogram
+// metrics, in addition to their bucket counts.
+var runtimeMetricQuantiles = []struct {
+	key      string
+	quantile float64
+}{
+	{key: "p50", quantile: 0.5},
+	{key: "p90", quantile: 0.9},
+	{key: "p99", quantile: 0.99},
+}
+
+// CollectGoRuntimeMetrics reads every metric that the runtime/metrics
+// package supports (e.g. scheduler latencies, GC pauses, and the
+// number of goroutines), and returns them as a document, which
+// nests the metrics by the components of their names, so that the
+// metric "/sched/goroutines:goroutines" has the FTDC key
+// "sched.goroutines:goroutines".
+//
+// Histograms are documents that hold the total count of samples, the
+// estimated quantiles ("p50", "p90", "p99", and "max", in the unit of
+// the metric), and the count of each bucket, in the "counts" array.
+// The buckets of a histogram do not change while a program runs, so
+// the keys of the buckets are stable, but their bounds depend on the
+// version of Go.
+func CollectGoRuntimeMetrics() *bsonx.Document {
+	descs := metrics.All()
+	samples := make([]metrics.Sample, len(descs))
+	for idx := range descs {
+		samples[idx].Name = descs[idx].Name
+	}
+	metrics.Read(samples)
+
+	root := newRuntimeMetricNode()
+	for _, sample := range samples {
+		value := runtimeMetricValue(sample.Value)
+		if value == nil {
+			continue
+		}
+
+		name, unit := sample.Name, ""
+		if idx := strings.LastIndexByte(name, ':'); idx >= 0 {
+			name, unit = name[:idx], name[idx:]
+		}
+
+		path := strings.Split(strings.Trim(name, "/"), "/")
+		for idx := range path {
+			path[idx] = strings.Replace(path[idx], ".", "_", -1)
+		}
+		path[len(path)-1] += unit
+
+		root.insert(path, value)
+	}
+
+	return root.document()
+}
+
+func runtimeMetricValue(value metrics.Value) *bsonx.Value {
+	switch value.Kind() {
+	case metrics.KindUint64:
+		v := value.Uint64()
+		if v > math.MaxInt64 {
+			v = math.MaxInt64
+		}
+		return bsonx.VC.Int64(int64(v))
+	case metrics.KindFloat64:
+		return bsonx.VC.Double(value.Float64())
+	case metrics.KindFloat64Histogram:
+		return bsonx.VC.Document(runtimeHistogramDocument(value.Float64Histogram()))
+	default:
+		return nil
+	}
+}
+
+func runtimeHistogramDocument(hist *metrics.Float64Histogram) *bsonx.Document {
+	var total uint64
+	counts := bsonx.MakeArray(len(hist.Counts))
+	for _, count := range hist.Counts {
+		total += count
+		counts.Append(bsonx.VC.Int64(int64(count)))
+	}
+
+	doc := bsonx.DC.Make(len(runtimeMetricQuantiles) + 3)
+	doc.Append(bsonx.EC.Int64("count", int64(total)))
+	for _, q := range runtimeMetricQuantiles {
+		doc.Append(bsonx.EC.Double(q.key, runtimeHistogramQuantile(hist, total, q.quantile)))
+	}
+	doc.Append(bsonx.EC.Double("max", runtimeHistogramQuantile(hist, total, 1)))
+	doc.Append(bsonx.EC.Array("counts", counts))
+
+	return doc
+}
+
+// runtimeHistogramQuantile returns the upper bound of the bucket that
+// holds the quantile, or the lower bound, if the upper bound is
+// infinite. Empty histograms have quantiles of zero.
+func runtimeHistogramQuantile(hist *metrics.Float64Histogram, total uint64, quantile float64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	target := uint64(math.Ceil(quantile * float64(total)))
+	if target == 0 {
+		target = 1
+	}
+
+	var seen uint64
+	for idx, count := range hist.Counts {
+		seen += count
+		if seen < target {
+			continue
+		}
+
+		// bucket idx spans [Buckets[idx], Buckets[idx+1]).
+		if upper := hist.Buckets[idx+1]; !math.IsInf(upper, 0) {
+			return upper
+		}
+		if lower := hist.Buckets[idx]; !math.IsInf(lower, 0) {
+			return lower
+		}
+		return 0
+	}
+
+	return 0
+}
+
+// runtimeMetricNode is a node of the tree of metric names, which
+// preserves the order in which names are inserted.
+type runtimeMetricNode struct {
+	keys     []string
+	children map[string]*runtimeMetricNode
+	values   map[string]*bsonx.Value
+}
+
+func newRuntimeMetricNode() *runtimeMetricNode {
+	return &runtimeMetricNode{
+		children: map[string]*runtimeMetricNode{},
+		values:   map[string]*bsonx.Value{},
+	}
+}
+
+func (n *runtimeMetricNode) insert(path []string, value *bsonx.Value) {
+	key := path[0]
+	if len(path) == 1 {
+		if _, ok := n.values[key]; !ok && n.children[key] == nil {
+			n.keys = append(n.keys, key)
+		}
+		n.values[key] = value
+		return
+	}
+
+	child, ok := n.children[key]
+	if !ok {
+		if _, exists := n.values[key]; !exists {
+			n.keys = append(n.keys, key)
+		}
+		child = newRuntimeMetricNode()
+		n.children[key] = child
+	}
+	child.insert(path[1:], value)
+}
+
+func (n *runtimeMetricNode) document() *bsonx.Document {
+	doc := bsonx.DC.Make(len(n.keys))
+	for _, key := range n.keys {
+		if value, ok := n.values[key]; ok {
+			doc.Append(bsonx.EC.FromValue(key, value))
+		}
+		if child, ok := n.children[key]; ok {
+			// a name that is also the prefix of other names
+			// holds the other metrics in a sub-document with
+			// a suffix, so that keys are unique.
+			childKey := key
+			if _, ok := n.values[key]; ok {
+				childKey += "_"
+			}
+			doc.Append(bsonx.EC.SubDocument(childKey, child.document()))
+		}
+	}
+
+	return doc
+}
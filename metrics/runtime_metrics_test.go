@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runtimeMetricKeys(prefix string, doc *bsonx.Document) []string {
+	keys := []string{}
+	iter := doc.Iterator()
+	for iter.Next() {
+		elem := iter.Element()
+		key := prefix + elem.Key()
+		if elem.Value().Type() == bsontype.EmbeddedDocument {
+			keys = append(keys, runtimeMetricKeys(key+".", elem.Value().MutableDocument())...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestCollectGoRuntimeMetrics(t *testing.T) {
+	doc := CollectGoRuntimeMetrics()
+	require.NotZero(t, doc.Len())
+
+	t.Run("Values", func(t *testing.T) {
+		sched := doc.Lookup("sched").MutableDocument()
+		goroutines, ok := sched.Lookup("goroutines:goroutines").Int64OK()
+		require.True(t, ok)
+		assert.True(t, goroutines > 0)
+
+		latencies := sched.Lookup("latencies:seconds").MutableDocument()
+		assert.Equal(t, []string{"count", "p50", "p90", "p99", "max", "counts"}, runtimeMetricKeys("", latencies))
+		assert.NotZero(t, latencies.Lookup("counts").MutableArray().Len())
+	})
+	t.Run("StableKeys", func(t *testing.T) {
+		// the values change between collections, but the keys
+		// must not.
+		runtime.GC()
+		assert.Equal(t, runtimeMetricKeys("", doc), runtimeMetricKeys("", CollectGoRuntimeMetrics()))
+	})
+	t.Run("Generate", func(t *testing.T) {
+		opts := CollectOptions{
+			SkipGolang:            true,
+			SkipSystem:            true,
+			SkipProcess:           true,
+			CollectRuntimeMetrics: true,
+		}
+
+		out := opts.generate(context.Background(), 0)
+		gc := out.Lookup("runtime").MutableDocument().Lookup("metrics").MutableDocument().Lookup("gc")
+		require.NotNil(t, gc)
+		assert.NotNil(t, gc.MutableDocument().LookupElement("pauses:seconds"))
+	})
+}
+
+func TestRuntimeHistogramDocument(t *testing.T) {
+	hist := &metrics.Float64Histogram{
+		Counts:  []uint64{0, 5, 4, 1},
+		Buckets: []float64{math.Inf(-1), 1, 2, 4, math.Inf(1)},
+	}
+
+	doc := runtimeHistogramDocument(hist)
+	assert.EqualValues(t, 10, doc.Lookup("count").Int64())
+	assert.Equal(t, 2.0, doc.Lookup("p50").Double())
+	assert.Equal(t, 4.0, doc.Lookup("p90").Double())
+	assert.Equal(t, 4.0, doc.Lookup("p99").Double(), "infinite upper bounds use the lower bound")
+	assert.Equal(t, 4.0, doc.Lookup("max").Double())
+	assert.Equal(t, 4, doc.Lookup("counts").MutableArray().Len())
+
+	empty := runtimeHistogramDocument(&metrics.Float64Histogram{
+		Counts:  []uint64{0, 0},
+		Buckets: []float64{0, 1, 2},
+	})
+	assert.Zero(t, empty.Lookup("count").Int64())
+	assert.Zero(t, empty.Lookup("max").Double())
+}
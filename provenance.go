@@ -0,0 +1,253 @@
+package ftdc
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// Provenance
+//
+// Tools that rewrite FTDC data (e.g. to scrub, downsample, or
+// recompress it) record what they did in the metadata of the chunks
+// they write, as an entry in the "provenance" array of the metadata
+// document. Each rewrite appends an entry to the chain inherited from
+// the source chunk, so chunks with no provenance entries hold original
+// data.
+const provenanceField = "provenance"
+
+// Provenance describes a single rewrite of FTDC data.
+type Provenance struct {
+	// Tool is the name of the program or operation that rewrote
+	// the data, and Parameters holds its settings.
+	Tool       string
+	Parameters map[string]string
+	// Timestamp is the time of the rewrite.
+	Timestamp time.Time
+	// SourceHash identifies the chunk that the data was rewritten
+	// from (see Chunk.SourceHash.)
+	SourceHash string
+}
+
+func (p Provenance) document() *bsonx.Document {
+	keys := make([]string, 0, len(p.Parameters))
+	for key := range p.Parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	params := bsonx.DC.Make(len(keys))
+	for _, key := range keys {
+		params.Append(bsonx.EC.String(key, p.Parameters[key]))
+	}
+
+	return bsonx.NewDocument(
+		bsonx.EC.String("tool", p.Tool),
+		bsonx.EC.SubDocument("parameters", params),
+		bsonx.EC.Time("ts", p.Timestamp),
+		bsonx.EC.String("source", p.SourceHash),
+	)
+}
+
+func readProvenance(doc *bsonx.Document) (Provenance, error) {
+	out := Provenance{}
+
+	var ok bool
+	if out.Tool, ok = doc.Lookup("tool").StringValueOK(); !ok {
+		return out, errors.New("provenance entry has no tool")
+	}
+	if out.Timestamp, ok = doc.Lookup("ts").TimeOK(); !ok {
+		return out, errors.New("provenance entry has no timestamp")
+	}
+	out.SourceHash, _ = doc.Lookup("source").StringValueOK()
+
+	if params, ok := doc.Lookup("parameters").MutableDocumentOK(); ok {
+		out.Parameters = make(map[string]string, params.Len())
+		iter := params.Iterator()
+		for iter.Next() {
+			elem := iter.Element()
+			value, ok := elem.Value().StringValueOK()
+			if !ok {
+				return out, errors.Errorf("provenance parameter '%s' is not a string", elem.Key())
+			}
+			out.Parameters[elem.Key()] = value
+		}
+	}
+
+	return out, nil
+}
+
+// AppendProvenance returns a copy of the metadata document, which may
+// be nil, with the entry added to the end of its provenance chain.
+// Use the result as the metadata of a collector that writes rewritten
+// data.
+func AppendProvenance(metadata *bsonx.Document, entry Provenance) (*bsonx.Document, error) {
+	out := bsonx.NewDocument()
+	if metadata != nil {
+		out = metadata.Copy()
+	}
+
+	chain := bsonx.NewArray()
+	if elem := out.LookupElement(provenanceField); elem != nil {
+		existing, ok := elem.Value().MutableArrayOK()
+		if !ok {
+			return nil, errors.New("provenance field is not an array")
+		}
+		iter := existing.Iterator()
+		for iter.Next() {
+			chain.Append(iter.Value())
+		}
+	}
+	chain.Append(bsonx.VC.Document(entry.document()))
+
+	out.Set(bsonx.EC.Array(provenanceField, chain))
+	return out, nil
+}
+
+// userMetadata returns the user-supplied metadata document held in
+// the metadata document of the chunk, if any.
+func (c *Chunk) userMetadata() *bsonx.Document {
+	if c.metadata == nil {
+		return nil
+	}
+
+	doc, ok := c.metadata.Lookup("doc").MutableDocumentOK()
+	if !ok {
+		return nil
+	}
+	return doc
+}
+
+// Provenance returns the chain of rewrites that produced the data in
+// the chunk, oldest first. The chain is empty for original data.
+func (c *Chunk) Provenance() ([]Provenance, error) {
+	metadata := c.userMetadata()
+	if metadata == nil {
+		return nil, nil
+	}
+
+	elem := metadata.LookupElement(provenanceField)
+	if elem == nil {
+		return nil, nil
+	}
+
+	chain, ok := elem.Value().MutableArrayOK()
+	if !ok {
+		return nil, errors.New("provenance field is not an array")
+	}
+
+	out := make([]Provenance, 0, chain.Len())
+	iter := chain.Iterator()
+	for iter.Next() {
+		value := iter.Value()
+		if value.Type() != bsontype.EmbeddedDocument {
+			return nil, errors.Errorf("provenance entry %d is not a document", len(out))
+		}
+
+		entry, err := readProvenance(value.MutableDocument())
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem reading provenance entry %d", len(out))
+		}
+		out = append(out, entry)
+	}
+
+	return out, nil
+}
+
+// SourceHash returns a hash of the encoded contents of a chunk that
+// was read from an FTDC data source, or an empty string for chunks
+// that were not.
+func (c *Chunk) SourceHash() string {
+	if c.payload == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(c.payload))
+}
+
+// RewriteOptions describe a rewrite of FTDC data with RewriteChunks.
+type RewriteOptions struct {
+	// Tool and Parameters are recorded in the provenance entry
+	// of every rewritten chunk.
+	Tool       string
+	Parameters map[string]string
+	// Transform is called with each sample in the source
+	// data, as returned by the StructuredIterator of each chunk,
+	// and returns the sample to write, or nil to drop the sample.
+	// If nil, samples are written unchanged, which is useful to
+	// recompress data.
+	Transform func(*bsonx.Document) (*bsonx.Document, error)
+}
+
+// RewriteChunks reads every chunk from the iterator, passes its
+// samples through the transform, and writes the results to the
+// output, with the provenance chain of the source chunk extended
+// with an entry for this rewrite. Each source chunk produces at
+// least one output chunk, so that every output chunk has a single
+// source.
+func RewriteChunks(ctx context.Context, iter *ChunkIterator, output io.Writer, opts RewriteOptions) error {
+	if opts.Tool == "" {
+		return errors.New("must specify the tool that rewrites the data")
+	}
+
+	now := time.Now()
+	for iter.Next() {
+		chunk := iter.Chunk()
+
+		metadata, err := AppendProvenance(chunk.userMetadata(), Provenance{
+			Tool:       opts.Tool,
+			Parameters: opts.Parameters,
+			Timestamp:  now,
+			SourceHash: chunk.SourceHash(),
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		collector := NewDynamicCollector(chunk.Size())
+		if err = collector.SetMetadata(metadata); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err = rewriteChunk(ctx, chunk, collector, opts.Transform); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err = FlushCollector(collector, output); err != nil {
+			return errors.Wrap(err, "problem writing rewritten chunk")
+		}
+	}
+
+	return errors.WithStack(iter.Err())
+}
+
+func rewriteChunk(ctx context.Context, chunk *Chunk, collector Collector, transform func(*bsonx.Document) (*bsonx.Document, error)) error {
+	samples := chunk.StructuredIterator(ctx)
+	defer samples.Close()
+
+	for samples.Next() {
+		doc := samples.Document()
+		if transform != nil {
+			var err error
+			if doc, err = transform(doc); err != nil {
+				return errors.Wrap(err, "problem transforming sample")
+			}
+			if doc == nil {
+				continue
+			}
+		}
+
+		if err := collector.Add(doc); err != nil {
+			return errors.Wrap(err, "problem adding rewritten sample")
+		}
+	}
+
+	return errors.WithStack(samples.Err())
+}
@@ -0,0 +1,129 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvenance(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	source := &bytes.Buffer{}
+	collector := NewStreamingCollector(10, source)
+	require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "example"))))
+	for i := 0; i < 25; i++ {
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("counter", int64(i)),
+			bsonx.EC.Int64("secret", int64(i*2)),
+		)))
+	}
+	require.NoError(t, FlushCollector(collector, source))
+
+	readAll := func(t *testing.T, data []byte) []*Chunk {
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+
+		chunks := []*Chunk{}
+		for iter.Next() {
+			chunks = append(chunks, iter.Chunk())
+		}
+		require.NoError(t, iter.Err())
+		return chunks
+	}
+
+	original := readAll(t, source.Bytes())
+	require.Len(t, original, 3)
+	for _, chunk := range original {
+		chain, err := chunk.Provenance()
+		require.NoError(t, err)
+		assert.Empty(t, chain)
+		assert.Len(t, chunk.SourceHash(), 64)
+	}
+	assert.NotEqual(t, original[0].SourceHash(), original[1].SourceHash())
+
+	scrubbed := &bytes.Buffer{}
+	require.NoError(t, RewriteChunks(ctx, ReadChunks(ctx, bytes.NewReader(source.Bytes())), scrubbed, RewriteOptions{
+		Tool:       "scrub",
+		Parameters: map[string]string{"fields": "secret"},
+		Transform: func(doc *bsonx.Document) (*bsonx.Document, error) {
+			doc.Delete("secret")
+			return doc, nil
+		},
+	}))
+
+	recompressed := &bytes.Buffer{}
+	require.NoError(t, RewriteChunks(ctx, ReadChunks(ctx, bytes.NewReader(scrubbed.Bytes())), recompressed, RewriteOptions{
+		Tool: "recompress",
+	}))
+
+	intermediate := readAll(t, scrubbed.Bytes())
+	chunks := readAll(t, recompressed.Bytes())
+	require.Len(t, chunks, 3)
+	for idx, chunk := range chunks {
+		assert.Equal(t, original[idx].Size(), chunk.Size())
+		assert.Equal(t, 2, chunk.Len())
+
+		chain, err := chunk.Provenance()
+		require.NoError(t, err)
+		require.Len(t, chain, 2)
+		assert.Equal(t, "scrub", chain[0].Tool)
+		assert.Equal(t, map[string]string{"fields": "secret"}, chain[0].Parameters)
+		assert.Equal(t, original[idx].SourceHash(), chain[0].SourceHash)
+		assert.False(t, chain[0].Timestamp.IsZero())
+		assert.Equal(t, "recompress", chain[1].Tool)
+		assert.Empty(t, chain[1].Parameters)
+		assert.Equal(t, intermediate[idx].SourceHash(), chain[1].SourceHash)
+
+		assert.Equal(t, "example", chunk.userMetadata().Lookup("host").StringValue())
+	}
+
+	t.Run("DropSamples", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, RewriteChunks(ctx, ReadChunks(ctx, bytes.NewReader(source.Bytes())), out, RewriteOptions{
+			Tool: "filter",
+			Transform: func(doc *bsonx.Document) (*bsonx.Document, error) {
+				if doc.Lookup("counter").Int64()%2 == 0 {
+					return nil, nil
+				}
+				return doc, nil
+			},
+		}))
+
+		count := 0
+		for _, chunk := range readAll(t, out.Bytes()) {
+			count += chunk.Size()
+		}
+		assert.Equal(t, 12, count)
+	})
+	t.Run("Errors", func(t *testing.T) {
+		assert.Error(t, RewriteChunks(ctx, ReadChunks(ctx, bytes.NewReader(source.Bytes())), &bytes.Buffer{}, RewriteOptions{}))
+		assert.Error(t, RewriteChunks(ctx, ReadChunks(ctx, bytes.NewReader(source.Bytes())), &bytes.Buffer{}, RewriteOptions{
+			Tool:      "broken",
+			Transform: func(*bsonx.Document) (*bsonx.Document, error) { return nil, errors.New("broken") },
+		}))
+
+		_, err := AppendProvenance(bsonx.NewDocument(bsonx.EC.String(provenanceField, "foo")), Provenance{Tool: "test"})
+		assert.Error(t, err)
+	})
+	t.Run("AppendProvenance", func(t *testing.T) {
+		metadata := bsonx.NewDocument(bsonx.EC.String("host", "example"))
+		first, err := AppendProvenance(metadata, Provenance{Tool: "first"})
+		require.NoError(t, err)
+		second, err := AppendProvenance(first, Provenance{Tool: "second"})
+		require.NoError(t, err)
+
+		assert.Nil(t, metadata.LookupElement(provenanceField))
+		assert.Equal(t, 1, first.Lookup(provenanceField).MutableArray().Len())
+		assert.Equal(t, 2, second.Lookup(provenanceField).MutableArray().Len())
+	})
+}
@@ -0,0 +1,227 @@
+package ftdc
+
+import (
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// Rate returns the per-second rates of change of a counter metric
+// whose samples were collected every window, so that the result has
+// one rate, for each pair of consecutive samples, fewer than the
+// metric has values.
+//
+// Counters only increase, so a value that is smaller than the previous
+// value is treated as a reset of the counter (e.g. a restart of the
+// process that reports it), and the increase between the samples is
+// the value itself, as the counter has counted up from zero since the
+// reset.
+func Rate(m Metric, window time.Duration) []float64 {
+	if len(m.Values) < 2 || window <= 0 {
+		return []float64{}
+	}
+
+	seconds := window.Seconds()
+	out := make([]float64, len(m.Values)-1)
+	for idx := 1; idx < len(m.Values); idx++ {
+		out[idx-1] = counterIncrease(m.originalType, m.Values[idx-1], m.Values[idx]) / seconds
+	}
+
+	return out
+}
+
+// counterIncrease returns the increase of a counter between two
+// values, with reset detection (see Rate.)
+func counterIncrease(t bsontype.Type, previous, current int64) float64 {
+	if t == bsontype.Double {
+		prev, cur := restoreFloat(previous), restoreFloat(current)
+		if cur < prev {
+			return cur
+		}
+		return cur - prev
+	}
+
+	if current < previous {
+		return float64(current)
+	}
+	return float64(current - previous)
+}
+
+// isCounterType reports whether metrics of the type may be counters.
+func isCounterType(t bsontype.Type) bool {
+	switch t {
+	case bsontype.Double, bsontype.Int32, bsontype.Int64:
+		return true
+	default:
+		return false
+	}
+}
+
+type derivedIterator struct {
+	chunks   *ChunkIterator
+	counters KeyMatcher
+	chunk    *Chunk
+	times    []time.Time
+	sample   int
+	keys     []string
+	types    []bsontype.Type
+	counter  []bool
+	previous []int64
+	last     time.Time
+	started  bool
+	metadata *bsonx.Document
+	document *bsonx.Document
+	catcher  grip.Catcher
+}
+
+// NewDerivedIterator returns an iterator of flattened documents in
+// which the values of counter metrics are replaced with their
+// per-second rates of change, as doubles, since the previous sample,
+// with the reset detection of Rate. Other metrics hold their values.
+//
+// Counters are the numeric metrics whose keys the matcher matches, or
+// if the matcher is nil, the metrics that have a counter descriptor
+// (see NewDescriptorCollector.) Rates are computed from the sample
+// times of the first date time metric of each chunk, and the
+// iterator reports an error for chunks without a date time metric.
+//
+// The iterator produces one document for each sample except the
+// first, as the first sample has no previous sample, and likewise
+// skips the first sample after the metrics change between chunks,
+// and samples whose time is not after that of the previous sample.
+//
+// The iterator takes ownership of the chunk iterator, and closes it
+// when the iterator is closed.
+func NewDerivedIterator(iter *ChunkIterator, counters KeyMatcher) Iterator {
+	return &derivedIterator{
+		chunks:   iter,
+		counters: counters,
+		catcher:  grip.NewBasicCatcher(),
+	}
+}
+
+func (iter *derivedIterator) Close()                    { iter.chunks.Close() }
+func (iter *derivedIterator) Err() error                { return iter.catcher.Resolve() }
+func (iter *derivedIterator) Metadata() *bsonx.Document { return iter.metadata }
+func (iter *derivedIterator) Document() *bsonx.Document { return iter.document }
+
+func (iter *derivedIterator) Next() bool {
+	for {
+		if iter.chunk != nil && iter.sample < iter.chunk.Size() {
+			idx := iter.sample
+			iter.sample++
+
+			ts := iter.times[idx]
+			var doc *bsonx.Document
+			if iter.started && ts.After(iter.last) {
+				doc = iter.derive(idx, ts.Sub(iter.last))
+			}
+
+			for m := range iter.chunk.Metrics {
+				iter.previous[m] = iter.chunk.Metrics[m].Values[idx]
+			}
+			iter.last = ts
+			iter.started = true
+
+			if doc != nil {
+				iter.document = doc
+				return true
+			}
+			continue
+		}
+
+		if !iter.chunks.Next() {
+			iter.catcher.Add(iter.chunks.Err())
+			return false
+		}
+
+		chunk := iter.chunks.Chunk()
+		if metadata := chunk.GetMetadata(); metadata != nil {
+			iter.metadata = metadata
+		}
+
+		times := chunk.sampleTimes()
+		if times == nil {
+			iter.catcher.Add(errors.New("cannot compute rates for chunk without a date time metric"))
+			return false
+		}
+
+		if !iter.compatible(chunk) {
+			iter.setSchema(chunk)
+		}
+		iter.chunk = chunk
+		iter.times = times
+		iter.sample = 0
+	}
+}
+
+// compatible returns true if the chunk has the same metrics as the
+// previous chunk.
+func (iter *derivedIterator) compatible(chunk *Chunk) bool {
+	if len(chunk.Metrics) != len(iter.keys) {
+		return false
+	}
+
+	for idx := range chunk.Metrics {
+		if chunk.Metrics[idx].originalType != iter.types[idx] || chunk.Metrics[idx].Key() != iter.keys[idx] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setSchema records the metrics of the chunk, and which of them are
+// counters, and discards the previous sample.
+func (iter *derivedIterator) setSchema(chunk *Chunk) {
+	num := len(chunk.Metrics)
+	iter.keys = make([]string, num)
+	iter.types = make([]bsontype.Type, num)
+	iter.counter = make([]bool, num)
+	iter.previous = make([]int64, num)
+	iter.started = false
+
+	var descriptors map[string]MetricDescriptor
+	if iter.counters == nil {
+		descriptors = iter.chunks.MetricDescriptors()
+	}
+
+	for idx := range chunk.Metrics {
+		key := chunk.Metrics[idx].Key()
+		iter.keys[idx] = key
+		iter.types[idx] = chunk.Metrics[idx].originalType
+
+		if !isCounterType(iter.types[idx]) {
+			continue
+		}
+		if iter.counters != nil {
+			iter.counter[idx] = iter.counters.MatchKey(key)
+		} else {
+			iter.counter[idx] = descriptors[key].Kind == MetricKindCounter
+		}
+	}
+}
+
+// derive returns the document for a sample, with the rates of the
+// counters since the previous sample.
+func (iter *derivedIterator) derive(sample int, elapsed time.Duration) *bsonx.Document {
+	doc := bsonx.DC.Make(len(iter.keys))
+	seconds := elapsed.Seconds()
+
+	for idx, key := range iter.keys {
+		value := iter.chunk.Metrics[idx].Values[sample]
+		if iter.counter[idx] {
+			doc.Append(bsonx.EC.Double(key, counterIncrease(iter.types[idx], iter.previous[idx], value)/seconds))
+			continue
+		}
+
+		if elem, ok := restoreFlat(iter.types[idx], key, value); ok {
+			doc.Append(elem)
+		}
+	}
+
+	return doc
+}
@@ -0,0 +1,92 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRate(t *testing.T) {
+	t.Run("Counter", func(t *testing.T) {
+		m := Metric{KeyName: "ops", Values: []int64{0, 10, 30, 5, 15}, originalType: bsontype.Int64}
+		assert.Equal(t, []float64{5, 10, 2.5, 5}, Rate(m, 2*time.Second))
+	})
+	t.Run("Double", func(t *testing.T) {
+		values := []int64{int64(math.Float64bits(1.5)), int64(math.Float64bits(2.5)), int64(math.Float64bits(0.5))}
+		m := Metric{KeyName: "cpu", Values: values, originalType: bsontype.Double}
+		assert.Equal(t, []float64{1, 0.5}, Rate(m, time.Second))
+	})
+	t.Run("Degenerate", func(t *testing.T) {
+		assert.Empty(t, Rate(Metric{Values: []int64{1}, originalType: bsontype.Int64}, time.Second))
+		assert.Empty(t, Rate(Metric{Values: []int64{1, 2}, originalType: bsontype.Int64}, 0))
+	})
+}
+
+func TestDerivedIterator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC)
+	ops := []int64{0, 10, 20, 40, 5, 25, 45}
+	buf := &bytes.Buffer{}
+	collector := NewDescriptorCollector(NewStreamingCollector(3, buf))
+	require.NoError(t, collector.Describe("ops", MetricDescriptor{Kind: MetricKindCounter}))
+	for idx, value := range ops {
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(idx)*2*time.Second)),
+			bsonx.EC.Int64("ops", value),
+			bsonx.EC.Int64("conns", int64(idx)),
+		)))
+	}
+	require.NoError(t, FlushCollector(collector, buf))
+
+	collect := func(t *testing.T, iter Iterator) []*bsonx.Document {
+		defer iter.Close()
+
+		docs := []*bsonx.Document{}
+		for iter.Next() {
+			docs = append(docs, iter.Document())
+		}
+		require.NoError(t, iter.Err())
+		return docs
+	}
+
+	t.Run("Descriptors", func(t *testing.T) {
+		docs := collect(t, NewDerivedIterator(ReadChunks(ctx, bytes.NewReader(buf.Bytes())), nil))
+		require.Len(t, docs, len(ops)-1)
+
+		expected := []float64{5, 5, 10, 2.5, 10, 10}
+		for idx, doc := range docs {
+			assert.Equal(t, expected[idx], doc.Lookup("ops").Double(), "sample %d", idx)
+			assert.EqualValues(t, idx+1, doc.Lookup("conns").Int64())
+			assert.True(t, base.Add(time.Duration(idx+1)*2*time.Second).Equal(doc.Lookup("ts").Time()))
+		}
+	})
+	t.Run("Matcher", func(t *testing.T) {
+		matcher := KeyMatcherFunc(func(key string) bool { return key == "conns" })
+		docs := collect(t, NewDerivedIterator(ReadChunks(ctx, bytes.NewReader(buf.Bytes())), matcher))
+		require.Len(t, docs, len(ops)-1)
+		for idx, doc := range docs {
+			assert.Equal(t, 0.5, doc.Lookup("conns").Double())
+			assert.Equal(t, ops[idx+1], doc.Lookup("ops").Int64())
+		}
+	})
+	t.Run("NoTimes", func(t *testing.T) {
+		collector := NewBaseCollector(10)
+		require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("ops", 1))))
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		iter := NewDerivedIterator(ReadChunks(ctx, bytes.NewReader(data)), nil)
+		defer iter.Close()
+		assert.False(t, iter.Next())
+		assert.Error(t, iter.Err())
+	})
+}
@@ -3,7 +3,6 @@ package ftdc
 import (
 	"bufio"
 	"bytes"
-	"compress/zlib"
 	"context"
 	"encoding/binary"
 	"io"
@@ -34,9 +33,26 @@ func readDiagnostic(ctx context.Context, f io.Reader, ch chan<- *bsonx.Document)
 }
 
 func readChunks(ctx context.Context, ch <-chan *bsonx.Document, o chan<- *Chunk) error {
+	return readFilteredChunks(ctx, ch, o, nil, nil)
+}
+
+// readFilteredChunks is the same as readChunks, except that the chunks
+// only hold the metrics for which include returns true, as with
+// readChunk, and encrypted documents are decrypted with the key
+// provider. Both the include function and the key provider may be
+// nil.
+func readFilteredChunks(ctx context.Context, ch <-chan *bsonx.Document, o chan<- *Chunk, include func(*Metric) bool, decrypt KeyProvider) error {
 	defer close(o)
 
-	var metadata *bsonx.Document
+	var (
+		metadata *bsonx.Document
+		periodic periodicMetadata
+	)
+
+	// the reference documents in each chunk typically have the
+	// same keys, so share the key strings between all chunks
+	// read by this iterator.
+	keys := bsonx.NewKeyInterner()
 
 	for doc := range ch {
 		// the FTDC streams typically have onetime-per-file
@@ -44,108 +60,276 @@ func readChunks(ctx context.Context, ch <-chan *bsonx.Document, o chan<- *Chunk)
 		// change (like process parameters, and machine
 		// info. This implementation entirely ignores that.)
 		docType := doc.Lookup("type")
-
-		if isNum(0, docType) {
-			metadata = doc
+		if isNum(periodicMetadataType, docType) {
+			if err := periodic.add(doc); err != nil {
+				recordDecode(err)
+				return errors.WithStack(err)
+			}
 			continue
-		} else if !isNum(1, docType) {
+		} else if !isNum(0, docType) && !isNum(1, docType) {
 			continue
 		}
 
-		id, _ := doc.Lookup("_id").TimeOK()
+		doc, err := decryptDocument(doc, decrypt)
+		if err != nil {
+			recordDecode(err)
+			return errors.WithStack(err)
+		}
 
-		// get the data field which holds the metrics chunk
-		zelem := doc.LookupElement("data")
-		if zelem == nil {
-			return errors.New("data is not populated")
+		if isNum(0, docType) {
+			metadata = doc
+			continue
 		}
-		_, zBytes := zelem.Value().Binary()
 
-		// the metrics chunk, after the first 4 bytes, is zlib
-		// compressed, so we make a reader for that. data
-		z, err := zlib.NewReader(bytes.NewBuffer(zBytes[4:]))
+		chunk, err := readChunk(doc, metadata, keys, include)
+		recordDecode(err)
 		if err != nil {
-			return errors.Wrap(err, "problem building zlib reader")
+			return errors.WithStack(err)
 		}
-		buf := bufio.NewReader(z)
+		chunk.periodic = periodic.doc
 
-		// the metrics chunk, which is *not* bson, first
-		// contains a bson document which begins the
-		// sample. This has the field and we use use it to
-		// create a slice of Metrics for each series. The
-		// deltas are not populated.
-		refDoc, metrics, err := readBufMetrics(buf)
-		if err != nil {
-			return errors.Wrap(err, "problem reading metrics")
+		select {
+		case o <- chunk:
+		case <-ctx.Done():
+			return nil
 		}
+	}
+	return nil
+}
 
-		// now go back and read the first few bytes
-		// (uncompressed) which tell us how many metrics are
-		// in each sample (e.g. the fields in the document)
-		// and how many events are collected in each series.
-		bl := make([]byte, 8)
-		_, err = io.ReadAtLeast(buf, bl, 8)
-		if err != nil {
-			return err
+// readChunk decodes a single metric chunk document (i.e. with a type
+// of 1) into a Chunk. The keys of the reference document are interned
+// in the provided table, which may be nil.
+//
+// If include is not nil, the chunk only holds the metrics for which
+// it returns true, and the values of other metrics are skipped
+// without being stored.
+func readChunk(doc *bsonx.Document, metadata *bsonx.Document, keys *bsonx.KeyInterner, include func(*Metric) bool) (*Chunk, error) {
+	id, _ := doc.Lookup("_id").TimeOK()
+
+	zBytes, payload, err := readChunkPayload(doc)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	buf := bufio.NewReader(bytes.NewReader(payload))
+
+	// the metrics chunk, which is *not* bson, first
+	// contains a bson document which begins the
+	// sample. This has the field and we use use it to
+	// create a slice of Metrics for each series. The
+	// deltas are not populated.
+	refDoc, metrics, err := readBufMetrics(buf, keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem reading metrics")
+	}
+
+	// now go back and read the first few bytes
+	// (uncompressed) which tell us how many metrics are
+	// in each sample (e.g. the fields in the document)
+	// and how many events are collected in each series.
+	bl := make([]byte, 8)
+	_, err = io.ReadAtLeast(buf, bl, 8)
+	if err != nil {
+		return nil, err
+	}
+	nmetrics := int(binary.LittleEndian.Uint32(bl[:4]))
+	ndeltas := int(binary.LittleEndian.Uint32(bl[4:]))
+
+	// if the number of metrics that we see from the
+	// source document (metrics) and the number the file
+	// reports don't equal, it's probably corrupt.
+	if nmetrics != len(metrics) {
+		return nil, errors.Errorf("metrics mismatch, file likely corrupt Expected %d, got %d", nmetrics, len(metrics))
+	}
+
+	order, err := readColumnOrder(doc, nmetrics)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	schema, err := readSchemaTransition(doc)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	xorFloats, err := xorFloatsEnabled(doc)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	dodTimes, err := dodTimesEnabled(doc)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// now go back and populate the delta numbers
+	var nzeroes uint64
+	for _, i := range order {
+		v := metrics[i]
+		if include != nil && !include(&metrics[i]) {
+			// the deltas of every column must still be
+			// decoded, as runs of zeros span columns.
+			if nzeroes, err = skipDeltas(buf, ndeltas, nzeroes); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			metrics[i].Values = nil
+			continue
 		}
-		nmetrics := int(binary.LittleEndian.Uint32(bl[:4]))
-		ndeltas := int(binary.LittleEndian.Uint32(bl[4:]))
-
-		// if the number of metrics that we see from the
-		// source document (metrics) and the number the file
-		// reports don't equal, it's probably corrupt.
-		if nmetrics != len(metrics) {
-			return errors.Errorf("metrics mismatch, file likely corrupt Expected %d, got %d", nmetrics, len(metrics))
-		}
-
-		// now go back and populate the delta numbers
-		var nzeroes uint64
-		for i, v := range metrics {
-			metrics[i].startingValue = v.startingValue
-			metrics[i].Values = make([]int64, ndeltas)
-
-			for j := 0; j < ndeltas; j++ {
-				var delta uint64
-				if nzeroes != 0 {
-					delta = 0
-					nzeroes--
-				} else {
-					delta, err = binary.ReadUvarint(buf)
+		metrics[i].Values = make([]int64, ndeltas)
+
+		for j := 0; j < ndeltas; j++ {
+			var delta uint64
+			if nzeroes != 0 {
+				delta = 0
+				nzeroes--
+			} else {
+				delta, err = binary.ReadUvarint(buf)
+				if err != nil {
+					return nil, errors.Wrap(err, "reached unexpected end of encoded integer")
+				}
+				if delta == 0 {
+					nzeroes, err = binary.ReadUvarint(buf)
 					if err != nil {
-						return errors.Wrap(err, "reached unexpected end of encoded integer")
-					}
-					if delta == 0 {
-						nzeroes, err = binary.ReadUvarint(buf)
-						if err != nil {
-							return err
-						}
+						return nil, err
 					}
 				}
-				metrics[i].Values[j] = int64(delta)
 			}
-			if metrics[i].originalType == bsontype.Double {
-				metrics[i].Values = undeltaFloats(v.startingValue, metrics[i].Values)
-			} else {
-				metrics[i].Values = undelta(v.startingValue, metrics[i].Values)
+			metrics[i].Values[j] = int64(delta)
+		}
+		if metrics[i].originalType == bsontype.DateTime && dodTimes {
+			metrics[i].Values = undeltaOfDeltas(metrics[i].Values)
+		}
+		if metrics[i].originalType == bsontype.Double && xorFloats {
+			metrics[i].Values = unxorFloats(v.startingValue, metrics[i].Values)
+		} else if metrics[i].originalType == bsontype.Double {
+			metrics[i].Values = undeltaFloats(v.startingValue, metrics[i].Values)
+		} else {
+			metrics[i].Values = undelta(v.startingValue, metrics[i].Values)
+		}
+	}
+
+	if include != nil {
+		selected := metrics[:0]
+		for _, m := range metrics {
+			if m.Values != nil {
+				selected = append(selected, m)
 			}
+		}
+		metrics = selected
+	}
+
+	return &Chunk{
+		Metrics:   metrics,
+		nPoints:   ndeltas + 1, // this accounts for the reference document
+		id:        id,
+		metadata:  metadata,
+		reference: refDoc,
+		schema:    schema,
+		payload:   zBytes,
+	}, nil
+}
 
+// readChunkPayload returns the data field of a chunk document, and
+// the payload, which is decompressed and checked against the chunk's
+// checksum, if it has one.
+func readChunkPayload(doc *bsonx.Document) ([]byte, []byte, error) {
+	if doc.LookupElement(encryptionField) != nil {
+		return nil, nil, errors.New("chunk is encrypted, read it with a key provider")
+	}
+
+	// get the data field which holds the metrics chunk
+	zelem := doc.LookupElement("data")
+	if zelem == nil {
+		return nil, nil, errors.New("data is not populated")
+	}
+	_, zBytes := zelem.Value().Binary()
+
+	// the metrics chunk, after the first 4 bytes, is compressed
+	// (with zlib, unless the chunk names another codec), so we
+	// decompress it, and verify its checksum, if it has one,
+	// before decoding anything.
+	codec, err := readCompression(doc)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	payload, err := decompressBuffer(codec, zBytes)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	if err = verifyChecksum(doc, payload); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	return zBytes, payload, nil
+}
+
+// readColumnOrder returns the order of the columns of deltas in the
+// payload of a chunk document. Chunks written by the grouping
+// collector store the columns of metrics that never change after all
+// other columns.
+func readColumnOrder(doc *bsonx.Document, nmetrics int) ([]int, error) {
+	var cold []byte
+	if celem := doc.LookupElement(coldMetricsField); celem != nil {
+		var ok bool
+		if _, cold, ok = celem.Value().BinaryOK(); !ok {
+			return nil, errors.New("cold metrics field is not binary")
 		}
-		select {
-		case o <- &Chunk{
-			Metrics:   metrics,
-			nPoints:   ndeltas + 1, // this accounts for the reference document
-			id:        id,
-			metadata:  metadata,
-			reference: refDoc,
-		}:
-		case <-ctx.Done():
-			return nil
+	}
+
+	order, err := columnOrder(cold, nmetrics)
+	return order, errors.WithStack(err)
+}
+
+// readEncryptedChunk decrypts the chunk document, if it's encrypted,
+// and decodes it with readChunk.
+func readEncryptedChunk(doc *bsonx.Document, metadata *bsonx.Document, keys *bsonx.KeyInterner, decrypt KeyProvider) (*Chunk, error) {
+	doc, err := decryptDocument(doc, decrypt)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return readChunk(doc, metadata, keys, nil)
+}
+
+// skipDeltas reads the deltas of a single column from the payload
+// without storing them, given the number of zero deltas remaining
+// from the previous column, and returns the number of zero deltas
+// remaining for the next column.
+func skipDeltas(buf *bufio.Reader, ndeltas int, nzeroes uint64) (uint64, error) {
+	for j := 0; j < ndeltas; {
+		if nzeroes != 0 {
+			n := uint64(ndeltas - j)
+			if nzeroes < n {
+				n = nzeroes
+			}
+			nzeroes -= n
+			j += int(n)
+			continue
 		}
+
+		delta, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return 0, errors.Wrap(err, "reached unexpected end of encoded integer")
+		}
+		if delta == 0 {
+			if nzeroes, err = binary.ReadUvarint(buf); err != nil {
+				return 0, err
+			}
+		}
+		j++
 	}
-	return nil
+
+	return nzeroes, nil
 }
 
 func readBufBSON(buf *bufio.Reader) (*bsonx.Document, error) {
+	envelope, data, err := readBufEnvelope(buf)
+	if err != nil {
+		return nil, err
+	}
+	if envelope != nil {
+		return readEnvelopedDocument(envelope, data)
+	}
+
 	doc := &bsonx.Document{}
 
 	if _, err := doc.ReadFrom(buf); err != nil {
@@ -155,9 +339,9 @@ func readBufBSON(buf *bufio.Reader) (*bsonx.Document, error) {
 	return doc, nil
 }
 
-func readBufMetrics(buf *bufio.Reader) (*bsonx.Document, []Metric, error) {
-	doc, err := readBufBSON(buf)
-	if err != nil {
+func readBufMetrics(buf *bufio.Reader, keys *bsonx.KeyInterner) (*bsonx.Document, []Metric, error) {
+	doc := &bsonx.Document{}
+	if _, err := doc.ReadFromInterned(buf, keys); err != nil {
 		return nil, nil, errors.Wrap(err, "problem reading reference doc")
 	}
 
@@ -0,0 +1,266 @@
+package ftdc
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// ReadChunksOptions configure the ChunkIterator returned by
+// ReadChunksWithOptions.
+type ReadChunksOptions struct {
+	// Workers is the number of goroutines that decompress and
+	// decode chunks concurrently. Values of 0 and 1 decode chunks
+	// on a single goroutine, as ReadChunks does, and negative
+	// values use one goroutine per CPU.
+	Workers int
+
+	// Keys decrypts the chunks and metadata documents written by
+	// encrypted collectors (see NewEncryptedCollector). Without
+	// a key provider, the iterator returns an error when it reads
+	// encrypted data.
+	Keys KeyProvider
+
+	// MemoryBudget limits the approximate number of bytes of
+	// decoded values held in chunks that the parallel decoder has
+	// decoded ahead of the consumer of the iterator. When decoded
+	// chunks reach the budget, the decoder waits until the
+	// consumer advances the iterator past them before decoding
+	// more chunks. Chunks that are being decoded are not counted,
+	// so the iterator may exceed the budget by the size of one
+	// chunk per worker. A value of 0 disables the budget, and the
+	// budget has no effect with a single worker.
+	MemoryBudget int64
+}
+
+// ReadChunksWithOptions creates a ChunkIterator from an underlying
+// FTDC data source, as ReadChunks does. With more than one worker,
+// chunks are decoded concurrently, which is much faster for large
+// files on machines with many cores, while the iterator still returns
+// the chunks in the order in which they appear in the data source.
+//
+// Parallel decoding holds up to two chunks per worker in memory ahead
+// of the consumer of the iterator.
+func ReadChunksWithOptions(ctx context.Context, r io.Reader, opts ReadChunksOptions) *ChunkIterator {
+	workers := opts.Workers
+	if workers < 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers <= 1 {
+		return readChunksWithKeys(ctx, r, opts.Keys)
+	}
+
+	iter := &ChunkIterator{
+		catcher: grip.NewBasicCatcher(),
+		pipe:    make(chan *Chunk, 2),
+	}
+	if opts.MemoryBudget > 0 {
+		iter.budget = newMemoryBudget(opts.MemoryBudget)
+	}
+
+	ipc := make(chan *bsonx.Document)
+	ctx, iter.cancel = context.WithCancel(ctx)
+
+	go func() {
+		iter.catcher.Add(readDiagnostic(ctx, r, ipc))
+	}()
+
+	go func() {
+		iter.catcher.Add(readChunksParallel(ctx, ipc, iter.pipe, workers, opts.Keys, iter.budget))
+	}()
+
+	return iter
+}
+
+// chunkJob is a chunk document to decode. Workers send the decoded
+// chunk, or the error, to the result channel, which is buffered so
+// that workers never wait for the consumer.
+type chunkJob struct {
+	doc      *bsonx.Document
+	metadata *bsonx.Document
+	periodic *bsonx.Document
+	result   chan chunkResult
+}
+
+type chunkResult struct {
+	chunk *Chunk
+	err   error
+}
+
+// readChunksParallel has the same semantics as readChunks, but decodes
+// (and decrypts) chunks on a pool of workers. Jobs are queued in the
+// order that the chunk documents are read, and the results are sent to
+// the output in that order, so at most 2*workers chunks are in flight
+// at once. If the budget is not nil, chunks are only queued while the
+// decoded chunks are within the budget.
+func readChunksParallel(ctx context.Context, ch <-chan *bsonx.Document, o chan<- *Chunk, workers int, decrypt KeyProvider, budget *memoryBudget) error {
+	defer close(o)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	keys := bsonx.NewKeyInterner()
+	jobs := make(chan *chunkJob, workers)
+	ordered := make(chan *chunkJob, workers)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				chunk, err := readEncryptedChunk(job.doc, job.metadata, keys, decrypt)
+				recordDecode(err)
+				if err == nil {
+					chunk.periodic = job.periodic
+				}
+				if err == nil && budget != nil {
+					budget.add(chunk.valuesSize())
+				}
+				job.result <- chunkResult{chunk: chunk, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+
+		var (
+			metadata *bsonx.Document
+			periodic periodicMetadata
+			err      error
+		)
+		for doc := range ch {
+			docType := doc.Lookup("type")
+			if isNum(0, docType) {
+				// metadata documents are small, so
+				// they're decrypted here, in order.
+				if metadata, err = decryptDocument(doc, decrypt); err != nil {
+					job := &chunkJob{result: make(chan chunkResult, 1)}
+					job.result <- chunkResult{err: err}
+					select {
+					case ordered <- job:
+					case <-ctx.Done():
+					}
+					return
+				}
+				continue
+			} else if isNum(periodicMetadataType, docType) {
+				if err = periodic.add(doc); err != nil {
+					recordDecode(err)
+					job := &chunkJob{result: make(chan chunkResult, 1)}
+					job.result <- chunkResult{err: err}
+					select {
+					case ordered <- job:
+					case <-ctx.Done():
+					}
+					return
+				}
+				continue
+			} else if !isNum(1, docType) {
+				continue
+			}
+
+			if budget != nil && !budget.wait(ctx) {
+				return
+			}
+
+			job := &chunkJob{doc: doc, metadata: metadata, periodic: periodic.doc, result: make(chan chunkResult, 1)}
+			select {
+			case ordered <- job:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for job := range ordered {
+		var res chunkResult
+		select {
+		case res = <-job.result:
+		case <-ctx.Done():
+			return nil
+		}
+		if res.err != nil {
+			return errors.WithStack(res.err)
+		}
+
+		select {
+		case o <- res.chunk:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// memoryBudget tracks the size of the decoded chunks that the parallel
+// decoder holds ahead of the consumer.
+type memoryBudget struct {
+	mu     sync.Mutex
+	limit  int64
+	used   int64
+	notify chan struct{}
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	return &memoryBudget{
+		limit:  limit,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (b *memoryBudget) add(size int64) {
+	b.mu.Lock()
+	b.used += size
+	b.mu.Unlock()
+}
+
+func (b *memoryBudget) release(size int64) {
+	b.mu.Lock()
+	b.used -= size
+	b.mu.Unlock()
+
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks until the decoded chunks are within the budget, and
+// returns false if the context is canceled first.
+func (b *memoryBudget) wait(ctx context.Context) bool {
+	for {
+		b.mu.Lock()
+		ok := b.used < b.limit
+		b.mu.Unlock()
+		if ok {
+			return true
+		}
+
+		select {
+		case <-b.notify:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// valuesSize returns the number of bytes of the decoded values of the
+// chunk's metrics.
+func (c *Chunk) valuesSize() int64 {
+	var size int64
+	for _, m := range c.Metrics {
+		size += int64(len(m.Values)) * 8
+	}
+	return size
+}
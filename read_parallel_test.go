@@ -0,0 +1,117 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadChunksWithOptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// twenty chunks of ten samples, where the schema changes every
+	// five chunks, and the metadata changes half way through.
+	buf := &bytes.Buffer{}
+	collector := NewBaseCollector(10)
+	require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "first"))))
+	for i := 0; i < 200; i++ {
+		doc := bsonx.NewDocument(bsonx.EC.Int64("counter", int64(i)))
+		for j := 0; j < i/50; j++ {
+			doc.Append(bsonx.EC.Int64(fmt.Sprint("extra", j), int64(i*j)))
+		}
+		require.NoError(t, collector.Add(doc))
+
+		if collector.Info().SampleCount == 10 {
+			require.NoError(t, FlushCollector(collector, buf))
+		}
+		if i == 99 {
+			require.NoError(t, collector.SetMetadata(bsonx.NewDocument(bsonx.EC.String("host", "second"))))
+		}
+	}
+	data := buf.Bytes()
+
+	readAll := func(t *testing.T, iter *ChunkIterator) []*Chunk {
+		defer iter.Close()
+		out := []*Chunk{}
+		for iter.Next() {
+			out = append(out, iter.Chunk())
+		}
+		require.NoError(t, iter.Err())
+		return out
+	}
+	expected := readAll(t, ReadChunks(ctx, bytes.NewReader(data)))
+	require.Len(t, expected, 20)
+
+	for _, workers := range []int{-1, 0, 1, 2, 8, 64} {
+		t.Run(fmt.Sprintf("Workers%d", workers), func(t *testing.T) {
+			actual := readAll(t, ReadChunksWithOptions(ctx, bytes.NewReader(data), ReadChunksOptions{Workers: workers}))
+			require.Len(t, actual, len(expected))
+
+			for idx := range expected {
+				assert.Equal(t, expected[idx].Size(), actual[idx].Size(), "chunk %d", idx)
+				assert.Equal(t, expected[idx].GetMetadata(), actual[idx].GetMetadata(), "chunk %d", idx)
+				require.Len(t, actual[idx].Metrics, len(expected[idx].Metrics), "chunk %d", idx)
+				for m := range expected[idx].Metrics {
+					assert.Equal(t, expected[idx].Metrics[m].Key(), actual[idx].Metrics[m].Key())
+					assert.Equal(t, expected[idx].Metrics[m].Values, actual[idx].Metrics[m].Values)
+				}
+			}
+		})
+	}
+	t.Run("CorruptChunk", func(t *testing.T) {
+		corrupt, err := bsonx.NewDocument(
+			bsonx.EC.Int32("type", 1),
+			bsonx.EC.Binary("data", []byte("not a zlib stream")),
+		).MarshalBSON()
+		require.NoError(t, err)
+
+		// the chunks before the corrupt chunk are returned, and
+		// the chunks after it are not.
+		in := append(append(append([]byte{}, data...), corrupt...), data...)
+		iter := ReadChunksWithOptions(ctx, bytes.NewReader(in), ReadChunksOptions{Workers: 4})
+		defer iter.Close()
+
+		count := 0
+		for iter.Next() {
+			count++
+		}
+		assert.Equal(t, len(expected), count)
+		assert.Error(t, iter.Err())
+	})
+	t.Run("MemoryBudget", func(t *testing.T) {
+		for _, budget := range []int64{1, 1024, 1 << 30} {
+			iter := ReadChunksWithOptions(ctx, bytes.NewReader(data), ReadChunksOptions{Workers: 4, MemoryBudget: budget})
+			require.NotNil(t, iter.budget)
+			actual := readAll(t, iter)
+			require.Len(t, actual, len(expected))
+			for idx := range expected {
+				assert.Equal(t, expected[idx].Metrics, actual[idx].Metrics, "chunk %d", idx)
+			}
+
+			// every chunk is released once the consumer
+			// advances past it.
+			assert.Zero(t, iter.budget.used)
+		}
+	})
+	t.Run("EarlyClose", func(t *testing.T) {
+		iter := ReadChunksWithOptions(ctx, bytes.NewReader(data), ReadChunksOptions{Workers: 4})
+		require.True(t, iter.Next())
+		require.NotNil(t, iter.Chunk())
+		iter.Close()
+
+		// chunks that were decoded before the iterator closed
+		// may still be returned, but iteration must end.
+		count := 1
+		for iter.Next() {
+			count++
+		}
+		assert.True(t, count < len(expected))
+		assert.NoError(t, iter.Err())
+	})
+}
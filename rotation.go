@@ -0,0 +1,282 @@
+package ftdc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// RotationOptions describe how FTDC data is split between files in a
+// directory, and how long those files are retained, following the
+// layout of the mongod "diagnostic.data" directory.
+type RotationOptions struct {
+	// Prefix is the prefix of the name of each file, which is
+	// followed by the time that the file was created. Defaults to
+	// "metrics".
+	Prefix string
+	// MaxFileSize is the size, in bytes, after which a file is
+	// closed and subsequent data is written to a new file. Files
+	// are only rotated between chunks, so files may exceed this
+	// size by up to one chunk. Zero disables size based
+	// rotation.
+	MaxFileSize int64
+	// RotateInterval is the length of time after which a file is
+	// closed and subsequent data is written to a new file. Zero
+	// disables time based rotation.
+	RotateInterval time.Duration
+	// MaxTotalSize is the maximum total size, in bytes, of all
+	// files in the directory with the prefix. The oldest files
+	// are removed once the total exceeds this size. Zero disables
+	// size based retention.
+	MaxTotalSize int64
+	// MaxAge is the length of time that files are retained after
+	// they were last modified. Zero disables age based
+	// retention.
+	MaxAge time.Duration
+	// SampleCount is the maximum number of samples in each chunk
+	// written by a RotatingFileCollector. Defaults to 300.
+	// Sessions use SessionOptions.SampleCount instead.
+	SampleCount int
+}
+
+// Validate ensures that the rotation options are reasonable, and sets
+// default values.
+func (opts *RotationOptions) Validate() error {
+	if opts.Prefix == "" {
+		opts.Prefix = "metrics"
+	}
+	if opts.SampleCount == 0 {
+		opts.SampleCount = 300
+	}
+
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(strings.ContainsRune(opts.Prefix, filepath.Separator), "file prefix must not contain a path separator")
+	catcher.NewWhen(opts.MaxFileSize < 0, "max file size must not be negative")
+	catcher.NewWhen(opts.RotateInterval < 0, "rotation interval must not be negative")
+	catcher.NewWhen(opts.MaxTotalSize < 0, "max total size must not be negative")
+	catcher.NewWhen(opts.MaxAge < 0, "max age must not be negative")
+	catcher.NewWhen(opts.SampleCount < 0, "sample count must not be negative")
+	catcher.NewWhen(opts.MaxTotalSize > 0 && opts.MaxFileSize > opts.MaxTotalSize,
+		"max total size must not be less than max file size")
+
+	return catcher.Resolve()
+}
+
+// rotatingWriter writes FTDC data to a series of files in a
+// directory. Each call to Write is expected to contain a complete
+// chunk (as written by FlushCollector) and files are only rotated
+// between writes. Each new file begins with the metadata document, if
+// one is set.
+type rotatingWriter struct {
+	dir      string
+	opts     RotationOptions
+	metadata *bsonx.Document
+
+	// onRotate, if set, is called with the name of each file after
+	// it is closed, before old files are pruned. The keep
+	// function, if set, reports files that must not be pruned.
+	onRotate func(string)
+	keep     func(string) bool
+
+	file    *os.File
+	name    string
+	size    int64
+	opened  time.Time
+	lastSeq int
+
+	// catcher holds the errors from rotating or pruning files
+	// after writes that succeeded, which are returned by Close.
+	catcher grip.Catcher
+}
+
+func newRotatingWriter(dir string, opts RotationOptions) (*rotatingWriter, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid rotation options")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "problem creating directory '%s'", dir)
+	}
+
+	return &rotatingWriter{dir: dir, opts: opts, catcher: grip.NewBasicCatcher()}, nil
+}
+
+func (w *rotatingWriter) fileName(ts time.Time) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%s.%s-%05d", w.opts.Prefix, ts.UTC().Format("2006-01-02T15-04-05Z"), w.lastSeq))
+}
+
+func (w *rotatingWriter) open() error {
+	now := time.Now()
+
+	var (
+		file *os.File
+		err  error
+	)
+
+	// the sequence number disambiguates files created within the
+	// same second, including by previous writers.
+	for {
+		w.lastSeq++
+		w.name = w.fileName(now)
+
+		file, err = os.OpenFile(w.name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "problem creating file '%s'", w.name)
+		}
+		break
+	}
+
+	w.file = file
+	w.size = 0
+	w.opened = now
+
+	if w.metadata == nil {
+		return nil
+	}
+
+	n, err := bsonx.NewDocument(
+		bsonx.EC.Time("_id", now),
+		bsonx.EC.Int32("type", 0),
+		bsonx.EC.SubDocument("doc", w.metadata)).WriteTo(w.file)
+	w.size += n
+
+	return errors.Wrap(err, "problem writing metadata document")
+}
+
+func (w *rotatingWriter) Write(payload []byte) (int, error) {
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	}
+
+	n, err := w.file.Write(payload)
+	w.size += int64(n)
+	if err != nil {
+		return n, errors.Wrapf(err, "problem writing to '%s'", w.name)
+	}
+
+	// the payload is written, so errors from rotating the file
+	// are reported by Close instead.
+	if w.shouldRotate() {
+		w.catcher.Add(errors.WithStack(w.rotate()))
+	}
+
+	return n, nil
+}
+
+func (w *rotatingWriter) shouldRotate() bool {
+	if w.file == nil {
+		return false
+	}
+
+	if w.opts.MaxFileSize > 0 && w.size >= w.opts.MaxFileSize {
+		return true
+	}
+
+	return w.opts.RotateInterval > 0 && time.Since(w.opened) >= w.opts.RotateInterval
+}
+
+// rotate closes the current file, if any, and prunes old files. The
+// next write creates a new file.
+func (w *rotatingWriter) rotate() error {
+	if w.file == nil {
+		return nil
+	}
+
+	name := w.name
+	err := w.file.Close()
+	w.file = nil
+	w.name = ""
+	if err != nil {
+		return errors.Wrapf(err, "problem closing '%s'", name)
+	}
+
+	if w.onRotate != nil {
+		w.onRotate(name)
+	}
+
+	return errors.WithStack(w.prune())
+}
+
+func (w *rotatingWriter) Close() error {
+	w.catcher.Add(w.rotate())
+	err := w.catcher.Resolve()
+	w.catcher = grip.NewBasicCatcher()
+
+	return err
+}
+
+// files returns the files in the directory that were created by a
+// writer with the same prefix, oldest first.
+func (w *rotatingWriter) files() ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem listing directory '%s'", w.dir)
+	}
+
+	out := make([]os.FileInfo, 0, len(infos))
+	for _, info := range infos {
+		if info.Mode().IsRegular() && strings.HasPrefix(info.Name(), w.opts.Prefix+".") {
+			out = append(out, info)
+		}
+	}
+
+	// the names of files begin with their creation time, so they
+	// sort chronologically.
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+
+	return out, nil
+}
+
+// prune removes the oldest files until the total size and age of the
+// files in the directory are within the retention limits. The current
+// file is never removed.
+func (w *rotatingWriter) prune() error {
+	if w.opts.MaxTotalSize == 0 && w.opts.MaxAge == 0 {
+		return nil
+	}
+
+	files, err := w.files()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var total int64
+	for _, info := range files {
+		total += info.Size()
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for _, info := range files {
+		name := filepath.Join(w.dir, info.Name())
+		if name == w.name || (w.keep != nil && w.keep(name)) {
+			continue
+		}
+
+		expired := w.opts.MaxAge > 0 && time.Since(info.ModTime()) > w.opts.MaxAge
+		oversize := w.opts.MaxTotalSize > 0 && total > w.opts.MaxTotalSize
+		if !expired && !oversize {
+			continue
+		}
+
+		if err := os.Remove(name); err != nil {
+			catcher.Add(errors.Wrapf(err, "problem removing '%s'", name))
+			continue
+		}
+		total -= info.Size()
+	}
+
+	return catcher.Resolve()
+}
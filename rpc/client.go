@@ -0,0 +1,72 @@
+//go:build grpc
+// +build grpc
+
+package rpc
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// Client sends metrics to the service over a gRPC connection.
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewClient returns a client that uses the connection, which the
+// caller remains responsible for closing.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+// SendMetrics opens a stream of documents to the server. Canceling the
+// context aborts the stream.
+func (c *Client) SendMetrics(ctx context.Context, opts ...grpc.CallOption) (*Stream, error) {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(ContentSubtype)}, opts...)
+
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[0], sendMetricsMethod, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem opening stream")
+	}
+
+	return &Stream{stream: stream}, nil
+}
+
+// Stream is a client stream of documents to the service. Streams are
+// not safe for concurrent use.
+type Stream struct {
+	stream grpc.ClientStream
+}
+
+// Send sends a document to the server. The document may be anything
+// that a collector accepts: a *bsonx.Document, a value that implements
+// bson.Marshaler, raw BSON bytes, or a struct that the driver's bson
+// package can marshal.
+//
+// Errors from the collector on the server are not returned by Send,
+// but by CloseAndRecv. If the server has already ended the stream,
+// Send returns io.EOF, and CloseAndRecv returns the server's error.
+func (s *Stream) Send(doc interface{}) error {
+	if doc == nil {
+		return errors.New("cannot send a nil document")
+	}
+
+	return s.stream.SendMsg(doc)
+}
+
+// CloseAndRecv closes the stream, and waits for the server's summary
+// of the documents that it added to the collector.
+func (s *Stream) CloseAndRecv() (*Summary, error) {
+	if err := s.stream.CloseSend(); err != nil {
+		return nil, errors.Wrap(err, "problem closing stream")
+	}
+
+	out := &Summary{}
+	if err := s.stream.RecvMsg(out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
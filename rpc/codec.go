@@ -0,0 +1,51 @@
+//go:build grpc
+// +build grpc
+
+package rpc
+
+import (
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/grpc/encoding"
+)
+
+// ContentSubtype is the gRPC content subtype of the BSON codec that
+// the service uses for its messages.
+const ContentSubtype = "bson"
+
+func init() {
+	encoding.RegisterCodec(bsonCodec{})
+}
+
+// bsonCodec encodes values that implement the bson Marshaler and
+// Unmarshaler interfaces (e.g. bsonx documents) with those methods,
+// and all other values with the driver's bson package.
+type bsonCodec struct{}
+
+func (bsonCodec) Name() string { return ContentSubtype }
+
+func (bsonCodec) Marshal(v interface{}) ([]byte, error) {
+	switch msg := v.(type) {
+	case []byte:
+		return msg, nil
+	case bson.Marshaler:
+		data, err := msg.MarshalBSON()
+		return data, errors.Wrap(err, "problem marshaling message")
+	default:
+		data, err := bson.Marshal(msg)
+		return data, errors.Wrap(err, "problem marshaling message")
+	}
+}
+
+func (bsonCodec) Unmarshal(data []byte, v interface{}) error {
+	// gRPC may reuse the buffer once Unmarshal returns, and
+	// documents keep references to the data they're read from.
+	data = append([]byte(nil), data...)
+
+	switch msg := v.(type) {
+	case bson.Unmarshaler:
+		return errors.Wrap(msg.UnmarshalBSON(data), "problem unmarshaling message")
+	default:
+		return errors.Wrap(bson.Unmarshal(data, msg), "problem unmarshaling message")
+	}
+}
@@ -0,0 +1,14 @@
+// Package rpc provides a gRPC service for sending structured metrics
+// to a remote process, which adds them to an FTDC collector, so that
+// many processes can write their metrics through a single writer.
+//
+// The service has a single client-streaming method,
+// "/ftdc.Metrics/SendMetrics": clients stream BSON documents, and the
+// server responds with a Summary once the client closes the stream.
+// Messages use a BSON codec, registered with the "bson" content
+// subtype, rather than protocol buffers, so the service needs no
+// generated code.
+//
+// The service is only built with the grpc build tag, so that users of
+// the ftdc package do not need the gRPC dependency.
+package rpc
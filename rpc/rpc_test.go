@@ -0,0 +1,140 @@
+//go:build grpc
+// +build grpc
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type failingCollector struct {
+	ftdc.Collector
+	after int
+}
+
+func (c *failingCollector) Add(in interface{}) error {
+	if c.Info().SampleCount >= c.after {
+		return errors.New("collector is full")
+	}
+	return c.Collector.Add(in)
+}
+
+func startServer(t *testing.T, collector ftdc.Collector) *Client {
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	require.NoError(t, RegisterServer(srv, collector))
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return NewClient(conn)
+}
+
+func TestSendMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type sample struct {
+		Counter int64 `bson:"counter"`
+		Gauge   int64 `bson:"gauge"`
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		assert.Error(t, RegisterServer(nil, ftdc.NewBaseCollector(10)))
+		assert.Error(t, RegisterServer(grpc.NewServer(), nil))
+	})
+	t.Run("RoundTrip", func(t *testing.T) {
+		collector := ftdc.NewBaseCollector(100)
+		client := startServer(t, collector)
+
+		stream, err := client.SendMetrics(ctx)
+		require.NoError(t, err)
+		assert.Error(t, stream.Send(nil))
+		for i := int64(0); i < 10; i++ {
+			require.NoError(t, stream.Send(bsonx.NewDocument(bsonx.EC.Int64("counter", i), bsonx.EC.Int64("gauge", 2*i))))
+		}
+		for i := int64(10); i < 20; i++ {
+			require.NoError(t, stream.Send(sample{Counter: i, Gauge: 2 * i}))
+		}
+		summary, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		assert.EqualValues(t, 20, summary.Count)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, ftdc.FlushCollector(collector, buf))
+		iter := ftdc.ReadStructuredMetrics(ctx, buf)
+		defer iter.Close()
+		idx := int64(0)
+		for iter.Next() {
+			doc := iter.Document()
+			assert.Equal(t, idx, doc.Lookup("counter").Interface())
+			assert.Equal(t, 2*idx, doc.Lookup("gauge").Interface())
+			idx++
+		}
+		require.NoError(t, iter.Err())
+		assert.EqualValues(t, 20, idx)
+	})
+	t.Run("ConcurrentStreams", func(t *testing.T) {
+		collector := ftdc.NewBaseCollector(1000)
+		client := startServer(t, collector)
+
+		wg := &sync.WaitGroup{}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				stream, err := client.SendMetrics(ctx)
+				if !assert.NoError(t, err) {
+					return
+				}
+				for j := int64(0); j < 50; j++ {
+					assert.NoError(t, stream.Send(sample{Counter: j, Gauge: j}))
+				}
+				summary, err := stream.CloseAndRecv()
+				if assert.NoError(t, err) {
+					assert.EqualValues(t, 50, summary.Count)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 400, collector.Info().SampleCount)
+	})
+	t.Run("CollectorError", func(t *testing.T) {
+		collector := &failingCollector{Collector: ftdc.NewBaseCollector(100), after: 5}
+		client := startServer(t, collector)
+
+		stream, err := client.SendMetrics(ctx)
+		require.NoError(t, err)
+		for i := int64(0); i < 10; i++ {
+			if err = stream.Send(sample{Counter: i}); err != nil {
+				break
+			}
+		}
+		_, err = stream.CloseAndRecv()
+		require.Error(t, err)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Equal(t, 5, collector.Info().SampleCount)
+	})
+}
@@ -0,0 +1,102 @@
+//go:build grpc
+// +build grpc
+
+package rpc
+
+import (
+	"io"
+	"sync"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	serviceName       = "ftdc.Metrics"
+	sendMetricsMethod = "/" + serviceName + "/SendMetrics"
+)
+
+// Summary is the response to a SendMetrics stream.
+type Summary struct {
+	// Count is the number of documents that the server added to
+	// the collector.
+	Count int64 `bson:"count"`
+}
+
+// metricsServer is the handler type of the service, which gRPC
+// requires to be an interface.
+type metricsServer interface {
+	sendMetrics(grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*metricsServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SendMetrics",
+			Handler:       sendMetricsHandler,
+			ClientStreams: true,
+		},
+	},
+}
+
+func sendMetricsHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(metricsServer).sendMetrics(stream)
+}
+
+type server struct {
+	mu        sync.Mutex
+	collector ftdc.Collector
+}
+
+// RegisterServer registers the metrics service with a gRPC server. The
+// service adds every document that clients send to the collector, and
+// serializes calls to the collector, so that it's safe to use
+// collectors that are not safe for concurrent use with many clients.
+//
+// If the collector returns an error for a document, the server ends
+// the stream with an InvalidArgument error, and the client's
+// CloseAndRecv returns the error. Documents that the client sent
+// before the document that failed remain in the collector.
+func RegisterServer(srv *grpc.Server, collector ftdc.Collector) error {
+	if srv == nil {
+		return errors.New("must specify a gRPC server")
+	}
+	if collector == nil {
+		return errors.New("must specify a collector")
+	}
+
+	srv.RegisterService(&serviceDesc, &server{collector: collector})
+	return nil
+}
+
+func (s *server) sendMetrics(stream grpc.ServerStream) error {
+	out := &Summary{}
+	for {
+		doc := bsonx.NewDocument()
+		err := stream.RecvMsg(doc)
+		if err == io.EOF {
+			return stream.SendMsg(out)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = s.add(doc); err != nil {
+			return status.Errorf(codes.InvalidArgument, "problem adding document %d: %+v", out.Count, err)
+		}
+		out.Count++
+	}
+}
+
+func (s *server) add(doc *bsonx.Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.collector.Add(doc)
+}
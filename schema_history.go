@@ -0,0 +1,120 @@
+package ftdc
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// SchemaHash returns a hash of the flattened keys of the chunk's
+// metrics, in order. Chunks with the same keys have the same hash,
+// regardless of their values, and the hash is the same as the hashes
+// of the schemas that dynamic and schema tracking collectors compute
+// for the samples of the chunk, so that you can compare it to the
+// hashes of SchemaTransition.
+func (c *Chunk) SchemaHash() string {
+	checksum := fnv.New64()
+	for idx := 0; idx < len(c.Metrics); idx++ {
+		_, _ = checksum.Write([]byte("." + c.Metrics[idx].Key()))
+
+		// timestamps are stored as two metrics, but hashed
+		// as one key.
+		if c.Metrics[idx].originalType == bsontype.Timestamp {
+			idx++
+		}
+	}
+	return fmt.Sprintf("%x", checksum.Sum(nil))
+}
+
+// SchemaChange describes a change in the schema (i.e. the flattened
+// keys of the metrics) between consecutive chunks.
+type SchemaChange struct {
+	// Chunk is the index of the first chunk with the new schema,
+	// and Sample is the index of its first sample, counting from
+	// the first chunk of the iterator.
+	Chunk  int
+	Sample int64
+	// Time is the time of the first sample with the new schema,
+	// or the chunk's ID if the chunk has no date time metric.
+	Time time.Time
+	// PreviousHash and Hash are the schema hashes (see
+	// Chunk.SchemaHash) before and after the change.
+	PreviousHash string
+	Hash         string
+	// Added and Removed are the keys that the new schema has that
+	// the previous schema did not, and the reverse, in the order
+	// of the chunks. Both are empty if only the order of the keys
+	// changed.
+	Added   []string
+	Removed []string
+}
+
+// SchemaHistory reads all of the chunks of the iterator, and returns
+// the changes in their schemas, in order. The first change describes
+// the schema of the first chunk, with an empty PreviousHash, and all
+// of its keys added. Returns an error if there is a problem reading
+// the chunks; the iterator is not closed.
+func SchemaHistory(iter *ChunkIterator) ([]SchemaChange, error) {
+	out := []SchemaChange{}
+
+	var (
+		hash    string
+		keys    []string
+		samples int64
+	)
+	for count := 0; iter.Next(); count++ {
+		chunk := iter.Chunk()
+		chunkHash := chunk.SchemaHash()
+		if count > 0 && chunkHash == hash {
+			samples += int64(chunk.Size())
+			continue
+		}
+
+		chunkKeys := make([]string, len(chunk.Metrics))
+		for idx := range chunk.Metrics {
+			chunkKeys[idx] = chunk.Metrics[idx].Key()
+		}
+
+		change := SchemaChange{
+			Chunk:        count,
+			Sample:       samples,
+			Time:         chunk.id,
+			PreviousHash: hash,
+			Hash:         chunkHash,
+			Added:        keyDifference(chunkKeys, keys),
+			Removed:      keyDifference(keys, chunkKeys),
+		}
+		if times := chunk.sampleTimes(); len(times) > 0 {
+			change.Time = times[0]
+		}
+		out = append(out, change)
+
+		hash, keys = chunkHash, chunkKeys
+		samples += int64(chunk.Size())
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, errors.Wrap(err, "problem reading chunks")
+	}
+
+	return out, nil
+}
+
+// keyDifference returns the keys that are not in the other keys.
+func keyDifference(keys, other []string) []string {
+	seen := make(map[string]struct{}, len(other))
+	for _, key := range other {
+		seen[key] = struct{}{}
+	}
+
+	out := []string{}
+	for _, key := range keys {
+		if _, ok := seen[key]; !ok {
+			out = append(out, key)
+		}
+	}
+	return out
+}
@@ -0,0 +1,97 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaHistory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(i int, keys ...string) *bsonx.Document {
+		doc := bsonx.NewDocument(bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)))
+		for _, key := range keys {
+			doc.Append(bsonx.EC.Int64(key, int64(i)))
+		}
+		return doc
+	}
+
+	t.Run("SchemaHash", func(t *testing.T) {
+		doc := bsonx.NewDocument(
+			bsonx.EC.Time("ts", base),
+			bsonx.EC.SubDocumentFromElements("mem", bsonx.EC.Int64("resident", 1)),
+			bsonx.EC.Timestamp("optime", 1, 2),
+			bsonx.EC.Boolean("ok", true),
+		)
+		collector := NewBaseCollector(10)
+		require.NoError(t, collector.Add(doc))
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		expected, _ := metricKeyHash(doc)
+		assert.Equal(t, expected, iter.Chunk().SchemaHash(), "hashes match the hashes of collectors")
+	})
+	t.Run("Transitions", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		collector := NewStreamingSchemaTrackingCollector(4, buf)
+		for i := 0; i < 6; i++ {
+			require.NoError(t, collector.Add(sample(i, "a", "b")))
+		}
+		for i := 6; i < 9; i++ {
+			require.NoError(t, collector.Add(sample(i, "a", "c", "d")))
+		}
+		for i := 9; i < 11; i++ {
+			require.NoError(t, collector.Add(sample(i, "a", "b")))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		iter := ReadChunks(ctx, bytes.NewReader(buf.Bytes()))
+		defer iter.Close()
+		history, err := SchemaHistory(iter)
+		require.NoError(t, err)
+		require.Len(t, history, 3)
+
+		assert.Equal(t, 0, history[0].Chunk)
+		assert.Equal(t, "", history[0].PreviousHash)
+		assert.Equal(t, []string{"ts", "a", "b"}, history[0].Added)
+		assert.Empty(t, history[0].Removed)
+
+		assert.Equal(t, 2, history[1].Chunk)
+		assert.EqualValues(t, 6, history[1].Sample)
+		assert.True(t, base.Add(6*time.Second).Equal(history[1].Time))
+		assert.Equal(t, history[0].Hash, history[1].PreviousHash)
+		assert.Equal(t, []string{"c", "d"}, history[1].Added)
+		assert.Equal(t, []string{"b"}, history[1].Removed)
+
+		assert.Equal(t, 3, history[2].Chunk)
+		assert.EqualValues(t, 9, history[2].Sample)
+		assert.Equal(t, history[0].Hash, history[2].Hash)
+		assert.Equal(t, []string{"b"}, history[2].Added)
+		assert.Equal(t, []string{"c", "d"}, history[2].Removed)
+
+		// the hashes are the hashes that the collector records.
+		transitions := iter.SchemaTransitions()
+		require.Len(t, transitions, 2)
+		for idx, transition := range transitions {
+			assert.Equal(t, history[idx+1].PreviousHash, transition.PreviousHash)
+			assert.Equal(t, history[idx+1].Hash, transition.Hash)
+			assert.Equal(t, history[idx+1].Sample, transition.Sample)
+		}
+	})
+	t.Run("Empty", func(t *testing.T) {
+		history, err := SchemaHistory(ReadChunks(ctx, &bytes.Buffer{}))
+		require.NoError(t, err)
+		assert.Empty(t, history)
+	})
+}
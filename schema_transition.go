@@ -0,0 +1,59 @@
+package ftdc
+
+import (
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+)
+
+// The schema tracking collector writes a "schema" document in the
+// first chunk document after every change to the schema of the
+// collected documents, so that readers can relate the chunks on
+// either side of the change.
+const schemaTransitionField = "schema"
+
+// SchemaTransition describes a change in the schema (i.e. the set of
+// metric keys) of the documents written by a schema tracking
+// collector. Hashes identify schemas, and are only meaningful when
+// compared to other hashes produced by this package.
+type SchemaTransition struct {
+	// PreviousHash and Hash identify the schema before and after
+	// the change.
+	PreviousHash string
+	Hash         string
+	// Sample is the index, counting from the first sample added to
+	// the collector, of the first sample with the new schema.
+	Sample int64
+}
+
+func (t *SchemaTransition) document() *bsonx.Document {
+	return bsonx.NewDocument(
+		bsonx.EC.String("previous", t.PreviousHash),
+		bsonx.EC.String("hash", t.Hash),
+		bsonx.EC.Int64("sample", t.Sample),
+	)
+}
+
+func readSchemaTransition(doc *bsonx.Document) (*SchemaTransition, error) {
+	elem := doc.LookupElement(schemaTransitionField)
+	if elem == nil {
+		return nil, nil
+	}
+
+	sdoc, ok := elem.Value().MutableDocumentOK()
+	if !ok {
+		return nil, errors.New("schema transition field is not a document")
+	}
+
+	out := &SchemaTransition{}
+	if out.PreviousHash, ok = sdoc.Lookup("previous").StringValueOK(); !ok {
+		return nil, errors.New("schema transition has no previous hash")
+	}
+	if out.Hash, ok = sdoc.Lookup("hash").StringValueOK(); !ok {
+		return nil, errors.New("schema transition has no hash")
+	}
+	if out.Sample, ok = sdoc.Lookup("sample").Int64OK(); !ok {
+		return nil, errors.New("schema transition has no sample index")
+	}
+
+	return out, nil
+}
@@ -0,0 +1,111 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaTrackingCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sample := func(keys ...string) *bsonx.Document {
+		doc := bsonx.NewDocument()
+		for idx, key := range keys {
+			doc.Append(bsonx.EC.Int64(key, int64(idx)))
+		}
+		return doc
+	}
+
+	first, _ := metricKeyHash(sample("a", "b"))
+	second, _ := metricKeyHash(sample("a", "b", "c"))
+
+	readChunks := func(t *testing.T, buf *bytes.Buffer) ([]*Chunk, []SchemaTransition) {
+		iter := ReadChunks(ctx, buf)
+		defer iter.Close()
+
+		chunks := []*Chunk{}
+		for iter.Next() {
+			chunks = append(chunks, iter.Chunk())
+		}
+		require.NoError(t, iter.Err())
+		return chunks, iter.SchemaTransitions()
+	}
+
+	t.Run("Transitions", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		collector := NewStreamingSchemaTrackingCollector(4, buf)
+
+		// 6 samples with the first schema (one full chunk and
+		// a partial chunk), 3 with the second, then 2 more with
+		// the first schema.
+		for i := 0; i < 6; i++ {
+			require.NoError(t, collector.Add(sample("a", "b")))
+		}
+		for i := 0; i < 3; i++ {
+			require.NoError(t, collector.Add(sample("a", "b", "c")))
+		}
+		for i := 0; i < 2; i++ {
+			require.NoError(t, collector.Add(sample("a", "b")))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		chunks, transitions := readChunks(t, buf)
+		require.Len(t, chunks, 4)
+		assert.Equal(t, []int{4, 2, 3, 2}, []int{chunks[0].Size(), chunks[1].Size(), chunks[2].Size(), chunks[3].Size()})
+		assert.Nil(t, chunks[0].SchemaTransition())
+		assert.Nil(t, chunks[1].SchemaTransition())
+		require.NotNil(t, chunks[2].SchemaTransition())
+		require.NotNil(t, chunks[3].SchemaTransition())
+
+		assert.Equal(t, []SchemaTransition{
+			{PreviousHash: first, Hash: second, Sample: 6},
+			{PreviousHash: second, Hash: first, Sample: 9},
+		}, transitions)
+		assert.Equal(t, transitions[0], *chunks[2].SchemaTransition())
+	})
+	t.Run("TransitionAfterFlush", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		collector := NewStreamingSchemaTrackingCollector(10, buf)
+		require.NoError(t, collector.Add(sample("a", "b")))
+		require.NoError(t, FlushCollector(collector, buf))
+		require.NoError(t, collector.Add(sample("a", "b", "c")))
+		require.NoError(t, FlushCollector(collector, buf))
+
+		chunks, transitions := readChunks(t, buf)
+		require.Len(t, chunks, 2)
+		assert.Equal(t, []SchemaTransition{{PreviousHash: first, Hash: second, Sample: 1}}, transitions)
+	})
+	t.Run("DynamicCollector", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		collector := NewStreamingDynamicCollector(10, buf)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, collector.Add(sample("a", "b")))
+		}
+		for i := 0; i < 3; i++ {
+			require.NoError(t, collector.Add(sample("a", "b", "c")))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		chunks, transitions := readChunks(t, buf)
+		require.Len(t, chunks, 2)
+		assert.Equal(t, 3, chunks[1].Size())
+		assert.Empty(t, transitions)
+	})
+	t.Run("InvalidTransition", func(t *testing.T) {
+		_, err := readSchemaTransition(bsonx.NewDocument(bsonx.EC.String(schemaTransitionField, "foo")))
+		assert.Error(t, err)
+		_, err = readSchemaTransition(bsonx.NewDocument(bsonx.EC.SubDocumentFromElements(schemaTransitionField,
+			bsonx.EC.String("previous", first))))
+		assert.Error(t, err)
+
+		schema, err := readSchemaTransition(bsonx.NewDocument())
+		assert.NoError(t, err)
+		assert.Nil(t, schema)
+	})
+}
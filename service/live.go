@@ -0,0 +1,454 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/pkg/errors"
+)
+
+// Live samples
+//
+// The live endpoints stream samples to WebSocket clients as new chunks
+// arrive, either from the files in a directory (see NewHandler), or
+// from a running collector (see Publisher).
+
+// chunkSource sends chunks to the channel as they arrive, until the
+// context is canceled or no more chunks will arrive.
+type chunkSource func(ctx context.Context, out chan<- *ftdc.Chunk) error
+
+// websocket close status codes.
+const (
+	closeGoingAway  = 1001
+	closeInternal   = 1011
+	maxCloseMessage = 123
+)
+
+func parseLiveQuery(r *http.Request) (*query, time.Duration, error) {
+	values := r.URL.Query()
+	q := &query{keys: parseKeys(values)}
+
+	var interval time.Duration
+	if value := values.Get("interval"); value != "" {
+		var err error
+		if interval, err = time.ParseDuration(value); err != nil {
+			return nil, 0, errors.Wrap(err, "invalid interval")
+		}
+		if interval < 0 {
+			return nil, 0, errors.New("interval must not be negative")
+		}
+	}
+
+	return q, interval, nil
+}
+
+func serveLive(w http.ResponseWriter, r *http.Request, source chunkSource) {
+	q, interval, err := parseLiveQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	conn, err := upgradeWebsocket(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		// the client has closed the connection, or the connection
+		// has failed.
+		_ = conn.readLoop()
+		cancel()
+	}()
+
+	chunks := make(chan *ftdc.Chunk)
+	errs := make(chan error, 1)
+	go func() { errs <- source(ctx, chunks) }()
+
+	sampler := &downsampler{interval: interval}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err = <-errs:
+			if err != nil {
+				_ = conn.writeClose(closeInternal, err.Error())
+			} else {
+				_ = conn.writeClose(closeGoingAway, "")
+			}
+			return
+		case chunk := <-chunks:
+			msg, err := encodeLiveChunk(chunk, q, sampler)
+			if err != nil {
+				_ = conn.writeClose(closeInternal, err.Error())
+				return
+			}
+			if msg == nil {
+				continue
+			}
+			if err = conn.writeMessage(opText, msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *websocketConn) writeClose(code uint16, reason string) error {
+	if len(reason) > maxCloseMessage {
+		reason = reason[:maxCloseMessage]
+	}
+
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	payload = append(payload, reason...)
+
+	return errors.WithStack(c.writeMessage(opClose, payload))
+}
+
+// downsampler drops samples that are less than the interval after the
+// last sample that was kept.
+type downsampler struct {
+	interval time.Duration
+	last     time.Time
+}
+
+func (d *downsampler) keep(ts time.Time) bool {
+	if d.interval == 0 || d.last.IsZero() || !ts.Before(d.last.Add(d.interval)) {
+		d.last = ts
+		return true
+	}
+	return false
+}
+
+// encodeLiveChunk returns the message for a chunk, or nil if no
+// samples of the chunk are selected.
+func encodeLiveChunk(chunk *ftdc.Chunk, q *query, sampler *downsampler) ([]byte, error) {
+	metrics := []*ftdc.Metric{}
+	keys := []string{}
+	for idx := range chunk.Metrics {
+		metric := &chunk.Metrics[idx]
+		if key := metric.Key(); q.includes(key) {
+			metrics = append(metrics, metric)
+			keys = append(keys, key)
+		}
+	}
+	if len(metrics) == 0 {
+		return nil, nil
+	}
+
+	times := sampleTimes(chunk)
+	buf := &bytes.Buffer{}
+	writer, err := newSampleWriter("json", buf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	values := make([]interface{}, len(metrics))
+	count := 0
+	for i := 0; i < chunk.Size(); i++ {
+		if times != nil && !sampler.keep(times[i]) {
+			continue
+		}
+		for idx, metric := range metrics {
+			values[idx] = sampleValue(metric, i)
+		}
+		if err = writer.writeSample(keys, values); err != nil {
+			return nil, errors.Wrap(err, "problem writing sample")
+		}
+		count++
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	if err = writer.close(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// completeDocuments returns the length of the longest prefix of the
+// data that holds only complete BSON documents.
+func completeDocuments(data []byte) (int, error) {
+	n := 0
+	for len(data)-n >= 4 {
+		size := int(int32(binary.LittleEndian.Uint32(data[n:])))
+		if size < 5 {
+			return n, errors.Errorf("invalid document size %d", size)
+		}
+		if len(data)-n < size {
+			break
+		}
+		n += size
+	}
+
+	return n, nil
+}
+
+// decodeChunks returns the chunks in FTDC data that holds only
+// complete documents.
+func decodeChunks(data []byte) ([]*ftdc.Chunk, error) {
+	iter := ftdc.ReadChunks(context.Background(), bytes.NewReader(data))
+	defer iter.Close()
+
+	out := []*ftdc.Chunk{}
+	for iter.Next() {
+		out = append(out, iter.Chunk())
+	}
+
+	return out, errors.WithStack(iter.Err())
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// directories
+
+func (h *handler) streamLive(w http.ResponseWriter, r *http.Request) {
+	serveLive(w, r, h.tail)
+}
+
+// tail polls the directory for data appended to its files, or written
+// to new files, after tail is called, and sends the chunks in the new
+// data. Files are expected to only grow, or to be replaced by new
+// files: files that shrink are read again from the beginning.
+func (h *handler) tail(ctx context.Context, out chan<- *ftdc.Chunk) error {
+	files, err := h.files()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	offsets := make(map[string]int64, len(files))
+	for _, info := range files {
+		offsets[info.Name()] = info.Size()
+	}
+
+	ticker := time.NewTicker(h.opts.pollInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if files, err = h.files(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, info := range files {
+			name := info.Name()
+			offset := offsets[name]
+			if info.Size() < offset {
+				offset = 0
+			}
+			if info.Size() == offset {
+				continue
+			}
+
+			data, err := readRange(filepath.Join(h.opts.Directory, name), offset, info.Size())
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			n, err := completeDocuments(data)
+			if err != nil {
+				return errors.Wrapf(err, "problem reading '%s'", name)
+			}
+			chunks, err := decodeChunks(data[:n])
+			if err != nil {
+				return errors.Wrapf(err, "problem reading '%s'", name)
+			}
+			offsets[name] = offset + int64(n)
+
+			for _, chunk := range chunks {
+				select {
+				case out <- chunk:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func readRange(path string, start, end int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening '%s'", path)
+	}
+	defer f.Close()
+
+	data := make([]byte, end-start)
+	if _, err = f.ReadAt(data, start); err != nil && err != io.EOF {
+		return nil, errors.Wrapf(err, "problem reading '%s'", path)
+	}
+
+	return data, nil
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// collectors
+
+// Publisher is an http.Handler that streams the samples in the FTDC
+// data written to the publisher to WebSocket clients. Use a publisher
+// as the output of a streaming collector, alone or with an
+// io.MultiWriter, to serve the samples of a running collector.
+//
+// Each chunk is sent as a text message holding a JSON array of its
+// samples, in the same format as the samples endpoint of NewHandler,
+// and chunks that have no samples after filtering are not sent.
+// Clients may specify the following query parameters:
+//
+//	keys      limits the samples to the specified metrics, as for
+//	          the samples endpoint.
+//	interval  downsamples the samples, so that consecutive samples
+//	          are at least the specified duration (e.g. "10s") apart.
+//	          Samples in chunks without a date time metric are
+//	          never dropped.
+//
+// If the data cannot be read, the server closes the connection with
+// the error as the reason.
+//
+// Publishers never block writers: clients that do not keep up with
+// the data written to the publisher miss chunks.
+type Publisher struct {
+	mu          sync.Mutex
+	buf         []byte
+	subscribers map[chan *ftdc.Chunk]struct{}
+	closed      bool
+}
+
+// subscriberBuffer is the number of chunks that the publisher holds
+// for each client.
+const subscriberBuffer = 16
+
+// NewPublisher returns a publisher with no clients.
+func NewPublisher() *Publisher {
+	return &Publisher{subscribers: map[chan *ftdc.Chunk]struct{}{}}
+}
+
+// Write adds FTDC data to the publisher, and sends the chunks in the
+// data to the clients. Documents may be split across writes.
+func (p *Publisher) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return 0, errors.New("publisher is closed")
+	}
+
+	p.buf = append(p.buf, data...)
+	n, err := completeDocuments(p.buf)
+	if err != nil {
+		p.buf = nil
+		return 0, errors.WithStack(err)
+	}
+	if n == 0 {
+		return len(data), nil
+	}
+
+	chunks, err := decodeChunks(p.buf[:n])
+	p.buf = append(p.buf[:0], p.buf[n:]...)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	for _, chunk := range chunks {
+		for sub := range p.subscribers {
+			select {
+			case sub <- chunk:
+			default:
+			}
+		}
+	}
+
+	return len(data), nil
+}
+
+// Close disconnects all clients, and rejects further writes and
+// connections.
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.closed {
+		p.closed = true
+		for sub := range p.subscribers {
+			close(sub)
+			delete(p.subscribers, sub)
+		}
+	}
+
+	return nil
+}
+
+func (p *Publisher) subscribe() (chan *ftdc.Chunk, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, errors.New("publisher is closed")
+	}
+
+	sub := make(chan *ftdc.Chunk, subscriberBuffer)
+	p.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+func (p *Publisher) unsubscribe(sub chan *ftdc.Chunk) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.subscribers[sub]; ok {
+		delete(p.subscribers, sub)
+		close(sub)
+	}
+}
+
+func (p *Publisher) chunks(ctx context.Context, out chan<- *ftdc.Chunk) error {
+	sub, err := p.subscribe()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer p.unsubscribe(sub)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case chunk, ok := <-sub:
+			if !ok {
+				return nil
+			}
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// ServeHTTP upgrades GET requests to WebSocket connections, and
+// streams samples to the clients until the client disconnects or the
+// publisher is closed.
+func (p *Publisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	serveLive(w, r, p.chunks)
+}
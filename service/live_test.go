@@ -0,0 +1,294 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClient is a minimal websocket client.
+type testClient struct {
+	conn net.Conn
+	buf  *bufio.Reader
+}
+
+func dialTestClient(t *testing.T, server *httptest.Server, path string) *testClient {
+	addr, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", addr.Host)
+	require.NoError(t, err)
+	require.NoError(t, conn.SetDeadline(time.Now().Add(10*time.Second)))
+
+	nonce := make([]byte, 16)
+	_, err = rand.Read(nonce)
+	require.NoError(t, err)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	require.NoError(t, req.Write(conn))
+
+	buf := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(buf, req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	require.Equal(t, websocketAccept(key), resp.Header.Get("Sec-WebSocket-Accept"))
+
+	return &testClient{conn: conn, buf: buf}
+}
+
+func (c *testClient) write(t *testing.T, opcode byte, payload []byte) {
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for idx, b := range payload {
+		frame = append(frame, b^mask[idx%4])
+	}
+	_, err := c.conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func (c *testClient) read(t *testing.T) (byte, []byte) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(c.buf, header)
+	require.NoError(t, err)
+	require.Zero(t, header[1]&0x80, "server frames must not be masked")
+
+	size := uint64(header[1] & 0x7F)
+	switch size {
+	case 126:
+		ext := make([]byte, 2)
+		_, err = io.ReadFull(c.buf, ext)
+		require.NoError(t, err)
+		size = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		_, err = io.ReadFull(c.buf, ext)
+		require.NoError(t, err)
+		size = binary.BigEndian.Uint64(ext)
+	}
+
+	payload := make([]byte, size)
+	_, err = io.ReadFull(c.buf, payload)
+	require.NoError(t, err)
+	return header[0] & 0x0F, payload
+}
+
+func (c *testClient) readSamples(t *testing.T) []map[string]interface{} {
+	opcode, payload := c.read(t)
+	require.Equal(t, byte(opText), opcode, string(payload))
+
+	out := []map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(payload, &out))
+	return out
+}
+
+func writeLiveChunk(t *testing.T, w io.Writer, base time.Time, start, num int) {
+	collector := ftdc.NewStreamingCollector(num, w)
+	for i := start; i < start+num; i++ {
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.SubDocument("ops", bsonx.NewDocument(
+				bsonx.EC.Int64("insert", int64(i)),
+				bsonx.EC.Int64("query", int64(2*i)),
+			)),
+		)))
+	}
+	require.NoError(t, ftdc.FlushCollector(collector, w))
+}
+
+func waitForSubscribers(t *testing.T, p *Publisher, n int) {
+	for i := 0; i < 1000; i++ {
+		p.mu.Lock()
+		count := len(p.subscribers)
+		p.mu.Unlock()
+		if count == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.FailNow(t, "clients did not connect")
+}
+
+func TestPublisher(t *testing.T) {
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Samples", func(t *testing.T) {
+		publisher := NewPublisher()
+		server := httptest.NewServer(publisher)
+		defer server.Close()
+
+		all := dialTestClient(t, server, "/")
+		defer all.conn.Close()
+		filtered := dialTestClient(t, server, "/?keys=ops.query&interval=5s")
+		defer filtered.conn.Close()
+		waitForSubscribers(t, publisher, 2)
+
+		writeLiveChunk(t, publisher, base, 0, 10)
+
+		samples := all.readSamples(t)
+		require.Len(t, samples, 10)
+		assert.Equal(t, base.Add(3*time.Second).Format(time.RFC3339), samples[3]["ts"])
+		assert.EqualValues(t, 3, samples[3]["ops.insert"])
+		assert.EqualValues(t, 6, samples[3]["ops.query"])
+
+		samples = filtered.readSamples(t)
+		require.Len(t, samples, 2)
+		assert.Equal(t, []map[string]interface{}{{"ops.query": 0.0}, {"ops.query": 10.0}}, samples)
+
+		// downsampling continues across chunks.
+		writeLiveChunk(t, publisher, base, 10, 10)
+		samples = filtered.readSamples(t)
+		require.Len(t, samples, 2)
+		assert.EqualValues(t, 20, samples[0]["ops.query"])
+		assert.EqualValues(t, 30, samples[1]["ops.query"])
+	})
+	t.Run("PartialWrites", func(t *testing.T) {
+		publisher := NewPublisher()
+		server := httptest.NewServer(publisher)
+		defer server.Close()
+
+		client := dialTestClient(t, server, "/")
+		defer client.conn.Close()
+		waitForSubscribers(t, publisher, 1)
+
+		buf := &bytes.Buffer{}
+		writeLiveChunk(t, buf, base, 0, 5)
+		data := buf.Bytes()
+		for idx := range data {
+			n, err := publisher.Write(data[idx : idx+1])
+			require.NoError(t, err)
+			require.Equal(t, 1, n)
+		}
+
+		assert.Len(t, client.readSamples(t), 5)
+	})
+	t.Run("ControlMessages", func(t *testing.T) {
+		publisher := NewPublisher()
+		server := httptest.NewServer(publisher)
+		defer server.Close()
+
+		client := dialTestClient(t, server, "/")
+		defer client.conn.Close()
+		waitForSubscribers(t, publisher, 1)
+
+		client.write(t, opPing, []byte("hello"))
+		opcode, payload := client.read(t)
+		assert.Equal(t, byte(opPong), opcode)
+		assert.Equal(t, "hello", string(payload))
+
+		client.write(t, opClose, []byte{0x03, 0xE8})
+		opcode, payload = client.read(t)
+		assert.Equal(t, byte(opClose), opcode)
+		assert.Equal(t, []byte{0x03, 0xE8}, payload)
+		waitForSubscribers(t, publisher, 0)
+	})
+	t.Run("Close", func(t *testing.T) {
+		publisher := NewPublisher()
+		server := httptest.NewServer(publisher)
+		defer server.Close()
+
+		client := dialTestClient(t, server, "/")
+		defer client.conn.Close()
+		waitForSubscribers(t, publisher, 1)
+
+		require.NoError(t, publisher.Close())
+		opcode, payload := client.read(t)
+		assert.Equal(t, byte(opClose), opcode)
+		assert.EqualValues(t, closeGoingAway, binary.BigEndian.Uint16(payload))
+
+		_, err := publisher.Write([]byte{})
+		assert.Error(t, err)
+	})
+	t.Run("InvalidData", func(t *testing.T) {
+		publisher := NewPublisher()
+		_, err := publisher.Write([]byte{1, 0, 0, 0})
+		assert.Error(t, err)
+	})
+	t.Run("InvalidRequests", func(t *testing.T) {
+		publisher := NewPublisher()
+
+		rec := httptest.NewRecorder()
+		publisher.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusUpgradeRequired, rec.Code)
+
+		rec = httptest.NewRecorder()
+		publisher.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?interval=soon", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = httptest.NewRecorder()
+		publisher.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+}
+
+func TestLiveDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftdc-service-live")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	buf := &bytes.Buffer{}
+	writeLiveChunk(t, buf, base, 0, 5)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "metrics.1"), buf.Bytes(), 0644))
+
+	handler, err := NewHandler(Options{Directory: dir, PollInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := dialTestClient(t, server, "/live?keys=ops.insert")
+	defer client.conn.Close()
+
+	// give the handler time to record the existing data, which is
+	// not sent.
+	time.Sleep(100 * time.Millisecond)
+
+	// append a chunk in two writes, to the existing file, and then
+	// add a new file.
+	buf.Reset()
+	writeLiveChunk(t, buf, base, 5, 5)
+	f, err := os.OpenFile(filepath.Join(dir, "metrics.1"), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.Write(buf.Bytes()[:10])
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = f.Write(buf.Bytes()[10:])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	samples := client.readSamples(t)
+	require.Len(t, samples, 5)
+	assert.Equal(t, map[string]interface{}{"ops.insert": 5.0}, samples[0])
+
+	buf.Reset()
+	writeLiveChunk(t, buf, base, 10, 3)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "metrics.2"), buf.Bytes(), 0644))
+
+	samples = client.readSamples(t)
+	require.Len(t, samples, 3)
+	assert.Equal(t, map[string]interface{}{"ops.insert": 10.0}, samples[0])
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// sampleWriter writes the samples of chunks in one of the supported
+// output formats.
+type sampleWriter interface {
+	contentType() string
+	writeSample(keys []string, values []interface{}) error
+	close() error
+}
+
+func newSampleWriter(format string, w io.Writer) (sampleWriter, error) {
+	switch format {
+	case "", "json":
+		return &jsonSampleWriter{buf: bufio.NewWriter(w), array: true}, nil
+	case "ndjson":
+		return &jsonSampleWriter{buf: bufio.NewWriter(w)}, nil
+	case "csv":
+		return &csvSampleWriter{csv: csv.NewWriter(w)}, nil
+	default:
+		return nil, errors.Errorf("unsupported format '%s'", format)
+	}
+}
+
+func (h *handler) streamSamples(w http.ResponseWriter, r *http.Request) {
+	q, err := h.parseQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// the status is only sent with the first sample, so that errors
+	// that occur before any data is written are reported as errors.
+	out := &deferredWriter{w: w}
+	writer, err := newSampleWriter(r.URL.Query().Get("format"), out)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", writer.contentType())
+
+	err = h.eachChunk(r.Context(), q, func(_ string, _ int, chunk *ftdc.Chunk) error {
+		metrics := []*ftdc.Metric{}
+		keys := []string{}
+		for idx := range chunk.Metrics {
+			metric := &chunk.Metrics[idx]
+			if key := metric.Key(); q.includes(key) {
+				metrics = append(metrics, metric)
+				keys = append(keys, key)
+			}
+		}
+		if len(metrics) == 0 {
+			return nil
+		}
+
+		values := make([]interface{}, len(metrics))
+		for i := 0; i < chunk.Size(); i++ {
+			for idx, metric := range metrics {
+				values[idx] = sampleValue(metric, i)
+			}
+			if err := writer.writeSample(keys, values); err != nil {
+				return errors.Wrap(err, "problem writing sample")
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = writer.close()
+	}
+
+	if err != nil && !out.started {
+		w.Header().Del("Content-Type")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// sampleValue returns the value of a metric for a sample, as a type
+// that encodes naturally in JSON and CSV.
+func sampleValue(metric *ftdc.Metric, idx int) interface{} {
+	value := metric.Values[idx]
+	switch metric.Type() {
+	case bsontype.Double:
+		f := math.Float64frombits(uint64(value))
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil
+		}
+		return f
+	case bsontype.Boolean:
+		return value != 0
+	case bsontype.DateTime:
+		return epochMs(value)
+	default:
+		return value
+	}
+}
+
+// deferredWriter records whether any data has been written to the
+// response.
+type deferredWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (w *deferredWriter) Write(p []byte) (int, error) {
+	w.started = true
+	return w.w.Write(p)
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// json and newline-delimited json
+
+type jsonSampleWriter struct {
+	buf   *bufio.Writer
+	array bool
+	count int
+}
+
+func (w *jsonSampleWriter) contentType() string {
+	if w.array {
+		return "application/json"
+	}
+	return "application/x-ndjson"
+}
+
+func (w *jsonSampleWriter) writeSample(keys []string, values []interface{}) error {
+	if w.array {
+		if w.count == 0 {
+			_ = w.buf.WriteByte('[')
+		} else {
+			_ = w.buf.WriteByte(',')
+		}
+	}
+	w.count++
+
+	// documents are written by hand to preserve the order of the
+	// keys.
+	_ = w.buf.WriteByte('{')
+	for idx, key := range keys {
+		if idx > 0 {
+			_ = w.buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		v, err := json.Marshal(values[idx])
+		if err != nil {
+			return errors.Wrapf(err, "problem encoding '%s'", key)
+		}
+		_, _ = w.buf.Write(k)
+		_ = w.buf.WriteByte(':')
+		_, _ = w.buf.Write(v)
+	}
+	_ = w.buf.WriteByte('}')
+
+	if !w.array {
+		_ = w.buf.WriteByte('\n')
+	}
+
+	if w.buf.Buffered() > 32*1024 {
+		return errors.WithStack(w.buf.Flush())
+	}
+	return nil
+}
+
+func (w *jsonSampleWriter) close() error {
+	if w.array {
+		if w.count == 0 {
+			_ = w.buf.WriteByte('[')
+		}
+		_, _ = w.buf.WriteString("]\n")
+	}
+
+	return errors.WithStack(w.buf.Flush())
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// csv
+
+// csvSampleWriter writes a header row before the first sample, and
+// again whenever the keys of the samples change.
+type csvSampleWriter struct {
+	csv    *csv.Writer
+	keys   []string
+	record []string
+}
+
+func (w *csvSampleWriter) contentType() string { return "text/csv" }
+
+func (w *csvSampleWriter) writeSample(keys []string, values []interface{}) error {
+	if !equalKeys(w.keys, keys) {
+		w.keys = append(w.keys[:0], keys...)
+		if err := w.csv.Write(w.keys); err != nil {
+			return errors.Wrap(err, "problem writing header")
+		}
+	}
+
+	w.record = w.record[:0]
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			w.record = append(w.record, "")
+		case int64:
+			w.record = append(w.record, strconv.FormatInt(v, 10))
+		case float64:
+			w.record = append(w.record, strconv.FormatFloat(v, 'g', -1, 64))
+		case bool:
+			w.record = append(w.record, strconv.FormatBool(v))
+		case time.Time:
+			w.record = append(w.record, v.Format(time.RFC3339Nano))
+		}
+	}
+
+	return errors.WithStack(w.csv.Write(w.record))
+}
+
+func (w *csvSampleWriter) close() error {
+	w.csv.Flush()
+	return errors.WithStack(w.csv.Error())
+}
+
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,410 @@
+// Package service provides an HTTP interface for reading the FTDC
+// files in a directory: listing files, chunks and metrics, and
+// streaming samples as JSON, newline-delimited JSON, or CSV.
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// Options configure the handler returned by NewHandler.
+type Options struct {
+	// Directory holds the FTDC files served by the handler. Every
+	// regular file in the directory is treated as an FTDC file.
+	Directory string
+	// PollInterval is how often the live endpoint checks the
+	// directory for new data. Defaults to one second.
+	PollInterval time.Duration
+}
+
+func (opts Options) pollInterval() time.Duration {
+	if opts.PollInterval == 0 {
+		return time.Second
+	}
+	return opts.PollInterval
+}
+
+// Validate checks the options, returning an error if the directory
+// does not exist, or the poll interval is negative.
+func (opts Options) Validate() error {
+	if opts.Directory == "" {
+		return errors.New("must specify a directory")
+	}
+	if opts.PollInterval < 0 {
+		return errors.New("poll interval must not be negative")
+	}
+
+	info, err := os.Stat(opts.Directory)
+	if err != nil {
+		return errors.Wrapf(err, "problem finding directory '%s'", opts.Directory)
+	}
+	if !info.IsDir() {
+		return errors.Errorf("'%s' is not a directory", opts.Directory)
+	}
+
+	return nil
+}
+
+type handler struct {
+	opts Options
+	mux  *http.ServeMux
+}
+
+// NewHandler returns an http.Handler that serves the FTDC files in a
+// directory, with the following endpoints, which respond to GET
+// requests:
+//
+//	/files    lists the files in the directory.
+//	/chunks   lists the chunks in the files, with their time range,
+//	          and number of samples and metrics.
+//	/metrics  lists the keys and types of the metrics in the files.
+//	/samples  streams the samples in the files. The format parameter
+//	          selects "json" (the default), "ndjson", or "csv".
+//	/live     upgrades the request to a WebSocket connection, and
+//	          streams the samples in data written to the files after
+//	          the connection opens (see Publisher for the format.)
+//
+// The chunks, metrics, and samples endpoints accept the following
+// query parameters:
+//
+//	file   limits the output to one file, by name. By default, all
+//	       files are read, in name order.
+//	start  and end limit the output to samples collected in the
+//	       [start, end) time range, as RFC 3339 times.
+//	keys   limits the output to metrics with the specified keys,
+//	       or whose keys begin with the specified keys followed by
+//	       a ".", as a comma separated list.
+//
+// Samples include the values of the metrics in each sample, with
+// date time values as RFC 3339 times, and double values as numbers.
+func NewHandler(opts Options) (http.Handler, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	h := &handler{
+		opts: opts,
+		mux:  http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/files", h.listFiles)
+	h.mux.HandleFunc("/chunks", h.listChunks)
+	h.mux.HandleFunc("/metrics", h.listMetrics)
+	h.mux.HandleFunc("/samples", h.streamSamples)
+	h.mux.HandleFunc("/live", h.streamLive)
+
+	return h, nil
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// query parameters
+
+type query struct {
+	files []string
+	start time.Time
+	end   time.Time
+	keys  []string
+}
+
+// errNotFound is returned when the file parameter names a file that
+// is not in the directory.
+var errNotFound = errors.New("file not found")
+
+func (h *handler) parseQuery(r *http.Request) (*query, error) {
+	values := r.URL.Query()
+	q := &query{}
+
+	var err error
+	if start := values.Get("start"); start != "" {
+		if q.start, err = time.Parse(time.RFC3339Nano, start); err != nil {
+			return nil, errors.Wrap(err, "invalid start time")
+		}
+	}
+	if end := values.Get("end"); end != "" {
+		if q.end, err = time.Parse(time.RFC3339Nano, end); err != nil {
+			return nil, errors.Wrap(err, "invalid end time")
+		}
+	}
+	if !q.start.IsZero() && !q.end.IsZero() && !q.start.Before(q.end) {
+		return nil, errors.New("start time must be before end time")
+	}
+
+	q.keys = parseKeys(values)
+
+	files, err := h.files()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if name := values.Get("file"); name != "" {
+		for _, info := range files {
+			if info.Name() == name {
+				q.files = []string{name}
+				break
+			}
+		}
+		if q.files == nil {
+			return nil, errNotFound
+		}
+	} else {
+		for _, info := range files {
+			q.files = append(q.files, info.Name())
+		}
+	}
+
+	return q, nil
+}
+
+// parseKeys returns the metric keys in the keys parameters.
+func parseKeys(values url.Values) []string {
+	out := []string{}
+	for _, keys := range values["keys"] {
+		for _, key := range strings.Split(keys, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				out = append(out, key)
+			}
+		}
+	}
+	return out
+}
+
+// includes reports whether the metric key is selected by the keys
+// parameter of the query.
+func (q *query) includes(key string) bool {
+	if len(q.keys) == 0 {
+		return true
+	}
+
+	for _, k := range q.keys {
+		if key == k || strings.HasPrefix(key, k+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// files returns the regular files in the directory, sorted by name.
+func (h *handler) files() ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(h.opts.Directory)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem reading directory")
+	}
+
+	out := make([]os.FileInfo, 0, len(infos))
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			out = append(out, info)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+
+	return out, nil
+}
+
+// eachChunk calls the function with every chunk in the files selected
+// by the query, trimmed to the time range of the query.
+func (h *handler) eachChunk(ctx context.Context, q *query, fn func(string, int, *ftdc.Chunk) error) error {
+	for _, name := range q.files {
+		f, err := os.Open(filepath.Join(h.opts.Directory, name))
+		if err != nil {
+			return errors.Wrapf(err, "problem opening '%s'", name)
+		}
+
+		iter := ftdc.NewChunkIteratorWithRange(ctx, f, q.start, q.end)
+		idx := 0
+		for iter.Next() {
+			if err = fn(name, idx, iter.Chunk()); err != nil {
+				break
+			}
+			idx++
+		}
+		iter.Close()
+		if err == nil {
+			err = errors.Wrapf(iter.Err(), "problem reading '%s'", name)
+		}
+		f.Close()
+
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// endpoints
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch errors.Cause(err) {
+	case errNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// FileInfo describes a file served by the handler.
+type FileInfo struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+func (h *handler) listFiles(w http.ResponseWriter, r *http.Request) {
+	files, err := h.files()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]FileInfo, len(files))
+	for idx, info := range files {
+		out[idx] = FileInfo{
+			Name:     info.Name(),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		}
+	}
+
+	writeJSON(w, out)
+}
+
+// ChunkInfo describes a chunk in a file served by the handler. The
+// start and end times are the times of the first and last samples,
+// and are omitted for chunks without a date time metric.
+type ChunkInfo struct {
+	File    string     `json:"file"`
+	Index   int        `json:"index"`
+	Start   *time.Time `json:"start,omitempty"`
+	End     *time.Time `json:"end,omitempty"`
+	Samples int        `json:"samples"`
+	Metrics int        `json:"metrics"`
+}
+
+func (h *handler) listChunks(w http.ResponseWriter, r *http.Request) {
+	q, err := h.parseQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	out := []ChunkInfo{}
+	err = h.eachChunk(r.Context(), q, func(name string, idx int, chunk *ftdc.Chunk) error {
+		info := ChunkInfo{
+			File:    name,
+			Index:   idx,
+			Samples: chunk.Size(),
+		}
+		for _, metric := range chunk.Metrics {
+			if q.includes(metric.Key()) {
+				info.Metrics++
+			}
+		}
+		if times := sampleTimes(chunk); len(times) > 0 {
+			info.Start, info.End = &times[0], &times[len(times)-1]
+		}
+		out = append(out, info)
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, out)
+}
+
+// MetricInfo describes a metric in the files served by the handler.
+type MetricInfo struct {
+	Key     string `json:"key"`
+	Type    string `json:"type"`
+	Samples int    `json:"samples"`
+}
+
+func (h *handler) listMetrics(w http.ResponseWriter, r *http.Request) {
+	q, err := h.parseQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	out := []*MetricInfo{}
+	seen := map[string]*MetricInfo{}
+	err = h.eachChunk(r.Context(), q, func(_ string, _ int, chunk *ftdc.Chunk) error {
+		for idx := range chunk.Metrics {
+			metric := &chunk.Metrics[idx]
+			key := metric.Key()
+			if !q.includes(key) {
+				continue
+			}
+
+			info, ok := seen[key]
+			if !ok {
+				info = &MetricInfo{Key: key, Type: metric.Type().String()}
+				seen[key] = info
+				out = append(out, info)
+			}
+			info.Samples += len(metric.Values)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, out)
+}
+
+// sampleTimes returns the times of the samples in the chunk, from its
+// first date time metric.
+func sampleTimes(chunk *ftdc.Chunk) []time.Time {
+	for idx := range chunk.Metrics {
+		metric := &chunk.Metrics[idx]
+		if metric.Type() != bsontype.DateTime {
+			continue
+		}
+
+		out := make([]time.Time, len(metric.Values))
+		for i, v := range metric.Values {
+			out[i] = epochMs(v)
+		}
+		return out
+	}
+
+	return nil
+}
+
+func epochMs(v int64) time.Time { return time.Unix(v/1000, v%1000*int64(time.Millisecond)).UTC() }
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftdc-service")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	// flush writes the chunk with the time of its first sample as
+	// its _id, as mongod does, rather than the time of the test.
+	flush := func(collector ftdc.Collector, buf *bytes.Buffer, first int) {
+		payload, err := collector.Resolve()
+		require.NoError(t, err)
+		doc, err := bsonx.ReadDocument(payload)
+		require.NoError(t, err)
+		_, err = doc.Set(bsonx.EC.Time("_id", base.Add(time.Duration(first)*time.Second))).WriteTo(buf)
+		require.NoError(t, err)
+		collector.Reset()
+	}
+	writeFile := func(name string, start, num int, extra bool) {
+		buf := &bytes.Buffer{}
+		collector := ftdc.NewBaseCollector(10)
+		for i := start; i < start+num; i++ {
+			doc := bsonx.NewDocument(
+				bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+				bsonx.EC.SubDocument("ops", bsonx.NewDocument(
+					bsonx.EC.Int64("insert", int64(i)),
+					bsonx.EC.Int64("query", int64(2*i)),
+				)),
+				bsonx.EC.Boolean("up", true),
+			)
+			if extra {
+				doc.Append(bsonx.EC.Int32("extra", int32(i)))
+			}
+			require.NoError(t, collector.Add(doc))
+			if collector.Info().SampleCount == 10 {
+				flush(collector, buf, i-9)
+			}
+		}
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644))
+	}
+	writeFile("metrics.2", 20, 20, true)
+	writeFile("metrics.1", 0, 20, false)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0755))
+
+	handler, err := NewHandler(Options{Directory: dir})
+	require.NoError(t, err)
+
+	get := func(t *testing.T, url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	getJSON := func(t *testing.T, url string, out interface{}) {
+		rec := get(t, url)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), out))
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		_, err := NewHandler(Options{})
+		assert.Error(t, err)
+		_, err = NewHandler(Options{Directory: filepath.Join(dir, "missing")})
+		assert.Error(t, err)
+		_, err = NewHandler(Options{Directory: filepath.Join(dir, "metrics.1")})
+		assert.Error(t, err)
+	})
+	t.Run("Files", func(t *testing.T) {
+		files := []FileInfo{}
+		getJSON(t, "/files", &files)
+		require.Len(t, files, 2)
+		assert.Equal(t, "metrics.1", files[0].Name)
+		assert.Equal(t, "metrics.2", files[1].Name)
+		assert.True(t, files[0].Size > 0)
+	})
+	t.Run("Chunks", func(t *testing.T) {
+		chunks := []ChunkInfo{}
+		getJSON(t, "/chunks", &chunks)
+		require.Len(t, chunks, 4)
+		assert.Equal(t, "metrics.1", chunks[0].File)
+		assert.Equal(t, 1, chunks[1].Index)
+		assert.Equal(t, 10, chunks[0].Samples)
+		assert.Equal(t, 4, chunks[0].Metrics)
+		assert.Equal(t, 5, chunks[3].Metrics)
+		require.NotNil(t, chunks[0].Start)
+		assert.True(t, base.Equal(*chunks[0].Start))
+		assert.True(t, base.Add(9*time.Second).Equal(*chunks[0].End))
+
+		chunks = []ChunkInfo{}
+		getJSON(t, "/chunks?file=metrics.2&keys=ops", &chunks)
+		require.Len(t, chunks, 2)
+		assert.Equal(t, 2, chunks[0].Metrics)
+
+		chunks = []ChunkInfo{}
+		getJSON(t, "/chunks?start="+base.Add(15*time.Second).Format(time.RFC3339)+
+			"&end="+base.Add(25*time.Second).Format(time.RFC3339), &chunks)
+		require.Len(t, chunks, 2)
+		assert.Equal(t, 5, chunks[0].Samples)
+		assert.Equal(t, 5, chunks[1].Samples)
+	})
+	t.Run("Metrics", func(t *testing.T) {
+		metrics := []MetricInfo{}
+		getJSON(t, "/metrics", &metrics)
+		require.Len(t, metrics, 5)
+		assert.Equal(t, MetricInfo{Key: "ts", Type: "UTC datetime", Samples: 40}, metrics[0])
+		assert.Equal(t, "ops.insert", metrics[1].Key)
+		assert.Equal(t, MetricInfo{Key: "extra", Type: "32-bit integer", Samples: 20}, metrics[4])
+	})
+	t.Run("Samples", func(t *testing.T) {
+		t.Run("JSON", func(t *testing.T) {
+			samples := []map[string]interface{}{}
+			getJSON(t, "/samples?keys=ts,ops.query", &samples)
+			require.Len(t, samples, 40)
+			assert.Len(t, samples[0], 2)
+			assert.EqualValues(t, 78, samples[39]["ops.query"])
+			assert.Equal(t, base.Add(39*time.Second).Format(time.RFC3339), samples[39]["ts"])
+
+			rec := get(t, "/samples?keys=missing")
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "[]\n", rec.Body.String())
+		})
+		t.Run("NDJSON", func(t *testing.T) {
+			rec := get(t, "/samples?format=ndjson&file=metrics.2&keys=extra,up")
+			require.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+
+			lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+			require.Len(t, lines, 20)
+			assert.Equal(t, `{"up":true,"extra":20}`, lines[0])
+		})
+		t.Run("CSV", func(t *testing.T) {
+			rec := get(t, "/samples?format=csv&keys=ops.insert,extra")
+			require.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "text/csv", rec.Header().Get("Content-Type"))
+
+			reader := csv.NewReader(rec.Body)
+			reader.FieldsPerRecord = -1
+			records, err := reader.ReadAll()
+			require.NoError(t, err)
+			// the header is repeated when the extra metric
+			// appears.
+			require.Len(t, records, 42)
+			assert.Equal(t, []string{"ops.insert"}, records[0])
+			assert.Equal(t, []string{"0"}, records[1])
+			assert.Equal(t, []string{"ops.insert", "extra"}, records[21])
+			assert.Equal(t, []string{"39", "39"}, records[41])
+		})
+	})
+	t.Run("Errors", func(t *testing.T) {
+		for url, code := range map[string]int{
+			"/samples?file=missing":      http.StatusNotFound,
+			"/samples?file=../metrics.1": http.StatusNotFound,
+			"/samples?file=subdir":       http.StatusNotFound,
+			"/samples?format=xml":        http.StatusBadRequest,
+			"/chunks?start=yesterday":    http.StatusBadRequest,
+			"/metrics?end=tomorrow":      http.StatusBadRequest,
+			"/samples?start=" + base.Format(time.RFC3339) + "&end=" + base.Format(time.RFC3339): http.StatusBadRequest,
+			"/unknown": http.StatusNotFound,
+		} {
+			assert.Equal(t, code, get(t, url).Code, url)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/files", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "corrupt"), []byte("not ftdc data"), 0644))
+		defer os.Remove(filepath.Join(dir, "corrupt"))
+		assert.Equal(t, http.StatusInternalServerError, get(t, "/samples?file=corrupt").Code)
+		assert.Equal(t, http.StatusInternalServerError, get(t, "/chunks?file=corrupt").Code)
+	})
+}
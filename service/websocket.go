@@ -0,0 +1,201 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// This file implements the server side of the WebSocket protocol (RFC
+// 6455), to the extent needed to push messages to browser clients:
+// the opening handshake, unfragmented text messages from the server,
+// and the control messages (ping, pong, close) from clients.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// maxClientFrameSize limits the payload of frames from clients, which
+// are only expected to send control messages.
+const maxClientFrameSize = 64 * 1024
+
+type websocketConn struct {
+	conn net.Conn
+	buf  *bufio.ReadWriter
+	mu   sync.Mutex
+}
+
+func headerContains(h http.Header, name, value string) bool {
+	for _, field := range h[http.CanonicalHeaderKey(name)] {
+		for _, token := range strings.Split(field, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// upgradeWebsocket completes the opening handshake of a WebSocket
+// connection. If the request is not a valid WebSocket request,
+// upgradeWebsocket writes an error response and returns an error.
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request) (*websocketConn, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return nil, errors.New("not a websocket request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusBadRequest)
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing websocket key", http.StatusBadRequest)
+		return nil, errors.New("missing websocket key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket connections are not supported", http.StatusInternalServerError)
+		return nil, errors.New("response does not support hijacking")
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, errors.Wrap(err, "problem hijacking connection")
+	}
+
+	_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n")
+	if err = buf.Flush(); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "problem completing handshake")
+	}
+
+	return &websocketConn{conn: conn, buf: buf}, nil
+}
+
+// writeMessage writes a single, unmasked, frame.
+func (c *websocketConn) writeMessage(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+	switch {
+	case len(payload) < 126:
+		header[1] = byte(len(payload))
+	case len(payload) <= 0xFFFF:
+		header[1] = 126
+		header = header[:4]
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header[1] = 127
+		header = header[:10]
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+
+	_, _ = c.buf.Write(header)
+	_, _ = c.buf.Write(payload)
+	return errors.WithStack(c.buf.Flush())
+}
+
+// readFrame reads a single frame from the client, and returns its
+// opcode and unmasked payload.
+func (c *websocketConn) readFrame() (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.buf, header); err != nil {
+		return 0, nil, errors.WithStack(err)
+	}
+
+	opcode := header[0] & 0x0F
+	if header[1]&0x80 == 0 {
+		return 0, nil, errors.New("client frames must be masked")
+	}
+
+	size := uint64(header[1] & 0x7F)
+	switch size {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(c.buf, ext); err != nil {
+			return 0, nil, errors.WithStack(err)
+		}
+		size = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(c.buf, ext); err != nil {
+			return 0, nil, errors.WithStack(err)
+		}
+		size = binary.BigEndian.Uint64(ext)
+	}
+	if size > maxClientFrameSize {
+		return 0, nil, errors.Errorf("client frame of %d bytes is too large", size)
+	}
+
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(c.buf, mask); err != nil {
+		return 0, nil, errors.WithStack(err)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.buf, payload); err != nil {
+		return 0, nil, errors.WithStack(err)
+	}
+	for idx := range payload {
+		payload[idx] ^= mask[idx%4]
+	}
+
+	return opcode, payload, nil
+}
+
+// readLoop handles messages from the client until the client closes
+// the connection or the connection fails. Data messages from the
+// client are ignored.
+func (c *websocketConn) readLoop() error {
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		switch opcode {
+		case opPing:
+			if err = c.writeMessage(opPong, payload); err != nil {
+				return errors.WithStack(err)
+			}
+		case opClose:
+			// echo the status code, if any, to complete the
+			// closing handshake.
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			return errors.WithStack(c.writeMessage(opClose, payload))
+		case opText, opBinary, opContinuation, opPong:
+		default:
+			return errors.Errorf("unknown opcode %d", opcode)
+		}
+	}
+}
+
+func (c *websocketConn) Close() error { return c.conn.Close() }
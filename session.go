@@ -0,0 +1,383 @@
+package ftdc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/mongodb/grip/recovery"
+	"github.com/pkg/errors"
+)
+
+// Uploader receives the files written by a Session after they are
+// complete, for instance to copy them to remote storage. Files are
+// passed to the Uploader one at a time, in the order that they were
+// written, and are not removed by the session's retention policy
+// until the upload returns.
+type Uploader interface {
+	Upload(ctx context.Context, filename string) error
+}
+
+// SessionOptions configure a capture Session.
+type SessionOptions struct {
+	// Directory is the path of the directory that holds the FTDC
+	// files. It is created if it does not exist.
+	Directory string
+	// Source is called at every collection interval to produce
+	// the next sample. Samples may have any type accepted by
+	// Collector's Add method; schema changes between samples are
+	// handled by starting a new chunk.
+	Source func(context.Context) (interface{}, error)
+	// CollectionInterval is the time between samples. Defaults to
+	// one second.
+	CollectionInterval time.Duration
+	// SampleCount is the maximum number of samples in each
+	// chunk. Defaults to 300.
+	SampleCount int
+	// Metadata, if set, is written at the beginning of every
+	// file.
+	Metadata interface{}
+	// Rotation controls the naming, rotation, and retention of
+	// files in the directory.
+	Rotation RotationOptions
+	// SelfMetrics, when set, adds an "ftdc" sub-document to each
+	// sample, with the session's statistics and the package's
+	// internal counters.
+	SelfMetrics bool
+	// Uploader, if set, receives every file after it has been
+	// rotated.
+	Uploader Uploader
+}
+
+// Validate ensures that the options are reasonable, and sets default
+// values.
+func (opts *SessionOptions) Validate() error {
+	if opts.CollectionInterval == 0 {
+		opts.CollectionInterval = time.Second
+	}
+	if opts.SampleCount == 0 {
+		opts.SampleCount = 300
+	}
+
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(opts.Directory == "", "must specify a directory")
+	catcher.NewWhen(opts.Source == nil, "must specify a source for samples")
+	catcher.NewWhen(opts.CollectionInterval < time.Millisecond, "collection interval must be at least a millisecond")
+	catcher.NewWhen(opts.SampleCount < 1, "sample count must be positive")
+	catcher.Add(opts.Rotation.Validate())
+
+	return catcher.Resolve()
+}
+
+// SessionStats reports on the activity of a Session.
+type SessionStats struct {
+	Samples          int64 `json:"samples"`
+	CollectionErrors int64 `json:"collection_errors"`
+	FilesWritten     int64 `json:"files_written"`
+	FilesUploaded    int64 `json:"files_uploaded"`
+	UploadErrors     int64 `json:"upload_errors"`
+}
+
+// Session captures FTDC data from a source into a directory of
+// rotating files, removing old files according to a retention policy
+// and optionally uploading completed files.
+//
+// A minimal session looks like:
+//
+//    session, err := NewSession(SessionOptions{
+//        Directory: "diagnostic.data",
+//        Source: func(ctx context.Context) (interface{}, error) {
+//            return getStatus(ctx)
+//        },
+//    })
+//    if err != nil {
+//        return err
+//    }
+//    if err = session.Start(ctx); err != nil {
+//        return err
+//    }
+//    defer session.Stop()
+type Session struct {
+	opts      SessionOptions
+	stats     SessionStats
+	mu        sync.Mutex
+	writer    *rotatingWriter
+	collector Collector
+	started   bool
+	stopped   bool
+	cancel    context.CancelFunc
+	collected chan struct{}
+	finished  chan struct{}
+	uploaded  chan struct{}
+	catcher   grip.Catcher
+
+	uploadMu     sync.Mutex
+	uploadQueue  []string
+	uploadSignal chan struct{}
+	pending      map[string]struct{}
+}
+
+// NewSession validates the options and constructs a Session. Use
+// Start to begin collecting data.
+func NewSession(opts SessionOptions) (*Session, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid session options")
+	}
+
+	writer, err := newRotatingWriter(opts.Directory, opts.Rotation)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if opts.Metadata != nil {
+		writer.metadata, err = readDocument(opts.Metadata)
+		if err != nil {
+			return nil, errors.Wrap(err, "problem reading metadata")
+		}
+	}
+
+	s := &Session{
+		opts:         opts,
+		writer:       writer,
+		collector:    NewStreamingDynamicCollector(opts.SampleCount, writer),
+		catcher:      grip.NewBasicCatcher(),
+		collected:    make(chan struct{}),
+		finished:     make(chan struct{}),
+		uploaded:     make(chan struct{}),
+		uploadSignal: make(chan struct{}, 1),
+		pending:      map[string]struct{}{},
+	}
+
+	writer.onRotate = s.rotated
+	writer.keep = s.isPending
+
+	return s, nil
+}
+
+// Start begins collecting samples in the background. Canceling the
+// context aborts collection and any in progress upload; you must
+// still call Stop to flush buffered samples and close the current
+// file.
+func (s *Session) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return errors.New("session has already been started")
+	}
+	s.started = true
+
+	var cctx context.Context
+	cctx, s.cancel = context.WithCancel(ctx)
+
+	go s.collectLoop(cctx)
+
+	if s.opts.Uploader != nil {
+		go s.uploadLoop(ctx)
+	} else {
+		close(s.uploaded)
+	}
+
+	return nil
+}
+
+// Stop ends collection, flushes buffered samples to the current file,
+// closes it, and waits for all uploads to complete. Returns any
+// errors encountered while writing or uploading files.
+func (s *Session) Stop() error {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return errors.New("session has not been started")
+	}
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	s.cancel()
+	s.mu.Unlock()
+
+	// wait for the collection loop to return before flushing,
+	// then for the upload loop to drain the queue, which
+	// includes the final file.
+	<-s.collected
+
+	s.mu.Lock()
+	s.catcher.Add(FlushCollector(s.collector, s.writer))
+	s.catcher.Add(s.writer.Close())
+	s.mu.Unlock()
+
+	close(s.finished)
+	<-s.uploaded
+
+	return s.catcher.Resolve()
+}
+
+// Stats returns a snapshot of the session's statistics.
+func (s *Session) Stats() SessionStats {
+	return SessionStats{
+		Samples:          atomic.LoadInt64(&s.stats.Samples),
+		CollectionErrors: atomic.LoadInt64(&s.stats.CollectionErrors),
+		FilesWritten:     atomic.LoadInt64(&s.stats.FilesWritten),
+		FilesUploaded:    atomic.LoadInt64(&s.stats.FilesUploaded),
+		UploadErrors:     atomic.LoadInt64(&s.stats.UploadErrors),
+	}
+}
+
+func (s *Session) collectLoop(ctx context.Context) {
+	defer close(s.collected)
+	defer recovery.LogStackTraceAndContinue("ftdc capture session")
+
+	ticker := time.NewTicker(s.opts.CollectionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.collect(ctx); err != nil {
+				atomic.AddInt64(&s.stats.CollectionErrors, 1)
+				grip.Warning(message.WrapError(err, message.Fields{
+					"message":   "problem collecting ftdc sample",
+					"directory": s.opts.Directory,
+				}))
+			}
+		}
+	}
+}
+
+func (s *Session) collect(ctx context.Context) error {
+	sample, err := s.opts.Source(ctx)
+	if err != nil {
+		return errors.Wrap(err, "problem producing sample")
+	}
+
+	doc, err := readDocument(sample)
+	if err != nil {
+		return errors.Wrap(err, "problem reading sample")
+	}
+
+	if s.opts.SelfMetrics {
+		doc = doc.Copy().Append(bsonx.EC.SubDocument("ftdc", s.selfMetrics()))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.collector.Add(doc); err != nil {
+		return errors.Wrap(err, "problem adding sample")
+	}
+	atomic.AddInt64(&s.stats.Samples, 1)
+
+	return nil
+}
+
+func (s *Session) selfMetrics() *bsonx.Document {
+	session := s.Stats()
+	pkg := GetStats()
+
+	return bsonx.NewDocument(
+		bsonx.EC.Int64("samples", session.Samples),
+		bsonx.EC.Int64("collection_errors", session.CollectionErrors),
+		bsonx.EC.Int64("files_written", session.FilesWritten),
+		bsonx.EC.Int64("files_uploaded", session.FilesUploaded),
+		bsonx.EC.Int64("upload_errors", session.UploadErrors),
+		bsonx.EC.Int64("chunks_flushed", pkg.ChunksFlushed),
+		bsonx.EC.Int64("bytes_written", pkg.BytesWritten),
+		bsonx.EC.Int64("flush_errors", pkg.FlushErrors),
+	)
+}
+
+func (s *Session) rotated(filename string) {
+	atomic.AddInt64(&s.stats.FilesWritten, 1)
+
+	if s.opts.Uploader == nil {
+		return
+	}
+
+	s.uploadMu.Lock()
+	s.uploadQueue = append(s.uploadQueue, filename)
+	s.pending[filename] = struct{}{}
+	s.uploadMu.Unlock()
+
+	s.signalUpload()
+}
+
+func (s *Session) isPending(filename string) bool {
+	s.uploadMu.Lock()
+	defer s.uploadMu.Unlock()
+
+	_, ok := s.pending[filename]
+	return ok
+}
+
+func (s *Session) signalUpload() {
+	select {
+	case s.uploadSignal <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Session) nextUpload() (string, bool) {
+	s.uploadMu.Lock()
+	defer s.uploadMu.Unlock()
+
+	if len(s.uploadQueue) == 0 {
+		return "", false
+	}
+
+	name := s.uploadQueue[0]
+	s.uploadQueue = s.uploadQueue[1:]
+	return name, true
+}
+
+func (s *Session) uploadLoop(ctx context.Context) {
+	defer close(s.uploaded)
+	defer recovery.LogStackTraceAndContinue("ftdc capture session uploader")
+
+	for {
+		s.drainUploads(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.uploadSignal:
+		case <-s.finished:
+			s.drainUploads(ctx)
+			return
+		}
+	}
+}
+
+func (s *Session) drainUploads(ctx context.Context) {
+	for ctx.Err() == nil {
+		name, ok := s.nextUpload()
+		if !ok {
+			return
+		}
+
+		s.upload(ctx, name)
+	}
+}
+
+func (s *Session) upload(ctx context.Context, filename string) {
+	err := s.opts.Uploader.Upload(ctx, filename)
+
+	s.uploadMu.Lock()
+	delete(s.pending, filename)
+	s.uploadMu.Unlock()
+
+	if err != nil {
+		atomic.AddInt64(&s.stats.UploadErrors, 1)
+		s.catcher.Add(errors.Wrapf(err, "problem uploading '%s'", filename))
+		return
+	}
+
+	atomic.AddInt64(&s.stats.FilesUploaded, 1)
+}
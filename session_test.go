@@ -0,0 +1,246 @@
+package ftdc
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockUploader struct {
+	mu    sync.Mutex
+	files []string
+	err   error
+}
+
+func (u *mockUploader) Upload(ctx context.Context, fn string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, err := os.Stat(fn); err != nil {
+		return err
+	}
+
+	u.files = append(u.files, fn)
+	return u.err
+}
+
+func countSamples(t *testing.T, ctx context.Context, fn string) (int, *bsonx.Document) {
+	f, err := os.Open(fn)
+	require.NoError(t, err)
+	defer f.Close()
+
+	iter := ReadChunks(ctx, f)
+	defer iter.Close()
+
+	var (
+		num      int
+		metadata *bsonx.Document
+	)
+	for iter.Next() {
+		num += iter.Chunk().Size()
+		metadata = iter.Chunk().GetMetadata()
+	}
+	require.NoError(t, iter.Err())
+
+	return num, metadata
+}
+
+func TestSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for name, opts := range map[string]SessionOptions{
+			"Empty":       {},
+			"NoSource":    {Directory: "foo"},
+			"NoDirectory": {Source: func(context.Context) (interface{}, error) { return nil, nil }},
+			"Rotation": {
+				Directory: "foo",
+				Source:    func(context.Context) (interface{}, error) { return nil, nil },
+				Rotation:  RotationOptions{MaxFileSize: -1},
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				s, err := NewSession(opts)
+				assert.Error(t, err)
+				assert.Nil(t, s)
+			})
+		}
+	})
+	t.Run("StartStop", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "ftdc-session")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		var count int64
+		uploader := &mockUploader{}
+		s, err := NewSession(SessionOptions{
+			Directory:          dir,
+			CollectionInterval: time.Millisecond,
+			SampleCount:        10,
+			Metadata:           bsonx.NewDocument(bsonx.EC.String("process", "test")),
+			SelfMetrics:        true,
+			Uploader:           uploader,
+			Rotation:           RotationOptions{MaxFileSize: 1},
+			Source: func(context.Context) (interface{}, error) {
+				return bsonx.NewDocument(bsonx.EC.Int64("count", atomic.AddInt64(&count, 1))), nil
+			},
+		})
+		require.NoError(t, err)
+
+		require.Error(t, s.Stop())
+		require.NoError(t, s.Start(ctx))
+		require.Error(t, s.Start(ctx))
+
+		time.Sleep(100 * time.Millisecond)
+		require.NoError(t, s.Stop())
+		require.NoError(t, s.Stop())
+
+		stats := s.Stats()
+		assert.True(t, stats.Samples > 10)
+		assert.Zero(t, stats.CollectionErrors)
+		assert.True(t, stats.FilesWritten > 1)
+		assert.Equal(t, stats.FilesWritten, stats.FilesUploaded)
+		assert.Zero(t, stats.UploadErrors)
+		assert.Len(t, uploader.files, int(stats.FilesUploaded))
+
+		var total int
+		for _, fn := range uploader.files {
+			num, metadata := countSamples(t, ctx, fn)
+			total += num
+			require.NotNil(t, metadata)
+			assert.Equal(t, "test", metadata.Lookup("doc").MutableDocument().Lookup("process").StringValue())
+		}
+		assert.EqualValues(t, stats.Samples, total)
+	})
+	t.Run("CollectionErrors", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "ftdc-session")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		s, err := NewSession(SessionOptions{
+			Directory:          dir,
+			CollectionInterval: time.Millisecond,
+			Source: func(context.Context) (interface{}, error) {
+				return nil, errors.New("source error")
+			},
+		})
+		require.NoError(t, err)
+		require.NoError(t, s.Start(ctx))
+		time.Sleep(20 * time.Millisecond)
+		require.NoError(t, s.Stop())
+
+		stats := s.Stats()
+		assert.True(t, stats.CollectionErrors > 0)
+		assert.Zero(t, stats.Samples)
+		assert.Zero(t, stats.FilesWritten)
+	})
+	t.Run("UploadErrors", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "ftdc-session")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		s, err := NewSession(SessionOptions{
+			Directory:          dir,
+			CollectionInterval: time.Millisecond,
+			Uploader:           &mockUploader{err: errors.New("upload error")},
+			Source: func(context.Context) (interface{}, error) {
+				return bsonx.NewDocument(bsonx.EC.Int64("value", 1)), nil
+			},
+		})
+		require.NoError(t, err)
+		require.NoError(t, s.Start(ctx))
+		time.Sleep(20 * time.Millisecond)
+		require.Error(t, s.Stop())
+		assert.EqualValues(t, 1, s.Stats().UploadErrors)
+	})
+}
+
+func TestRotatingWriter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "ftdc-rotation")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = newRotatingWriter(dir, RotationOptions{Prefix: "a/b"})
+	require.Error(t, err)
+	_, err = newRotatingWriter(dir, RotationOptions{MaxFileSize: 10, MaxTotalSize: 5})
+	require.Error(t, err)
+
+	chunk := newChunk(10)
+	w, err := newRotatingWriter(dir, RotationOptions{
+		MaxFileSize:  int64(len(chunk)) * 2,
+		MaxTotalSize: int64(len(chunk)) * 5,
+	})
+	require.NoError(t, err)
+
+	rotated := []string{}
+	w.onRotate = func(fn string) { rotated = append(rotated, fn) }
+
+	for i := 0; i < 10; i++ {
+		n, err := w.Write(chunk)
+		require.NoError(t, err)
+		require.Equal(t, len(chunk), n)
+	}
+	require.NoError(t, w.Close())
+
+	assert.Len(t, rotated, 5)
+
+	files, err := w.files()
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	for idx, info := range files {
+		assert.Equal(t, rotated[idx+3], filepath.Join(dir, info.Name()))
+		num, _ := countSamples(t, ctx, rotated[idx+3])
+		assert.Equal(t, 20, num)
+	}
+
+	t.Run("PruneError", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "ftdc-rotation")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		w, err := newRotatingWriter(dir, RotationOptions{
+			MaxFileSize:  int64(len(chunk)),
+			MaxTotalSize: int64(len(chunk)),
+		})
+		require.NoError(t, err)
+
+		n, err := w.Write(chunk)
+		require.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+
+		// remove the first file out from under the writer, so
+		// that it fails to prune it after the next write.
+		w.keep = func(fn string) bool {
+			if _, err := os.Stat(fn); err == nil {
+				require.NoError(t, os.Remove(fn))
+			}
+			return false
+		}
+
+		n, err = w.Write(chunk)
+		require.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+
+		// the error is reported when the writer is closed,
+		// rather than failing later writes.
+		n, err = w.Write(chunk)
+		assert.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+		assert.Error(t, w.Close())
+		assert.NoError(t, w.Close())
+	})
+}
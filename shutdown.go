@@ -0,0 +1,127 @@
+package ftdc
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ShutdownCoordinator flushes a set of collectors when a process shuts
+// down, in priority order, within a single deadline, so that the most
+// important data is written first, and data that cannot be written in
+// time does not hold up the rest of the shutdown.
+//
+// The coordinator is safe for concurrent use.
+type ShutdownCoordinator struct {
+	mu      sync.Mutex
+	targets []shutdownTarget
+}
+
+type shutdownTarget struct {
+	name      string
+	priority  int
+	collector Collector
+	output    io.Writer
+}
+
+// ShutdownResult describes the flush of a single collector by a
+// ShutdownCoordinator.
+type ShutdownResult struct {
+	Name     string
+	Priority int
+	// Complete is true when all of the data in the collector was
+	// written to its output.
+	Complete bool
+	// Err holds the error that prevented the flush from
+	// completing, which is the error of the context for
+	// collectors that were not flushed before the deadline.
+	Err      error
+	Duration time.Duration
+}
+
+// NewShutdownCoordinator returns a coordinator with no collectors.
+func NewShutdownCoordinator() *ShutdownCoordinator {
+	return &ShutdownCoordinator{}
+}
+
+// Register adds a collector, which is flushed to the output when the
+// coordinator flushes. Collectors with higher priorities are flushed
+// first, and collectors with the same priority are flushed in the
+// order in which they were registered. Names identify collectors in
+// the results, and must be unique.
+func (c *ShutdownCoordinator) Register(name string, priority int, collector Collector, output io.Writer) error {
+	if name == "" {
+		return errors.New("must specify a name")
+	}
+	if collector == nil {
+		return errors.New("must specify a collector")
+	}
+	if output == nil {
+		return errors.New("must specify an output")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, t := range c.targets {
+		if t.name == name {
+			return errors.Errorf("collector '%s' is already registered", name)
+		}
+	}
+
+	c.targets = append(c.targets, shutdownTarget{
+		name:      name,
+		priority:  priority,
+		collector: collector,
+		output:    output,
+	})
+
+	return nil
+}
+
+// Flush writes the contents of every registered collector to its
+// output, one collector at a time, in priority order, and returns the
+// result for every collector, in the order in which they were
+// flushed.
+//
+// When the context is canceled or its deadline passes, Flush returns
+// immediately, and the collectors that were not completely flushed
+// are reported as incomplete. A write that is in progress at the
+// deadline continues in the background, as with
+// FlushCollectorContext.
+func (c *ShutdownCoordinator) Flush(ctx context.Context) []ShutdownResult {
+	c.mu.Lock()
+	targets := make([]shutdownTarget, len(c.targets))
+	copy(targets, c.targets)
+	c.mu.Unlock()
+
+	sort.SliceStable(targets, func(i, j int) bool { return targets[i].priority > targets[j].priority })
+
+	out := make([]ShutdownResult, len(targets))
+	for idx, t := range targets {
+		out[idx] = ShutdownResult{
+			Name:     t.name,
+			Priority: t.priority,
+		}
+
+		if err := ctx.Err(); err != nil {
+			out[idx].Err = errors.WithStack(err)
+			continue
+		}
+
+		start := time.Now()
+		err := FlushCollectorContext(ctx, NewCollectorContext(t.collector), t.output)
+		out[idx].Duration = time.Since(start)
+		if err != nil {
+			out[idx].Err = errors.Wrapf(err, "problem flushing '%s'", t.name)
+			continue
+		}
+		out[idx].Complete = true
+	}
+
+	return out
+}
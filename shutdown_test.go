@@ -0,0 +1,110 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("write failed") }
+
+func TestShutdownCoordinator(t *testing.T) {
+	newCollector := func(t *testing.T) Collector {
+		collector := NewBaseCollector(10)
+		for i := 0; i < 5; i++ {
+			require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("a", int64(i)))))
+		}
+		return collector
+	}
+
+	t.Run("Register", func(t *testing.T) {
+		coordinator := NewShutdownCoordinator()
+		assert.Error(t, coordinator.Register("", 0, newCollector(t), &bytes.Buffer{}))
+		assert.Error(t, coordinator.Register("a", 0, nil, &bytes.Buffer{}))
+		assert.Error(t, coordinator.Register("a", 0, newCollector(t), nil))
+		require.NoError(t, coordinator.Register("a", 0, newCollector(t), &bytes.Buffer{}))
+		assert.Error(t, coordinator.Register("a", 1, newCollector(t), &bytes.Buffer{}))
+	})
+	t.Run("PriorityOrder", func(t *testing.T) {
+		coordinator := NewShutdownCoordinator()
+		outputs := map[string]*bytes.Buffer{}
+		for _, target := range []struct {
+			name     string
+			priority int
+		}{{"low", 1}, {"high", 10}, {"medium", 5}, {"medium2", 5}} {
+			outputs[target.name] = &bytes.Buffer{}
+			require.NoError(t, coordinator.Register(target.name, target.priority, newCollector(t), outputs[target.name]))
+		}
+		empty := &bytes.Buffer{}
+		require.NoError(t, coordinator.Register("empty", 0, NewBaseCollector(10), empty))
+		failed := NewBaseCollector(10)
+		require.NoError(t, failed.Add(bsonx.NewDocument(bsonx.EC.Int64("a", 1))))
+		require.NoError(t, coordinator.Register("failed", 2, failed, failingWriter{}))
+
+		results := coordinator.Flush(context.Background())
+		require.Len(t, results, 6)
+
+		names := []string{}
+		for _, r := range results {
+			names = append(names, r.Name)
+		}
+		assert.Equal(t, []string{"high", "medium", "medium2", "failed", "low", "empty"}, names)
+
+		for _, r := range results {
+			if r.Name == "failed" {
+				assert.False(t, r.Complete)
+				assert.Error(t, r.Err)
+				continue
+			}
+			assert.True(t, r.Complete, r.Name)
+			assert.NoError(t, r.Err, r.Name)
+		}
+
+		for name, buf := range outputs {
+			iter := ReadChunks(context.Background(), bytes.NewReader(buf.Bytes()))
+			require.True(t, iter.Next(), name)
+			assert.Equal(t, 5, iter.Chunk().Size())
+			iter.Close()
+		}
+		assert.Zero(t, empty.Len())
+	})
+	t.Run("Deadline", func(t *testing.T) {
+		coordinator := NewShutdownCoordinator()
+		first := &bytes.Buffer{}
+		stuck := &blockingWriter{release: make(chan struct{})}
+		defer close(stuck.release)
+		last := &bytes.Buffer{}
+
+		require.NoError(t, coordinator.Register("first", 3, newCollector(t), first))
+		require.NoError(t, coordinator.Register("stuck", 2, newCollector(t), stuck))
+		require.NoError(t, coordinator.Register("last", 1, newCollector(t), last))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		results := coordinator.Flush(ctx)
+		assert.True(t, time.Since(start) < 5*time.Second)
+		require.Len(t, results, 3)
+
+		assert.True(t, results[0].Complete)
+		assert.NotZero(t, first.Len())
+
+		assert.Equal(t, "stuck", results[1].Name)
+		assert.False(t, results[1].Complete)
+		assert.Error(t, results[1].Err)
+
+		assert.Equal(t, "last", results[2].Name)
+		assert.False(t, results[2].Complete)
+		assert.Equal(t, context.DeadlineExceeded, errors.Cause(results[2].Err))
+		assert.Zero(t, last.Len())
+	})
+}
@@ -0,0 +1,140 @@
+package ftdc
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// Stats reports on the activity of the FTDC machinery in the current
+// process. All values are cumulative since the process started.
+type Stats struct {
+	// ChunksFlushed and BytesWritten count the chunks written to
+	// writers by FlushCollector (and FlushCollectorContext),
+	// including flushes performed by streaming collectors.
+	ChunksFlushed int64 `json:"chunks_flushed"`
+	BytesWritten  int64 `json:"bytes_written"`
+	// FlushErrors counts flushes that failed to resolve the
+	// collector or write the resulting payload.
+	FlushErrors int64 `json:"flush_errors"`
+
+	// ChunksDecoded counts the metric chunks decoded by the
+	// iterators, and DecodeErrors counts chunks that could not
+	// be decoded.
+	ChunksDecoded int64 `json:"chunks_decoded"`
+	DecodeErrors  int64 `json:"decode_errors"`
+
+	// PoolHits counts the zlib compressors and decompressors
+	// that were reused from the package's pools when encoding or
+	// decoding chunks, and PoolMisses counts those that had to be
+	// created because the pool was empty.
+	PoolHits   int64 `json:"pool_hits"`
+	PoolMisses int64 `json:"pool_misses"`
+}
+
+var globalStats Stats
+
+// GetStats returns a snapshot of the package's internal counters.
+func GetStats() Stats {
+	return Stats{
+		ChunksFlushed: atomic.LoadInt64(&globalStats.ChunksFlushed),
+		BytesWritten:  atomic.LoadInt64(&globalStats.BytesWritten),
+		FlushErrors:   atomic.LoadInt64(&globalStats.FlushErrors),
+		ChunksDecoded: atomic.LoadInt64(&globalStats.ChunksDecoded),
+		DecodeErrors:  atomic.LoadInt64(&globalStats.DecodeErrors),
+		PoolHits:      atomic.LoadInt64(&globalStats.PoolHits),
+		PoolMisses:    atomic.LoadInt64(&globalStats.PoolMisses),
+	}
+}
+
+func recordFlush(size int, err error) {
+	if err != nil {
+		atomic.AddInt64(&globalStats.FlushErrors, 1)
+		return
+	}
+
+	atomic.AddInt64(&globalStats.ChunksFlushed, 1)
+	atomic.AddInt64(&globalStats.BytesWritten, int64(size))
+}
+
+func recordDecode(err error) {
+	if err != nil {
+		atomic.AddInt64(&globalStats.DecodeErrors, 1)
+		return
+	}
+
+	atomic.AddInt64(&globalStats.ChunksDecoded, 1)
+}
+
+func recordPoolGet(hit bool) {
+	if hit {
+		atomic.AddInt64(&globalStats.PoolHits, 1)
+		return
+	}
+
+	atomic.AddInt64(&globalStats.PoolMisses, 1)
+}
+
+// PublishExpvar publishes the package's internal counters with the
+// expvar package under the specified name, which makes them
+// available on the standard /debug/vars endpoint. Returns an error
+// if a variable with that name is already published.
+func PublishExpvar(name string) error {
+	if name == "" {
+		return errors.New("must specify a name for the expvar variable")
+	}
+
+	if expvar.Get(name) != nil {
+		return errors.Errorf("expvar variable '%s' is already published", name)
+	}
+
+	expvar.Publish(name, expvar.Func(func() interface{} { return GetStats() }))
+
+	return nil
+}
+
+// WritePrometheus writes the package's internal counters to the
+// writer using the Prometheus text exposition format, with all
+// metric names prefixed by "ftdc_".
+func WritePrometheus(w io.Writer) error {
+	stats := GetStats()
+
+	for _, counter := range []struct {
+		name  string
+		help  string
+		value int64
+	}{
+		{"chunks_flushed_total", "Number of chunks written by FTDC collectors.", stats.ChunksFlushed},
+		{"bytes_written_total", "Number of bytes written by FTDC collectors.", stats.BytesWritten},
+		{"flush_errors_total", "Number of failed FTDC collector flushes.", stats.FlushErrors},
+		{"chunks_decoded_total", "Number of FTDC chunks decoded by iterators.", stats.ChunksDecoded},
+		{"decode_errors_total", "Number of FTDC chunks that could not be decoded.", stats.DecodeErrors},
+		{"pool_hits_total", "Number of FTDC zlib compressors and decompressors reused from a pool.", stats.PoolHits},
+		{"pool_misses_total", "Number of FTDC zlib compressors and decompressors created for an empty pool.", stats.PoolMisses},
+	} {
+		_, err := fmt.Fprintf(w, "# HELP ftdc_%s %s\n# TYPE ftdc_%s counter\nftdc_%s %d\n",
+			counter.name, counter.help, counter.name, counter.name, counter.value)
+		if err != nil {
+			return errors.Wrap(err, "problem writing metrics")
+		}
+	}
+
+	return nil
+}
+
+// PrometheusHandler returns an http.Handler that exposes the
+// package's internal counters for Prometheus to scrape. Register it
+// on your metrics endpoint or combine its output with other
+// exporters.
+func PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := WritePrometheus(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("Flush", func(t *testing.T) {
+		before := GetStats()
+
+		collector := NewBaseCollector(10)
+		for i := int64(0); i < 10; i++ {
+			require.NoError(t, collector.Add(createEventRecord(i, i, i, 1)))
+		}
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		after := GetStats()
+		assert.True(t, after.ChunksFlushed >= before.ChunksFlushed+1)
+		assert.True(t, after.BytesWritten >= before.BytesWritten+int64(buf.Len()))
+	})
+	t.Run("FlushError", func(t *testing.T) {
+		before := GetStats()
+
+		collector := NewBaseCollector(10)
+		require.NoError(t, collector.Add(createEventRecord(1, 1, 1, 1)))
+		require.Error(t, FlushCollector(collector, &errorWriter{}))
+
+		assert.True(t, GetStats().FlushErrors >= before.FlushErrors+1)
+	})
+	t.Run("Decode", func(t *testing.T) {
+		before := GetStats()
+
+		iter := ReadChunks(ctx, bytes.NewBuffer(newChunk(10)))
+		for iter.Next() {
+		}
+		iter.Close()
+		require.NoError(t, iter.Err())
+
+		assert.True(t, GetStats().ChunksDecoded >= before.ChunksDecoded+1)
+	})
+	t.Run("Pool", func(t *testing.T) {
+		before := GetStats()
+
+		for i := 0; i < 2; i++ {
+			iter := ReadChunks(ctx, bytes.NewBuffer(newChunk(10)))
+			for iter.Next() {
+			}
+			iter.Close()
+			require.NoError(t, iter.Err())
+		}
+
+		// each chunk is compressed and decompressed once. The
+		// pools may drop their contents at any time, so
+		// whether these were hits or misses isn't predictable.
+		after := GetStats()
+		assert.True(t, after.PoolHits+after.PoolMisses >= before.PoolHits+before.PoolMisses+4)
+	})
+	t.Run("Expvar", func(t *testing.T) {
+		require.Error(t, PublishExpvar(""))
+		require.NoError(t, PublishExpvar("ftdc-test-stats"))
+		require.Error(t, PublishExpvar("ftdc-test-stats"))
+
+		out := Stats{}
+		require.NoError(t, json.Unmarshal([]byte(expvar.Get("ftdc-test-stats").String()), &out))
+		assert.True(t, out.ChunksFlushed > 0)
+	})
+	t.Run("Prometheus", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		PrometheusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		body := rec.Body.String()
+		for _, name := range []string{"chunks_flushed_total", "bytes_written_total", "flush_errors_total", "chunks_decoded_total", "decode_errors_total", "pool_hits_total", "pool_misses_total"} {
+			assert.Contains(t, body, "# TYPE ftdc_"+name+" counter\n")
+		}
+		assert.Equal(t, 21, strings.Count(body, "\n"))
+	})
+}
+
+type errorWriter struct{}
+
+func (*errorWriter) Write(_ []byte) (int, error) { return 0, assert.AnError }
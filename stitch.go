@@ -0,0 +1,203 @@
+package ftdc
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// StitchOptions control how StitchFiles combines the series from
+// multiple files.
+type StitchOptions struct {
+	// GapThreshold is the length of time between consecutive
+	// samples of a metric above which the samples are considered
+	// discontinuous, and a gap is recorded. When zero, the
+	// threshold for each metric is twice the median interval
+	// between its samples.
+	GapThreshold time.Duration
+	// IsCounter reports metrics that are monotonically increasing
+	// counters, which are reset (e.g. when the process restarts)
+	// rather than decrease. When the value of a counter decreases,
+	// the stitched series continues from the value before the
+	// reset. If nil, no metrics are treated as counters.
+	IsCounter func(key string) bool
+	// Include, if set, limits the stitched series to the metrics
+	// for which it returns true. Because stitched series hold every
+	// sample in memory, this is useful for long periods.
+	Include func(key string) bool
+}
+
+// StitchedSeries is the continuous history of a single metric across
+// all of the stitched files, ordered by time.
+type StitchedSeries struct {
+	Key    string
+	Type   bsontype.Type
+	Times  []time.Time
+	Values []int64
+	// Gaps holds the indexes of the samples that follow a gap in
+	// the series, either because no data was collected, or because
+	// the metric was absent from the files for that period.
+	Gaps []int
+	// Resets holds the indexes of the samples of counters that
+	// follow a counter reset. The values of these, and subsequent,
+	// samples are adjusted to continue the series.
+	Resets []int
+}
+
+// Len returns the number of samples in the series.
+func (s *StitchedSeries) Len() int { return len(s.Values) }
+
+// StitchFiles reads all of the chunks in the specified files, which
+// may be provided in any order, and combines the samples of each
+// metric into a single series ordered by time, so that the boundaries
+// between files, as produced by rotation, are transparent. Samples
+// with the same time as a previous sample of the same metric (i.e.
+// from overlapping files) are dropped.
+//
+// Sample times are derived from the first date time metric in each
+// chunk, and StitchFiles returns an error for chunks without a date
+// time metric. If the type of a metric changes between files, it
+// returns an error.
+func StitchFiles(ctx context.Context, paths []string, opts StitchOptions) (map[string]*StitchedSeries, error) {
+	if opts.GapThreshold < 0 {
+		return nil, errors.New("gap threshold must not be negative")
+	}
+
+	out := map[string]*StitchedSeries{}
+	for _, path := range paths {
+		if err := stitchFile(ctx, path, opts, out); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	for key, series := range out {
+		series.sort()
+		series.findGaps(opts.GapThreshold)
+		if opts.IsCounter != nil && opts.IsCounter(key) {
+			series.adjustResets()
+		}
+	}
+
+	return out, nil
+}
+
+func stitchFile(ctx context.Context, path string, opts StitchOptions, out map[string]*StitchedSeries) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening '%s'", path)
+	}
+	defer f.Close()
+
+	iter := ReadChunks(ctx, f)
+	defer iter.Close()
+
+	for iter.Next() {
+		chunk := iter.Chunk()
+		times := chunk.sampleTimes()
+		if times == nil {
+			return errors.Errorf("chunk in '%s' has no date time metric", path)
+		}
+
+		for idx := range chunk.Metrics {
+			metric := &chunk.Metrics[idx]
+			key := metric.Key()
+			if opts.Include != nil && !opts.Include(key) {
+				continue
+			}
+
+			series, ok := out[key]
+			if !ok {
+				series = &StitchedSeries{Key: key, Type: metric.originalType}
+				out[key] = series
+			} else if series.Type != metric.originalType {
+				return errors.Errorf("metric '%s' changed type from %s to %s in '%s'",
+					key, series.Type, metric.originalType, path)
+			}
+
+			series.Times = append(series.Times, times...)
+			series.Values = append(series.Values, metric.Values...)
+		}
+	}
+
+	return errors.Wrapf(iter.Err(), "problem reading '%s'", path)
+}
+
+type seriesByTime StitchedSeries
+
+func (s *seriesByTime) Len() int           { return len(s.Times) }
+func (s *seriesByTime) Less(i, j int) bool { return s.Times[i].Before(s.Times[j]) }
+func (s *seriesByTime) Swap(i, j int) {
+	s.Times[i], s.Times[j] = s.Times[j], s.Times[i]
+	s.Values[i], s.Values[j] = s.Values[j], s.Values[i]
+}
+
+// sort orders the samples by time and removes duplicate samples.
+func (s *StitchedSeries) sort() {
+	sort.Stable((*seriesByTime)(s))
+
+	num := 0
+	for idx := range s.Times {
+		if num > 0 && s.Times[idx].Equal(s.Times[num-1]) {
+			continue
+		}
+		s.Times[num] = s.Times[idx]
+		s.Values[num] = s.Values[idx]
+		num++
+	}
+	s.Times = s.Times[:num]
+	s.Values = s.Values[:num]
+}
+
+func (s *StitchedSeries) findGaps(threshold time.Duration) {
+	if len(s.Times) < 2 {
+		return
+	}
+
+	if threshold == 0 {
+		intervals := make([]time.Duration, len(s.Times)-1)
+		for idx := range intervals {
+			intervals[idx] = s.Times[idx+1].Sub(s.Times[idx])
+		}
+		sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+		threshold = 2 * intervals[len(intervals)/2]
+	}
+
+	for idx := 1; idx < len(s.Times); idx++ {
+		if s.Times[idx].Sub(s.Times[idx-1]) > threshold {
+			s.Gaps = append(s.Gaps, idx)
+		}
+	}
+}
+
+// adjustResets finds the samples where a counter decreased, and adds
+// the value of the counter before each reset to all subsequent
+// samples, on the assumption that the counter restarted from zero.
+func (s *StitchedSeries) adjustResets() {
+	switch s.Type {
+	case bsontype.Double:
+		var offset, last float64
+		for idx, v := range s.Values {
+			value := restoreFloat(v)
+			if idx > 0 && value < last {
+				s.Resets = append(s.Resets, idx)
+				offset += last
+			}
+			last = value
+			s.Values[idx] = normalizeFloat(value + offset)
+		}
+	case bsontype.Int32, bsontype.Int64:
+		var offset, last int64
+		for idx, value := range s.Values {
+			if idx > 0 && value < last {
+				s.Resets = append(s.Resets, idx)
+				offset += last
+			}
+			last = value
+			s.Values[idx] = value + offset
+		}
+	}
+}
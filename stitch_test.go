@@ -0,0 +1,146 @@
+package ftdc
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStitchFiles(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "ftdc-stitch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	writeFile := func(name string, docs []*bsonx.Document) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		defer f.Close()
+
+		collector := NewStreamingDynamicCollector(7, f)
+		for _, doc := range docs {
+			require.NoError(t, collector.Add(doc))
+		}
+		require.NoError(t, FlushCollector(collector, f))
+		return path
+	}
+
+	// the first file has 20 samples of a counter, and the second,
+	// written after a restart and a ten second gap, has 20 more
+	// samples of the counter, which restarted from zero, and an
+	// additional metric. The files overlap by one sample.
+	first := []*bsonx.Document{}
+	for i := 0; i < 20; i++ {
+		first = append(first, bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("counter", int64(100+i)),
+			bsonx.EC.Int32("gauge", int32(i%3)),
+		))
+	}
+	second := []*bsonx.Document{first[len(first)-1]}
+	for i := 0; i < 20; i++ {
+		second = append(second, bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(30+i)*time.Second)),
+			bsonx.EC.Int64("counter", int64(i)),
+			bsonx.EC.Int32("gauge", int32(i%3)),
+			bsonx.EC.Int64("extra", int64(i)),
+		))
+	}
+
+	paths := []string{
+		writeFile("metrics.2", second),
+		writeFile("metrics.1", first),
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		series, err := StitchFiles(ctx, paths, StitchOptions{GapThreshold: -1})
+		assert.Error(t, err)
+		assert.Nil(t, series)
+	})
+	t.Run("MissingFile", func(t *testing.T) {
+		series, err := StitchFiles(ctx, []string{filepath.Join(dir, "missing")}, StitchOptions{})
+		assert.Error(t, err)
+		assert.Nil(t, series)
+	})
+	t.Run("NoTimestamps", func(t *testing.T) {
+		path := filepath.Join(dir, "flat")
+		require.NoError(t, ioutil.WriteFile(path, newFlatChunk(t, 10), 0644))
+		series, err := StitchFiles(ctx, []string{path}, StitchOptions{})
+		assert.Error(t, err)
+		assert.Nil(t, series)
+	})
+	t.Run("Stitch", func(t *testing.T) {
+		series, err := StitchFiles(ctx, paths, StitchOptions{
+			IsCounter: func(key string) bool { return key == "counter" },
+		})
+		require.NoError(t, err)
+		require.Len(t, series, 4)
+
+		counter := series["counter"]
+		require.NotNil(t, counter)
+		assert.Equal(t, bsontype.Int64, counter.Type)
+		require.Equal(t, 40, counter.Len())
+		require.Len(t, counter.Times, 40)
+		for idx := 1; idx < counter.Len(); idx++ {
+			assert.True(t, counter.Times[idx].After(counter.Times[idx-1]))
+		}
+		assert.Equal(t, []int{20}, counter.Gaps)
+		assert.Equal(t, []int{20}, counter.Resets)
+		assert.EqualValues(t, 100, counter.Values[0])
+		assert.EqualValues(t, 119, counter.Values[19])
+		assert.EqualValues(t, 119, counter.Values[20])
+		assert.EqualValues(t, 138, counter.Values[39])
+
+		// gauges are not counters, so decreases are not resets.
+		gauge := series["gauge"]
+		require.NotNil(t, gauge)
+		assert.Equal(t, bsontype.Int32, gauge.Type)
+		assert.Equal(t, []int{20}, gauge.Gaps)
+		assert.Empty(t, gauge.Resets)
+		assert.EqualValues(t, 0, gauge.Values[20])
+
+		extra := series["extra"]
+		require.NotNil(t, extra)
+		assert.Equal(t, 20, extra.Len())
+		assert.Empty(t, extra.Gaps)
+		assert.True(t, base.Add(30*time.Second).Equal(extra.Times[0]))
+	})
+	t.Run("Options", func(t *testing.T) {
+		series, err := StitchFiles(ctx, paths, StitchOptions{
+			GapThreshold: time.Minute,
+			Include:      func(key string) bool { return key == "counter" },
+		})
+		require.NoError(t, err)
+		require.Len(t, series, 1)
+
+		counter := series["counter"]
+		require.NotNil(t, counter)
+		assert.Empty(t, counter.Gaps)
+		assert.Empty(t, counter.Resets)
+		assert.EqualValues(t, 0, counter.Values[20])
+	})
+	t.Run("TypeChange", func(t *testing.T) {
+		path := writeFile("metrics.3", []*bsonx.Document{
+			bsonx.NewDocument(
+				bsonx.EC.Time("ts", base.Add(time.Minute)),
+				bsonx.EC.Boolean("counter", true),
+			),
+		})
+		series, err := StitchFiles(ctx, append(paths, path), StitchOptions{})
+		assert.Error(t, err)
+		assert.Nil(t, series)
+	})
+}
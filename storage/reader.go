@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/pkg/errors"
+)
+
+// objectTime returns the time in the key of an object that a sink
+// wrote with the prefix, and false for other keys.
+func objectTime(prefix, key string) (time.Time, bool) {
+	if !strings.HasPrefix(key, prefix) || len(key)-len(prefix) < len(objectTimeFormat) {
+		return time.Time{}, false
+	}
+
+	ts, err := time.Parse(objectTimeFormat, key[len(prefix):len(prefix)+len(objectTimeFormat)])
+	return ts, err == nil
+}
+
+type objectRef struct {
+	key string
+	ts  time.Time
+}
+
+// ReadObjects returns an iterator over the chunks of the objects that
+// an object sink wrote to the store with the prefix, in order, which
+// it reads from the store as the iterator reaches them. Only objects
+// that may hold samples within the [start, end) range are read, and
+// chunks are trimmed to the range, as with
+// ftdc.NewChunkIteratorWithRange. Use a zero time for either start or
+// end to leave that side of the range unbounded.
+//
+// Returns an error if the objects cannot be listed. The iterator
+// reports errors reading objects.
+func ReadObjects(ctx context.Context, store ObjectStore, prefix string, start, end time.Time) (*ftdc.ChunkIterator, error) {
+	infos, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem listing objects with prefix '%s'", prefix)
+	}
+
+	objects := []objectRef{}
+	for _, info := range infos {
+		if ts, ok := objectTime(prefix, info.Key); ok {
+			objects = append(objects, objectRef{key: info.Key, ts: ts})
+		}
+	}
+	sort.SliceStable(objects, func(i, j int) bool { return objects[i].key < objects[j].key })
+
+	// objects hold the samples from the time of their first chunk
+	// until the time of the first chunk of the next object.
+	keys := []string{}
+	for idx, obj := range objects {
+		if !end.IsZero() && !obj.ts.Before(end) {
+			break
+		}
+		if !start.IsZero() && idx+1 < len(objects) && !objects[idx+1].ts.After(start) {
+			continue
+		}
+		keys = append(keys, obj.key)
+	}
+
+	return ftdc.NewChunkIteratorWithRange(ctx, &objectReader{ctx: ctx, store: store, keys: keys}, start, end), nil
+}
+
+// objectReader reads the contents of a sequence of objects, opening
+// each object when the previous object has been read.
+type objectReader struct {
+	ctx     context.Context
+	store   ObjectStore
+	keys    []string
+	current io.ReadCloser
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.keys) == 0 {
+				return 0, io.EOF
+			}
+
+			body, err := r.store.Get(r.ctx, r.keys[0])
+			if err != nil {
+				return 0, errors.Wrapf(err, "problem reading object '%s'", r.keys[0])
+			}
+			r.current = body
+			r.keys = r.keys[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			err = r.current.Close()
+			r.current = nil
+			if n > 0 || err != nil {
+				return n, errors.WithStack(err)
+			}
+			continue
+		}
+
+		return n, errors.WithStack(err)
+	}
+}
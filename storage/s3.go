@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// S3Options configure an S3Store.
+type S3Options struct {
+	// Bucket is the name of the bucket that holds the objects.
+	Bucket string
+	// Region is the region of the bucket, which signs requests.
+	// Defaults to "us-east-1".
+	Region string
+	// Endpoint is the URL of the service (e.g.
+	// "http://localhost:9000" for a local MinIO server).
+	// Defaults to the Amazon S3 endpoint of the region.
+	Endpoint string
+	// PathStyle addresses buckets in the path of requests, rather
+	// than in the host name, which many S3 compatible services
+	// require.
+	PathStyle bool
+	// AccessKeyID, SecretAccessKey, and SessionToken are the
+	// credentials that sign requests. Requests are not signed if
+	// AccessKeyID is empty.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Client sends requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Validate ensures that the options are reasonable, and sets default
+// values.
+func (opts *S3Options) Validate() error {
+	if opts.Bucket == "" {
+		return errors.New("bucket must be specified")
+	}
+	if opts.AccessKeyID != "" && opts.SecretAccessKey == "" {
+		return errors.New("secret access key must be specified with an access key ID")
+	}
+
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", opts.Region)
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return errors.Wrap(err, "invalid endpoint")
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return errors.Errorf("endpoint '%s' must have a scheme and a host", opts.Endpoint)
+	}
+
+	return nil
+}
+
+// S3Store is an ObjectStore for Amazon S3 and other services with S3
+// compatible APIs, which uses the REST API directly.
+type S3Store struct {
+	opts     S3Options
+	endpoint *url.URL
+	now      func() time.Time
+}
+
+// NewS3Store constructs a store for the bucket, returning an error if
+// the options are not valid.
+func NewS3Store(opts S3Options) (*S3Store, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+
+	endpoint, _ := url.Parse(opts.Endpoint)
+	return &S3Store{opts: opts, endpoint: endpoint, now: time.Now}, nil
+}
+
+// objectURL returns the URL of the object, or of the bucket, if the key
+// is empty.
+func (s *S3Store) objectURL(key string, query url.Values) *url.URL {
+	out := *s.endpoint
+	path := strings.TrimSuffix(out.Path, "/")
+	if s.opts.PathStyle {
+		path += "/" + s.opts.Bucket
+	} else {
+		out.Host = s.opts.Bucket + "." + out.Host
+	}
+	if key != "" || !s.opts.PathStyle {
+		path += "/" + key
+	}
+
+	out.Path = path
+	out.RawPath = uriEncode(path, false)
+	out.RawQuery = query.Encode()
+	return &out
+}
+
+// send sends a request, and returns the response if its status is
+// successful, and an error otherwise.
+func (s *S3Store) send(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "problem creating request")
+	}
+	req = req.WithContext(ctx)
+
+	if s.opts.AccessKeyID != "" {
+		payloadHash := hashHex(body)
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+		signV4(req, credentials{
+			accessKeyID:     s.opts.AccessKeyID,
+			secretAccessKey: s.opts.SecretAccessKey,
+			sessionToken:    s.opts.SessionToken,
+		}, s.opts.Region, "s3", payloadHash, s.now())
+	}
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem sending %s request for '%s'", method, key)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return nil, newS3Error(resp.StatusCode, data)
+	}
+
+	return resp, nil
+}
+
+// do sends a request, and returns the body and the headers of the
+// response.
+func (s *S3Store) do(ctx context.Context, method, key string, query url.Values, body []byte) ([]byte, http.Header, error) {
+	resp, err := s.send(ctx, method, key, query, body)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "problem reading response for '%s'", key)
+	}
+
+	return data, resp.Header, nil
+}
+
+// S3Error is an error response from an S3 compatible service.
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("s3 request failed with status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func newS3Error(status int, body []byte) error {
+	out := &S3Error{StatusCode: status}
+	if err := xml.Unmarshal(body, out); err != nil {
+		out.Message = strings.TrimSpace(string(body))
+	}
+	return out
+}
+
+// CreateMultipartUpload starts a multipart upload of the object.
+func (s *S3Store) CreateMultipartUpload(ctx context.Context, key string) (string, error) {
+	data, _, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	result := struct {
+		UploadID string `xml:"UploadId"`
+	}{}
+	if err = xml.Unmarshal(data, &result); err != nil {
+		return "", errors.Wrap(err, "problem parsing response")
+	}
+	if result.UploadID == "" {
+		return "", errors.Errorf("response for '%s' has no upload ID", key)
+	}
+
+	return result.UploadID, nil
+}
+
+// UploadPart uploads a part of a multipart upload.
+func (s *S3Store) UploadPart(ctx context.Context, key, uploadID string, number int, data []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+	_, header, err := s.do(ctx, http.MethodPut, key, query, data)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	etag := header.Get("ETag")
+	if etag == "" {
+		return "", errors.Errorf("response for part %d of '%s' has no entity tag", number, key)
+	}
+	return etag, nil
+}
+
+// CompleteMultipartUpload creates the object from the parts of the
+// upload.
+func (s *S3Store) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error {
+	type part struct {
+		PartNumber int
+		ETag       string
+	}
+	request := struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{}
+	for _, p := range parts {
+		request.Parts = append(request.Parts, part{PartNumber: p.Number, ETag: p.ETag})
+	}
+
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return errors.Wrap(err, "problem encoding request")
+	}
+
+	data, _, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// the service may report errors after it has sent the status
+	// of the response.
+	if bytes.Contains(data, []byte("<Error>")) {
+		return newS3Error(http.StatusOK, data)
+	}
+
+	return nil
+}
+
+// AbortMultipartUpload discards the upload and its parts.
+func (s *S3Store) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	_, _, err := s.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil)
+	return errors.WithStack(err)
+}
+
+// List returns the objects whose keys begin with the prefix.
+func (s *S3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	out := []ObjectInfo{}
+
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		data, _, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		result := struct {
+			IsTruncated           bool
+			NextContinuationToken string
+			Contents              []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+		}{}
+		if err = xml.Unmarshal(data, &result); err != nil {
+			return nil, errors.Wrap(err, "problem parsing response")
+		}
+
+		for _, obj := range result.Contents {
+			out = append(out, ObjectInfo{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return out, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Get returns the contents of the object, which the caller must close.
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.send(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignV4(t *testing.T) {
+	// the example from the AWS Signature Version 4 documentation.
+	secret := "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	now := time.Date(2015, time.August, 30, 12, 36, 0, 0, time.UTC)
+
+	t.Run("SigningKey", func(t *testing.T) {
+		key := signingKey(secret, now, "us-east-1", "iam")
+		assert.Equal(t, "c4afb1cc5771d871763a393e44b703571b55cc28424d1a5e86da6ed3c154a4b9", hex.EncodeToString(key))
+	})
+	t.Run("Request", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+		signV4(req, credentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: secret}, "us-east-1", "iam", emptyPayloadHash, now)
+		assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+		assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+			"SignedHeaders=content-type;host;x-amz-date, "+
+			"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7", req.Header.Get("Authorization"))
+	})
+	t.Run("SessionToken", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "https://bucket.s3.amazonaws.com/key", nil)
+		require.NoError(t, err)
+
+		signV4(req, credentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: secret, sessionToken: "token"}, "us-east-1", "s3", emptyPayloadHash, now)
+		assert.Equal(t, "token", req.Header.Get("X-Amz-Security-Token"))
+		assert.Contains(t, req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token,")
+	})
+	t.Run("Encoding", func(t *testing.T) {
+		assert.Equal(t, "a/b%20c~d%2Be", uriEncode("a/b c~d+e", false))
+		assert.Equal(t, "a%2Fb", uriEncode("a/b", true))
+		assert.Equal(t, "a=1&a=2&b=x%2Fy&uploads=", canonicalQuery(map[string][]string{"b": {"x/y"}, "a": {"2", "1"}, "uploads": {""}}))
+	})
+}
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+// MinPartSize is the minimum size, in bytes, of all but the last part
+// of a multipart upload to S3.
+const MinPartSize = 5 * 1024 * 1024
+
+// objectTimeFormat is the format of the times in the keys of objects,
+// which sort in the order of the times.
+const objectTimeFormat = "2006-01-02T15-04-05.000Z"
+
+// ObjectSinkOptions configure an object sink.
+type ObjectSinkOptions struct {
+	// Prefix is the prefix of the key of each object (e.g.
+	// "ftdc/host-1/"), which is followed by the time of the
+	// first chunk of the object.
+	Prefix string
+	// RotateInterval is the length of time after which the sink
+	// completes an object, and writes subsequent data to a new
+	// object. Defaults to one hour.
+	RotateInterval time.Duration
+	// PartSize is the size, in bytes, of the data that the sink
+	// buffers before it uploads a part. Defaults to, and must not
+	// be less than, MinPartSize.
+	PartSize int
+}
+
+// Validate ensures that the options are reasonable, and sets default
+// values.
+func (opts *ObjectSinkOptions) Validate() error {
+	if opts.RotateInterval == 0 {
+		opts.RotateInterval = time.Hour
+	}
+	if opts.PartSize == 0 {
+		opts.PartSize = MinPartSize
+	}
+
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(opts.RotateInterval < 0, "rotation interval must not be negative")
+	catcher.NewWhen(opts.PartSize < MinPartSize, "part size must not be less than the minimum part size")
+	return catcher.Resolve()
+}
+
+type objectSink struct {
+	ctx   context.Context
+	store ObjectStore
+	opts  ObjectSinkOptions
+	now   func() time.Time
+
+	mu       sync.Mutex
+	key      string
+	uploadID string
+	opened   time.Time
+	parts    []CompletedPart
+	buf      []byte
+	seq      int
+}
+
+// NewObjectSink returns a sink that writes the data it receives to
+// objects in the store, with one multipart upload for each object,
+// returning an error if the options are not valid. Objects are named
+// with the prefix and the time of their first chunk, so that
+// ReadObjects can select the objects that hold a time range. The
+// context bounds all requests to the store.
+//
+// The sink buffers data until it has a part to upload, and completes
+// objects when they are older than the rotation interval, after a
+// write, or when you call Rotate or Close. Objects are not visible in
+// the store until they are complete.
+//
+// Write only returns an error if the sink cannot start a new object,
+// in which case it discards the data. If uploading a part, or
+// completing an object, fails during a write, the sink keeps the
+// data, logs the error, and retries with the next write, and Rotate
+// and Close return the error if the upload still fails, so that
+// collectors do not write the same data twice.
+func NewObjectSink(ctx context.Context, store ObjectStore, opts ObjectSinkOptions) (ChunkSink, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+
+	return &objectSink{
+		ctx:   ctx,
+		store: store,
+		opts:  opts,
+		now:   time.Now,
+	}, nil
+}
+
+// firstDocumentTime returns the _id of the first document of the data,
+// which is the time of chunks and metadata documents, or the zero
+// time if it does not have one.
+func firstDocumentTime(data []byte) time.Time {
+	if len(data) < 4 {
+		return time.Time{}
+	}
+	size := int(binary.LittleEndian.Uint32(data))
+	if size < 5 || size > len(data) {
+		return time.Time{}
+	}
+
+	elem, err := bsonx.Reader(data[:size]).RecursiveLookup("_id")
+	if err != nil {
+		return time.Time{}
+	}
+	ts, _ := elem.Value().TimeOK()
+	return ts
+}
+
+func (s *objectSink) open(data []byte) error {
+	now := s.now()
+	ts := firstDocumentTime(data)
+	if ts.IsZero() {
+		ts = now
+	}
+
+	s.seq++
+	key := fmt.Sprintf("%s%s-%05d.ftdc", s.opts.Prefix, ts.UTC().Format(objectTimeFormat), s.seq)
+	uploadID, err := s.store.CreateMultipartUpload(s.ctx, key)
+	if err != nil {
+		return errors.Wrapf(err, "problem starting upload of '%s'", key)
+	}
+
+	s.key, s.uploadID, s.opened = key, uploadID, now
+	s.parts = nil
+	return nil
+}
+
+func (s *objectSink) uploadPart() error {
+	number := len(s.parts) + 1
+	etag, err := s.store.UploadPart(s.ctx, s.key, s.uploadID, number, s.buf)
+	if err != nil {
+		return errors.Wrapf(err, "problem uploading part %d of '%s'", number, s.key)
+	}
+
+	s.parts = append(s.parts, CompletedPart{Number: number, ETag: etag})
+	s.buf = s.buf[:0]
+	return nil
+}
+
+func (s *objectSink) Write(data []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.uploadID == "" {
+		if err := s.open(data); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	}
+
+	s.buf = append(s.buf, data...)
+
+	var err error
+	if len(s.buf) >= s.opts.PartSize {
+		err = s.uploadPart()
+	}
+	if err == nil && s.now().Sub(s.opened) >= s.opts.RotateInterval {
+		err = s.complete()
+	}
+	grip.Warning(message.WrapError(err, message.Fields{
+		"message": "problem uploading data, which will be retried",
+		"key":     s.key,
+	}))
+
+	return len(data), nil
+}
+
+// complete uploads the buffered data as the last part of the object,
+// and completes the upload. The caller must hold the lock.
+func (s *objectSink) complete() error {
+	if s.uploadID == "" {
+		return nil
+	}
+
+	if len(s.buf) > 0 {
+		if err := s.uploadPart(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	var err error
+	if len(s.parts) == 0 {
+		err = errors.Wrapf(s.store.AbortMultipartUpload(s.ctx, s.key, s.uploadID), "problem aborting upload of '%s'", s.key)
+	} else {
+		err = errors.Wrapf(s.store.CompleteMultipartUpload(s.ctx, s.key, s.uploadID, s.parts), "problem completing upload of '%s'", s.key)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.key, s.uploadID, s.parts = "", "", nil
+	return nil
+}
+
+func (s *objectSink) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return errors.WithStack(s.complete())
+}
+
+func (s *objectSink) Close() error { return s.Rotate() }
@@ -0,0 +1,67 @@
+// Package storage ships FTDC data to object stores, such as Amazon S3
+// and other S3 compatible services, and reads it back.
+//
+// An object sink (see NewObjectSink) is a writer for collectors that
+// uploads the chunks it receives to one object for each rotation
+// period, with multipart uploads, so that it never holds more than a
+// part in memory. ReadObjects streams the chunks of the objects
+// under a prefix back, within a time range.
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ChunkSink receives FTDC data from collectors: each write must
+// contain complete documents (i.e. chunks and metadata documents), as
+// collectors and FlushCollector write them. Sinks are safe for
+// concurrent use.
+type ChunkSink interface {
+	io.Writer
+
+	// Rotate completes the object that the sink is writing, if
+	// any, so that subsequent data is written to a new object.
+	Rotate() error
+
+	// Close completes the object that the sink is writing, as
+	// Rotate does. Writing data after Close starts a new object.
+	Close() error
+}
+
+// ObjectInfo describes an object in an object store.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// CompletedPart identifies a part of a multipart upload.
+type CompletedPart struct {
+	Number int
+	ETag   string
+}
+
+// ObjectStore is the subset of the operations of S3 compatible object
+// stores that sinks and readers require. S3Store implements the
+// interface for S3 compatible services; implement it to use other
+// services.
+type ObjectStore interface {
+	// CreateMultipartUpload starts a multipart upload of the
+	// object, and returns the ID of the upload.
+	CreateMultipartUpload(ctx context.Context, key string) (string, error)
+	// UploadPart uploads a part of a multipart upload, and
+	// returns its entity tag. Parts are numbered from 1.
+	UploadPart(ctx context.Context, key, uploadID string, number int, data []byte) (string, error)
+	// CompleteMultipartUpload creates the object from the parts
+	// of the upload.
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error
+	// AbortMultipartUpload discards the upload and its parts.
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+	// List returns the objects whose keys begin with the prefix,
+	// ordered by key.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Get returns the contents of the object.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 implements the subset of the S3 REST API that S3Store uses,
+// for path style requests to a single bucket.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	nextID  int
+	// failParts is the number of part uploads that fail before
+	// uploads succeed.
+	failParts int
+	requests  []*http.Request
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+
+	if !strings.HasPrefix(r.URL.Path, "/bucket") {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code><Message>no bucket</Message></Error>", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/bucket"), "/")
+	query := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodPost && query.Get("uploadId") == "" && query["uploads"] != nil:
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", key, id)
+	case r.Method == http.MethodPut && query.Get("uploadId") != "":
+		if s.failParts > 0 {
+			s.failParts--
+			http.Error(w, "<Error><Code>SlowDown</Code><Message>slow down</Message></Error>", http.StatusServiceUnavailable)
+			return
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		s.uploads[query.Get("uploadId")][number] = body
+		w.Header().Set("ETag", fmt.Sprintf("\"etag-%d\"", number))
+	case r.Method == http.MethodPost && query.Get("uploadId") != "":
+		request := struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}{}
+		if err := xml.Unmarshal(body, &request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		parts := s.uploads[query.Get("uploadId")]
+		data := []byte{}
+		for idx, part := range request.Parts {
+			if part.PartNumber != idx+1 || part.ETag != fmt.Sprintf("\"etag-%d\"", idx+1) {
+				fmt.Fprint(w, "<Error><Code>InvalidPart</Code><Message>invalid part</Message></Error>")
+				return
+			}
+			data = append(data, parts[part.PartNumber]...)
+		}
+		s.objects[key] = data
+		delete(s.uploads, query.Get("uploadId"))
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && query.Get("uploadId") != "":
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && key == "":
+		keys := []string{}
+		for k := range s.objects {
+			if strings.HasPrefix(k, query.Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		// return one object per page, to exercise continuation.
+		start := 0
+		if token := query.Get("continuation-token"); token != "" {
+			start, _ = strconv.Atoi(token)
+		}
+		out := &bytes.Buffer{}
+		out.WriteString("<ListBucketResult>")
+		if start+1 < len(keys) {
+			fmt.Fprintf(out, "<IsTruncated>true</IsTruncated><NextContinuationToken>%d</NextContinuationToken>", start+1)
+		}
+		if start < len(keys) {
+			fmt.Fprintf(out, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>2018-06-01T00:00:00.000Z</LastModified></Contents>",
+				keys[start], len(s.objects[keys[start]]))
+		}
+		out.WriteString("</ListBucketResult>")
+		_, _ = w.Write(out.Bytes())
+	case r.Method == http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code><Message>no key</Message></Error>", http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	default:
+		http.Error(w, "unsupported request", http.StatusBadRequest)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for name, opts := range map[string]S3Options{
+			"NoBucket":   {},
+			"NoSecret":   {Bucket: "bucket", AccessKeyID: "key"},
+			"NoScheme":   {Bucket: "bucket", Endpoint: "localhost:9000"},
+			"BadAddress": {Bucket: "bucket", Endpoint: "http://[::1"},
+		} {
+			_, err := NewS3Store(opts)
+			assert.Error(t, err, name)
+		}
+	})
+	t.Run("Addressing", func(t *testing.T) {
+		store, err := NewS3Store(S3Options{Bucket: "bucket", Region: "eu-west-1"})
+		require.NoError(t, err)
+		assert.Equal(t, "https://bucket.s3.eu-west-1.amazonaws.com/a/b%20c.ftdc", store.objectURL("a/b c.ftdc", nil).String())
+		assert.Equal(t, "https://bucket.s3.eu-west-1.amazonaws.com/?prefix=a", store.objectURL("", map[string][]string{"prefix": {"a"}}).String())
+
+		store, err = NewS3Store(S3Options{Bucket: "bucket", Endpoint: "http://localhost:9000/", PathStyle: true})
+		require.NoError(t, err)
+		assert.Equal(t, "http://localhost:9000/bucket/key", store.objectURL("key", nil).String())
+		assert.Equal(t, "http://localhost:9000/bucket", store.objectURL("", nil).String())
+	})
+	t.Run("Operations", func(t *testing.T) {
+		store, err := NewS3Store(S3Options{
+			Bucket:          "bucket",
+			Endpoint:        server.URL,
+			PathStyle:       true,
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "secret",
+		})
+		require.NoError(t, err)
+
+		id, err := store.CreateMultipartUpload(ctx, "prefix/one")
+		require.NoError(t, err)
+		etag, err := store.UploadPart(ctx, "prefix/one", id, 1, []byte("hello "))
+		require.NoError(t, err)
+		etag2, err := store.UploadPart(ctx, "prefix/one", id, 2, []byte("world"))
+		require.NoError(t, err)
+		require.NoError(t, store.CompleteMultipartUpload(ctx, "prefix/one", id, []CompletedPart{{1, etag}, {2, etag2}}))
+
+		id, err = store.CreateMultipartUpload(ctx, "prefix/two")
+		require.NoError(t, err)
+		_, err = store.UploadPart(ctx, "prefix/two", id, 1, []byte("data"))
+		require.NoError(t, err)
+		err = store.CompleteMultipartUpload(ctx, "prefix/two", id, []CompletedPart{{1, "wrong"}})
+		require.Error(t, err, "errors in successful responses are reported")
+		assert.Equal(t, "InvalidPart", errors.Cause(err).(*S3Error).Code)
+		require.NoError(t, store.AbortMultipartUpload(ctx, "prefix/two", id))
+
+		id, err = store.CreateMultipartUpload(ctx, "prefix/three")
+		require.NoError(t, err)
+		_, err = store.UploadPart(ctx, "prefix/three", id, 1, []byte("three"))
+		require.NoError(t, err)
+		require.NoError(t, store.CompleteMultipartUpload(ctx, "prefix/three", id, []CompletedPart{{1, "\"etag-1\""}}))
+
+		infos, err := store.List(ctx, "prefix/")
+		require.NoError(t, err)
+		require.Len(t, infos, 2)
+		assert.Equal(t, "prefix/one", infos[0].Key)
+		assert.EqualValues(t, 11, infos[0].Size)
+		assert.Equal(t, "prefix/three", infos[1].Key)
+
+		body, err := store.Get(ctx, "prefix/one")
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(body)
+		require.NoError(t, err)
+		require.NoError(t, body.Close())
+		assert.Equal(t, "hello world", string(data))
+
+		_, err = store.Get(ctx, "prefix/missing")
+		require.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, errors.Cause(err).(*S3Error).StatusCode)
+		assert.Equal(t, "NoSuchKey", errors.Cause(err).(*S3Error).Code)
+
+		for _, req := range fake.requests {
+			assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), req.URL.String())
+			assert.Contains(t, req.Header.Get("Authorization"), "/us-east-1/s3/aws4_request")
+			assert.NotEmpty(t, req.Header.Get("X-Amz-Content-Sha256"))
+		}
+	})
+}
+
+func TestObjectSink(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(i int) *bsonx.Document {
+		return bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Minute)),
+			bsonx.EC.Int64("counter", int64(i)),
+		)
+	}
+
+	newStore := func(t *testing.T) (*fakeS3, *S3Store) {
+		fake := newFakeS3()
+		server := httptest.NewServer(fake)
+		t.Cleanup(server.Close)
+
+		store, err := NewS3Store(S3Options{Bucket: "bucket", Endpoint: server.URL, PathStyle: true})
+		require.NoError(t, err)
+		return fake, store
+	}
+
+	// write collects 120 samples, one per minute, in chunks of 10
+	// samples, with the clock of the sink at the time of the last
+	// sample of each chunk, and the time of the first sample of
+	// each chunk as its _id.
+	write := func(t *testing.T, sink ChunkSink) {
+		collector := ftdc.NewBaseCollector(10)
+		for i := 0; i < 120; i++ {
+			sink.(*objectSink).now = func() time.Time { return base.Add(time.Duration(i) * time.Minute) }
+			require.NoError(t, collector.Add(sample(i)))
+			if collector.Info().SampleCount == 10 {
+				payload, err := collector.Resolve()
+				require.NoError(t, err)
+				doc, err := bsonx.ReadDocument(payload)
+				require.NoError(t, err)
+				_, err = doc.Set(bsonx.EC.Time("_id", base.Add(time.Duration(i-9)*time.Minute))).WriteTo(sink)
+				require.NoError(t, err)
+				collector.Reset()
+			}
+		}
+		require.NoError(t, sink.Close())
+	}
+
+	read := func(t *testing.T, store ObjectStore, start, end time.Time) []int64 {
+		iter, err := ReadObjects(ctx, store, "host/", start, end)
+		require.NoError(t, err)
+		defer iter.Close()
+
+		out := []int64{}
+		for iter.Next() {
+			out = append(out, iter.Chunk().Metrics[1].Values...)
+		}
+		require.NoError(t, iter.Err())
+		return out
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		_, store := newStore(t)
+		_, err := NewObjectSink(ctx, store, ObjectSinkOptions{PartSize: 1024})
+		assert.Error(t, err)
+		_, err = NewObjectSink(ctx, store, ObjectSinkOptions{RotateInterval: -time.Second})
+		assert.Error(t, err)
+	})
+	t.Run("RotatesObjects", func(t *testing.T) {
+		fake, store := newStore(t)
+		sink, err := NewObjectSink(ctx, store, ObjectSinkOptions{Prefix: "host/", RotateInterval: 30 * time.Minute})
+		require.NoError(t, err)
+		write(t, sink)
+
+		keys := []string{}
+		for key := range fake.objects {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		assert.Equal(t, []string{
+			"host/2018-06-01T00-00-00.000Z-00001.ftdc",
+			"host/2018-06-01T00-40-00.000Z-00002.ftdc",
+			"host/2018-06-01T01-20-00.000Z-00003.ftdc",
+		}, keys)
+		assert.Empty(t, fake.uploads)
+
+		values := read(t, store, time.Time{}, time.Time{})
+		require.Len(t, values, 120)
+		for i, value := range values {
+			assert.EqualValues(t, i, value)
+		}
+	})
+	t.Run("TimeRange", func(t *testing.T) {
+		fake, store := newStore(t)
+		sink, err := NewObjectSink(ctx, store, ObjectSinkOptions{Prefix: "host/", RotateInterval: 30 * time.Minute})
+		require.NoError(t, err)
+		write(t, sink)
+
+		fake.requests = nil
+		values := read(t, store, base.Add(45*time.Minute), base.Add(75*time.Minute))
+		require.Len(t, values, 30)
+		assert.EqualValues(t, 45, values[0])
+		assert.EqualValues(t, 74, values[29])
+
+		gets := 0
+		for _, req := range fake.requests {
+			if req.Method == http.MethodGet && req.URL.Query().Get("list-type") == "" {
+				gets++
+			}
+		}
+		assert.Equal(t, 1, gets, "only objects within the range are read")
+
+		assert.Len(t, read(t, store, base.Add(100*time.Minute), time.Time{}), 20)
+		assert.Len(t, read(t, store, time.Time{}, base.Add(15*time.Minute)), 15)
+		assert.Empty(t, read(t, store, base.Add(-time.Hour), base))
+	})
+	t.Run("Parts", func(t *testing.T) {
+		fake, store := newStore(t)
+		sink, err := NewObjectSink(ctx, store, ObjectSinkOptions{Prefix: "host/"})
+		require.NoError(t, err)
+
+		chunk := make([]byte, MinPartSize/2+1)
+		for i := 0; i < 5; i++ {
+			_, err = sink.Write(chunk)
+			require.NoError(t, err)
+		}
+		require.Len(t, fake.uploads, 1)
+		for _, parts := range fake.uploads {
+			assert.Len(t, parts, 2)
+		}
+		require.NoError(t, sink.Close())
+		require.Len(t, fake.objects, 1)
+		for _, data := range fake.objects {
+			assert.Len(t, data, 5*len(chunk))
+		}
+
+		require.NoError(t, sink.Close(), "closing an idle sink is a noop")
+	})
+	t.Run("RetriesUploads", func(t *testing.T) {
+		fake, store := newStore(t)
+		sink, err := NewObjectSink(ctx, store, ObjectSinkOptions{Prefix: "host/"})
+		require.NoError(t, err)
+
+		fake.failParts = 2
+		_, err = sink.Write(make([]byte, MinPartSize))
+		require.NoError(t, err, "writes do not report failed uploads")
+		assert.Error(t, sink.Close(), "close reports uploads that still fail")
+		require.NoError(t, sink.Close())
+
+		require.Len(t, fake.objects, 1)
+		for _, data := range fake.objects {
+			assert.Len(t, data, MinPartSize)
+		}
+	})
+	t.Run("CreateFails", func(t *testing.T) {
+		store, err := NewS3Store(S3Options{Bucket: "missing", Endpoint: "http://127.0.0.1:1", PathStyle: true})
+		require.NoError(t, err)
+		sink, err := NewObjectSink(ctx, store, ObjectSinkOptions{})
+		require.NoError(t, err)
+
+		n, err := sink.Write([]byte("data"))
+		assert.Error(t, err)
+		assert.Zero(t, n)
+	})
+}
@@ -0,0 +1,176 @@
+package ftdc
+
+import (
+	"context"
+	"io"
+	"math"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+)
+
+// MetricSummary holds summary statistics of the values of a metric.
+// Values are converted to floats: date time values are milliseconds
+// since the Unix epoch, and boolean values are 0 or 1. The minimum
+// and maximum ignore NaN values, which make the mean NaN.
+type MetricSummary struct {
+	Key   string
+	Type  bsontype.Type
+	Count int
+	Min   float64
+	Max   float64
+	Mean  float64
+	First float64
+	Last  float64
+	// Delta is the difference between the last and first values.
+	Delta float64
+}
+
+// FileSummary holds the summary statistics of the metrics of a stream
+// of chunks, in the order in which the metrics first appear.
+type FileSummary struct {
+	Chunks  int
+	Samples int
+	Metrics []MetricSummary
+}
+
+func newMetricSummary(key string, t bsontype.Type) MetricSummary {
+	return MetricSummary{
+		Key:  key,
+		Type: t,
+		Min:  math.Inf(1),
+		Max:  math.Inf(-1),
+	}
+}
+
+// add records the next value of the metric.
+func (s *MetricSummary) add(value float64) {
+	if s.Count == 0 {
+		s.First = value
+	}
+	s.Count++
+	s.Last = value
+	s.Delta = s.Last - s.First
+	s.Mean += (value - s.Mean) / float64(s.Count)
+
+	if value < s.Min {
+		s.Min = value
+	}
+	if value > s.Max {
+		s.Max = value
+	}
+}
+
+// merge combines the summary of values that follow the values of
+// the summary.
+func (s *MetricSummary) merge(next MetricSummary) {
+	if next.Count == 0 {
+		return
+	}
+	if s.Count == 0 {
+		*s = next
+		return
+	}
+
+	count := s.Count + next.Count
+	s.Mean = s.Mean*(float64(s.Count)/float64(count)) + next.Mean*(float64(next.Count)/float64(count))
+	s.Count = count
+	s.Last = next.Last
+	s.Delta = s.Last - s.First
+	s.Min = math.Min(s.Min, next.Min)
+	s.Max = math.Max(s.Max, next.Max)
+}
+
+// Summary returns the summary statistics of each metric in the chunk,
+// in the order of the metrics, which it computes from the values of
+// the metrics, without building the documents of the samples.
+func (c *Chunk) Summary() []MetricSummary {
+	out := make([]MetricSummary, len(c.Metrics))
+	for idx := range c.Metrics {
+		m := &c.Metrics[idx]
+		out[idx] = newMetricSummary(m.Key(), m.originalType)
+		for _, value := range m.Values {
+			out[idx].add(metricValue(m.originalType, value))
+		}
+	}
+	return out
+}
+
+// summary returns the summary statistics of each metric in the chunk,
+// which it computes as it decodes the deltas of each column, without
+// expanding the values of the metrics. It consumes the chunk.
+func (c *lazyChunk) summary() ([]MetricSummary, error) {
+	out := make([]MetricSummary, len(c.metrics))
+	for i := range c.metrics {
+		t := c.metrics[i].originalType
+		out[i] = newMetricSummary(c.keys[i], t)
+		out[i].add(metricValue(t, c.columns[i].value))
+
+		for sample := 1; sample < c.nPoints; sample++ {
+			if err := c.advance(i); err != nil {
+				return nil, errors.Wrapf(err, "problem decoding metric '%s'", c.keys[i])
+			}
+			out[i].add(metricValue(t, c.columns[i].value))
+		}
+	}
+	c.sample = c.nPoints
+
+	return out, nil
+}
+
+// SummarizeFile returns the summary statistics of the metrics in a
+// stream of chunks (e.g. an FTDC file), which it computes from the
+// deltas of each chunk, without expanding the values of the metrics
+// or building the documents of the samples, so that the memory used
+// is proportional to the size of a chunk's payload. Metrics that only
+// some chunks hold are summarized over the chunks that hold them.
+func SummarizeFile(ctx context.Context, r io.Reader) (*FileSummary, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	docs := make(chan *bsonx.Document)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- readDiagnostic(ctx, r, docs)
+	}()
+
+	out := &FileSummary{}
+	index := map[string]int{}
+	for doc := range docs {
+		if !isNum(1, doc.Lookup("type")) {
+			continue
+		}
+
+		chunk, err := newLazyChunk(doc)
+		recordDecode(err)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem reading chunk #%d", out.Chunks+1)
+		}
+		summaries, err := chunk.summary()
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem summarizing chunk #%d", out.Chunks+1)
+		}
+
+		out.Chunks++
+		out.Samples += chunk.nPoints
+		for _, summary := range summaries {
+			idx, ok := index[summary.Key]
+			if !ok {
+				index[summary.Key] = len(out.Metrics)
+				out.Metrics = append(out.Metrics, summary)
+				continue
+			}
+			out.Metrics[idx].merge(summary)
+		}
+	}
+
+	if err := <-errs; err != nil {
+		return nil, errors.Wrap(err, "problem reading chunks")
+	}
+	if ctx.Err() != nil {
+		return nil, errors.New("operation aborted")
+	}
+
+	return out, nil
+}
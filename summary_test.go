@@ -0,0 +1,182 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	sample := func(i int) *bsonx.Document {
+		return bsonx.NewDocument(
+			bsonx.EC.Time("ts", start.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("counter", int64(i*i)),
+			bsonx.EC.Int32("gauge", int32(10-i%7)),
+			bsonx.EC.Double("ratio", float64(i)/4),
+			bsonx.EC.Boolean("up", i%3 != 0),
+		)
+	}
+
+	for name, newCollector := range map[string]func(io.Writer) Collector{
+		"Streaming":            func(w io.Writer) Collector { return NewStreamingCollector(10, w) },
+		"FloatPreserving":      func(w io.Writer) Collector { return NewStreamingFloatPreservingCollector(10, w) },
+		"TimestampCompressing": func(w io.Writer) Collector { return NewStreamingTimestampCompressingCollector(10, w) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			collector := newCollector(buf)
+			for i := 0; i < 25; i++ {
+				require.NoError(t, collector.Add(sample(i)))
+			}
+			require.NoError(t, FlushCollector(collector, buf))
+
+			// the summaries of chunks agree with their values,
+			// and the summary of the file combines them.
+			expected := map[string]*MetricSummary{}
+			keys := []string{}
+			chunks := 0
+			iter := ReadChunks(ctx, bytes.NewReader(buf.Bytes()))
+			for iter.Next() {
+				chunk := iter.Chunk()
+				chunks++
+				summaries := chunk.Summary()
+				require.Len(t, summaries, len(chunk.Metrics))
+				for idx, summary := range summaries {
+					m := chunk.Metrics[idx]
+					assert.Equal(t, m.Key(), summary.Key)
+					assert.Equal(t, m.Type(), summary.Type)
+					assert.Equal(t, len(m.Values), summary.Count)
+					assert.Equal(t, metricValue(m.Type(), m.Values[0]), summary.First)
+					assert.Equal(t, metricValue(m.Type(), m.Values[len(m.Values)-1]), summary.Last)
+					assert.Equal(t, summary.Last-summary.First, summary.Delta)
+
+					if _, ok := expected[summary.Key]; !ok {
+						expected[summary.Key] = &MetricSummary{}
+						keys = append(keys, summary.Key)
+					}
+					for _, value := range m.Values {
+						s := expected[summary.Key]
+						if s.Count == 0 {
+							*s = newMetricSummary(summary.Key, summary.Type)
+						}
+						s.add(metricValue(m.Type(), value))
+					}
+				}
+			}
+			iter.Close()
+			require.NoError(t, iter.Err())
+			assert.Equal(t, 3, chunks)
+
+			summary, err := SummarizeFile(ctx, bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			assert.Equal(t, 3, summary.Chunks)
+			assert.Equal(t, 25, summary.Samples)
+			require.Len(t, summary.Metrics, len(keys))
+			for idx, key := range keys {
+				actual := summary.Metrics[idx]
+				assert.Equal(t, key, actual.Key)
+				assert.Equal(t, expected[key].Count, actual.Count)
+				assert.Equal(t, expected[key].Min, actual.Min)
+				assert.Equal(t, expected[key].Max, actual.Max)
+				assert.InDelta(t, expected[key].Mean, actual.Mean, 1e-9)
+				assert.Equal(t, expected[key].First, actual.First)
+				assert.Equal(t, expected[key].Last, actual.Last)
+				assert.Equal(t, expected[key].Delta, actual.Delta)
+			}
+		})
+	}
+	t.Run("Values", func(t *testing.T) {
+		collector := NewFloatPreservingCollector(100)
+		for i := 0; i < 25; i++ {
+			require.NoError(t, collector.Add(sample(i)))
+		}
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		summary, err := SummarizeFile(ctx, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Len(t, summary.Metrics, 5)
+
+		ts := summary.Metrics[0]
+		assert.Equal(t, bsontype.DateTime, ts.Type)
+		assert.Equal(t, float64(epochMs(start)), ts.Min)
+		assert.Equal(t, float64(24000), ts.Delta)
+
+		counter := summary.Metrics[1]
+		assert.Equal(t, MetricSummary{
+			Key: "counter", Type: bsontype.Int64, Count: 25,
+			Min: 0, Max: 576, Mean: 196, First: 0, Last: 576, Delta: 576,
+		}, counter)
+
+		gauge := summary.Metrics[2]
+		assert.Equal(t, float64(4), gauge.Min)
+		assert.Equal(t, float64(10), gauge.Max)
+		assert.Equal(t, float64(-3), gauge.Delta)
+
+		ratio := summary.Metrics[3]
+		assert.Equal(t, 6.0, ratio.Max)
+		assert.InDelta(t, 3.0, ratio.Mean, 1e-9)
+
+		up := summary.Metrics[4]
+		assert.Equal(t, float64(0), up.Min)
+		assert.Equal(t, float64(1), up.Max)
+		assert.InDelta(t, 16.0/25, up.Mean, 1e-9)
+	})
+	t.Run("SchemaChanges", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		collector := NewStreamingDynamicCollector(100, buf)
+		for i := 0; i < 10; i++ {
+			doc := bsonx.NewDocument(bsonx.EC.Int64("a", int64(i)))
+			if i >= 5 {
+				doc.Append(bsonx.EC.Int64("b", int64(i)))
+			}
+			require.NoError(t, collector.Add(doc))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		summary, err := SummarizeFile(ctx, bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, 2, summary.Chunks)
+		require.Len(t, summary.Metrics, 2)
+		assert.Equal(t, 10, summary.Metrics[0].Count)
+		assert.Equal(t, 4.5, summary.Metrics[0].Mean)
+		assert.Equal(t, 5, summary.Metrics[1].Count)
+		assert.Equal(t, float64(5), summary.Metrics[1].First)
+	})
+	t.Run("NaN", func(t *testing.T) {
+		s := newMetricSummary("x", bsontype.Double)
+		for _, value := range []float64{1, math.NaN(), 3} {
+			s.add(value)
+		}
+		assert.Equal(t, float64(1), s.Min)
+		assert.Equal(t, float64(3), s.Max)
+		assert.True(t, math.IsNaN(s.Mean))
+	})
+	t.Run("Errors", func(t *testing.T) {
+		_, err := SummarizeFile(ctx, bytes.NewReader([]byte{1, 2, 3, 4, 5, 6}))
+		assert.Error(t, err)
+
+		data := newFlatChunk(t, 10)
+		cctx, ccancel := context.WithCancel(ctx)
+		ccancel()
+		_, err = SummarizeFile(cctx, bytes.NewReader(bytes.Repeat(data, 100)))
+		assert.Error(t, err)
+
+		summary, err := SummarizeFile(ctx, bytes.NewReader(nil))
+		require.NoError(t, err)
+		assert.Zero(t, summary.Chunks)
+		assert.Empty(t, summary.Metrics)
+	})
+}
@@ -0,0 +1,92 @@
+package ftdc
+
+import (
+	"io"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/pkg/errors"
+)
+
+// The standard payload stores the deltas of date time metrics like
+// those of any other integer metric, so the deltas of a timestamp
+// collected at a regular interval are the same, non-zero, value for
+// every sample. Chunks written by timestamp compressing collectors
+// instead store the difference between consecutive deltas of date
+// time metrics (delta-of-delta, as in Gorilla), which is zero, and so
+// run-length encoded, while the interval between samples is constant.
+// The differences are zig-zag encoded, so that the small negative
+// differences of a nearly constant interval are encoded in one or two
+// bytes, rather than ten.
+//
+// These chunks hold the name of the encoding in the "times" field of
+// the chunk document, and are read transparently by this package,
+// but may not be readable by other FTDC implementations.
+const (
+	timeEncodingField        = "times"
+	timeEncodingDeltaOfDelta = "dod"
+)
+
+// NewTimestampCompressingCollector provides a collector that is
+// equivalent to the basic collector, except that it stores date time
+// metrics with delta-of-delta encoding, which greatly reduces the
+// size of the timestamps of high frequency captures.
+func NewTimestampCompressingCollector(maxSize int) Collector {
+	return &betterCollector{
+		maxDeltas: maxSize,
+		dodTimes:  true,
+	}
+}
+
+// NewStreamingTimestampCompressingCollector provides a streaming
+// collector (see NewStreamingCollector) that writes chunks in the
+// same format as the timestamp compressing collector.
+func NewStreamingTimestampCompressingCollector(maxSamples int, writer io.Writer) Collector {
+	c := newStreamingCollector(maxSamples, writer)
+	c.Collector.(*betterCollector).dodTimes = true
+	return c
+}
+
+// dodTimesEnabled reports whether the chunk document uses the
+// delta-of-delta encoding for date time metrics.
+func dodTimesEnabled(doc *bsonx.Document) (bool, error) {
+	elem := doc.LookupElement(timeEncodingField)
+	if elem == nil {
+		return false, nil
+	}
+
+	encoding, ok := elem.Value().StringValueOK()
+	if !ok {
+		return false, errors.New("time encoding field is not a string")
+	}
+	if encoding != timeEncodingDeltaOfDelta {
+		return false, errors.Errorf("unsupported time encoding '%s'", encoding)
+	}
+
+	return true, nil
+}
+
+// deltaOfDeltas returns the zig-zag encoded differences between
+// consecutive deltas, where the first delta is relative to a delta of
+// zero.
+func deltaOfDeltas(deltas []int64) []int64 {
+	out := make([]int64, len(deltas))
+	var previous int64
+	for idx, delta := range deltas {
+		out[idx] = zigzag(delta - previous)
+		previous = delta
+	}
+	return out
+}
+
+// undeltaOfDeltas reverses deltaOfDeltas, in place.
+func undeltaOfDeltas(dods []int64) []int64 {
+	var previous int64
+	for idx, dod := range dods {
+		previous += unzigzag(dod)
+		dods[idx] = previous
+	}
+	return dods
+}
+
+func zigzag(v int64) int64   { return (v << 1) ^ (v >> 63) }
+func unzigzag(v int64) int64 { return int64(uint64(v)>>1) ^ -(v & 1) }
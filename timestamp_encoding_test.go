@@ -0,0 +1,134 @@
+package ftdc
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimestampCompressingCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// samples are collected every 10ms, with some jitter, and the
+	// clock goes backwards once.
+	start := time.Date(2019, time.March, 1, 0, 0, 0, 0, time.UTC)
+	samples := make([]*bsonx.Document, 1000)
+	for idx := range samples {
+		ts := start.Add(time.Duration(idx) * 10 * time.Millisecond)
+		switch {
+		case idx%100 == 7:
+			ts = ts.Add(3 * time.Millisecond)
+		case idx == 500:
+			ts = ts.Add(-time.Second)
+		}
+		samples[idx] = bsonx.NewDocument(
+			bsonx.EC.Time("ts", ts),
+			bsonx.EC.Int64("counter", int64(idx*7)),
+			bsonx.EC.SubDocumentFromElements("nested", bsonx.EC.Time("started", start)),
+		)
+	}
+
+	resolve := func(t *testing.T, collector Collector) []byte {
+		for _, doc := range samples {
+			require.NoError(t, collector.Add(doc))
+		}
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+		return data
+	}
+	readChunk := func(t *testing.T, data []byte) *Chunk {
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		require.True(t, iter.Next())
+		chunk := iter.Chunk()
+		require.False(t, iter.Next())
+		require.NoError(t, iter.Err())
+		return chunk
+	}
+
+	base := NewBaseCollector(len(samples))
+	expected := readChunk(t, resolve(t, base))
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		collector := NewTimestampCompressingCollector(len(samples))
+		data := resolve(t, collector)
+
+		// the delta-of-deltas of most timestamps are zero, and
+		// are run-length encoded, rather than stored per sample.
+		size, baseSize := collector.(StatsCollector).Stats().UncompressedPayloadSize, base.(StatsCollector).Stats().UncompressedPayloadSize
+		assert.True(t, size < baseSize-len(samples)/2, "%d vs %d", size, baseSize)
+
+		doc, err := bsonx.ReadDocument(data)
+		require.NoError(t, err)
+		assert.Equal(t, timeEncodingDeltaOfDelta, doc.Lookup(timeEncodingField).StringValue())
+
+		chunk := readChunk(t, data)
+		require.Len(t, chunk.Metrics, len(expected.Metrics))
+		for idx := range expected.Metrics {
+			assert.Equal(t, expected.Metrics[idx].Values, chunk.Metrics[idx].Values, expected.Metrics[idx].Key())
+		}
+
+		// the lazy iterator decodes the same samples.
+		iter := ReadLazyMetrics(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		idx := 0
+		for ; iter.Next(); idx++ {
+			assert.Equal(t, samples[idx].Lookup("ts").Time(), iter.Document().Lookup("ts").Time(), "sample %d", idx)
+		}
+		require.NoError(t, iter.Err())
+		assert.Equal(t, len(samples), idx)
+	})
+	t.Run("Streaming", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		collector := NewStreamingTimestampCompressingCollector(len(samples), buf)
+		for _, doc := range samples {
+			require.NoError(t, collector.Add(doc))
+		}
+		require.NoError(t, FlushCollector(collector, buf))
+
+		chunk := readChunk(t, buf.Bytes())
+		assert.Equal(t, expected.Metrics[0].Values, chunk.Metrics[0].Values)
+	})
+	t.Run("StandardFormatWithoutTimes", func(t *testing.T) {
+		collector := NewTimestampCompressingCollector(10)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, collector.Add(bsonx.NewDocument(bsonx.EC.Int64("counter", int64(i)))))
+		}
+		data, err := collector.Resolve()
+		require.NoError(t, err)
+
+		doc, err := bsonx.ReadDocument(data)
+		require.NoError(t, err)
+		assert.Nil(t, doc.LookupElement(timeEncodingField))
+	})
+	t.Run("UnsupportedEncoding", func(t *testing.T) {
+		doc, err := bsonx.ReadDocument(resolve(t, NewTimestampCompressingCollector(len(samples))))
+		require.NoError(t, err)
+		doc.Set(bsonx.EC.String(timeEncodingField, "gorilla"))
+		data, err := doc.MarshalBSON()
+		require.NoError(t, err)
+
+		iter := ReadChunks(ctx, bytes.NewReader(data))
+		defer iter.Close()
+		assert.False(t, iter.Next())
+		assert.Error(t, iter.Err())
+	})
+	t.Run("Encoding", func(t *testing.T) {
+		for _, v := range []int64{0, 1, -1, 63, -64, math.MaxInt64, math.MinInt64} {
+			assert.Equal(t, v, unzigzag(zigzag(v)))
+		}
+		assert.EqualValues(t, 1, zigzag(-1))
+
+		deltas := []int64{10, 10, 10, 9, 11, -1000, 10}
+		dods := deltaOfDeltas(deltas)
+		assert.Equal(t, []int64{20, 0, 0, 1, 4, 2021, 2020}, dods)
+		assert.Equal(t, deltas, undeltaOfDeltas(dods))
+	})
+}
@@ -1,14 +1,14 @@
 package ftdc
 
 import (
-	"bytes"
-	"compress/zlib"
 	"encoding/binary"
 	"math"
+	"math/bits"
 	"time"
 
 	"github.com/mongodb/ftdc/bsonx"
 	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/mongodb/grip"
 	"github.com/mongodb/grip/message"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
@@ -39,6 +39,18 @@ func readDocument(in interface{}) (*bsonx.Document, error) {
 	}
 }
 
+// resolveErrors returns the error of the catcher, which is the
+// original error, rather than a copy of its message, when the catcher
+// only holds one error, so that callers can inspect its cause (e.g. a
+// ChecksumError.)
+func resolveErrors(catcher grip.Catcher) error {
+	if errs := catcher.Errors(); len(errs) == 1 {
+		return errs[0]
+	}
+
+	return catcher.Resolve()
+}
+
 func getOffset(count, sample, metric int) int { return metric*count + sample }
 
 func undeltaFloats(value int64, deltas []int64) []int64 {
@@ -71,25 +83,23 @@ func encodeValue(val int64) []byte {
 	return tmp[:num]
 }
 
-func compressBuffer(input []byte) ([]byte, error) {
-	buf := bytes.NewBuffer([]byte{})
-	zbuf := zlib.NewWriter(buf)
-
-	var err error
-
-	buf.Write(encodeSizeValue(uint32(len(input))))
-
-	_, err = zbuf.Write(input)
-	if err != nil {
-		return nil, err
+// uvarintSize returns the number of bytes of the varint encoding of
+// the value.
+func uvarintSize(val uint64) int {
+	if val == 0 {
+		return 1
 	}
+	return (bits.Len64(val) + 6) / 7
+}
 
-	err = zbuf.Close()
-	if err != nil {
-		return nil, err
+// zeroRunSize returns the number of bytes of the encoding of a run of
+// zero deltas of the length, which is a zero followed by the number of
+// additional zeros.
+func zeroRunSize(length int) int {
+	if length == 0 {
+		return 0
 	}
-
-	return buf.Bytes(), nil
+	return 1 + uvarintSize(uint64(length-1))
 }
 
 func normalizeFloat(in float64) int64 { return int64(math.Float64bits(in)) }
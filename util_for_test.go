@@ -161,6 +161,22 @@ func createCollectors() []*customCollector {
 			name:    "Better",
 			factory: func() Collector { return NewBaseCollector(1000) },
 		},
+		{
+			name:    "Grouping",
+			factory: func() Collector { return NewGroupingCollector(1000) },
+		},
+		{
+			name:    "FloatPreserving",
+			factory: func() Collector { return NewFloatPreservingCollector(1000) },
+		},
+		{
+			name:    "SnappyCompression",
+			factory: func() Collector { return NewCompressedCollector(1000, CompressionSnappy) },
+		},
+		{
+			name:    "LZ4Compression",
+			factory: func() Collector { return NewCompressedCollector(1000, CompressionLZ4) },
+		},
 		{
 			name:      "SmallBatch",
 			factory:   func() Collector { return NewBatchCollector(10) },
@@ -181,6 +197,15 @@ func createCollectors() []*customCollector {
 			factory:   func() Collector { return NewBatchCollector(10000) },
 			skipBench: true,
 		},
+		{
+			name:      "MetadataHistory",
+			factory:   func() Collector { return NewMetadataCollector(NewBaseCollector(1000)) },
+			skipBench: true,
+		},
+		{
+			name:    "Sharded",
+			factory: func() Collector { return NewShardedCollector(100, 4) },
+		},
 		{
 			name:      "SmallDynamic",
 			factory:   func() Collector { return NewDynamicCollector(10) },
@@ -229,6 +254,10 @@ func createCollectors() []*customCollector {
 			name:    "LargeStreamingDynamic",
 			factory: func() Collector { return NewStreamingDynamicCollector(10000, &bytes.Buffer{}) },
 		},
+		{
+			name:    "SmallStreamingSchemaTracking",
+			factory: func() Collector { return NewStreamingSchemaTrackingCollector(100, &bytes.Buffer{}) },
+		},
 		{
 			name:         "UncompressedSmallJSON",
 			factory:      func() Collector { return NewUncompressedCollectorJSON(10) },
@@ -0,0 +1,125 @@
+package window
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/mongodb/ftdc/bsonx/bsontype"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type teeCollector struct {
+	store *Store
+	ftdc.Collector
+}
+
+// NewTeeCollector wraps a collector so that every sample that the
+// collector accepts is also added to the store. The wrapper decodes
+// each sample once, and passes the decoded document to the wrapped
+// collector. Samples that the wrapped collector rejects are not
+// added to the store.
+func NewTeeCollector(store *Store, collector ftdc.Collector) ftdc.Collector {
+	return &teeCollector{
+		store:     store,
+		Collector: collector,
+	}
+}
+
+func (c *teeCollector) Add(in interface{}) error {
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err = c.Collector.Add(doc); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.Wrap(c.store.Add(doc), "problem adding sample to window")
+}
+
+func readDocument(in interface{}) (*bsonx.Document, error) {
+	switch doc := in.(type) {
+	case *bsonx.Document:
+		return doc, nil
+	case []byte:
+		return bsonx.ReadDocument(doc)
+	case bson.Marshaler:
+		data, err := doc.MarshalBSON()
+		if err != nil {
+			return nil, errors.Wrap(err, "problem with unmarshaler")
+		}
+		return bsonx.ReadDocument(data)
+	default:
+		data, err := bson.Marshal(in)
+		if err != nil {
+			return nil, errors.Wrap(err, "problem with fallback marshaling")
+		}
+		return bsonx.ReadDocument(data)
+	}
+}
+
+// flatten returns the flattened names and the values of the metrics
+// of the document, and the time of the sample, which is zero if the
+// document does not have the time metric.
+func flatten(doc *bsonx.Document, timeKey string) ([]string, []float64, time.Time) {
+	f := &flattener{timeKey: timeKey}
+	f.document("", doc)
+	return f.keys, f.values, f.ts
+}
+
+type flattener struct {
+	timeKey string
+	ts      time.Time
+	keys    []string
+	values  []float64
+}
+
+func (f *flattener) document(prefix string, doc *bsonx.Document) {
+	iter := doc.Iterator()
+	for iter.Next() {
+		elem := iter.Element()
+		key := elem.Key()
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		f.value(key, elem.Value())
+	}
+}
+
+func (f *flattener) value(key string, val *bsonx.Value) {
+	switch val.Type() {
+	case bsontype.EmbeddedDocument:
+		f.document(key, val.MutableDocument())
+	case bsontype.Array:
+		iter := val.MutableArray().Iterator()
+		for idx := 0; iter.Next(); idx++ {
+			f.value(key+"."+strconv.Itoa(idx), iter.Value())
+		}
+	case bsontype.Int32:
+		f.add(key, float64(val.Int32()))
+	case bsontype.Int64:
+		f.add(key, float64(val.Int64()))
+	case bsontype.Double:
+		f.add(key, val.Double())
+	case bsontype.Boolean:
+		if val.Boolean() {
+			f.add(key, 1)
+		} else {
+			f.add(key, 0)
+		}
+	case bsontype.DateTime:
+		if f.ts.IsZero() && (f.timeKey == "" || f.timeKey == key) {
+			f.ts = val.Time()
+		}
+		f.add(key, float64(val.DateTime()))
+	}
+}
+
+func (f *flattener) add(key string, value float64) {
+	f.keys = append(f.keys, key)
+	f.values = append(f.values, value)
+}
@@ -0,0 +1,282 @@
+// Package window provides an in-memory store of the most recent
+// samples of a collector, so that agents can answer questions about
+// recent values of metrics (e.g. the average over the last five
+// minutes) without reading FTDC files.
+package window
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Options configure a Store.
+type Options struct {
+	// Duration is the span of time, measured back from the newest
+	// sample, that the store retains. Defaults to five minutes.
+	Duration time.Duration
+	// MaxSamples is the capacity of the store's ring buffer: when
+	// the store is full, each sample replaces the oldest sample,
+	// even if the oldest sample is within the duration. Defaults
+	// to 3600 (i.e. one hour of samples at one second intervals.)
+	MaxSamples int
+	// TimeKey is the flattened name of the date time metric that
+	// holds the time of each sample. If empty, the store uses the
+	// first date time metric of each sample, or the time that the
+	// sample was added if the sample has no date time metrics.
+	TimeKey string
+}
+
+// Validate ensures that the options are reasonable, and sets default
+// values.
+func (opts *Options) Validate() error {
+	if opts.Duration < 0 {
+		return errors.New("duration must not be negative")
+	}
+	if opts.MaxSamples < 0 {
+		return errors.New("maximum samples must not be negative")
+	}
+
+	if opts.Duration == 0 {
+		opts.Duration = 5 * time.Minute
+	}
+	if opts.MaxSamples == 0 {
+		opts.MaxSamples = 3600
+	}
+
+	return nil
+}
+
+// Point is the value of a metric at the time of a sample.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// schema holds the keys of samples, which consecutive samples with
+// the same keys share.
+type schema struct {
+	keys  []string
+	index map[string]int
+}
+
+func (s *schema) equal(keys []string) bool {
+	if s == nil || len(s.keys) != len(keys) {
+		return false
+	}
+	for idx := range keys {
+		if s.keys[idx] != keys[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+type sample struct {
+	ts     time.Time
+	schema *schema
+	values []float64
+}
+
+func (s *sample) value(key string) (float64, bool) {
+	idx, ok := s.schema.index[key]
+	if !ok {
+		return 0, false
+	}
+	return s.values[idx], true
+}
+
+// Store retains the samples of the last Duration in a fixed size ring
+// buffer, and answers queries about the values of their metrics.
+// Metrics are identified by their flattened names (e.g.
+// "mem.resident"), as with Metric.Key(). Numeric, boolean (as 0 or
+// 1), and date time (as milliseconds since the epoch) values are
+// stored as floating point numbers, and all other values are
+// ignored.
+//
+// Queries take a window, measured back from the newest sample, and
+// consider all retained samples when the window is zero. Stores are
+// safe for concurrent use.
+type Store struct {
+	opts    Options
+	mu      sync.RWMutex
+	samples []sample
+	start   int
+	count   int
+	now     func() time.Time
+}
+
+// NewStore constructs an empty store, returning an error if the
+// options are not valid. Feed the store with Add, or wrap a collector
+// with NewTeeCollector.
+func NewStore(opts Options) (*Store, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid options")
+	}
+
+	return &Store{
+		opts:    opts,
+		samples: make([]sample, opts.MaxSamples),
+		now:     time.Now,
+	}, nil
+}
+
+// Add decodes a sample, which may be any value that a collector
+// accepts, and adds it to the store, evicting the samples that fall
+// outside of the store's duration.
+func (s *Store) Add(in interface{}) error {
+	doc, err := readDocument(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	keys, values, ts := flatten(doc, s.opts.TimeKey)
+	if ts.IsZero() {
+		ts = s.now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var previous *schema
+	if s.count > 0 {
+		previous = s.at(s.count - 1).schema
+	}
+	if !previous.equal(keys) {
+		previous = &schema{keys: keys, index: make(map[string]int, len(keys))}
+		for idx, key := range keys {
+			previous.index[key] = idx
+		}
+	}
+
+	if s.count == len(s.samples) {
+		s.start = (s.start + 1) % len(s.samples)
+		s.count--
+	}
+	*s.at(s.count) = sample{ts: ts, schema: previous, values: values}
+	s.count++
+
+	horizon := ts.Add(-s.opts.Duration)
+	for s.count > 1 && s.at(0).ts.Before(horizon) {
+		*s.at(0) = sample{}
+		s.start = (s.start + 1) % len(s.samples)
+		s.count--
+	}
+
+	return nil
+}
+
+// at returns the sample at the position, where 0 is the oldest
+// sample. The caller must hold the lock.
+func (s *Store) at(idx int) *sample { return &s.samples[(s.start+idx)%len(s.samples)] }
+
+// Len returns the number of samples in the store.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.count
+}
+
+// Keys returns the flattened names of the metrics of the newest
+// sample, in the order of the sample.
+func (s *Store) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.count == 0 {
+		return nil
+	}
+
+	return append([]string(nil), s.at(s.count-1).schema.keys...)
+}
+
+// Latest returns the newest value of the metric, and the time of its
+// sample, and false if no sample in the store has the metric.
+func (s *Store) Latest(key string) (Point, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for idx := s.count - 1; idx >= 0; idx-- {
+		sample := s.at(idx)
+		if value, ok := sample.value(key); ok {
+			return Point{Time: sample.ts, Value: value}, true
+		}
+	}
+
+	return Point{}, false
+}
+
+// Series returns the values of the metric within the window, from the
+// oldest to the newest, omitting samples without the metric.
+func (s *Store) Series(key string, window time.Duration) []Point {
+	out := []Point{}
+	s.each(key, window, func(ts time.Time, value float64) {
+		out = append(out, Point{Time: ts, Value: value})
+	})
+	return out
+}
+
+// Min returns the minimum value of the metric within the window, and
+// false if no sample within the window has the metric.
+func (s *Store) Min(key string, window time.Duration) (float64, bool) {
+	min, count := math.Inf(1), 0
+	s.each(key, window, func(_ time.Time, value float64) {
+		min = math.Min(min, value)
+		count++
+	})
+	return min, count > 0
+}
+
+// Max returns the maximum value of the metric within the window, and
+// false if no sample within the window has the metric.
+func (s *Store) Max(key string, window time.Duration) (float64, bool) {
+	max, count := math.Inf(-1), 0
+	s.each(key, window, func(_ time.Time, value float64) {
+		max = math.Max(max, value)
+		count++
+	})
+	return max, count > 0
+}
+
+// Avg returns the mean value of the metric within the window, and
+// false if no sample within the window has the metric.
+func (s *Store) Avg(key string, window time.Duration) (float64, bool) {
+	sum, count := 0.0, 0
+	s.each(key, window, func(_ time.Time, value float64) {
+		sum += value
+		count++
+	})
+	if count == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
+
+// each calls the function with the values of the metric within the
+// window, from the oldest to the newest.
+func (s *Store) each(key string, window time.Duration, fn func(time.Time, float64)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.count == 0 {
+		return
+	}
+
+	var horizon time.Time
+	if window > 0 {
+		horizon = s.at(s.count - 1).ts.Add(-window)
+	}
+
+	for idx := 0; idx < s.count; idx++ {
+		sample := s.at(idx)
+		if sample.ts.Before(horizon) {
+			continue
+		}
+		if value, ok := sample.value(key); ok {
+			fn(sample.ts, value)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package window
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/ftdc"
+	"github.com/mongodb/ftdc/bsonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	base := time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(i int) *bsonx.Document {
+		return bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Duration(i)*time.Second)),
+			bsonx.EC.Int64("ops", int64(i)),
+			bsonx.EC.SubDocumentFromElements("mem",
+				bsonx.EC.Double("ratio", float64(i)/2),
+				bsonx.EC.Boolean("ok", i%2 == 0),
+			),
+			bsonx.EC.ArrayFromElements("cpus", bsonx.VC.Int32(int32(i)), bsonx.VC.Int32(int32(2*i))),
+			bsonx.EC.String("host", "example"),
+		)
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		_, err := NewStore(Options{Duration: -time.Second})
+		assert.Error(t, err)
+		_, err = NewStore(Options{MaxSamples: -1})
+		assert.Error(t, err)
+	})
+	t.Run("Empty", func(t *testing.T) {
+		store, err := NewStore(Options{})
+		require.NoError(t, err)
+		assert.Zero(t, store.Len())
+		assert.Empty(t, store.Keys())
+		_, ok := store.Latest("ops")
+		assert.False(t, ok)
+		_, ok = store.Avg("ops", 0)
+		assert.False(t, ok)
+		assert.Empty(t, store.Series("ops", 0))
+	})
+	t.Run("Queries", func(t *testing.T) {
+		store, err := NewStore(Options{Duration: time.Minute})
+		require.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, store.Add(sample(i)))
+		}
+
+		assert.Equal(t, 10, store.Len())
+		assert.Equal(t, []string{"ts", "ops", "mem.ratio", "mem.ok", "cpus.0", "cpus.1"}, store.Keys())
+
+		latest, ok := store.Latest("cpus.1")
+		require.True(t, ok)
+		assert.Equal(t, 18.0, latest.Value)
+		assert.True(t, base.Add(9*time.Second).Equal(latest.Time))
+		_, ok = store.Latest("host")
+		assert.False(t, ok, "strings are not stored")
+
+		min, ok := store.Min("ops", 0)
+		require.True(t, ok)
+		assert.Equal(t, 0.0, min)
+		max, ok := store.Max("ops", 0)
+		require.True(t, ok)
+		assert.Equal(t, 9.0, max)
+		avg, ok := store.Avg("ops", 0)
+		require.True(t, ok)
+		assert.Equal(t, 4.5, avg)
+
+		avg, ok = store.Avg("ops", 4*time.Second)
+		require.True(t, ok)
+		assert.Equal(t, 7.0, avg, "windows are measured from the newest sample")
+		min, _ = store.Min("mem.ratio", 2*time.Second)
+		assert.Equal(t, 3.5, min)
+		avg, _ = store.Avg("mem.ok", 0)
+		assert.Equal(t, 0.5, avg)
+
+		series := store.Series("ops", 2*time.Second)
+		require.Len(t, series, 3)
+		for i, point := range series {
+			assert.Equal(t, float64(7+i), point.Value)
+			assert.True(t, base.Add(time.Duration(7+i)*time.Second).Equal(point.Time))
+		}
+	})
+	t.Run("EvictsByDuration", func(t *testing.T) {
+		store, err := NewStore(Options{Duration: 5 * time.Second})
+		require.NoError(t, err)
+		for i := 0; i < 20; i++ {
+			require.NoError(t, store.Add(sample(i)))
+		}
+
+		assert.Equal(t, 6, store.Len())
+		series := store.Series("ops", 0)
+		require.Len(t, series, 6)
+		assert.Equal(t, 14.0, series[0].Value)
+		assert.Equal(t, 19.0, series[5].Value)
+	})
+	t.Run("EvictsByCapacity", func(t *testing.T) {
+		store, err := NewStore(Options{Duration: time.Hour, MaxSamples: 4})
+		require.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, store.Add(sample(i)))
+		}
+
+		assert.Equal(t, 4, store.Len())
+		min, _ := store.Min("ops", 0)
+		assert.Equal(t, 6.0, min)
+	})
+	t.Run("SchemaChanges", func(t *testing.T) {
+		store, err := NewStore(Options{})
+		require.NoError(t, err)
+		require.NoError(t, store.Add(sample(0)))
+		require.NoError(t, store.Add(bsonx.NewDocument(
+			bsonx.EC.Time("ts", base.Add(time.Second)),
+			bsonx.EC.Int64("conns", 3),
+		)))
+		require.NoError(t, store.Add(sample(2)))
+
+		assert.Len(t, store.Keys(), 6)
+		assert.Len(t, store.Series("ops", 0), 2, "samples without the metric are omitted")
+		latest, ok := store.Latest("conns")
+		require.True(t, ok)
+		assert.Equal(t, 3.0, latest.Value)
+		assert.True(t, base.Add(time.Second).Equal(latest.Time))
+	})
+	t.Run("TimeKey", func(t *testing.T) {
+		store, err := NewStore(Options{TimeKey: "end"})
+		require.NoError(t, err)
+		now := base.Add(2 * time.Minute)
+		store.now = func() time.Time { return now }
+
+		require.NoError(t, store.Add(bsonx.NewDocument(
+			bsonx.EC.Time("start", base),
+			bsonx.EC.Time("end", base.Add(time.Minute)),
+		)))
+		require.NoError(t, store.Add(bsonx.NewDocument(bsonx.EC.Int32("value", 1))))
+
+		series := store.Series("start", 0)
+		require.Len(t, series, 1)
+		assert.True(t, base.Add(time.Minute).Equal(series[0].Time))
+		latest, ok := store.Latest("value")
+		require.True(t, ok)
+		assert.True(t, now.Equal(latest.Time), "samples without a time use the current time")
+	})
+}
+
+func TestTeeCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store, err := NewStore(Options{})
+	require.NoError(t, err)
+	collector := NewTeeCollector(store, ftdc.NewBaseCollector(100))
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, collector.Add(bsonx.NewDocument(
+			bsonx.EC.Time("ts", time.Now()),
+			bsonx.EC.Int64("ops", int64(i)),
+		)))
+	}
+	require.NoError(t, collector.Add(struct {
+		TS  time.Time `bson:"ts"`
+		Ops int64     `bson:"ops"`
+	}{TS: time.Now(), Ops: 10}))
+	assert.Error(t, collector.Add(bsonx.NewDocument(bsonx.EC.String("ops", "value"))))
+
+	assert.Equal(t, 11, store.Len())
+	latest, ok := store.Latest("ops")
+	require.True(t, ok)
+	assert.Equal(t, 10.0, latest.Value)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, ftdc.FlushCollector(collector, buf))
+	iter := ftdc.ReadChunks(ctx, bytes.NewReader(buf.Bytes()))
+	defer iter.Close()
+	count := 0
+	for iter.Next() {
+		count += iter.Chunk().Size()
+	}
+	require.NoError(t, iter.Err())
+	assert.Equal(t, 11, count)
+}